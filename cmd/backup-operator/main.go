@@ -16,6 +16,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"net/http"
 	"os"
 	"runtime"
 	"time"
@@ -25,6 +27,7 @@ import (
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 	version "github.com/coreos/etcd-operator/version/backup-operator"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
@@ -35,6 +38,13 @@ import (
 	"k8s.io/client-go/tools/record"
 )
 
+var listenAddr string
+
+func init() {
+	flag.StringVar(&listenAddr, "listen-addr", "0.0.0.0:8080", "The address on which the HTTP server serving the backup metrics will listen to")
+	flag.Parse()
+}
+
 func main() {
 	namespace := os.Getenv(constants.EnvOperatorPodNamespace)
 	if len(namespace) == 0 {
@@ -54,6 +64,9 @@ func main() {
 	logrus.Infof("etcd-backup-operator Version: %v", version.Version)
 	logrus.Infof("Git SHA: %s", version.GitSHA)
 
+	http.Handle("/metrics", prometheus.Handler())
+	go http.ListenAndServe(listenAddr, nil)
+
 	kubecli := k8sutil.MustNewKubeClient()
 	rl, err := resourcelock.New(
 		resourcelock.EndpointsResourceLock,
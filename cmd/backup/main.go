@@ -20,25 +20,44 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup"
 	"github.com/coreos/etcd-operator/pkg/backup/env"
+	"github.com/coreos/etcd-operator/pkg/backup/server"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 	"github.com/coreos/etcd-operator/version"
 
 	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 var (
 	masterHost  string
 	clusterName string
 	listenAddr  string
-	namespace   string
+	// healthListenAddr is where the health checks are served without TLS if the HTTP API requires client certificates.
+	healthListenAddr string
+	// snapshotListenAddr is where etcd members download the latest backup from.
+	snapshotListenAddr string
+	namespace          string
 	// serveBackupOnly flag indicates that this backup service only serves
 	// http backup requests.
 	serveBackupOnly bool
+	// logFormat is the format of the logs, "text" or "json".
+	logFormat string
+	// drainTimeout is how long the backup in progress when the sidecar is terminated is given to finish.
+	drainTimeout time.Duration
+	// backendName overrides the storage of the backup policy. Only "null" is supported.
+	backendName string
 
 	printVersion bool
 )
@@ -47,6 +66,11 @@ func init() {
 	flag.StringVar(&masterHost, "master", "", "API Server addr, e.g. ' - NOT RECOMMENDED FOR PRODUCTION - http://127.0.0.1:8080'. Omit parameter to run in on-cluster mode and utilize the service account token.")
 	flag.StringVar(&clusterName, "etcd-cluster", "", "")
 	flag.StringVar(&listenAddr, "listen", "0.0.0.0:19999", "")
+	flag.StringVar(&healthListenAddr, "health-listen", fmt.Sprintf("0.0.0.0:%d", constants.DefaultBackupPodHealthPort), "Address to also serve the health checks on without TLS if the HTTP API requires client certificates.")
+	flag.StringVar(&snapshotListenAddr, "snapshot-listen", fmt.Sprintf("0.0.0.0:%d", constants.DefaultBackupPodSnapshotPort), "Address to serve the latest backup to etcd members on. It uses the cluster's client TLS if enabled.")
+	flag.StringVar(&logFormat, "log-format", "text", "Format of the logs, text or json. The json format suits log aggregation.")
+	flag.DurationVar(&drainTimeout, "drain-timeout", 25*time.Second, "How long the backup in progress when the sidecar is terminated is given to finish before it is cancelled and deleted. It should be shorter than the termination grace period of the pod.")
+	flag.StringVar(&backendName, "backend", "", "Storage to save the backups in instead of the one of the backup policy. Only null is supported, which discards the backups to benchmark the snapshot throughput.")
 	flag.BoolVar(&printVersion, "version", false, "Show version and quit")
 
 	flag.Parse()
@@ -67,17 +91,38 @@ func main() {
 		panic("clusterName not set")
 	}
 
+	switch logFormat {
+	case "text":
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		logrus.Fatalf("unknown log format (%s), must be text or json", logFormat)
+	}
+
+	switch backendName {
+	case "":
+	case "null":
+		logrus.Warning("backups are discarded by the null backend")
+	default:
+		logrus.Fatalf("unknown backend (%s), must be null", backendName)
+	}
+
 	bp, tls, err := parseSpecsFromEnv()
 	if err != nil {
 		logrus.Fatalf("failed to parse specs from environment: %v", err)
 	}
+	kubecli := k8sutil.MustNewKubeClient()
 	bc := &backup.BackupControllerConfig{
-		Kubecli:      k8sutil.MustNewKubeClient(),
-		ListenAddr:   listenAddr,
-		ClusterName:  clusterName,
-		Namespace:    namespace,
-		TLS:          tls,
-		BackupPolicy: bp,
+		Kubecli:          kubecli,
+		ListenAddr:       listenAddr,
+		HealthListenAddr: healthListenAddr,
+		ClusterName:      clusterName,
+		Namespace:        namespace,
+		TLS:              tls,
+		BackupPolicy:     bp,
+		DrainTimeout:     drainTimeout,
+		EventRecorder:    createRecorder(kubecli, namespace),
+		NullBackend:      backendName == "null",
 	}
 
 	bk, err := backup.NewBackupController(bc)
@@ -85,15 +130,40 @@ func main() {
 		logrus.Fatalf("failed to create backup sidecar: %v", err)
 	}
 
-	ctx := context.Background()
+	// once the sidecar is terminated, no backup is started anymore. The backup being saved then is given
+	// the drain timeout to finish, and is cancelled after it, so that its upload is aborted instead of being left partial.
+	ctx, cancel := context.WithCancel(context.Background())
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		logrus.Infof("received %v, stopping", <-sigc)
+		cancel()
+	}()
+
+	go bk.WatchTLS(ctx)
 	go bk.StartHTTP()
+	go func() {
+		logrus.Fatalf("snapshot server stopped: %v", server.ListenAndServe(snapshotListenAddr, bk.Backend(), bk.EtcdTLSConfig))
+	}()
 	if !serveBackupOnly {
-		go bk.Run()
+		// the cluster may still be starting, so an invalid backup configuration doesn't stop the sidecar.
+		if err := bk.Validate(ctx); err != nil {
+			logrus.Errorf("backup configuration is invalid: %v", err)
+		}
+		bk.Run(ctx)
+		logrus.Info("stopped")
+		return
 	}
 
 	<-ctx.Done()
 }
 
+func createRecorder(kubecli kubernetes.Interface, namespace string) record.EventRecorder {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: v1core.New(kubecli.Core().RESTClient()).Events(namespace)})
+	return eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "etcd-backup-sidecar"})
+}
+
 // parseSpecsFromEnv parses ClusterSpec and BackupSpec from env if any.
 func parseSpecsFromEnv() (*api.BackupPolicy, *api.TLSPolicy, error) {
 	var (
@@ -0,0 +1,273 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// etcdop-backup takes and restores the backups of an etcd cluster on demand, outside the schedule of
+// its backup sidecar. It reads the backup policy from the same environment as the sidecar, so it
+// can be run in the sidecar pod, e.g. `kubectl exec <sidecar> -- etcdop-backup backup now --etcd-cluster=<name>`.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/env"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/restore"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/version"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	clusterName string
+	namespace   string
+	timeout     time.Duration
+	// clusterSpec is the spec the operator passes to the backup sidecar, with the backup policy.
+	clusterSpec *api.ClusterSpec
+
+	// revision is the revision of the backup to restore or verify. If 0, the latest backup is used.
+	revision int64
+	// backupName is the name of the backup to restore or verify. It can't be set with revision.
+	backupName   string
+	dataDir      string
+	memberName   string
+	etcdVersion  string
+	clusterToken string
+	// force takes a backup even if the cluster has not changed since the latest backup.
+	force bool
+)
+
+func main() {
+	root := &cobra.Command{
+		Use:          "etcdop-backup",
+		Short:        "Take, list, verify and restore the backups of an etcd cluster on demand",
+		SilenceUsage: true,
+	}
+	root.PersistentFlags().StringVar(&clusterName, "etcd-cluster", "", "Name of the etcd cluster")
+	root.PersistentFlags().DurationVar(&timeout, "timeout", 10*time.Minute, "Timeout of taking a backup")
+
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Operate on the backups saved with the backup policy of the cluster",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			clusterSpec, err = clusterSpecFromEnv()
+			return err
+		},
+	}
+	backupCmd.AddCommand(newNowCommand(), newListCommand(), newRestoreCommand(), newVerifyCommand())
+	root.AddCommand(backupCmd, &cobra.Command{
+		Use:   "version",
+		Short: "Show version",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("etcdop-backup", version.Version)
+		},
+	})
+
+	namespace = os.Getenv(constants.EnvOperatorPodNamespace)
+	if len(namespace) == 0 {
+		namespace = "default"
+	}
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newNowCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "now",
+		Short: "Take a backup if the cluster has changed since the latest backup, or regardless with --force",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bc, err := newBackupController()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			bs, err := bc.SaveSnapNow(ctx, backup.SaveSnapOptions{Force: force})
+			if err != nil {
+				return err
+			}
+			if bs == nil {
+				fmt.Println("skipped creating new backup: no change since the latest backup")
+				return nil
+			}
+			return json.NewEncoder(os.Stdout).Encode(bs)
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "Take a backup even if the cluster has not changed since the latest backup")
+	return cmd
+}
+
+func newListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the backups in ascending revision order",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bc, err := newBackupController()
+			if err != nil {
+				return err
+			}
+			backups, err := bc.Backend().List()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "REVISION\tVERSION\tSIZE (MB)\tCREATED\tPATH")
+			for _, b := range backups {
+				fmt.Fprintf(w, "%d\t%s\t%.2f\t%s\t%s\n", b.Revision, b.Version, util.ToMB(b.Size), b.CreationTime.Format(time.RFC3339), b.Path)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newRestoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore the data directory of a member from a backup",
+		Long: "Restore the data directory of a member from the backup named --name or taken at --revision, " +
+			"or from the latest backup and the deltas saved on top of it. The etcd binary must be in PATH.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(dataDir) == 0 || len(memberName) == 0 || len(etcdVersion) == 0 {
+				return errors.New("--data-dir, --member-name and --etcd-version must be set")
+			}
+			if len(backupName) != 0 && revision != 0 {
+				return errors.New("--name and --revision can't be both set")
+			}
+			bc, err := newBackupController()
+			if err != nil {
+				return err
+			}
+			m := &etcdutil.Member{Name: memberName, Namespace: namespace, SecurePeer: clusterSpec.TLS.IsSecurePeer()}
+			rm := restore.NewRestoreManager(bc.Backend(), etcdVersion, m, clusterToken, dataDir)
+			var name string
+			switch {
+			case len(backupName) != 0:
+				name, err = rm.RestoreFromName(backupName)
+			case revision != 0:
+				name, err = rm.RestoreFromRevision(revision)
+			default:
+				name, err = rm.RestoreFromLatest()
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("restored %s from backup %s\n", dataDir, name)
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&revision, "revision", 0, "Revision of the backup to restore from. If 0, the latest backup is used")
+	cmd.Flags().StringVar(&backupName, "name", "", "Name of the backup to restore from, e.g. 3.1.8_0000000000000001_etcd.backup")
+	cmd.Flags().StringVar(&dataDir, "data-dir", "", "Data directory to restore, which must not exist")
+	cmd.Flags().StringVar(&memberName, "member-name", "", "Name of the member whose data directory is restored")
+	cmd.Flags().StringVar(&etcdVersion, "etcd-version", "", "Version of etcd the member runs, which the backup must be compatible with")
+	cmd.Flags().StringVar(&clusterToken, "cluster-token", "", "Initial cluster token of the cluster")
+	return cmd
+}
+
+func newVerifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify a backup against the checksum saved with it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bc, err := newBackupController()
+			if err != nil {
+				return err
+			}
+			if len(backupName) != 0 && revision != 0 {
+				return errors.New("--name and --revision can't be both set")
+			}
+			b, err := findBackup(bc.Backend(), revision, backupName)
+			if err != nil {
+				return err
+			}
+			if err = bc.BackupManager().VerifyBackup(b.Name); err != nil {
+				return fmt.Errorf("backup (%s) is invalid: %v", b.Path, err)
+			}
+			fmt.Printf("backup %s matches its checksum\n", b.Path)
+			return nil
+		},
+	}
+	cmd.Flags().Int64Var(&revision, "revision", 0, "Revision of the backup to verify. If 0, the latest backup is verified")
+	cmd.Flags().StringVar(&backupName, "name", "", "Name of the backup to verify, e.g. 3.1.8_0000000000000001_etcd.backup")
+	return cmd
+}
+
+// findBackup returns the backup of the given name if not empty, the backup taken at rev,
+// or the latest backup if rev is 0.
+func findBackup(be backend.Backend, rev int64, name string) (*backend.BackupMeta, error) {
+	backups, err := be.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) == 0 {
+		return nil, errors.New("no backup found")
+	}
+	if len(name) != 0 {
+		for i := range backups {
+			if backups[i].Name == name {
+				return &backups[i], nil
+			}
+		}
+		return nil, fmt.Errorf("no backup found named %s", name)
+	}
+	if rev == 0 {
+		return &backups[len(backups)-1], nil
+	}
+	for i := range backups {
+		if backups[i].Revision == rev {
+			return &backups[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no backup found at revision %d", rev)
+}
+
+// newBackupController creates the BackupController of the cluster with the backup policy in clusterSpec.
+func newBackupController() (*backup.BackupController, error) {
+	return backup.NewBackupController(&backup.BackupControllerConfig{
+		Kubecli:      k8sutil.MustNewKubeClient(),
+		ClusterName:  clusterName,
+		Namespace:    namespace,
+		TLS:          clusterSpec.TLS,
+		BackupPolicy: clusterSpec.Backup,
+	})
+}
+
+// clusterSpecFromEnv parses the cluster spec the operator passes to the backup sidecar.
+func clusterSpecFromEnv() (*api.ClusterSpec, error) {
+	if len(clusterName) == 0 {
+		return nil, errors.New("--etcd-cluster must be set")
+	}
+	sps := os.Getenv(env.ClusterSpec)
+	var cs api.ClusterSpec
+	if err := json.Unmarshal([]byte(sps), &cs); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster spec (%s): %v", sps, err)
+	}
+	if cs.Backup == nil {
+		return nil, errors.New("backup policy not found")
+	}
+	return &cs, nil
+}
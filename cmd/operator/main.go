@@ -50,8 +50,12 @@ import (
 )
 
 var (
-	namespace  string
-	name       string
+	// namespace and name are of the operator pod.
+	namespace string
+	name      string
+	// watchNamespace is the namespace of the EtcdClusters the operator manages.
+	watchNamespace string
+
 	listenAddr string
 	gcInterval time.Duration
 
@@ -60,16 +64,25 @@ var (
 	printVersion bool
 
 	createCRD bool
+
+	memberFailureThreshold    time.Duration
+	maxConcurrentReplacements int
+
+	generatePerClusterRBAC bool
 )
 
 func init() {
 	flag.StringVar(&debug.DebugFilePath, "debug-logfile-path", "", "only for a self hosted cluster, the path where the debug logfile will be written, recommended to be under: /var/tmp/etcd-operator/debug/ to avoid any issue with lack of write permissions")
+	flag.StringVar(&watchNamespace, "namespace", "", "The namespace of the EtcdClusters the operator watches and manages. If empty, the namespace of the operator pod is watched")
 	flag.StringVar(&listenAddr, "listen-addr", "0.0.0.0:8080", "The address on which the HTTP server will listen to")
 	// chaos level will be removed once we have a formal tool to inject failures.
 	flag.IntVar(&chaosLevel, "chaos-level", -1, "DO NOT USE IN PRODUCTION - level of chaos injected into the etcd clusters created by the operator.")
 	flag.BoolVar(&printVersion, "version", false, "Show version and quit")
 	flag.BoolVar(&createCRD, "create-crd", true, "The operator will not create the EtcdCluster CRD when this flag is set to false.")
 	flag.DurationVar(&gcInterval, "gc-interval", 10*time.Minute, "GC interval")
+	flag.DurationVar(&memberFailureThreshold, "member-failure-threshold", 5*time.Minute, "How long an etcd member's pod can stay pending before the member is replaced. 0 disables the replacement.")
+	flag.IntVar(&maxConcurrentReplacements, "max-concurrent-replacements", 1, "The max number of failed etcd members of a cluster being replaced at the same time")
+	flag.BoolVar(&generatePerClusterRBAC, "generate-per-cluster-rbac", false, "Run the backup sidecar of each cluster with a ServiceAccount of its own, granted only the permissions the sidecar needs, instead of the ServiceAccount of the operator")
 	flag.Parse()
 }
 
@@ -82,6 +95,9 @@ func main() {
 	if len(name) == 0 {
 		logrus.Fatalf("must set env (%s)", constants.EnvOperatorPodName)
 	}
+	if len(watchNamespace) == 0 {
+		watchNamespace = namespace
+	}
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c)
@@ -102,6 +118,7 @@ func main() {
 	logrus.Infof("Git SHA: %s", version.GitSHA)
 	logrus.Infof("Go Version: %s", runtime.Version())
 	logrus.Infof("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH)
+	logrus.Infof("watching EtcdClusters in namespace (%s)", watchNamespace)
 
 	id, err := os.Hostname()
 	if err != nil {
@@ -163,12 +180,17 @@ func newControllerConfig() controller.Config {
 	}
 
 	cfg := controller.Config{
-		Namespace:      namespace,
+		Namespace:      watchNamespace,
 		ServiceAccount: serviceAccount,
 		KubeCli:        kubecli,
 		KubeExtCli:     k8sutil.MustNewKubeExtClient(),
 		EtcdCRCli:      client.MustNewInCluster(),
 		CreateCRD:      createCRD,
+
+		MemberFailureThreshold:    memberFailureThreshold,
+		MaxConcurrentReplacements: maxConcurrentReplacements,
+
+		GeneratePerClusterRBAC: generatePerClusterRBAC,
 	}
 
 	return cfg
@@ -14,7 +14,14 @@
 
 package v1beta2
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"github.com/robfig/cron"
+)
 
 type BackupStorageType string
 
@@ -23,14 +30,57 @@ const (
 	BackupStorageTypePersistentVolume = "PersistentVolume"
 	BackupStorageTypeS3               = "S3"
 	BackupStorageTypeABS              = "ABS"
+	BackupStorageTypeGCS              = "GCS"
+	BackupStorageTypeSwift            = "Swift"
+	BackupStorageTypeOSS              = "OSS"
+	BackupStorageTypeSFTP             = "SFTP"
 
 	AWSSecretCredentialsFileName = "credentials"
 	AWSSecretConfigFileName      = "config"
+	// AWSSecretCABundleFileName is the optional PEM encoded CA bundle in the AWS secret
+	// used to verify a S3 compatible endpoint with a self-signed certificate.
+	AWSSecretCABundleFileName = "ca-bundle.pem"
 
 	// ABSStorageAccount defines the key for the Azure Storage Account value in the ABS Kubernetes secret
 	ABSStorageAccount = "storage-account"
 	// ABSStorageKey defines the key for the Azure Storage Key value in the ABS Kubernetes secret
 	ABSStorageKey = "storage-key"
+	// GCPSecretCredentialsFileName defines the key for the GCP service account JSON key in the GCS Kubernetes secret
+	GCPSecretCredentialsFileName = "credentials.json"
+	// VaultSecretTokenFileName defines the key for the Vault token in the Vault token Kubernetes secret
+	VaultSecretTokenFileName = "token"
+
+	// SwiftAuthURL defines the key for the Keystone v3 auth URL in the Swift Kubernetes secret
+	SwiftAuthURL = "auth-url"
+	// SwiftUsername defines the key for the Keystone username in the Swift Kubernetes secret
+	SwiftUsername = "username"
+	// SwiftPassword defines the key for the Keystone password in the Swift Kubernetes secret
+	SwiftPassword = "password"
+	// SwiftDomain defines the key for the Keystone user domain name in the Swift Kubernetes secret
+	SwiftDomain = "domain"
+	// SwiftProject defines the key for the Keystone project name in the Swift Kubernetes secret
+	SwiftProject = "project"
+	// SwiftRegion defines the key for the optional region in the Swift Kubernetes secret
+	SwiftRegion = "region"
+
+	// OSSAccessKeyID defines the key for the Alibaba Cloud AccessKey ID in the OSS Kubernetes secret
+	OSSAccessKeyID = "access-key-id"
+	// OSSAccessKeySecret defines the key for the Alibaba Cloud AccessKey secret in the OSS Kubernetes secret
+	OSSAccessKeySecret = "access-key-secret"
+
+	// SFTPUsername defines the key for the SSH username in the SFTP Kubernetes secret
+	SFTPUsername = "username"
+	// SFTPPassword defines the key for the optional SSH password in the SFTP Kubernetes secret
+	SFTPPassword = "password"
+	// SFTPPrivateKey defines the key for the optional PEM encoded SSH private key in the SFTP Kubernetes secret
+	SFTPPrivateKey = "private-key"
+	// SFTPHostKey defines the key for the SSH host public key, in authorized_keys format, in the SFTP Kubernetes secret
+	SFTPHostKey = "host-key"
+
+	// EtcdAuthUsername defines the key for the etcd username in the etcd auth Kubernetes secret
+	EtcdAuthUsername = "username"
+	// EtcdAuthPassword defines the key for the etcd password in the etcd auth Kubernetes secret
+	EtcdAuthPassword = "password"
 )
 
 var (
@@ -52,11 +102,147 @@ type BackupPolicy struct {
 	// The default interval is 1800 seconds.
 	BackupIntervalInSecond int `json:"backupIntervalInSecond"`
 
+	// BackupSchedule is the cron expression of when backups are taken, in UTC, e.g. "0 2 * * *" for
+	// every day at 02:00 or "@hourly". It can't be set along with BackupIntervalInSecond.
+	BackupSchedule string `json:"backupSchedule,omitempty"`
+
+	// If greater than 0, MinBackupIntervalInSecond is the minimum time between two backups, so that a backup
+	// is skipped until this long after the latest backup even if the revision of the cluster moved.
+	MinBackupIntervalInSecond int `json:"minBackupIntervalInSecond,omitempty"`
+
+	// If greater than 0, MinRevisionDelta is the minimum number of revisions between two backups, so that a backup
+	// is skipped until the revision of the cluster moved this far past the latest backup.
+	// A backup is saved only once both MinBackupIntervalInSecond and MinRevisionDelta are met.
+	MinRevisionDelta int64 `json:"minRevisionDelta,omitempty"`
+
 	// If greater than 0, MaxBackups is the maximum number of backup files to retain.
 	// If equal to 0, it means unlimited backups.
 	// Otherwise, it is invalid.
 	MaxBackups int `json:"maxBackups"`
 
+	// If greater than 0, MaxBackupAgeInDays is the maximum age of backup files to retain.
+	// The latest backup is always retained regardless of its age.
+	// If equal to 0, backup files are retained regardless of their age.
+	MaxBackupAgeInDays int `json:"maxBackupAgeInDays,omitempty"`
+
+	// If greater than 0, MaxDeltas is the maximum number of deltas, i.e. the changes since the
+	// previous backup, saved on top of a full backup before the next full backup is taken.
+	// If equal to 0, every backup is a full backup.
+	MaxDeltas int `json:"maxDeltas,omitempty"`
+
+	// MaxBackupRevisionLag is how many revisions behind the member with max revision a follower with a backup
+	// priority may be to still be preferred for taking the snapshots, which spares the leader.
+	// If equal to 0, a follower is only preferred if it is at the max revision. See PodPolicy.BackupPriority.
+	MaxBackupRevisionLag int64 `json:"maxBackupRevisionLag,omitempty"`
+
+	// AutoCompact tells whether to compact the cluster up to the revision of each backup once it is saved,
+	// so that the following backups don't carry the history which is already backed up.
+	// The history before the latest backup is then no longer available to the clients of the cluster.
+	AutoCompact bool `json:"autoCompact,omitempty"`
+	// CompactionTimeoutInSecond is the timeout of each compaction. The default timeout is 60 seconds.
+	CompactionTimeoutInSecond int `json:"compactionTimeoutInSecond,omitempty"`
+
+	// DefragBeforeBackup tells whether to defragment the member each full backup is taken from before the
+	// snapshot, so that the snapshot doesn't carry the free pages of its database. The leader and a member
+	// without a leader are not defragmented. Failing to defragment does not fail the backup.
+	DefragBeforeBackup bool `json:"defragBeforeBackup,omitempty"`
+	// DefragTimeoutInSecond is the timeout of each defragmentation, after which the snapshot is taken anyway.
+	// The default timeout is 60 seconds.
+	DefragTimeoutInSecond int `json:"defragTimeoutInSecond,omitempty"`
+
+	// FailOnNoSpaceAlarm tells whether to report the backups taken while etcd raised a NOSPACE alarm as failed,
+	// so that the alerting on the failed backups fires. The backups are saved anyway.
+	// A CORRUPT alarm always fails the backups, which are then not saved.
+	FailOnNoSpaceAlarm bool `json:"failOnNoSpaceAlarm,omitempty"`
+
+	// AuthSecret is the name of the Secret in the namespace of the cluster holding the username and password
+	// the backups authenticate to etcd with, where the etcd authentication is enabled. The user needs the
+	// permissions to take snapshots and to read the revision of the keys, e.g. the root role.
+	AuthSecret string `json:"authSecret,omitempty"`
+
+	// If greater than 0, MinSnapshotThroughputInKBPerSecond scales the timeout of each backup with the size of
+	// the database: it is 60 seconds plus the time to receive and save the database at this throughput.
+	// If equal to 0, the timeout is 60 seconds regardless of the size of the database.
+	MinSnapshotThroughputInKBPerSecond int `json:"minSnapshotThroughputInKBPerSecond,omitempty"`
+	// MinSnapshotTimeoutInSecond is the floor of the scaled timeout of each backup.
+	MinSnapshotTimeoutInSecond int `json:"minSnapshotTimeoutInSecond,omitempty"`
+	// If greater than 0, MaxSnapshotTimeoutInSecond is the ceiling of the scaled timeout of each backup.
+	MaxSnapshotTimeoutInSecond int `json:"maxSnapshotTimeoutInSecond,omitempty"`
+
+	// MaxUploadAttempts is the maximum number of attempts to upload a backup which fails with a transient
+	// error, e.g. a timeout or a server error of the storage. Each attempt takes a new snapshot.
+	// A snapshot which fails to be received from etcd, e.g. because the member restarted, is taken again
+	// from the member with max revision, within the same attempts.
+	// It also bounds the attempts to read the latest backup from the storage before a backup.
+	// If equal to 0, a backup is attempted 3 times.
+	MaxUploadAttempts int `json:"maxUploadAttempts,omitempty"`
+	// UploadBackoffInSecond is the wait before the first retry of an upload, which doubles after each retry.
+	// If equal to 0, the first retry waits 1 second.
+	UploadBackoffInSecond int `json:"uploadBackoffInSecond,omitempty"`
+	// If greater than 0, FailureBackoffInSecond is the wait after a failed backup during which the scheduled
+	// backups are skipped, so that a sustained failure of etcd or the storage is not hit on every scheduled time.
+	// It doubles after each consecutive failed backup, with some jitter, and is reset by a backup that does not fail.
+	// Backups requested on demand are not delayed.
+	FailureBackoffInSecond int `json:"failureBackoffInSecond,omitempty"`
+	// MaxFailureBackoffInSecond caps the wait of FailureBackoffInSecond. If equal to 0, it is 1 hour.
+	MaxFailureBackoffInSecond int `json:"maxFailureBackoffInSecond,omitempty"`
+
+	// UseServiceEndpoint tells whether the backups are taken through the client service of the cluster
+	// instead of the addresses of its pods, e.g. where the client port of the pods is firewalled.
+	UseServiceEndpoint bool `json:"useServiceEndpoint,omitempty"`
+	// ServiceName is the client service the backups are taken through if UseServiceEndpoint is set.
+	// If empty, the client service the operator creates, <cluster-name>-client, is used.
+	ServiceName string `json:"serviceName,omitempty"`
+	// DiscoverMembers tells whether the members are discovered with the etcd member list through the client
+	// service instead of the pod list if UseServiceEndpoint is set, so that the backups are taken from the member
+	// with max revision instead of the member the service picks, without listing the pods.
+	DiscoverMembers bool `json:"discoverMembers,omitempty"`
+	// ClientPort is the port the backups reach the members at, e.g. where a proxy sidecar serves the clients
+	// of the members on another port than etcd. If equal to 0, the etcd client port 2379 is used.
+	// The client service is still reached at its port 2379.
+	ClientPort int `json:"clientPort,omitempty"`
+	// ClientScheme is the scheme the backups reach the members at, http or https. If empty, https is used
+	// if the cluster uses client TLS, http otherwise.
+	ClientScheme string `json:"clientScheme,omitempty"`
+
+	// RecordMetadata tells whether the status of each backup is recorded in the ConfigMap
+	// <cluster-name>-backup-metadata, labeled with the cluster, for auditing.
+	// The entries of the backups beyond MaxBackups are removed.
+	RecordMetadata bool `json:"recordMetadata,omitempty"`
+
+	// VerifySnapshot tells whether each snapshot is checked for truncation and corruption
+	// after it is saved. A snapshot that fails the check is deleted and the backup fails.
+	VerifySnapshot bool `json:"verifySnapshot,omitempty"`
+
+	// MaxSignedURLTTLInSecond, if greater than 0, makes the backup sidecar serve pre-signed URLs
+	// to download the backups without storage credentials, valid for at most this many seconds.
+	// Only S3 backups without client-side encryption can be downloaded this way.
+	MaxSignedURLTTLInSecond int `json:"maxSignedURLTTLInSecond,omitempty"`
+
+	// HTTPClientCertAuth tells whether the HTTP API of the backup sidecar is served with TLS and only
+	// accepts clients with a certificate signed by the CA of the operator secret of the cluster, like the
+	// snapshot server. The sidecar presents the certificate of the operator secret, which must be valid
+	// for the backup sidecar service, <cluster-name>-backup-sidecar. It requires static client TLS.
+	HTTPClientCertAuth bool `json:"httpClientCertAuth,omitempty"`
+
+	// Compression is how the backups are compressed before they are saved, "gzip", "zstd" or empty for none.
+	// Compressed backups are decompressed transparently when restored.
+	Compression string `json:"compression,omitempty"`
+	// CompressionLevel is the level of the compression: 1 to 9 for gzip, or 1 to 22 for zstd.
+	// If equal to 0, the default level of the compression is used, e.g. 3 for zstd.
+	CompressionLevel int `json:"compressionLevel,omitempty"`
+
+	// BackupNameTemplate is the Go template of the names of the backups, with the variables .Version, .Revision,
+	// .Timestamp, .RFC3339Timestamp, .ClusterName and .ClusterUID,
+	// e.g. "{{.Version}}_{{.Revision}}_{{.ClusterName}}-{{.Timestamp}}_etcd.backup".
+	// The backups are listed and sorted by their names, so the names must start with "{{.Version}}_{{.Revision}}_"
+	// and end with "etcd.backup". If empty, the backups are named "{{.Version}}_{{.Revision}}_etcd.backup".
+	BackupNameTemplate string `json:"backupNameTemplate,omitempty"`
+
+	// Encryption is the key the backups are encrypted with before they are saved.
+	// If not set, the backups are not encrypted.
+	Encryption *BackupEncryption `json:"encryption,omitempty"`
+
 	// AutoDelete tells whether to cleanup backup data if cluster is deleted.
 	// By default (false), operator will keep the backup data.
 	AutoDelete bool `json:"autoDelete"`
@@ -66,6 +252,91 @@ func (bp *BackupPolicy) Validate() error {
 	if bp.MaxBackups < 0 {
 		return errors.New("MaxBackups value should be >= 0")
 	}
+	if bp.CompactionTimeoutInSecond < 0 {
+		return errors.New("CompactionTimeoutInSecond value should be >= 0")
+	}
+	if bp.DefragTimeoutInSecond < 0 {
+		return errors.New("DefragTimeoutInSecond value should be >= 0")
+	}
+	if bp.MaxBackupAgeInDays < 0 {
+		return errors.New("MaxBackupAgeInDays value should be >= 0")
+	}
+	if bp.MaxUploadAttempts < 0 {
+		return errors.New("MaxUploadAttempts value should be >= 0")
+	}
+	if bp.UploadBackoffInSecond < 0 {
+		return errors.New("UploadBackoffInSecond value should be >= 0")
+	}
+	if bp.FailureBackoffInSecond < 0 {
+		return errors.New("FailureBackoffInSecond value should be >= 0")
+	}
+	if bp.MaxFailureBackoffInSecond < 0 {
+		return errors.New("MaxFailureBackoffInSecond value should be >= 0")
+	}
+	if bp.MaxSignedURLTTLInSecond < 0 {
+		return errors.New("MaxSignedURLTTLInSecond value should be >= 0")
+	}
+	if len(bp.ServiceName) != 0 && !bp.UseServiceEndpoint {
+		return errors.New("ServiceName can't be set without UseServiceEndpoint")
+	}
+	if bp.DiscoverMembers && !bp.UseServiceEndpoint {
+		return errors.New("DiscoverMembers can't be set without UseServiceEndpoint")
+	}
+	if bp.ClientPort < 0 || bp.ClientPort > 65535 {
+		return errors.New("ClientPort value should be between 1 and 65535, or 0 for the default")
+	}
+	switch bp.ClientScheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("unsupported ClientScheme (%s), want http or https", bp.ClientScheme)
+	}
+	if bp.MaxDeltas < 0 {
+		return errors.New("MaxDeltas value should be >= 0")
+	}
+	if bp.MinBackupIntervalInSecond < 0 {
+		return errors.New("MinBackupIntervalInSecond value should be >= 0")
+	}
+	if bp.MinRevisionDelta < 0 {
+		return errors.New("MinRevisionDelta value should be >= 0")
+	}
+	if bp.MaxBackupRevisionLag < 0 {
+		return errors.New("MaxBackupRevisionLag value should be >= 0")
+	}
+	if bp.MinSnapshotThroughputInKBPerSecond < 0 {
+		return errors.New("MinSnapshotThroughputInKBPerSecond value should be >= 0")
+	}
+	if bp.MinSnapshotTimeoutInSecond < 0 {
+		return errors.New("MinSnapshotTimeoutInSecond value should be >= 0")
+	}
+	if bp.MaxSnapshotTimeoutInSecond < 0 {
+		return errors.New("MaxSnapshotTimeoutInSecond value should be >= 0")
+	}
+	if bp.MaxSnapshotTimeoutInSecond > 0 && bp.MaxSnapshotTimeoutInSecond < bp.MinSnapshotTimeoutInSecond {
+		return errors.New("MaxSnapshotTimeoutInSecond should be >= MinSnapshotTimeoutInSecond")
+	}
+	if len(bp.BackupSchedule) != 0 {
+		if bp.BackupIntervalInSecond != 0 {
+			return errors.New("BackupSchedule and BackupIntervalInSecond can't be both set")
+		}
+		if _, err := cron.ParseStandard(bp.BackupSchedule); err != nil {
+			return fmt.Errorf("invalid BackupSchedule (%s): %v", bp.BackupSchedule, err)
+		}
+	}
+	if len(bp.BackupNameTemplate) != 0 {
+		if _, err := util.ParseBackupNameTemplate(bp.BackupNameTemplate); err != nil {
+			return fmt.Errorf("invalid BackupNameTemplate (%s): %v", bp.BackupNameTemplate, err)
+		}
+	}
+	if e := bp.Encryption; e != nil {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+	}
+	if bp.StorageType == BackupStorageTypeS3 && bp.S3 != nil {
+		if err := bp.S3.Validate(); err != nil {
+			return err
+		}
+	}
 	if bp.StorageType == BackupStorageTypePersistentVolume {
 		pv := bp.StorageSource.PV
 		if pv == nil || pv.VolumeSizeInMB <= 0 {
@@ -78,6 +349,48 @@ func (bp *BackupPolicy) Validate() error {
 	return nil
 }
 
+// BackupEncryption defines the key the backups are encrypted with. Each backup is encrypted with
+// its own data key, which is encrypted with the given KMS key or the key in the given Secret.
+// The ID of the key is stored in the backup name.
+type BackupEncryption struct {
+	// AWSKMSKeyID is the ID, ARN or alias of the AWS KMS key to encrypt the backups with.
+	// The backup sidecar uses the same AWS credentials and config as the S3 storage.
+	AWSKMSKeyID string `json:"awsKMSKeyID,omitempty"`
+
+	// GCPKMSKeyName is the resource name of the GCP Cloud KMS crypto key to encrypt the backups with,
+	// "projects/*/locations/*/keyRings/*/cryptoKeys/*".
+	// The backup sidecar uses the Application Default Credentials.
+	GCPKMSKeyName string `json:"gcpKMSKeyName,omitempty"`
+
+	// SecretName is the name of the Secret in the namespace of the cluster holding the 32 bytes
+	// AES-256 keys to encrypt the backups with. The ID of a key is its SHA-256 fingerprint.
+	SecretName string `json:"secretName,omitempty"`
+
+	// SecretKey is the key of the data in the Secret holding the key new backups are encrypted with.
+	SecretKey string `json:"secretKey,omitempty"`
+
+	// AcceptedSecretKeys are the keys of the data in the Secret holding the keys the backups
+	// were encrypted with before the key is rotated, so that the older backups remain restorable.
+	AcceptedSecretKeys []string `json:"acceptedSecretKeys,omitempty"`
+}
+
+// Validate checks that exactly one key is set.
+func (e *BackupEncryption) Validate() error {
+	n := 0
+	for _, k := range []string{e.AWSKMSKeyID, e.GCPKMSKeyName, e.SecretName} {
+		if len(k) != 0 {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("backup encryption must set exactly one of awsKMSKeyID, gcpKMSKeyName and secretName")
+	}
+	if len(e.SecretName) != 0 && len(e.SecretKey) == 0 {
+		return errors.New("backup encryption must set secretKey with secretName")
+	}
+	return nil
+}
+
 type StorageSource struct {
 	// PV represents a Persistent Volume resource, operator will claim the
 	// required size before creating the etcd cluster for backup purpose.
@@ -107,7 +420,86 @@ type S3Source struct {
 	// The profile to use in both files will be 'default'.
 	//
 	// AWSSecret overwrites the default etcd operator wide AWS credential and config.
+	// It can't be set along with UseDefaultCredentialChain or Vault.
 	AWSSecret string `json:"awsSecret,omitempty"`
+
+	// UseDefaultCredentialChain tells to use the default AWS credential chain instead of AWSSecret:
+	// the environment, the IAM role of the service account (IRSA), then the ECS task role or the EC2
+	// instance profile. The region is read from the AWS_REGION environment variable.
+	UseDefaultCredentialChain bool `json:"useDefaultCredentialChain,omitempty"`
+
+	// Vault tells to get short-lived credentials from the AWS secrets engine of HashiCorp Vault
+	// instead of AWSSecret. The region is read from the AWS_REGION environment variable.
+	Vault *VaultSource `json:"vault,omitempty"`
+
+	// Endpoint is the URL of a S3 compatible service to use instead of AWS S3,
+	// e.g. "http://minio.minio.svc:9000" for an in-cluster Minio.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// ForcePathStyle forces path-style addressing, "<endpoint>/<bucket>/<key>",
+	// instead of virtual-hosted-style addressing, "<bucket>.<endpoint>/<key>".
+	// Most S3 compatible services such as Minio and Ceph RGW require it.
+	ForcePathStyle bool `json:"forcePathStyle,omitempty"`
+
+	// InsecureSkipVerify disables TLS certificate verification of the endpoint.
+	// To verify an endpoint with a self-signed certificate instead, put its CA bundle
+	// in the AWS secret as 'ca-bundle.pem'.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+
+	// SSE is the server-side encryption of the backups, "aws:kms" or "AES256".
+	// If empty, the default encryption of the bucket applies.
+	SSE string `json:"sse,omitempty"`
+
+	// SSEKMSKeyID is the ID, ARN or alias of the AWS KMS key to encrypt the backups with.
+	// Setting it implies the "aws:kms" server-side encryption.
+	SSEKMSKeyID string `json:"sseKMSKeyID,omitempty"`
+
+	// StorageClass is the S3 storage class of the backups, "STANDARD", "STANDARD_IA",
+	// "ONEZONE_IA" or "INTELLIGENT_TIERING". If empty, the default storage class of the bucket applies.
+	// Archive classes such as "GLACIER" are rejected since the latest backup must be readable to restore from.
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// PartSizeInMB is the size of the parts in which the backup operator and the backup sidecar
+	// upload a backup, at least 5. It bounds the memory used to upload a backup and the size of
+	// a backup at 10000 parts.
+	// If not set, default is 64.
+	PartSizeInMB int64 `json:"partSizeInMB,omitempty"`
+
+	// UploadConcurrency is the number of parts of a backup the backup sidecar uploads in parallel.
+	// The sidecar holds up to UploadConcurrency+1 parts of PartSizeInMB in memory while uploading.
+	// If not set, default is 4.
+	UploadConcurrency int `json:"uploadConcurrency,omitempty"`
+
+	// SecondaryS3Buckets are the names of AWS S3 buckets to also save the backups in, e.g. for disaster recovery.
+	// They are accessed with the same credentials and endpoint as S3Bucket.
+	// With the backup operator, a backup succeeds once it is saved in S3Bucket;
+	// failing to save it in a secondary bucket is logged.
+	// With the backup sidecar, a backup succeeds once it is saved in a majority of the buckets, and
+	// the sidecar restores from the latest backup present in a majority of them.
+	SecondaryS3Buckets []string `json:"secondaryS3Buckets,omitempty"`
+
+	// ReplicationMode is how the backup sidecar saves the backups in SecondaryS3Buckets:
+	// "sync" saves a backup in all the buckets before it succeeds,
+	// "async" saves it in the primary bucket and in the secondary buckets in the background.
+	// If not set, default is "sync".
+	ReplicationMode string `json:"replicationMode,omitempty"`
+}
+
+// Validate checks that the credentials are either in AWSSecret, from the default credential chain or from Vault.
+func (s *S3Source) Validate() error {
+	if len(s.AWSSecret) != 0 && s.UseDefaultCredentialChain {
+		return errors.New("AWSSecret and UseDefaultCredentialChain can't be both set")
+	}
+	if s.Vault != nil {
+		if len(s.AWSSecret) != 0 || s.UseDefaultCredentialChain {
+			return errors.New("Vault can't be set along with AWSSecret or UseDefaultCredentialChain")
+		}
+		return s.Vault.Validate()
+	}
+	if len(s.AWSSecret) == 0 && !s.UseDefaultCredentialChain {
+		return errors.New("either AWSSecret, UseDefaultCredentialChain or Vault must be set")
+	}
+	return nil
 }
 
 // ABSSource represents an Azure Blob Storage (ABS) backup storage source
@@ -123,6 +515,172 @@ type ABSSource struct {
 	ABSSecret string `json:"absSecret,omitempty"`
 }
 
+// GCSSource represents a Google Cloud Storage (GCS) backup storage source
+type GCSSource struct {
+	// GCSBucket is the name of the GCS bucket to store backups in.
+	GCSBucket string `json:"gcsBucket,omitempty"`
+
+	// Prefix is the GCS prefix used to prefix the bucket path.
+	// It's the prefix at the beginning.
+	// After that, it will have version and cluster specific paths.
+	Prefix string `json:"prefix,omitempty"`
+
+	// GCPSecret is the name of the secret object that stores the GCP service account key.
+	//
+	// Within the secret object, the following field MUST be provided:
+	// 'credentials.json' holding the JSON key of the GCP service account
+	//
+	// It can be omitted if the backup operator runs on GKE with Workload Identity enabled;
+	// the GCP service account bound to the operator's Kubernetes service account is used then.
+	GCPSecret string `json:"gcpSecret,omitempty"`
+
+	// UseApplicationDefaultCredentials makes the backup operator authenticate with the
+	// Application Default Credentials of its pod, e.g. from GKE Workload Identity, instead of GCPSecret.
+	UseApplicationDefaultCredentials bool `json:"useApplicationDefaultCredentials,omitempty"`
+
+	// Vault tells to get short-lived OAuth2 access tokens from the GCP secrets engine of HashiCorp Vault
+	// instead of GCPSecret. Signed download URLs need a service account key, so they are not served then.
+	Vault *VaultSource `json:"vault,omitempty"`
+}
+
+// Validate checks that the credentials are either in GCPSecret, the Application Default Credentials or from Vault.
+func (s *GCSSource) Validate() error {
+	if len(s.GCPSecret) != 0 && s.UseApplicationDefaultCredentials {
+		return errors.New("GCPSecret and UseApplicationDefaultCredentials can't be both set")
+	}
+	if s.Vault != nil {
+		if len(s.GCPSecret) != 0 || s.UseApplicationDefaultCredentials {
+			return errors.New("Vault can't be set along with GCPSecret or UseApplicationDefaultCredentials")
+		}
+		return s.Vault.Validate()
+	}
+	if len(s.GCPSecret) == 0 && !s.UseApplicationDefaultCredentials {
+		return errors.New("either GCPSecret, UseApplicationDefaultCredentials or Vault must be set")
+	}
+	return nil
+}
+
+// VaultSource tells how to get short-lived storage credentials from HashiCorp Vault.
+// The credentials are refreshed before they expire.
+type VaultSource struct {
+	// Address is the URL of the Vault server, e.g. "https://vault.vault.svc:8200".
+	Address string `json:"address"`
+
+	// TokenSecret is the name of the secret object that stores the Vault token.
+	//
+	// Within the secret object, the following field MUST be provided:
+	// 'token' holding the Vault token
+	//
+	// It can't be set along with KubernetesRole.
+	TokenSecret string `json:"tokenSecret,omitempty"`
+
+	// KubernetesRole is the role to log in to Vault as with the Kubernetes auth method,
+	// authenticated by the token of the service account of the backup operator, instead of TokenSecret.
+	KubernetesRole string `json:"kubernetesRole,omitempty"`
+
+	// KubernetesAuthPath is the path the Kubernetes auth method is mounted at.
+	// If not set, default is "kubernetes".
+	KubernetesAuthPath string `json:"kubernetesAuthPath,omitempty"`
+
+	// SecretsEnginePath is the path the AWS or GCP secrets engine is mounted at.
+	// If not set, default is "aws" for S3 and "gcp" for GCS.
+	SecretsEnginePath string `json:"secretsEnginePath,omitempty"`
+
+	// Role is the role of the AWS secrets engine, or the roleset of the GCP secrets engine,
+	// to get the credentials of.
+	Role string `json:"role"`
+}
+
+// Validate checks that the Vault server and role are set, and that the token is either in TokenSecret
+// or from the Kubernetes auth method.
+func (v *VaultSource) Validate() error {
+	if len(v.Address) == 0 || len(v.Role) == 0 {
+		return errors.New("vault address and role must be set")
+	}
+	if len(v.TokenSecret) != 0 && len(v.KubernetesRole) != 0 {
+		return errors.New("vault TokenSecret and KubernetesRole can't be both set")
+	}
+	if len(v.TokenSecret) == 0 && len(v.KubernetesRole) == 0 {
+		return errors.New("either vault TokenSecret or KubernetesRole must be set")
+	}
+	return nil
+}
+
+// SwiftSource represents an OpenStack Swift backup storage source
+type SwiftSource struct {
+	// SwiftContainer is the name of the Swift container to store backups in.
+	SwiftContainer string `json:"swiftContainer,omitempty"`
+
+	// Prefix is the Swift prefix used to prefix the object path.
+	// It's the prefix at the beginning.
+	// After that, it will have version and cluster specific paths.
+	Prefix string `json:"prefix,omitempty"`
+
+	// SwiftSecret is the name of the secret object that stores the Keystone v3 credentials.
+	//
+	// Within the secret object, the following fields MUST be provided:
+	// 'auth-url', 'username', 'password', 'domain' and 'project'.
+	// The 'region' field is optional.
+	SwiftSecret string `json:"swiftSecret,omitempty"`
+
+	// RequestTimeoutInSecond is the timeout of a single request to Swift.
+	// The default timeout is 60 seconds.
+	RequestTimeoutInSecond int `json:"requestTimeoutInSecond,omitempty"`
+}
+
+// OSSSource represents an Alibaba Cloud Object Storage Service (OSS) backup storage source
+type OSSSource struct {
+	// Endpoint is the OSS endpoint of the region the bucket is in,
+	// e.g. "http://oss-cn-hangzhou.aliyuncs.com".
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// OSSBucket is the name of the OSS bucket to store backups in.
+	OSSBucket string `json:"ossBucket,omitempty"`
+
+	// Prefix is the OSS prefix used to prefix the object path.
+	// It's the prefix at the beginning.
+	// After that, it will have version and cluster specific paths.
+	Prefix string `json:"prefix,omitempty"`
+
+	// OSSSecret is the name of the secret object that stores the Alibaba Cloud AccessKey.
+	//
+	// Within the secret object, the following fields MUST be provided:
+	// 'access-key-id' holding the AccessKey ID
+	// 'access-key-secret' holding the AccessKey secret
+	OSSSecret string `json:"ossSecret,omitempty"`
+}
+
+// SFTPSource represents a SFTP server backup storage source
+type SFTPSource struct {
+	// Host is the hostname or IP address of the SFTP server.
+	Host string `json:"host,omitempty"`
+
+	// Port is the SSH port of the SFTP server. Defaults to 22.
+	Port int `json:"port,omitempty"`
+
+	// Path is the remote base directory to store backups in.
+	// After that, it will have version and cluster specific paths.
+	Path string `json:"path,omitempty"`
+
+	// SFTPSecret is the name of the secret object that stores the SSH credentials.
+	//
+	// Within the secret object, the following fields MUST be provided:
+	// 'username' holding the SSH username
+	// 'host-key' holding the public key of the server in authorized_keys format
+	// and at least one of:
+	// 'password' holding the SSH password
+	// 'private-key' holding the PEM encoded SSH private key
+	SFTPSecret string `json:"sftpSecret,omitempty"`
+}
+
+// PVBackupSource represents a volume mounted in the backup operator pod as a backup storage source,
+// e.g. a NFS or hostPath volume, or a persistent volume claim.
+type PVBackupSource struct {
+	// Path is the directory where the volume is mounted in the backup operator pod.
+	// After that, it will have version and cluster specific paths.
+	Path string `json:"path"`
+}
+
 type BackupServiceStatus struct {
 	// RecentBackup is status of the most recent backup created by
 	// the backup service
@@ -133,6 +691,14 @@ type BackupServiceStatus struct {
 
 	// BackupSize is the total size of existing backups in MB.
 	BackupSize float64 `json:"backupSize"`
+
+	// LastBackupError is the error of the most recent backup attempt.
+	// It is empty if the most recent backup attempt succeeded.
+	LastBackupError string `json:"lastBackupError,omitempty"`
+
+	// LastSkipReason is why the most recent backup attempt saved no backup, e.g. the cluster has not
+	// changed since the latest backup. It is empty if the most recent backup attempt saved a backup or failed.
+	LastSkipReason string `json:"lastSkipReason,omitempty"`
 }
 
 type BackupStatus struct {
@@ -142,6 +708,10 @@ type BackupStatus struct {
 	// Size is the size of the backup in MB.
 	Size float64 `json:"size"`
 
+	// CompressedSize is the size of the backup in MB after compression.
+	// It is 0 if the backup is not compressed.
+	CompressedSize float64 `json:"compressedSize,omitempty"`
+
 	// Revision is the revision of the backup.
 	Revision int64 `json:"revision"`
 
@@ -150,4 +720,16 @@ type BackupStatus struct {
 
 	// TimeTookInSecond is the total time took to create the backup.
 	TimeTookInSecond int `json:"timeTookInSecond"`
+
+	// SHA256 is the hex encoded SHA-256 checksum of the snapshot, before compression and encryption.
+	// It is saved next to the backup and checked before a member is seeded from the backup.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Forced is true if the backup was requested regardless of whether the cluster changed
+	// since the latest backup. Its revision may then be the revision of the latest backup.
+	Forced bool `json:"forced,omitempty"`
+
+	// Attempts is the number of snapshots taken to save the backup, more than 1 if the first
+	// failed to be received from etcd or saved to the storage.
+	Attempts int `json:"attempts,omitempty"`
 }
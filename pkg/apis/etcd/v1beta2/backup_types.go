@@ -42,6 +42,38 @@ type BackupSpec struct {
 	ClusterName string `json:"clusterName,omitempty"`
 	// StorageType is the etcd backup storage type.
 	StorageType string `json:"storageType"`
+	// MaxBackups is the maximum number of backups of the cluster to keep in the storage.
+	// After each successful backup, the oldest backups beyond MaxBackups are deleted.
+	// If equal to 0, all backups are kept.
+	MaxBackups int `json:"maxBackups,omitempty"`
+	// MaxBackupAgeInDays is the maximum age of the backups of the cluster to keep in the storage.
+	// After each successful backup, the backups older than MaxBackupAgeInDays are deleted,
+	// except the latest backup, which is always kept. If equal to 0, backups are kept regardless of their age.
+	MaxBackupAgeInDays int `json:"maxBackupAgeInDays,omitempty"`
+	// Compression is how the backups are compressed before they are saved, "gzip", "zstd" or empty for none.
+	// Compressed backups are decompressed transparently when restored.
+	Compression string `json:"compression,omitempty"`
+	// CompressionLevel is the level of the compression: 1 to 9 for gzip, or 1 to 22 for zstd.
+	// If equal to 0, the default level of the compression is used, e.g. 3 for zstd.
+	CompressionLevel int `json:"compressionLevel,omitempty"`
+	// PreBackupHook is the name of a Job in the namespace of the backup to run before the backup,
+	// e.g. to quiesce the applications writing to the cluster. The Job is the template of a new Job
+	// created for each backup, so it can have a parallelism of 0 to not run by itself.
+	// If the new Job does not complete within HookTimeoutInSecond, the backup is not saved.
+	PreBackupHook string `json:"preBackupHook,omitempty"`
+	// PostBackupHook is the name of a Job to run after the backup, whether it was saved or not,
+	// the same way as PreBackupHook. Its failure does not fail the backup.
+	PostBackupHook string `json:"postBackupHook,omitempty"`
+	// HookTimeoutInSecond is how long each hook Job is waited for.
+	// If equal to 0, the hooks are waited for 5 minutes.
+	HookTimeoutInSecond int64 `json:"hookTimeoutInSecond,omitempty"`
+	// DefragmentAfterNBackups is how many successful backups of the cluster its members are defragmented after.
+	// The members are defragmented one at a time, the leader last. If equal to 0, they are never defragmented.
+	DefragmentAfterNBackups int `json:"defragmentAfterNBackups,omitempty"`
+	// BackupNameTemplate is the Go template of the names of the backups, with the variables .Version, .Revision,
+	// .Timestamp, .RFC3339Timestamp, .ClusterName and .ClusterUID, like the BackupNameTemplate of BackupPolicy.
+	// If empty, the backups are named "{{.Version}}_{{.Revision}}_etcd.backup".
+	BackupNameTemplate string `json:"backupNameTemplate,omitempty"`
 	// BackupStorageSource is the backup storage source.
 	BackupStorageSource `json:",inline"`
 }
@@ -49,6 +81,18 @@ type BackupSpec struct {
 // BackupStorageSource contains the supported backup sources.
 type BackupStorageSource struct {
 	S3 *S3Source `json:"s3,omitempty"`
+	// GCS represents a Google Cloud Storage resource for storing etcd backups.
+	GCS *GCSSource `json:"gcs,omitempty"`
+	// ABS represents an Azure Blob Storage resource for storing etcd backups.
+	ABS *ABSSource `json:"abs,omitempty"`
+	// Swift represents an OpenStack Swift resource for storing etcd backups.
+	Swift *SwiftSource `json:"swift,omitempty"`
+	// OSS represents an Alibaba Cloud OSS resource for storing etcd backups.
+	OSS *OSSSource `json:"oss,omitempty"`
+	// SFTP represents a SFTP server for storing etcd backups.
+	SFTP *SFTPSource `json:"sftp,omitempty"`
+	// PV represents a volume mounted in the backup operator pod for storing etcd backups.
+	PV *PVBackupSource `json:"pv,omitempty"`
 }
 
 // BackupCRStatus represents the status of the EtcdBackup Custom Resource.
@@ -57,7 +101,28 @@ type BackupCRStatus struct {
 	Succeeded bool `json:"succeeded"`
 	// Reason indicates the reason for any backup related failures.
 	Reason string `json:"Reason,omitempty"`
+	// Unchanged indicates that no new backup was saved because the cluster had not changed
+	// since the latest backup. The path fields report the path of that backup.
+	Unchanged bool `json:"unchanged,omitempty"`
 	// If S3Source is used to store the backup, this field reports the
 	// S3 path where the backup is saved.
 	S3Path string `json:"s3Path,omitempty"`
+	// If GCSSource is used to store the backup, this field reports the
+	// GCS path where the backup is saved.
+	GCSPath string `json:"gcsPath,omitempty"`
+	// If ABSSource is used to store the backup, this field reports the
+	// ABS path where the backup is saved.
+	ABSPath string `json:"absPath,omitempty"`
+	// If SwiftSource is used to store the backup, this field reports the
+	// Swift path where the backup is saved.
+	SwiftPath string `json:"swiftPath,omitempty"`
+	// If OSSSource is used to store the backup, this field reports the
+	// OSS path where the backup is saved.
+	OSSPath string `json:"ossPath,omitempty"`
+	// If SFTPSource is used to store the backup, this field reports the
+	// remote path where the backup is saved.
+	SFTPPath string `json:"sftpPath,omitempty"`
+	// If PVBackupSource is used to store the backup, this field reports the
+	// path on the volume where the backup is saved.
+	PVPath string `json:"pvPath,omitempty"`
 }
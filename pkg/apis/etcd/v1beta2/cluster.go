@@ -16,9 +16,11 @@ package v1beta2
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -103,7 +105,8 @@ type ClusterSpec struct {
 
 	// Pod defines the policy to create pod for the etcd pod.
 	//
-	// Updating Pod does not take effect on any existing etcd pods.
+	// Updating Pod does not take effect on any existing etcd pods, except for EtcdEnv and Resources,
+	// whose update restarts the members one at a time. See MaxUnavailable.
 	Pod *PodPolicy `json:"pod,omitempty"`
 
 	// Backup defines the policy to backup data of etcd cluster if not nil.
@@ -125,6 +128,91 @@ type ClusterSpec struct {
 
 	// etcd cluster TLS configuration
 	TLS *TLSPolicy `json:"TLS,omitempty"`
+
+	// TopologySpread spreads the members across the values of a node label, e.g. the zones, if not nil.
+	//
+	// Updating TopologySpread does not take effect on any existing etcd pods.
+	TopologySpread *TopologySpreadPolicy `json:"topologySpread,omitempty"`
+
+	// MaxUnavailable is the max number of members restarted at the same time by a rolling restart, which
+	// replaces the members whose pods run with an older etcd configuration. See PodPolicy.EtcdEnv.
+	// If equal to 0, the members are restarted one at a time. The members restarted at the same time are
+	// capped so that the cluster keeps its quorum: the member of a single member cluster is never restarted.
+	MaxUnavailable int `json:"maxUnavailable,omitempty"`
+
+	// Storage stores the data of each member on a PersistentVolumeClaim of its own if not nil,
+	// instead of an emptyDir volume.
+	//
+	// Updating Storage does not take effect on any existing etcd pods, except for increasing
+	// RequestedSize, which expands their PersistentVolumeClaims.
+	Storage *StorageSpec `json:"storage,omitempty"`
+}
+
+// StorageSpec is the PersistentVolumeClaim the data of each member is stored on.
+type StorageSpec struct {
+	// StorageClassName is the StorageClass of the PersistentVolumeClaims.
+	// If empty, the default StorageClass of the Kubernetes cluster is used.
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// RequestedSize is the size requested for each PersistentVolumeClaim.
+	// Increasing it expands the PersistentVolumeClaims, if their StorageClass allows the volume expansion.
+	// It can't be decreased.
+	RequestedSize resource.Quantity `json:"requestedSize"`
+
+	// AccessMode is the access mode of the PersistentVolumeClaims, ReadWriteOnce or ReadWriteMany.
+	// If empty, ReadWriteOnce is used.
+	AccessMode v1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+}
+
+// Validate returns an error if the storage spec is invalid.
+func (ss *StorageSpec) Validate() error {
+	if ss.RequestedSize.Sign() <= 0 {
+		return errors.New("spec: storage requestedSize should be > 0")
+	}
+	switch ss.AccessMode {
+	case "", v1.ReadWriteOnce, v1.ReadWriteMany:
+		return nil
+	}
+	return fmt.Errorf("spec: unsupported storage accessMode (%s), want %s or %s", ss.AccessMode, v1.ReadWriteOnce, v1.ReadWriteMany)
+}
+
+const (
+	// TopologySpreadDoNotSchedule leaves a member unscheduled rather than sharing a topology value with another member.
+	TopologySpreadDoNotSchedule = "DoNotSchedule"
+	// TopologySpreadScheduleAnyway schedules a member on a topology value shared with another member
+	// if every other value already has a member.
+	TopologySpreadScheduleAnyway = "ScheduleAnyway"
+)
+
+// TopologySpreadPolicy defines how the members are spread across the topology of the nodes.
+// The members are spread with a pod anti-affinity term on TopologyKey, like a topology spread
+// constraint with a max skew of 1, which the supported Kubernetes versions don't have.
+type TopologySpreadPolicy struct {
+	// TopologyKey is the node label whose values the members are spread across,
+	// e.g. "topology.kubernetes.io/zone" or "failure-domain.beta.kubernetes.io/zone".
+	TopologyKey string `json:"topologyKey"`
+	// WhenUnsatisfiable is what to do when every value of TopologyKey already has a member:
+	// "DoNotSchedule" or "ScheduleAnyway". If empty, it is "DoNotSchedule".
+	// With "DoNotSchedule", a cluster can't have more members than TopologyKey has values.
+	WhenUnsatisfiable string `json:"whenUnsatisfiable,omitempty"`
+}
+
+// Validate returns an error if the topology spread policy is invalid.
+func (tp *TopologySpreadPolicy) Validate() error {
+	if len(tp.TopologyKey) == 0 {
+		return errors.New("spec: topologySpread requires topologyKey")
+	}
+	switch tp.WhenUnsatisfiable {
+	case "", TopologySpreadDoNotSchedule, TopologySpreadScheduleAnyway:
+		return nil
+	}
+	return fmt.Errorf("spec: unknown topologySpread whenUnsatisfiable (%s), want %s or %s",
+		tp.WhenUnsatisfiable, TopologySpreadDoNotSchedule, TopologySpreadScheduleAnyway)
+}
+
+// IsRequired tells whether the members are left unscheduled rather than sharing a topology value.
+func (tp *TopologySpreadPolicy) IsRequired() bool {
+	return tp.WhenUnsatisfiable != TopologySpreadScheduleAnyway
 }
 
 // RestorePolicy defines the policy to restore cluster form existing backup if not nil.
@@ -155,7 +243,7 @@ type PodPolicy struct {
 	AntiAffinity bool `json:"antiAffinity,omitempty"`
 
 	// Resources is the resource requirements for the etcd container.
-	// This field cannot be updated once the cluster is created.
+	// Updating this field restarts the members with the new requirements, like EtcdEnv.
 	Resources v1.ResourceRequirements `json:"resources,omitempty"`
 
 	// Tolerations specifies the pod's tolerations.
@@ -165,7 +253,7 @@ type PodPolicy struct {
 	// This is used to configure etcd process. etcd cluster cannot be created, when
 	// bad environement variables are provided. Do not overwrite any flags used to
 	// bootstrap the cluster (for example `--initial-cluster` flag).
-	// This field cannot be updated.
+	// Updating this field restarts the members with the new environment, like Resources.
 	EtcdEnv []v1.EnvVar `json:"etcdEnv,omitempty"`
 
 	// PV represents a Persistent Volume resource.
@@ -176,6 +264,11 @@ type PodPolicy struct {
 	// By default, kubernetes will mount a service account token into the etcd pods.
 	// AutomountServiceAccountToken indicates whether pods running with the service account should have an API token automatically mounted.
 	AutomountServiceAccountToken *bool `json:"automountServiceAccountToken,omitempty"`
+
+	// If greater than 0, BackupPriority is the backup priority the pods are annotated with, which makes the
+	// backup sidecar take the snapshots from a follower instead of the leader. The annotation of a single pod
+	// can then be changed to prefer it, or set to 0 to avoid it. See BackupPolicy.MaxBackupRevisionLag.
+	BackupPriority int `json:"backupPriority,omitempty"`
 }
 
 func (c *ClusterSpec) Validate() error {
@@ -191,6 +284,9 @@ func (c *ClusterSpec) Validate() error {
 		if err := c.Backup.Validate(); err != nil {
 			return err
 		}
+		if c.Backup.HTTPClientCertAuth && !c.TLS.IsSecureClient() {
+			return errors.New("spec: backup httpClientCertAuth requires static client TLS (operatorSecret)")
+		}
 	}
 	if c.TLS != nil {
 		if err := c.TLS.Validate(); err != nil {
@@ -198,6 +294,28 @@ func (c *ClusterSpec) Validate() error {
 		}
 	}
 
+	if c.TopologySpread != nil {
+		if c.SelfHosted != nil {
+			return errors.New("spec: topologySpread can't be set for a self hosted cluster")
+		}
+		if err := c.TopologySpread.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Storage != nil {
+		if c.SelfHosted != nil {
+			return errors.New("spec: storage can't be set for a self hosted cluster")
+		}
+		if err := c.Storage.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.MaxUnavailable < 0 {
+		return errors.New("spec: maxUnavailable should be >= 0")
+	}
+
 	if c.Pod != nil {
 		for k := range c.Pod.Labels {
 			if k == "app" || strings.HasPrefix(k, "etcd_") {
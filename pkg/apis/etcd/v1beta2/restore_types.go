@@ -60,6 +60,9 @@ type S3RestoreSource struct {
 	// Path is the full s3 path where the backup is saved.
 	// The format of the path must be: "<s3-bucket-name>/<path-to-backup-file>"
 	// e.g: "etcd-backups/v1/default/example-etcd-cluster/3.1.8_0000000000000001_etcd.backup"
+	// If the path ends with "/", the latest backup saved under it by the backup operator is restored,
+	// e.g: "etcd-backups/v1/default/example-etcd-cluster/". It is looked up in the index.json of the prefix,
+	// or by listing the prefix if the index is missing.
 	Path string `json:"path"`
 
 	// The name of the secret object that stores the AWS credential and config files.
@@ -69,6 +72,16 @@ type S3RestoreSource struct {
 	//
 	// AWSSecret overwrites the default etcd operator wide AWS credential and config.
 	AWSSecret string `json:"awsSecret"`
+
+	// Endpoint is the URL of a S3 compatible service to use instead of AWS S3.
+	// It must be the same as the endpoint the backup was saved to.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// ForcePathStyle forces path-style addressing, "<endpoint>/<bucket>/<key>".
+	ForcePathStyle bool `json:"forcePathStyle,omitempty"`
+
+	// InsecureSkipVerify disables TLS certificate verification of the endpoint.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
 }
 
 // RestoreStatus reports the status of this restore operation.
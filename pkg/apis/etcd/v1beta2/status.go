@@ -31,10 +31,11 @@ const (
 	ClusterPhaseFailed                = "Failed"
 
 	// See ./doc/user/conditions_and_events.md
-	ClusterConditionAvailable  ClusterConditionType = "Available"
-	ClusterConditionRecovering                      = "Recovering"
-	ClusterConditionScaling                         = "Scaling"
-	ClusterConditionUpgrading                       = "Upgrading"
+	ClusterConditionAvailable                   ClusterConditionType = "Available"
+	ClusterConditionRecovering                                       = "Recovering"
+	ClusterConditionScaling                                          = "Scaling"
+	ClusterConditionUpgrading                                        = "Upgrading"
+	ClusterConditionDisruptionBudgetBelowQuorum                      = "DisruptionBudgetBelowQuorum"
 )
 
 type ClusterStatus struct {
@@ -162,6 +163,12 @@ func (cs *ClusterStatus) SetReadyCondition() {
 	cs.setClusterCondition(*c)
 }
 
+func (cs *ClusterStatus) SetDisruptionBudgetBelowQuorumCondition(minAvailable, quorum int) {
+	c := newClusterCondition(ClusterConditionDisruptionBudgetBelowQuorum, v1.ConditionTrue, "Disruption budget below quorum",
+		fmt.Sprintf("PodDisruptionBudget keeps %d members available, quorum needs %d", minAvailable, quorum))
+	cs.setClusterCondition(*c)
+}
+
 func (cs *ClusterStatus) ClearCondition(t ClusterConditionType) {
 	pos, _ := getClusterCondition(cs, t)
 	if pos == -1 {
@@ -40,6 +40,10 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*BackupCRStatus).DeepCopyInto(out.(*BackupCRStatus))
 			return nil
 		}, InType: reflect.TypeOf(&BackupCRStatus{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*BackupEncryption).DeepCopyInto(out.(*BackupEncryption))
+			return nil
+		}, InType: reflect.TypeOf(&BackupEncryption{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*BackupPolicy).DeepCopyInto(out.(*BackupPolicy))
 			return nil
@@ -96,6 +100,10 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*EtcdRestoreList).DeepCopyInto(out.(*EtcdRestoreList))
 			return nil
 		}, InType: reflect.TypeOf(&EtcdRestoreList{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*GCSSource).DeepCopyInto(out.(*GCSSource))
+			return nil
+		}, InType: reflect.TypeOf(&GCSSource{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*MemberSecret).DeepCopyInto(out.(*MemberSecret))
 			return nil
@@ -104,6 +112,14 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*MembersStatus).DeepCopyInto(out.(*MembersStatus))
 			return nil
 		}, InType: reflect.TypeOf(&MembersStatus{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*OSSSource).DeepCopyInto(out.(*OSSSource))
+			return nil
+		}, InType: reflect.TypeOf(&OSSSource{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*PVBackupSource).DeepCopyInto(out.(*PVBackupSource))
+			return nil
+		}, InType: reflect.TypeOf(&PVBackupSource{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*PVSource).DeepCopyInto(out.(*PVSource))
 			return nil
@@ -136,6 +152,10 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*S3Source).DeepCopyInto(out.(*S3Source))
 			return nil
 		}, InType: reflect.TypeOf(&S3Source{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*SFTPSource).DeepCopyInto(out.(*SFTPSource))
+			return nil
+		}, InType: reflect.TypeOf(&SFTPSource{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*SelfHostedPolicy).DeepCopyInto(out.(*SelfHostedPolicy))
 			return nil
@@ -148,10 +168,18 @@ func GetGeneratedDeepCopyFuncs() []conversion.GeneratedDeepCopyFunc {
 			in.(*StorageSource).DeepCopyInto(out.(*StorageSource))
 			return nil
 		}, InType: reflect.TypeOf(&StorageSource{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*SwiftSource).DeepCopyInto(out.(*SwiftSource))
+			return nil
+		}, InType: reflect.TypeOf(&SwiftSource{})},
 		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
 			in.(*TLSPolicy).DeepCopyInto(out.(*TLSPolicy))
 			return nil
 		}, InType: reflect.TypeOf(&TLSPolicy{})},
+		{Fn: func(in interface{}, out interface{}, c *conversion.Cloner) error {
+			in.(*VaultSource).DeepCopyInto(out.(*VaultSource))
+			return nil
+		}, InType: reflect.TypeOf(&VaultSource{})},
 	}
 }
 
@@ -187,6 +215,27 @@ func (in *BackupCRStatus) DeepCopy() *BackupCRStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupEncryption) DeepCopyInto(out *BackupEncryption) {
+	*out = *in
+	if in.AcceptedSecretKeys != nil {
+		in, out := &in.AcceptedSecretKeys, &out.AcceptedSecretKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupEncryption.
+func (in *BackupEncryption) DeepCopy() *BackupEncryption {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupEncryption)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BackupPolicy) DeepCopyInto(out *BackupPolicy) {
 	*out = *in
@@ -200,6 +249,15 @@ func (in *BackupPolicy) DeepCopyInto(out *BackupPolicy) {
 		}
 	}
 	in.StorageSource.DeepCopyInto(&out.StorageSource)
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(BackupEncryption)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -280,6 +338,60 @@ func (in *BackupStorageSource) DeepCopyInto(out *BackupStorageSource) {
 			*out = nil
 		} else {
 			*out = new(S3Source)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.GCS != nil {
+		in, out := &in.GCS, &out.GCS
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(GCSSource)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.ABS != nil {
+		in, out := &in.ABS, &out.ABS
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(ABSSource)
+			**out = **in
+		}
+	}
+	if in.Swift != nil {
+		in, out := &in.Swift, &out.Swift
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(SwiftSource)
+			**out = **in
+		}
+	}
+	if in.OSS != nil {
+		in, out := &in.OSS, &out.OSS
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(OSSSource)
+			**out = **in
+		}
+	}
+	if in.SFTP != nil {
+		in, out := &in.SFTP, &out.SFTP
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(SFTPSource)
+			**out = **in
+		}
+	}
+	if in.PV != nil {
+		in, out := &in.PV, &out.PV
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(PVBackupSource)
 			**out = **in
 		}
 	}
@@ -360,6 +472,24 @@ func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 			(*in).DeepCopyInto(*out)
 		}
 	}
+	if in.TopologySpread != nil {
+		in, out := &in.TopologySpread, &out.TopologySpread
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(TopologySpreadPolicy)
+			**out = **in
+		}
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(StorageSpec)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -593,6 +723,31 @@ func (in *EtcdRestoreList) DeepCopyObject() runtime.Object {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCSSource) DeepCopyInto(out *GCSSource) {
+	*out = *in
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(VaultSource)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCSSource.
+func (in *GCSSource) DeepCopy() *GCSSource {
+	if in == nil {
+		return nil
+	}
+	out := new(GCSSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MemberSecret) DeepCopyInto(out *MemberSecret) {
 	*out = *in
@@ -635,6 +790,38 @@ func (in *MembersStatus) DeepCopy() *MembersStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSSSource) DeepCopyInto(out *OSSSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSSSource.
+func (in *OSSSource) DeepCopy() *OSSSource {
+	if in == nil {
+		return nil
+	}
+	out := new(OSSSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PVBackupSource) DeepCopyInto(out *PVBackupSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PVBackupSource.
+func (in *PVBackupSource) DeepCopy() *PVBackupSource {
+	if in == nil {
+		return nil
+	}
+	out := new(PVBackupSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PVSource) DeepCopyInto(out *PVSource) {
 	*out = *in
@@ -809,6 +996,20 @@ func (in *S3RestoreSource) DeepCopy() *S3RestoreSource {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *S3Source) DeepCopyInto(out *S3Source) {
 	*out = *in
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(VaultSource)
+			**out = **in
+		}
+	}
+	if in.SecondaryS3Buckets != nil {
+		in, out := &in.SecondaryS3Buckets, &out.SecondaryS3Buckets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -822,6 +1023,22 @@ func (in *S3Source) DeepCopy() *S3Source {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SFTPSource) DeepCopyInto(out *SFTPSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SFTPSource.
+func (in *SFTPSource) DeepCopy() *SFTPSource {
+	if in == nil {
+		return nil
+	}
+	out := new(SFTPSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SelfHostedPolicy) DeepCopyInto(out *SelfHostedPolicy) {
 	*out = *in
@@ -881,7 +1098,7 @@ func (in *StorageSource) DeepCopyInto(out *StorageSource) {
 			*out = nil
 		} else {
 			*out = new(S3Source)
-			**out = **in
+			(*in).DeepCopyInto(*out)
 		}
 	}
 	if in.ABS != nil {
@@ -906,6 +1123,39 @@ func (in *StorageSource) DeepCopy() *StorageSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageSpec) DeepCopyInto(out *StorageSpec) {
+	*out = *in
+	out.RequestedSize = in.RequestedSize.DeepCopy()
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageSpec.
+func (in *StorageSpec) DeepCopy() *StorageSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SwiftSource) DeepCopyInto(out *SwiftSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SwiftSource.
+func (in *SwiftSource) DeepCopy() *SwiftSource {
+	if in == nil {
+		return nil
+	}
+	out := new(SwiftSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TLSPolicy) DeepCopyInto(out *TLSPolicy) {
 	*out = *in
@@ -930,3 +1180,35 @@ func (in *TLSPolicy) DeepCopy() *TLSPolicy {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TopologySpreadPolicy) DeepCopyInto(out *TopologySpreadPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TopologySpreadPolicy.
+func (in *TopologySpreadPolicy) DeepCopy() *TopologySpreadPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(TopologySpreadPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultSource) DeepCopyInto(out *VaultSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultSource.
+func (in *VaultSource) DeepCopy() *VaultSource {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultSource)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -15,9 +15,15 @@
 package abs
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"os"
 	"path"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
 
 	"github.com/Azure/azure-sdk-for-go/storage"
 )
@@ -62,13 +68,26 @@ func NewFromClient(container, prefix string, storageClient *storage.Client) (*AB
 	}, nil
 }
 
-// Put puts a chunk of data into a ABS container using the provided key for its reference
-func (w *ABS) Put(key string, r io.Reader) error {
+// Ping checks that the container still exists and is accessible with the credentials of the client.
+func (w *ABS) Ping(ctx context.Context) error {
+	exists, err := w.container.Exists()
+	if err != nil {
+		return fmt.Errorf("failed to reach abs container (%s): %v", w.container.Name, err)
+	}
+	if !exists {
+		return fmt.Errorf("container %v does not exist", w.container.Name)
+	}
+	return nil
+}
+
+// Put puts a chunk of data into a ABS container using the provided key for its reference.
+// The upload stops reading r once ctx is cancelled.
+func (w *ABS) Put(ctx context.Context, key string, r io.Reader) error {
 	blobName := path.Join(v1, w.prefix, key)
 	blob := w.container.GetBlobReference(blobName)
 
 	putBlobOpts := storage.PutBlobOptions{}
-	err := blob.CreateBlockBlobFromReader(r, &putBlobOpts)
+	err := blob.CreateBlockBlobFromReader(util.NewContextReader(ctx, r), &putBlobOpts)
 	if err != nil {
 		return fmt.Errorf("create block blob from reader failed: %v", err)
 	}
@@ -76,13 +95,24 @@ func (w *ABS) Put(key string, r io.Reader) error {
 	return nil
 }
 
-// Get gets the blob object specified by key from a ABS container
+// Get gets the blob object specified by key from a ABS container.
+// os.IsNotExist(err) is true if the blob does not exist.
 func (w *ABS) Get(key string) (io.ReadCloser, error) {
 	blobName := path.Join(v1, w.prefix, key)
 	blob := w.container.GetBlobReference(blobName)
 
 	opts := &storage.GetBlobOptions{}
-	return blob.Get(opts)
+	rc, err := blob.Get(opts)
+	if IsNotFound(err) {
+		return nil, &os.PathError{Op: "get", Path: key, Err: os.ErrNotExist}
+	}
+	return rc, err
+}
+
+// IsNotFound returns true if err is returned by ABS for a blob or container that does not exist.
+func IsNotFound(err error) bool {
+	serr, ok := err.(storage.AzureStorageServiceError)
+	return ok && serr.StatusCode == http.StatusNotFound
 }
 
 // Delete deletes the blob object specified by key from a ABS container
@@ -94,6 +124,16 @@ func (w *ABS) Delete(key string) error {
 	return blob.Delete(opts)
 }
 
+// DeleteIfExists deletes the blob object specified by key from a ABS container if it exists
+func (w *ABS) DeleteIfExists(key string) error {
+	blobName := path.Join(v1, w.prefix, key)
+	blob := w.container.GetBlobReference(blobName)
+
+	opts := &storage.DeleteBlobOptions{}
+	_, err := blob.DeleteIfExists(opts)
+	return err
+}
+
 // List lists all blobs in a given ABS container
 func (w *ABS) List() ([]string, error) {
 	_, l, err := w.list(w.prefix)
@@ -118,6 +158,50 @@ func (w *ABS) list(prefix string) (int64, []string, error) {
 	return size, keys, nil
 }
 
+// ListModTimes returns the last modified time of every blob in a given ABS container
+func (w *ABS) ListModTimes() (map[string]time.Time, error) {
+	params := storage.ListBlobsParameters{Prefix: path.Join(v1, w.prefix) + "/"}
+	resp, err := w.container.ListBlobs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	modTimes := make(map[string]time.Time, len(resp.Blobs))
+	for _, blob := range resp.Blobs {
+		modTimes[(blob.Name)[len(resp.Prefix):]] = time.Time(blob.Properties.LastModified)
+	}
+	return modTimes, nil
+}
+
+// BlobInfo describes a blob under the prefix.
+type BlobInfo struct {
+	Size         int64
+	LastModified time.Time
+}
+
+// ListBlobInfos returns the size and the last modified time of every blob in a given ABS container
+func (w *ABS) ListBlobInfos() (map[string]BlobInfo, error) {
+	params := storage.ListBlobsParameters{Prefix: path.Join(v1, w.prefix) + "/"}
+	resp, err := w.container.ListBlobs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make(map[string]BlobInfo, len(resp.Blobs))
+	for _, blob := range resp.Blobs {
+		infos[(blob.Name)[len(resp.Prefix):]] = BlobInfo{
+			Size:         blob.Properties.ContentLength,
+			LastModified: time.Time(blob.Properties.LastModified),
+		}
+	}
+	return infos, nil
+}
+
+// Path returns the location of the blob specified by key, <container>/v1/<prefix>/<key>
+func (w *ABS) Path(key string) string {
+	return path.Join(w.container.Name, v1, w.prefix, key)
+}
+
 // TotalSize returns the total size of all blobs in a ABS container
 func (w *ABS) TotalSize() (int64, error) {
 	size, _, err := w.list(w.prefix)
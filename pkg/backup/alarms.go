@@ -0,0 +1,113 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"golang.org/x/net/context"
+	"k8s.io/api/core/v1"
+)
+
+// alarmCorruptType is the CORRUPT alarm, raised by etcd 3.3 and later once a member is found with data
+// inconsistent with the rest of the cluster. The vendored etcd client only defines NONE and NOSPACE.
+const alarmCorruptType etcdserverpb.AlarmType = 2
+
+// The names of the etcd alarms, as recorded in BackupStatus.Alarms and in the alarm label of the metrics.
+const (
+	alarmNoSpace = "NOSPACE"
+	alarmCorrupt = "CORRUPT"
+)
+
+var alarmNames = map[etcdserverpb.AlarmType]string{
+	etcdserverpb.AlarmType_NOSPACE: alarmNoSpace,
+	alarmCorruptType:               alarmCorrupt,
+}
+
+// checkAlarms returns the names of the alarms raised in the cluster, checked before a snapshot is taken from it.
+// A CORRUPT alarm fails the backup, since the snapshot may carry the inconsistent data. A NOSPACE alarm emits a
+// warning event: the cluster only serves reads and deletes until its space is reclaimed, but its snapshot is sound.
+// Failing to list the alarms doesn't fail the backup.
+func (bm *BackupManager) checkAlarms(ctx context.Context, mcli clientv3.Maintenance) ([]string, error) {
+	actx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	defer cancel()
+	resp, err := mcli.AlarmList(actx)
+	if err != nil {
+		bm.getLogger().WithError(err).Warning("failed to list etcd alarms")
+		return nil, nil
+	}
+
+	members := make(map[string][]string)
+	for _, a := range resp.Alarms {
+		name, ok := alarmNames[a.Alarm]
+		if !ok {
+			name = a.Alarm.String()
+		}
+		members[name] = append(members[name], fmt.Sprintf("%x", a.MemberID))
+	}
+	var alarms []string
+	for name := range members {
+		alarms = append(alarms, name)
+	}
+	sort.Strings(alarms)
+	for _, name := range alarmNames {
+		bm.metrics.SetAlarm(bm.clusterName, name, len(members[name]) != 0)
+	}
+
+	if ids, ok := members[alarmCorrupt]; ok {
+		return alarms, &backupFailure{reason: failureAlarm,
+			err: fmt.Errorf("etcd raised a CORRUPT alarm on member(s) %s: a snapshot would be untrustworthy", strings.Join(ids, ", "))}
+	}
+	if ids, ok := members[alarmNoSpace]; ok {
+		msg := fmt.Sprintf("etcd raised a NOSPACE alarm on member(s) %s: the cluster rejects writes until its space is reclaimed", strings.Join(ids, ", "))
+		bm.getLogger().WithField("members", strings.Join(ids, ",")).Warning("etcd raised a NOSPACE alarm")
+		bm.recordAlarmEvent(msg)
+	}
+	return alarms, nil
+}
+
+// noSpaceFailure returns the failure of a backup taken while the given alarms were raised if they include
+// NOSPACE and bm fails such backups, so that the alerting on the failed backups fires. It returns nil otherwise.
+func (bm *BackupManager) noSpaceFailure(alarms []string) error {
+	if !bm.failOnNoSpace {
+		return nil
+	}
+	for _, a := range alarms {
+		if a == alarmNoSpace {
+			return &backupFailure{reason: failureAlarm, err: fmt.Errorf("etcd raised a NOSPACE alarm")}
+		}
+	}
+	return nil
+}
+
+// recordAlarmEvent emits a warning event with msg about a raised alarm, at most once every 10 minutes for
+// the same message, like the failure events.
+func (bm *BackupManager) recordAlarmEvent(msg string) {
+	if bm.recorder == nil {
+		return
+	}
+	if msg == bm.lastAlarmEvent && time.Since(bm.lastAlarmEventTime) < failureEventInterval {
+		return
+	}
+	bm.lastAlarmEvent, bm.lastAlarmEventTime = msg, time.Now()
+	bm.recorder.Event(bm.clusterRef(), v1.EventTypeWarning, "Etcd Alarm", msg)
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"golang.org/x/net/context"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// alarmMaintenanceClient is a cluster with the given alarms raised, or whose alarms fail to be listed with err.
+type alarmMaintenanceClient struct {
+	clientv3.Maintenance
+	alarms []*etcdserverpb.AlarmMember
+	err    error
+}
+
+func (c *alarmMaintenanceClient) AlarmList(ctx context.Context) (*clientv3.AlarmResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &clientv3.AlarmResponse{Alarms: c.alarms}, nil
+}
+
+// TestCheckAlarms ensures a CORRUPT alarm fails the backup, a NOSPACE alarm emits a warning event and only fails
+// the backup with failOnNoSpace, and a failure to list the alarms is ignored.
+func TestCheckAlarms(t *testing.T) {
+	noSpace := &etcdserverpb.AlarmMember{MemberID: 0x1a, Alarm: etcdserverpb.AlarmType_NOSPACE}
+	corrupt := &etcdserverpb.AlarmMember{MemberID: 0x2b, Alarm: alarmCorruptType}
+	tests := []struct {
+		desc          string
+		mcli          *alarmMaintenanceClient
+		failOnNoSpace bool
+
+		wantAlarms  []string
+		wantErr     string
+		wantEvent   bool
+		wantNoSpace bool
+	}{
+		{desc: "no alarm", mcli: &alarmMaintenanceClient{}},
+		{desc: "list failure", mcli: &alarmMaintenanceClient{err: errors.New("etcdserver: request timed out")}},
+		{desc: "nospace", mcli: &alarmMaintenanceClient{alarms: []*etcdserverpb.AlarmMember{noSpace}},
+			wantAlarms: []string{alarmNoSpace}, wantEvent: true},
+		{desc: "nospace failing the backup", mcli: &alarmMaintenanceClient{alarms: []*etcdserverpb.AlarmMember{noSpace}}, failOnNoSpace: true,
+			wantAlarms: []string{alarmNoSpace}, wantEvent: true, wantNoSpace: true},
+		{desc: "corrupt", mcli: &alarmMaintenanceClient{alarms: []*etcdserverpb.AlarmMember{noSpace, corrupt}},
+			wantAlarms: []string{alarmCorrupt, alarmNoSpace}, wantErr: "CORRUPT alarm on member(s) 2b"},
+	}
+	for _, tt := range tests {
+		recorder := record.NewFakeRecorder(10)
+		bm := &BackupManager{kubecli: fake.NewSimpleClientset(), clusterName: "test", namespace: "default", failOnNoSpace: tt.failOnNoSpace}
+		bm.RecordEvents(recorder)
+
+		alarms, err := bm.checkAlarms(context.Background(), tt.mcli)
+		if !reflect.DeepEqual(alarms, tt.wantAlarms) {
+			t.Errorf("%s: alarms = %v, want %v", tt.desc, alarms, tt.wantAlarms)
+		}
+		switch {
+		case len(tt.wantErr) == 0 && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.desc, err)
+		case len(tt.wantErr) != 0 && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: error = %v, want %q", tt.desc, err, tt.wantErr)
+		case err != nil && failureReason(err) != failureAlarm:
+			t.Errorf("%s: failure reason = %q, want %q", tt.desc, failureReason(err), failureAlarm)
+		}
+		if nerr := bm.noSpaceFailure(alarms); (nerr != nil) != tt.wantNoSpace {
+			t.Errorf("%s: NOSPACE failure = %v, want failed %v", tt.desc, nerr, tt.wantNoSpace)
+		}
+
+		select {
+		case e := <-recorder.Events:
+			if !tt.wantEvent {
+				t.Errorf("%s: unexpected event %q", tt.desc, e)
+			} else if !strings.HasPrefix(e, "Warning Etcd Alarm etcd raised a NOSPACE alarm on member(s) 1a") {
+				t.Errorf("%s: event = %q, want the NOSPACE warning", tt.desc, e)
+			}
+		default:
+			if tt.wantEvent {
+				t.Errorf("%s: expect the NOSPACE warning, got no event", tt.desc)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"fmt"
+	"strings"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EtcdCredentials are the username and password the etcd clients authenticate with,
+// where the etcd authentication is enabled.
+type EtcdCredentials struct {
+	Username string
+	Password string
+}
+
+// SetEtcdCredentials has the etcd clients of the BackupManager authenticate with c, both the clients
+// taking the snapshots and the ones checking the revisions of the members. A nil c disables the authentication.
+func (bm *BackupManager) SetEtcdCredentials(c *EtcdCredentials) {
+	bm.credentials = c
+}
+
+// getEtcdCredentials reads the etcd credentials from the given Secret.
+func getEtcdCredentials(kubecli kubernetes.Interface, ns, secretName string) (*EtcdCredentials, error) {
+	secret, err := kubecli.CoreV1().Secrets(ns).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get etcd auth secret (%s): %v", secretName, err)
+	}
+	username := string(secret.Data[api.EtcdAuthUsername])
+	if len(username) == 0 {
+		return nil, fmt.Errorf("etcd auth secret (%s) has no %s", secretName, api.EtcdAuthUsername)
+	}
+	return &EtcdCredentials{Username: username, Password: string(secret.Data[api.EtcdAuthPassword])}, nil
+}
+
+// newEtcdClient returns an etcd client of the given endpoint with the TLS config and the credentials of bm.
+func (bm *BackupManager) newEtcdClient(url string) (*clientv3.Client, error) {
+	return createEtcdClient(url, bm.tlsConfig(), bm.credentials)
+}
+
+// retryOnExpiredToken calls f with *etcdcli. If f fails because the auth token of *etcdcli expired, *etcdcli is
+// replaced by a new client of the same endpoint, which authenticates again, and f is called once more with it.
+// f must start over on each call, e.g. take a new snapshot.
+func (bm *BackupManager) retryOnExpiredToken(etcdcli **clientv3.Client, f func(*clientv3.Client) error) error {
+	err := f(*etcdcli)
+	if bm.credentials == nil || !isAuthTokenExpired(err) {
+		return err
+	}
+	bm.getLogger().WithError(err).Info("etcd auth token expired, authenticating again")
+	cli, cerr := bm.newEtcdClient((*etcdcli).Endpoints()[0])
+	if cerr != nil {
+		return &etcdError{fmt.Errorf("create etcd client failed: %v", cerr)}
+	}
+	(*etcdcli).Close()
+	*etcdcli = cli
+	return f(cli)
+}
+
+// isAuthTokenExpired tells whether err is etcd rejecting the auth token of the client, which expired.
+// It is matched by its message, since the errors of the snapshots wrap the errors of etcd.
+func isAuthTokenExpired(err error) bool {
+	return err != nil && strings.Contains(err.Error(), rpctypes.ErrInvalidAuthToken.Error())
+}
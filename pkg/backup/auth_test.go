@@ -0,0 +1,68 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetEtcdCredentials(t *testing.T) {
+	kubecli := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd-auth", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("root"), "password": []byte("secret")},
+	}, &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "no-username", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("secret")},
+	})
+
+	creds, err := getEtcdCredentials(kubecli, "default", "etcd-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *creds != (EtcdCredentials{Username: "root", Password: "secret"}) {
+		t.Errorf("expect credentials root/secret, get %s/%s", creds.Username, creds.Password)
+	}
+	for _, name := range []string{"no-username", "missing"} {
+		if _, err := getEtcdCredentials(kubecli, "default", name); err == nil {
+			t.Errorf("%s: expect an error", name)
+		}
+	}
+}
+
+func TestIsAuthTokenExpired(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: errors.New("connection refused"), want: false},
+		{err: rpctypes.ErrInvalidAuthToken, want: true},
+		{err: rpctypes.ErrGRPCInvalidAuthToken, want: true},
+		{err: &etcdError{fmt.Errorf("failed to receive snapshot (%v)", rpctypes.ErrGRPCInvalidAuthToken)}, want: true},
+		{err: rpctypes.ErrAuthFailed, want: false},
+	}
+	for i, tt := range tests {
+		if got := isAuthTokenExpired(tt.err); got != tt.want {
+			t.Errorf("#%d: expect %v for %v, get %v", i, tt.want, tt.err, got)
+		}
+	}
+}
@@ -15,9 +15,12 @@
 package backend
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/coreos/etcd-operator/pkg/backup/abs"
 	"github.com/coreos/etcd-operator/pkg/backup/util"
@@ -25,8 +28,11 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// ensure absBackend satisfies backend interface.
-var _ Backend = &absBackend{}
+// ensure absBackend satisfies backend interfaces.
+var (
+	_ Backend = &absBackend{}
+	_ Pinger  = &absBackend{}
+)
 
 // absBackend is the Azure Blob Storage backend.
 type absBackend struct {
@@ -37,10 +43,25 @@ func NewAbsBackend(abs *abs.ABS) Backend {
 	return &absBackend{abs}
 }
 
-func (ab *absBackend) Save(version string, snapRev int64, r io.Reader) (int64, error) {
-	key := util.MakeBackupName(version, snapRev)
+func (ab *absBackend) Save(ctx context.Context, version string, snapRev int64, r io.Reader) (int64, error) {
+	return ab.save(ctx, util.MakeBackupName(version, snapRev), r)
+}
+
+func (ab *absBackend) SaveDelta(ctx context.Context, version string, rev int64, r io.Reader) (int64, error) {
+	return ab.save(ctx, util.MakeDeltaName(version, rev), r)
+}
+
+func (ab *absBackend) SaveChecksum(ctx context.Context, version string, rev int64, sum string) error {
+	_, err := ab.save(ctx, util.MakeChecksumName(util.MakeBackupName(version, rev)), strings.NewReader(sum))
+	return err
+}
+
+func (ab *absBackend) SaveAs(ctx context.Context, name string, r io.Reader) (int64, error) {
+	return ab.save(ctx, name, r)
+}
 
-	err := ab.ABS.Put(key, r)
+func (ab *absBackend) save(ctx context.Context, key string, r io.Reader) (int64, error) {
+	err := ab.ABS.Put(ctx, key, r)
 	if err != nil {
 		return -1, err
 	}
@@ -54,6 +75,10 @@ func (ab *absBackend) Save(version string, snapRev int64, r io.Reader) (int64, e
 	return n, nil
 }
 
+func (ab *absBackend) Ping(ctx context.Context) error {
+	return ab.ABS.Ping(ctx)
+}
+
 func (ab *absBackend) GetLatest() (string, error) {
 	keys, err := ab.ABS.List()
 	if err != nil {
@@ -63,11 +88,36 @@ func (ab *absBackend) GetLatest() (string, error) {
 	return util.GetLatestBackupName(keys), nil
 }
 
+func (ab *absBackend) List() ([]BackupMeta, error) {
+	infos, err := ab.ABS.ListBlobInfos()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list abs container: %v", err)
+	}
+
+	keys := make([]string, 0, len(infos))
+	for k := range infos {
+		keys = append(keys, k)
+	}
+	var metas []BackupMeta
+	for _, k := range util.FilterAndSortBackups(keys) {
+		metas = append(metas, newBackupMeta(k, ab.ABS.Path(k), infos[k].Size, infos[k].LastModified))
+	}
+	return metas, nil
+}
+
+func (ab *absBackend) ListDeltas(baseRev int64) ([]string, error) {
+	keys, err := ab.ABS.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list abs container: %v", err)
+	}
+	return util.FilterAndSortDeltas(keys, baseRev), nil
+}
+
 func (ab *absBackend) Open(name string) (io.ReadCloser, error) {
 	return ab.ABS.Get(name)
 }
 
-func (ab *absBackend) Purge(maxBackupFiles int) error {
+func (ab *absBackend) KeepLatestN(ctx context.Context, maxBackupFiles int) error {
 	names, err := ab.ABS.List()
 	if err != nil {
 		return err
@@ -76,13 +126,46 @@ func (ab *absBackend) Purge(maxBackupFiles int) error {
 	if len(bnames) < maxBackupFiles {
 		return nil
 	}
-	for i := 0; i < len(bnames)-maxBackupFiles; i++ {
-		err := ab.ABS.Delete(bnames[i])
-		if err != nil {
-			logrus.Errorf("fail to delete abs blob (%s): %v", bnames[i], err)
+	removed := bnames[:len(bnames)-maxBackupFiles]
+	if err := purge(ctx, removed, ab.delete); err != nil {
+		return err
+	}
+	// the deltas taken on top of the removed backups can't be replayed anymore.
+	return purge(ctx, util.ObsoleteDeltas(names, removed), ab.delete)
+}
+
+func (ab *absBackend) PruneOlderThan(ctx context.Context, d time.Duration) error {
+	modTimes, err := ab.ABS.ListModTimes()
+	if err != nil {
+		return err
+	}
+	old := util.BackupsOlderThan(modTimes, time.Now().Add(-d))
+	if err := purge(ctx, old, ab.delete); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(modTimes))
+	for n := range modTimes {
+		names = append(names, n)
+	}
+	return purge(ctx, util.ObsoleteDeltas(names, old), ab.delete)
+}
+
+func (ab *absBackend) Delete(name string) error {
+	return ab.ABS.DeleteIfExists(name)
+}
+
+// delete deletes the backup blob with its checksum and cluster metadata blobs.
+func (ab *absBackend) delete(name string) {
+	err := ab.ABS.Delete(name)
+	if err != nil {
+		logrus.Errorf("fail to delete abs blob (%s): %v", name, err)
+		return
+	}
+	for _, sname := range []string{util.MakeChecksumName(name), util.MakeClusterMetadataName(name)} {
+		if err = ab.ABS.DeleteIfExists(sname); err != nil {
+			logrus.Errorf("fail to delete abs blob (%s): %v", sname, err)
 		}
 	}
-	return nil
 }
 
 func (ab *absBackend) Total() (int, error) {
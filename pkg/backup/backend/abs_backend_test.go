@@ -16,6 +16,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"fmt"
 	"io/ioutil"
@@ -115,10 +116,10 @@ func TestABSBackendGetLatest(t *testing.T) {
 	}
 	ab := &absBackend{ABS: abs}
 
-	if _, err := ab.Save("3.1.0", 1, bytes.NewBuffer([]byte(blobContents))); err != nil {
+	if _, err := ab.Save(context.Background(), "3.1.0", 1, bytes.NewBuffer([]byte(blobContents))); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := ab.Save("3.1.1", 2, bytes.NewBuffer([]byte(blobContents))); err != nil {
+	if _, err := ab.Save(context.Background(), "3.1.1", 2, bytes.NewBuffer([]byte(blobContents))); err != nil {
 		t.Fatal(err)
 	}
 
@@ -198,13 +199,13 @@ func TestABSBackendPurge(t *testing.T) {
 	}
 	ab := &absBackend{ABS: abs}
 
-	if _, err := ab.Save("3.1.0", 1, bytes.NewBuffer([]byte(blobContents))); err != nil {
+	if _, err := ab.Save(context.Background(), "3.1.0", 1, bytes.NewBuffer([]byte(blobContents))); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := ab.Save("3.1.0", 2, bytes.NewBuffer([]byte(blobContents))); err != nil {
+	if _, err := ab.Save(context.Background(), "3.1.0", 2, bytes.NewBuffer([]byte(blobContents))); err != nil {
 		t.Fatal(err)
 	}
-	if err := ab.Purge(1); err != nil {
+	if err := ab.KeepLatestN(context.Background(), 1); err != nil {
 		t.Fatal(err)
 	}
 	names, err := abs.List()
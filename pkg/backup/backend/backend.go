@@ -14,27 +14,131 @@
 
 package backend
 
-import "io"
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
 
 // Backend defines required backend operations
 type Backend interface {
 	// Save saves the backup from the given reader with given etcd version and revision.
-	// It returns the size of the snapshot saved.
-	Save(etcdVersion string, rev int64, r io.Reader) (size int64, err error)
+	// It returns the size of the snapshot saved. The save is abandoned if ctx is cancelled.
+	Save(ctx context.Context, etcdVersion string, rev int64, r io.Reader) (size int64, err error)
+
+	// SaveDelta saves the changes since the previous backup or delta from the given reader
+	// with given etcd version and the revision the delta brings the backup up to.
+	// It returns the size of the delta saved.
+	SaveDelta(ctx context.Context, etcdVersion string, rev int64, r io.Reader) (size int64, err error)
+
+	// SaveChecksum saves the hex encoded SHA-256 checksum of the backup with given etcd version
+	// and revision next to the backup, under the name given by util.MakeChecksumName.
+	SaveChecksum(ctx context.Context, etcdVersion string, rev int64, sum string) error
+
+	// SaveAs saves the file from the given reader under the given name.
+	// It is used by the backends that wrap another backend and name the files themselves.
+	// It returns the size of the file saved.
+	SaveAs(ctx context.Context, name string, r io.Reader) (size int64, err error)
+
+	// ListDeltas returns the names of the deltas newer than baseRev in ascending revision order.
+	ListDeltas(baseRev int64) (names []string, err error)
+
+	// List returns the metadata of all backups in ascending revision order.
+	List() ([]BackupMeta, error)
 
 	// GetLatest gets latest backup's name.
 	// If no backup is available, returns empty string name.
 	GetLatest() (name string, err error)
 
-	// Open opens a backup file for reading
+	// Open opens the file saved under the given name for reading, e.g. a backup listed by List.
+	// os.IsNotExist(err) is true if the file does not exist.
 	Open(name string) (rc io.ReadCloser, err error)
 
+	// Delete deletes the file saved under the given name by SaveAs.
+	// Deleting a file that does not exist is not an error.
+	Delete(name string) error
+
 	// Total returns the total number of available backups.
 	Total() (int, error)
 
 	// TotalSize returns the total size of the backups.
 	TotalSize() (int64, error)
 
-	// Purge purges backup files when backups are greater than maxBackupFiles.
-	Purge(maxBackupFiles int) error
+	// KeepLatestN purges the oldest backup files when backups are greater than n.
+	// It stops purging once ctx is cancelled.
+	KeepLatestN(ctx context.Context, n int) error
+
+	// PruneOlderThan purges backup files older than d.
+	// The latest backup is always kept. It stops purging once ctx is cancelled.
+	PruneOlderThan(ctx context.Context, d time.Duration) error
+}
+
+// Pinger is implemented by the backends which can check cheaply, without saving anything, that their storage
+// is reachable and accepts their credentials, e.g. with a HEAD request on the bucket.
+type Pinger interface {
+	// Ping checks the storage the backups are saved to.
+	Ping(ctx context.Context) error
+}
+
+// Ping checks the storage of be. It returns nil if be can't check its storage.
+func Ping(ctx context.Context, be Backend) error {
+	if p, ok := be.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// URLSigner is implemented by the backends which can generate URLs to download their backups
+// without credentials, e.g. pre-signed S3 URLs.
+type URLSigner interface {
+	// SignedURL returns a URL to download the backup of the given name which expires after ttl.
+	SignedURL(name string, ttl time.Duration) (string, error)
+}
+
+// BackupMeta describes a backup saved in a backend.
+type BackupMeta struct {
+	// Name is the name of the backup, which Open takes.
+	Name string `json:"name"`
+
+	// Path is where the backup is stored, e.g. <bucket>/<prefix>/<name> on S3.
+	Path string `json:"path"`
+
+	// Version is the etcd version of the backup.
+	Version string `json:"version"`
+
+	// Revision is the etcd revision the backup was taken at.
+	Revision int64 `json:"revision"`
+
+	// Size is the size of the backup in bytes as stored, e.g. after compression.
+	Size int64 `json:"size"`
+
+	// CreationTime is when the backup was saved to the backend.
+	CreationTime time.Time `json:"creationTime"`
+}
+
+// newBackupMeta returns the metadata of the backup with the given name, which must be
+// listed by util.FilterAndSortBackups.
+func newBackupMeta(name, path string, size int64, created time.Time) BackupMeta {
+	return BackupMeta{
+		Name:         name,
+		Path:         path,
+		Version:      strings.SplitN(name, "_", 2)[0],
+		Revision:     util.MustParseRevision(name),
+		Size:         size,
+		CreationTime: created,
+	}
+}
+
+// purge removes the files of the given names with remove until ctx is cancelled.
+func purge(ctx context.Context, names []string, remove func(name string)) error {
+	for _, n := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		remove(n)
+	}
+	return nil
 }
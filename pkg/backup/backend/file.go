@@ -15,20 +15,26 @@
 package backend
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/coreos/etcd-operator/pkg/backup/util"
 
 	"github.com/sirupsen/logrus"
 )
 
-// ensure fileBackend satisfies backend interface.
-var _ Backend = &fileBackend{}
+// ensure fileBackend satisfies backend interfaces.
+var (
+	_ Backend = &fileBackend{}
+	_ Pinger  = &fileBackend{}
+)
 
 // fileBackend is file based backend.
 type fileBackend struct {
@@ -39,13 +45,29 @@ func NewFileBackend(dir string) Backend {
 	return &fileBackend{dir}
 }
 
-func (fb *fileBackend) Save(version string, snapRev int64, rc io.Reader) (int64, error) {
-	filename := util.MakeBackupName(version, snapRev)
+func (fb *fileBackend) Save(ctx context.Context, version string, snapRev int64, rc io.Reader) (int64, error) {
+	return fb.save(ctx, util.MakeBackupName(version, snapRev), rc)
+}
+
+func (fb *fileBackend) SaveDelta(ctx context.Context, version string, rev int64, rc io.Reader) (int64, error) {
+	return fb.save(ctx, util.MakeDeltaName(version, rev), rc)
+}
+
+func (fb *fileBackend) SaveChecksum(ctx context.Context, version string, rev int64, sum string) error {
+	_, err := fb.save(ctx, util.MakeChecksumName(util.MakeBackupName(version, rev)), strings.NewReader(sum))
+	return err
+}
+
+func (fb *fileBackend) SaveAs(ctx context.Context, name string, rc io.Reader) (int64, error) {
+	return fb.save(ctx, name, rc)
+}
+
+func (fb *fileBackend) save(ctx context.Context, filename string, rc io.Reader) (int64, error) {
 	tmpfile, err := os.OpenFile(filepath.Join(fb.dir, util.BackupTmpDir, filename), os.O_WRONLY|os.O_TRUNC|os.O_CREATE, util.BackupFilePerm)
 	if err != nil {
 		return -1, fmt.Errorf("failed to create snapshot tempfile: %v", err)
 	}
-	n, err := io.Copy(tmpfile, rc)
+	n, err := io.Copy(tmpfile, util.NewContextReader(ctx, rc))
 	if err != nil {
 		tmpfile.Close()
 		os.Remove(tmpfile.Name())
@@ -68,6 +90,19 @@ func (fb *fileBackend) Save(version string, snapRev int64, rc io.Reader) (int64,
 	return n, nil
 }
 
+// Ping checks that the directory the backups are saved to through exists.
+func (fb *fileBackend) Ping(ctx context.Context) error {
+	dir := filepath.Join(fb.dir, util.BackupTmpDir)
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("backup directory (%s) is not a directory", dir)
+	}
+	return nil
+}
+
 func (fb *fileBackend) GetLatest() (string, error) {
 	files, err := ioutil.ReadDir(fb.dir)
 	if err != nil {
@@ -86,11 +121,43 @@ func (fb *fileBackend) GetLatest() (string, error) {
 	return fn, err
 }
 
+func (fb *fileBackend) List() ([]BackupMeta, error) {
+	files, err := ioutil.ReadDir(fb.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dir (%s): error (%v)", fb.dir, err)
+	}
+
+	var names []string
+	infos := make(map[string]os.FileInfo, len(files))
+	for _, f := range files {
+		names = append(names, f.Name())
+		infos[f.Name()] = f
+	}
+	var metas []BackupMeta
+	for _, n := range util.FilterAndSortBackups(names) {
+		metas = append(metas, newBackupMeta(n, filepath.Join(fb.dir, n), infos[n].Size(), infos[n].ModTime()))
+	}
+	return metas, nil
+}
+
+func (fb *fileBackend) ListDeltas(baseRev int64) ([]string, error) {
+	files, err := ioutil.ReadDir(fb.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dir (%s): error (%v)", fb.dir, err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	return util.FilterAndSortDeltas(names, baseRev), nil
+}
+
 func (fb *fileBackend) Open(name string) (io.ReadCloser, error) {
 	return os.Open(filepath.Join(fb.dir, name))
 }
 
-func (fb *fileBackend) Purge(maxBackupFiles int) error {
+func (fb *fileBackend) KeepLatestN(ctx context.Context, maxBackupFiles int) error {
 	files, err := ioutil.ReadDir(fb.dir)
 	if err != nil {
 		return err
@@ -105,17 +172,61 @@ func (fb *fileBackend) Purge(maxBackupFiles int) error {
 	if len(bnames) < maxBackupFiles {
 		return nil
 	}
-	for i := 0; i < len(bnames)-maxBackupFiles; i++ {
-		err := os.Remove(path.Join(fb.dir, bnames[i]))
-		if err != nil {
-			logrus.Errorf("failed to remove backup file (%s): %v", bnames[i], err)
-		} else {
-			logrus.Infof("removed backup file: %s", bnames[i])
-		}
+	removed := bnames[:len(bnames)-maxBackupFiles]
+	if err := purge(ctx, removed, fb.remove); err != nil {
+		return err
+	}
+	// the deltas taken on top of the removed backups can't be replayed anymore.
+	return purge(ctx, util.ObsoleteDeltas(names, removed), fb.remove)
+}
+
+func (fb *fileBackend) PruneOlderThan(ctx context.Context, d time.Duration) error {
+	files, err := ioutil.ReadDir(fb.dir)
+	if err != nil {
+		return err
+	}
+
+	modTimes := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		modTimes[f.Name()] = f.ModTime()
+	}
+
+	old := util.BackupsOlderThan(modTimes, time.Now().Add(-d))
+	if err := purge(ctx, old, fb.remove); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(modTimes))
+	for n := range modTimes {
+		names = append(names, n)
+	}
+	return purge(ctx, util.ObsoleteDeltas(names, old), fb.remove)
+}
+
+func (fb *fileBackend) Delete(name string) error {
+	err := os.Remove(path.Join(fb.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
 	return nil
 }
 
+// remove removes the backup file with its checksum and cluster metadata files.
+func (fb *fileBackend) remove(name string) {
+	err := os.Remove(path.Join(fb.dir, name))
+	if err != nil {
+		logrus.Errorf("failed to remove backup file (%s): %v", name, err)
+		return
+	}
+	logrus.Infof("removed backup file: %s", name)
+
+	for _, sname := range []string{util.MakeChecksumName(name), util.MakeClusterMetadataName(name)} {
+		err = os.Remove(path.Join(fb.dir, sname))
+		if err != nil && !os.IsNotExist(err) {
+			logrus.Errorf("failed to remove file (%s) saved with backup: %v", sname, err)
+		}
+	}
+}
+
 func (fb *fileBackend) Total() (int, error) {
 	files, err := ioutil.ReadDir(fb.dir)
 	if err != nil {
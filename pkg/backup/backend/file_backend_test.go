@@ -15,11 +15,14 @@
 package backend
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/coreos/etcd-operator/pkg/backup/util"
 )
@@ -71,6 +74,58 @@ func TestFileBackendGetLatest(t *testing.T) {
 	}
 }
 
+func TestFileBackendList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fb := &fileBackend{dir}
+	files := []string{
+		util.MakeBackupName("3.1.0", 20),
+		util.MakeChecksumName(util.MakeBackupName("3.1.0", 20)),
+		util.MakeBackupName("3.0.4", 3),
+		"3.0.1_badbackup_etcd.backup",
+	}
+	for _, n := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, n), []byte(n), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := fb.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name    string
+		version string
+		rev     int64
+	}{
+		{name: util.MakeBackupName("3.0.4", 3), version: "3.0.4", rev: 3},
+		{name: util.MakeBackupName("3.1.0", 20), version: "3.1.0", rev: 20},
+	}
+	if len(backups) != len(want) {
+		t.Fatalf("backups = %+v, want %d backups", backups, len(want))
+	}
+	for i, w := range want {
+		b := backups[i]
+		if b.Name != w.name || b.Version != w.version || b.Revision != w.rev {
+			t.Errorf("#%d: backup = %+v, want name %s, version %s, revision %d", i, b, w.name, w.version, w.rev)
+		}
+		if b.Path != filepath.Join(dir, w.name) {
+			t.Errorf("#%d: path = %s, want %s", i, b.Path, filepath.Join(dir, w.name))
+		}
+		if b.Size != int64(len(w.name)) {
+			t.Errorf("#%d: size = %d, want %d", i, b.Size, len(w.name))
+		}
+		if b.CreationTime.IsZero() {
+			t.Errorf("#%d: expect creation time", i)
+		}
+	}
+}
+
 func TestFileBackendPurge(t *testing.T) {
 	tests := []struct {
 		maxFiles  int
@@ -113,6 +168,33 @@ func TestFileBackendPurge(t *testing.T) {
 			util.MakeBackupName("3.1.0", 3), // keep two of the highest revs
 		},
 		leftFiles: []string{util.MakeBackupName("3.1.0", 2), util.MakeBackupName("3.1.0", 3)},
+	}, {
+		maxFiles: 1,
+		files: []string{
+			util.MakeBackupName("3.1.0", 1),
+			util.MakeChecksumName(util.MakeBackupName("3.1.0", 1)), // checksum goes with its backup
+			util.MakeBackupName("3.1.0", 2),
+			util.MakeChecksumName(util.MakeBackupName("3.1.0", 2)),
+		},
+		leftFiles: []string{util.MakeBackupName("3.1.0", 2), util.MakeChecksumName(util.MakeBackupName("3.1.0", 2))},
+	}, {
+		maxFiles: 1,
+		files: []string{
+			util.MakeBackupName("3.1.0", 1),
+			util.MakeClusterMetadataName(util.MakeBackupName("3.1.0", 1)), // so does its cluster metadata
+			util.MakeBackupName("3.1.0", 2),
+			util.MakeClusterMetadataName(util.MakeBackupName("3.1.0", 2)),
+		},
+		leftFiles: []string{util.MakeBackupName("3.1.0", 2), util.MakeClusterMetadataName(util.MakeBackupName("3.1.0", 2))},
+	}, {
+		maxFiles: 1,
+		files: []string{
+			util.MakeBackupName("3.1.0", 1),
+			util.MakeDeltaName("3.1.0", 2), // deltas go with the backup they are taken on top of
+			util.MakeBackupName("3.1.0", 3),
+			util.MakeDeltaName("3.1.0", 4),
+		},
+		leftFiles: []string{util.MakeBackupName("3.1.0", 3), util.MakeDeltaName("3.1.0", 4)},
 	}}
 
 	for i, tt := range tests {
@@ -127,7 +209,7 @@ func TestFileBackendPurge(t *testing.T) {
 				t.Fatal(err)
 			}
 		}
-		fb.Purge(tt.maxFiles)
+		fb.KeepLatestN(context.Background(), tt.maxFiles)
 		infos, err := ioutil.ReadDir(dir)
 		if err != nil {
 			t.Fatal(err)
@@ -146,3 +228,82 @@ func TestFileBackendPurge(t *testing.T) {
 		}
 	}
 }
+
+func TestFileBackendPruneOlderThan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	files := map[string]time.Time{
+		util.MakeBackupName("3.1.0", 1): now.Add(-3 * time.Hour),
+		util.MakeBackupName("3.1.0", 2): now.Add(-time.Minute),
+		util.MakeBackupName("3.1.0", 3): now.Add(-3 * time.Hour), // latest backup is always kept
+	}
+	for name, mt := range files {
+		f := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(f, []byte("ignore"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(f, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fb := &fileBackend{dir}
+	if err := fb.PruneOlderThan(context.Background(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range infos {
+		names = append(names, f.Name())
+	}
+	leftFiles := []string{util.MakeBackupName("3.1.0", 2), util.MakeBackupName("3.1.0", 3)}
+	if !reflect.DeepEqual(leftFiles, names) {
+		t.Errorf("left files after prune, want=%v, get=%v", leftFiles, names)
+	}
+}
+
+func TestFileBackendCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(filepath.Join(dir, util.BackupTmpDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{util.MakeBackupName("3.1.0", 1), util.MakeBackupName("3.1.0", 2)}
+	for _, name := range names {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte("ignore"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fb := &fileBackend{dir}
+	if _, err = fb.Save(ctx, "3.1.0", 3, strings.NewReader("snapshot")); err == nil {
+		t.Error("expect save to fail once cancelled")
+	}
+	if err = fb.KeepLatestN(ctx, 1); err != context.Canceled {
+		t.Errorf("expect purge to stop with %v, got %v", context.Canceled, err)
+	}
+	latest, err := fb.GetLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != names[1] {
+		t.Errorf("latest backup = %s, want %s", latest, names[1])
+	}
+	if n, err := fb.Total(); err != nil || n != len(names) {
+		t.Errorf("total = %d (%v), want %d", n, err, len(names))
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ensure nullBackend satisfies backend interface.
+var _ Backend = &nullBackend{}
+
+// nullBackend discards the backups. It measures the throughput of taking snapshots
+// without the cost of writing them to a storage.
+// It only remembers the metadata of the latest backup, so that the backups can still be
+// scheduled and pruned, but none can be opened.
+type nullBackend struct {
+	mu     sync.Mutex
+	latest *BackupMeta
+}
+
+// NewNullBackend returns a backend which discards the backups.
+func NewNullBackend() Backend {
+	return &nullBackend{}
+}
+
+func (nb *nullBackend) Save(ctx context.Context, version string, snapRev int64, rc io.Reader) (int64, error) {
+	name := util.MakeBackupName(version, snapRev)
+	n, err := nb.save(ctx, name, rc)
+	if err != nil {
+		return -1, err
+	}
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	meta := newBackupMeta(name, name, n, time.Now())
+	nb.latest = &meta
+	return n, nil
+}
+
+func (nb *nullBackend) SaveDelta(ctx context.Context, version string, rev int64, rc io.Reader) (int64, error) {
+	return nb.save(ctx, util.MakeDeltaName(version, rev), rc)
+}
+
+func (nb *nullBackend) SaveChecksum(ctx context.Context, version string, rev int64, sum string) error {
+	return nil
+}
+
+func (nb *nullBackend) SaveAs(ctx context.Context, name string, rc io.Reader) (int64, error) {
+	return nb.save(ctx, name, rc)
+}
+
+func (nb *nullBackend) save(ctx context.Context, name string, rc io.Reader) (int64, error) {
+	start := time.Now()
+	n, err := io.Copy(ioutil.Discard, util.NewContextReader(ctx, rc))
+	if err != nil {
+		return -1, err
+	}
+	logrus.Infof("discarded backup %s (size: %d) in %v", name, n, time.Since(start))
+	return n, nil
+}
+
+func (nb *nullBackend) ListDeltas(baseRev int64) ([]string, error) {
+	return nil, nil
+}
+
+func (nb *nullBackend) List() ([]BackupMeta, error) {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	if nb.latest == nil {
+		return nil, nil
+	}
+	return []BackupMeta{*nb.latest}, nil
+}
+
+func (nb *nullBackend) GetLatest() (string, error) {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	if nb.latest == nil {
+		return "", nil
+	}
+	return nb.latest.Name, nil
+}
+
+// Open always fails, since the backups are discarded.
+func (nb *nullBackend) Open(name string) (io.ReadCloser, error) {
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
+
+func (nb *nullBackend) Delete(name string) error {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	if nb.latest != nil && nb.latest.Name == name {
+		nb.latest = nil
+	}
+	return nil
+}
+
+func (nb *nullBackend) Total() (int, error) {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	if nb.latest == nil {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (nb *nullBackend) TotalSize() (int64, error) {
+	nb.mu.Lock()
+	defer nb.mu.Unlock()
+	if nb.latest == nil {
+		return 0, nil
+	}
+	return nb.latest.Size, nil
+}
+
+// KeepLatestN does nothing, since only the latest backup is remembered.
+func (nb *nullBackend) KeepLatestN(ctx context.Context, n int) error {
+	return nil
+}
+
+// PruneOlderThan does nothing, since the latest backup is always kept.
+func (nb *nullBackend) PruneOlderThan(ctx context.Context, d time.Duration) error {
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+func TestNullBackend(t *testing.T) {
+	nb := NewNullBackend()
+	if name, err := nb.GetLatest(); err != nil || len(name) != 0 {
+		t.Fatalf("GetLatest() = %q, %v, want no backup", name, err)
+	}
+
+	data := []byte("etcd snapshot")
+	n, err := nb.Save(context.Background(), "3.1.9", 10, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("size = %d, want %d", n, len(data))
+	}
+
+	wname := util.MakeBackupName("3.1.9", 10)
+	if name, err := nb.GetLatest(); err != nil || name != wname {
+		t.Errorf("GetLatest() = %q, %v, want %q", name, err, wname)
+	}
+	metas, err := nb.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metas) != 1 || metas[0].Name != wname || metas[0].Revision != 10 || metas[0].Size != int64(len(data)) {
+		t.Errorf("List() = %+v, want the metadata of %s", metas, wname)
+	}
+	if total, err := nb.Total(); err != nil || total != 1 {
+		t.Errorf("Total() = %d, %v, want 1", total, err)
+	}
+	if _, err := nb.Open(wname); !os.IsNotExist(err) {
+		t.Errorf("Open() err = %v, want not exist", err)
+	}
+
+	if err := nb.Delete(wname); err != nil {
+		t.Fatal(err)
+	}
+	if total, err := nb.Total(); err != nil || total != 0 {
+		t.Errorf("Total() = %d, %v after delete, want 0", total, err)
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReplicationMode is how a ReplicatedBackend writes to its backends.
+type ReplicationMode string
+
+const (
+	// ReplicationSync writes to all the backends before a write returns.
+	ReplicationSync ReplicationMode = "sync"
+	// ReplicationAsync writes to the first backend before a write returns and to the others in the background.
+	ReplicationAsync ReplicationMode = "async"
+)
+
+// ReplicationError is returned by a ReplicatedBackend if some of its backends failed.
+type ReplicationError struct {
+	// Errs maps the index of each failed backend to its error.
+	Errs map[int]error
+	// Total is the number of backends.
+	Total int
+}
+
+func (e *ReplicationError) Error() string {
+	idx := make([]int, 0, len(e.Errs))
+	for i := range e.Errs {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d of %d backend(s) failed:", len(idx), e.Total)
+	for _, i := range idx {
+		fmt.Fprintf(&b, " [%d] %v;", i, e.Errs[i])
+	}
+	return b.String()
+}
+
+// IsPartialReplication returns true if err reports that only a minority of the backends of a ReplicatedBackend
+// failed, which means the write succeeded on a quorum of them.
+func IsPartialReplication(err error) bool {
+	e, ok := err.(*ReplicationError)
+	return ok && e.Total-len(e.Errs) >= quorum(e.Total)
+}
+
+func quorum(n int) int {
+	return n/2 + 1
+}
+
+var (
+	_ Backend = &ReplicatedBackend{}
+	_ Pinger  = &ReplicatedBackend{}
+)
+
+// ReplicatedBackend replicates the backups to several backends, e.g. buckets in different regions.
+// It reads from the first backend that succeeds, in the given order, while GetLatest returns
+// the latest backup present on a quorum of the backends.
+// Writes that fail on some of the backends return a *ReplicationError.
+type ReplicatedBackend struct {
+	backends []Backend
+	mode     ReplicationMode
+	// tmpDir is where the files are spooled to before they are written to the backends.
+	tmpDir string
+
+	// wg tracks the writes in the background of ReplicationAsync.
+	wg sync.WaitGroup
+	// mu guards asyncErrs.
+	mu sync.Mutex
+	// asyncErrs are the errors of the writes in the background since the last Wait, by backend index.
+	asyncErrs map[int]error
+}
+
+// NewReplicatedBackend creates a ReplicatedBackend which replicates to the given backends,
+// at least 2, with the given mode. The first backend is the one written synchronously with ReplicationAsync.
+func NewReplicatedBackend(mode ReplicationMode, backends ...Backend) (*ReplicatedBackend, error) {
+	if len(backends) < 2 {
+		return nil, fmt.Errorf("replicating needs at least 2 backends, got %d", len(backends))
+	}
+	if mode != ReplicationSync && mode != ReplicationAsync {
+		return nil, fmt.Errorf("unknown replication mode (%s)", mode)
+	}
+	return &ReplicatedBackend{
+		backends:  backends,
+		mode:      mode,
+		tmpDir:    os.TempDir(),
+		asyncErrs: make(map[int]error),
+	}, nil
+}
+
+func (rb *ReplicatedBackend) Save(ctx context.Context, version string, rev int64, r io.Reader) (int64, error) {
+	return rb.replicate(ctx, r, func(ctx context.Context, be Backend, r io.Reader) (int64, error) {
+		return be.Save(ctx, version, rev, r)
+	})
+}
+
+func (rb *ReplicatedBackend) SaveDelta(ctx context.Context, version string, rev int64, r io.Reader) (int64, error) {
+	return rb.replicate(ctx, r, func(ctx context.Context, be Backend, r io.Reader) (int64, error) {
+		return be.SaveDelta(ctx, version, rev, r)
+	})
+}
+
+func (rb *ReplicatedBackend) SaveChecksum(ctx context.Context, version string, rev int64, sum string) error {
+	_, err := rb.replicate(ctx, strings.NewReader(sum), func(ctx context.Context, be Backend, _ io.Reader) (int64, error) {
+		return 0, be.SaveChecksum(ctx, version, rev, sum)
+	})
+	return err
+}
+
+func (rb *ReplicatedBackend) SaveAs(ctx context.Context, name string, r io.Reader) (int64, error) {
+	return rb.replicate(ctx, r, func(ctx context.Context, be Backend, r io.Reader) (int64, error) {
+		return be.SaveAs(ctx, name, r)
+	})
+}
+
+// saveFunc saves r to be.
+type saveFunc func(ctx context.Context, be Backend, r io.Reader) (int64, error)
+
+// replicate spools r to a temporary file and saves it to the backends with save.
+// It returns the size saved to the first backend that succeeded.
+// The writes in the background of ReplicationAsync outlive the call, so they are not cancelled with ctx.
+func (rb *ReplicatedBackend) replicate(ctx context.Context, r io.Reader, save saveFunc) (int64, error) {
+	f, err := ioutil.TempFile(rb.tmpDir, "replicated-backup")
+	if err != nil {
+		return -1, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	size, err := io.Copy(f, util.NewContextReader(ctx, r))
+	if err != nil {
+		cleanup()
+		return -1, err
+	}
+
+	if rb.mode == ReplicationSync {
+		defer cleanup()
+		sizes, errs := rb.saveAll(ctx, f, size, all(len(rb.backends)), save)
+		for i := range rb.backends {
+			if _, ok := errs[i]; !ok {
+				if len(errs) != 0 {
+					return sizes[i], &ReplicationError{Errs: errs, Total: len(rb.backends)}
+				}
+				return sizes[i], nil
+			}
+		}
+		return -1, &ReplicationError{Errs: errs, Total: len(rb.backends)}
+	}
+
+	n, err := save(ctx, rb.backends[0], io.NewSectionReader(f, 0, size))
+	if err != nil {
+		cleanup()
+		return -1, &ReplicationError{Errs: map[int]error{0: err}, Total: len(rb.backends)}
+	}
+	rb.wg.Add(1)
+	go func() {
+		defer rb.wg.Done()
+		defer cleanup()
+		_, errs := rb.saveAll(context.Background(), f, size, all(len(rb.backends))[1:], save)
+		if len(errs) == 0 {
+			return
+		}
+		rb.mu.Lock()
+		for i, err := range errs {
+			rb.asyncErrs[i] = err
+		}
+		rb.mu.Unlock()
+		logrus.Errorf("failed to replicate backup: %v", &ReplicationError{Errs: errs, Total: len(rb.backends)})
+	}()
+	return n, nil
+}
+
+// saveAll saves the first size bytes of f to the backends of the given indexes concurrently.
+// It returns the sizes saved and the errors by backend index.
+func (rb *ReplicatedBackend) saveAll(ctx context.Context, f *os.File, size int64, idx []int, save saveFunc) (map[int]int64, map[int]error) {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		sizes = make(map[int]int64, len(idx))
+		errs  = make(map[int]error)
+	)
+	for _, i := range idx {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// ReadAt is safe for concurrent use, so each backend reads the file on its own.
+			n, err := save(ctx, rb.backends[i], io.NewSectionReader(f, 0, size))
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			sizes[i] = n
+		}(i)
+	}
+	wg.Wait()
+	return sizes, errs
+}
+
+func all(n int) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+// Wait waits for the writes in the background of ReplicationAsync to finish.
+// It returns a *ReplicationError of the writes that failed since the last Wait, if any.
+func (rb *ReplicatedBackend) Wait() error {
+	rb.wg.Wait()
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if len(rb.asyncErrs) == 0 {
+		return nil
+	}
+	err := &ReplicationError{Errs: rb.asyncErrs, Total: len(rb.backends)}
+	rb.asyncErrs = make(map[int]error)
+	return err
+}
+
+// GetLatest returns the name of the latest backup present on a quorum of the backends,
+// so that a backup that has not been replicated yet, or only partially, is not restored from.
+func (rb *ReplicatedBackend) GetLatest() (string, error) {
+	var (
+		counts = make(map[string]int)
+		revs   = make(map[string]int64)
+		errs   = make(map[int]error)
+	)
+	for i, be := range rb.backends {
+		backups, err := be.List()
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		for _, b := range backups {
+			counts[b.Name]++
+			revs[b.Name] = b.Revision
+		}
+	}
+	if len(rb.backends)-len(errs) < quorum(len(rb.backends)) {
+		return "", &ReplicationError{Errs: errs, Total: len(rb.backends)}
+	}
+
+	var latest string
+	for name, n := range counts {
+		if n < quorum(len(rb.backends)) {
+			continue
+		}
+		if len(latest) == 0 || revs[name] > revs[latest] || (revs[name] == revs[latest] && name > latest) {
+			latest = name
+		}
+	}
+	return latest, nil
+}
+
+// List lists the backups of the first backend that succeeds.
+func (rb *ReplicatedBackend) List() ([]BackupMeta, error) {
+	var backups []BackupMeta
+	err := rb.first(func(be Backend) (err error) {
+		backups, err = be.List()
+		return err
+	})
+	return backups, err
+}
+
+// ListDeltas lists the deltas of the first backend that succeeds.
+func (rb *ReplicatedBackend) ListDeltas(baseRev int64) ([]string, error) {
+	var names []string
+	err := rb.first(func(be Backend) (err error) {
+		names, err = be.ListDeltas(baseRev)
+		return err
+	})
+	return names, err
+}
+
+// Open opens the file from the first backend that succeeds.
+func (rb *ReplicatedBackend) Open(name string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := rb.first(func(be Backend) (err error) {
+		rc, err = be.Open(name)
+		return err
+	})
+	return rc, err
+}
+
+func (rb *ReplicatedBackend) Total() (int, error) {
+	var n int
+	err := rb.first(func(be Backend) (err error) {
+		n, err = be.Total()
+		return err
+	})
+	return n, err
+}
+
+func (rb *ReplicatedBackend) TotalSize() (int64, error) {
+	var n int64
+	err := rb.first(func(be Backend) (err error) {
+		n, err = be.TotalSize()
+		return err
+	})
+	return n, err
+}
+
+// Ping checks the storage of the backends a save waits for: all of them with ReplicationSync,
+// the first one with ReplicationAsync. It returns a *ReplicationError if any of them fails.
+func (rb *ReplicatedBackend) Ping(ctx context.Context) error {
+	if rb.mode == ReplicationAsync {
+		if err := Ping(ctx, rb.backends[0]); err != nil {
+			return &ReplicationError{Errs: map[int]error{0: err}, Total: len(rb.backends)}
+		}
+		return nil
+	}
+	return rb.each(func(be Backend) error { return Ping(ctx, be) })
+}
+
+// first calls fn with the backends in order until it succeeds.
+// It returns the error of the first backend if fn fails with all of them.
+func (rb *ReplicatedBackend) first(fn func(Backend) error) error {
+	var firstErr error
+	for i, be := range rb.backends {
+		err := fn(be)
+		if err == nil {
+			return nil
+		}
+		if i == 0 {
+			firstErr = err
+		}
+		logrus.Warningf("backend [%d] failed, trying the next one: %v", i, err)
+	}
+	return firstErr
+}
+
+func (rb *ReplicatedBackend) Delete(name string) error {
+	return rb.each(func(be Backend) error { return be.Delete(name) })
+}
+
+func (rb *ReplicatedBackend) KeepLatestN(ctx context.Context, n int) error {
+	return rb.each(func(be Backend) error { return be.KeepLatestN(ctx, n) })
+}
+
+func (rb *ReplicatedBackend) PruneOlderThan(ctx context.Context, d time.Duration) error {
+	return rb.each(func(be Backend) error { return be.PruneOlderThan(ctx, d) })
+}
+
+// each calls fn with every backend. It returns a *ReplicationError if fn fails with any of them.
+func (rb *ReplicatedBackend) each(fn func(Backend) error) error {
+	errs := make(map[int]error)
+	for i, be := range rb.backends {
+		if err := fn(be); err != nil {
+			errs[i] = err
+		}
+	}
+	if len(errs) != 0 {
+		return &ReplicationError{Errs: errs, Total: len(rb.backends)}
+	}
+	return nil
+}
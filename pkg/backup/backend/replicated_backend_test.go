@@ -0,0 +1,240 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+// failingBackend is a Backend that fails every call.
+type failingBackend struct {
+	Backend
+}
+
+var errFailingBackend = errors.New("backend down")
+
+func (failingBackend) Save(context.Context, string, int64, io.Reader) (int64, error) {
+	return -1, errFailingBackend
+}
+func (failingBackend) SaveChecksum(context.Context, string, int64, string) error {
+	return errFailingBackend
+}
+func (failingBackend) List() ([]BackupMeta, error)        { return nil, errFailingBackend }
+func (failingBackend) Open(string) (io.ReadCloser, error) { return nil, errFailingBackend }
+func (failingBackend) SaveDelta(context.Context, string, int64, io.Reader) (int64, error) {
+	return -1, errFailingBackend
+}
+
+func newReplicatedTestBackends(t *testing.T, n int) ([]Backend, func()) {
+	var dirs []string
+	var bes []Backend
+	for i := 0; i < n; i++ {
+		dir, err := ioutil.TempDir("", "etcd-operator-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the file backend spools the backups to its tmp directory.
+		if err = os.Mkdir(filepath.Join(dir, util.BackupTmpDir), 0700); err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, dir)
+		bes = append(bes, &fileBackend{dir})
+	}
+	return bes, func() {
+		for _, dir := range dirs {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+func TestReplicatedBackendSaveSync(t *testing.T) {
+	bes, cleanup := newReplicatedTestBackends(t, 2)
+	defer cleanup()
+	rb, err := NewReplicatedBackend(ReplicationSync, append(bes, failingBackend{})...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := rb.Save(context.Background(), "3.1.0", 1, strings.NewReader("snapshot"))
+	if !IsPartialReplication(err) {
+		t.Fatalf("expect partial replication error, got %v", err)
+	}
+	if re := err.(*ReplicationError); len(re.Errs) != 1 || re.Errs[2] != errFailingBackend {
+		t.Errorf("expect only backend [2] to fail, got %v", err)
+	}
+	if n != int64(len("snapshot")) {
+		t.Errorf("size = %d, want %d", n, len("snapshot"))
+	}
+	for i, be := range bes {
+		if total, err := be.Total(); err != nil || total != 1 {
+			t.Errorf("backend [%d]: expect 1 backup, got %d (%v)", i, total, err)
+		}
+	}
+}
+
+func TestReplicatedBackendSaveMajorityFailed(t *testing.T) {
+	bes, cleanup := newReplicatedTestBackends(t, 1)
+	defer cleanup()
+	rb, err := NewReplicatedBackend(ReplicationSync, failingBackend{}, bes[0], failingBackend{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rb.Save(context.Background(), "3.1.0", 1, strings.NewReader("snapshot"))
+	if _, ok := err.(*ReplicationError); !ok || IsPartialReplication(err) {
+		t.Errorf("expect replication error without quorum, got %v", err)
+	}
+}
+
+func TestReplicatedBackendSaveAsync(t *testing.T) {
+	bes, cleanup := newReplicatedTestBackends(t, 2)
+	defer cleanup()
+	rb, err := NewReplicatedBackend(ReplicationAsync, append(bes, failingBackend{})...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = rb.Save(context.Background(), "3.1.0", 1, strings.NewReader("snapshot")); err != nil {
+		t.Fatal(err)
+	}
+	err = rb.Wait()
+	if re, ok := err.(*ReplicationError); !ok || len(re.Errs) != 1 || re.Errs[2] == nil {
+		t.Errorf("expect backend [2] to fail in the background, got %v", err)
+	}
+	if err = rb.Wait(); err != nil {
+		t.Errorf("expect the errors to be reset by Wait, got %v", err)
+	}
+	if total, err := bes[1].Total(); err != nil || total != 1 {
+		t.Errorf("expect backup replicated to backend [1], got %d (%v)", total, err)
+	}
+}
+
+func TestReplicatedBackendGetLatestQuorum(t *testing.T) {
+	bes, cleanup := newReplicatedTestBackends(t, 3)
+	defer cleanup()
+	for i, be := range bes {
+		if _, err := be.Save(context.Background(), "3.1.0", 1, strings.NewReader("1")); err != nil {
+			t.Fatal(err)
+		}
+		// revision 2 is only on a minority, e.g. its replication is in progress.
+		if i == 0 {
+			if _, err := be.Save(context.Background(), "3.1.0", 2, strings.NewReader("2")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	rb, err := NewReplicatedBackend(ReplicationSync, bes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := rb.GetLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := util.MakeBackupName("3.1.0", 1); name != want {
+		t.Errorf("latest = %s, want %s", name, want)
+	}
+
+	rb, err = NewReplicatedBackend(ReplicationSync, bes[0], failingBackend{}, failingBackend{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rb.GetLatest(); err == nil {
+		t.Error("expect error when a quorum of backends can't be listed")
+	}
+}
+
+func TestReplicatedBackendReadsFirstHealthy(t *testing.T) {
+	bes, cleanup := newReplicatedTestBackends(t, 1)
+	defer cleanup()
+	if _, err := bes[0].Save(context.Background(), "3.1.0", 1, strings.NewReader("snapshot")); err != nil {
+		t.Fatal(err)
+	}
+	rb, err := NewReplicatedBackend(ReplicationSync, failingBackend{}, bes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := rb.Open(util.MakeBackupName("3.1.0", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "snapshot" {
+		t.Errorf("content = %s, want snapshot", b)
+	}
+	if backups, err := rb.List(); err != nil || len(backups) != 1 {
+		t.Errorf("expect 1 backup listed, got %v (%v)", backups, err)
+	}
+}
+
+// TestReplicatedBackendPing ensures only the backends a save waits for are required to be reachable.
+func TestReplicatedBackendPing(t *testing.T) {
+	bes, cleanup := newReplicatedTestBackends(t, 3)
+	defer cleanup()
+	// the file backend can't save without its tmp directory.
+	if err := os.RemoveAll(filepath.Join(bes[2].(*fileBackend).dir, util.BackupTmpDir)); err != nil {
+		t.Fatal(err)
+	}
+
+	rb, err := NewReplicatedBackend(ReplicationSync, bes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rb.Ping(context.Background()); !IsPartialReplication(err) {
+		t.Errorf("sync: expect a partial replication error, got %v", err)
+	}
+
+	rb, err = NewReplicatedBackend(ReplicationAsync, bes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rb.Ping(context.Background()); err != nil {
+		t.Errorf("async: expect the unreachable secondary backend to be ignored, got %v", err)
+	}
+	rb, err = NewReplicatedBackend(ReplicationAsync, bes[2], bes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rb.Ping(context.Background()); err == nil || IsPartialReplication(err) {
+		t.Errorf("async: expect the unreachable first backend to fail, got %v", err)
+	}
+}
+
+func TestNewReplicatedBackend(t *testing.T) {
+	be := &fileBackend{os.TempDir()}
+	if _, err := NewReplicatedBackend(ReplicationSync, be); err == nil {
+		t.Error("expect error with a single backend")
+	}
+	if _, err := NewReplicatedBackend("bad", be, be); err == nil {
+		t.Error("expect error with an unknown mode")
+	}
+	if _, err := NewReplicatedBackend(ReplicationAsync, be, be); err != nil {
+		t.Error(err)
+	}
+}
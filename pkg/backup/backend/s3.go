@@ -15,10 +15,11 @@
 package backend
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
+	"strings"
+	"time"
 
 	"github.com/coreos/etcd-operator/pkg/backup/s3"
 	"github.com/coreos/etcd-operator/pkg/backup/util"
@@ -26,14 +27,13 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-const (
-	tmpDir              = "/tmp"
-	tmpBackupFilePrefix = "etcd-backup-"
+// ensure s3Backend satisfies backend interfaces.
+var (
+	_ Backend   = &s3Backend{}
+	_ URLSigner = &s3Backend{}
+	_ Pinger    = &s3Backend{}
 )
 
-// ensure s3Backend satisfies backend interface.
-var _ Backend = &s3Backend{}
-
 // s3Backend is AWS S3 backend.
 type s3Backend struct {
 	s3 *s3.S3
@@ -43,28 +43,26 @@ func NewS3Backend(s3 *s3.S3) Backend {
 	return &s3Backend{s3}
 }
 
-func (sb *s3Backend) Save(version string, snapRev int64, rc io.Reader) (int64, error) {
-	// make a local file copy of the backup first, since s3 requires io.ReadSeeker.
-	tmpfile, err := ioutil.TempFile(tmpDir, tmpBackupFilePrefix)
-	if err != nil {
-		return -1, fmt.Errorf("failed to create snapshot tempfile: %v", err)
-	}
-	defer func() {
-		tmpfile.Close()
-		os.Remove(tmpfile.Name())
-	}()
+func (sb *s3Backend) Save(ctx context.Context, version string, snapRev int64, rc io.Reader) (int64, error) {
+	return sb.save(ctx, util.MakeBackupName(version, snapRev), rc)
+}
 
-	n, err := io.Copy(tmpfile, rc)
-	if err != nil {
-		return -1, fmt.Errorf("failed to save snapshot to tmpfile: %v", err)
-	}
-	_, err = tmpfile.Seek(0, os.SEEK_SET)
-	if err != nil {
-		return -1, err
-	}
-	// S3 put is atomic, so let's go ahead and put the key directly.
-	key := util.MakeBackupName(version, snapRev)
-	err = sb.s3.Put(key, tmpfile)
+func (sb *s3Backend) SaveDelta(ctx context.Context, version string, rev int64, rc io.Reader) (int64, error) {
+	return sb.save(ctx, util.MakeDeltaName(version, rev), rc)
+}
+
+func (sb *s3Backend) SaveChecksum(ctx context.Context, version string, rev int64, sum string) error {
+	_, err := sb.save(ctx, util.MakeChecksumName(util.MakeBackupName(version, rev)), strings.NewReader(sum))
+	return err
+}
+
+func (sb *s3Backend) SaveAs(ctx context.Context, name string, rc io.Reader) (int64, error) {
+	return sb.save(ctx, name, rc)
+}
+
+func (sb *s3Backend) save(ctx context.Context, key string, rc io.Reader) (int64, error) {
+	// S3 put and multipart upload are atomic, so let's go ahead and upload the key directly.
+	n, err := sb.s3.Upload(ctx, key, util.NewContextReader(ctx, rc))
 	if err != nil {
 		return -1, err
 	}
@@ -72,6 +70,10 @@ func (sb *s3Backend) Save(version string, snapRev int64, rc io.Reader) (int64, e
 	return n, nil
 }
 
+func (sb *s3Backend) Ping(ctx context.Context) error {
+	return sb.s3.Ping(ctx)
+}
+
 func (sb *s3Backend) GetLatest() (string, error) {
 	keys, err := sb.s3.List()
 	if err != nil {
@@ -81,11 +83,41 @@ func (sb *s3Backend) GetLatest() (string, error) {
 	return util.GetLatestBackupName(keys), nil
 }
 
+func (sb *s3Backend) List() ([]BackupMeta, error) {
+	infos, err := sb.s3.ListObjectInfos()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list s3 bucket: %v", err)
+	}
+
+	keys := make([]string, 0, len(infos))
+	for k := range infos {
+		keys = append(keys, k)
+	}
+	var metas []BackupMeta
+	for _, k := range util.FilterAndSortBackups(keys) {
+		metas = append(metas, newBackupMeta(k, sb.s3.Path(k), infos[k].Size, infos[k].LastModified))
+	}
+	return metas, nil
+}
+
+func (sb *s3Backend) ListDeltas(baseRev int64) ([]string, error) {
+	keys, err := sb.s3.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list s3 bucket: %v", err)
+	}
+	return util.FilterAndSortDeltas(keys, baseRev), nil
+}
+
 func (sb *s3Backend) Open(name string) (io.ReadCloser, error) {
 	return sb.s3.Get(name)
 }
 
-func (sb *s3Backend) Purge(maxBackupFiles int) error {
+// SignedURL returns a pre-signed URL to download the backup of the given name, which expires after ttl.
+func (sb *s3Backend) SignedURL(name string, ttl time.Duration) (string, error) {
+	return sb.s3.SignedURL(name, ttl)
+}
+
+func (sb *s3Backend) KeepLatestN(ctx context.Context, maxBackupFiles int) error {
 	names, err := sb.s3.List()
 	if err != nil {
 		return err
@@ -94,13 +126,48 @@ func (sb *s3Backend) Purge(maxBackupFiles int) error {
 	if len(bnames) < maxBackupFiles {
 		return nil
 	}
-	for i := 0; i < len(bnames)-maxBackupFiles; i++ {
-		err := sb.s3.Delete(bnames[i])
-		if err != nil {
-			logrus.Errorf("fail to delete s3 file (%s): %v", bnames[i], err)
+	removed := bnames[:len(bnames)-maxBackupFiles]
+	if err := purge(ctx, removed, sb.delete); err != nil {
+		return err
+	}
+	// the deltas taken on top of the removed backups can't be replayed anymore.
+	return purge(ctx, util.ObsoleteDeltas(names, removed), sb.delete)
+}
+
+func (sb *s3Backend) PruneOlderThan(ctx context.Context, d time.Duration) error {
+	modTimes, err := sb.s3.ListModTimes()
+	if err != nil {
+		return err
+	}
+	old := util.BackupsOlderThan(modTimes, time.Now().Add(-d))
+	if err := purge(ctx, old, sb.delete); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(modTimes))
+	for n := range modTimes {
+		names = append(names, n)
+	}
+	return purge(ctx, util.ObsoleteDeltas(names, old), sb.delete)
+}
+
+// Delete deletes the file of the given name. S3 delete succeeds even if the file does not exist.
+func (sb *s3Backend) Delete(name string) error {
+	return sb.s3.Delete(name)
+}
+
+// delete deletes the backup file with its checksum and cluster metadata files.
+func (sb *s3Backend) delete(name string) {
+	err := sb.s3.Delete(name)
+	if err != nil {
+		logrus.Errorf("fail to delete s3 file (%s): %v", name, err)
+		return
+	}
+	// S3 delete succeeds even if the file does not exist.
+	for _, sname := range []string{util.MakeChecksumName(name), util.MakeClusterMetadataName(name)} {
+		if err = sb.s3.Delete(sname); err != nil {
+			logrus.Errorf("fail to delete s3 file (%s): %v", sname, err)
 		}
 	}
-	return nil
 }
 
 func (sb *s3Backend) Total() (int, error) {
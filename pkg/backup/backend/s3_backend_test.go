@@ -16,6 +16,7 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"math/rand"
 	"os"
 	"reflect"
@@ -77,13 +78,13 @@ func testS3BackendPurge(t *testing.T, s3cli *s3.S3) {
 	s := &s3Backend{
 		s3: s3cli,
 	}
-	if _, err := s.Save("3.1.0", 1, bytes.NewBuffer([]byte("ignore"))); err != nil {
+	if _, err := s.Save(context.Background(), "3.1.0", 1, bytes.NewBuffer([]byte("ignore"))); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := s.Save("3.1.0", 2, bytes.NewBuffer([]byte("ignore"))); err != nil {
+	if _, err := s.Save(context.Background(), "3.1.0", 2, bytes.NewBuffer([]byte("ignore"))); err != nil {
 		t.Fatal(err)
 	}
-	if err := s.Purge(1); err != nil {
+	if err := s.KeepLatestN(context.Background(), 1); err != nil {
 		t.Fatal(err)
 	}
 	names, err := s3cli.List()
@@ -103,7 +104,7 @@ func testS3BackendDelete(t *testing.T, s3cli *s3.S3) {
 	s := &s3Backend{
 		s3: s3cli,
 	}
-	if _, err := s.Save("3.1.0", 1, bytes.NewBuffer([]byte("ignore"))); err != nil {
+	if _, err := s.Save(context.Background(), "3.1.0", 1, bytes.NewBuffer([]byte("ignore"))); err != nil {
 		t.Fatal(err)
 	}
 	names, err := s3cli.List()
@@ -158,11 +159,11 @@ func TestS3BackendWithPrefix(t *testing.T) {
 		s3: s3Cli2,
 	}
 
-	if _, err := s.Save("file1", 1, bytes.NewBuffer([]byte("ignore"))); err != nil {
+	if _, err := s.Save(context.Background(), "file1", 1, bytes.NewBuffer([]byte("ignore"))); err != nil {
 		t.Fatal(err)
 	}
 
-	if _, err := s2.Save("file2", 1, bytes.NewBuffer([]byte("ignore"))); err != nil {
+	if _, err := s2.Save(context.Background(), "file2", 1, bytes.NewBuffer([]byte("ignore"))); err != nil {
 		t.Fatal(err)
 	}
 
@@ -185,11 +186,11 @@ func TestS3BackendWithPrefix(t *testing.T) {
 	}
 
 	// clean up
-	if err = s.Purge(1); err != nil {
+	if err = s.KeepLatestN(context.Background(), 1); err != nil {
 		t.Fatal(err)
 	}
 
-	if err = s2.Purge(1); err != nil {
+	if err = s2.KeepLatestN(context.Background(), 1); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -0,0 +1,102 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultMaxFailureBackoff caps the wait after failed backups if RetryPolicy.MaxBackoff is not set.
+	defaultMaxFailureBackoff = time.Hour
+	// defaultBackoffMultiplier grows the wait after each failed backup if RetryPolicy.BackoffMultiplier is not set.
+	defaultBackoffMultiplier = 2
+	// backoffJitter is the fraction of the wait added at random, so that the sidecars of clusters failing
+	// together on a shared storage don't retry in step.
+	backoffJitter = 0.2
+)
+
+// RetryPolicy backs off the scheduled backups after consecutive failures, so that a sustained failure of
+// etcd or the storage is not hit by a backup on every scheduled time. Once a backup fails, the next
+// scheduled backups are skipped for InitialBackoff, which grows by BackoffMultiplier after each failed
+// backup up to MaxBackoff, with a jitter of up to 20%. A backup that does not fail resets the wait.
+// Backups requested on demand are not delayed, and reset the wait if they succeed.
+type RetryPolicy struct {
+	// InitialBackoff is the wait after the first failed backup.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait. If equal to 0, defaultMaxFailureBackoff is used.
+	MaxBackoff time.Duration
+	// BackoffMultiplier grows the wait after each failed backup. If less than 1, defaultBackoffMultiplier is used.
+	BackoffMultiplier float64
+}
+
+// SetRetryPolicy makes the scheduled backups of bm back off after failures as rp configures.
+// See BackoffUntil.
+func (bm *BackupManager) SetRetryPolicy(rp RetryPolicy) {
+	bm.retryPolicy = &rp
+}
+
+// BackoffUntil returns the time before which the scheduled backups are skipped after failed backups,
+// or the zero time if the latest backup did not fail or no RetryPolicy is set.
+func (bm *BackupManager) BackoffUntil() time.Time {
+	return bm.backoffUntil
+}
+
+// updateBackoff grows the wait of the RetryPolicy of bm if the backup which ended at now failed with err,
+// or resets it otherwise, and records the wait in bm.metrics.
+func (bm *BackupManager) updateBackoff(err error, now time.Time) {
+	rp := bm.retryPolicy
+	if rp == nil {
+		return
+	}
+	if err == nil {
+		bm.backoff, bm.backoffUntil = 0, time.Time{}
+		bm.metrics.SetFailureBackoff(bm.clusterName, 0)
+		return
+	}
+
+	bm.backoff = nextBackoff(*rp, bm.backoff)
+	wait := bm.backoff + time.Duration(rand.Float64()*backoffJitter*float64(bm.backoff))
+	bm.backoffUntil = now.Add(wait)
+	bm.metrics.SetFailureBackoff(bm.clusterName, wait)
+	bm.getLogger().WithFields(logrus.Fields{"backoff": wait}).Warning("backing off the scheduled backups after failed backup")
+}
+
+// nextBackoff returns the wait of rp after a failed backup, given the wait after the previous one,
+// or 0 if the previous backup did not fail.
+func nextBackoff(rp RetryPolicy, prev time.Duration) time.Duration {
+	max := rp.MaxBackoff
+	if max <= 0 {
+		max = defaultMaxFailureBackoff
+	}
+	if prev <= 0 {
+		if rp.InitialBackoff > max {
+			return max
+		}
+		return rp.InitialBackoff
+	}
+	mult := rp.BackoffMultiplier
+	if mult < 1 {
+		mult = defaultBackoffMultiplier
+	}
+	next := float64(prev) * mult
+	if next > float64(max) {
+		return max
+	}
+	return time.Duration(next)
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+	rp := RetryPolicy{InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute}
+	var got []time.Duration
+	for b, i := time.Duration(0), 0; i < 5; i++ {
+		b = nextBackoff(rp, b)
+		got = append(got, b)
+	}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expect backoffs %v, get %v", want, got)
+		}
+	}
+
+	rp = RetryPolicy{InitialBackoff: time.Second, BackoffMultiplier: 3}
+	if b := nextBackoff(rp, 2*time.Second); b != 6*time.Second {
+		t.Errorf("expect backoff 6s, get %v", b)
+	}
+	if b := nextBackoff(rp, 50*time.Minute); b != defaultMaxFailureBackoff {
+		t.Errorf("expect backoff capped at %v, get %v", defaultMaxFailureBackoff, b)
+	}
+}
+
+func TestUpdateBackoff(t *testing.T) {
+	bm := &BackupManager{}
+	now := time.Now()
+	bm.updateBackoff(errors.New("storage down"), now)
+	if !bm.BackoffUntil().IsZero() {
+		t.Fatalf("expect no backoff without a retry policy, get %v", bm.BackoffUntil())
+	}
+
+	bm.SetRetryPolicy(RetryPolicy{InitialBackoff: 10 * time.Second})
+	for _, backoff := range []time.Duration{10 * time.Second, 20 * time.Second} {
+		bm.updateBackoff(errors.New("storage down"), now)
+		wait := bm.BackoffUntil().Sub(now)
+		if wait < backoff || wait > backoff+time.Duration(backoffJitter*float64(backoff)) {
+			t.Errorf("expect a wait of %v plus jitter, get %v", backoff, wait)
+		}
+	}
+
+	bm.updateBackoff(nil, now)
+	if !bm.BackoffUntil().IsZero() {
+		t.Errorf("expect the backoff reset after a backup that did not fail, get %v", bm.BackoffUntil())
+	}
+	bm.updateBackoff(errors.New("storage down"), now)
+	if wait := bm.BackoffUntil().Sub(now); wait > 12*time.Second {
+		t.Errorf("expect the wait to restart from the initial backoff, get %v", wait)
+	}
+}
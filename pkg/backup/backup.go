@@ -15,25 +15,44 @@
 package backup
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"sync"
+	"text/template"
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup/abs"
 	"github.com/coreos/etcd-operator/pkg/backup/backend"
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
+	"github.com/coreos/etcd-operator/pkg/backup/credentials"
+	"github.com/coreos/etcd-operator/pkg/backup/encryption"
 	"github.com/coreos/etcd-operator/pkg/backup/env"
+	"github.com/coreos/etcd-operator/pkg/backup/metrics"
 	"github.com/coreos/etcd-operator/pkg/backup/s3"
 	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/util/awsutil/s3factory"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/tlsutil"
 
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2/google"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -45,12 +64,29 @@ const (
 // BackupController controls when to do backup based on backup policy and incoming HTTP backup requests.
 type BackupController struct {
 	listenAddr    string
-	backupNow     chan chan backupNowAck
+	backupNow     chan backupNowRequest
 	policy        api.BackupPolicy
+	schedule      cron.Schedule
 	backupManager *BackupManager
 	backupServer  *BackupServer
+
+	// healthListenAddr is where the health checks are also served without TLS
+	// if the HTTP API requires client certificates.
+	healthListenAddr string
+
+	// drainTimeout is how long the backup in progress when Run is stopped is given to finish.
+	drainTimeout time.Duration
+	// stopped is closed once Run is stopped, so that no backup is requested anymore.
+	stopped chan struct{}
+
+	// mu guards the fields below, which are written by Run and read by the HTTP handlers.
+	mu sync.Mutex
 	// recentBackupStatus keeps the statuses of 'maxRecentBackupStatusCount' recent backups.
 	recentBackupsStatus []backupapi.BackupStatus
+	// lastBackupError is the error of the most recent backup attempt, if it failed.
+	lastBackupError string
+	// lastSkipReason is why the most recent backup attempt saved no backup, if it did not.
+	lastSkipReason string
 }
 
 // BackupControllerConfig contains configuration data to construct BackupController.
@@ -60,13 +96,181 @@ type BackupControllerConfig struct {
 	ListenAddr  string
 	ClusterName string
 	Namespace   string
+	// HealthListenAddr is where the health checks are also served without TLS
+	// if BackupPolicy.HTTPClientCertAuth is set, for the kubelet probes.
+	HealthListenAddr string
 
 	TLS          *api.TLSPolicy
 	BackupPolicy *api.BackupPolicy
+
+	// EventRecorder emits an event on the EtcdCluster after each backup if not nil.
+	EventRecorder record.EventRecorder
+
+	// DrainTimeout is how long the backup in progress when the controller is stopped is given to finish
+	// before it is cancelled. If equal to 0, it is cancelled right away.
+	DrainTimeout time.Duration
+
+	// NullBackend discards the backups instead of saving them in the storage of BackupPolicy,
+	// to benchmark the snapshot throughput independently of the storage.
+	NullBackend bool
 }
 
 // NewBackupController creates a BackupController.
 func NewBackupController(config *BackupControllerConfig) (*BackupController, error) {
+	bp := config.BackupPolicy
+	be, err := newBackend(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var tc *tls.Config
+	if config.TLS.IsSecureClient() {
+		d, err := k8sutil.GetTLSDataFromSecret(config.Kubecli, config.Namespace, config.TLS.Static.OperatorSecret)
+		if err != nil {
+			return nil, err
+		}
+		tc, err = etcdutil.NewTLSConfig(d.CertData, d.KeyData, d.CAData)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if bp.HTTPClientCertAuth && tc == nil {
+		return nil, errors.New("HTTPClientCertAuth requires static client TLS")
+	}
+
+	if err := compression.Validate(bp.Compression, bp.CompressionLevel); err != nil {
+		return nil, err
+	}
+	schedule, err := newBackupSchedule(bp)
+	if err != nil {
+		return nil, err
+	}
+	var nameTemplate *template.Template
+	if len(bp.BackupNameTemplate) != 0 {
+		if nameTemplate, err = util.ParseBackupNameTemplate(bp.BackupNameTemplate); err != nil {
+			return nil, fmt.Errorf("invalid backup name template (%s): %v", bp.BackupNameTemplate, err)
+		}
+	}
+	if e := bp.Encryption; e != nil && len(e.SecretName) != 0 {
+		kp, accepted, err := newSecretKeyProviders(config.Kubecli, config.Namespace, e)
+		if err != nil {
+			return nil, err
+		}
+		be = encryption.NewBackend(be, kp, accepted...)
+	} else if e != nil {
+		kp, err := newKeyProvider(e)
+		if err != nil {
+			return nil, err
+		}
+		be = encryption.NewBackend(be, kp)
+	}
+	// the metrics are served by StartHTTP from the default registry.
+	m, err := metrics.New(prometheus.DefaultRegisterer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register backup metrics: %v", err)
+	}
+	bm := &BackupManager{
+		kubecli:            config.Kubecli,
+		clusterName:        config.ClusterName,
+		namespace:          config.Namespace,
+		be:                 be,
+		etcdTLSConfig:      tc,
+		useServiceEndpoint: bp.UseServiceEndpoint,
+		serviceName:        bp.ServiceName,
+		discoverMembers:    bp.DiscoverMembers,
+		maxRevisionLag:     bp.MaxBackupRevisionLag,
+		retention: BackupRetentionPolicy{
+			MaxBackups:   bp.MaxBackups,
+			MaxBackupAge: time.Duration(bp.MaxBackupAgeInDays) * 24 * time.Hour,
+		},
+		skip: BackupSkipPolicy{
+			MinInterval:      time.Duration(bp.MinBackupIntervalInSecond) * time.Second,
+			MinRevisionDelta: bp.MinRevisionDelta,
+		},
+		uploadRetry: UploadRetryConfig{
+			Attempts: bp.MaxUploadAttempts,
+			Backoff:  time.Duration(bp.UploadBackoffInSecond) * time.Second,
+		},
+		compression:      bp.Compression,
+		compressionLevel: bp.CompressionLevel,
+		nameTemplate:     nameTemplate,
+		metrics:          m,
+		logger:           newLogger(config.ClusterName, config.Namespace),
+	}
+	if bp.MaxDeltas > 0 {
+		bm.incremental = &IncrementalBackupConfig{MaxDeltas: bp.MaxDeltas}
+	}
+	if bp.MinSnapshotThroughputInKBPerSecond > 0 {
+		bm.snapshotTimeoutPolicy = &SnapshotTimeoutPolicy{
+			MinThroughput: int64(bp.MinSnapshotThroughputInKBPerSecond) * 1024,
+			MinTimeout:    time.Duration(bp.MinSnapshotTimeoutInSecond) * time.Second,
+			MaxTimeout:    time.Duration(bp.MaxSnapshotTimeoutInSecond) * time.Second,
+		}
+	}
+	if bp.RecordMetadata {
+		bm.metadataStore = NewConfigMapMetadataStore(config.Kubecli, config.ClusterName, config.Namespace, bp.MaxBackups)
+	}
+	bm.checkSnapshotStream = true
+	if config.EventRecorder != nil {
+		bm.RecordEvents(config.EventRecorder)
+	}
+	if tc != nil {
+		bm.WatchTLS(tlsutil.NewSecretWatcher(config.Kubecli, config.Namespace, config.TLS.Static.OperatorSecret, tc))
+	}
+	bm.verifySnapshot = bp.VerifySnapshot
+	if bp.FailureBackoffInSecond > 0 {
+		bm.SetRetryPolicy(RetryPolicy{
+			InitialBackoff: time.Duration(bp.FailureBackoffInSecond) * time.Second,
+			MaxBackoff:     time.Duration(bp.MaxFailureBackoffInSecond) * time.Second,
+		})
+	}
+	bm.RetryOnStorageError(bp.MaxUploadAttempts, time.Duration(bp.UploadBackoffInSecond)*time.Second)
+	if bp.AutoCompact {
+		bm.compaction = &CompactionConfig{Timeout: time.Duration(bp.CompactionTimeoutInSecond) * time.Second}
+	}
+	if bp.DefragBeforeBackup {
+		bm.defrag = &DefragConfig{Timeout: time.Duration(bp.DefragTimeoutInSecond) * time.Second}
+	}
+	bm.failOnNoSpace = bp.FailOnNoSpaceAlarm
+	if bp.ClientPort != 0 || len(bp.ClientScheme) != 0 {
+		port := bp.ClientPort
+		if port == 0 {
+			port = etcdutil.DefaultClientPort
+		}
+		if err := bm.SetClientEndpoint(bp.ClientScheme, port); err != nil {
+			return nil, err
+		}
+	}
+	if len(bp.AuthSecret) != 0 {
+		creds, err := getEtcdCredentials(config.Kubecli, config.Namespace, bp.AuthSecret)
+		if err != nil {
+			return nil, err
+		}
+		bm.SetEtcdCredentials(creds)
+	}
+	bs := &BackupServer{
+		backend: be,
+	}
+
+	return &BackupController{
+		listenAddr:       config.ListenAddr,
+		healthListenAddr: config.HealthListenAddr,
+		backupNow:        make(chan backupNowRequest),
+		drainTimeout:     config.DrainTimeout,
+		stopped:          make(chan struct{}),
+		policy:           *bp,
+		schedule:         schedule,
+		backupManager:    bm,
+		backupServer:     bs,
+	}, nil
+}
+
+// newBackend returns the backend to save the backups in, given by the storage type of the backup policy.
+func newBackend(config *BackupControllerConfig) (backend.Backend, error) {
+	if config.NullBackend {
+		return backend.NewNullBackend(), nil
+	}
+
 	var be backend.Backend
 	bp := config.BackupPolicy
 
@@ -80,14 +284,76 @@ func NewBackupController(config *BackupControllerConfig) (*BackupController, err
 		be = backend.NewFileBackend(bdir)
 	case api.BackupStorageTypeS3:
 		s3Prefix := ""
+		so := session.Options{SharedConfigState: session.SharedConfigEnable}
 		if bp.S3 != nil {
 			s3Prefix = bp.S3.Prefix
+			ec := s3factory.NewEndpointConfig(bp.S3)
+			ca, err := ioutil.ReadFile(path.Join(k8sutil.AWSCredentialDir, api.AWSSecretCABundleFileName))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to read S3 CA bundle: %v", err)
+			}
+			ec.CABundle = ca
+			ec.Apply(&so)
 		}
-		s3cli, err := s3.New(os.Getenv(env.AWSS3Bucket), backupapi.ToS3Prefix(s3Prefix, config.Namespace, config.ClusterName))
-		if err != nil {
-			return nil, err
+		bucket, prefix := os.Getenv(env.AWSS3Bucket), backupapi.ToS3Prefix(s3Prefix, config.Namespace, config.ClusterName)
+		var s3cli *s3.S3
+		if bp.S3 != nil && bp.S3.UseDefaultCredentialChain {
+			sess, err := s3factory.NewSessionFromDefaultChain(so)
+			if err != nil {
+				return nil, err
+			}
+			s3cli = s3.NewFromSession(bucket, prefix, sess)
+		} else if bp.S3 != nil && bp.S3.Vault != nil {
+			p, err := credentials.NewVaultCredentialProvider(config.Kubecli, config.Namespace, credentials.EngineAWS, bp.S3.Vault)
+			if err != nil {
+				return nil, err
+			}
+			sess, err := s3factory.NewSessionFromProvider(so, p)
+			if err != nil {
+				return nil, err
+			}
+			s3cli = s3.NewFromSession(bucket, prefix, sess)
+		} else {
+			var err error
+			s3cli, err = s3.NewFromSessionOpt(bucket, prefix, so)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if bp.S3 != nil {
+			sse, err := s3.NewSSE(bp.S3.SSE, bp.S3.SSEKMSKeyID)
+			if err != nil {
+				return nil, err
+			}
+			s3cli.SetSSE(sse)
+			if err = s3.ValidateStorageClass(bp.S3.StorageClass); err != nil {
+				return nil, err
+			}
+			s3cli.SetStorageClass(bp.S3.StorageClass)
+			if bp.S3.PartSizeInMB != 0 && bp.S3.PartSizeInMB < s3.MinPartSizeInMB {
+				return nil, fmt.Errorf("S3 part size (%dMB) must be at least %dMB", bp.S3.PartSizeInMB, s3.MinPartSizeInMB)
+			}
+			if bp.S3.UploadConcurrency < 0 {
+				return nil, fmt.Errorf("S3 upload concurrency (%d) must not be negative", bp.S3.UploadConcurrency)
+			}
+			s3cli.SetUploadOptions(bp.S3.PartSizeInMB, bp.S3.UploadConcurrency)
 		}
 		be = backend.NewS3Backend(s3cli)
+		if bp.S3 != nil && len(bp.S3.SecondaryS3Buckets) != 0 {
+			bes := []backend.Backend{be}
+			for _, bk := range bp.S3.SecondaryS3Buckets {
+				bes = append(bes, backend.NewS3Backend(s3cli.WithBucket(bk)))
+			}
+			mode := backend.ReplicationMode(bp.S3.ReplicationMode)
+			if len(mode) == 0 {
+				mode = backend.ReplicationSync
+			}
+			rb, err := backend.NewReplicatedBackend(mode, bes...)
+			if err != nil {
+				return nil, err
+			}
+			be = rb
+		}
 	case api.BackupStorageTypeABS:
 		absCli, err := abs.New(os.Getenv(env.ABSContainer),
 			os.Getenv(env.ABSStorageAccount),
@@ -100,88 +366,227 @@ func NewBackupController(config *BackupControllerConfig) (*BackupController, err
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %v", bp.StorageType)
 	}
+	return be, nil
+}
 
-	var tc *tls.Config
-	if config.TLS.IsSecureClient() {
-		d, err := k8sutil.GetTLSDataFromSecret(config.Kubecli, config.Namespace, config.TLS.Static.OperatorSecret)
+// drainContext returns a context which is cancelled timeout after ctx is done, or by the returned cancel.
+func drainContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	dctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-dctx.Done():
+			return
+		}
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			cancel()
+		case <-dctx.Done():
+		}
+	}()
+	return dctx, cancel
+}
+
+// newBackupSchedule returns the schedule of the backups taken with the given policy,
+// every BackupIntervalInSecond unless a BackupSchedule is given.
+func newBackupSchedule(bp *api.BackupPolicy) (cron.Schedule, error) {
+	if len(bp.BackupSchedule) != 0 {
+		s, err := cron.ParseStandard(bp.BackupSchedule)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("invalid backup schedule (%s): %v", bp.BackupSchedule, err)
 		}
-		tc, err = etcdutil.NewTLSConfig(d.CertData, d.KeyData, d.CAData)
+		return s, nil
+	}
+	interval := constants.DefaultSnapshotInterval
+	if bp.BackupIntervalInSecond != 0 {
+		interval = time.Duration(bp.BackupIntervalInSecond) * time.Second
+	}
+	return cron.Every(interval), nil
+}
+
+// newKeyProvider returns the KeyProvider of the KMS key the backups are encrypted with.
+func newKeyProvider(e *api.BackupEncryption) (encryption.KeyProvider, error) {
+	if len(e.AWSKMSKeyID) != 0 {
+		sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to create AWS session for KMS: %v", err)
 		}
+		return encryption.NewAWSKMSKeyProvider(kms.New(sess), e.AWSKMSKeyID), nil
+	}
+	hc, err := google.DefaultClient(context.Background(), cloudkms.CloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloud KMS client: %v", err)
+	}
+	svc, err := cloudkms.New(hc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloud KMS client: %v", err)
 	}
+	return encryption.NewGCPKMSKeyProvider(svc, e.GCPKMSKeyName), nil
+}
 
-	bm := &BackupManager{
-		kubecli:       config.Kubecli,
-		clusterName:   config.ClusterName,
-		namespace:     config.Namespace,
-		be:            be,
-		etcdTLSConfig: tc,
+// newSecretKeyProviders returns the KeyProviders of the key the backups are encrypted with and of the accepted keys,
+// which are read from the Secret of the backup encryption.
+func newSecretKeyProviders(kubecli kubernetes.Interface, ns string, e *api.BackupEncryption) (encryption.KeyProvider, []encryption.KeyProvider, error) {
+	secret, err := kubecli.CoreV1().Secrets(ns).Get(e.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get encryption key secret (%s): %v", e.SecretName, err)
 	}
-	bs := &BackupServer{
-		backend: be,
+	newProvider := func(k string) (encryption.KeyProvider, error) {
+		key, ok := secret.Data[k]
+		if !ok {
+			return nil, fmt.Errorf("encryption key secret (%s) has no key (%s)", e.SecretName, k)
+		}
+		kp, err := encryption.NewSecretKeyProvider(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key (%s) in secret (%s): %v", k, e.SecretName, err)
+		}
+		return kp, nil
 	}
 
-	return &BackupController{
-		listenAddr:    config.ListenAddr,
-		backupNow:     make(chan chan backupNowAck),
-		policy:        *bp,
-		backupManager: bm,
-		backupServer:  bs,
-	}, nil
+	kp, err := newProvider(e.SecretKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var accepted []encryption.KeyProvider
+	for _, k := range e.AcceptedSecretKeys {
+		p, err := newProvider(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		accepted = append(accepted, p)
+	}
+	return kp, accepted, nil
+}
+
+// Backend returns the backend the backups are saved to.
+func (bc *BackupController) Backend() backend.Backend {
+	return bc.backupManager.be
+}
+
+// EtcdTLSConfig returns the TLS config used to talk to the etcd cluster,
+// or nil if the cluster does not use TLS. It follows the rotation of the operator secret.
+func (bc *BackupController) EtcdTLSConfig() *tls.Config {
+	return bc.backupManager.tlsConfig()
+}
+
+// WatchTLS reloads the etcd TLS config whenever the operator secret is rotated, until ctx is done.
+// It returns right away if the cluster does not use TLS.
+func (bc *BackupController) WatchTLS(ctx context.Context) {
+	if w := bc.backupManager.tlsWatcher; w != nil {
+		w.Run(ctx.Done())
+	}
+}
+
+// recordBackup records the result of a backup attempt for the HTTP handlers and returns the ack
+// of a backup request. If no new backup is saved, the status of the most recent backup, if any, is acked.
+func (bc *BackupController) recordBackup(bs *backupapi.BackupStatus, err error) backupNowAck {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.lastSkipReason = ""
+	if err != nil {
+		bc.lastBackupError = err.Error()
+		return backupNowAck{err: err}
+	}
+	bc.lastBackupError = ""
+	if bs == nil {
+		bc.lastSkipReason = bc.backupManager.lastSkipReason
+	}
+	if bs != nil {
+		bc.recentBackupsStatus = append(bc.recentBackupsStatus, *bs)
+		if len(bc.recentBackupsStatus) > maxRecentBackupStatusCount {
+			bc.recentBackupsStatus = bc.recentBackupsStatus[1:]
+		}
+	}
+	if len(bc.recentBackupsStatus) == 0 {
+		return backupNowAck{}
+	}
+	return backupNowAck{status: bc.recentBackupsStatus[len(bc.recentBackupsStatus)-1]}
+}
+
+// BackupManager returns the BackupManager which saves the backups of bc.
+func (bc *BackupController) BackupManager() *BackupManager {
+	return bc.backupManager
+}
+
+// SaveSnapNow saves a snapshot of the cluster if it has changed since the latest backup, or regardless
+// if opts.Force is set, like a backup request served by StartHTTP, and applies the retention policy.
+// It returns a nil status if the cluster has not changed and the backup is not forced.
+func (bc *BackupController) SaveSnapNow(ctx context.Context, opts SaveSnapOptions) (*backupapi.BackupStatus, error) {
+	return bc.backupManager.SaveSnapWithOptions(ctx, LatestBackupRevUnknown, opts)
+}
+
+// Validate checks that the backups can be saved with the backup policy; see BackupManager.Validate.
+// A failure is reported as the last backup error until a backup succeeds.
+func (bc *BackupController) Validate(ctx context.Context) error {
+	err := bc.backupManager.Validate(ctx)
+	if err != nil {
+		bc.mu.Lock()
+		bc.lastBackupError = err.Error()
+		bc.mu.Unlock()
+	}
+	return err
 }
 
 // Run starts BackupController controller where it
 // controlls backups based on backup policy and HTTP backup requests.
-func (bc *BackupController) Run() {
-	lastSnapRev := bc.backupManager.getLatestBackupRev()
-	interval := constants.DefaultSnapshotInterval
-	if bc.policy.BackupIntervalInSecond != 0 {
-		interval = time.Duration(bc.policy.BackupIntervalInSecond) * time.Second
-	}
+// Once ctx is done, no backup is started anymore, and Run returns once the backup being saved then
+// is saved, or cancelled after the drain timeout, which aborts its upload.
+func (bc *BackupController) Run(ctx context.Context) {
+	// the latest backup is looked up by the first backup, so that a storage outage at startup
+	// fails that backup instead of the sidecar.
+	lastSnapRev := LatestBackupRevUnknown
+	bctx, cancel := drainContext(ctx, bc.drainTimeout)
+	defer cancel()
+	defer close(bc.stopped)
 
-	go func() {
-		if bc.policy.MaxBackups == 0 {
+	for {
+		var req backupNowRequest
+		// the schedule is in UTC.
+		now := time.Now().UTC()
+		next := bc.schedule.Next(now)
+		if until := bc.backupManager.BackoffUntil(); next.Before(until) {
+			// the scheduled backups are skipped until the backoff after failed backups ends.
+			next = bc.schedule.Next(until)
+		}
+		select {
+		case <-time.After(next.Sub(now)):
+		case req = <-bc.backupNow:
+			logrus.WithField("force", req.force).Info("received a backup request")
+		case <-ctx.Done():
 			return
 		}
-		for {
-			<-time.After(10 * time.Second)
-			err := bc.backupManager.be.Purge(bc.policy.MaxBackups)
-			if err != nil {
-				logrus.Errorf("fail to purge backups: %v", err)
+		if ctx.Err() != nil {
+			// ctx was done along with the schedule or the request.
+			if req.ackchan != nil {
+				req.ackchan <- backupNowAck{err: errStopped}
 			}
+			return
 		}
-	}()
 
-	for {
-		var ackchan chan backupNowAck
-		select {
-		case <-time.After(interval):
-		case ackchan = <-bc.backupNow:
-			logrus.Info("received a backup request")
+		bs, err := bc.backupManager.SaveSnapWithOptions(bctx, lastSnapRev, SaveSnapOptions{Force: req.force})
+		if err == ErrBackupInProgress {
+			// the backup in progress, e.g. saved by SaveSnapNow, is reported by its caller.
+			if req.ackchan != nil {
+				req.ackchan <- backupNowAck{err: err}
+			}
+			continue
 		}
-
-		bs, err := bc.backupManager.SaveSnap(lastSnapRev)
 		if err != nil {
 			logrus.Errorf("failed to save snapshot: %v", err)
+			if bctx.Err() != nil {
+				logrus.Warningf("cancelled the backup in progress: not saved within the drain timeout (%v)", bc.drainTimeout)
+			}
 		}
-
 		if bs != nil {
 			lastSnapRev = bs.Revision
-			bc.recentBackupsStatus = append(bc.recentBackupsStatus, *bs)
-			if len(bc.recentBackupsStatus) > maxRecentBackupStatusCount {
-				bc.recentBackupsStatus = bc.recentBackupsStatus[1:]
-			}
 		}
+		ack := bc.recordBackup(bs, err)
 
-		if ackchan != nil {
-			ack := backupNowAck{err: err}
-			if err == nil {
-				ack.status = bc.recentBackupsStatus[len(bc.recentBackupsStatus)-1]
-			}
-			ackchan <- ack
+		if req.ackchan != nil {
+			req.ackchan <- ack
 		}
 	}
 }
@@ -15,27 +15,69 @@
 package backup
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup/backend"
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
+	"github.com/coreos/etcd-operator/pkg/backup/metrics"
 	"github.com/coreos/etcd-operator/pkg/backup/util"
 	"github.com/coreos/etcd-operator/pkg/backup/writer"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+	"github.com/coreos/etcd-operator/pkg/util/tlsutil"
 
 	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
+// defaultRevisionCheckConcurrency is the default maximum number of members
+// whose revision is checked at the same time.
+const defaultRevisionCheckConcurrency = 3
+
+// revisionProbeTimeout is how long the members are given to answer their revision, including the dial.
+var revisionProbeTimeout = constants.DefaultDialTimeout + constants.DefaultRequestTimeout
+
+// BackupRetentionPolicy defines which backups are kept after each successful backup.
+type BackupRetentionPolicy struct {
+	// MaxBackups is the maximum number of backups to keep.
+	// If equal to 0, it means unlimited backups.
+	MaxBackups int
+
+	// MaxBackupAge is the maximum age of backups to keep.
+	// If equal to 0, backups are kept regardless of their age.
+	// The latest backup is always kept.
+	MaxBackupAge time.Duration
+}
+
+// ErrSnapshotUnchanged is returned by SaveSnapWithPrefix when the cluster has not changed
+// since the latest backup, so no new backup is saved.
+var ErrSnapshotUnchanged = errors.New("cluster revision has not changed since the latest backup")
+
+// LatestBackupRevUnknown is given to SaveSnap as the revision of the latest backup to have SaveSnap look it up.
+const LatestBackupRevUnknown int64 = -1
+
 // BackupManager backups an etcd cluster.
 type BackupManager struct {
 	kubecli kubernetes.Interface
@@ -43,216 +85,1493 @@ type BackupManager struct {
 	clusterName   string
 	namespace     string
 	etcdTLSConfig *tls.Config
+	// tlsWatcher, if not nil, gives the rotated etcd TLS config instead of etcdTLSConfig.
+	tlsWatcher *tlsutil.SecretWatcher
+	// credentials are the etcd username and password the etcd clients authenticate with if not nil.
+	credentials *EtcdCredentials
+
+	// useServiceEndpoint tells whether the cluster is reached through its client service
+	// instead of the addresses of its pods, e.g. where the client port of the pods is firewalled.
+	useServiceEndpoint bool
+	// discoverMembers tells whether the members are discovered with the etcd member list through the client
+	// service, instead of the pod list, to take the backup from the member with max revision. It requires useServiceEndpoint.
+	discoverMembers bool
+	// serviceName is the client service of the cluster. If empty, k8sutil.ClientServiceName is used.
+	serviceName string
+	// clientScheme and clientPort are where the members are reached if not empty or 0. See SetClientEndpoint.
+	clientScheme string
+	clientPort   int
 
 	be backend.Backend
 	bw writer.Writer
+
+	// incremental enables saving deltas between full snapshots if not nil.
+	incremental *IncrementalBackupConfig
+
+	retention BackupRetentionPolicy
+
+	// skip configures skipping the backups of a cluster which changed too little since the latest backup.
+	skip BackupSkipPolicy
+	// lastBackupTime is when the latest backup was saved by SaveSnap, or the zero time if none was.
+	lastBackupTime time.Time
+	// lastSkipReason is why the latest SaveSnap saved no backup, or empty if it saved one or failed.
+	lastSkipReason string
+
+	// hooks are the Jobs run around each backup. See RunHooks.
+	hooks BackupHooks
+
+	// defrag enables defragmenting the member each full snapshot saved by SaveSnap is taken from if not nil.
+	defrag *DefragConfig
+	// memberDefrag enables defragmenting every member of the cluster after a number of backups if not nil.
+	// See DefragmentMembersAfter.
+	memberDefrag *MemberDefragConfig
+
+	// failOnNoSpace fails the backups taken while a NOSPACE alarm is raised, once saved. See checkAlarms.
+	failOnNoSpace bool
+
+	// compaction enables compacting the cluster after each backup saved by SaveSnap if not nil.
+	compaction *CompactionConfig
+
+	// metadataStore records the status of each backup saved by SaveSnap if not nil.
+	metadataStore MetadataStore
+	// checkSnapshotStream enables checking each snapshot with util.SnapshotVerifier as it is received,
+	// before the backup is reported saved. It is set by the constructors.
+	checkSnapshotStream bool
+	// verifySnapshot enables checking each snapshot saved by SaveSnap with util.VerifySnap.
+	verifySnapshot bool
+
+	// uploadRetry configures retrying the uploads which fail with a transient error.
+	uploadRetry UploadRetryConfig
+	// storageRetry configures retrying to read the latest backup from the storage if not nil.
+	storageRetry *UploadRetryConfig
+	// retryPolicy backs off the scheduled backups after failed backups if not nil. See SetRetryPolicy.
+	retryPolicy *RetryPolicy
+	// backoff is the wait of retryPolicy after the latest failed backup, and backoffUntil when it ends.
+	backoff      time.Duration
+	backoffUntil time.Time
+	// inProgress keeps SaveSnap and SaveSnapWithPrefix from saving two backups together.
+	inProgress backupInProgress
+
+	// compression is how snapshots are compressed before they are saved. See package compression.
+	compression string
+	// compressionLevel is the level of the compression, or compression.DefaultLevel.
+	compressionLevel int
+
+	// nameTemplate renders the names of the backups if not nil. See util.ParseBackupNameTemplate.
+	nameTemplate *template.Template
+
+	// metrics records the backups saved by SaveSnap and the failed purges. It is nil if metrics are not recorded.
+	metrics *metrics.Metrics
+
+	// maxRevisionLag is how many revisions behind the max revision a follower with a backup priority may be
+	// to be preferred for taking the snapshots. See k8sutil.MemberBackupPriorityAnnotation.
+	maxRevisionLag int64
+
+	// snapshotTimeout is the timeout of receiving a snapshot from etcd.
+	// If equal to 0, constants.DefaultSnapshotTimeout is used.
+	snapshotTimeout time.Duration
+	// snapshotTimeoutPolicy scales the timeout of receiving and saving a snapshot with the size of the database
+	// if not nil, from the snapshotTimeout base.
+	snapshotTimeoutPolicy *SnapshotTimeoutPolicy
+
+	// recorder emits an event on the EtcdCluster after each backup saved by SaveSnap if not nil. See RecordEvents.
+	recorder record.EventRecorder
+	// lastFailureEvent and lastFailureEventTime are the message and time of the latest failure event.
+	lastFailureEvent     string
+	lastFailureEventTime time.Time
+	// lastAlarmEvent and lastAlarmEventTime are the message and time of the latest alarm event.
+	lastAlarmEvent     string
+	lastAlarmEventTime time.Time
+	// eventClusterUID is the UID of the EtcdCluster the events are emitted on, once found by clusterRef.
+	eventClusterUID string
+
+	// logger logs with the cluster and namespace fields. If nil, newLogger is used.
+	logger *logrus.Entry
+}
+
+var pkgLogger = logrus.WithField("pkg", "backup")
+
+// newLogger returns the logger of the BackupManager of the given cluster.
+// The messages of BackupManager are constant, while the values are in consistently named fields:
+// cluster, namespace, revision, version, size_mb, duration_s, throughput_mb_s, timeout_s and error.
+func newLogger(clusterName, namespace string) *logrus.Entry {
+	return pkgLogger.WithFields(logrus.Fields{"cluster": clusterName, "namespace": namespace})
 }
 
 // NewBackupManager creates a BackupManager.
 func NewBackupManager(kubecli kubernetes.Interface, clusterName string, namespace string, etcdTLSConfig *tls.Config, be backend.Backend) *BackupManager {
+	return NewBackupManagerWithSnapshotTimeout(kubecli, clusterName, namespace, etcdTLSConfig, be, constants.DefaultSnapshotTimeout)
+}
+
+// NewBackupManagerWithSnapshotTimeout creates a BackupManager which gives up receiving a snapshot
+// from etcd after snapshotTimeout. If snapshotTimeout is 0, constants.DefaultSnapshotTimeout is used.
+func NewBackupManagerWithSnapshotTimeout(kubecli kubernetes.Interface, clusterName string, namespace string, etcdTLSConfig *tls.Config, be backend.Backend, snapshotTimeout time.Duration) *BackupManager {
 	return &BackupManager{
-		kubecli:       kubecli,
-		clusterName:   clusterName,
-		namespace:     namespace,
-		etcdTLSConfig: etcdTLSConfig,
-		be:            be,
+		kubecli:             kubecli,
+		clusterName:         clusterName,
+		namespace:           namespace,
+		etcdTLSConfig:       etcdTLSConfig,
+		be:                  be,
+		snapshotTimeout:     snapshotTimeout,
+		checkSnapshotStream: true,
+		logger:              newLogger(clusterName, namespace),
 	}
 }
 
+// NewBackupManagerWithLogger creates a BackupManager which logs to the given logger, e.g. a test logger.
+// The cluster and namespace fields are added to the logger.
+func NewBackupManagerWithLogger(kubecli kubernetes.Interface, clusterName string, namespace string, etcdTLSConfig *tls.Config, be backend.Backend, logger *logrus.Entry) *BackupManager {
+	bm := NewBackupManager(kubecli, clusterName, namespace, etcdTLSConfig, be)
+	bm.logger = logger.WithFields(logrus.Fields{"cluster": clusterName, "namespace": namespace})
+	return bm
+}
+
 // NewBackupManagerFromWriter creates a BackupManager with backup writer.
-func NewBackupManagerFromWriter(kubecli kubernetes.Interface, bw writer.Writer, clusterName, namespace string) *BackupManager {
+// etcdTLSConfig is nil if the cluster does not use TLS.
+// The retention policy is applied after each successful SaveSnapWithPrefix.
+// compressionType and compressionLevel must be validated by compression.Validate.
+// Its metrics are registered with the default prometheus registry.
+func NewBackupManagerFromWriter(kubecli kubernetes.Interface, bw writer.Writer, clusterName, namespace string, etcdTLSConfig *tls.Config,
+	retention BackupRetentionPolicy, compressionType string, compressionLevel int) *BackupManager {
+	m, err := metrics.New(prometheus.DefaultRegisterer)
+	if err != nil {
+		// the backups are still saved, only not measured.
+		logrus.Warningf("failed to register backup metrics: %v", err)
+	}
 	return &BackupManager{
-		kubecli:     kubecli,
-		clusterName: clusterName,
-		namespace:   namespace,
-		bw:          bw,
+		kubecli:             kubecli,
+		clusterName:         clusterName,
+		namespace:           namespace,
+		etcdTLSConfig:       etcdTLSConfig,
+		bw:                  bw,
+		retention:           retention,
+		compression:         compressionType,
+		compressionLevel:    compressionLevel,
+		snapshotTimeout:     constants.DefaultSnapshotTimeout,
+		checkSnapshotStream: true,
+		metrics:             m,
+		logger:              newLogger(clusterName, namespace),
 	}
 }
 
-// SaveSnap saves the latest snapshot if its revision is greater than the given lastSnapRev
-// and returns a BackupStatus containing saving backup metadata if SaveSnap succeeds.
-func (bm *BackupManager) SaveSnap(lastSnapRev int64) (*backupapi.BackupStatus, error) {
-	etcdcli, rev, err := bm.etcdClientWithMaxRevision()
-	if err != nil {
-		return nil, fmt.Errorf("create etcd client with max revision failed: %v", err)
+// SaveSnap saves the latest snapshot if its revision is greater than the given lastSnapRev, and far enough from it
+// by the skip policy, and returns a BackupStatus containing saving backup metadata if SaveSnap succeeds.
+// If lastSnapRev is LatestBackupRevUnknown, the revision of the latest backup is read from the backend first,
+// and SaveSnap fails if the backend can't be read.
+// The timeouts of the backup are derived from ctx: once ctx is done, the snapshot stream and its upload are
+// cancelled, and the backup fails instead of leaving a partial backup in the storage.
+// If another backup of bm is in progress, no backup is saved and ErrBackupInProgress is returned.
+func (bm *BackupManager) SaveSnap(ctx context.Context, lastSnapRev int64) (*backupapi.BackupStatus, error) {
+	return bm.SaveSnapWithOptions(ctx, lastSnapRev, SaveSnapOptions{})
+}
+
+// SaveSnapOptions are the options of SaveSnapWithOptions.
+type SaveSnapOptions struct {
+	// Force saves a full snapshot even if the revision of the cluster is not greater than lastSnapRev,
+	// and even if incremental backups are enabled. A forced backup at the revision of the latest backup
+	// taken from the same etcd version has the same name, and replaces it.
+	// A forced backup waits for the backup in progress to end instead of being skipped.
+	Force bool
+}
+
+// SaveSnapWithOptions is like SaveSnap with the given options.
+func (bm *BackupManager) SaveSnapWithOptions(ctx context.Context, lastSnapRev int64, opts SaveSnapOptions) (*backupapi.BackupStatus, error) {
+	// a forced backup is queued behind the backup in progress, while the others are skipped.
+	if err := bm.beginBackup(ctx, opts.Force); err != nil {
+		return nil, err
 	}
-	defer etcdcli.Close()
+	defer bm.inProgress.end()
+
+	start := time.Now()
+	bm.metrics.IncAttempts(bm.clusterName)
+	bs, err := bm.saveSnap(ctx, lastSnapRev, opts)
+	switch {
+	case err != nil:
+		bm.metrics.IncFailures(bm.clusterName, failureReason(err))
+	case bs == nil:
+		bm.metrics.IncRevisionsSkipped(bm.clusterName)
+	default:
+		// bs.Size is in MB truncated to KB, which is precise enough for the histogram buckets.
+		bm.metrics.ObserveBackup(bm.clusterName, time.Since(start), int64(bs.Size*1024*1024))
+	}
+	bm.recordBackupEvent(bs, err)
+	bm.updateBackoff(err, time.Now())
+	return bs, err
+}
 
-	if rev <= lastSnapRev {
-		logrus.Info("skipped creating new backup: no change since last time")
-		return nil, nil
+// saveSnap saves the snapshot for SaveSnapWithOptions, which records its outcome in bm.metrics.
+func (bm *BackupManager) saveSnap(ctx context.Context, lastSnapRev int64, opts SaveSnapOptions) (*backupapi.BackupStatus, error) {
+	// the post-backup hook also runs after a failed pre-backup hook, which may have done part of its work.
+	defer bm.runPostBackupHook()
+	if err := bm.runPreBackupHook(ctx); err != nil {
+		return nil, err
+	}
+	if err := bm.checkStorage(ctx, ""); err != nil {
+		return nil, err
 	}
 
-	bs, err := bm.writeSnap(etcdcli.Maintenance, etcdcli.Endpoints()[0], rev)
+	// a forced backup is a full snapshot, which doesn't depend on the latest backup.
+	if lastSnapRev == LatestBackupRevUnknown && !opts.Force {
+		var err error
+		if lastSnapRev, err = bm.getLatestBackupRev(ctx); err != nil {
+			return nil, &backupFailure{reason: failureStorage, err: fmt.Errorf("failed to get the latest backup revision: %v", err)}
+		}
+	}
+	etcdcli, rev, err := bm.etcdClientWithMaxRevision(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("write snapshot failed: %v", err)
+		return nil, &backupFailure{reason: failureEtcd, err: fmt.Errorf("create etcd client with max revision failed: %v", err)}
 	}
-	logrus.Infof("saved backup (rev: %v, etcdVersion: %v) for cluster (%s)",
-		bs.Revision, bs.Version, bm.clusterName)
-	return bs, nil
+	// etcdcli is replaced if the snapshot is retried from another member.
+	defer func() { etcdcli.Close() }()
+
+	// the alarms are checked before skipping: a cluster out of space doesn't change, so its backups are skipped.
+	alarms, err := bm.checkAlarms(ctx, etcdcli.Maintenance)
+	if err != nil {
+		return nil, err
+	}
+
+	bm.lastSkipReason = ""
+	if !opts.Force {
+		if reason := bm.skipReason(lastSnapRev, rev); len(reason) != 0 {
+			bm.lastSkipReason = reason
+			bm.getLogger().WithFields(logrus.Fields{"revision": rev, "reason": reason}).Info("skipped creating new backup")
+			return nil, bm.noSpaceFailure(alarms)
+		}
+	}
+
+	var (
+		bs       *backupapi.BackupStatus
+		attempts = 1
+	)
+	if bm.incremental != nil && !opts.Force {
+		bs, err = bm.saveIncremental(ctx, etcdcli, lastSnapRev, rev)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var (
+			werr       error
+			defragFrom int64
+		)
+		if bm.defrag != nil {
+			defragFrom = bm.defragment(ctx, etcdcli.Maintenance, etcdcli.Endpoints()[0])
+		}
+		attempts = 0
+		err = bm.retrySnapshot(ctx, func() error {
+			attempts++
+			if _, ok := werr.(*etcdError); ok {
+				// the member may have restarted: the snapshot is taken from the member with max revision again.
+				cli, r, cerr := bm.etcdClientWithMaxRevision(ctx)
+				if cerr != nil {
+					werr = &etcdError{fmt.Errorf("create etcd client with max revision failed: %v", cerr)}
+					return werr
+				}
+				etcdcli.Close()
+				etcdcli, rev = cli, r
+			}
+			werr = bm.retryOnExpiredToken(&etcdcli, func(cli *clientv3.Client) error {
+				var err error
+				bs, err = bm.writeSnap(ctx, cli.Maintenance, cli.Endpoints()[0], rev)
+				return err
+			})
+			return werr
+		})
+		if err != nil {
+			return nil, wrapFailure(err, fmt.Sprintf("write snapshot failed after %d attempt(s)", attempts))
+		}
+		if defragFrom > 0 {
+			bs.DBSizeBeforeDefrag = util.ToMB(defragFrom)
+		}
+		bm.saveClusterMetadata(ctx, etcdcli.Cluster, bs)
+	}
+	bs.Forced = opts.Force
+	bs.Attempts = attempts
+	bs.Alarms = alarms
+	bm.lastBackupTime = time.Now()
+	bm.getLogger().WithFields(logrus.Fields{
+		"revision":        bs.Revision,
+		"version":         bs.Version,
+		"size_mb":         bs.Size,
+		"duration_s":      bs.TimeTookInSecond,
+		"throughput_mb_s": bs.Throughput,
+		"forced":          bs.Forced,
+		"attempts":        bs.Attempts,
+	}).Info("saved backup")
+
+	if bm.metadataStore != nil {
+		// the backup is saved even if its metadata can't be recorded.
+		if err := bm.metadataStore.Record(bs.Name, bs); err != nil {
+			bm.getLogger().WithError(err).Warning("failed to record backup metadata")
+		}
+	}
+	bm.applyRetentionPolicy(ctx)
+	if bm.compaction != nil {
+		bm.compact(ctx, etcdcli, bs.Revision)
+	}
+	bm.countBackup(ctx, etcdcli)
+	// the backup is saved, but reported failed.
+	return bs, bm.noSpaceFailure(alarms)
 }
 
-func (bm *BackupManager) writeSnap(mcli clientv3.Maintenance, endpoint string, rev int64) (*backupapi.BackupStatus, error) {
+// applyRetentionPolicy purges the backups not retained by the retention policy.
+// It runs right after a successful save in the same call, so it never races with another save.
+// Failing to purge does not fail the backup. It stops purging once ctx is done.
+func (bm *BackupManager) applyRetentionPolicy(ctx context.Context) {
+	if bm.retention.MaxBackups > 0 {
+		if err := bm.be.KeepLatestN(ctx, bm.retention.MaxBackups); err != nil {
+			bm.metrics.IncPurgeFailed(bm.clusterName)
+			bm.getLogger().WithError(err).Error("fail to purge backups")
+		}
+	}
+	if bm.retention.MaxBackupAge > 0 {
+		if err := bm.be.PruneOlderThan(ctx, bm.retention.MaxBackupAge); err != nil {
+			bm.metrics.IncPurgeFailed(bm.clusterName)
+			bm.getLogger().WithError(err).WithField("max_age", bm.retention.MaxBackupAge).Error("fail to prune old backups")
+		}
+	}
+	if bm.metrics != nil {
+		if n, err := bm.be.Total(); err == nil {
+			bm.metrics.SetStoredBackups(bm.clusterName, n)
+		}
+	}
+}
+
+func (bm *BackupManager) writeSnap(ctx context.Context, mcli clientv3.Maintenance, endpoint string, rev int64) (*backupapi.BackupStatus, error) {
 	start := time.Now()
 
-	version, err := getEtcdVersion(mcli, endpoint)
+	status, err := bm.getEtcdStatus(ctx, mcli, endpoint)
 	if err != nil {
 		return nil, err
 	}
+	version := status.Version
 
-	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultSnapshotTimeout)
+	// the timeout covers both receiving the snapshot and saving it, which are streamed together.
+	ctx, cancel := context.WithTimeout(ctx, bm.snapshotTimeoutFor(status.DbSize))
 	rc, err := mcli.Snapshot(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to receive snapshot (%v)", err)
+		return nil, &etcdError{fmt.Errorf("failed to receive snapshot (%v)", err)}
 	}
 	defer cancel()
 	defer rc.Close()
 
-	n, err := bm.be.Save(version, rev, rc)
+	// the snapshot is read once: it is hashed as it is saved, so it is never buffered in memory.
+	// The checksum is of the snapshot before compression.
+	h := sha256.New()
+	var sv *util.SnapshotVerifier
+	er := &etcdReader{r: rc}
+	r := io.Reader(er)
+	if bm.checkSnapshotStream {
+		sv = util.NewSnapshotVerifier(er)
+		if etcdutil.SnapshotHasHash(version) {
+			sv.RequireHash()
+		}
+		r = sv
+	}
+	r = io.TeeReader(r, h)
+	var f *os.File
+	if bm.verifySnapshot {
+		// bolt needs random access to check the snapshot, so a copy is kept aside while it is saved.
+		f, err = ioutil.TempFile("", "etcd-snapshot-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create snapshot copy: %v", err)
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		r = io.TeeReader(r, f)
+	}
+	// raw counts the bytes of the snapshot and logs the progress of saving a large one.
+	raw := newProgressReader(r, bm.getLogger().WithField("revision", rev))
+	name, err := bm.makeBackupName(version, rev)
 	if err != nil {
 		return nil, err
 	}
+	name = compression.MakeName(name, bm.compression)
+	var (
+		n   int64
+		sum string
+		// uploaded and saved tell whether the snapshot, and then the whole backup, is saved.
+		uploaded, saved bool
+	)
+	// a backup cancelled after its snapshot is uploaded, e.g. when the sidecar is stopped or the
+	// snapshot times out, is deleted so that no backup without its checksum is left in the storage.
+	// The backends clean up the snapshots whose upload is cancelled.
+	defer func() {
+		if uploaded && !saved && ctx.Err() != nil {
+			bm.deletePartial(name, ctx.Err())
+		}
+	}()
+	if bm.compression == compression.None && bm.nameTemplate == nil {
+		n, err = bm.be.Save(ctx, version, rev, raw)
+		if err = bm.tolerateReplication(err); err != nil {
+			return nil, er.wrap(ctx, err)
+		}
+		uploaded = true
+		sum = hex.EncodeToString(h.Sum(nil))
+		err = bm.tolerateReplication(bm.be.SaveChecksum(ctx, version, rev, sum))
+	} else {
+		// the backends only name the backups they save with the default name.
+		cr := compression.NewCompressReader(raw, bm.compression, bm.compressionLevel)
+		n, err = bm.be.SaveAs(ctx, name, cr)
+		cr.Close()
+		if err = bm.tolerateReplication(err); err != nil {
+			return nil, er.wrap(ctx, err)
+		}
+		uploaded = true
+		sum = hex.EncodeToString(h.Sum(nil))
+		_, err = bm.be.SaveAs(ctx, util.MakeChecksumName(name), strings.NewReader(sum))
+		err = bm.tolerateReplication(err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save checksum: %v", err)
+	}
+
+	if sv != nil {
+		if err = bm.checkSaved(sv, name); err != nil {
+			return nil, err
+		}
+	}
+	if f != nil {
+		if err = bm.verifySaved(f.Name(), name); err != nil {
+			return nil, err
+		}
+	}
 
 	bs := &backupapi.BackupStatus{
+		Name:             name,
 		CreationTime:     time.Now().Format(time.RFC3339),
-		Size:             util.ToMB(n),
+		Size:             util.ToMB(raw.n),
 		Version:          version,
 		Revision:         rev,
 		TimeTookInSecond: int(time.Since(start).Seconds() + 1),
+		SHA256:           sum,
+		Throughput:       raw.throughput(),
+	}
+	if status.Header != nil {
+		bs.MemberID = fmt.Sprintf("%x", status.Header.MemberId)
+		bs.FromLeader = status.Leader == status.Header.MemberId
+	}
+	if bm.compression != compression.None {
+		bs.CompressedSize = util.ToMB(n)
 	}
+	saved = true
 
 	return bs, nil
 }
 
+// SetNameTemplate has the backups named with t, parsed by util.ParseBackupNameTemplate, instead of the default names.
+// The backups named either way are listed and sorted together.
+func (bm *BackupManager) SetNameTemplate(t *template.Template) {
+	bm.nameTemplate = t
+}
+
+// makeBackupName returns the name of the backup of the given etcd version and revision taken now,
+// before compression and encryption.
+func (bm *BackupManager) makeBackupName(version string, rev int64) (string, error) {
+	uid := ""
+	if bm.nameTemplate != nil {
+		// the UID is only looked up for the template, which may use it.
+		uid = bm.clusterUID()
+	}
+	return util.MakeBackupNameFromTemplate(bm.nameTemplate, version, rev, bm.clusterName, uid, time.Now())
+}
+
+// checkSaved checks the snapshot saved as name, which was read through sv.
+// If the snapshot is truncated or corrupt, it is deleted with its checksum so that it is never restored.
+func (bm *BackupManager) checkSaved(sv *util.SnapshotVerifier, name string) error {
+	err := sv.Verify()
+	if err == nil {
+		return nil
+	}
+	bm.deleteCorrupt(name, err)
+	return &backupFailure{reason: failureCorrupt, err: fmt.Errorf("backup (%s) is corrupt: %v", name, err)}
+}
+
+// verifySaved checks the copy at snapPath of the snapshot saved as name.
+// If the snapshot is truncated or corrupt, it is deleted with its checksum so that it is never restored.
+func (bm *BackupManager) verifySaved(snapPath, name string) error {
+	err := util.VerifySnap(snapPath)
+	if err == nil {
+		return nil
+	}
+	bm.deleteCorrupt(name, err)
+	return &backupFailure{reason: failureCorrupt, err: fmt.Errorf("backup (%s) is corrupt: %v", name, err)}
+}
+
+// deleteCorrupt deletes the snapshot saved as name with its checksum, which failed the check with err.
+func (bm *BackupManager) deleteCorrupt(name string, err error) {
+	bm.metrics.IncCorruptSnapshots(bm.clusterName)
+	logger := bm.getLogger().WithField("backup", name)
+	logger.WithError(err).Error("saved snapshot is corrupt")
+	bm.deleteWithChecksum(logger, name)
+}
+
+// deletePartial deletes the snapshot saved as name with its checksum, whose backup was cancelled with err.
+func (bm *BackupManager) deletePartial(name string, err error) {
+	logger := bm.getLogger().WithField("backup", name)
+	logger.WithError(err).Warning("deleting cancelled backup")
+	bm.deleteWithChecksum(logger, name)
+}
+
+// deleteWithChecksum deletes the snapshot saved as name with its checksum and cluster metadata, if they exist.
+func (bm *BackupManager) deleteWithChecksum(logger *logrus.Entry, name string) {
+	for _, n := range []string{name, util.MakeChecksumName(name), util.MakeClusterMetadataName(name)} {
+		if derr := bm.be.Delete(n); derr != nil && !os.IsNotExist(derr) {
+			logger.WithError(derr).Warningf("failed to delete backup file (%s)", n)
+		}
+	}
+}
+
+// tolerateReplication returns nil if err only reports that a minority of the backends
+// of a backend.ReplicatedBackend failed, since the backup is still saved on a quorum of them.
+func (bm *BackupManager) tolerateReplication(err error) error {
+	if backend.IsPartialReplication(err) {
+		bm.getLogger().WithError(err).Warning("saved backup partially")
+		return nil
+	}
+	return err
+}
+
 // SaveSnapWithPrefix uses backup writer to save latest snapshot to a path prepended with the given prefix
 // and returns file size and full path.
 // the full path has the format of prefix/<etcd_version>_<snapshot_reversion>_etcd.backup
 // e.g prefix = etcd-backups/v1/default/example-etcd-cluster and
 // backup object name = 3.1.8_0000000000000001_etcd.backup
 // full path is "etcd-backups/v1/default/example-etcd-cluster/3.1.8_0000000000000001_etcd.backup".
-func (bm *BackupManager) SaveSnapWithPrefix(prefix string) (string, error) {
-	etcdcli, rev, err := bm.etcdClientWithMaxRevision()
+// If the writer reports a partial write, the full path is returned along with the *writer.PartialWriteError.
+// If the cluster revision has not moved past the latest backup under the prefix, no backup is saved and
+// the full path of the latest backup is returned along with ErrSnapshotUnchanged.
+// If another backup of bm is in progress, no backup is saved and ErrBackupInProgress is returned.
+// It stops saving the snapshot once ctx is done.
+func (bm *BackupManager) SaveSnapWithPrefix(ctx context.Context, prefix string) (string, error) {
+	if err := bm.beginBackup(ctx, false); err != nil {
+		return "", err
+	}
+	defer bm.inProgress.end()
+
+	// the post-backup hook also runs after a failed pre-backup hook, which may have done part of its work.
+	defer bm.runPostBackupHook()
+	if err := bm.runPreBackupHook(ctx); err != nil {
+		return "", err
+	}
+	if err := bm.checkStorage(ctx, prefix); err != nil {
+		return "", err
+	}
+
+	etcdcli, rev, err := bm.etcdClientWithMaxRevision(ctx)
 	if err != nil {
 		return "", fmt.Errorf("create etcd client failed: %v", err)
 	}
-	defer etcdcli.Close()
+	// etcdcli is replaced if its auth token expires.
+	defer func() { etcdcli.Close() }()
+	if _, err := bm.checkAlarms(ctx, etcdcli.Maintenance); err != nil {
+		return "", err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultSnapshotTimeout)
-	rc, err := etcdcli.Snapshot(ctx)
+	idx := bm.loadIndex(prefix)
+	latestPath, latestRev, err := bm.getLatestBackupWithPrefix(prefix, idx)
 	if err != nil {
-		return "", fmt.Errorf("failed to receive snapshot (%v)", err)
+		// Not knowing the latest backup only costs an unneeded backup.
+		bm.getLogger().WithError(err).Warning("failed to get the latest backup")
+	} else if len(latestPath) != 0 && rev <= latestRev {
+		bm.getLogger().WithFields(logrus.Fields{"revision": rev, "path": latestPath}).Info("skipped creating new backup: no change since the latest backup")
+		return latestPath, ErrSnapshotUnchanged
 	}
-	defer cancel()
-	defer rc.Close()
 
-	version, err := getEtcdVersion(etcdcli.Maintenance, etcdcli.Endpoints()[0])
+	status, err := bm.getEtcdStatus(ctx, etcdcli.Maintenance, etcdcli.Endpoints()[0])
 	if err != nil {
 		return "", err
 	}
-	fullPath := path.Join(prefix, util.MakeBackupName(version, rev))
-	_, err = bm.bw.Write(fullPath, rc)
+	version := status.Version
+	timeout := bm.snapshotTimeoutFor(status.DbSize)
+	name, err := bm.makeBackupName(version, rev)
 	if err != nil {
+		return "", err
+	}
+	fullPath := path.Join(prefix, compression.MakeName(name, bm.compression))
+	md := &backupapi.BackupMetadata{
+		ClusterName:       bm.clusterName,
+		Namespace:         bm.namespace,
+		ClusterUID:        bm.clusterUID(),
+		EtcdVersion:       version,
+		Revision:          rev,
+		CreationTimestamp: time.Now(),
+	}
+	var (
+		n   int64
+		sum string
+	)
+	err = bm.retryUpload(ctx, func() error {
+		return bm.retryOnExpiredToken(&etcdcli, func(cli *clientv3.Client) error {
+			var werr error
+			n, sum, werr = bm.writeSnapWithPrefix(ctx, cli.Maintenance, fullPath, md, timeout)
+			return werr
+		})
+	})
+	if err != nil && !writer.IsPartialWrite(err) {
 		return "", fmt.Errorf("failed to write snapshot (%v)", err)
 	}
-	return fullPath, nil
+	cerr := bm.retryUpload(ctx, func() error {
+		_, werr := bm.bw.Write(ctx, util.MakeChecksumName(fullPath), strings.NewReader(sum))
+		return werr
+	})
+	if cerr != nil && !writer.IsPartialWrite(cerr) {
+		// a backup without its checksum can't be verified before restoring from it.
+		bm.bw.Delete(fullPath)
+		return "", fmt.Errorf("failed to write checksum (%v)", cerr)
+	}
+	lg := bm.getLogger().WithFields(logrus.Fields{"revision": rev, "version": version, "path": fullPath, "size_mb": util.ToMB(n)})
+	if err != nil {
+		lg.WithError(err).Warning("saved backup partially")
+	} else {
+		lg.Info("saved backup")
+	}
+	bm.saveClusterMetadataWithPrefix(ctx, etcdcli.Cluster, fullPath, version, rev, sum)
+	if lerr := writeLatest(ctx, bm.bw, prefix, fullPath, rev, sum); lerr != nil {
+		// the backup is saved, but the latest alias still points at the previous one.
+		bm.metrics.IncLatestFailed(bm.clusterName)
+		bm.getLogger().WithError(lerr).Warning("failed to update the latest backup alias")
+	}
+	if idx != nil {
+		idx.Put(backupapi.BackupIndexEntry{
+			Name:      path.Base(fullPath),
+			Revision:  rev,
+			Version:   version,
+			Size:      n,
+			SHA256:    sum,
+			CreatedAt: md.CreationTimestamp,
+		})
+	}
+	if bm.retention.MaxBackups > 0 {
+		bm.purgeBackupsWithPrefix(ctx, prefix, idx, bm.retention.MaxBackups)
+	}
+	if bm.retention.MaxBackupAge > 0 {
+		bm.purgeBackupsOlderThanWithPrefix(ctx, prefix, idx, bm.retention.MaxBackupAge)
+	}
+	if idx != nil {
+		if werr := writeIndex(ctx, bm.bw, prefix, idx); werr != nil {
+			// the index is rebuilt from listing the storage once it is found stale.
+			bm.getLogger().WithError(werr).Warning("failed to update backup index")
+		}
+	}
+	if err == nil {
+		// a backup saved partially doesn't count.
+		bm.countBackup(ctx, etcdcli)
+	}
+	return fullPath, err
 }
 
-func getEtcdVersion(mcli clientv3.Maintenance, endpoint string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultSnapshotTimeout)
+// writeSnapWithPrefix receives a snapshot and writes it to fullPath with the given metadata.
+// It returns the size written and the hex encoded SHA-256 checksum of the snapshot before compression.
+func (bm *BackupManager) writeSnapWithPrefix(ctx context.Context, mcli clientv3.Maintenance, fullPath string, md *backupapi.BackupMetadata, timeout time.Duration) (int64, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	rc, err := mcli.Snapshot(ctx)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to receive snapshot (%v)", err)
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	var sv *util.SnapshotVerifier
+	pr := newProgressReader(rc, bm.getLogger().WithField("path", fullPath))
+	r := io.Reader(pr)
+	if bm.checkSnapshotStream {
+		sv = util.NewSnapshotVerifier(pr)
+		if etcdutil.SnapshotHasHash(md.EtcdVersion) {
+			sv.RequireHash()
+		}
+		r = sv
+	}
+	cr := compression.NewCompressReader(io.TeeReader(r, h), bm.compression, bm.compressionLevel)
+	defer cr.Close()
+	n, err := writer.WriteWithMetadata(ctx, bm.bw, fullPath, cr, md.ToMap())
+	if err == nil && sv != nil {
+		if verr := sv.Verify(); verr != nil {
+			bm.metrics.IncCorruptSnapshots(bm.clusterName)
+			bm.bw.Delete(fullPath)
+			return 0, "", fmt.Errorf("backup (%s) is corrupt: %v", fullPath, verr)
+		}
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), err
+}
+
+// purgeBackupsWithPrefix deletes the oldest backups under the given prefix so that only the latest
+// maxBackups are kept. Failing to delete a backup does not fail the backup; it is logged and counted.
+// The backups are looked up in idx, which the deleted backups are removed from, or listed if idx is nil.
+// It stops purging once ctx is done.
+func (bm *BackupManager) purgeBackupsWithPrefix(ctx context.Context, prefix string, idx *backupapi.BackupIndex, maxBackups int) {
+	var names []string
+	if idx != nil {
+		names = idx.Names()
+	} else {
+		var err error
+		if names, err = listBackupsWithPrefix(bm.bw, prefix); err != nil {
+			bm.getLogger().WithError(err).Error("fail to list backups to purge")
+			return
+		}
+	}
+	if len(names) <= maxBackups {
+		return
+	}
+	bm.deleteBackupsWithPrefix(ctx, prefix, idx, names[:len(names)-maxBackups])
+}
+
+// purgeBackupsOlderThanWithPrefix deletes the backups under the given prefix which were created more than
+// maxAge ago, except the latest backup. Their age is looked up in idx, which the deleted backups are removed from.
+// If idx is nil or doesn't tell the age of all the backups, the writer must be a writer.ModTimeLister to tell it.
+// It stops purging once ctx is done.
+func (bm *BackupManager) purgeBackupsOlderThanWithPrefix(ctx context.Context, prefix string, idx *backupapi.BackupIndex, maxAge time.Duration) {
+	var (
+		nameModTimes map[string]time.Time
+		ok           bool
+	)
+	if idx != nil {
+		nameModTimes, ok = idx.CreationTimes()
+	}
+	if !ok {
+		l, ok := bm.bw.(writer.ModTimeLister)
+		if !ok {
+			bm.getLogger().Warning("skipped purging old backups: the storage can't tell the age of backups")
+			return
+		}
+		modTimes, err := l.ListModTimes(strings.TrimSuffix(prefix, "/") + "/")
+		if err != nil {
+			bm.getLogger().WithError(err).Error("fail to list backups to purge")
+			return
+		}
+		// the backups in nested prefixes belong to other clusters.
+		nameModTimes = make(map[string]time.Time, len(modTimes))
+		for p, t := range modTimes {
+			if path.Dir(p) == path.Clean(prefix) {
+				nameModTimes[path.Base(p)] = t
+			}
+		}
+	}
+	bm.deleteBackupsWithPrefix(ctx, prefix, idx, util.BackupsOlderThan(nameModTimes, time.Now().Add(-maxAge)))
+}
+
+// deleteBackupsWithPrefix deletes the backups of the given names under the given prefix with deleteBackupWithPrefix
+// until ctx is done. The backups left are purged after the next backup.
+func (bm *BackupManager) deleteBackupsWithPrefix(ctx context.Context, prefix string, idx *backupapi.BackupIndex, names []string) {
+	for _, name := range names {
+		if ctx.Err() != nil {
+			bm.getLogger().WithError(ctx.Err()).Warning("stopped purging backups")
+			return
+		}
+		bm.deleteBackupWithPrefix(prefix, idx, name)
+	}
+}
+
+// deleteBackupWithPrefix deletes the backup of the given name under the given prefix along with the files saved with it,
+// and removes it from idx if not nil.
+// Failures are logged, since a backup that is not deleted is purged again after the next backup.
+func (bm *BackupManager) deleteBackupWithPrefix(prefix string, idx *backupapi.BackupIndex, name string) {
+	p := path.Join(prefix, name)
+	if err := bm.bw.Delete(p); err != nil {
+		bm.metrics.IncPurgeFailed(bm.clusterName)
+		bm.getLogger().WithError(err).WithField("path", p).Error("fail to delete backup")
+		return
+	}
+	if idx != nil {
+		idx.Remove(name)
+	}
+	for _, sp := range []string{util.MakeChecksumName(p), util.MakeManifestName(p), util.MakeClusterMetadataName(p)} {
+		if err := bm.bw.Delete(sp); err != nil {
+			bm.getLogger().WithError(err).WithField("path", sp).Warning("fail to delete file saved with backup")
+		}
+	}
+	bm.getLogger().WithField("path", p).Info("deleted backup")
+}
+
+// getLogger returns the logger of bm.
+func (bm *BackupManager) getLogger() *logrus.Entry {
+	if bm.logger == nil {
+		return newLogger(bm.clusterName, bm.namespace)
+	}
+	return bm.logger
+}
+
+// getSnapshotTimeout returns the timeout of receiving a snapshot from etcd.
+func (bm *BackupManager) getSnapshotTimeout() time.Duration {
+	if bm.snapshotTimeout == 0 {
+		return constants.DefaultSnapshotTimeout
+	}
+	return bm.snapshotTimeout
+}
+
+// snapshotTimeoutFor returns the timeout of receiving and saving a snapshot of a database of dbSize bytes.
+func (bm *BackupManager) snapshotTimeoutFor(dbSize int64) time.Duration {
+	base := bm.getSnapshotTimeout()
+	if bm.snapshotTimeoutPolicy == nil {
+		return base
+	}
+	timeout := bm.snapshotTimeoutPolicy.timeout(base, dbSize)
+	bm.getLogger().WithFields(logrus.Fields{"size_mb": util.ToMB(dbSize), "timeout_s": timeout.Seconds()}).Info("computed snapshot timeout")
+	return timeout
+}
+
+// getEtcdStatus returns the status of the etcd member at endpoint, e.g. its version and the size of its database.
+func (bm *BackupManager) getEtcdStatus(ctx context.Context, mcli clientv3.Maintenance, endpoint string) (*clientv3.StatusResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, bm.getSnapshotTimeout())
 	resp, err := mcli.Status(ctx, endpoint)
 	cancel()
 	if err != nil {
-		return "", fmt.Errorf("failed to receive etcd version (%v)", err)
+		return nil, &etcdError{fmt.Errorf("failed to receive etcd version (%v)", err)}
 	}
-	return resp.Version, nil
+	return resp, nil
+}
+
+// clusterUID returns the UID of the EtcdCluster which owns the pods of the cluster, or "" if it can't be found.
+func (bm *BackupManager) clusterUID() string {
+	podList, err := bm.kubecli.Core().Pods(bm.namespace).List(k8sutil.ClusterListOpt(bm.clusterName))
+	if err != nil {
+		bm.getLogger().WithError(err).Warning("failed to get the cluster UID")
+		return ""
+	}
+	for _, pod := range podList.Items {
+		for _, ref := range pod.OwnerReferences {
+			if ref.Kind == api.EtcdClusterResourceKind {
+				return string(ref.UID)
+			}
+		}
+	}
+	return ""
+}
+
+// WatchTLS has the BackupManager use the etcd TLS config of w, which follows the rotation of its Secret.
+func (bm *BackupManager) WatchTLS(w *tlsutil.SecretWatcher) {
+	bm.tlsWatcher = w
+}
+
+// tlsConfig returns the TLS config to talk to etcd, or nil if the cluster does not use TLS.
+func (bm *BackupManager) tlsConfig() *tls.Config {
+	if bm.tlsWatcher != nil {
+		return bm.tlsWatcher.Config()
+	}
+	return bm.etcdTLSConfig
 }
 
 // etcdClientWithMaxRevision gets the etcd member with the maximum kv store revision
 // and returns the etcd client and the rev of that member.
-func (bm *BackupManager) etcdClientWithMaxRevision() (*clientv3.Client, int64, error) {
-	podList, err := bm.kubecli.Core().Pods(bm.namespace).List(k8sutil.ClusterListOpt(bm.clusterName))
+func (bm *BackupManager) etcdClientWithMaxRevision(ctx context.Context) (*clientv3.Client, int64, error) {
+	if bm.useServiceEndpoint && bm.discoverMembers {
+		return bm.etcdClientFromMemberList(ctx)
+	}
+	if bm.useServiceEndpoint {
+		return bm.etcdClientFromService(ctx)
+	}
+	podList, err := bm.listPods()
 	if err != nil {
 		return nil, 0, err
 	}
 
+	pods := backupCandidatePods(bm.getLogger(), podList.Items)
+	if len(pods) == 0 {
+		return nil, 0, errors.New("no running etcd pods found")
+	}
+	// the status of each member tells both its revision and whether it is the leader.
+	var mu sync.Mutex
+	leaders := make(map[string]bool)
+	getRev := func(ctx context.Context, pod *v1.Pod) (*etcdutil.Member, int64, error) {
+		m, st, err := getMemberStatus(ctx, bm.podMember(pod), bm.tlsConfig(), bm.credentials)
+		if err != nil {
+			return nil, 0, err
+		}
+		mu.Lock()
+		leaders[m.Name] = st.Leader == st.Header.MemberId
+		mu.Unlock()
+		return m, st.Header.Revision, nil
+	}
+	revs, err := getMemberRevisions(ctx, bm.getLogger(), pods, defaultRevisionCheckConcurrency, getRev)
+	isLeader := func(m *etcdutil.Member) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return leaders[m.Name]
+	}
+	member, rev := followerWithMaxRev(revs, isLeader)
+	if member == nil {
+		return nil, 0, fmt.Errorf("no reachable member: %v", err)
+	}
+	checkLeader := func(ctx context.Context, m *etcdutil.Member) (bool, error) {
+		return isLeader(m), nil
+	}
+	if p := preferredMember(ctx, bm.getLogger(), revs, rev, bm.maxRevisionLag, checkLeader); p != nil {
+		bm.getLogger().WithFields(logrus.Fields{"member": p.member.Name, "revision": p.rev}).Info("taking the snapshot from a follower with backup priority")
+		member, rev = p.member, p.rev
+	}
+
+	etcdcli, err := bm.newEtcdClient(member.ClientURL())
+	if err != nil {
+		return nil, 0, fmt.Errorf("create etcd client failed: %v", err)
+	}
+	return etcdcli, rev, nil
+}
+
+// listPods lists the pods of the members of the cluster.
+func (bm *BackupManager) listPods() (*v1.PodList, error) {
+	return bm.kubecli.Core().Pods(bm.namespace).List(k8sutil.ClusterListOpt(bm.clusterName))
+}
+
+// MemberInfo is the state of an etcd member as seen by ListMembers.
+type MemberInfo struct {
+	*etcdutil.Member
+	// Reachable is true if the member answered its status.
+	Reachable bool
+	// Revision is the kv store revision of the member, if reachable.
+	Revision int64
+	// Version is the etcd version of the member, if reachable.
+	Version string
+	// Err is why the member is not reachable.
+	Err error
+}
+
+// ListMembers returns the members running in the pods of the cluster, found like the members to back up,
+// in the order of the pods. The members are queried concurrently, and those which don't answer in time
+// are reported unreachable.
+func (bm *BackupManager) ListMembers(ctx context.Context) ([]MemberInfo, error) {
+	podList, err := bm.listPods()
+	if err != nil {
+		return nil, err
+	}
 	var pods []*v1.Pod
 	for i := range podList.Items {
-		pod := &podList.Items[i]
-		if pod.Status.Phase == v1.PodRunning {
-			pods = append(pods, pod)
+		if podList.Items[i].Status.Phase == v1.PodRunning {
+			pods = append(pods, &podList.Items[i])
 		}
 	}
 
-	if len(pods) == 0 {
-		return nil, 0, errors.New("no running etcd pods found")
+	var mu sync.Mutex
+	versions := make(map[string]string)
+	getRev := func(ctx context.Context, pod *v1.Pod) (*etcdutil.Member, int64, error) {
+		m, st, err := getMemberStatus(ctx, bm.podMember(pod), bm.tlsConfig(), bm.credentials)
+		if err != nil {
+			return nil, 0, err
+		}
+		mu.Lock()
+		versions[pod.Name] = st.Version
+		mu.Unlock()
+		return m, st.Header.Revision, nil
 	}
-	member, rev := getMemberWithMaxRev(pods, bm.etcdTLSConfig)
-	if member == nil {
-		return nil, 0, errors.New("no reachable member")
+	revs, err := getMemberRevisions(ctx, bm.getLogger(), pods, defaultRevisionCheckConcurrency, getRev)
+	merrs, _ := err.(memberErrors)
+
+	byPod := make(map[string]memberRevision, len(revs))
+	for _, r := range revs {
+		byPod[r.pod.Name] = r
+	}
+	infos := make([]MemberInfo, 0, len(pods))
+	for _, pod := range pods {
+		r, ok := byPod[pod.Name]
+		if !ok {
+			infos = append(infos, MemberInfo{Member: bm.podMember(pod), Err: merrs[pod.Name]})
+			continue
+		}
+		infos = append(infos, MemberInfo{Member: r.member, Reachable: true, Revision: r.rev, Version: versions[pod.Name]})
 	}
+	return infos, nil
+}
 
-	etcdcli, err := createEtcdClient(member.ClientURL(), bm.etcdTLSConfig)
+// backupCandidatePods returns the pods whose member may be backed up: the running pods which are ready
+// and whose etcd container is ready, so that no dial is wasted on a crash-looping or syncing member.
+// If none is ready, the running pods are returned so that a degraded cluster can still be backed up.
+func backupCandidatePods(logger *logrus.Entry, items []v1.Pod) []*v1.Pod {
+	var running, ready []*v1.Pod
+	for i := range items {
+		pod := &items[i]
+		if pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		running = append(running, pod)
+		if k8sutil.IsPodReady(pod) && k8sutil.IsEtcdContainerReady(pod) {
+			ready = append(ready, pod)
+		}
+	}
+	if len(ready) == 0 && len(running) != 0 {
+		logger.Warningf("no ready etcd pods, falling back to the %d running ones", len(running))
+		return running
+	}
+	return ready
+}
+
+// etcdClientFromService returns an etcd client which reaches the cluster through its client service,
+// and the revision of the cluster. The service picks the member, so the revision is read with
+// a linearizable request: the member has applied every change committed before the backup.
+// The client keeps its connection to that member, which the snapshot is then taken from.
+func (bm *BackupManager) etcdClientFromService(ctx context.Context) (*clientv3.Client, int64, error) {
+	url := bm.serviceClientURL()
+	etcdcli, err := bm.newEtcdClient(url)
+	if err != nil {
+		return nil, 0, fmt.Errorf("create etcd client failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	resp, err := etcdcli.Get(ctx, "/", clientv3.WithCountOnly())
+	cancel()
+	if err != nil {
+		etcdcli.Close()
+		return nil, 0, fmt.Errorf("failed to get revision through service (%s): %v", url, err)
+	}
+	bm.getLogger().WithFields(logrus.Fields{"endpoint": url, "revision": resp.Header.Revision}).Info("got cluster revision through service")
+	return etcdcli, resp.Header.Revision, nil
+}
+
+// etcdClientFromMemberList discovers the members with the etcd member list through the client service of
+// the cluster instead of the pod list, and returns an etcd client of the member with max revision and its revision.
+func (bm *BackupManager) etcdClientFromMemberList(ctx context.Context) (*clientv3.Client, int64, error) {
+	url := bm.serviceClientURL()
+	resp, err := bm.listMembers(ctx, url)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list members through service (%s): %v", url, err)
+	}
+	getRev := func(ctx context.Context, url string) (int64, error) {
+		return getEndpointRevision(ctx, url, bm.tlsConfig(), bm.credentials)
+	}
+	ep, rev, err := endpointWithMaxRev(ctx, bm.getLogger(), resp.Members, defaultRevisionCheckConcurrency, getRev)
+	if err != nil {
+		return nil, 0, fmt.Errorf("no reachable member: %v", err)
+	}
+	etcdcli, err := bm.newEtcdClient(ep)
 	if err != nil {
 		return nil, 0, fmt.Errorf("create etcd client failed: %v", err)
 	}
 	return etcdcli, rev, nil
 }
 
-func getMemberWithMaxRev(pods []*v1.Pod, tc *tls.Config) (*etcdutil.Member, int64) {
-	var member *etcdutil.Member
-	maxRev := int64(0)
-	for _, pod := range pods {
-		m := &etcdutil.Member{
-			Name:         pod.Name,
-			Namespace:    pod.Namespace,
-			SecureClient: tc != nil,
+// listMembers lists the etcd members through the given client URL.
+func (bm *BackupManager) listMembers(ctx context.Context, url string) (*clientv3.MemberListResponse, error) {
+	etcdcli, err := bm.newEtcdClient(url)
+	if err != nil {
+		return nil, fmt.Errorf("create etcd client failed: %v", err)
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	defer cancel()
+	return etcdcli.MemberList(ctx)
+}
+
+// endpointWithMaxRev checks the revision of members at their first client URL with getRev concurrently, with at
+// most concurrency checks in flight, and returns the client URL of the member with max revision and its revision.
+// If several members have the max revision, the one that comes first in members is returned.
+// The checks are given revisionProbeTimeout. The members whose revision can't be checked are skipped,
+// and it fails with their memberErrors if no member is left.
+func endpointWithMaxRev(ctx context.Context, logger *logrus.Entry, members []*etcdserverpb.Member, concurrency int, getRev func(context.Context, string) (int64, error)) (string, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, revisionProbeTimeout)
+	defer cancel()
+
+	type result struct {
+		rev int64
+		err error
+	}
+	results := make([]result, len(members))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, m := range members {
+		if len(m.ClientURLs) == 0 {
+			results[i].err = errors.New("member is not started")
+			continue
 		}
-		cfg := clientv3.Config{
-			Endpoints:   []string{m.ClientURL()},
-			DialTimeout: constants.DefaultDialTimeout,
-			TLS:         tc,
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i].err = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			results[i].rev, results[i].err = getRev(ctx, url)
+		}(i, m.ClientURLs[0])
+	}
+	wg.Wait()
+
+	var (
+		ep     string
+		maxRev int64
+	)
+	errs := make(memberErrors)
+	for i, r := range results {
+		name := members[i].Name
+		if len(name) == 0 {
+			// the member is not started, so it has no name yet.
+			name = fmt.Sprintf("%x", members[i].ID)
 		}
-		etcdcli, err := clientv3.New(cfg)
-		if err != nil {
-			logrus.Warningf("failed to create etcd client for pod (%v): %v", pod.Name, err)
+		if r.err != nil {
+			errs[name] = r.err
+			logger.WithError(r.err).WithField("member", name).Warning("getMaxRev: failed to get member revision")
 			continue
 		}
-		defer etcdcli.Close()
+		logger.WithFields(logrus.Fields{"member": name, "revision": r.rev}).Info("getMaxRev: got member revision")
+		if len(ep) == 0 || r.rev > maxRev {
+			ep, maxRev = members[i].ClientURLs[0], r.rev
+		}
+	}
+	if len(ep) == 0 {
+		return "", 0, errs
+	}
+	return ep, maxRev, nil
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
-		resp, err := etcdcli.Get(ctx, "/", clientv3.WithSerializable())
-		cancel()
+// serviceClientURL returns the client URL of the client service of the cluster.
+func (bm *BackupManager) serviceClientURL() string {
+	name := bm.serviceName
+	if len(name) == 0 {
+		name = k8sutil.ClientServiceName(bm.clusterName)
+	}
+	scheme := "http"
+	if bm.tlsConfig() != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s.%s.svc:%d", scheme, name, bm.namespace, k8sutil.EtcdClientPort)
+}
+
+// getMemberWithMaxRev checks the revision of the members of the given pods with getRev concurrently,
+// with at most concurrency checks in flight, and returns the member with the maximum revision.
+// If several members have the maximum revision, the one that comes first in pods is returned.
+// The members whose revision can't be checked are skipped, and logged to logger.
+func getMemberWithMaxRev(ctx context.Context, logger *logrus.Entry, pods []*v1.Pod, concurrency int, getRev func(context.Context, *v1.Pod) (*etcdutil.Member, int64, error)) (*etcdutil.Member, int64) {
+	revs, _ := getMemberRevisions(ctx, logger, pods, concurrency, getRev)
+	return memberWithMaxRev(revs)
+}
+
+// memberRevision is the revision of the member running in pod.
+type memberRevision struct {
+	pod    *v1.Pod
+	member *etcdutil.Member
+	rev    int64
+}
+
+// getMemberRevisions returns the revisions of the reachable members running in pods, in the order of pods.
+// At most concurrency members are queried at a time, and the members which don't answer within
+// revisionProbeTimeout are given up on, so that a hung member can't stall the probe.
+// The error, if not nil, is the memberErrors of the members whose revision couldn't be checked.
+func getMemberRevisions(ctx context.Context, logger *logrus.Entry, pods []*v1.Pod, concurrency int, getRev func(context.Context, *v1.Pod) (*etcdutil.Member, int64, error)) ([]memberRevision, error) {
+	if concurrency <= 0 {
+		concurrency = defaultRevisionCheckConcurrency
+	}
+	ctx, cancel := context.WithTimeout(ctx, revisionProbeTimeout)
+	defer cancel()
+
+	type result struct {
+		idx int
+		memberRevision
+		err error
+	}
+	sem := make(chan struct{}, concurrency)
+	// results is large enough for the checks given up on to finish, and close their clients, without a receiver.
+	results := make(chan result, len(pods))
+	for i, pod := range pods {
+		go func(i int, pod *v1.Pod) {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results <- result{idx: i, err: ctx.Err()}
+				return
+			}
+			defer func() { <-sem }()
+
+			m, rev, err := getRev(ctx, pod)
+			if err != nil {
+				results <- result{idx: i, err: err}
+				return
+			}
+			logger.WithFields(logrus.Fields{"member": m.Name, "revision": rev}).Info("getMaxRev: got member revision")
+			results <- result{idx: i, memberRevision: memberRevision{pod: pod, member: m, rev: rev}}
+		}(i, pod)
+	}
+
+	byPod := make([]memberRevision, len(pods))
+	answered := make([]bool, len(pods))
+	errs := make(memberErrors)
+collect:
+	for range pods {
+		select {
+		case r := <-results:
+			answered[r.idx] = true
+			if r.err != nil {
+				errs[pods[r.idx].Name] = r.err
+				continue
+			}
+			byPod[r.idx] = r.memberRevision
+		case <-ctx.Done():
+			for i, pod := range pods {
+				if !answered[i] {
+					errs[pod.Name] = fmt.Errorf("no answer: %v", ctx.Err())
+				}
+			}
+			break collect
+		}
+	}
+	var revs []memberRevision
+	for _, r := range byPod {
+		if r.member != nil {
+			revs = append(revs, r)
+		}
+	}
+	if len(errs) == 0 {
+		return revs, nil
+	}
+	for name, err := range errs {
+		logger.WithError(err).WithField("pod", name).Warning("getMaxRev: failed to get member revision")
+	}
+	return revs, errs
+}
+
+// memberErrors are the errors of the members whose revision couldn't be checked, by pod name.
+type memberErrors map[string]error
+
+func (me memberErrors) Error() string {
+	names := make([]string, 0, len(me))
+	for name := range me {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, me[name]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// memberWithMaxRev returns the member with max revision among revs, the first one if several tie,
+// and its revision. It returns a nil member if revs is empty.
+func memberWithMaxRev(revs []memberRevision) (*etcdutil.Member, int64) {
+	var (
+		member *etcdutil.Member
+		maxRev = int64(0)
+	)
+	for _, r := range revs {
+		if member == nil || r.rev > maxRev {
+			maxRev, member = r.rev, r.member
+		}
+	}
+	return member, maxRev
+}
+
+// followerWithMaxRev returns a member with max revision among revs and its revision, like memberWithMaxRev,
+// but prefers the first follower to the leader, so that the snapshot spares the leader, which serves the writes.
+// The leader is returned only if no follower has the max revision. It returns a nil member if revs is empty.
+func followerWithMaxRev(revs []memberRevision, isLeader func(*etcdutil.Member) bool) (*etcdutil.Member, int64) {
+	member, maxRev := memberWithMaxRev(revs)
+	if member == nil || !isLeader(member) {
+		return member, maxRev
+	}
+	for _, r := range revs {
+		if r.rev == maxRev && !isLeader(r.member) {
+			return r.member, maxRev
+		}
+	}
+	return member, maxRev
+}
+
+// preferredMember returns the follower of the highest backup priority among revs whose revision is within
+// maxLag of maxRev, so that the snapshot spares the leader. Among the followers of the same priority, the one
+// of the higher revision, then the first one, is preferred. It returns nil if no such follower is found.
+func preferredMember(ctx context.Context, logger *logrus.Entry, revs []memberRevision, maxRev, maxLag int64, isLeader func(context.Context, *etcdutil.Member) (bool, error)) *memberRevision {
+	var candidates []memberRevision
+	for _, r := range revs {
+		if k8sutil.GetMemberBackupPriority(r.pod) > 0 && maxRev-r.rev <= maxLag {
+			candidates = append(candidates, r)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		pi, pj := k8sutil.GetMemberBackupPriority(candidates[i].pod), k8sutil.GetMemberBackupPriority(candidates[j].pod)
+		if pi != pj {
+			return pi > pj
+		}
+		return candidates[i].rev > candidates[j].rev
+	})
+	for i := range candidates {
+		leader, err := isLeader(ctx, candidates[i].member)
 		if err != nil {
-			logrus.Warningf("getMaxRev: failed to get revision from member %s (%s)", m.Name, m.ClientURL())
+			logger.WithError(err).WithField("member", candidates[i].member.Name).Warning("failed to check whether the member is the leader")
 			continue
 		}
+		if !leader {
+			return &candidates[i]
+		}
+	}
+	return nil
+}
+
+// SetClientEndpoint has the BackupManager reach the members at the given scheme and client port, instead of
+// http or https with the client TLS and the etcd client port, e.g. where a proxy sidecar serves the clients of the
+// members on another port. An empty scheme keeps the default scheme. It fails if the port is not a valid port.
+func (bm *BackupManager) SetClientEndpoint(scheme string, port int) error {
+	if err := etcdutil.ValidateClientEndpoint(scheme, port); err != nil {
+		return err
+	}
+	bm.clientScheme, bm.clientPort = scheme, port
+	return nil
+}
+
+// podMember returns the etcd member running in the given pod.
+func (bm *BackupManager) podMember(pod *v1.Pod) *etcdutil.Member {
+	return &etcdutil.Member{
+		Name:         pod.Name,
+		Namespace:    pod.Namespace,
+		SecureClient: bm.tlsConfig() != nil,
+		ClientScheme: bm.clientScheme,
+		ClientPort:   bm.clientPort,
+	}
+}
+
+// getMemberStatus returns the status of the given member.
+// Each call authenticates with creds if not nil, so the auth token of its client can't have expired.
+func getMemberStatus(ctx context.Context, m *etcdutil.Member, tc *tls.Config, creds *EtcdCredentials) (*etcdutil.Member, *clientv3.StatusResponse, error) {
+	etcdcli, err := createEtcdClient(m.ClientURL(), tc, creds)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create etcd client for pod (%v): %v", m.Name, err)
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	resp, err := etcdcli.Status(ctx, m.ClientURL())
+	cancel()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get status of member %s (%s): %v", m.Name, m.ClientURL(), err)
+	}
+	return m, resp, nil
+}
+
+// getEndpointRevision returns the kv store revision of the etcd member at the given client URL.
+// Each call authenticates with creds if not nil, so the auth token of its client can't have expired.
+func getEndpointRevision(ctx context.Context, url string, tc *tls.Config, creds *EtcdCredentials) (int64, error) {
+	etcdcli, err := createEtcdClient(url, tc, creds)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create etcd client for %s: %v", url, err)
+	}
+	defer etcdcli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	resp, err := etcdcli.Get(ctx, "/", clientv3.WithSerializable())
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get revision from %s: %v", url, err)
+	}
+	return resp.Header.Revision, nil
+}
 
-		logrus.Infof("getMaxRev: member %s revision (%d)", m.Name, resp.Header.Revision)
-		if resp.Header.Revision > maxRev {
-			maxRev = resp.Header.Revision
-			member = m
+// getLatestBackupRev is latestBackupRev, retried as configured by RetryOnStorageError.
+// The caller decides whether to give up or try again later on error.
+func (b *BackupManager) getLatestBackupRev(ctx context.Context) (int64, error) {
+	var rev int64
+	err := b.retryStorage(ctx, func() error {
+		var rerr error
+		rev, rerr = b.latestBackupRev()
+		return rerr
+	})
+	return rev, err
+}
+
+// latestBackupRev returns the revision of the latest backup in the backend, including the deltas
+// saved on top of it if incremental backups are enabled, or 0 if there is none or it does not match its checksum.
+func (b *BackupManager) latestBackupRev() (int64, error) {
+	name, err := b.be.GetLatest()
+	if err != nil {
+		return 0, err
+	}
+	if len(name) == 0 {
+		return 0, nil
+	}
+	// An unverified backup is not trusted; returning 0 makes the next SaveSnap take a new one.
+	if err = b.VerifyBackup(name); err != nil {
+		b.getLogger().WithError(err).WithField("name", name).Warning("latest backup is not trusted")
+		return 0, nil
+	}
+	rev := util.MustParseRevision(name)
+	if b.incremental == nil {
+		return rev, nil
+	}
+	// the next delta continues from the latest delta saved on top of the backup.
+	deltas, err := b.be.ListDeltas(rev)
+	if err != nil {
+		return 0, err
+	}
+	if len(deltas) != 0 {
+		rev = util.MustParseRevision(deltas[len(deltas)-1])
+	}
+	return rev, nil
+}
+
+// getLatestBackupWithPrefix returns the path and the revision of the latest backup that the writer
+// stored under the given prefix, or an empty path and 0 if there is none.
+// The backup is looked up in idx, or listed if idx is nil.
+func (bm *BackupManager) getLatestBackupWithPrefix(prefix string, idx *backupapi.BackupIndex) (string, int64, error) {
+	var names []string
+	if idx != nil {
+		names = idx.Names()
+	} else {
+		var err error
+		if names, err = listBackupsWithPrefix(bm.bw, prefix); err != nil {
+			return "", 0, err
 		}
 	}
-	return member, maxRev
+	if len(names) == 0 {
+		return "", 0, nil
+	}
+	name := names[len(names)-1]
+	return path.Join(prefix, name), util.MustParseRevision(name), nil
 }
 
-func (b *BackupManager) getLatestBackupRev() int64 {
-	// If there is any error, we just exit backup sidecar because we can't serve the backup any way.
+// VerifyLatest returns true if the latest backup matches the checksum saved with it.
+func (b *BackupManager) VerifyLatest() bool {
 	name, err := b.be.GetLatest()
 	if err != nil {
-		logrus.Fatal(err)
+		b.getLogger().WithError(err).Error("failed to get latest backup")
+		return false
 	}
 	if len(name) == 0 {
-		return 0
+		return false
+	}
+	if err = b.VerifyBackup(name); err != nil {
+		b.getLogger().WithError(err).WithField("name", name).Warning("failed to verify backup")
+		return false
 	}
-	return util.MustParseRevision(name)
+	return true
 }
 
-func createEtcdClient(url string, tlsConfig *tls.Config) (*clientv3.Client, error) {
+// VerifyBackup checks the backup with the given name against the SHA-256 checksum saved with it.
+func (b *BackupManager) VerifyBackup(name string) error {
+	crc, err := b.be.Open(util.MakeChecksumName(name))
+	if err != nil {
+		return fmt.Errorf("failed to open checksum: %v", err)
+	}
+	want, err := ioutil.ReadAll(crc)
+	crc.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read checksum: %v", err)
+	}
+
+	rc, err := b.be.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer rc.Close()
+	// the checksum is of the snapshot before compression.
+	dr, err := compression.NewDecompressReader(name, rc)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err = io.Copy(h, dr); err != nil {
+		return fmt.Errorf("failed to read backup: %v", err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != strings.TrimSpace(string(want)) {
+		return fmt.Errorf("checksum mismatch: saved %s, computed %s", strings.TrimSpace(string(want)), got)
+	}
+	return nil
+}
+
+func createEtcdClient(url string, tlsConfig *tls.Config, creds *EtcdCredentials) (*clientv3.Client, error) {
 	cfg := clientv3.Config{
 		Endpoints:   []string{url},
 		DialTimeout: constants.DefaultDialTimeout,
 		TLS:         tlsConfig,
 	}
+	if creds != nil {
+		cfg.Username = creds.Username
+		cfg.Password = creds.Password
+	}
 	return clientv3.New(cfg)
 }
@@ -16,16 +16,42 @@ package backup
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
 	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 const (
@@ -42,7 +68,27 @@ func (c *fakeMaintenanceClient) Snapshot(ctx context.Context) (io.ReadCloser, er
 }
 
 func (c *fakeMaintenanceClient) Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error) {
-	return &clientv3.StatusResponse{Version: testEtcdVersion}, nil
+	// the snapshots are served by member 1a, a follower of member 2b.
+	return &clientv3.StatusResponse{Header: &etcdserverpb.ResponseHeader{MemberId: 0x1a}, Version: testEtcdVersion, Leader: 0x2b}, nil
+}
+
+// ctxMaintenanceClient fails the requests whose context is done.
+type ctxMaintenanceClient struct {
+	fakeMaintenanceClient
+}
+
+func (c *ctxMaintenanceClient) Snapshot(ctx context.Context) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.fakeMaintenanceClient.Snapshot(ctx)
+}
+
+func (c *ctxMaintenanceClient) Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.fakeMaintenanceClient.Status(ctx, endpoint)
 }
 
 // TestWriteSnap ensures BackupManager.WriteSnap can write snapshot to
@@ -58,7 +104,7 @@ func TestWriteSnap(t *testing.T) {
 		be: backend.NewFileBackend(d),
 	}
 
-	bs, err := bm.writeSnap(&fakeMaintenanceClient{}, "", rev)
+	bs, err := bm.writeSnap(context.Background(), &fakeMaintenanceClient{}, "", rev)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -68,6 +114,12 @@ func TestWriteSnap(t *testing.T) {
 	if bs.Revision != rev {
 		t.Fatalf("expect Version %v, got %v", rev, bs.Version)
 	}
+	if sum := sha256.Sum256([]byte(testData)); bs.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("expect SHA256 %x, got %v", sum, bs.SHA256)
+	}
+	if bs.MemberID != "1a" || bs.FromLeader {
+		t.Fatalf("expect the snapshot from follower 1a, got member %q (leader: %v)", bs.MemberID, bs.FromLeader)
+	}
 
 	lbn, err := bm.be.GetLatest()
 	if err != nil {
@@ -90,6 +142,185 @@ func TestWriteSnap(t *testing.T) {
 	}
 }
 
+// TestVerifyLatest ensures a backup written by BackupManager.writeSnap is verified
+// by its checksum and a corrupted backup is not trusted.
+func TestVerifyLatest(t *testing.T) {
+	var rev int64 = 1
+	bn := util.MakeBackupName(testEtcdVersion, rev)
+	d, err := makeFileBackendDir(bn)
+	if err != nil {
+		t.Fatalf("failed to make file backend dir: (%v)", err)
+	}
+	defer os.RemoveAll(d)
+	bm := &BackupManager{
+		be: backend.NewFileBackend(d),
+	}
+
+	if bm.VerifyLatest() {
+		t.Fatal("expect no backup to verify")
+	}
+	if _, err = bm.writeSnap(context.Background(), &fakeMaintenanceClient{}, "", rev); err != nil {
+		t.Fatal(err)
+	}
+	if !bm.VerifyLatest() {
+		t.Fatal("expect latest backup to be verified")
+	}
+	if got, err := bm.getLatestBackupRev(context.Background()); err != nil || got != rev {
+		t.Fatalf("expect latest backup rev %v, got %v (%v)", rev, got, err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(d, bn), []byte("corrupted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if bm.VerifyLatest() {
+		t.Fatal("expect corrupted backup to fail verification")
+	}
+	if got, err := bm.getLatestBackupRev(context.Background()); err != nil || got != 0 {
+		t.Fatalf("expect latest backup rev 0 for corrupted backup, got %v (%v)", got, err)
+	}
+}
+
+// TestWriteSnapCorruptStream ensures a snapshot received corrupt fails the backup and is not kept.
+func TestWriteSnapCorruptStream(t *testing.T) {
+	d, err := makeFileBackendDir(util.MakeBackupName(testEtcdVersion, 1))
+	if err != nil {
+		t.Fatalf("failed to make file backend dir: (%v)", err)
+	}
+	defer os.RemoveAll(d)
+	bm := &BackupManager{
+		be:                  backend.NewFileBackend(d),
+		checkSnapshotStream: true,
+	}
+
+	// testData is not a bolt database.
+	if _, err = bm.writeSnap(context.Background(), &fakeMaintenanceClient{}, "", 1); err == nil {
+		t.Fatal("expect a corrupt snapshot to fail the backup")
+	}
+	if name, err := bm.be.GetLatest(); err != nil || len(name) != 0 {
+		t.Errorf("expect no backup to be kept, got (%s) (%v)", name, err)
+	}
+}
+
+// brokenStreamMaintenanceClient fails the snapshot stream midway, as when the member restarts.
+type brokenStreamMaintenanceClient struct {
+	fakeMaintenanceClient
+}
+
+func (c *brokenStreamMaintenanceClient) Snapshot(ctx context.Context) (io.ReadCloser, error) {
+	r := io.MultiReader(strings.NewReader(testData), iotest.TimeoutReader(strings.NewReader(testData)))
+	return ioutil.NopCloser(iotest.OneByteReader(r)), nil
+}
+
+// TestWriteSnapEtcdError ensures a snapshot which fails to be received is reported as an etcd failure,
+// so that it is retried from the member with max revision.
+func TestWriteSnapEtcdError(t *testing.T) {
+	d, err := makeFileBackendDir(util.MakeBackupName(testEtcdVersion, 1))
+	if err != nil {
+		t.Fatalf("failed to make file backend dir: (%v)", err)
+	}
+	defer os.RemoveAll(d)
+	bm := &BackupManager{be: backend.NewFileBackend(d)}
+
+	_, err = bm.writeSnap(context.Background(), &brokenStreamMaintenanceClient{}, "", 1)
+	if _, ok := err.(*etcdError); !ok {
+		t.Errorf("expect *etcdError, got %v", err)
+	}
+}
+
+// cancelingBackend cancels the backup once its snapshot is saved, before its checksum is.
+type cancelingBackend struct {
+	backend.Backend
+	cancel context.CancelFunc
+}
+
+func (cb *cancelingBackend) SaveChecksum(ctx context.Context, version string, rev int64, sum string) error {
+	cb.cancel()
+	return ctx.Err()
+}
+
+// TestWriteSnapCancelled ensures a backup cancelled after its snapshot is saved is deleted.
+func TestWriteSnapCancelled(t *testing.T) {
+	d, err := makeFileBackendDir(util.MakeBackupName(testEtcdVersion, 1))
+	if err != nil {
+		t.Fatalf("failed to make file backend dir: (%v)", err)
+	}
+	defer os.RemoveAll(d)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bm := &BackupManager{
+		be: &cancelingBackend{Backend: backend.NewFileBackend(d), cancel: cancel},
+	}
+
+	if _, err = bm.writeSnap(ctx, &fakeMaintenanceClient{}, "", 1); err == nil {
+		t.Fatal("expect a cancelled backup to fail")
+	}
+	if name, err := bm.be.GetLatest(); err != nil || len(name) != 0 {
+		t.Errorf("expect no backup to be kept, got (%s) (%v)", name, err)
+	}
+}
+
+// TestWriteSnapCompressed ensures a compressed backup is verified and served decompressed.
+func TestWriteSnapCompressed(t *testing.T) {
+	var rev int64 = 1
+	bn := util.MakeBackupName(testEtcdVersion, rev)
+	d, err := makeFileBackendDir(bn)
+	if err != nil {
+		t.Fatalf("failed to make file backend dir: (%v)", err)
+	}
+	defer os.RemoveAll(d)
+	bm := &BackupManager{
+		be:          backend.NewFileBackend(d),
+		compression: compression.Gzip,
+	}
+
+	bs, err := bm.writeSnap(context.Background(), &fakeMaintenanceClient{}, "", rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs.Size != util.ToMB(int64(len(testData))) || bs.CompressedSize == 0 {
+		t.Errorf("expect raw size %v and a compressed size, got %v and %v", util.ToMB(int64(len(testData))), bs.Size, bs.CompressedSize)
+	}
+	lbn, err := bm.be.GetLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bn + util.GzipFileExtension; lbn != want {
+		t.Fatalf("expect backup name %v, got %v", want, lbn)
+	}
+	if !bm.VerifyLatest() {
+		t.Fatal("expect compressed backup to be verified")
+	}
+
+	bsrv := NewBackupServer(bm.be)
+	for _, u := range []*url.URL{
+		backupapi.NewBackupURL("http", "ignore", "", -1),
+		backupapi.NewBackupURL("http", "ignore", testEtcdVersion, rev),
+	} {
+		rr := httptest.NewRecorder()
+		bsrv.ServeBackup(rr, &http.Request{Method: http.MethodGet, URL: u})
+		if rr.Code != http.StatusOK || rr.Body.String() != testData {
+			t.Errorf("%v: expect served backup %q, got (%d, %q)", u, testData, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestNewBackupManagerWithSnapshotTimeout(t *testing.T) {
+	bm := NewBackupManager(nil, "example", "default", nil, nil)
+	if bm.getSnapshotTimeout() != constants.DefaultSnapshotTimeout {
+		t.Errorf("expect default snapshot timeout %v, got %v", constants.DefaultSnapshotTimeout, bm.getSnapshotTimeout())
+	}
+
+	bm = NewBackupManagerWithSnapshotTimeout(nil, "example", "default", nil, nil, 10*time.Minute)
+	if bm.getSnapshotTimeout() != 10*time.Minute {
+		t.Errorf("expect snapshot timeout %v, got %v", 10*time.Minute, bm.getSnapshotTimeout())
+	}
+
+	bm = NewBackupManagerWithSnapshotTimeout(nil, "example", "default", nil, nil, 0)
+	if bm.getSnapshotTimeout() != constants.DefaultSnapshotTimeout {
+		t.Errorf("expect default snapshot timeout %v, got %v", constants.DefaultSnapshotTimeout, bm.getSnapshotTimeout())
+	}
+}
+
 func makeFileBackendDir(snap string) (string, error) {
 	d, err := ioutil.TempDir("", "backupdir")
 	if err != nil {
@@ -109,3 +340,531 @@ func makeFileBackendDir(snap string) (string, error) {
 	}
 	return d, nil
 }
+
+func TestGetLatestBackupWithPrefix(t *testing.T) {
+	bw := writer.NewFakeWriter()
+	bm := NewBackupManagerFromWriter(nil, bw, "example", "default", nil, BackupRetentionPolicy{}, "", 0)
+	prefix := "bucket/v1/default/example"
+
+	p, rev, err := bm.getLatestBackupWithPrefix(prefix, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 0 || rev != 0 {
+		t.Errorf("latest backup without backups = (%s, %d), want none", p, rev)
+	}
+
+	for _, p := range []string{
+		path.Join(prefix, util.MakeBackupName(testEtcdVersion, 1)),
+		path.Join(prefix, util.MakeBackupName(testEtcdVersion, 12)),
+		path.Join(prefix, util.MakeBackupName(testEtcdVersion, 3)),
+		path.Join(prefix+"2", util.MakeBackupName(testEtcdVersion, 20)),
+		path.Join(prefix, "nested", util.MakeBackupName(testEtcdVersion, 30)), // not directly under the prefix
+	} {
+		if _, err = bw.Write(context.Background(), p, bytes.NewBufferString(testData)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, rev, err = bm.getLatestBackupWithPrefix(prefix, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := path.Join(prefix, util.MakeBackupName(testEtcdVersion, 12)); p != want || rev != 12 {
+		t.Errorf("latest backup = (%s, %d), want (%s, 12)", p, rev, want)
+	}
+}
+
+// TestBackupCandidatePods ensures the ready pods are backed up, falling back to the running ones if none is ready.
+func TestBackupCandidatePods(t *testing.T) {
+	newPod := func(name string, phase v1.PodPhase, podReady, etcdReady bool) v1.Pod {
+		pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		pod.Status.Phase = phase
+		cond := v1.ConditionFalse
+		if podReady {
+			cond = v1.ConditionTrue
+		}
+		pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: cond}}
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{Name: "etcd", Ready: etcdReady}}
+		return pod
+	}
+
+	tests := []struct {
+		pods  []v1.Pod
+		wants []string
+	}{{
+		pods: []v1.Pod{
+			newPod("ready", v1.PodRunning, true, true),
+			newPod("crashlooping", v1.PodRunning, false, false),
+			newPod("etcd-not-ready", v1.PodRunning, true, false),
+			newPod("pending", v1.PodPending, false, false),
+			newPod("ready2", v1.PodRunning, true, true),
+		},
+		wants: []string{"ready", "ready2"},
+	}, {
+		// no ready pod: fall back to the running ones.
+		pods: []v1.Pod{
+			newPod("syncing", v1.PodRunning, false, false),
+			newPod("etcd-not-ready", v1.PodRunning, true, false),
+			newPod("pending", v1.PodPending, false, false),
+		},
+		wants: []string{"syncing", "etcd-not-ready"},
+	}, {
+		pods:  []v1.Pod{newPod("pending", v1.PodPending, false, false)},
+		wants: nil,
+	}}
+	for i, tt := range tests {
+		var names []string
+		for _, pod := range backupCandidatePods(pkgLogger, tt.pods) {
+			names = append(names, pod.Name)
+		}
+		if !reflect.DeepEqual(names, tt.wants) {
+			t.Errorf("#%d: candidate pods = %v, want %v", i, names, tt.wants)
+		}
+	}
+}
+
+// TestGetMemberWithMaxRev ensures the member with the maximum revision is found with at most
+// the given number of revision checks in flight, skipping the members that fail the check.
+func TestGetMemberWithMaxRev(t *testing.T) {
+	revs := map[string]int64{"m0": 3, "m1": 5, "m2": -1, "m3": 5, "m4": 2}
+	var pods []*v1.Pod
+	for _, name := range []string{"m0", "m1", "m2", "m3", "m4"} {
+		pods = append(pods, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+
+	const concurrency = 2
+	var inFlight, maxInFlight int32
+	getRev := func(ctx context.Context, pod *v1.Pod) (*etcdutil.Member, int64, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if revs[pod.Name] < 0 {
+			return nil, 0, errors.New("unreachable")
+		}
+		return &etcdutil.Member{Name: pod.Name}, revs[pod.Name], nil
+	}
+
+	m, rev := getMemberWithMaxRev(context.Background(), pkgLogger, pods, concurrency, getRev)
+	// m1 and m3 tie; the one that comes first wins.
+	if m == nil || m.Name != "m1" || rev != 5 {
+		t.Errorf("member with max rev = (%v, %d), want (m1, 5)", m, rev)
+	}
+	if maxInFlight > concurrency {
+		t.Errorf("revision checks in flight = %d, want at most %d", maxInFlight, concurrency)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if m, _ = getMemberWithMaxRev(ctx, pkgLogger, pods, 0, func(context.Context, *v1.Pod) (*etcdutil.Member, int64, error) {
+		return nil, 0, errors.New("unreachable")
+	}); m != nil {
+		t.Errorf("expect no member if every check fails, got %v", m)
+	}
+}
+
+// TestGetMemberRevisionsDeadline ensures a hung member doesn't stall the revision probe past its deadline,
+// and that the error tells which members failed.
+func TestGetMemberRevisionsDeadline(t *testing.T) {
+	defer func(d time.Duration) { revisionProbeTimeout = d }(revisionProbeTimeout)
+	revisionProbeTimeout = 50 * time.Millisecond
+
+	var pods []*v1.Pod
+	for _, name := range []string{"m0", "hung", "unreachable"} {
+		pods = append(pods, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	release := make(chan struct{})
+	defer close(release)
+	getRev := func(ctx context.Context, pod *v1.Pod) (*etcdutil.Member, int64, error) {
+		switch pod.Name {
+		case "hung":
+			// ignores ctx, like a blocking dial.
+			<-release
+			return nil, 0, errors.New("released")
+		case "unreachable":
+			return nil, 0, errors.New("connection refused")
+		}
+		return &etcdutil.Member{Name: pod.Name}, 7, nil
+	}
+
+	start := time.Now()
+	revs, err := getMemberRevisions(context.Background(), pkgLogger, pods, 0, getRev)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("revision probe took %v, want about %v", d, revisionProbeTimeout)
+	}
+	if len(revs) != 1 || revs[0].member.Name != "m0" || revs[0].rev != 7 {
+		t.Errorf("revisions = %+v, want m0 at 7", revs)
+	}
+	merrs, ok := err.(memberErrors)
+	if !ok {
+		t.Fatalf("err = %v, want memberErrors", err)
+	}
+	if len(merrs) != 2 || merrs["hung"] == nil || merrs["unreachable"] == nil {
+		t.Errorf("member errors = %v, want hung and unreachable", merrs)
+	}
+}
+
+// TestListMembers ensures the members of the running pods of the cluster are listed in order,
+// and reported unreachable with the cause if they don't answer in time.
+func TestListMembers(t *testing.T) {
+	defer func(d time.Duration) { revisionProbeTimeout = d }(revisionProbeTimeout)
+	revisionProbeTimeout = 50 * time.Millisecond
+
+	newPod := func(name, cluster string, phase v1.PodPhase) *v1.Pod {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: k8sutil.LabelsForCluster(cluster)}}
+		pod.Status.Phase = phase
+		return pod
+	}
+	kubecli := fake.NewSimpleClientset(
+		newPod("example-0000", "example", v1.PodRunning),
+		newPod("example-0001", "example", v1.PodPending),
+		newPod("example-0002", "example", v1.PodRunning),
+		newPod("other-0000", "other", v1.PodRunning),
+	)
+	bm := NewBackupManager(kubecli, "example", "default", nil, nil)
+
+	infos, err := bm.ListMembers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name)
+		if info.Reachable || info.Err == nil {
+			t.Errorf("member %s: reachable = %v, err = %v, want unreachable with the cause", info.Name, info.Reachable, info.Err)
+		}
+	}
+	sort.Strings(names)
+	if wnames := []string{"example-0000", "example-0002"}; !reflect.DeepEqual(names, wnames) {
+		t.Errorf("members = %v, want %v", names, wnames)
+	}
+}
+
+// TestPreferredMember ensures the follower of the highest backup priority within the revision lag is preferred.
+func TestPreferredMember(t *testing.T) {
+	newRev := func(name string, rev int64, priority string) memberRevision {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{}}}
+		if len(priority) != 0 {
+			pod.Annotations[k8sutil.MemberBackupPriorityAnnotation] = priority
+		}
+		return memberRevision{pod: pod, member: &etcdutil.Member{Name: name}, rev: rev}
+	}
+	isLeader := func(ctx context.Context, m *etcdutil.Member) (bool, error) {
+		switch m.Name {
+		case "leader":
+			return true, nil
+		case "unreachable":
+			return false, errors.New("unreachable")
+		}
+		return false, nil
+	}
+	tests := []struct {
+		revs   []memberRevision
+		maxLag int64
+		want   string
+	}{
+		// no priority: the member with max revision is kept.
+		{revs: []memberRevision{newRev("leader", 10, ""), newRev("f1", 10, "")}},
+		// an invalid or non-positive priority is no priority.
+		{revs: []memberRevision{newRev("leader", 10, ""), newRev("f1", 10, "x"), newRev("f2", 10, "0")}},
+		{revs: []memberRevision{newRev("leader", 10, "1"), newRev("f1", 10, "1")}, want: "f1"},
+		// the leader is never preferred.
+		{revs: []memberRevision{newRev("leader", 10, "2"), newRev("f1", 10, "1")}, want: "f1"},
+		{revs: []memberRevision{newRev("leader", 10, "1"), newRev("f1", 10, "1"), newRev("f2", 10, "2")}, want: "f2"},
+		// a lagging follower is only preferred within maxLag.
+		{revs: []memberRevision{newRev("leader", 10, ""), newRev("f1", 8, "1")}},
+		{revs: []memberRevision{newRev("leader", 10, ""), newRev("f1", 8, "1")}, maxLag: 2, want: "f1"},
+		// among the same priority, the higher revision wins.
+		{revs: []memberRevision{newRev("leader", 10, ""), newRev("f1", 8, "1"), newRev("f2", 9, "1")}, maxLag: 5, want: "f2"},
+		{revs: []memberRevision{newRev("leader", 10, ""), newRev("unreachable", 10, "2"), newRev("f1", 10, "1")}, want: "f1"},
+	}
+	for i, tt := range tests {
+		got := preferredMember(context.Background(), pkgLogger, tt.revs, 10, tt.maxLag, isLeader)
+		name := ""
+		if got != nil {
+			name = got.member.Name
+		}
+		if name != tt.want {
+			t.Errorf("#%d: preferred member = %q, want %q", i, name, tt.want)
+		}
+	}
+}
+
+func TestFollowerWithMaxRev(t *testing.T) {
+	newRev := func(name string, rev int64) memberRevision {
+		return memberRevision{member: &etcdutil.Member{Name: name}, rev: rev}
+	}
+	isLeader := func(m *etcdutil.Member) bool { return m.Name == "leader" }
+	tests := []struct {
+		revs    []memberRevision
+		want    string
+		wantRev int64
+	}{
+		{},
+		// a follower at the max revision is preferred to the leader.
+		{revs: []memberRevision{newRev("leader", 10), newRev("f1", 10), newRev("f2", 10)}, want: "f1", wantRev: 10},
+		// the leader is the only member at the max revision.
+		{revs: []memberRevision{newRev("f1", 9), newRev("leader", 10), newRev("f2", 8)}, want: "leader", wantRev: 10},
+		{revs: []memberRevision{newRev("f1", 9), newRev("f2", 10), newRev("leader", 10)}, want: "f2", wantRev: 10},
+		{revs: []memberRevision{newRev("leader", 10)}, want: "leader", wantRev: 10},
+	}
+	for i, tt := range tests {
+		m, rev := followerWithMaxRev(tt.revs, isLeader)
+		name := ""
+		if m != nil {
+			name = m.Name
+		}
+		if name != tt.want || rev != tt.wantRev {
+			t.Errorf("#%d: member with max rev = (%q, %d), want (%q, %d)", i, name, rev, tt.want, tt.wantRev)
+		}
+	}
+}
+
+type failingDeleteWriter struct {
+	*writer.FakeWriter
+}
+
+func (fw *failingDeleteWriter) Delete(path string) error {
+	return errors.New("failed")
+}
+
+func TestPurgeBackupsWithPrefix(t *testing.T) {
+	fw := writer.NewFakeWriter()
+	bm := NewBackupManagerFromWriter(nil, fw, "example", "default", nil, BackupRetentionPolicy{}, "", 0)
+	prefix := "bucket/v1/default/example"
+	other := path.Join(prefix+"2", util.MakeBackupName(testEtcdVersion, 1))
+	// the files under the prefix which are not backups of the cluster are never purged.
+	foreign := []string{path.Join(prefix, "README"), path.Join(prefix, "3.1.10_zz_etcd.backup")}
+	var paths []string
+	for rev := int64(1); rev <= 4; rev++ {
+		paths = append(paths, path.Join(prefix, util.MakeBackupName(testEtcdVersion, rev)))
+	}
+	for _, p := range append(paths, other) {
+		if _, err := fw.Write(context.Background(), p, bytes.NewBufferString(testData)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// failing to delete is not fatal and deletes nothing.
+	NewBackupManagerFromWriter(nil, &failingDeleteWriter{fw}, "example", "default", nil, BackupRetentionPolicy{}, "", 0).purgeBackupsWithPrefix(context.Background(), prefix, nil, 2)
+	got, err := fw.List(prefix + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, paths) {
+		t.Errorf("backups after failed purge = %v, want %v", got, paths)
+	}
+
+	sumPath := util.MakeChecksumName(paths[0])
+	for _, p := range append(foreign, sumPath) {
+		if _, err = fw.Write(context.Background(), p, bytes.NewBufferString("sum")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bm.purgeBackupsWithPrefix(context.Background(), prefix, nil, 2)
+	got, err = fw.List(prefix + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]string(nil), paths[2:]...), foreign...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("backups after purge = %v, want %v", got, want)
+	}
+	if _, ok := fw.Get(other); !ok {
+		t.Errorf("backup of another cluster (%s) is purged", other)
+	}
+	for _, p := range foreign {
+		if _, ok := fw.Get(p); !ok {
+			t.Errorf("foreign file (%s) is purged", p)
+		}
+	}
+	if _, ok := fw.Get(sumPath); ok {
+		t.Errorf("checksum (%s) of a purged backup is kept", sumPath)
+	}
+}
+
+// TestPurgeBackupsOlderThanWithPrefix ensures the backups older than the max age are purged
+// except the latest one, which is kept however old it is.
+func TestPurgeBackupsOlderThanWithPrefix(t *testing.T) {
+	fw := writer.NewFakeWriter()
+	bm := NewBackupManagerFromWriter(nil, fw, "example", "default", nil, BackupRetentionPolicy{}, "", 0)
+	prefix := "bucket/v1/default/example"
+	other := path.Join(prefix+"2", util.MakeBackupName(testEtcdVersion, 1))
+	old := time.Now().Add(-31 * 24 * time.Hour)
+	var paths []string
+	for rev := int64(1); rev <= 3; rev++ {
+		paths = append(paths, path.Join(prefix, util.MakeBackupName(testEtcdVersion, rev)))
+	}
+	for _, p := range append(paths, other) {
+		if _, err := fw.Write(context.Background(), p, bytes.NewBufferString(testData)); err != nil {
+			t.Fatal(err)
+		}
+		fw.SetModTime(p, old)
+	}
+	// the second backup is recent.
+	fw.SetModTime(paths[1], time.Now())
+
+	bm.purgeBackupsOlderThanWithPrefix(context.Background(), prefix, nil, 30*24*time.Hour)
+	got, err := fw.List(prefix + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := paths[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("backups after purge = %v, want %v", got, want)
+	}
+	if _, ok := fw.Get(other); !ok {
+		t.Errorf("backup of another cluster (%s) is purged", other)
+	}
+}
+
+// TestWriteSnapCanceled ensures no backup is saved once the parent context is canceled.
+func TestWriteSnapCanceled(t *testing.T) {
+	d, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	bm := &BackupManager{
+		be: backend.NewFileBackend(d),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = bm.writeSnap(ctx, &ctxMaintenanceClient{}, "", 1); err == nil {
+		t.Fatal("expect writeSnap to fail with a canceled context")
+	}
+	name, err := bm.be.GetLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(name) != 0 {
+		t.Errorf("expect no backup, got %s", name)
+	}
+}
+
+func TestBackupManagerLogFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.Out = &buf
+	l.Formatter = &logrus.JSONFormatter{}
+
+	fw := writer.NewFakeWriter()
+	prefix := "bucket/default/example"
+	for rev := int64(1); rev <= 2; rev++ {
+		if _, err := fw.Write(context.Background(), path.Join(prefix, util.MakeBackupName(testEtcdVersion, rev)), strings.NewReader("snap")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bm := NewBackupManagerWithLogger(nil, "example", "default", nil, nil, logrus.NewEntry(l))
+	bm.bw = &failingDeleteWriter{fw}
+	bm.purgeBackupsWithPrefix(context.Background(), prefix, nil, 1)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expect a JSON log entry, got %q: %v", buf.String(), err)
+	}
+	for k, want := range map[string]string{"cluster": "example", "namespace": "default", "error": "failed", "msg": "fail to delete backup"} {
+		if entry[k] != want {
+			t.Errorf("log field %s = %v, want %s", k, entry[k], want)
+		}
+	}
+}
+
+// TestEndpointWithMaxRev ensures the member with max revision is picked from the etcd member list,
+// skipping the members that are not started or not reachable.
+func TestEndpointWithMaxRev(t *testing.T) {
+	members := []*etcdserverpb.Member{
+		{ID: 1, Name: "m0", ClientURLs: []string{"http://m0:2379"}},
+		{ID: 2, Name: "m1", ClientURLs: []string{"http://m1:2379", "http://10.0.0.1:2379"}},
+		{ID: 3}, // not started
+		{ID: 4, Name: "m3", ClientURLs: []string{"http://m3:2379"}},
+		{ID: 5, Name: "m4", ClientURLs: []string{"http://m4:2379"}},
+	}
+	revs := map[string]int64{"http://m0:2379": 3, "http://m1:2379": 5, "http://m3:2379": -1, "http://m4:2379": 5}
+	getRev := func(ctx context.Context, url string) (int64, error) {
+		if revs[url] < 0 {
+			return 0, errors.New("unreachable")
+		}
+		return revs[url], nil
+	}
+
+	ep, rev, err := endpointWithMaxRev(context.Background(), pkgLogger, members, 2, getRev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// m1 and m4 tie; the one that comes first wins.
+	if ep != "http://m1:2379" || rev != 5 {
+		t.Errorf("endpoint with max rev = (%s, %d), want (http://m1:2379, 5)", ep, rev)
+	}
+
+	_, _, err = endpointWithMaxRev(context.Background(), pkgLogger, members[2:4], 2, getRev)
+	merrs, ok := err.(memberErrors)
+	if !ok {
+		t.Fatalf("err = %v, want memberErrors", err)
+	}
+	if len(merrs) != 2 || merrs["3"] == nil || merrs["m3"] == nil {
+		t.Errorf("member errors = %v, want the not started member and m3", merrs)
+	}
+}
+
+func TestServiceClientURL(t *testing.T) {
+	tests := []struct {
+		serviceName string
+		tc          *tls.Config
+		want        string
+	}{
+		{want: "http://example-client.default.svc:2379"},
+		{serviceName: "etcd-lb", want: "http://etcd-lb.default.svc:2379"},
+		{tc: &tls.Config{}, want: "https://example-client.default.svc:2379"},
+	}
+	for i, tt := range tests {
+		bm := &BackupManager{clusterName: "example", namespace: "default", serviceName: tt.serviceName, etcdTLSConfig: tt.tc}
+		if got := bm.serviceClientURL(); got != tt.want {
+			t.Errorf("#%d: serviceClientURL() = %s, want %s", i, got, tt.want)
+		}
+	}
+}
+
+func TestPodMemberClientEndpoint(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "example-0000", Namespace: "default"}}
+	tests := []struct {
+		scheme string
+		port   int
+		tc     *tls.Config
+		want   string
+	}{
+		{want: "http://example-0000.example.default.svc:2379"},
+		{tc: &tls.Config{}, want: "https://example-0000.example.default.svc:2379"},
+		{port: 12379, want: "http://example-0000.example.default.svc:12379"},
+		{scheme: "https", port: 2379, want: "https://example-0000.example.default.svc:2379"},
+		{scheme: "http", port: 8080, tc: &tls.Config{}, want: "http://example-0000.example.default.svc:8080"},
+	}
+	for i, tt := range tests {
+		bm := &BackupManager{clusterName: "example", namespace: "default", etcdTLSConfig: tt.tc}
+		if tt.port != 0 {
+			if err := bm.SetClientEndpoint(tt.scheme, tt.port); err != nil {
+				t.Fatalf("#%d: %v", i, err)
+			}
+		}
+		if got := bm.podMember(pod).ClientURL(); got != tt.want {
+			t.Errorf("#%d: ClientURL() = %s, want %s", i, got, tt.want)
+		}
+	}
+
+	bm := &BackupManager{}
+	for _, ep := range []struct {
+		scheme string
+		port   int
+	}{{"", 0}, {"", -1}, {"", 65536}, {"tcp", 2379}} {
+		if err := bm.SetClientEndpoint(ep.scheme, ep.port); err == nil {
+			t.Errorf("SetClientEndpoint(%q, %d) succeeded, want error", ep.scheme, ep.port)
+		}
+	}
+}
@@ -19,10 +19,12 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"strconv"
 
 	"github.com/coreos/etcd-operator/pkg/backup/backend"
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
 	"github.com/coreos/etcd-operator/pkg/backup/util"
 
 	"github.com/sirupsen/logrus"
@@ -42,6 +44,7 @@ func NewBackupServer(backend backend.Backend) *BackupServer {
 // - For GET, it returns the headers of etcd version and revision, with backup data.
 //   For HEAD, it only returns the headers.
 // - It checks compatibility and fails any incompatible backup request
+// - If the backup name is given, it returns the backup of that name.
 // - If both etcd version and revision, it returns the specified backup.
 //   If etcd version and revision is not given, it returns the latest compatible backup.
 //   If etcd version is not given, it returns the latest backup.
@@ -51,10 +54,17 @@ func (bs *BackupServer) ServeBackup(w http.ResponseWriter, r *http.Request) {
 		err   error
 	)
 
+	name := r.FormValue(backupapi.HTTPQueryNameKey)
 	revision := r.FormValue(backupapi.HTTPQueryRevisionKey)
 	version := r.FormValue(backupapi.HTTPQueryVersionKey)
 
 	switch {
+	case len(name) != 0:
+		if path.Base(name) != name || !util.IsBackup(name) {
+			http.Error(w, fmt.Sprintf("invalid backup name (%s)", name), http.StatusBadRequest)
+			return
+		}
+		fname = name
 	case len(revision) != 0 && len(version) != 0:
 		revisioni, err := strconv.ParseInt(revision, 10, 64)
 		if err != nil {
@@ -80,8 +90,24 @@ func (bs *BackupServer) ServeBackup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rc, err := bs.backend.Open(fname)
+	if os.IsNotExist(err) && len(revision) != 0 {
+		// the backup may be saved compressed.
+		for _, c := range []string{compression.Gzip, compression.Zstd} {
+			if rc, err = bs.backend.Open(compression.MakeName(fname, c)); !os.IsNotExist(err) {
+				fname = compression.MakeName(fname, c)
+				break
+			}
+		}
+	}
+	if os.IsNotExist(err) && len(revision) != 0 {
+		// or under a name rendered from a template.
+		var n string
+		if n, err = bs.findBackup(version, revision); err == nil {
+			fname = n
+			rc, err = bs.backend.Open(fname)
+		}
+	}
 	if err != nil {
-		// TODO: define backend layer not found error
 		if os.IsNotExist(err) {
 			http.Error(w, "backup not found", http.StatusNotFound)
 			return
@@ -92,6 +118,13 @@ func (bs *BackupServer) ServeBackup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer rc.Close()
+	// the seed member restores from the snapshot as is.
+	dr, err := compression.NewDecompressReader(fname, rc)
+	if err != nil {
+		logrus.Errorf("fail to serve backup: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	serV, err := getMajorMinorVersionFromBackup(fname)
 	if err != nil {
@@ -122,8 +155,23 @@ func (bs *BackupServer) ServeBackup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = io.Copy(w, rc)
+	_, err = io.Copy(w, dr)
 	if err != nil {
 		logrus.Errorf("failed to write backup to %s: %v", r.RemoteAddr, err)
 	}
 }
+
+// findBackup returns the name of the backup of the given etcd version taken at the given decimal revision.
+// os.IsNotExist(err) is true if there is no such backup.
+func (bs *BackupServer) findBackup(version, revision string) (string, error) {
+	backups, err := bs.backend.List()
+	if err != nil {
+		return "", err
+	}
+	for _, b := range backups {
+		if b.Version == version && strconv.FormatInt(b.Revision, 10) == revision {
+			return b.Name, nil
+		}
+	}
+	return "", &os.PathError{Op: "open", Path: fmt.Sprintf("backup of etcd %s at revision %s", version, revision), Err: os.ErrNotExist}
+}
@@ -15,15 +15,30 @@
 package backup
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup/backend"
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/encryption"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+
+	"github.com/robfig/cron"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestRespHeaderHasVersionRevision(t *testing.T) {
@@ -86,6 +101,81 @@ func TestServeBackup(t *testing.T) {
 	}
 }
 
+func TestServeBackupByName(t *testing.T) {
+	d, err := setupBackupDir("3.0.15_0000000000000002_etcd.backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	tests := []struct {
+		name  string
+		httpC int
+	}{
+		{"3.0.15_0000000000000002_etcd.backup", http.StatusOK},
+		{"3.0.15_0000000000000003_etcd.backup", http.StatusNotFound},
+		{"../3.0.15_0000000000000002_etcd.backup", http.StatusBadRequest},
+		{"3.0.15_0000000000000002_etcd.backup.sha256", http.StatusBadRequest},
+	}
+
+	bs := &BackupServer{
+		backend: backend.NewFileBackend(d),
+	}
+	for i, tt := range tests {
+		u := backupapi.NewBackupURL("http", "ignore", "", -1)
+		q := u.Query()
+		q.Set(backupapi.HTTPQueryNameKey, tt.name)
+		u.RawQuery = q.Encode()
+		rr := httptest.NewRecorder()
+		bs.ServeBackup(rr, &http.Request{URL: u})
+
+		if rr.Code != tt.httpC {
+			t.Errorf("#%d: http code want = %d, get = %d", i, tt.httpC, rr.Code)
+		}
+		if tt.httpC == http.StatusOK {
+			if get := rr.Header().Get(HTTPHeaderRevision); get != "2" {
+				t.Errorf("#%d: revision want=2, get=%s", i, get)
+			}
+		}
+	}
+}
+
+// TestServeBackupByRevisionWithTemplatedName ensures a backup named from a template is served by its revision.
+func TestServeBackupByRevisionWithTemplatedName(t *testing.T) {
+	d, err := setupBackupDir("3.0.15_0000000000000002_example-20171102T030405Z_etcd.backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	tests := []struct {
+		version string
+		rev     int64
+		httpC   int
+	}{
+		{"3.0.15", 2, http.StatusOK},
+		{"3.0.15", 3, http.StatusNotFound},
+		{"3.0.14", 2, http.StatusNotFound},
+	}
+
+	bs := &BackupServer{
+		backend: backend.NewFileBackend(d),
+	}
+	for i, tt := range tests {
+		rr := httptest.NewRecorder()
+		bs.ServeBackup(rr, &http.Request{URL: backupapi.NewBackupURL("http", "ignore", tt.version, tt.rev)})
+
+		if rr.Code != tt.httpC {
+			t.Errorf("#%d: http code want = %d, get = %d", i, tt.httpC, rr.Code)
+		}
+		if tt.httpC == http.StatusOK {
+			if get := rr.Header().Get(HTTPHeaderRevision); get != "2" {
+				t.Errorf("#%d: revision want=2, get=%s", i, get)
+			}
+		}
+	}
+}
+
 func TestBackupVersionCompatiblity(t *testing.T) {
 	d, err := setupBackupDir("3.0.15_0000000000000002_etcd.backup")
 	if err != nil {
@@ -137,3 +227,365 @@ func setupBackupDir(snap string) (string, error) {
 	}
 	return d, nil
 }
+
+// TestRecordBackup ensures the status served while backups are recorded is consistent.
+// Run with -race to check the status is not read and written concurrently.
+func TestRecordBackup(t *testing.T) {
+	d, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	bc := &BackupController{backupManager: &BackupManager{be: backend.NewFileBackend(d)}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			rr := httptest.NewRecorder()
+			bc.serveStatus(rr, &http.Request{})
+			if rr.Code != http.StatusOK {
+				t.Errorf("status code = %d, want %d", rr.Code, http.StatusOK)
+			}
+		}
+	}()
+
+	if ack := bc.recordBackup(nil, nil); ack.err != nil || ack.status.Revision != 0 {
+		t.Errorf("ack without backups = %+v, want empty", ack)
+	}
+	if ack := bc.recordBackup(&backupapi.BackupStatus{Revision: 1}, nil); ack.status.Revision != 1 {
+		t.Errorf("ack revision = %d, want 1", ack.status.Revision)
+	}
+	if ack := bc.recordBackup(nil, errors.New("failed")); ack.err == nil || bc.lastBackupError != "failed" {
+		t.Errorf("ack = %+v, last backup error = %q, want the error", ack, bc.lastBackupError)
+	}
+	// a skipped backup acks the most recent backup and clears the error.
+	if ack := bc.recordBackup(nil, nil); ack.status.Revision != 1 || bc.lastBackupError != "" {
+		t.Errorf("ack revision = %d, last backup error = %q, want 1 and none", ack.status.Revision, bc.lastBackupError)
+	}
+	<-done
+}
+
+func TestNewSecretKeyProviders(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	kubecli := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup-keys", Namespace: "default"},
+		Data:       map[string][]byte{"old": oldKey, "new": newKey, "short": []byte("key")},
+	})
+
+	e := &api.BackupEncryption{SecretName: "backup-keys", SecretKey: "new", AcceptedSecretKeys: []string{"old"}}
+	kp, accepted, err := newSecretKeyProviders(kubecli, "default", e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kp.KeyID() != encryption.KeyFingerprint(newKey) {
+		t.Errorf("key ID = %s, want the fingerprint of the new key", kp.KeyID())
+	}
+	if len(accepted) != 1 || accepted[0].KeyID() != encryption.KeyFingerprint(oldKey) {
+		t.Errorf("expect the old key to be accepted, got %v", accepted)
+	}
+
+	for _, e := range []*api.BackupEncryption{
+		{SecretName: "missing", SecretKey: "new"},
+		{SecretName: "backup-keys", SecretKey: "missing"},
+		{SecretName: "backup-keys", SecretKey: "short"},
+		{SecretName: "backup-keys", SecretKey: "new", AcceptedSecretKeys: []string{"missing"}},
+	} {
+		if _, _, err = newSecretKeyProviders(kubecli, "default", e); err == nil {
+			t.Errorf("expect error for %+v", e)
+		}
+	}
+}
+
+func TestNewBackupSchedule(t *testing.T) {
+	now := time.Date(2017, 12, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		policy api.BackupPolicy
+		want   time.Time
+	}{
+		{policy: api.BackupPolicy{}, want: now.Add(constants.DefaultSnapshotInterval)},
+		{policy: api.BackupPolicy{BackupIntervalInSecond: 60}, want: now.Add(time.Minute)},
+		{policy: api.BackupPolicy{BackupSchedule: "0 2 * * *"}, want: time.Date(2017, 12, 2, 2, 0, 0, 0, time.UTC)},
+		{policy: api.BackupPolicy{BackupSchedule: "@hourly"}, want: time.Date(2017, 12, 1, 11, 0, 0, 0, time.UTC)},
+	}
+	for i, tt := range tests {
+		s, err := newBackupSchedule(&tt.policy)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if got := s.Next(now); !got.Equal(tt.want) {
+			t.Errorf("#%d: next backup at %v, want %v", i, got, tt.want)
+		}
+	}
+
+	if _, err := newBackupSchedule(&api.BackupPolicy{BackupSchedule: "0 25 * * *"}); err == nil {
+		t.Error("expect an invalid schedule to be rejected")
+	}
+}
+
+// TestServeHealth ensures the health endpoints report each check and fail if any check fails.
+func TestServeHealth(t *testing.T) {
+	d, err := ioutil.TempDir("", "backup-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	// the cluster has no pods, so it is not reachable, while the storage accepts writes.
+	bc := &BackupController{
+		backupManager: NewBackupManager(fake.NewSimpleClientset(), "example", "default", nil, backend.NewFileBackend(d)),
+	}
+
+	tests := []struct {
+		serve func(http.ResponseWriter, *http.Request)
+		want  map[string]string
+	}{
+		{serve: bc.serveHealthz, want: map[string]string{"etcd": backupapi.HealthCheckFailed}},
+		{serve: bc.serveReadyz, want: map[string]string{"etcd": backupapi.HealthCheckFailed, "storage": backupapi.HealthCheckOK}},
+	}
+	for i, tt := range tests {
+		rr := httptest.NewRecorder()
+		tt.serve(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("#%d: http code want = %d, get = %d", i, http.StatusServiceUnavailable, rr.Code)
+		}
+		var hs backupapi.HealthStatus
+		if err := json.NewDecoder(rr.Body).Decode(&hs); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if hs.Status != backupapi.HealthCheckFailed {
+			t.Errorf("#%d: status = %s, want %s", i, hs.Status, backupapi.HealthCheckFailed)
+		}
+		if len(hs.Checks) != len(tt.want) {
+			t.Errorf("#%d: checks = %v, want %v", i, hs.Checks, tt.want)
+		}
+		for name, status := range tt.want {
+			if c := hs.Checks[name]; c.Status != status || (status == backupapi.HealthCheckFailed) != (len(c.Error) != 0) {
+				t.Errorf("#%d: check %s = %+v, want status %s", i, name, c, status)
+			}
+		}
+	}
+}
+
+// TestServeBackups ensures the backup catalog lists the backups in the backend.
+func TestServeBackups(t *testing.T) {
+	d, err := ioutil.TempDir("", "backup-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	be := backend.NewFileBackend(d)
+	bc := &BackupController{
+		backupManager: NewBackupManager(fake.NewSimpleClientset(), "example", "default", nil, be),
+	}
+
+	rr := httptest.NewRecorder()
+	bc.serveBackups(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Body.String() != "[]\n" {
+		t.Errorf("empty catalog = %q, want []", rr.Body.String())
+	}
+
+	for _, rev := range []int64{2, 1} {
+		if _, err := be.Save(context.Background(), "3.1.0", rev, strings.NewReader("snapshot")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rr = httptest.NewRecorder()
+	bc.serveBackups(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("http code want = %d, get = %d", http.StatusOK, rr.Code)
+	}
+	var backups []backend.BackupMeta
+	if err := json.NewDecoder(rr.Body).Decode(&backups); err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Revision != 1 || backups[1].Revision != 2 {
+		t.Fatalf("backups = %+v, want revisions 1 and 2", backups)
+	}
+	if backups[1].Version != "3.1.0" || backups[1].Size != int64(len("snapshot")) {
+		t.Errorf("backup = %+v, want version 3.1.0 and size %d", backups[1], len("snapshot"))
+	}
+
+	rr = httptest.NewRecorder()
+	bc.serveBackups(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("http code want = %d, get = %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+// TestServeBackupNowForce ensures a backup request passes on whether the backup is forced.
+func TestServeBackupNowForce(t *testing.T) {
+	bc := &BackupController{backupNow: make(chan backupNowRequest)}
+	go func() {
+		for req := range bc.backupNow {
+			req.ackchan <- backupNowAck{status: backupapi.BackupStatus{Revision: 1, Forced: req.force}}
+		}
+	}()
+	defer close(bc.backupNow)
+
+	tests := []struct {
+		query      string
+		wantCode   int
+		wantForced bool
+	}{
+		{query: "", wantCode: http.StatusOK},
+		{query: "?force=true", wantCode: http.StatusOK, wantForced: true},
+		{query: "?force=false", wantCode: http.StatusOK},
+		{query: "?force=yes", wantCode: http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		rr := httptest.NewRecorder()
+		bc.serveBackupNow(rr, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+		if rr.Code != tt.wantCode {
+			t.Errorf("#%d: http code want = %d, get = %d", i, tt.wantCode, rr.Code)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+		var bs backupapi.BackupStatus
+		if err := json.NewDecoder(rr.Body).Decode(&bs); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if bs.Forced != tt.wantForced {
+			t.Errorf("#%d: forced = %v, want %v", i, bs.Forced, tt.wantForced)
+		}
+	}
+}
+
+// TestServeBackupNowStopped ensures no backup is requested once the controller is stopped.
+func TestServeBackupNowStopped(t *testing.T) {
+	bc := &BackupController{
+		backupNow: make(chan backupNowRequest),
+		stopped:   make(chan struct{}),
+		schedule:  cron.Every(time.Hour),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bc.Run(ctx)
+
+	rr := httptest.NewRecorder()
+	bc.serveBackupNow(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("http code want = %d, get = %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
+
+func TestDrainContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dctx, dcancel := drainContext(ctx, 100*time.Millisecond)
+	defer dcancel()
+
+	cancel()
+	select {
+	case <-dctx.Done():
+		t.Fatal("expect the drain context to outlive its parent until the drain timeout")
+	case <-time.After(20 * time.Millisecond):
+	}
+	select {
+	case <-dctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expect the drain context to be done after the drain timeout")
+	}
+}
+
+// TestServeDiffRequest ensures a diff request names two backups by their revisions.
+func TestServeDiffRequest(t *testing.T) {
+	d, err := ioutil.TempDir("", "backup-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	be := backend.NewFileBackend(d)
+	if _, err = be.Save(context.Background(), "3.1.0", 1, strings.NewReader("snapshot")); err != nil {
+		t.Fatal(err)
+	}
+	bc := &BackupController{
+		backupManager: NewBackupManager(fake.NewSimpleClientset(), "example", "default", nil, be),
+	}
+
+	tests := []struct {
+		method   string
+		query    string
+		wantCode int
+	}{
+		{method: http.MethodGet, query: "", wantCode: http.StatusBadRequest},
+		{method: http.MethodGet, query: "?from=1", wantCode: http.StatusBadRequest},
+		{method: http.MethodGet, query: "?from=a&to=1", wantCode: http.StatusBadRequest},
+		{method: http.MethodGet, query: "?from=1&to=2", wantCode: http.StatusNotFound},
+		{method: http.MethodPost, query: "?from=1&to=1", wantCode: http.StatusMethodNotAllowed},
+	}
+	for i, tt := range tests {
+		rr := httptest.NewRecorder()
+		bc.serveDiff(rr, httptest.NewRequest(tt.method, "/"+tt.query, nil))
+		if rr.Code != tt.wantCode {
+			t.Errorf("#%d: http code want = %d, get = %d", i, tt.wantCode, rr.Code)
+		}
+	}
+}
+
+// signingBackend signs URLs of the form "signed:<name>:<ttl>".
+type signingBackend struct {
+	backend.Backend
+}
+
+func (sb *signingBackend) SignedURL(name string, ttl time.Duration) (string, error) {
+	return fmt.Sprintf("signed:%s:%v", name, ttl), nil
+}
+
+func TestServeSignedURL(t *testing.T) {
+	d, err := ioutil.TempDir("", "backup-signed-url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	be := backend.NewFileBackend(d)
+	if _, err = be.Save(context.Background(), "3.1.0", 1, strings.NewReader("snapshot")); err != nil {
+		t.Fatal(err)
+	}
+	name := "3.1.0_0000000000000001_etcd.backup"
+	bc := &BackupController{
+		policy:        api.BackupPolicy{MaxSignedURLTTLInSecond: 600},
+		backupManager: NewBackupManager(fake.NewSimpleClientset(), "example", "default", nil, &signingBackend{be}),
+	}
+
+	tests := []struct {
+		query   string
+		code    int
+		wantURL string
+	}{
+		{"?name=" + name, http.StatusOK, "signed:" + name + ":10m0s"},
+		{"?name=" + name + "&ttl=60", http.StatusOK, "signed:" + name + ":1m0s"},
+		// the ttl is capped by the policy.
+		{"?name=" + name + "&ttl=3600", http.StatusOK, "signed:" + name + ":10m0s"},
+		{"?name=" + name + "&ttl=-1", http.StatusBadRequest, ""},
+		{"?name=3.1.0_0000000000000002_etcd.backup", http.StatusNotFound, ""},
+		{"?name=../secret", http.StatusNotFound, ""},
+	}
+	for i, tt := range tests {
+		rr := httptest.NewRecorder()
+		bc.serveSignedURL(rr, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+		if rr.Code != tt.code {
+			t.Errorf("#%d: http code want = %d, get = %d", i, tt.code, rr.Code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var su backupapi.SignedURL
+		if err := json.NewDecoder(rr.Body).Decode(&su); err != nil {
+			t.Fatal(err)
+		}
+		if su.URL != tt.wantURL {
+			t.Errorf("#%d: url = %s, want %s", i, su.URL, tt.wantURL)
+		}
+	}
+
+	// backends which can't sign URLs, e.g. encrypted ones, are reported as such.
+	bc.backupManager = NewBackupManager(fake.NewSimpleClientset(), "example", "default", nil, be)
+	rr := httptest.NewRecorder()
+	bc.serveSignedURL(rr, httptest.NewRequest(http.MethodGet, "/?name="+name, nil))
+	if rr.Code != http.StatusNotImplemented {
+		t.Errorf("http code want = %d, get = %d", http.StatusNotImplemented, rr.Code)
+	}
+}
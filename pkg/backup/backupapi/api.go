@@ -14,13 +14,25 @@
 
 package backupapi
 
-import "path"
+import (
+	"path"
+	"time"
+)
 
 const (
 	APIV1 = "/v1"
 	// S3V1 indicates the version 1 of
 	// S3 backup format: <s3Bucket>/<s3Prefix>/"v1"/<namespace>/<clusterName>
 	S3V1 = "v1"
+
+	// HealthzPath is the path of the liveness check of the backup sidecar: the cluster is reachable.
+	HealthzPath = "/healthz"
+	// ReadyzPath is the path of the readiness check of the backup sidecar:
+	// the cluster is reachable and the storage accepts writes.
+	ReadyzPath = "/readyz"
+
+	HealthCheckOK     = "ok"
+	HealthCheckFailed = "failed"
 )
 
 type ServiceStatus struct {
@@ -33,15 +45,34 @@ type ServiceStatus struct {
 
 	// BackupSize is the total size of existing backups in MB.
 	BackupSize float64 `json:"backupSize"`
+
+	// LastBackupError is the error of the most recent backup attempt.
+	// It is empty if the most recent backup attempt succeeded.
+	LastBackupError string `json:"lastBackupError,omitempty"`
+
+	// LastSkipReason is why the most recent backup attempt saved no backup, e.g. the cluster has not
+	// changed since the latest backup. It is empty if the most recent backup attempt saved a backup or failed.
+	LastSkipReason string `json:"lastSkipReason,omitempty"`
+
+	// BackupInProgressSeconds is how long the backup in progress has been running.
+	// It is 0 if no backup is in progress.
+	BackupInProgressSeconds float64 `json:"backupInProgressSeconds,omitempty"`
 }
 
 type BackupStatus struct {
+	// Name is the name of the backup file.
+	Name string `json:"name,omitempty"`
+
 	// Creation time of the backup.
 	CreationTime string `json:"creationTime"`
 
 	// Size is the size of the backup in MB.
 	Size float64 `json:"size"`
 
+	// CompressedSize is the size of the backup in MB after compression.
+	// It is 0 if the backup is not compressed.
+	CompressedSize float64 `json:"compressedSize,omitempty"`
+
 	// Revision is the revision of the backup.
 	Revision int64 `json:"revision"`
 
@@ -50,6 +81,62 @@ type BackupStatus struct {
 
 	// TimeTookInSecond is the total time took to create the backup.
 	TimeTookInSecond int `json:"timeTookInSecond"`
+
+	// SHA256 is the hex encoded SHA-256 checksum of the snapshot, before compression and encryption.
+	// It is saved next to the backup and checked before a member is seeded from the backup.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Forced is true if the backup was requested regardless of whether the cluster changed
+	// since the latest backup. Its revision may then be the revision of the latest backup.
+	Forced bool `json:"forced,omitempty"`
+
+	// Attempts is the number of snapshots taken to save the backup, more than 1 if the first
+	// failed to be received from etcd or saved to the storage.
+	Attempts int `json:"attempts,omitempty"`
+
+	// MemberID is the hex encoded ID of the etcd member which served the snapshot.
+	MemberID string `json:"memberID,omitempty"`
+
+	// FromLeader is true if the snapshot was served by the leader, which happens
+	// only if no follower was at the max revision.
+	FromLeader bool `json:"fromLeader,omitempty"`
+
+	// DBSizeBeforeDefrag is the size in MB of the database of the member before it was defragmented
+	// for the snapshot, to compare with Size. It is 0 if the member was not defragmented.
+	DBSizeBeforeDefrag float64 `json:"dbSizeBeforeDefrag,omitempty"`
+
+	// Alarms are the names of the etcd alarms raised in the cluster when the snapshot was taken, e.g. NOSPACE.
+	Alarms []string `json:"alarms,omitempty"`
+
+	// Throughput is the rate in MB per second the snapshot was received and saved at, before compression.
+	Throughput float64 `json:"throughput,omitempty"`
+}
+
+// SignedURL is a URL to download a backup without storage credentials.
+type SignedURL struct {
+	// URL is the URL to download the backup from.
+	URL string `json:"url"`
+
+	// Expires is when the URL expires.
+	Expires time.Time `json:"expires"`
+}
+
+// HealthStatus is the result of a health check of the backup sidecar.
+type HealthStatus struct {
+	// Status is HealthCheckOK if all the checks passed, HealthCheckFailed otherwise.
+	Status string `json:"status"`
+
+	// Checks are the results of the checks by name, e.g. "etcd" or "storage".
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the result of a single check of a HealthStatus.
+type HealthCheck struct {
+	// Status is HealthCheckOK or HealthCheckFailed.
+	Status string `json:"status"`
+
+	// Error is why the check failed. It is empty if the check passed.
+	Error string `json:"error,omitempty"`
 }
 
 // ToS3Prefix concatenates s3Prefix, S3V1, namespace, clusterName to a single s3 prefix.
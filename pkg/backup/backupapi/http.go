@@ -23,6 +23,8 @@ import (
 const (
 	HTTPQueryVersionKey  = "etcdVersion"
 	HTTPQueryRevisionKey = "etcdRevision"
+	// HTTPQueryNameKey names the backup to retrieve, which takes precedence over the revision.
+	HTTPQueryNameKey = "name"
 )
 
 // NewBackupURL creates a URL struct for retrieving an existing backup.
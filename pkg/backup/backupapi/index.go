@@ -0,0 +1,107 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backupapi
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// BackupIndexName is the name of the index of the backups saved under a prefix.
+const BackupIndexName = "index.json"
+
+// BackupIndex lists the backups saved under a prefix, so that they can be found without listing the storage.
+type BackupIndex struct {
+	// RebuiltAt is when the index was last rebuilt from listing the storage.
+	RebuiltAt time.Time `json:"rebuiltAt"`
+	// Backups are in ascending revision order.
+	Backups []BackupIndexEntry `json:"backups"`
+}
+
+// BackupIndexEntry describes a backup in a BackupIndex.
+type BackupIndexEntry struct {
+	// Name is the name of the backup under the prefix.
+	Name     string `json:"name"`
+	Revision int64  `json:"revision"`
+	Version  string `json:"version"`
+	// Size is the size of the backup in bytes. It is 0 for the backups only known from listing the storage.
+	Size int64 `json:"size,omitempty"`
+	// SHA256 is the hex encoded checksum of the snapshot before compression.
+	// It is empty for the backups only known from listing the storage.
+	SHA256 string `json:"sha256,omitempty"`
+	// CreatedAt is when the backup was saved. It is zero if not known.
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ParseBackupIndex parses a BackupIndex saved as JSON.
+func ParseBackupIndex(b []byte) (*BackupIndex, error) {
+	idx := &BackupIndex{}
+	if err := json.Unmarshal(b, idx); err != nil {
+		return nil, err
+	}
+	idx.sort()
+	return idx, nil
+}
+
+// Names returns the names of the backups in ascending revision order.
+func (idx *BackupIndex) Names() []string {
+	names := make([]string, 0, len(idx.Backups))
+	for _, e := range idx.Backups {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// CreationTimes returns the creation time of the backups keyed by name.
+// It returns false if the creation time of any backup is not known.
+func (idx *BackupIndex) CreationTimes() (map[string]time.Time, bool) {
+	times := make(map[string]time.Time, len(idx.Backups))
+	for _, e := range idx.Backups {
+		if e.CreatedAt.IsZero() {
+			return nil, false
+		}
+		times[e.Name] = e.CreatedAt
+	}
+	return times, true
+}
+
+// Put adds the given backup to the index, or replaces the backup of the same name.
+func (idx *BackupIndex) Put(e BackupIndexEntry) {
+	idx.Remove(e.Name)
+	idx.Backups = append(idx.Backups, e)
+	idx.sort()
+}
+
+// Remove removes the backups of the given names from the index.
+func (idx *BackupIndex) Remove(names ...string) {
+	rm := make(map[string]bool, len(names))
+	for _, name := range names {
+		rm[name] = true
+	}
+	backups := idx.Backups[:0]
+	for _, e := range idx.Backups {
+		if !rm[e.Name] {
+			backups = append(backups, e)
+		}
+	}
+	idx.Backups = backups
+}
+
+func (idx *BackupIndex) sort() {
+	sort.SliceStable(idx.Backups, func(i, j int) bool {
+		return idx.Backups[i].Revision < idx.Backups[j].Revision
+	})
+}
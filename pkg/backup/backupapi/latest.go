@@ -0,0 +1,39 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backupapi
+
+import "encoding/json"
+
+// LatestBackupInfoName is the name of the file describing the latest backup saved under a prefix,
+// whose copy is saved as util.LatestBackupName.
+const LatestBackupInfoName = "latest.json"
+
+// LatestBackupInfo describes the latest backup saved under a prefix.
+type LatestBackupInfo struct {
+	// Name is the name of the backup under the prefix.
+	Name     string `json:"name"`
+	Revision int64  `json:"revision"`
+	// SHA256 is the hex encoded checksum of the snapshot before compression.
+	SHA256 string `json:"sha256"`
+}
+
+// ParseLatestBackupInfo parses a LatestBackupInfo saved as JSON.
+func ParseLatestBackupInfo(b []byte) (*LatestBackupInfo, error) {
+	info := &LatestBackupInfo{}
+	if err := json.Unmarshal(b, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
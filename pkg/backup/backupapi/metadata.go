@@ -0,0 +1,145 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backupapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The keys of the metadata saved with a backup. They are valid S3 metadata keys
+// and ABS metadata names, which must be C# identifiers.
+const (
+	MetadataClusterName       = "etcd_cluster_name"
+	MetadataNamespace         = "etcd_cluster_namespace"
+	MetadataClusterUID        = "etcd_cluster_uid"
+	MetadataEtcdVersion       = "etcd_version"
+	MetadataRevision          = "etcd_revision"
+	MetadataCreationTimestamp = "creation_timestamp"
+)
+
+// BackupMetadata identifies the cluster a backup is taken from, so that backups
+// can be told apart without parsing their names.
+type BackupMetadata struct {
+	ClusterName string
+	Namespace   string
+	// ClusterUID is the UID of the EtcdCluster, which tells apart the clusters
+	// recreated with the same name. It is empty if it is not known.
+	ClusterUID        string
+	EtcdVersion       string
+	Revision          int64
+	CreationTimestamp time.Time
+}
+
+// ToMap returns the metadata as saved with the backup.
+func (m *BackupMetadata) ToMap() map[string]string {
+	md := map[string]string{
+		MetadataClusterName:       m.ClusterName,
+		MetadataNamespace:         m.Namespace,
+		MetadataEtcdVersion:       m.EtcdVersion,
+		MetadataRevision:          strconv.FormatInt(m.Revision, 10),
+		MetadataCreationTimestamp: m.CreationTimestamp.UTC().Format(time.RFC3339),
+	}
+	if len(m.ClusterUID) != 0 {
+		md[MetadataClusterUID] = m.ClusterUID
+	}
+	return md
+}
+
+// ParseBackupMetadata parses the metadata returned by ToMap.
+// Keys are matched case-insensitively since storage services may change their case, e.g. S3 returns "Etcd_revision".
+func ParseBackupMetadata(md map[string]string) (*BackupMetadata, error) {
+	lower := make(map[string]string, len(md))
+	for k, v := range md {
+		lower[strings.ToLower(k)] = v
+	}
+	m := &BackupMetadata{
+		ClusterName: lower[MetadataClusterName],
+		Namespace:   lower[MetadataNamespace],
+		ClusterUID:  lower[MetadataClusterUID],
+		EtcdVersion: lower[MetadataEtcdVersion],
+	}
+	if len(m.ClusterName) == 0 {
+		return nil, fmt.Errorf("missing metadata (%s)", MetadataClusterName)
+	}
+	var err error
+	if m.Revision, err = strconv.ParseInt(lower[MetadataRevision], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid metadata (%s): %v", MetadataRevision, err)
+	}
+	if m.CreationTimestamp, err = time.Parse(time.RFC3339, lower[MetadataCreationTimestamp]); err != nil {
+		return nil, fmt.Errorf("invalid metadata (%s): %v", MetadataCreationTimestamp, err)
+	}
+	return m, nil
+}
+
+// ParseBackupManifest parses the JSON manifest saved next to a backup
+// by the writers which can't save metadata with the backup itself.
+func ParseBackupManifest(b []byte) (*BackupMetadata, error) {
+	var md map[string]string
+	if err := json.Unmarshal(b, &md); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %v", err)
+	}
+	return ParseBackupMetadata(md)
+}
+
+// ClusterMetadata describes the cluster a backup is taken from beyond what the snapshot carries,
+// so that the backup can be checked before it is restored. It is saved as JSON next to the backup,
+// under the name given by util.MakeClusterMetadataName.
+type ClusterMetadata struct {
+	// Backup is the name of the backup.
+	Backup      string `json:"backup"`
+	ClusterName string `json:"clusterName"`
+	Namespace   string `json:"namespace"`
+	// ClusterUID is the UID of the EtcdCluster. It is empty if it is not known.
+	ClusterUID string `json:"clusterUID,omitempty"`
+	// ClusterSize is the size of the cluster in its spec, or the number of its members if the spec is not known.
+	ClusterSize int    `json:"clusterSize"`
+	EtcdVersion string `json:"etcdVersion"`
+	Revision    int64  `json:"revision"`
+	// SHA256 is the hex encoded checksum of the snapshot before compression.
+	SHA256 string `json:"sha256,omitempty"`
+	// Members are the members of the cluster as listed by etcd.
+	Members []MemberMetadata `json:"members"`
+	// PeerTLS and ClientTLS tell whether the members serve their peer and client URLs with TLS.
+	PeerTLS   bool `json:"peerTLS"`
+	ClientTLS bool `json:"clientTLS"`
+	// Spec is the spec of the EtcdCluster. It is empty if the EtcdCluster could not be read.
+	Spec              json.RawMessage `json:"spec,omitempty"`
+	CreationTimestamp time.Time       `json:"creationTimestamp"`
+}
+
+// MemberMetadata is a member of the cluster a backup is taken from.
+type MemberMetadata struct {
+	// ID is the hex encoded ID of the member.
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs,omitempty"`
+}
+
+// ParseClusterMetadata parses the cluster metadata saved next to a backup.
+func ParseClusterMetadata(b []byte) (*ClusterMetadata, error) {
+	m := &ClusterMetadata{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("invalid cluster metadata: %v", err)
+	}
+	if len(m.EtcdVersion) == 0 {
+		return nil, fmt.Errorf("invalid cluster metadata: missing etcd version")
+	}
+	return m, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backupapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBackupMetadata(t *testing.T) {
+	md := &BackupMetadata{
+		ClusterName:       "example",
+		Namespace:         "default",
+		EtcdVersion:       "3.1.10",
+		Revision:          42015,
+		CreationTimestamp: time.Date(2017, 12, 1, 0, 0, 0, 0, time.UTC),
+	}
+	// S3 returns the metadata keys canonicalized as HTTP headers.
+	s3md := make(map[string]string)
+	for k, v := range md.ToMap() {
+		s3md[strings.Title(k)] = v
+	}
+	got, err := ParseBackupMetadata(s3md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *md {
+		t.Errorf("metadata = %+v, want %+v", got, md)
+	}
+
+	for _, bad := range []map[string]string{
+		{MetadataRevision: "1", MetadataCreationTimestamp: "2017-12-01T00:00:00Z"},
+		{MetadataClusterName: "example", MetadataRevision: "x", MetadataCreationTimestamp: "2017-12-01T00:00:00Z"},
+		{MetadataClusterName: "example", MetadataRevision: "1"},
+	} {
+		if _, err := ParseBackupMetadata(bad); err == nil {
+			t.Errorf("expect %v to be rejected", bad)
+		}
+	}
+}
+
+func TestParseClusterMetadata(t *testing.T) {
+	md := &ClusterMetadata{
+		Backup:      "3.1.10_000000000000a41f_etcd.backup",
+		ClusterName: "example",
+		Namespace:   "default",
+		ClusterSize: 3,
+		EtcdVersion: "3.1.10",
+		Revision:    42015,
+		Members: []MemberMetadata{
+			{ID: "8e9e05c52164694d", Name: "example-0000", PeerURLs: []string{"https://example-0000.example.default.svc:2380"}},
+		},
+		PeerTLS:           true,
+		Spec:              json.RawMessage(`{"size":3}`),
+		CreationTimestamp: time.Date(2017, 12, 1, 0, 0, 0, 0, time.UTC),
+	}
+	b, err := json.Marshal(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseClusterMetadata(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, md) {
+		t.Errorf("metadata = %+v, want %+v", got, md)
+	}
+
+	for _, bad := range []string{"", "{", `{"clusterName":"example"}`} {
+		if _, err := ParseClusterMetadata([]byte(bad)); err == nil {
+			t.Errorf("expect %q to be rejected", bad)
+		}
+	}
+}
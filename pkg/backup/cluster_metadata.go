@@ -0,0 +1,164 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"golang.org/x/net/context"
+)
+
+// clusterMetadata returns the metadata of the cluster the backup of the given name, etcd version, revision
+// and checksum is taken from, with the members listed through ccli. The spec of the EtcdCluster is left out
+// if it can't be read, since the members are enough to restore the backup.
+func (bm *BackupManager) clusterMetadata(ctx context.Context, ccli clientv3.Cluster, name, version string, rev int64, sum string) (*backupapi.ClusterMetadata, error) {
+	lctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	resp, err := ccli.MemberList(lctx)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %v", err)
+	}
+	spec, size, err := bm.getClusterSpec()
+	if err != nil {
+		bm.getLogger().WithError(err).Warning("failed to get the cluster spec, saving the cluster metadata without it")
+	}
+	md := newClusterMetadata(resp.Members, spec, size)
+	md.Backup = name
+	md.ClusterName = bm.clusterName
+	md.Namespace = bm.namespace
+	md.ClusterUID = bm.clusterUID()
+	md.EtcdVersion = version
+	md.Revision = rev
+	md.SHA256 = sum
+	md.CreationTimestamp = time.Now()
+	return md, nil
+}
+
+// newClusterMetadata returns the metadata of a cluster with the given members and spec of the given size.
+// If the spec is not known, the size of the cluster is its number of members.
+func newClusterMetadata(members []*etcdserverpb.Member, spec json.RawMessage, size int) *backupapi.ClusterMetadata {
+	md := &backupapi.ClusterMetadata{Spec: spec, ClusterSize: size}
+	if len(spec) == 0 {
+		md.ClusterSize = len(members)
+	}
+	for _, m := range members {
+		md.Members = append(md.Members, backupapi.MemberMetadata{
+			ID:         fmt.Sprintf("%x", m.ID),
+			Name:       m.Name,
+			PeerURLs:   m.PeerURLs,
+			ClientURLs: m.ClientURLs,
+		})
+		for _, u := range m.PeerURLs {
+			md.PeerTLS = md.PeerTLS || strings.HasPrefix(u, "https://")
+		}
+		for _, u := range m.ClientURLs {
+			md.ClientTLS = md.ClientTLS || strings.HasPrefix(u, "https://")
+		}
+	}
+	return md
+}
+
+// getClusterSpec returns the spec of the EtcdCluster as JSON, and its size.
+func (bm *BackupManager) getClusterSpec() (json.RawMessage, int, error) {
+	b, err := bm.kubecli.CoreV1().RESTClient().Get().
+		AbsPath("/apis", api.SchemeGroupVersion.Group, api.SchemeGroupVersion.Version,
+			"namespaces", bm.namespace, api.EtcdClusterResourcePlural, bm.clusterName).
+		DoRaw()
+	if err != nil {
+		return nil, 0, err
+	}
+	var cl struct {
+		Spec json.RawMessage `json:"spec"`
+	}
+	if err = json.Unmarshal(b, &cl); err != nil {
+		return nil, 0, fmt.Errorf("invalid EtcdCluster: %v", err)
+	}
+	var spec api.ClusterSpec
+	if err = json.Unmarshal(cl.Spec, &spec); err != nil {
+		return nil, 0, fmt.Errorf("invalid EtcdCluster spec: %v", err)
+	}
+	return cl.Spec, spec.Size, nil
+}
+
+// encodeClusterMetadata returns the metadata of the cluster the backup of the given name, etcd version, revision
+// and checksum is taken from, as saved next to the backup.
+func (bm *BackupManager) encodeClusterMetadata(ctx context.Context, ccli clientv3.Cluster, name, version string, rev int64, sum string) ([]byte, error) {
+	md, err := bm.clusterMetadata(ctx, ccli, name, version, rev, sum)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(md)
+	if err != nil {
+		panic("unexpected json error " + err.Error())
+	}
+	return b, nil
+}
+
+// saveClusterMetadata saves the metadata of the cluster next to the backup of status bs, once it is saved.
+// Failing to save it doesn't fail the backup, which can be restored without it.
+func (bm *BackupManager) saveClusterMetadata(ctx context.Context, ccli clientv3.Cluster, bs *backupapi.BackupStatus) {
+	b, err := bm.encodeClusterMetadata(ctx, ccli, bs.Name, bs.Version, bs.Revision, bs.SHA256)
+	if err == nil {
+		_, err = bm.be.SaveAs(ctx, util.MakeClusterMetadataName(bs.Name), bytes.NewReader(b))
+		err = bm.tolerateReplication(err)
+	}
+	if err != nil {
+		bm.getLogger().WithError(err).WithField("backup", bs.Name).Warning("failed to save cluster metadata")
+	}
+}
+
+// saveClusterMetadataWithPrefix is like saveClusterMetadata for the backup saved at fullPath by SaveSnapWithPrefix.
+func (bm *BackupManager) saveClusterMetadataWithPrefix(ctx context.Context, ccli clientv3.Cluster, fullPath, version string, rev int64, sum string) {
+	b, err := bm.encodeClusterMetadata(ctx, ccli, path.Base(fullPath), version, rev, sum)
+	if err == nil {
+		_, err = bm.bw.Write(ctx, util.MakeClusterMetadataName(fullPath), bytes.NewReader(b))
+	}
+	if err != nil {
+		bm.getLogger().WithError(err).WithField("path", fullPath).Warning("failed to save cluster metadata")
+	}
+}
+
+// ReadClusterMetadata reads the metadata of the cluster saved next to the backup of the given name in be,
+// e.g. to check the backup before restoring it. It returns nil if the backup was saved without it.
+func ReadClusterMetadata(be backend.Backend, name string) (*backupapi.ClusterMetadata, error) {
+	rc, err := be.Open(util.MakeClusterMetadataName(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cluster metadata of backup (%s): %v", name, err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster metadata of backup (%s): %v", name, err)
+	}
+	return backupapi.ParseClusterMetadata(b)
+}
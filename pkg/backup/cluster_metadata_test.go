@@ -0,0 +1,106 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"golang.org/x/net/context"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewClusterMetadata(t *testing.T) {
+	members := []*etcdserverpb.Member{
+		{ID: 0x1a, Name: "example-0000", PeerURLs: []string{"https://example-0000.example.default.svc:2380"}, ClientURLs: []string{"http://example-0000.example.default.svc:2379"}},
+		{ID: 0x2b, Name: "example-0001", PeerURLs: []string{"https://example-0001.example.default.svc:2380"}, ClientURLs: []string{"http://example-0001.example.default.svc:2379"}},
+	}
+	md := newClusterMetadata(members, nil, 0)
+	if md.ClusterSize != 2 {
+		t.Errorf("cluster size without spec = %d, want the 2 members", md.ClusterSize)
+	}
+	if len(md.Members) != 2 || md.Members[0].ID != "1a" || md.Members[1].Name != "example-0001" {
+		t.Errorf("members = %+v, want example-0000 (1a) and example-0001 (2b)", md.Members)
+	}
+	if !md.PeerTLS || md.ClientTLS {
+		t.Errorf("peer TLS = %v, client TLS = %v, want peer TLS only", md.PeerTLS, md.ClientTLS)
+	}
+
+	// a member being added, e.g. while the cluster is scaled up, counts in the spec size only.
+	md = newClusterMetadata(members, json.RawMessage(`{"size":3}`), 3)
+	if md.ClusterSize != 3 {
+		t.Errorf("cluster size = %d, want the spec size 3", md.ClusterSize)
+	}
+}
+
+func TestServeClusterMetadata(t *testing.T) {
+	d, err := ioutil.TempDir("", "backup-metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	be := backend.NewFileBackend(d)
+	bc := &BackupController{
+		backupManager: NewBackupManager(fake.NewSimpleClientset(), "example", "default", nil, be),
+	}
+	withMeta, withoutMeta := util.MakeBackupName("3.1.0", 2), util.MakeBackupName("3.1.0", 1)
+	for _, rev := range []int64{1, 2} {
+		if _, err := be.Save(context.Background(), "3.1.0", rev, strings.NewReader("snapshot")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, _ := json.Marshal(&backupapi.ClusterMetadata{Backup: withMeta, ClusterName: "example", EtcdVersion: "3.1.0", Revision: 2})
+	if _, err := be.SaveAs(context.Background(), util.MakeClusterMetadataName(withMeta), strings.NewReader(string(b))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		wantCode int
+	}{
+		{name: withMeta, wantCode: http.StatusOK},
+		{name: withoutMeta, wantCode: http.StatusNotFound},
+		// only the cluster metadata of the backups is served.
+		{name: "../secret", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		bc.serveClusterMetadata(rr, httptest.NewRequest(http.MethodGet, "/?"+HTTPQueryClusterMetadataNameKey+"="+tt.name, nil))
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: http code = %d, want %d", tt.name, rr.Code, tt.wantCode)
+			continue
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+		md, err := backupapi.ParseClusterMetadata(rr.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.Backup != withMeta || md.Revision != 2 {
+			t.Errorf("cluster metadata = %+v, want the metadata of %s", md, withMeta)
+		}
+	}
+}
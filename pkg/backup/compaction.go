@@ -0,0 +1,59 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"golang.org/x/net/context"
+)
+
+// defaultCompactionTimeout is the timeout of a compaction if CompactionConfig.Timeout is not set.
+const defaultCompactionTimeout = time.Minute
+
+// CompactionConfig configures the compaction of the cluster after each backup.
+// The history up to the revision of the backup is then only in the backups,
+// which keeps the following snapshots from growing with old revisions.
+type CompactionConfig struct {
+	// Timeout is the timeout of a compaction. If equal to 0, defaultCompactionTimeout is used.
+	Timeout time.Duration
+}
+
+// compact compacts the key space of the cluster up to rev, the revision of the backup just saved.
+// The compaction is proposed through the leader, and is physical: it returns once the members
+// have removed the compacted revisions from their storage. Failing to compact does not fail the backup.
+func (bm *BackupManager) compact(ctx context.Context, kv clientv3.KV, rev int64) {
+	timeout := bm.compaction.Timeout
+	if timeout == 0 {
+		timeout = defaultCompactionTimeout
+	}
+	cctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	lg := bm.getLogger().WithField("revision", rev)
+	_, err := kv.Compact(cctx, rev, clientv3.WithCompactPhysical())
+	switch err {
+	case nil:
+		lg.WithField("duration_s", time.Since(start).Seconds()).Info("compacted cluster")
+	case rpctypes.ErrCompacted:
+		// the cluster has been compacted up to a later revision, e.g. by its own auto compaction.
+		lg.Info("skipped compacting cluster: already compacted")
+	default:
+		lg.WithError(err).WithField("timeout", timeout).Warning("failed to compact cluster")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"golang.org/x/net/context"
+)
+
+type fakeCompactKV struct {
+	clientv3.KV
+	err error
+
+	rev      int64
+	deadline time.Time
+}
+
+func (kv *fakeCompactKV) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	kv.rev = rev
+	kv.deadline, _ = ctx.Deadline()
+	if kv.err != nil {
+		return nil, kv.err
+	}
+	return &clientv3.CompactResponse{}, nil
+}
+
+// TestCompact ensures the cluster is compacted up to the revision of the backup within the timeout,
+// and that failing to compact is not fatal.
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		err     error
+		want    time.Duration
+	}{
+		{want: defaultCompactionTimeout},
+		{timeout: 5 * time.Second, want: 5 * time.Second},
+		{err: rpctypes.ErrCompacted, want: defaultCompactionTimeout},
+		{err: errors.New("etcdserver: request timed out"), want: defaultCompactionTimeout},
+	}
+	for i, tt := range tests {
+		bm := &BackupManager{compaction: &CompactionConfig{Timeout: tt.timeout}}
+		kv := &fakeCompactKV{err: tt.err}
+		start := time.Now()
+		bm.compact(context.Background(), kv, 42)
+		if kv.rev != 42 {
+			t.Errorf("#%d: compacted up to revision %d, want 42", i, kv.rev)
+		}
+		if d := kv.deadline.Sub(start); d < tt.want-time.Second || d > tt.want+time.Second {
+			t.Errorf("#%d: compaction timeout = %v, want %v", i, d, tt.want)
+		}
+	}
+}
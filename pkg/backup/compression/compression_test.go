@@ -0,0 +1,207 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	// repetitive data compresses like a snapshot.
+	data := bytes.Repeat([]byte("etcd snapshot "), 64*1024)
+	rand.New(rand.NewSource(1)).Read(data[:1024])
+	name := util.MakeBackupName("3.1.8", 1)
+
+	for _, c := range []string{None, Gzip, Zstd} {
+		if err := Validate(c, DefaultLevel); err != nil {
+			t.Fatal(err)
+		}
+		cr := NewCompressReader(bytes.NewReader(data), c, DefaultLevel)
+		compressed, err := ioutil.ReadAll(cr)
+		cr.Close()
+		if err != nil {
+			t.Fatalf("%q: %v", c, err)
+		}
+		if c != None && len(compressed) >= len(data)/4 {
+			t.Errorf("%q: compressed %d bytes to %d bytes, want less than a quarter", c, len(data), len(compressed))
+		}
+
+		cname := MakeName(name, c)
+		if IsCompressed(cname) != (c != None) {
+			t.Errorf("%q: IsCompressed(%s) = %v", c, cname, !(c != None))
+		}
+		if !util.IsBackup(cname) {
+			t.Errorf("%q: expect %s to be a backup", c, cname)
+		}
+		rc, err := NewDecompressReader(cname, ioutil.NopCloser(bytes.NewReader(compressed)))
+		if err != nil {
+			t.Fatalf("%q: %v", c, err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%q: decompressed %d bytes (%v), want the %d bytes compressed", c, len(got), err, len(data))
+		}
+	}
+
+	if err := Validate("lz4", DefaultLevel); err == nil {
+		t.Error("expect unknown compression to be rejected")
+	}
+	if _, err := NewDecompressReader(MakeName(name, Gzip), ioutil.NopCloser(bytes.NewReader([]byte("not gzip")))); err == nil {
+		t.Error("expect decompressing corrupted backup to fail")
+	}
+}
+
+func TestValidateLevel(t *testing.T) {
+	tests := []struct {
+		c       string
+		level   int
+		wantErr bool
+	}{
+		{c: Gzip, level: 9},
+		{c: Gzip, level: 10, wantErr: true},
+		{c: Zstd, level: 1},
+		{c: Zstd, level: 22},
+		{c: Zstd, level: 23, wantErr: true},
+		{c: Zstd, level: -1, wantErr: true},
+		{c: None, level: 3, wantErr: true},
+	}
+	for i, tt := range tests {
+		if err := Validate(tt.c, tt.level); (err != nil) != tt.wantErr {
+			t.Errorf("#%d: expect error %v, got %v", i, tt.wantErr, err)
+		}
+	}
+}
+
+// TestDecompressDetectsFormat ensures a compressed backup is decompressed by its magic bytes,
+// e.g. when the name of an encrypted backup hides its compression extension from a suffix check.
+func TestDecompressDetectsFormat(t *testing.T) {
+	data := bytes.Repeat([]byte("etcd snapshot "), 1024)
+	for _, c := range []string{Gzip, Zstd} {
+		cr := NewCompressReader(bytes.NewReader(data), c, 1)
+		compressed, err := ioutil.ReadAll(cr)
+		cr.Close()
+		if err != nil {
+			t.Fatalf("%q: %v", c, err)
+		}
+		name := util.MakeEncryptedName(MakeName(util.MakeBackupName("3.1.8", 1), c), "key")
+		rc, err := NewDecompressReader(name, ioutil.NopCloser(bytes.NewReader(compressed)))
+		if err != nil {
+			t.Fatalf("%q: %v", c, err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%q: decompressed %d bytes (%v), want the %d bytes compressed", c, len(got), err, len(data))
+		}
+	}
+}
+
+// snapshotReader generates size bytes that compress like a snapshot, without holding them in memory.
+type snapshotReader struct {
+	rnd  *rand.Rand
+	size int64
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+	if r.size <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.size {
+		p = p[:r.size]
+	}
+	// a few random bytes in every 256 bytes of repeated keys.
+	for i := range p {
+		if i%256 < 8 {
+			p[i] = byte(r.rnd.Intn(256))
+		} else {
+			p[i] = "etcd/registry/pods/"[i%19]
+		}
+	}
+	r.size -= int64(len(p))
+	return len(p), nil
+}
+
+// heapSampler records the max heap in use while it is written to.
+type heapSampler struct {
+	n       int
+	maxHeap uint64
+}
+
+func (s *heapSampler) Write(p []byte) (int, error) {
+	s.n++
+	if s.n%1024 == 0 {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		if ms.HeapInuse > s.maxHeap {
+			s.maxHeap = ms.HeapInuse
+		}
+	}
+	return len(p), nil
+}
+
+// TestCompressStreamLarge ensures large snapshots round-trip through the compression
+// as streams, i.e. without being loaded in memory.
+func TestCompressStreamLarge(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping large snapshot in short mode")
+	}
+	const size = 512 << 20
+	for _, c := range []string{Gzip, Zstd} {
+		want := sha256.New()
+		cr := NewCompressReader(io.TeeReader(&snapshotReader{rnd: rand.New(rand.NewSource(1)), size: size}, want), c, DefaultLevel)
+		rc, err := NewDecompressReader(MakeName(util.MakeBackupName("3.1.8", 1), c), cr)
+		if err != nil {
+			t.Fatalf("%q: %v", c, err)
+		}
+		got := sha256.New()
+		hs := &heapSampler{}
+		n, err := io.Copy(io.MultiWriter(got, hs), rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%q: %v", c, err)
+		}
+		if n != size || !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+			t.Errorf("%q: round-tripped %d bytes with a different checksum, want the %d bytes compressed", c, n, size)
+		}
+		if hs.maxHeap > size/8 {
+			t.Errorf("%q: heap grew to %d bytes for a %d bytes snapshot", c, hs.maxHeap, size)
+		}
+	}
+}
+
+func benchmarkCompress(b *testing.B, c string) {
+	const size = 64 << 20
+	b.SetBytes(size)
+	for i := 0; i < b.N; i++ {
+		cr := NewCompressReader(&snapshotReader{rnd: rand.New(rand.NewSource(1)), size: size}, c, DefaultLevel)
+		if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+			b.Fatal(err)
+		}
+		cr.Close()
+	}
+}
+
+func BenchmarkCompressGzip(b *testing.B) { benchmarkCompress(b, Gzip) }
+
+func BenchmarkCompressZstd(b *testing.B) { benchmarkCompress(b, Zstd) }
@@ -0,0 +1,102 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package credentials provides short-lived storage credentials to the backup storage clients,
+// so that the clients don't depend on where the credentials come from.
+package credentials
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// ProviderName is the name of the provider of the AWS credentials from a CredentialProvider.
+	ProviderName = "CredentialProvider"
+
+	// awsExpiryWindow is how long before they expire the AWS SDK retrieves new credentials.
+	awsExpiryWindow = time.Minute
+)
+
+// Credentials are the short-lived credentials of a storage service.
+type Credentials struct {
+	// AccessKeyID, SecretAccessKey and SessionToken are AWS credentials.
+	// SessionToken is empty for the credentials of an IAM user.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Token is a GCP OAuth2 access token.
+	Token string
+	// Expiration is when the credentials expire. It is zero if they don't.
+	Expiration time.Time
+}
+
+// CredentialProvider provides the credentials of a storage service and refreshes them before they expire.
+type CredentialProvider interface {
+	// Credentials returns the current credentials, which must not be modified.
+	Credentials() (*Credentials, error)
+}
+
+// awsProvider gives the AWS credentials of a CredentialProvider to the AWS SDK.
+type awsProvider struct {
+	credentials.Expiry
+
+	p CredentialProvider
+}
+
+func (ap *awsProvider) Retrieve() (credentials.Value, error) {
+	c, err := ap.p.Credentials()
+	if err != nil {
+		return credentials.Value{ProviderName: ProviderName}, err
+	}
+	if !c.Expiration.IsZero() {
+		ap.SetExpiration(c.Expiration, awsExpiryWindow)
+	}
+	return credentials.Value{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		ProviderName:    ProviderName,
+	}, nil
+}
+
+// NewAWSCredentials returns the credentials of an AWS session which are the AWS credentials of p.
+func NewAWSCredentials(p CredentialProvider) *credentials.Credentials {
+	return credentials.NewCredentials(&awsProvider{p: p})
+}
+
+// tokenSource gives the GCP access token of a CredentialProvider to the GCP clients.
+type tokenSource struct {
+	p CredentialProvider
+}
+
+func (ts tokenSource) Token() (*oauth2.Token, error) {
+	c, err := ts.p.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: c.Token,
+		TokenType:   "Bearer",
+		Expiry:      c.Expiration,
+	}, nil
+}
+
+// NewTokenSource returns a token source of the GCP access token of p.
+// The token is reused until it expires.
+func NewTokenSource(p CredentialProvider) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, tokenSource{p: p})
+}
@@ -0,0 +1,302 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// EngineAWS is the Vault secrets engine of AWS credentials.
+	EngineAWS = "aws"
+	// EngineGCP is the Vault secrets engine of GCP OAuth2 access tokens.
+	EngineGCP = "gcp"
+
+	defaultKubernetesAuthPath = "kubernetes"
+	// serviceAccountTokenFile is where Kubernetes mounts the token of the service account of a pod.
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	vaultRequestTimeout = 30 * time.Second
+)
+
+// vaultLoginFunc returns a Vault token and its time to live, which is 0 if it doesn't expire.
+type vaultLoginFunc func() (token string, ttl time.Duration, err error)
+
+// VaultCredentialProvider gets short-lived credentials from the AWS or GCP secrets engine of Vault.
+// The credentials are cached and refreshed once three quarters of their lifetime has passed.
+type VaultCredentialProvider struct {
+	client  *http.Client
+	address string
+	engine  string
+	// credsPath is the Vault path the credentials are read from, e.g. "aws/creds/<role>".
+	credsPath string
+	login     vaultLoginFunc
+	// now is time.Now, but can be replaced in tests.
+	now func() time.Time
+
+	mu             sync.Mutex
+	token          string
+	tokenRefreshAt time.Time
+	creds          *Credentials
+	refreshAt      time.Time
+}
+
+var _ CredentialProvider = &VaultCredentialProvider{}
+
+// NewVaultCredentialProvider creates a VaultCredentialProvider of the credentials of the given secrets engine,
+// EngineAWS or EngineGCP, configured by v. The Vault token is read from the secret v.TokenSecret in namespace,
+// or got from logging in to Vault with the token of the service account of the pod.
+func NewVaultCredentialProvider(kubecli kubernetes.Interface, namespace, engine string, v *api.VaultSource) (*VaultCredentialProvider, error) {
+	if err := v.Validate(); err != nil {
+		return nil, err
+	}
+	mount := v.SecretsEnginePath
+	if len(mount) == 0 {
+		mount = engine
+	}
+	var credsPath string
+	switch engine {
+	case EngineAWS:
+		credsPath = path.Join(mount, "creds", v.Role)
+	case EngineGCP:
+		credsPath = path.Join(mount, "token", v.Role)
+	default:
+		return nil, fmt.Errorf("unknown vault secrets engine (%s)", engine)
+	}
+	p := &VaultCredentialProvider{
+		client:    &http.Client{Timeout: vaultRequestTimeout},
+		address:   strings.TrimSuffix(v.Address, "/"),
+		engine:    engine,
+		credsPath: credsPath,
+		now:       time.Now,
+	}
+	if len(v.TokenSecret) != 0 {
+		p.login = secretToken(kubecli, namespace, v.TokenSecret)
+	} else {
+		authPath := v.KubernetesAuthPath
+		if len(authPath) == 0 {
+			authPath = defaultKubernetesAuthPath
+		}
+		p.login = p.kubernetesLogin(authPath, v.KubernetesRole, serviceAccountTokenFile)
+	}
+	return p, nil
+}
+
+// secretToken reads the Vault token from the given secret. The secret is read on each login,
+// so that a rotated token is picked up once the current one is rejected.
+func secretToken(kubecli kubernetes.Interface, namespace, secret string) vaultLoginFunc {
+	return func() (string, time.Duration, error) {
+		se, err := kubecli.CoreV1().Secrets(namespace).Get(secret, metav1.GetOptions{})
+		if err != nil {
+			return "", 0, fmt.Errorf("get k8s secret failed: %v", err)
+		}
+		token := strings.TrimSpace(string(se.Data[api.VaultSecretTokenFileName]))
+		if len(token) == 0 {
+			return "", 0, fmt.Errorf("secret (%s) has no '%s' entry", secret, api.VaultSecretTokenFileName)
+		}
+		return token, 0, nil
+	}
+}
+
+// kubernetesLogin logs in to Vault as role with the Kubernetes auth method mounted at authPath,
+// authenticated by the service account token in tokenFile.
+func (p *VaultCredentialProvider) kubernetesLogin(authPath, role, tokenFile string) vaultLoginFunc {
+	return func() (string, time.Duration, error) {
+		jwt, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read service account token: %v", err)
+		}
+		body, err := json.Marshal(map[string]string{"role": role, "jwt": strings.TrimSpace(string(jwt))})
+		if err != nil {
+			return "", 0, err
+		}
+		resp, err := p.do(http.MethodPost, path.Join("auth", authPath, "login"), "", body)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to log in to vault as role (%s): %v", role, err)
+		}
+		if resp.Auth == nil || len(resp.Auth.ClientToken) == 0 {
+			return "", 0, fmt.Errorf("vault login as role (%s) returned no token", role)
+		}
+		return resp.Auth.ClientToken, time.Duration(resp.Auth.LeaseDuration) * time.Second, nil
+	}
+}
+
+// Credentials returns the cached credentials, or gets new ones from Vault once they are due to be refreshed.
+// If Vault fails while the cached credentials are still valid, they are returned.
+func (p *VaultCredentialProvider) Credentials() (*Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	if p.creds != nil && now.Before(p.refreshAt) {
+		return p.creds, nil
+	}
+	creds, err := p.fetch()
+	if err != nil {
+		if p.creds != nil && (p.creds.Expiration.IsZero() || now.Before(p.creds.Expiration)) {
+			logrus.Warningf("failed to refresh %s credentials from vault, using the current ones until they expire: %v", p.engine, err)
+			return p.creds, nil
+		}
+		return nil, err
+	}
+	p.creds = creds
+	if creds.Expiration.IsZero() {
+		p.refreshAt = now.Add(24 * time.Hour)
+	} else {
+		p.refreshAt = now.Add(creds.Expiration.Sub(now) * 3 / 4)
+	}
+	return creds, nil
+}
+
+// fetch reads new credentials from Vault, logging in first if there is no valid token.
+// If the token is rejected, e.g. because it was revoked, it logs in again once.
+func (p *VaultCredentialProvider) fetch() (*Credentials, error) {
+	for retried := false; ; retried = true {
+		if err := p.ensureToken(); err != nil {
+			return nil, err
+		}
+		resp, err := p.do(http.MethodGet, p.credsPath, p.token, nil)
+		if verr, ok := err.(*vaultError); ok && verr.code == http.StatusForbidden && !retried {
+			p.token = ""
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault credentials (%s): %v", p.credsPath, err)
+		}
+		return p.parseCredentials(resp)
+	}
+}
+
+func (p *VaultCredentialProvider) ensureToken() error {
+	if len(p.token) != 0 && (p.tokenRefreshAt.IsZero() || p.now().Before(p.tokenRefreshAt)) {
+		return nil
+	}
+	token, ttl, err := p.login()
+	if err != nil {
+		return err
+	}
+	p.token, p.tokenRefreshAt = token, time.Time{}
+	if ttl > 0 {
+		p.tokenRefreshAt = p.now().Add(ttl * 3 / 4)
+	}
+	return nil
+}
+
+func (p *VaultCredentialProvider) parseCredentials(resp *vaultResponse) (*Credentials, error) {
+	creds := &Credentials{}
+	switch p.engine {
+	case EngineAWS:
+		var data struct {
+			AccessKey     string `json:"access_key"`
+			SecretKey     string `json:"secret_key"`
+			SecurityToken string `json:"security_token"`
+		}
+		if err := json.Unmarshal(resp.Data, &data); err != nil {
+			return nil, fmt.Errorf("failed to parse vault aws credentials: %v", err)
+		}
+		if len(data.AccessKey) == 0 || len(data.SecretKey) == 0 {
+			return nil, fmt.Errorf("vault returned no aws credentials from (%s)", p.credsPath)
+		}
+		creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken = data.AccessKey, data.SecretKey, data.SecurityToken
+		if resp.LeaseDuration > 0 {
+			creds.Expiration = p.now().Add(time.Duration(resp.LeaseDuration) * time.Second)
+		}
+	case EngineGCP:
+		var data struct {
+			Token            string `json:"token"`
+			ExpiresAtSeconds int64  `json:"expires_at_seconds"`
+		}
+		if err := json.Unmarshal(resp.Data, &data); err != nil {
+			return nil, fmt.Errorf("failed to parse vault gcp token: %v", err)
+		}
+		if len(data.Token) == 0 {
+			return nil, fmt.Errorf("vault returned no gcp token from (%s)", p.credsPath)
+		}
+		creds.Token = data.Token
+		if data.ExpiresAtSeconds > 0 {
+			creds.Expiration = time.Unix(data.ExpiresAtSeconds, 0)
+		}
+	}
+	return creds, nil
+}
+
+// vaultResponse is the part of the responses of the Vault HTTP API the provider reads.
+type vaultResponse struct {
+	LeaseDuration int             `json:"lease_duration"`
+	Data          json.RawMessage `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+// vaultError is an error response of the Vault HTTP API.
+type vaultError struct {
+	code   int
+	errors []string
+}
+
+func (e *vaultError) Error() string {
+	return fmt.Sprintf("vault responded %d: %s", e.code, strings.Join(e.errors, "; "))
+}
+
+// do sends a request to the Vault HTTP API at the given path, authenticated by token if not empty.
+func (p *VaultCredentialProvider) do(method, apiPath, token string, body []byte) (*vaultResponse, error) {
+	req, err := http.NewRequest(method, p.address+"/v1/"+apiPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if len(token) != 0 {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		verr := &vaultError{code: resp.StatusCode}
+		var eresp struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(b, &eresp) == nil {
+			verr.errors = eresp.Errors
+		}
+		return nil, verr
+	}
+	vresp := &vaultResponse{}
+	if err = json.Unmarshal(b, vresp); err != nil {
+		return nil, fmt.Errorf("failed to parse vault response: %v", err)
+	}
+	return vresp, nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeVault serves the credentials of the AWS and GCP secrets engines to the requests with a valid token.
+type fakeVault struct {
+	validToken string
+	// fail makes every request fail.
+	fail  bool
+	reads int
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if v.fail {
+		http.Error(w, `{"errors": ["internal error"]}`, http.StatusInternalServerError)
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != v.validToken {
+		http.Error(w, `{"errors": ["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	v.reads++
+	switch r.URL.Path {
+	case "/v1/aws/creds/backup":
+		fmt.Fprintf(w, `{"lease_duration": 100, "data": {"access_key": "AKIA%d", "secret_key": "secret", "security_token": "session"}}`, v.reads)
+	case "/v1/gcp/token/backup":
+		fmt.Fprintf(w, `{"data": {"token": "ya29.%d", "expires_at_seconds": %d}}`, v.reads, time.Date(2018, 1, 1, 1, 0, 0, 0, time.UTC).Unix())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestProvider(addr, engine, credsPath string, login vaultLoginFunc, now *time.Time) *VaultCredentialProvider {
+	return &VaultCredentialProvider{
+		client:    http.DefaultClient,
+		address:   addr,
+		engine:    engine,
+		credsPath: credsPath,
+		login:     login,
+		now:       func() time.Time { return *now },
+	}
+}
+
+func staticToken(token string) vaultLoginFunc {
+	return func() (string, time.Duration, error) { return token, 0, nil }
+}
+
+// TestVaultCredentialProviderRefresh ensures the AWS credentials are cached until three quarters
+// of their lease has passed.
+func TestVaultCredentialProviderRefresh(t *testing.T) {
+	v := &fakeVault{validToken: "token"}
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newTestProvider(srv.URL, EngineAWS, "aws/creds/backup", staticToken("token"), &now)
+
+	tests := []struct {
+		after     time.Duration
+		wantKeyID string
+	}{
+		{0, "AKIA1"},
+		{74 * time.Second, "AKIA1"},
+		{time.Second, "AKIA2"},
+	}
+	for i, tt := range tests {
+		now = now.Add(tt.after)
+		c, err := p.Credentials()
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if c.AccessKeyID != tt.wantKeyID || c.SecretAccessKey != "secret" || c.SessionToken != "session" {
+			t.Errorf("#%d: credentials = %+v, want access key %s", i, c, tt.wantKeyID)
+		}
+		if want := now.Add(100 * time.Second); i == 0 && !c.Expiration.Equal(want) {
+			t.Errorf("#%d: expiration = %v, want %v", i, c.Expiration, want)
+		}
+	}
+}
+
+// TestVaultCredentialProviderRelogin ensures a rejected token is replaced by logging in again.
+func TestVaultCredentialProviderRelogin(t *testing.T) {
+	v := &fakeVault{validToken: "new"}
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	logins := 0
+	login := func() (string, time.Duration, error) {
+		logins++
+		if logins == 1 {
+			return "revoked", 0, nil
+		}
+		return "new", 0, nil
+	}
+	p := newTestProvider(srv.URL, EngineAWS, "aws/creds/backup", login, &now)
+
+	if _, err := p.Credentials(); err != nil {
+		t.Fatal(err)
+	}
+	if logins != 2 {
+		t.Errorf("expect 2 logins, got %d", logins)
+	}
+
+	// a token which is still rejected after logging in again is an error.
+	v.validToken = "other"
+	now = now.Add(time.Hour)
+	if _, err := p.Credentials(); err == nil {
+		t.Error("expect error with a rejected token")
+	}
+}
+
+// TestVaultCredentialProviderKeepsValidCredentials ensures the current credentials are used
+// while Vault is failing until they expire.
+func TestVaultCredentialProviderKeepsValidCredentials(t *testing.T) {
+	v := &fakeVault{validToken: "token"}
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newTestProvider(srv.URL, EngineAWS, "aws/creds/backup", staticToken("token"), &now)
+	if _, err := p.Credentials(); err != nil {
+		t.Fatal(err)
+	}
+
+	v.fail = true
+	now = now.Add(90 * time.Second)
+	c, err := p.Credentials()
+	if err != nil {
+		t.Fatalf("expect the current credentials while they are valid, got %v", err)
+	}
+	if c.AccessKeyID != "AKIA1" {
+		t.Errorf("access key = %s, want AKIA1", c.AccessKeyID)
+	}
+	now = now.Add(20 * time.Second)
+	if _, err = p.Credentials(); err == nil {
+		t.Error("expect error once the credentials expired")
+	}
+}
+
+func TestVaultCredentialProviderGCP(t *testing.T) {
+	v := &fakeVault{validToken: "token"}
+	srv := httptest.NewServer(v)
+	defer srv.Close()
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newTestProvider(srv.URL, EngineGCP, "gcp/token/backup", staticToken("token"), &now)
+
+	c, err := p.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "ya29.1" {
+		t.Errorf("token = %s, want ya29.1", c.Token)
+	}
+	if want := time.Date(2018, 1, 1, 1, 0, 0, 0, time.UTC); !c.Expiration.Equal(want) {
+		t.Errorf("expiration = %v, want %v", c.Expiration, want)
+	}
+	// the token is refreshed after 45 of its 60 minutes.
+	now = now.Add(45 * time.Minute)
+	if c, err = p.Credentials(); err != nil || c.Token != "ya29.2" {
+		t.Errorf("expect refreshed token ya29.2, got %v, %v", c, err)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// defaultDefragTimeout is the timeout of a defragmentation if DefragConfig.Timeout is not set.
+const defaultDefragTimeout = time.Minute
+
+// DefragConfig configures the defragmentation of the member a snapshot is taken from, before the snapshot,
+// so that the snapshot doesn't carry the free pages of its database.
+type DefragConfig struct {
+	// Timeout is the timeout of a defragmentation. If equal to 0, defaultDefragTimeout is used.
+	Timeout time.Duration
+}
+
+// defragment defragments the member at endpoint before its snapshot is taken, and returns the size of its database
+// before the defragmentation, or 0 if it was not defragmented. The leader is never defragmented, since it blocks
+// the writes of the cluster meanwhile, and neither is a member without a leader.
+// Failing to defragment only costs a larger snapshot. Once the timeout expires, the defragmentation is given up on;
+// the member may still finish it before it serves the snapshot.
+func (bm *BackupManager) defragment(ctx context.Context, mcli clientv3.Maintenance, endpoint string) int64 {
+	lg := bm.getLogger().WithField("endpoint", endpoint)
+	st, err := bm.getEtcdStatus(ctx, mcli, endpoint)
+	if err != nil {
+		lg.WithError(err).Warning("skipped defragmenting member: failed to get its status")
+		return 0
+	}
+	switch {
+	case st.Leader == 0:
+		lg.Warning("skipped defragmenting member: it has no leader")
+		return 0
+	case st.Header != nil && st.Leader == st.Header.MemberId:
+		lg.Info("skipped defragmenting member: it is the leader")
+		return 0
+	}
+
+	timeout := bm.defrag.Timeout
+	if timeout == 0 {
+		timeout = defaultDefragTimeout
+	}
+	dctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	if _, err := mcli.Defragment(dctx, endpoint); err != nil {
+		lg.WithError(err).WithField("timeout", timeout).Warning("failed to defragment member, taking the snapshot anyway")
+		return 0
+	}
+	lg.WithFields(logrus.Fields{
+		"size_mb":    util.ToMB(st.DbSize),
+		"duration_s": time.Since(start).Seconds(),
+	}).Info("defragmented member")
+	return st.DbSize
+}
+
+// MemberDefragConfig configures defragmenting every member of the cluster after a number of backups,
+// to give the space freed by the compactions back to the file system.
+type MemberDefragConfig struct {
+	// AfterBackups is how many successful backups the members are defragmented after.
+	AfterBackups int
+	// Timeout is the timeout of defragmenting each member. If equal to 0, defaultDefragTimeout is used.
+	Timeout time.Duration
+	// Counter counts the successful backups. It may be shared by the BackupManagers of a cluster,
+	// e.g. those created for each backup. If nil, DefragmentMembersAfter creates one.
+	Counter *BackupCounter
+}
+
+// BackupCounter counts the successful backups of a cluster until the members are defragmented.
+// It is safe for concurrent use.
+type BackupCounter struct {
+	mu sync.Mutex
+	n  int
+}
+
+// add counts a successful backup. It returns true, and resets the count, once n backups were counted.
+func (c *BackupCounter) add(n int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+	if c.n < n {
+		return false
+	}
+	c.n = 0
+	return true
+}
+
+// DefragmentMembersAfter enables defragmenting every member of the cluster after each cfg.AfterBackups
+// successful backups saved by SaveSnap or SaveSnapWithPrefix.
+func (bm *BackupManager) DefragmentMembersAfter(cfg MemberDefragConfig) {
+	if cfg.Counter == nil {
+		cfg.Counter = &BackupCounter{}
+	}
+	bm.memberDefrag = &cfg
+}
+
+// countBackup counts a successful backup, and defragments the members once enough backups were counted.
+func (bm *BackupManager) countBackup(ctx context.Context, etcdcli *clientv3.Client) {
+	if bm.memberDefrag == nil || bm.memberDefrag.AfterBackups <= 0 {
+		return
+	}
+	if bm.memberDefrag.Counter.add(bm.memberDefrag.AfterBackups) {
+		bm.defragmentMembers(ctx, etcdcli)
+	}
+}
+
+// defragmentMembers defragments the members of the cluster one at a time, so that a single member
+// is unavailable at once, and the leader last. It logs the size of the database of each member
+// before and after its defragmentation.
+// Failing to defragment a member is logged, and the next member is defragmented anyway.
+func (bm *BackupManager) defragmentMembers(ctx context.Context, etcdcli *clientv3.Client) {
+	lctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	resp, err := etcdcli.MemberList(lctx)
+	cancel()
+	if err != nil {
+		bm.getLogger().WithError(err).Warning("skipped defragmenting members: failed to list them")
+		return
+	}
+	var endpoints []string
+	leader := ""
+	for _, m := range resp.Members {
+		if len(m.ClientURLs) == 0 {
+			// the member has not started yet.
+			continue
+		}
+		ep := m.ClientURLs[0]
+		st, err := bm.getEtcdStatus(ctx, etcdcli.Maintenance, ep)
+		if err == nil && st.Leader == m.ID {
+			leader = ep
+			continue
+		}
+		endpoints = append(endpoints, ep)
+	}
+	if len(leader) != 0 {
+		endpoints = append(endpoints, leader)
+	}
+
+	timeout := bm.memberDefrag.Timeout
+	if timeout == 0 {
+		timeout = defaultDefragTimeout
+	}
+	for _, ep := range endpoints {
+		if ctx.Err() != nil {
+			return
+		}
+		lg := bm.getLogger().WithField("endpoint", ep)
+		before, err := bm.getEtcdStatus(ctx, etcdcli.Maintenance, ep)
+		if err != nil {
+			lg.WithError(err).Warning("skipped defragmenting member: failed to get its status")
+			continue
+		}
+		dctx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		_, err = etcdcli.Defragment(dctx, ep)
+		cancel()
+		if err != nil {
+			lg.WithError(err).WithField("timeout", timeout).Warning("failed to defragment member")
+			continue
+		}
+		fields := logrus.Fields{
+			"size_mb_before": util.ToMB(before.DbSize),
+			"duration_s":     time.Since(start).Seconds(),
+		}
+		if after, err := bm.getEtcdStatus(ctx, etcdcli.Maintenance, ep); err == nil {
+			fields["size_mb_after"] = util.ToMB(after.DbSize)
+		}
+		lg.WithFields(fields).Info("defragmented member")
+	}
+}
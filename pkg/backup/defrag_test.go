@@ -0,0 +1,96 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"golang.org/x/net/context"
+)
+
+// defragMaintenanceClient is a member of 4MB whose defragmentation takes delay, or fails with err.
+type defragMaintenanceClient struct {
+	clientv3.Maintenance
+	memberID, leader uint64
+	delay            time.Duration
+	err              error
+
+	defragmented bool
+}
+
+func (c *defragMaintenanceClient) Status(ctx context.Context, endpoint string) (*clientv3.StatusResponse, error) {
+	return &clientv3.StatusResponse{Header: &etcdserverpb.ResponseHeader{MemberId: c.memberID}, Leader: c.leader, DbSize: 4 * 1024 * 1024}, nil
+}
+
+func (c *defragMaintenanceClient) Defragment(ctx context.Context, endpoint string) (*clientv3.DefragmentResponse, error) {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.defragmented = true
+	return &clientv3.DefragmentResponse{}, nil
+}
+
+// TestDefragment ensures only a follower with a leader is defragmented, and that the snapshot is taken
+// anyway once the defragmentation fails or times out.
+func TestDefragment(t *testing.T) {
+	tests := []struct {
+		desc   string
+		mcli   *defragMaintenanceClient
+		wantDB int64
+	}{
+		{desc: "follower", mcli: &defragMaintenanceClient{memberID: 1, leader: 2}, wantDB: 4 * 1024 * 1024},
+		{desc: "leader", mcli: &defragMaintenanceClient{memberID: 1, leader: 1}},
+		{desc: "no leader", mcli: &defragMaintenanceClient{memberID: 1}},
+		{desc: "failure", mcli: &defragMaintenanceClient{memberID: 1, leader: 2, err: errors.New("etcdserver: request timed out")}},
+		{desc: "timeout", mcli: &defragMaintenanceClient{memberID: 1, leader: 2, delay: time.Second}},
+	}
+	for _, tt := range tests {
+		bm := &BackupManager{defrag: &DefragConfig{Timeout: 50 * time.Millisecond}}
+		start := time.Now()
+		if got := bm.defragment(context.Background(), tt.mcli, ""); got != tt.wantDB {
+			t.Errorf("%s: size before defragmentation = %d, want %d", tt.desc, got, tt.wantDB)
+		}
+		if tt.mcli.defragmented != (tt.wantDB != 0) {
+			t.Errorf("%s: defragmented = %v, want %v", tt.desc, tt.mcli.defragmented, tt.wantDB != 0)
+		}
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Errorf("%s: defragment took %v, want it given up on after the timeout", tt.desc, d)
+		}
+	}
+}
+
+// TestBackupCounter ensures the counter fires on every nth backup, and starts over after it.
+func TestBackupCounter(t *testing.T) {
+	c := &BackupCounter{}
+	var got []bool
+	for i := 0; i < 7; i++ {
+		got = append(got, c.add(3))
+	}
+	want := []bool{false, false, true, false, false, true, false}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("add results = %v, want %v", got, want)
+		}
+	}
+}
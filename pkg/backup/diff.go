@@ -0,0 +1,72 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
+	"github.com/coreos/etcd-operator/pkg/backup/diff"
+)
+
+// DiffBackups returns the changes of the keys from the backup with the name from to the one with the name to.
+// bolt needs random access to read the backups, so they are downloaded to temporary files first.
+func (bm *BackupManager) DiffBackups(from, to string) ([]diff.KeyChange, error) {
+	dir, err := ioutil.TempDir("", "etcd-backup-diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	fromPath, toPath := filepath.Join(dir, "from"), filepath.Join(dir, "to")
+	if err = bm.downloadBackup(from, fromPath); err != nil {
+		return nil, err
+	}
+	if err = bm.downloadBackup(to, toPath); err != nil {
+		return nil, err
+	}
+	return diff.Diff(fromPath, toPath)
+}
+
+// downloadBackup saves the snapshot of the backup with the given name to the file at p, decompressed.
+func (bm *BackupManager) downloadBackup(name, p string) error {
+	rc, err := bm.be.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open backup (%s): %v", name, err)
+	}
+	dr, err := compression.NewDecompressReader(name, rc)
+	if err != nil {
+		rc.Close()
+		return err
+	}
+	defer dr.Close()
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, dr)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download backup (%s): %v", name, err)
+	}
+	return nil
+}
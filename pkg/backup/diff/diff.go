@@ -0,0 +1,122 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diff computes the key-level changes between two etcd snapshots.
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// ChangeType is the type of the change of a key between two snapshots.
+type ChangeType string
+
+const (
+	Added    ChangeType = "added"
+	Deleted  ChangeType = "deleted"
+	Modified ChangeType = "modified"
+)
+
+// keyBucket is the bolt bucket where etcd keeps the revisions of the keys, see
+// https://github.com/coreos/etcd/blob/v3.1.9/mvcc/kvstore.go.
+var keyBucket = []byte("key")
+
+// The keys of keyBucket are revisions: the 8 byte big-endian main revision, '_', and the
+// 8 byte big-endian sub revision. The revision of a deletion is followed by markTombstone.
+const (
+	revBytesLen   = 8 + 1 + 8
+	markTombstone = 't'
+)
+
+// KeyChange is the change of a key between two snapshots.
+type KeyChange struct {
+	Key []byte `json:"key"`
+	// OldValue is the value of the key in the first snapshot. It is nil if the key was added.
+	OldValue []byte `json:"oldValue,omitempty"`
+	// NewValue is the value of the key in the second snapshot. It is nil if the key was deleted.
+	NewValue   []byte     `json:"newValue,omitempty"`
+	ChangeType ChangeType `json:"changeType"`
+}
+
+// Diff returns the changes of the keys from the etcd snapshot at snap1Path to the one at snap2Path
+// in ascending key order. The keys whose value is the same in both snapshots are left out.
+// The keys and values of both snapshots are held in memory.
+func Diff(snap1Path, snap2Path string) ([]KeyChange, error) {
+	kvs1, err := readKeyValues(snap1Path)
+	if err != nil {
+		return nil, err
+	}
+	kvs2, err := readKeyValues(snap2Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []KeyChange
+	for k, v1 := range kvs1 {
+		v2, ok := kvs2[k]
+		switch {
+		case !ok:
+			changes = append(changes, KeyChange{Key: []byte(k), OldValue: v1, ChangeType: Deleted})
+		case !bytes.Equal(v1, v2):
+			changes = append(changes, KeyChange{Key: []byte(k), OldValue: v1, NewValue: v2, ChangeType: Modified})
+		}
+	}
+	for k, v2 := range kvs2 {
+		if _, ok := kvs1[k]; !ok {
+			changes = append(changes, KeyChange{Key: []byte(k), NewValue: v2, ChangeType: Added})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return bytes.Compare(changes[i].Key, changes[j].Key) < 0 })
+	return changes, nil
+}
+
+// readKeyValues returns the value of each key in the etcd snapshot at the given path at its latest revision.
+func readKeyValues(path string) (map[string][]byte, error) {
+	db, err := bolt.Open(path, 0400, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot database (%s): %v", path, err)
+	}
+	defer db.Close()
+
+	kvs := make(map[string][]byte)
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(keyBucket)
+		if b == nil {
+			return errors.New("no key bucket")
+		}
+		// the revisions are iterated in ascending order, so the latest revision of a key is applied last.
+		return b.ForEach(func(rev, v []byte) error {
+			var kv mvccpb.KeyValue
+			if err := kv.Unmarshal(v); err != nil {
+				return fmt.Errorf("failed to decode key at revision %x: %v", rev, err)
+			}
+			if len(rev) == revBytesLen+1 && rev[revBytesLen] == markTombstone {
+				delete(kvs, string(kv.Key))
+				return nil
+			}
+			kvs[string(kv.Key)] = kv.Value
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot (%s): %v", path, err)
+	}
+	return kvs, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// testOp is a put of value to key, or a deletion of key if del is true.
+type testOp struct {
+	key, value string
+	del        bool
+}
+
+// writeTestSnap writes a bolt database laid out like the key bucket of etcd with the revisions of ops,
+// starting at revision 2, to the given path.
+func writeTestSnap(t *testing.T, p string, ops []testOp) {
+	db, err := bolt.Open(p, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(keyBucket)
+		if err != nil {
+			return err
+		}
+		for i, op := range ops {
+			rev := make([]byte, revBytesLen, revBytesLen+1)
+			binary.BigEndian.PutUint64(rev, uint64(i+2))
+			rev[8] = '_'
+			kv := mvccpb.KeyValue{Key: []byte(op.key), ModRevision: int64(i + 2)}
+			if op.del {
+				rev = append(rev, markTombstone)
+			} else {
+				kv.Value = []byte(op.value)
+			}
+			v, err := kv.Marshal()
+			if err != nil {
+				return err
+			}
+			if err = b.Put(rev, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	snap1 := filepath.Join(dir, "snap1")
+	writeTestSnap(t, snap1, []testOp{
+		{key: "a", value: "1"},
+		{key: "b", value: "1"},
+		{key: "c", value: "1"},
+		{key: "d", value: "1"},
+		{key: "d", del: true},
+	})
+	// the second snapshot has the history of the first one.
+	snap2 := filepath.Join(dir, "snap2")
+	writeTestSnap(t, snap2, []testOp{
+		{key: "a", value: "1"},
+		{key: "b", value: "1"},
+		{key: "c", value: "1"},
+		{key: "d", value: "1"},
+		{key: "d", del: true},
+		{key: "b", value: "2"},
+		{key: "c", del: true},
+		{key: "e", value: "1"},
+		{key: "a", value: "2"},
+		{key: "a", value: "1"},
+	})
+
+	changes, err := Diff(snap1, snap2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []KeyChange{
+		{Key: []byte("b"), OldValue: []byte("1"), NewValue: []byte("2"), ChangeType: Modified},
+		{Key: []byte("c"), OldValue: []byte("1"), ChangeType: Deleted},
+		{Key: []byte("e"), NewValue: []byte("1"), ChangeType: Added},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %+v, want %+v", changes, want)
+	}
+
+	if changes, err = Diff(snap1, snap1); err != nil || len(changes) != 0 {
+		t.Errorf("changes of a snapshot to itself = %+v, %v, want none", changes, err)
+	}
+	if _, err = Diff(snap1, filepath.Join(dir, "missing")); err == nil {
+		t.Error("expect diffing a missing snapshot to fail")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+var _ KeyProvider = &awsKMSKeyProvider{}
+
+// awsKMSKeyProvider encrypts data keys with an AWS KMS customer master key.
+type awsKMSKeyProvider struct {
+	kms   *kms.KMS
+	keyID string
+}
+
+// NewAWSKMSKeyProvider returns a KeyProvider that encrypts data keys with the AWS KMS key
+// of the given ID, ARN or alias.
+func NewAWSKMSKeyProvider(kmscli *kms.KMS, keyID string) KeyProvider {
+	return &awsKMSKeyProvider{kms: kmscli, keyID: keyID}
+}
+
+func (p *awsKMSKeyProvider) KeyID() string {
+	return p.keyID
+}
+
+func (p *awsKMSKeyProvider) Encrypt(plaintext []byte) ([]byte, error) {
+	out, err := p.kms.Encrypt(&kms.EncryptInput{
+		KeyId:     aws.String(p.keyID),
+		Plaintext: plaintext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.CiphertextBlob, nil
+}
+
+// Decrypt decrypts the ciphertext with the key it was encrypted with, which the ciphertext identifies.
+func (p *awsKMSKeyProvider) Decrypt(ciphertext []byte) ([]byte, error) {
+	out, err := p.kms.Decrypt(&kms.DecryptInput{
+		CiphertextBlob: ciphertext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
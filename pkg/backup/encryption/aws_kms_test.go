@@ -0,0 +1,112 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+const testAWSKMSKeyID = "alias/etcd-backup"
+
+// newFakeAWSKMSServer returns a server which "encrypts" by prefixing the plaintext with the key ID.
+// It only knows the key testAWSKMSKeyID.
+func newFakeAWSKMSServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			KeyId          string
+			Plaintext      []byte
+			CiphertextBlob []byte
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		prefix := []byte(testAWSKMSKeyID + ":")
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			if req.KeyId != testAWSKMSKeyID {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"NotFoundException","message":"Invalid keyId"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"KeyId":          req.KeyId,
+				"CiphertextBlob": append(prefix, req.Plaintext...),
+			})
+		case "TrentService.Decrypt":
+			if !bytes.HasPrefix(req.CiphertextBlob, prefix) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"InvalidCiphertextException","message":"invalid ciphertext"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"KeyId":     testAWSKMSKeyID,
+				"Plaintext": req.CiphertextBlob[len(prefix):],
+			})
+		default:
+			http.Error(w, "unsupported operation", http.StatusBadRequest)
+		}
+	}))
+}
+
+func newTestAWSKMSClient(t *testing.T, endpoint string) *kms.KMS {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(endpoint),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kms.New(sess)
+}
+
+func TestAWSKMSKeyProvider(t *testing.T) {
+	ts := newFakeAWSKMSServer()
+	defer ts.Close()
+	kp := NewAWSKMSKeyProvider(newTestAWSKMSClient(t, ts.URL), testAWSKMSKeyID)
+	if kp.KeyID() != testAWSKMSKeyID {
+		t.Errorf("key ID = %s, want %s", kp.KeyID(), testAWSKMSKeyID)
+	}
+
+	data := []byte(strings.Repeat("etcd snapshot", 1000))
+	got, err := decrypt(encrypt(t, data, kp), kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("decrypted %d bytes differ from the original", len(got))
+	}
+
+	if _, err = kp.Decrypt([]byte("not encrypted")); err == nil {
+		t.Error("expect decrypting an invalid ciphertext to fail")
+	}
+	invalid := NewAWSKMSKeyProvider(newTestAWSKMSClient(t, ts.URL), "alias/invalid")
+	if _, err = NewEncryptReader(bytes.NewReader(data), invalid); err == nil || !strings.Contains(err.Error(), "alias/invalid") {
+		t.Errorf("expect encryption with an invalid key to fail naming the key, got %v", err)
+	}
+}
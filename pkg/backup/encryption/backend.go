@@ -0,0 +1,138 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+var _ backend.Backend = &encryptedBackend{}
+
+// encryptedBackend encrypts the backups and deltas saved to the wrapped backend.
+type encryptedBackend struct {
+	backend.Backend
+	kp KeyProvider
+	// accepted are the providers of the keys files are decrypted with, by key ID.
+	accepted map[string]KeyProvider
+}
+
+// NewBackend returns a backend that encrypts the backups and deltas saved to be with data keys
+// encrypted by kp, and decrypts them when opened. The ID of the key is stored in the name of
+// each encrypted file; see util.MakeEncryptedName. Files saved without encryption are opened as is.
+// Files encrypted with the keys of the accepted providers, e.g. before the key is rotated,
+// are decrypted too.
+func NewBackend(be backend.Backend, kp KeyProvider, accepted ...KeyProvider) backend.Backend {
+	eb := &encryptedBackend{
+		Backend:  be,
+		kp:       kp,
+		accepted: map[string]KeyProvider{kp.KeyID(): kp},
+	}
+	for _, p := range accepted {
+		eb.accepted[p.KeyID()] = p
+	}
+	return eb
+}
+
+func (eb *encryptedBackend) Save(ctx context.Context, version string, snapRev int64, r io.Reader) (int64, error) {
+	return eb.save(ctx, util.MakeBackupName(version, snapRev), r)
+}
+
+func (eb *encryptedBackend) SaveDelta(ctx context.Context, version string, rev int64, r io.Reader) (int64, error) {
+	return eb.save(ctx, util.MakeDeltaName(version, rev), r)
+}
+
+// SaveChecksum saves the checksum of the backup next to the encrypted backup.
+// The checksum is of the backup before encryption, so it's checked against the decrypted backup.
+func (eb *encryptedBackend) SaveChecksum(ctx context.Context, version string, rev int64, sum string) error {
+	_, err := eb.SaveAs(ctx, util.MakeChecksumName(util.MakeBackupName(version, rev)), strings.NewReader(sum))
+	return err
+}
+
+// SaveAs encrypts the file saved under the given name, e.g. a compressed backup.
+// Checksums and cluster metadata are saved in plaintext next to the encrypted file they are of.
+func (eb *encryptedBackend) SaveAs(ctx context.Context, name string, r io.Reader) (int64, error) {
+	if _, ext := splitPlaintextExtension(name); len(ext) != 0 {
+		return eb.Backend.SaveAs(ctx, eb.encryptedName(name), r)
+	}
+	return eb.save(ctx, name, r)
+}
+
+func (eb *encryptedBackend) save(ctx context.Context, name string, r io.Reader) (int64, error) {
+	er, err := NewEncryptReader(r, eb.kp)
+	if err != nil {
+		return -1, err
+	}
+	return eb.Backend.SaveAs(ctx, util.MakeEncryptedName(name, eb.kp.KeyID()), er)
+}
+
+// Delete deletes the file saved under the given name by SaveAs. A name listed by List, which is
+// the encrypted name already, is deleted as is.
+func (eb *encryptedBackend) Delete(name string) error {
+	return eb.Backend.Delete(eb.encryptedName(name))
+}
+
+// encryptedName returns the name the file saved under the given name by SaveAs is stored under.
+func (eb *encryptedBackend) encryptedName(name string) string {
+	if base, ext := splitPlaintextExtension(name); len(ext) != 0 {
+		return eb.encryptedName(base) + ext
+	}
+	if _, _, ok := util.ParseEncryptedName(name); ok {
+		return name
+	}
+	return util.MakeEncryptedName(name, eb.kp.KeyID())
+}
+
+// splitPlaintextExtension splits the name of a file saved in plaintext next to a backup into the name
+// of the backup and the extension of the file. The extension is empty for other files.
+func splitPlaintextExtension(name string) (string, string) {
+	for _, ext := range []string{util.ChecksumFileExtension, util.ClusterMetadataFileExtension} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext), ext
+		}
+	}
+	return name, ""
+}
+
+func (eb *encryptedBackend) Open(name string) (io.ReadCloser, error) {
+	_, keyID, ok := util.ParseEncryptedName(name)
+	if !ok {
+		return eb.Backend.Open(name)
+	}
+	kp, ok := eb.accepted[keyID]
+	if !ok {
+		return nil, fmt.Errorf("failed to decrypt (%s): it is encrypted with key (%s), which is not an accepted key", name, keyID)
+	}
+	rc, err := eb.Backend.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := NewDecryptReader(rc, kp)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to decrypt (%s) encrypted with key (%s): %v", name, keyID, err)
+	}
+	return &readCloser{Reader: dr, Closer: rc}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
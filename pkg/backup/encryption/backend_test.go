@@ -0,0 +1,198 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+func TestBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(filepath.Join(dir, util.BackupTmpDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	kp := newTestKeyProvider(t, "projects/p/locations/global/keyRings/r/cryptoKeys/k")
+	be := NewBackend(backend.NewFileBackend(dir), kp)
+	data := "snapshot data"
+	if _, err = be.Save(context.Background(), "3.1.8", 10, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err = be.SaveChecksum(context.Background(), "3.1.8", 10, "sum"); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := be.GetLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := util.MakeEncryptedName(util.MakeBackupName("3.1.8", 10), kp.KeyID()); name != want {
+		t.Fatalf("latest backup = %s, want %s", name, want)
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), data) {
+		t.Error("backup is saved in plaintext")
+	}
+
+	for n, want := range map[string]string{name: data, util.MakeChecksumName(name): "sum"} {
+		rc, err := be.Open(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", n, got, want)
+		}
+	}
+}
+
+// TestBackendCompressed ensures compressed backups, which are saved with SaveAs, are encrypted too.
+func TestBackendCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(filepath.Join(dir, util.BackupTmpDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	kp := newTestKeyProvider(t, "projects/p/locations/global/keyRings/r/cryptoKeys/k")
+	be := NewBackend(backend.NewFileBackend(dir), kp)
+	data := strings.Repeat("snapshot data", 1024)
+	name := compression.MakeName(util.MakeBackupName("3.1.8", 10), compression.Gzip)
+	cr := compression.NewCompressReader(strings.NewReader(data), compression.Gzip, compression.DefaultLevel)
+	_, err = be.SaveAs(context.Background(), name, cr)
+	cr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = be.SaveAs(context.Background(), util.MakeChecksumName(name), strings.NewReader("sum")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = be.SaveAs(context.Background(), util.MakeClusterMetadataName(name), strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := be.GetLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := util.MakeEncryptedName(name, kp.KeyID()); latest != want {
+		t.Fatalf("latest backup = %s, want %s", latest, want)
+	}
+	if _, err = os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+		t.Errorf("expect no plaintext backup (%s), get=%v", name, err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, util.MakeChecksumName(latest))); err != nil {
+		t.Errorf("expect the checksum next to the encrypted backup: %v", err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, util.MakeClusterMetadataName(latest))); err != nil || string(b) != "{}" {
+		t.Errorf("expect the plaintext cluster metadata next to the encrypted backup, get=%q, %v", b, err)
+	}
+
+	rc, err := be.Open(latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := compression.NewDecompressReader(latest, rc)
+	if err != nil {
+		rc.Close()
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(dr)
+	dr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("read %d bytes, want the %d bytes of the snapshot", len(got), len(data))
+	}
+
+	// the files saved by SaveAs are deleted by the names they are saved under.
+	for _, n := range []string{name, util.MakeChecksumName(name), util.MakeClusterMetadataName(name)} {
+		if err = be.Delete(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range []string{latest, util.MakeChecksumName(latest), util.MakeClusterMetadataName(latest)} {
+		if _, err = os.Stat(filepath.Join(dir, n)); !os.IsNotExist(err) {
+			t.Errorf("expect %s to be deleted, get=%v", n, err)
+		}
+	}
+}
+
+// TestBackendKeyRotation ensures backups encrypted before the key is rotated are decrypted
+// with the accepted keys, and fail clearly without them.
+func TestBackendKeyRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Mkdir(filepath.Join(dir, util.BackupTmpDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	oldKey, err := NewSecretKeyProvider(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := NewSecretKeyProvider(bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "snapshot data"
+	if _, err = NewBackend(backend.NewFileBackend(dir), oldKey).Save(context.Background(), "3.1.8", 10, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	name := util.MakeEncryptedName(util.MakeBackupName("3.1.8", 10), oldKey.KeyID())
+
+	_, err = NewBackend(backend.NewFileBackend(dir), newKey).Open(name)
+	if err == nil || !strings.Contains(err.Error(), "not an accepted key") {
+		t.Errorf("expect not accepted key error, get=%v", err)
+	}
+
+	rc, err := NewBackend(backend.NewFileBackend(dir), newKey, oldKey).Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(got) != data {
+		t.Errorf("read %q (%v), want %q", got, err, data)
+	}
+}
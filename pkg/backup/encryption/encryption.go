@@ -0,0 +1,233 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encryption encrypts backups at rest.
+//
+// Each backup is encrypted with AES-256-GCM using a random data key. The data key is
+// encrypted by a KeyProvider, e.g. a KMS or a key in a Secret, and stored in the header of the encrypted backup.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// magic identifies the format of an encrypted backup.
+	magic = "ETCDENC1"
+
+	dataKeySize = 32
+	// chunkSize is the size of the plaintext sealed at a time,
+	// so that a backup is never fully buffered in memory.
+	chunkSize = 64 * 1024
+	// maxWrappedKeySize bounds the size of the encrypted data key read from the header.
+	maxWrappedKeySize = 4096
+)
+
+var (
+	errTruncated = errors.New("encrypted backup is truncated")
+	errCorrupted = errors.New("encrypted backup is corrupted or encrypted with another key")
+)
+
+// KeyProvider encrypts and decrypts the data keys of the backups.
+type KeyProvider interface {
+	// KeyID returns the ID of the key used to encrypt data keys.
+	KeyID() string
+	// Encrypt encrypts the given plaintext.
+	Encrypt(plaintext []byte) ([]byte, error)
+	// Decrypt decrypts the ciphertext returned by Encrypt.
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// NewEncryptReader returns a reader of the encrypted content of r.
+// The data key is generated and encrypted by kp before NewEncryptReader returns.
+func NewEncryptReader(r io.Reader, kp KeyProvider) (io.Reader, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %v", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := kp.Encrypt(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt data key with key (%s): %v", kp.KeyID(), err)
+	}
+	if len(wrapped) > maxWrappedKeySize {
+		return nil, fmt.Errorf("encrypted data key is too large (%d bytes)", len(wrapped))
+	}
+
+	er := &encryptReader{
+		src:  r,
+		aead: aead,
+		buf:  make([]byte, chunkSize),
+	}
+	er.out.WriteString(magic)
+	binary.Write(&er.out, binary.BigEndian, uint32(len(wrapped)))
+	er.out.Write(wrapped)
+	return er, nil
+}
+
+// NewDecryptReader returns a reader of the decrypted content of r, which is encrypted by NewEncryptReader.
+// Reading returns an error if the content is modified or truncated.
+func NewDecryptReader(r io.Reader, kp KeyProvider) (io.Reader, error) {
+	hdr := make([]byte, len(magic)+4)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+	if string(hdr[:len(magic)]) != magic {
+		return nil, errors.New("not an encrypted backup")
+	}
+	n := binary.BigEndian.Uint32(hdr[len(magic):])
+	if n > maxWrappedKeySize {
+		return nil, errCorrupted
+	}
+	wrapped := make([]byte, n)
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, fmt.Errorf("failed to read data key: %v", err)
+	}
+	key, err := kp.Decrypt(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key with key (%s): %v", kp.KeyID(), err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		src:  r,
+		aead: aead,
+		buf:  make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of the seq-th chunk. Since every backup has its own data key,
+// a counter never repeats a nonce under the same key. The final chunk has a distinct nonce
+// so that a truncated backup cannot pass as a complete one.
+func chunkNonce(seq uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	if final {
+		nonce[0] = 1
+	}
+	binary.BigEndian.PutUint64(nonce[4:], seq)
+	return nonce
+}
+
+type encryptReader struct {
+	src  io.Reader
+	aead cipher.AEAD
+	buf  []byte
+	out  bytes.Buffer
+	seq  uint64
+	done bool
+}
+
+func (er *encryptReader) Read(p []byte) (int, error) {
+	for er.out.Len() == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+		if err := er.sealChunk(); err != nil {
+			return 0, err
+		}
+	}
+	return er.out.Read(p)
+}
+
+// sealChunk encrypts the next chunk of the source into the output buffer.
+// Each chunk is written as its size followed by the sealed chunk.
+func (er *encryptReader) sealChunk() error {
+	n, err := io.ReadFull(er.src, er.buf)
+	final := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		final = true
+	default:
+		return err
+	}
+	sealed := er.aead.Seal(nil, chunkNonce(er.seq, final), er.buf[:n], nil)
+	binary.Write(&er.out, binary.BigEndian, uint32(len(sealed)))
+	er.out.Write(sealed)
+	er.seq++
+	er.done = final
+	return nil
+}
+
+type decryptReader struct {
+	src  io.Reader
+	aead cipher.AEAD
+	buf  []byte
+	out  bytes.Buffer
+	seq  uint64
+	done bool
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for dr.out.Len() == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.openChunk(); err != nil {
+			return 0, err
+		}
+	}
+	return dr.out.Read(p)
+}
+
+func (dr *decryptReader) openChunk() error {
+	var n uint32
+	if err := binary.Read(dr.src, binary.BigEndian, &n); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncated
+		}
+		return err
+	}
+	if int(n) > len(dr.buf) {
+		return errCorrupted
+	}
+	sealed := dr.buf[:n]
+	if _, err := io.ReadFull(dr.src, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncated
+		}
+		return err
+	}
+	plain, err := dr.aead.Open(nil, chunkNonce(dr.seq, false), sealed, nil)
+	if err != nil {
+		plain, err = dr.aead.Open(nil, chunkNonce(dr.seq, true), sealed, nil)
+		if err != nil {
+			return errCorrupted
+		}
+		dr.done = true
+	}
+	dr.out.Write(plain)
+	dr.seq++
+	return nil
+}
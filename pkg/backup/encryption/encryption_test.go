@@ -0,0 +1,105 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func newTestKeyProvider(t *testing.T, keyID string) KeyProvider {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		t.Fatal(err)
+	}
+	kp, err := NewLocalKeyProvider(keyID, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp
+}
+
+func encrypt(t *testing.T, data []byte, kp KeyProvider) []byte {
+	er, err := NewEncryptReader(bytes.NewReader(data), kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := ioutil.ReadAll(er)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+func decrypt(data []byte, kp KeyProvider) ([]byte, error) {
+	dr, err := NewDecryptReader(bytes.NewReader(data), kp)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(dr)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	kp := newTestKeyProvider(t, "test-key")
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 100} {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(rand.Reader, data); err != nil {
+			t.Fatal(err)
+		}
+		enc := encrypt(t, data, kp)
+		if size >= 16 && bytes.Contains(enc, data) {
+			t.Errorf("size %d: encrypted backup contains the plaintext", size)
+		}
+		got, err := decrypt(enc, kp)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("size %d: decrypted %d bytes differ from the original", size, len(got))
+		}
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	kp := newTestKeyProvider(t, "test-key")
+	data := make([]byte, 2*chunkSize+10)
+	enc := encrypt(t, data, kp)
+
+	modified := append([]byte(nil), enc...)
+	modified[len(modified)-1] ^= 1
+	// cut right after the first chunk so that the rest looks like a complete backup.
+	hdrSize := len(enc) - (2*chunkSize + 10) - 3*(4+16)
+	firstChunkEnd := hdrSize + 4 + chunkSize + 16
+
+	tests := []struct {
+		name string
+		data []byte
+		kp   KeyProvider
+	}{
+		{"modified", modified, kp},
+		{"truncated in a chunk", enc[:len(enc)-5], kp},
+		{"truncated at a chunk boundary", enc[:firstChunkEnd], kp},
+		{"wrong key", enc, newTestKeyProvider(t, "test-key")},
+		{"not encrypted", data, kp},
+	}
+	for _, tt := range tests {
+		if _, err := decrypt(tt.data, tt.kp); err == nil {
+			t.Errorf("%s: expect decryption to fail", tt.name)
+		}
+	}
+}
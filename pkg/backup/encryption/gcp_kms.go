@@ -0,0 +1,59 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"encoding/base64"
+
+	cloudkms "google.golang.org/api/cloudkms/v1"
+)
+
+var _ KeyProvider = &gcpKMSKeyProvider{}
+
+// gcpKMSKeyProvider encrypts data keys with a GCP Cloud KMS crypto key.
+type gcpKMSKeyProvider struct {
+	keys *cloudkms.ProjectsLocationsKeyRingsCryptoKeysService
+	name string
+}
+
+// NewGCPKMSKeyProvider returns a KeyProvider that encrypts data keys with the Cloud KMS crypto key
+// of the given resource name, "projects/*/locations/*/keyRings/*/cryptoKeys/*".
+func NewGCPKMSKeyProvider(svc *cloudkms.Service, keyName string) KeyProvider {
+	return &gcpKMSKeyProvider{keys: svc.Projects.Locations.KeyRings.CryptoKeys, name: keyName}
+}
+
+func (p *gcpKMSKeyProvider) KeyID() string {
+	return p.name
+}
+
+func (p *gcpKMSKeyProvider) Encrypt(plaintext []byte) ([]byte, error) {
+	resp, err := p.keys.Encrypt(p.name, &cloudkms.EncryptRequest{
+		Plaintext: base64.StdEncoding.EncodeToString(plaintext),
+	}).Do()
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Ciphertext)
+}
+
+func (p *gcpKMSKeyProvider) Decrypt(ciphertext []byte) ([]byte, error) {
+	resp, err := p.keys.Decrypt(p.name, &cloudkms.DecryptRequest{
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}).Do()
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
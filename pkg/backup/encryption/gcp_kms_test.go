@@ -0,0 +1,105 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cloudkms "google.golang.org/api/cloudkms/v1"
+)
+
+const testGCPKMSKeyName = "projects/p/locations/global/keyRings/etcd/cryptoKeys/backup"
+
+// newFakeGCPKMSServer returns a server which "encrypts" by prefixing the plaintext with the key name.
+// It only knows the key testGCPKMSKeyName.
+func newFakeGCPKMSServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Plaintext  string `json:"plaintext"`
+			Ciphertext string `json:"ciphertext"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		prefix := []byte(testGCPKMSKeyName + ":")
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/" + testGCPKMSKeyName + ":encrypt":
+			b, err := base64.StdEncoding.DecodeString(req.Plaintext)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{
+				"name":       testGCPKMSKeyName,
+				"ciphertext": base64.StdEncoding.EncodeToString(append(prefix, b...)),
+			})
+		case "/v1/" + testGCPKMSKeyName + ":decrypt":
+			b, err := base64.StdEncoding.DecodeString(req.Ciphertext)
+			if err != nil || !bytes.HasPrefix(b, prefix) {
+				http.Error(w, `{"error":{"code":400,"message":"invalid ciphertext"}}`, http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{
+				"plaintext": base64.StdEncoding.EncodeToString(b[len(prefix):]),
+			})
+		default:
+			http.Error(w, `{"error":{"code":404,"message":"crypto key not found"}}`, http.StatusNotFound)
+		}
+	}))
+}
+
+func newTestGCPKMSService(t *testing.T, endpoint string) *cloudkms.Service {
+	svc, err := cloudkms.New(http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.BasePath = endpoint + "/"
+	return svc
+}
+
+func TestGCPKMSKeyProvider(t *testing.T) {
+	ts := newFakeGCPKMSServer()
+	defer ts.Close()
+	kp := NewGCPKMSKeyProvider(newTestGCPKMSService(t, ts.URL), testGCPKMSKeyName)
+	if kp.KeyID() != testGCPKMSKeyName {
+		t.Errorf("key ID = %s, want %s", kp.KeyID(), testGCPKMSKeyName)
+	}
+
+	data := []byte(strings.Repeat("etcd snapshot", 1000))
+	got, err := decrypt(encrypt(t, data, kp), kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("decrypted %d bytes differ from the original", len(got))
+	}
+
+	if _, err = kp.Decrypt([]byte("not encrypted")); err == nil {
+		t.Error("expect decrypting an invalid ciphertext to fail")
+	}
+	unknown := "projects/p/locations/global/keyRings/etcd/cryptoKeys/unknown"
+	invalid := NewGCPKMSKeyProvider(newTestGCPKMSService(t, ts.URL), unknown)
+	if _, err = NewEncryptReader(bytes.NewReader(data), invalid); err == nil || !strings.Contains(err.Error(), unknown) {
+		t.Errorf("expect encryption with an unknown key to fail naming the key, got %v", err)
+	}
+}
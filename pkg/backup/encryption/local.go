@@ -0,0 +1,83 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var _ KeyProvider = &localKeyProvider{}
+
+// localKeyProvider encrypts data keys with a local AES-256-GCM key.
+type localKeyProvider struct {
+	keyID string
+	key   []byte
+}
+
+// NewLocalKeyProvider returns a KeyProvider that encrypts data keys with the given
+// 32 bytes AES-256 key. It is meant for testing; use a KMS or NewSecretKeyProvider in production.
+func NewLocalKeyProvider(keyID string, key []byte) (KeyProvider, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid AES-256 key size %d, want 32", len(key))
+	}
+	return &localKeyProvider{keyID: keyID, key: key}, nil
+}
+
+// NewSecretKeyProvider returns a KeyProvider that encrypts data keys with the given
+// 32 bytes AES-256 key, e.g. read from a Secret. The key ID is the fingerprint of the key,
+// so that a backup names the key it needs without revealing it.
+func NewSecretKeyProvider(key []byte) (KeyProvider, error) {
+	return NewLocalKeyProvider(KeyFingerprint(key), key)
+}
+
+// KeyFingerprint returns the fingerprint of the given key, "sha256:" followed by
+// the first 16 hex digits of its SHA-256 hash.
+func KeyFingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+func (p *localKeyProvider) KeyID() string {
+	return p.keyID
+}
+
+func (p *localKeyProvider) Encrypt(plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(p.key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (p *localKeyProvider) Decrypt(ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD(p.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], nil)
+}
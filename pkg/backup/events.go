@@ -0,0 +1,72 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"fmt"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+// failureEventInterval is the minimum time between two identical failure events,
+// so that a backup failing over and over, e.g. with a flapping storage, doesn't flood the events.
+const failureEventInterval = 10 * time.Minute
+
+// RecordEvents makes bm emit an event on the EtcdCluster with recorder after each backup SaveSnap saves or fails to save.
+// Identical failures are emitted at most once every 10 minutes.
+func (bm *BackupManager) RecordEvents(recorder record.EventRecorder) {
+	bm.recorder = recorder
+}
+
+// recordBackupEvent emits the event of the backup saved with status bs, or failed with err.
+// A skipped backup emits no event.
+func (bm *BackupManager) recordBackupEvent(bs *backupapi.BackupStatus, err error) {
+	if bm.recorder == nil || (bs == nil && err == nil) {
+		return
+	}
+	if err != nil {
+		msg := err.Error()
+		if msg == bm.lastFailureEvent && time.Since(bm.lastFailureEventTime) < failureEventInterval {
+			return
+		}
+		bm.lastFailureEvent, bm.lastFailureEventTime = msg, time.Now()
+		bm.recorder.Event(bm.clusterRef(), v1.EventTypeWarning, "Backup Failed", msg)
+		return
+	}
+	bm.lastFailureEvent = ""
+	bm.recorder.Event(bm.clusterRef(), v1.EventTypeNormal, "Backup Saved",
+		fmt.Sprintf("Saved backup %s at revision %d: %v MB in %ds", bs.Name, bs.Revision, bs.Size, bs.TimeTookInSecond))
+}
+
+// clusterRef returns the reference of the EtcdCluster the events are emitted on.
+func (bm *BackupManager) clusterRef() *v1.ObjectReference {
+	if len(bm.eventClusterUID) == 0 {
+		// the UID is only known once the pods of the cluster run.
+		bm.eventClusterUID = bm.clusterUID()
+	}
+	return &v1.ObjectReference{
+		APIVersion: api.SchemeGroupVersion.String(),
+		Kind:       api.EtcdClusterResourceKind,
+		Name:       bm.clusterName,
+		Namespace:  bm.namespace,
+		UID:        types.UID(bm.eventClusterUID),
+	}
+}
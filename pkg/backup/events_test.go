@@ -0,0 +1,74 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// TestRecordBackupEvent ensures each backup emits an event, except skipped backups and repeated identical failures.
+func TestRecordBackupEvent(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	bm := &BackupManager{kubecli: fake.NewSimpleClientset(), clusterName: "test", namespace: "default"}
+	bm.RecordEvents(recorder)
+
+	bs := &backupapi.BackupStatus{Name: "3.1.8_0000000000000001_etcd.backup", Revision: 1, Size: 1.5}
+	errDown := errors.New("storage down")
+	for _, b := range []struct {
+		bs  *backupapi.BackupStatus
+		err error
+	}{
+		{bs: bs},
+		// skipped
+		{},
+		{err: errDown},
+		// repeated
+		{err: errDown},
+		{err: errors.New("etcd down")},
+		{bs: bs},
+		{err: errDown},
+	} {
+		bm.recordBackupEvent(b.bs, b.err)
+	}
+
+	want := []string{
+		"Normal Backup Saved Saved backup 3.1.8_0000000000000001_etcd.backup at revision 1: 1.5 MB in 0s",
+		"Warning Backup Failed storage down",
+		"Warning Backup Failed etcd down",
+		"Normal Backup Saved Saved backup 3.1.8_0000000000000001_etcd.backup at revision 1: 1.5 MB in 0s",
+		"Warning Backup Failed storage down",
+	}
+	for i, w := range want {
+		select {
+		case e := <-recorder.Events:
+			if e != w {
+				t.Errorf("#%d: event = %q, want %q", i, e, w)
+			}
+		default:
+			t.Fatalf("#%d: expect event %q, got none", i, w)
+		}
+	}
+	select {
+	case e := <-recorder.Events:
+		t.Errorf("expect no more events, got %q", e)
+	default:
+	}
+}
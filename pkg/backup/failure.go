@@ -0,0 +1,66 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// The classes of the causes of failed backups, the reason label of the failure metrics.
+const (
+	failureEtcd     = "etcd"
+	failureStorage  = "storage"
+	failureCorrupt  = "corrupt"
+	failureAlarm    = "alarm"
+	failureTimeout  = "timeout"
+	failureCanceled = "canceled"
+	failureOther    = "other"
+)
+
+// backupFailure is the error of a failed backup along with the class of its cause.
+type backupFailure struct {
+	reason string
+	err    error
+}
+
+func (f *backupFailure) Error() string {
+	return f.err.Error()
+}
+
+// failureReason returns the class of the cause of the backup which failed with err.
+func failureReason(err error) string {
+	switch e := err.(type) {
+	case *backupFailure:
+		return e.reason
+	case *etcdError:
+		return failureEtcd
+	}
+	switch {
+	case err == context.DeadlineExceeded:
+		return failureTimeout
+	case err == context.Canceled:
+		return failureCanceled
+	case IsTransientError(err):
+		return failureStorage
+	}
+	return failureOther
+}
+
+// wrapFailure returns err prefixed with msg, keeping the class of its cause.
+func wrapFailure(err error, msg string) error {
+	return &backupFailure{reason: failureReason(err), err: fmt.Errorf("%s: %v", msg, err)}
+}
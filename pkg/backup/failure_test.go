@@ -0,0 +1,42 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: &etcdError{errors.New("member restarted")}, want: failureEtcd},
+		{err: &backupFailure{reason: failureCorrupt, err: errors.New("bad snapshot")}, want: failureCorrupt},
+		{err: wrapFailure(&etcdError{errors.New("member restarted")}, "write snapshot failed"), want: failureEtcd},
+		{err: wrapFailure(statusError(503), "write snapshot failed"), want: failureStorage},
+		{err: context.DeadlineExceeded, want: failureTimeout},
+		{err: context.Canceled, want: failureCanceled},
+		{err: errors.New("unknown"), want: failureOther},
+	}
+	for i, tt := range tests {
+		if got := failureReason(tt.err); got != tt.want {
+			t.Errorf("#%d: failureReason(%v) = %s, want %s", i, tt.err, got, tt.want)
+		}
+	}
+}
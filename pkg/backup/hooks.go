@@ -0,0 +1,164 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultHookTimeout is how long a hook Job is waited for if BackupHooks.Timeout is 0.
+const DefaultHookTimeout = 5 * time.Minute
+
+// hookPollInterval is how often the status of a hook Job is checked.
+var hookPollInterval = 2 * time.Second
+
+// BackupHooks configures the Jobs run around each backup, e.g. to quiesce the applications writing to the cluster.
+// Each hook names a Job in the namespace of the cluster, which serves as the template of the Job run for each backup.
+type BackupHooks struct {
+	// PreBackupJob is run before each backup. If it does not complete successfully, the backup is not saved.
+	// If empty, no Job is run.
+	PreBackupJob string
+	// PostBackupJob is run after each backup, whether it was saved or not, even if PreBackupJob failed.
+	// Its failure is only logged.
+	// If empty, no Job is run.
+	PostBackupJob string
+	// Timeout is how long each Job is waited for. If equal to 0, DefaultHookTimeout is used.
+	Timeout time.Duration
+}
+
+// RunHooks has the BackupManager run the Jobs of h around each backup saved by SaveSnap and SaveSnapWithPrefix.
+func (bm *BackupManager) RunHooks(h BackupHooks) {
+	bm.hooks = h
+}
+
+// runPreBackupHook runs the pre-backup Job, if any, and returns an error if it does not complete successfully.
+func (bm *BackupManager) runPreBackupHook(ctx context.Context) error {
+	if len(bm.hooks.PreBackupJob) == 0 {
+		return nil
+	}
+	if err := bm.runHookJob(ctx, bm.hooks.PreBackupJob); err != nil {
+		return fmt.Errorf("pre-backup hook failed: %v", err)
+	}
+	return nil
+}
+
+// runPostBackupHook runs the post-backup Job, if any, and logs its failure.
+// It is not bound to the context of the backup, so that it runs after a canceled backup too.
+func (bm *BackupManager) runPostBackupHook() {
+	if len(bm.hooks.PostBackupJob) == 0 {
+		return
+	}
+	if err := bm.runHookJob(context.Background(), bm.hooks.PostBackupJob); err != nil {
+		bm.getLogger().WithError(err).WithField("job", bm.hooks.PostBackupJob).Warning("post-backup hook failed")
+	}
+}
+
+// runHookJob creates a Job from the template Job of the given name and waits until it completes, fails
+// or the hook timeout expires. A completed Job is deleted, while a failed one is kept for inspection.
+func (bm *BackupManager) runHookJob(ctx context.Context, name string) error {
+	jobs := bm.kubecli.BatchV1().Jobs(bm.namespace)
+	tmpl, err := jobs.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the hook job (%s): %v", name, err)
+	}
+	job, err := jobs.Create(newHookJob(tmpl, time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to create the hook job from (%s): %v", name, err)
+	}
+	logger := bm.getLogger().WithField("job", job.Name)
+	logger.Info("started hook job")
+
+	timeout := bm.hooks.Timeout
+	if timeout == 0 {
+		timeout = DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(hookPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("hook job (%s) did not finish: %v", job.Name, ctx.Err())
+		case <-ticker.C:
+		}
+		job, err = jobs.Get(job.Name, metav1.GetOptions{})
+		if err != nil {
+			logger.WithError(err).Warning("failed to get hook job")
+			continue
+		}
+		switch {
+		case isJobFinished(job, batchv1.JobComplete):
+			logger.Info("hook job completed")
+			background := metav1.DeletePropagationBackground
+			if err := jobs.Delete(job.Name, &metav1.DeleteOptions{PropagationPolicy: &background}); err != nil {
+				logger.WithError(err).Warning("failed to delete hook job")
+			}
+			return nil
+		case isJobFinished(job, batchv1.JobFailed):
+			return fmt.Errorf("hook job (%s) failed", job.Name)
+		}
+	}
+}
+
+// newHookJob returns the Job to create from the template Job tmpl at the given time.
+// The selector and the labels generated for tmpl are dropped so that they are generated for the new Job.
+func newHookJob(tmpl *batchv1.Job, now time.Time) *batchv1.Job {
+	name := tmpl.Name
+	// the name is used as a label value, which is at most 63 characters long.
+	if len(name) > 52 {
+		name = name[:52]
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%d", name, now.Unix()),
+			Namespace:   tmpl.Namespace,
+			Labels:      tmpl.Labels,
+			Annotations: tmpl.Annotations,
+		},
+		Spec: *tmpl.Spec.DeepCopy(),
+	}
+	job.Spec.Selector = nil
+	job.Spec.ManualSelector = nil
+	// a template with 0 parallelism does not run by itself; its copies run with the default parallelism.
+	if job.Spec.Parallelism != nil && *job.Spec.Parallelism == 0 {
+		job.Spec.Parallelism = nil
+	}
+	labels := make(map[string]string)
+	for k, v := range job.Spec.Template.Labels {
+		if k == "controller-uid" || k == "job-name" {
+			continue
+		}
+		labels[k] = v
+	}
+	job.Spec.Template.Labels = labels
+	return job
+}
+
+// isJobFinished returns true if the job has the given condition, JobComplete or JobFailed.
+func isJobFinished(job *batchv1.Job, cond batchv1.JobConditionType) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Type == cond && c.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
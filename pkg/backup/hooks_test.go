@@ -0,0 +1,140 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestNewHookJob(t *testing.T) {
+	zero := int32(0)
+	manual := true
+	tmpl := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "freeze", Namespace: "default", Labels: map[string]string{"app": "freeze"}},
+		Spec: batchv1.JobSpec{
+			Parallelism:    &zero,
+			ManualSelector: &manual,
+			Selector:       &metav1.LabelSelector{MatchLabels: map[string]string{"controller-uid": "1234"}},
+		},
+	}
+	tmpl.Spec.Template.Labels = map[string]string{"app": "freeze", "controller-uid": "1234", "job-name": "freeze"}
+
+	job := newHookJob(tmpl, time.Unix(1500000000, 0))
+	if job.Name != "freeze-1500000000" || job.Namespace != "default" {
+		t.Errorf("job = %s/%s, want default/freeze-1500000000", job.Namespace, job.Name)
+	}
+	if job.Spec.Parallelism != nil || job.Spec.Selector != nil || job.Spec.ManualSelector != nil {
+		t.Errorf("parallelism = %v, selector = %v, manual selector = %v, want all unset", job.Spec.Parallelism, job.Spec.Selector, job.Spec.ManualSelector)
+	}
+	if l := job.Spec.Template.Labels; len(l) != 1 || l["app"] != "freeze" {
+		t.Errorf("template labels = %v, want only app=freeze", l)
+	}
+	if len(tmpl.Spec.Template.Labels) != 3 || tmpl.Spec.Parallelism == nil {
+		t.Error("the template job was modified")
+	}
+
+	tmpl.Name = strings.Repeat("a", 70)
+	if job := newHookJob(tmpl, time.Unix(1500000000, 0)); len(job.Name) > 63 {
+		t.Errorf("len(job name) = %d, want <= 63", len(job.Name))
+	}
+}
+
+// newHookTestClient returns a fake clientset with the template job of the given name,
+// whose copies finish with the given condition, or never finish if cond is empty.
+func newHookTestClient(name string, cond batchv1.JobConditionType) *fake.Clientset {
+	kubecli := fake.NewSimpleClientset(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}})
+	kubecli.PrependReactor("create", "jobs", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if len(cond) != 0 {
+			job := action.(ktesting.CreateAction).GetObject().(*batchv1.Job)
+			job.Status.Conditions = []batchv1.JobCondition{{Type: cond, Status: v1.ConditionTrue}}
+		}
+		return false, nil, nil
+	})
+	return kubecli
+}
+
+// hookJobs returns the names of the jobs other than the template job of the given name.
+func hookJobs(t *testing.T, kubecli *fake.Clientset, name string) []string {
+	jobs, err := kubecli.BatchV1().Jobs("default").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, job := range jobs.Items {
+		if job.Name != name {
+			names = append(names, job.Name)
+		}
+	}
+	return names
+}
+
+func TestRunHookJob(t *testing.T) {
+	defer func(d time.Duration) { hookPollInterval = d }(hookPollInterval)
+	hookPollInterval = time.Millisecond
+
+	tests := []struct {
+		cond     batchv1.JobConditionType
+		wantErr  string
+		wantKept bool
+	}{
+		{cond: batchv1.JobComplete},
+		{cond: batchv1.JobFailed, wantErr: "failed", wantKept: true},
+		{wantErr: "did not finish", wantKept: true},
+	}
+	for _, tt := range tests {
+		kubecli := newHookTestClient("freeze", tt.cond)
+		bm := NewBackupManager(kubecli, "example", "default", nil, nil)
+		bm.RunHooks(BackupHooks{PreBackupJob: "freeze", Timeout: 50 * time.Millisecond})
+
+		err := bm.runPreBackupHook(context.Background())
+		switch {
+		case len(tt.wantErr) == 0 && err != nil:
+			t.Errorf("%q: unexpected error: %v", tt.cond, err)
+		case len(tt.wantErr) != 0 && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%q: error = %v, want an error containing %q", tt.cond, err, tt.wantErr)
+		}
+		if kept := len(hookJobs(t, kubecli, "freeze")) != 0; kept != tt.wantKept {
+			t.Errorf("%q: job kept = %v, want %v", tt.cond, kept, tt.wantKept)
+		}
+	}
+}
+
+func TestPostBackupHookAfterFailedPreBackupHook(t *testing.T) {
+	defer func(d time.Duration) { hookPollInterval = d }(hookPollInterval)
+	hookPollInterval = time.Millisecond
+
+	// the pre-backup job is missing, while the post-backup job fails.
+	kubecli := newHookTestClient("thaw", batchv1.JobFailed)
+	bm := NewBackupManager(kubecli, "example", "default", nil, nil)
+	bm.RunHooks(BackupHooks{PreBackupJob: "freeze", PostBackupJob: "thaw", Timeout: 50 * time.Millisecond})
+
+	_, err := bm.SaveSnapWithPrefix(context.Background(), "prefix")
+	if err == nil || !strings.Contains(err.Error(), "pre-backup hook failed") {
+		t.Fatalf("error = %v, want the pre-backup hook failure", err)
+	}
+	if names := hookJobs(t, kubecli, "thaw"); len(names) != 1 || !strings.HasPrefix(names[0], "thaw-") {
+		t.Errorf("jobs = %v, want the failed post-backup job", names)
+	}
+}
@@ -15,12 +15,19 @@
 package backup
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/diff"
 	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
@@ -29,34 +36,106 @@ import (
 const (
 	HTTPHeaderEtcdVersion = "X-etcd-Version"
 	HTTPHeaderRevision    = "X-Revision"
+
+	// healthCheckTimeout bounds the checks of a health request, which must answer before the probe times out.
+	healthCheckTimeout = 5 * time.Second
+
+	// HTTPQuerySignedURLNameKey and HTTPQuerySignedURLTTLKey are the name of the backup to sign a URL for
+	// and the number of seconds the URL is valid for.
+	HTTPQuerySignedURLNameKey = "name"
+	HTTPQuerySignedURLTTLKey  = "ttl"
+
+	// HTTPQueryDiffFromKey and HTTPQueryDiffToKey are the revisions of the backups to diff.
+	HTTPQueryDiffFromKey = "from"
+	HTTPQueryDiffToKey   = "to"
+
+	// HTTPQueryClusterMetadataNameKey is the name of the backup to serve the cluster metadata of.
+	HTTPQueryClusterMetadataNameKey = "name"
+
+	// HTTPQueryBackupNowForceKey requests a backup even if the cluster has not changed since the latest backup.
+	HTTPQueryBackupNowForceKey = "force"
+
+	// defaultSignedURLTTL is how long a signed URL is valid for if not requested otherwise,
+	// unless the policy caps it lower.
+	defaultSignedURLTTL = 15 * time.Minute
 )
 
 func (bc *BackupController) StartHTTP() {
 	http.HandleFunc(backupapi.APIV1+"/backup", bc.backupServer.ServeBackup)
 	http.HandleFunc(backupapi.APIV1+"/backupnow", bc.serveBackupNow)
 	http.HandleFunc(backupapi.APIV1+"/status", bc.serveStatus)
+	http.HandleFunc(backupapi.APIV1+"/backups", bc.serveBackups)
+	http.HandleFunc(backupapi.APIV1+"/diff", bc.serveDiff)
+	http.HandleFunc(backupapi.APIV1+"/clustermetadata", bc.serveClusterMetadata)
+	if bc.policy.MaxSignedURLTTLInSecond > 0 {
+		http.HandleFunc(backupapi.APIV1+"/signedurl", bc.serveSignedURL)
+	}
+	http.HandleFunc(backupapi.HealthzPath, bc.serveHealthz)
+	http.HandleFunc(backupapi.ReadyzPath, bc.serveReadyz)
 	http.Handle("/metrics", prometheus.Handler())
 
+	if bc.policy.HTTPClientCertAuth {
+		// the kubelet probes can't present a client certificate.
+		health := http.NewServeMux()
+		health.HandleFunc(backupapi.HealthzPath, bc.serveHealthz)
+		health.HandleFunc(backupapi.ReadyzPath, bc.serveReadyz)
+		go func() {
+			logrus.Infof("serving health checks on %v", bc.healthListenAddr)
+			panic(http.ListenAndServe(bc.healthListenAddr, health))
+		}()
+
+		srv := &http.Server{Addr: bc.listenAddr, TLSConfig: etcdutil.ReloadingServerTLSConfig(bc.backupManager.tlsConfig)}
+		logrus.Infof("listening on %v with client certificate authentication", bc.listenAddr)
+		panic(srv.ListenAndServeTLS("", ""))
+	}
 	logrus.Infof("listening on %v", bc.listenAddr)
 	panic(http.ListenAndServe(bc.listenAddr, nil))
 }
 
+// errStopped answers the backup requests received once the BackupController is stopped.
+var errStopped = errors.New("backup sidecar is stopping")
+
+type backupNowRequest struct {
+	// force saves a backup even if the cluster has not changed since the latest backup.
+	force   bool
+	ackchan chan backupNowAck
+}
+
 type backupNowAck struct {
 	err    error
 	status backupapi.BackupStatus
 }
 
 func (bc *BackupController) serveBackupNow(w http.ResponseWriter, r *http.Request) {
-	ackchan := make(chan backupNowAck, 1)
+	req := backupNowRequest{ackchan: make(chan backupNowAck, 1)}
+	if s := r.URL.Query().Get(HTTPQueryBackupNowForceKey); len(s) != 0 {
+		force, err := strconv.ParseBool(s)
+		if err != nil {
+			http.Error(w, "invalid force: "+s, http.StatusBadRequest)
+			return
+		}
+		req.force = force
+	}
 	select {
-	case bc.backupNow <- ackchan:
+	case bc.backupNow <- req:
+	case <-bc.stopped:
+		http.Error(w, errStopped.Error(), http.StatusServiceUnavailable)
+		return
 	case <-time.After(time.Minute):
 		http.Error(w, "timeout", http.StatusRequestTimeout)
 		return
 	}
 
 	select {
-	case ack := <-ackchan:
+	case ack := <-req.ackchan:
+		if ack.err == errStopped {
+			http.Error(w, ack.err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if ack.err == ErrBackupInProgress {
+			http.Error(w, ack.err.Error(), http.StatusConflict)
+			return
+		}
 		if ack.err != nil {
 			http.Error(w, ack.err.Error(), http.StatusInternalServerError)
 			return
@@ -84,16 +163,241 @@ func (bc *BackupController) serveStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	s := backupapi.ServiceStatus{
-		Backups:    t,
-		BackupSize: util.ToMB(ts),
+		Backups:                 t,
+		BackupSize:              util.ToMB(ts),
+		BackupInProgressSeconds: bc.backupManager.BackupInProgressFor().Seconds(),
 	}
-	rbs := bc.recentBackupsStatus
-	if len(rbs) != 0 {
-		s.RecentBackup = &rbs[len(rbs)-1]
+	bc.mu.Lock()
+	s.LastBackupError = bc.lastBackupError
+	s.LastSkipReason = bc.lastSkipReason
+	if rbs := bc.recentBackupsStatus; len(rbs) != 0 {
+		rb := rbs[len(rbs)-1]
+		s.RecentBackup = &rb
 	}
+	bc.mu.Unlock()
 
 	je := json.NewEncoder(w)
 	if err := je.Encode(&s); err != nil {
 		logrus.Errorf("failed to write service status to %s: %v", r.RemoteAddr, err)
 	}
 }
+
+// serveBackups lists the backups in the backend as a JSON array of backend.BackupMeta
+// in ascending revision order.
+func (bc *BackupController) serveBackups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	backups, err := bc.backupManager.be.List()
+	if err != nil {
+		http.Error(w, "failed to list backups", http.StatusInternalServerError)
+		return
+	}
+	if backups == nil {
+		backups = []backend.BackupMeta{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(backups); err != nil {
+		logrus.Errorf("failed to write backups to %s: %v", r.RemoteAddr, err)
+	}
+}
+
+// serveSignedURL serves a backupapi.SignedURL to download the backup named by the "name" query parameter.
+// The URL is valid for the number of seconds given by the "ttl" query parameter, capped by the policy.
+func (bc *BackupController) serveSignedURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	signer, ok := bc.backupManager.be.(backend.URLSigner)
+	if !ok {
+		http.Error(w, "the backup storage doesn't support signed URLs", http.StatusNotImplemented)
+		return
+	}
+	maxTTL := time.Duration(bc.policy.MaxSignedURLTTLInSecond) * time.Second
+	ttl := defaultSignedURLTTL
+	if s := r.URL.Query().Get(HTTPQuerySignedURLTTLKey); len(s) != 0 {
+		sec, err := strconv.Atoi(s)
+		if err != nil || sec <= 0 {
+			http.Error(w, "invalid ttl: "+s, http.StatusBadRequest)
+			return
+		}
+		ttl = time.Duration(sec) * time.Second
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	name := r.URL.Query().Get(HTTPQuerySignedURLNameKey)
+	backups, err := bc.backupManager.be.List()
+	if err != nil {
+		http.Error(w, "failed to list backups", http.StatusInternalServerError)
+		return
+	}
+	found := false
+	for _, b := range backups {
+		if b.Name == name {
+			found = true
+			break
+		}
+	}
+	// only the backups can be signed, not any object the sidecar has access to.
+	if !found {
+		http.Error(w, "backup not found: "+name, http.StatusNotFound)
+		return
+	}
+
+	expires := time.Now().Add(ttl)
+	u, err := signer.SignedURL(name, ttl)
+	if err != nil {
+		logrus.Errorf("failed to sign URL of backup (%s): %v", name, err)
+		http.Error(w, "failed to sign URL", http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("signed URL of backup (%s) for %s, valid for %v", name, r.RemoteAddr, ttl)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&backupapi.SignedURL{URL: u, Expires: expires}); err != nil {
+		logrus.Errorf("failed to write signed URL to %s: %v", r.RemoteAddr, err)
+	}
+}
+
+// serveClusterMetadata serves the backupapi.ClusterMetadata saved with the backup named by the "name" query parameter.
+func (bc *BackupController) serveClusterMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get(HTTPQueryClusterMetadataNameKey)
+	backups, err := bc.backupManager.be.List()
+	if err != nil {
+		http.Error(w, "failed to list backups", http.StatusInternalServerError)
+		return
+	}
+	found := false
+	for _, b := range backups {
+		if b.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		http.Error(w, "backup not found: "+name, http.StatusNotFound)
+		return
+	}
+	md, err := ReadClusterMetadata(bc.backupManager.be, name)
+	if err != nil {
+		logrus.Errorf("failed to read cluster metadata of backup (%s): %v", name, err)
+		http.Error(w, "failed to read cluster metadata", http.StatusInternalServerError)
+		return
+	}
+	if md == nil {
+		http.Error(w, "backup saved without cluster metadata: "+name, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(md); err != nil {
+		logrus.Errorf("failed to write cluster metadata to %s: %v", r.RemoteAddr, err)
+	}
+}
+
+// serveDiff serves the changes of the keys from the backup at the revision given by the "from" query parameter
+// to the backup at the revision given by the "to" query parameter, as a JSON array of diff.KeyChange.
+func (bc *BackupController) serveDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var revs [2]int64
+	for i, k := range []string{HTTPQueryDiffFromKey, HTTPQueryDiffToKey} {
+		s := r.URL.Query().Get(k)
+		rev, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || rev <= 0 {
+			http.Error(w, "invalid "+k+": "+s, http.StatusBadRequest)
+			return
+		}
+		revs[i] = rev
+	}
+
+	backups, err := bc.backupManager.be.List()
+	if err != nil {
+		http.Error(w, "failed to list backups", http.StatusInternalServerError)
+		return
+	}
+	var names [2]string
+	for i, rev := range revs {
+		for _, b := range backups {
+			if b.Revision == rev {
+				names[i] = b.Name
+				break
+			}
+		}
+		if len(names[i]) == 0 {
+			http.Error(w, fmt.Sprintf("backup not found at revision %d", rev), http.StatusNotFound)
+			return
+		}
+	}
+
+	changes, err := bc.backupManager.DiffBackups(names[0], names[1])
+	if err != nil {
+		logrus.Errorf("failed to diff backups (%s) and (%s): %v", names[0], names[1], err)
+		http.Error(w, "failed to diff backups", http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []diff.KeyChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		logrus.Errorf("failed to write backup diff to %s: %v", r.RemoteAddr, err)
+	}
+}
+
+// serveHealthz reports whether a member of the cluster is reachable to take snapshots from.
+func (bc *BackupController) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	writeHealthStatus(w, r, map[string]error{
+		"etcd": bc.backupManager.validateMembers(ctx),
+	})
+}
+
+// serveReadyz reports whether backups can be saved: a member of the cluster is reachable
+// and the storage accepts writes with its credentials.
+func (bc *BackupController) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	writeHealthStatus(w, r, map[string]error{
+		"etcd":    bc.backupManager.validateMembers(ctx),
+		"storage": bc.backupManager.validateBackend(ctx),
+	})
+}
+
+// writeHealthStatus writes the results of the given checks as a backupapi.HealthStatus,
+// with the status code 503 if any check failed.
+func writeHealthStatus(w http.ResponseWriter, r *http.Request, checks map[string]error) {
+	hs := backupapi.HealthStatus{
+		Status: backupapi.HealthCheckOK,
+		Checks: make(map[string]backupapi.HealthCheck, len(checks)),
+	}
+	for name, err := range checks {
+		if err == nil {
+			hs.Checks[name] = backupapi.HealthCheck{Status: backupapi.HealthCheckOK}
+			continue
+		}
+		hs.Status = backupapi.HealthCheckFailed
+		hs.Checks[name] = backupapi.HealthCheck{Status: backupapi.HealthCheckFailed, Error: err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if hs.Status != backupapi.HealthCheckOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(&hs); err != nil {
+		logrus.Errorf("failed to write health status to %s: %v", r.RemoteAddr, err)
+	}
+}
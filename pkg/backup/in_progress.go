@@ -0,0 +1,103 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ErrBackupInProgress is returned by SaveSnap and SaveSnapWithPrefix when another backup of the cluster
+// is in progress with the same BackupManager, so that no backup is started along with it.
+var ErrBackupInProgress = errors.New("another backup of the cluster is in progress")
+
+// backupInProgress tracks the backup a BackupManager is saving, so that two backups of the same cluster
+// never run together, e.g. when a snapshot takes longer than the backup interval: they would double the
+// load on etcd and race on purging the old backups. Its zero value has no backup in progress.
+type backupInProgress struct {
+	mu sync.Mutex
+	// start is when the backup in progress started, and done is closed once it ends.
+	// done is nil if no backup is in progress.
+	start time.Time
+	done  chan struct{}
+}
+
+// begin marks a backup started if none is in progress, and returns true. Otherwise, it returns false right
+// away if wait is false, or waits for the backup in progress to end before starting, until ctx is done.
+// A started backup must be ended with end.
+func (bp *backupInProgress) begin(ctx context.Context, wait bool) (bool, error) {
+	for {
+		bp.mu.Lock()
+		if bp.done == nil {
+			bp.start, bp.done = time.Now(), make(chan struct{})
+			bp.mu.Unlock()
+			return true, nil
+		}
+		done := bp.done
+		bp.mu.Unlock()
+
+		if !wait {
+			return false, nil
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// end marks the backup started by begin ended.
+func (bp *backupInProgress) end() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	close(bp.done)
+	bp.start, bp.done = time.Time{}, nil
+}
+
+// runningFor returns how long the backup in progress has been running, or 0 if none is.
+func (bp *backupInProgress) runningFor() time.Duration {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if bp.done == nil {
+		return 0
+	}
+	return time.Since(bp.start)
+}
+
+// BackupInProgressFor returns how long the backup bm is saving has been running, or 0 if none is.
+func (bm *BackupManager) BackupInProgressFor() time.Duration {
+	return bm.inProgress.runningFor()
+}
+
+// beginBackup starts a backup of bm, waiting for the backup in progress to end first if wait is true.
+// If another backup is in progress and wait is false, the backup is skipped: it is logged and counted,
+// and ErrBackupInProgress is returned. The started backup must be ended with bm.inProgress.end.
+func (bm *BackupManager) beginBackup(ctx context.Context, wait bool) error {
+	running := bm.inProgress.runningFor()
+	ok, err := bm.inProgress.begin(ctx, wait)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		bm.metrics.IncSkippedInProgress(bm.clusterName)
+		bm.getLogger().WithField("running_s", running.Seconds()).Warning("skipped backup: another backup is in progress")
+		return ErrBackupInProgress
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestBackupInProgress(t *testing.T) {
+	var bp backupInProgress
+	if ok, err := bp.begin(context.Background(), false); !ok || err != nil {
+		t.Fatalf("expect the first backup to start, get %v, %v", ok, err)
+	}
+	if bp.runningFor() <= 0 {
+		t.Errorf("expect the backup in progress to be running")
+	}
+	if ok, err := bp.begin(context.Background(), false); ok || err != nil {
+		t.Errorf("expect the overlapping backup to be skipped, get %v, %v", ok, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if ok, err := bp.begin(ctx, true); ok || err != context.DeadlineExceeded {
+		t.Errorf("expect the queued backup to give up with its context, get %v, %v", ok, err)
+	}
+
+	started := make(chan bool)
+	go func() {
+		ok, _ := bp.begin(context.Background(), true)
+		started <- ok
+	}()
+	select {
+	case <-started:
+		t.Fatal("expect the queued backup to wait for the backup in progress")
+	case <-time.After(10 * time.Millisecond):
+	}
+	bp.end()
+	if !<-started {
+		t.Fatal("expect the queued backup to start once the backup in progress ended")
+	}
+	bp.end()
+	if bp.runningFor() != 0 {
+		t.Errorf("expect no backup in progress, get %v", bp.runningFor())
+	}
+}
+
+func TestSaveSnapSkippedInProgress(t *testing.T) {
+	bm := &BackupManager{}
+	bm.inProgress.begin(context.Background(), false)
+	defer bm.inProgress.end()
+
+	if _, err := bm.SaveSnap(context.Background(), 0); err != ErrBackupInProgress {
+		t.Errorf("expect ErrBackupInProgress, get %v", err)
+	}
+	if _, err := bm.SaveSnapWithPrefix(context.Background(), "prefix"); err != ErrBackupInProgress {
+		t.Errorf("expect ErrBackupInProgress, get %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := bm.SaveSnapWithOptions(ctx, 0, SaveSnapOptions{Force: true}); err != context.DeadlineExceeded {
+		t.Errorf("expect the forced backup to be queued until its context is done, get %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// IncrementalBackupConfig configures incremental backups.
+type IncrementalBackupConfig struct {
+	// MaxDeltas is the maximum number of deltas saved on top of a full
+	// snapshot before a new full snapshot is forced.
+	MaxDeltas int
+}
+
+// deltaOp is a single change recorded in a delta.
+type deltaOp struct {
+	Delete bool   `json:"delete,omitempty"`
+	Key    []byte `json:"key"`
+	Value  []byte `json:"value,omitempty"`
+	Rev    int64  `json:"rev"`
+}
+
+// writeDelta saves every change in the revision range (lastSnapRev, rev] as a delta.
+// It returns rpctypes.ErrCompacted if the history has already been compacted.
+func (bm *BackupManager) writeDelta(ctx context.Context, wcli clientv3.Watcher, mcli clientv3.Maintenance, endpoint string, lastSnapRev, rev int64) (*backupapi.BackupStatus, error) {
+	start := time.Now()
+
+	status, err := bm.getEtcdStatus(ctx, mcli, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	version := status.Version
+
+	ctx, cancel := context.WithTimeout(ctx, bm.getSnapshotTimeout())
+	defer cancel()
+	wch := wcli.Watch(ctx, "\x00", clientv3.WithFromKey(), clientv3.WithRev(lastSnapRev+1))
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for done := false; !done; {
+		wresp, ok := <-wch
+		if !ok {
+			return nil, fmt.Errorf("watch closed before reaching revision %d: %v", rev, ctx.Err())
+		}
+		if err := wresp.Err(); err != nil {
+			return nil, err
+		}
+		for _, ev := range wresp.Events {
+			if ev.Kv.ModRevision > rev {
+				done = true
+				break
+			}
+			op := deltaOp{
+				Delete: ev.Type == mvccpb.DELETE,
+				Key:    ev.Kv.Key,
+				Value:  ev.Kv.Value,
+				Rev:    ev.Kv.ModRevision,
+			}
+			if err := enc.Encode(&op); err != nil {
+				return nil, err
+			}
+			if ev.Kv.ModRevision == rev {
+				done = true
+			}
+		}
+	}
+
+	n, err := bm.be.SaveDelta(ctx, version, rev, &buf)
+	if err = bm.tolerateReplication(err); err != nil {
+		return nil, err
+	}
+
+	bs := &backupapi.BackupStatus{
+		Name:             util.MakeDeltaName(version, rev),
+		CreationTime:     time.Now().Format(time.RFC3339),
+		Size:             util.ToMB(n),
+		Version:          version,
+		Revision:         rev,
+		TimeTookInSecond: int(time.Since(start).Seconds() + 1),
+	}
+	return bs, nil
+}
+
+// saveIncremental saves a delta on top of the last backup if the configured
+// number of deltas has not been reached yet, or a full snapshot otherwise.
+func (bm *BackupManager) saveIncremental(ctx context.Context, etcdcli *clientv3.Client, lastSnapRev, rev int64) (*backupapi.BackupStatus, error) {
+	deltas, err := bm.deltasSinceLatestBackup()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count deltas: %v", err)
+	}
+	if lastSnapRev > 0 && len(deltas) < bm.incremental.MaxDeltas {
+		bs, err := bm.writeDelta(ctx, etcdcli.Watcher, etcdcli.Maintenance, etcdcli.Endpoints()[0], lastSnapRev, rev)
+		if err == nil {
+			return bs, nil
+		}
+		if err != rpctypes.ErrCompacted {
+			return nil, wrapFailure(err, "write delta failed")
+		}
+		bm.getLogger().WithField("revision", lastSnapRev).Info("history since the revision is compacted; taking a full snapshot")
+	}
+
+	bs, err := bm.writeSnap(ctx, etcdcli.Maintenance, etcdcli.Endpoints()[0], rev)
+	if err != nil {
+		return nil, wrapFailure(err, "write snapshot failed")
+	}
+	return bs, nil
+}
+
+// deltasSinceLatestBackup returns the names of the deltas saved on top of the latest full backup
+// in ascending revision order. They are counted from the backend so that the count survives restarts.
+func (bm *BackupManager) deltasSinceLatestBackup() ([]string, error) {
+	name, err := bm.be.GetLatest()
+	if err != nil {
+		return nil, err
+	}
+	if len(name) == 0 {
+		return nil, nil
+	}
+	return bm.be.ListDeltas(util.MustParseRevision(name))
+}
+
+// ApplyDeltas replays the deltas read from r on top of a cluster restored from a base snapshot.
+// It returns the revision of the last change applied.
+func ApplyDeltas(kv clientv3.KV, r io.Reader) (int64, error) {
+	var rev int64
+	dec := json.NewDecoder(r)
+	for {
+		var op deltaOp
+		err := dec.Decode(&op)
+		if err == io.EOF {
+			return rev, nil
+		}
+		if err != nil {
+			return rev, fmt.Errorf("failed to decode delta: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+		if op.Delete {
+			_, err = kv.Delete(ctx, string(op.Key))
+		} else {
+			_, err = kv.Put(ctx, string(op.Key), string(op.Value))
+		}
+		cancel()
+		if err != nil {
+			return rev, fmt.Errorf("failed to apply change at revision %d: %v", op.Rev, err)
+		}
+		rev = op.Rev
+	}
+}
+
+// ReplayDeltas applies all deltas saved in be after baseRev, in revision order.
+// It returns the revision the cluster has been brought up to.
+func ReplayDeltas(be backend.Backend, kv clientv3.KV, baseRev int64) (int64, error) {
+	names, err := be.ListDeltas(baseRev)
+	if err != nil {
+		return baseRev, err
+	}
+
+	rev := baseRev
+	for _, name := range names {
+		err := func() error {
+			rc, err := be.Open(name)
+			if err != nil {
+				return fmt.Errorf("failed to open delta (%s): %v", name, err)
+			}
+			defer rc.Close()
+			if _, err = ApplyDeltas(kv, rc); err != nil {
+				return fmt.Errorf("failed to replay delta (%s): %v", name, err)
+			}
+			return nil
+		}()
+		if err != nil {
+			return rev, err
+		}
+		rev = util.MustParseRevision(name)
+		logrus.Infof("replayed delta %s", name)
+	}
+	return rev, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"golang.org/x/net/context"
+)
+
+type fakeWatcher struct {
+	clientv3.Watcher
+	events []*clientv3.Event
+}
+
+func (w *fakeWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	wch := make(chan clientv3.WatchResponse, 1)
+	wch <- clientv3.WatchResponse{Events: w.events}
+	close(wch)
+	return wch
+}
+
+type fakeKV struct {
+	clientv3.KV
+	data map[string]string
+}
+
+func (kv *fakeKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	kv.data[key] = val
+	return &clientv3.PutResponse{}, nil
+}
+
+func (kv *fakeKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	delete(kv.data, key)
+	return &clientv3.DeleteResponse{}, nil
+}
+
+func newEvent(t mvccpb.Event_EventType, key, val string, rev int64) *clientv3.Event {
+	return &clientv3.Event{
+		Type: t,
+		Kv:   &mvccpb.KeyValue{Key: []byte(key), Value: []byte(val), ModRevision: rev},
+	}
+}
+
+// TestWriteAndReplayDelta ensures changes saved by writeDelta are replayed
+// on top of the base backup by ReplayDeltas.
+func TestWriteAndReplayDelta(t *testing.T) {
+	d, err := makeFileBackendDir(util.MakeBackupName(testEtcdVersion, 1))
+	if err != nil {
+		t.Fatalf("failed to make file backend dir: (%v)", err)
+	}
+	defer os.RemoveAll(d)
+	bm := &BackupManager{
+		be: backend.NewFileBackend(d),
+	}
+
+	w := &fakeWatcher{events: []*clientv3.Event{
+		newEvent(mvccpb.PUT, "a", "1", 2),
+		newEvent(mvccpb.PUT, "b", "2", 3),
+		newEvent(mvccpb.DELETE, "c", "", 4),
+		newEvent(mvccpb.PUT, "d", "ignored", 5), // newer than the requested revision
+	}}
+	bs, err := bm.writeDelta(context.Background(), w, &fakeMaintenanceClient{}, "", 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs.Revision != 4 {
+		t.Fatalf("expect Revision %v, got %v", 4, bs.Revision)
+	}
+
+	kv := &fakeKV{data: map[string]string{"c": "3"}}
+	rev, err := ReplayDeltas(bm.be, kv, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != 4 {
+		t.Errorf("expect replayed revision %v, got %v", 4, rev)
+	}
+	want := map[string]string{"a": "1", "b": "2"}
+	if !reflect.DeepEqual(kv.data, want) {
+		t.Errorf("expect data %v, got %v", want, kv.data)
+	}
+}
+
+// TestLatestBackupRevWithDeltas ensures the deltas saved on top of the latest backup are
+// counted from the backend, so that incremental backups continue after a restart.
+func TestLatestBackupRevWithDeltas(t *testing.T) {
+	d, err := makeFileBackendDir(util.MakeBackupName(testEtcdVersion, 1))
+	if err != nil {
+		t.Fatalf("failed to make file backend dir: (%v)", err)
+	}
+	defer os.RemoveAll(d)
+	bm := &BackupManager{
+		be:          backend.NewFileBackend(d),
+		incremental: &IncrementalBackupConfig{MaxDeltas: 2},
+	}
+
+	if _, err = bm.writeSnap(context.Background(), &fakeMaintenanceClient{}, "", 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, rev := range []int64{2, 3} {
+		if _, err = bm.be.SaveDelta(context.Background(), testEtcdVersion, rev, strings.NewReader("")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rev, err := bm.latestBackupRev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != 3 {
+		t.Errorf("expect latest backup rev %v, got %v", 3, rev)
+	}
+	deltas, err := bm.deltasSinceLatestBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deltas) != 2 {
+		t.Errorf("expect %d deltas since the latest backup, got %v", 2, deltas)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// indexRebuildInterval is how often the index of a prefix is rebuilt from listing the storage.
+// Rebuilding brings back the backups missing from the index, e.g. if the process crashed between
+// saving a backup and updating the index, and drops the backups deleted by others.
+const indexRebuildInterval = 24 * time.Hour
+
+// indexTmpExtension is the extension of the copy of the index written before the index itself.
+const indexTmpExtension = ".tmp"
+
+func indexPath(prefix string) string {
+	return path.Join(prefix, backupapi.BackupIndexName)
+}
+
+// readIndex reads the index of the backups saved under the given prefix of w.
+// It falls back to the temporary copy of the index if the index is missing or corrupt,
+// e.g. if the process crashed while writing it.
+// It returns nil if w can't read back files or neither is valid.
+func readIndex(w writer.Writer, prefix string) *backupapi.BackupIndex {
+	o, ok := w.(writer.Opener)
+	if !ok {
+		return nil
+	}
+	for _, p := range []string{indexPath(prefix), indexPath(prefix) + indexTmpExtension} {
+		idx, err := readIndexFile(o, p)
+		if err == nil {
+			return idx
+		}
+		if !os.IsNotExist(err) {
+			logrus.Warningf("failed to read backup index (%s): %v", p, err)
+		}
+	}
+	return nil
+}
+
+func readIndexFile(o writer.Opener, p string) (*backupapi.BackupIndex, error) {
+	rc, err := o.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return backupapi.ParseBackupIndex(b)
+}
+
+// readFreshIndex is like readIndex, but also returns nil if the index is due to be rebuilt.
+func readFreshIndex(w writer.Writer, prefix string) *backupapi.BackupIndex {
+	idx := readIndex(w, prefix)
+	if idx == nil || time.Since(idx.RebuiltAt) > indexRebuildInterval {
+		return nil
+	}
+	return idx
+}
+
+// rebuildIndex builds the index of the backups saved under the given prefix of w by listing them.
+// The size and checksum of the backups are not known from listing.
+func rebuildIndex(w writer.Writer, prefix string) (*backupapi.BackupIndex, error) {
+	names, err := listBackupsWithPrefix(w, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var modTimes map[string]time.Time
+	if l, ok := w.(writer.ModTimeLister); ok {
+		if modTimes, err = l.ListModTimes(strings.TrimSuffix(prefix, "/") + "/"); err != nil {
+			logrus.Warningf("failed to list the creation time of backups under (%s): %v", prefix, err)
+		}
+	}
+	idx := &backupapi.BackupIndex{RebuiltAt: time.Now()}
+	for _, name := range names {
+		idx.Put(backupapi.BackupIndexEntry{
+			Name:      name,
+			Revision:  util.MustParseRevision(name),
+			Version:   strings.SplitN(name, "_", 2)[0],
+			CreatedAt: modTimes[path.Join(prefix, name)],
+		})
+	}
+	return idx, nil
+}
+
+// writeIndex writes idx as the index of the given prefix of w.
+// It first writes a temporary copy of the index, so that a crash while writing the index leaves
+// the copy whole. Since writers may keep a file that already exists, e.g. the PV writer,
+// each file is deleted before it is written.
+func writeIndex(ctx context.Context, w writer.Writer, prefix string, idx *backupapi.BackupIndex) error {
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{indexPath(prefix) + indexTmpExtension, indexPath(prefix)} {
+		if err = w.Delete(p); err != nil && !writer.IsPartialWrite(err) {
+			return fmt.Errorf("failed to delete backup index (%s): %v", p, err)
+		}
+		if _, err = w.Write(ctx, p, bytes.NewReader(b)); err != nil && !writer.IsPartialWrite(err) {
+			return fmt.Errorf("failed to write backup index (%s): %v", p, err)
+		}
+	}
+	return nil
+}
+
+// listBackupsWithPrefix returns the names of the backups that w stored directly under
+// the given prefix in ascending revision order. The backups in nested prefixes belong to other clusters.
+func listBackupsWithPrefix(w writer.Writer, prefix string) ([]string, error) {
+	paths, err := w.List(strings.TrimSuffix(prefix, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups under (%s): %v", prefix, err)
+	}
+	names := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if path.Dir(p) != path.Clean(prefix) {
+			continue
+		}
+		names = append(names, path.Base(p))
+	}
+	return util.FilterAndSortBackups(names), nil
+}
+
+// LatestBackupWithPrefix returns the path of the latest backup saved by SaveSnapWithPrefix under
+// the given prefix of w, or an empty path if there is none.
+// It looks the backup up in the index of the prefix and falls back to listing w
+// if the index is missing or due to be rebuilt.
+func LatestBackupWithPrefix(w writer.Writer, prefix string) (string, error) {
+	var names []string
+	if idx := readFreshIndex(w, prefix); idx != nil {
+		names = idx.Names()
+	} else {
+		var err error
+		if names, err = listBackupsWithPrefix(w, prefix); err != nil {
+			return "", err
+		}
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	return path.Join(prefix, names[len(names)-1]), nil
+}
+
+// loadIndex returns the index of the given prefix, rebuilt from listing the storage if it is missing
+// or due to be rebuilt. It returns nil if the writer can't read back files or the index can't be rebuilt,
+// in which case the storage is listed instead.
+func (bm *BackupManager) loadIndex(prefix string) *backupapi.BackupIndex {
+	if _, ok := bm.bw.(writer.Opener); !ok {
+		return nil
+	}
+	if idx := readFreshIndex(bm.bw, prefix); idx != nil {
+		return idx
+	}
+	idx, err := rebuildIndex(bm.bw, prefix)
+	if err != nil {
+		bm.getLogger().WithError(err).Warning("failed to rebuild backup index")
+		return nil
+	}
+	return idx
+}
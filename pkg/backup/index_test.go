@@ -0,0 +1,166 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+
+	"golang.org/x/net/context"
+)
+
+func TestWriteAndReadIndex(t *testing.T) {
+	fw := writer.NewFakeWriter()
+	prefix := "bucket/v1/default/example"
+	idx := &backupapi.BackupIndex{RebuiltAt: time.Now()}
+	for rev := int64(3); rev >= 1; rev-- {
+		idx.Put(backupapi.BackupIndexEntry{Name: util.MakeBackupName(testEtcdVersion, rev), Revision: rev, Version: testEtcdVersion})
+	}
+	if err := writeIndex(context.Background(), fw, prefix, idx); err != nil {
+		t.Fatal(err)
+	}
+	// writing again replaces the index.
+	idx.Remove(util.MakeBackupName(testEtcdVersion, 1))
+	if err := writeIndex(context.Background(), fw, prefix, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readIndex(fw, prefix)
+	if got == nil {
+		t.Fatal("expect index")
+	}
+	want := []string{util.MakeBackupName(testEtcdVersion, 2), util.MakeBackupName(testEtcdVersion, 3)}
+	if !reflect.DeepEqual(got.Names(), want) {
+		t.Errorf("names = %v, want %v", got.Names(), want)
+	}
+
+	// a crash while writing the index leaves the temporary copy whole.
+	if _, err := fw.Write(context.Background(), indexPath(prefix), bytes.NewBufferString(`{"backups": [`)); err != nil {
+		t.Fatal(err)
+	}
+	if got = readIndex(fw, prefix); got == nil || !reflect.DeepEqual(got.Names(), want) {
+		t.Errorf("expect the temporary copy of the index to be read, got %v", got)
+	}
+}
+
+// TestLatestBackupWithPrefix ensures the latest backup is looked up in the index if it is fresh,
+// and by listing the storage if the index is missing or due to be rebuilt.
+func TestLatestBackupWithPrefix(t *testing.T) {
+	fw := writer.NewFakeWriter()
+	prefix := "bucket/v1/default/example"
+	for rev := int64(1); rev <= 2; rev++ {
+		if _, err := fw.Write(context.Background(), path.Join(prefix, util.MakeBackupName(testEtcdVersion, rev)), bytes.NewBufferString(testData)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := LatestBackupWithPrefix(fw, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := path.Join(prefix, util.MakeBackupName(testEtcdVersion, 2)); p != want {
+		t.Errorf("latest backup without index = %s, want %s", p, want)
+	}
+
+	// the index only knows of the first backup.
+	idx := &backupapi.BackupIndex{RebuiltAt: time.Now()}
+	idx.Put(backupapi.BackupIndexEntry{Name: util.MakeBackupName(testEtcdVersion, 1), Revision: 1, Version: testEtcdVersion})
+	if err = writeIndex(context.Background(), fw, prefix, idx); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = LatestBackupWithPrefix(fw, prefix); err != nil {
+		t.Fatal(err)
+	}
+	if want := path.Join(prefix, util.MakeBackupName(testEtcdVersion, 1)); p != want {
+		t.Errorf("latest backup with index = %s, want %s", p, want)
+	}
+
+	idx.RebuiltAt = time.Now().Add(-2 * indexRebuildInterval)
+	if err = writeIndex(context.Background(), fw, prefix, idx); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = LatestBackupWithPrefix(fw, prefix); err != nil {
+		t.Fatal(err)
+	}
+	if want := path.Join(prefix, util.MakeBackupName(testEtcdVersion, 2)); p != want {
+		t.Errorf("latest backup with stale index = %s, want %s", p, want)
+	}
+}
+
+func TestLoadIndexRebuilds(t *testing.T) {
+	fw := writer.NewFakeWriter()
+	bm := NewBackupManagerFromWriter(nil, fw, "example", "default", nil, BackupRetentionPolicy{}, "", 0)
+	prefix := "bucket/v1/default/example"
+	created := time.Now().Add(-time.Hour)
+	names := []string{util.MakeBackupName(testEtcdVersion, 1), util.MakeBackupName(testEtcdVersion, 2)}
+	for _, name := range names {
+		p := path.Join(prefix, name)
+		if _, err := fw.Write(context.Background(), p, bytes.NewBufferString(testData)); err != nil {
+			t.Fatal(err)
+		}
+		fw.SetModTime(p, created)
+	}
+
+	idx := bm.loadIndex(prefix)
+	if idx == nil {
+		t.Fatal("expect index rebuilt from listing")
+	}
+	if !reflect.DeepEqual(idx.Names(), names) {
+		t.Errorf("names = %v, want %v", idx.Names(), names)
+	}
+	times, ok := idx.CreationTimes()
+	if !ok || !times[names[0]].Equal(created) {
+		t.Errorf("expect creation times from listing, got %v", times)
+	}
+	if e := idx.Backups[1]; e.Revision != 2 || e.Version != testEtcdVersion {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
+
+// TestPurgeBackupsWithPrefixIndex ensures the purged backups are looked up in the index and removed from it.
+func TestPurgeBackupsWithPrefixIndex(t *testing.T) {
+	fw := writer.NewFakeWriter()
+	bm := NewBackupManagerFromWriter(nil, fw, "example", "default", nil, BackupRetentionPolicy{}, "", 0)
+	prefix := "bucket/v1/default/example"
+	idx := &backupapi.BackupIndex{RebuiltAt: time.Now()}
+	for rev := int64(1); rev <= 3; rev++ {
+		name := util.MakeBackupName(testEtcdVersion, rev)
+		if _, err := fw.Write(context.Background(), path.Join(prefix, name), bytes.NewBufferString(testData)); err != nil {
+			t.Fatal(err)
+		}
+		// the first backup is missing from the index, so it is not purged until the index is rebuilt.
+		if rev > 1 {
+			idx.Put(backupapi.BackupIndexEntry{Name: name, Revision: rev, Version: testEtcdVersion})
+		}
+	}
+
+	bm.purgeBackupsWithPrefix(context.Background(), prefix, idx, 1)
+	if want := []string{util.MakeBackupName(testEtcdVersion, 3)}; !reflect.DeepEqual(idx.Names(), want) {
+		t.Errorf("index after purge = %v, want %v", idx.Names(), want)
+	}
+	if _, ok := fw.Get(path.Join(prefix, util.MakeBackupName(testEtcdVersion, 2))); ok {
+		t.Error("expect the backup in the index to be purged")
+	}
+	if _, ok := fw.Get(path.Join(prefix, util.MakeBackupName(testEtcdVersion, 1))); !ok {
+		t.Error("expect the backup missing from the index to be kept")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+
+	"golang.org/x/net/context"
+)
+
+// writeLatest points the latest alias under the given prefix of w, util.LatestBackupName,
+// at the backup saved at fullPath by copying the backup, on the storage server if w can,
+// and describes the backup in backupapi.LatestBackupInfoName.
+// If only secondary writers fail, it updates what it can and returns the *writer.PartialWriteError.
+func writeLatest(ctx context.Context, w writer.Writer, prefix, fullPath string, rev int64, sum string) error {
+	var perr error
+	latestPath := path.Join(prefix, util.LatestBackupName)
+	err := writer.Copy(ctx, w, fullPath, latestPath)
+	switch {
+	case writer.IsPartialWrite(err):
+		perr = err
+	case err != nil:
+		return fmt.Errorf("failed to copy backup to (%s): %v", latestPath, err)
+	}
+
+	b, err := json.Marshal(&backupapi.LatestBackupInfo{
+		Name:     path.Base(fullPath),
+		Revision: rev,
+		SHA256:   sum,
+	})
+	if err != nil {
+		return err
+	}
+	infoPath := path.Join(prefix, backupapi.LatestBackupInfoName)
+	// writers may keep a file that already exists, e.g. the PV writer.
+	if err = w.Delete(infoPath); err != nil && !writer.IsPartialWrite(err) {
+		return fmt.Errorf("failed to delete (%s): %v", infoPath, err)
+	}
+	_, err = w.Write(ctx, infoPath, bytes.NewReader(b))
+	switch {
+	case writer.IsPartialWrite(err):
+		perr = err
+	case err != nil:
+		return fmt.Errorf("failed to write (%s): %v", infoPath, err)
+	}
+	return perr
+}
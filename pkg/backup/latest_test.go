@@ -0,0 +1,74 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+
+	"golang.org/x/net/context"
+)
+
+func TestWriteLatest(t *testing.T) {
+	fw := writer.NewFakeWriter()
+	prefix := "bucket/v1/default/example"
+	for rev := int64(1); rev <= 2; rev++ {
+		fullPath := path.Join(prefix, util.MakeBackupName(testEtcdVersion, rev))
+		data := []byte(fullPath)
+		if _, err := fw.Write(context.Background(), fullPath, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		sum := fmt.Sprintf("%x", sha256.Sum256(data))
+		if err := writeLatest(context.Background(), fw, prefix, fullPath, rev, sum); err != nil {
+			t.Fatal(err)
+		}
+
+		b, ok := fw.Get(path.Join(prefix, util.LatestBackupName))
+		if !ok || !bytes.Equal(b, data) {
+			t.Errorf("#%d: latest alias = %q, want %q", rev, b, data)
+		}
+		b, ok = fw.Get(path.Join(prefix, backupapi.LatestBackupInfoName))
+		if !ok {
+			t.Fatalf("#%d: latest backup info not written", rev)
+		}
+		info, err := backupapi.ParseLatestBackupInfo(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := backupapi.LatestBackupInfo{Name: path.Base(fullPath), Revision: rev, SHA256: sum}
+		if *info != want {
+			t.Errorf("#%d: latest backup info = %+v, want %+v", rev, *info, want)
+		}
+	}
+
+	// the alias is not a backup of its own.
+	names, err := listBackupsWithPrefix(fw, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Errorf("expect 2 backups, got %v", names)
+	}
+	if err = writeLatest(context.Background(), fw, prefix, path.Join(prefix, "missing"), 3, ""); err == nil {
+		t.Error("expect error updating the alias to a missing backup")
+	}
+}
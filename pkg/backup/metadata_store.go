@@ -0,0 +1,164 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// defaultMaxMetadataEntries bounds the entries of a metadata store without a retention limit,
+	// which keeps the ConfigMap well below the 1MB limit of Kubernetes objects.
+	defaultMaxMetadataEntries = 1000
+
+	// metadataUpdateAttempts is the number of attempts to update the ConfigMap on conflicts
+	// with a concurrent update.
+	metadataUpdateAttempts = 5
+)
+
+// MetadataStore records the statuses of the saved backups, e.g. for auditing.
+type MetadataStore interface {
+	// Record records the status of the backup of the given name.
+	Record(name string, bs *backupapi.BackupStatus) error
+	// List returns the recorded statuses keyed by backup name.
+	List() (map[string]*backupapi.BackupStatus, error)
+}
+
+// MetadataConfigMapName returns the name of the ConfigMap the backup metadata of the given cluster are stored in.
+func MetadataConfigMapName(clusterName string) string {
+	return clusterName + "-backup-metadata"
+}
+
+type configMapMetadataStore struct {
+	kubecli     kubernetes.Interface
+	clusterName string
+	namespace   string
+	// maxEntries is the maximum number of entries kept. The entries of the oldest revisions are removed first.
+	maxEntries int
+}
+
+// NewConfigMapMetadataStore returns a MetadataStore which records the backup statuses of the given cluster
+// as JSON in the ConfigMap named MetadataConfigMapName, labeled with the cluster.
+// It keeps the entries of the latest maxEntries backups, or of the latest 1000 if maxEntries is 0.
+func NewConfigMapMetadataStore(kubecli kubernetes.Interface, clusterName, namespace string, maxEntries int) MetadataStore {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxMetadataEntries
+	}
+	return &configMapMetadataStore{
+		kubecli:     kubecli,
+		clusterName: clusterName,
+		namespace:   namespace,
+		maxEntries:  maxEntries,
+	}
+}
+
+func (s *configMapMetadataStore) Record(name string, bs *backupapi.BackupStatus) error {
+	b, err := json.Marshal(bs)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		err = s.record(name, string(b))
+		if err == nil || i == metadataUpdateAttempts-1 || !(apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record backup metadata in configmap (%s): %v", MetadataConfigMapName(s.clusterName), err)
+	}
+	return nil
+}
+
+func (s *configMapMetadataStore) record(name, entry string) error {
+	cms := s.kubecli.CoreV1().ConfigMaps(s.namespace)
+	cm, err := cms.Get(MetadataConfigMapName(s.clusterName), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   MetadataConfigMapName(s.clusterName),
+				Labels: k8sutil.LabelsForCluster(s.clusterName),
+			},
+			Data: map[string]string{name: entry},
+		}
+		_, err = cms.Create(cm)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[name] = entry
+	s.trim(cm.Data)
+	_, err = cms.Update(cm)
+	return err
+}
+
+// trim removes the entries of the oldest revisions beyond maxEntries.
+// Entries which can't be decoded count as the oldest.
+func (s *configMapMetadataStore) trim(data map[string]string) {
+	if len(data) <= s.maxEntries {
+		return
+	}
+	type entry struct {
+		name string
+		rev  int64
+	}
+	entries := make([]entry, 0, len(data))
+	for name, v := range data {
+		var bs backupapi.BackupStatus
+		json.Unmarshal([]byte(v), &bs)
+		entries = append(entries, entry{name: name, rev: bs.Revision})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].rev != entries[j].rev {
+			return entries[i].rev < entries[j].rev
+		}
+		return entries[i].name < entries[j].name
+	})
+	for _, e := range entries[:len(entries)-s.maxEntries] {
+		delete(data, e.name)
+	}
+}
+
+func (s *configMapMetadataStore) List() (map[string]*backupapi.BackupStatus, error) {
+	cm, err := s.kubecli.CoreV1().ConfigMaps(s.namespace).Get(MetadataConfigMapName(s.clusterName), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return map[string]*backupapi.BackupStatus{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]*backupapi.BackupStatus, len(cm.Data))
+	for name, v := range cm.Data {
+		bs := &backupapi.BackupStatus{}
+		if err := json.Unmarshal([]byte(v), bs); err != nil {
+			return nil, fmt.Errorf("invalid metadata of backup (%s): %v", name, err)
+		}
+		statuses[name] = bs
+	}
+	return statuses, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapMetadataStore(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	s := NewConfigMapMetadataStore(kubecli, "example", "default", 2)
+
+	for _, rev := range []int64{3, 1, 2} {
+		bs := &backupapi.BackupStatus{Name: util.MakeBackupName("3.1.8", rev), Revision: rev, Version: "3.1.8"}
+		if err := s.Record(bs.Name, bs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statuses, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the entry of the oldest revision is removed.
+	if len(statuses) != 2 {
+		t.Fatalf("expect 2 entries, got %d", len(statuses))
+	}
+	for _, rev := range []int64{2, 3} {
+		bs, ok := statuses[util.MakeBackupName("3.1.8", rev)]
+		if !ok || bs.Revision != rev {
+			t.Errorf("expect entry of revision %d, got %v", rev, bs)
+		}
+	}
+
+	cm, err := kubecli.CoreV1().ConfigMaps("default").Get("example-backup-metadata", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Labels["etcd_cluster"] != "example" {
+		t.Errorf("expect configmap labeled with the cluster, got labels %v", cm.Labels)
+	}
+}
+
+func TestConfigMapMetadataStoreListEmpty(t *testing.T) {
+	s := NewConfigMapMetadataStore(fake.NewSimpleClientset(), "example", "default", 0)
+	statuses, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 0 {
+		t.Errorf("expect no entries, got %v", statuses)
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics provides the Prometheus metrics of the backups saved by a BackupManager.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "etcd_operator"
+	subsystem = "backup"
+
+	clusterLabel = "cluster"
+	// reasonLabel is the class of the cause of a failed backup, e.g. "etcd" or "storage".
+	reasonLabel = "reason"
+	// alarmLabel is the name of an etcd alarm, e.g. "NOSPACE".
+	alarmLabel = "alarm"
+)
+
+// Metrics records the backups of etcd clusters. A nil *Metrics records nothing.
+type Metrics struct {
+	duration         *prometheus.HistogramVec
+	size             *prometheus.HistogramVec
+	attempts         *prometheus.CounterVec
+	successes        *prometheus.CounterVec
+	failures         *prometheus.CounterVec
+	revisionsSkipped *prometheus.CounterVec
+	purgeFailed      *prometheus.CounterVec
+	corruptSnapshots *prometheus.CounterVec
+	latestFailed     *prometheus.CounterVec
+	inProgress       *prometheus.CounterVec
+
+	lastSuccess   *prometheus.GaugeVec
+	lastSize      *prometheus.GaugeVec
+	lastDuration  *prometheus.GaugeVec
+	storedBackups *prometheus.GaugeVec
+	alarms        *prometheus.GaugeVec
+	backoff       *prometheus.GaugeVec
+}
+
+// New creates Metrics and registers them with reg.
+// Metrics already registered with reg, e.g. by another BackupManager, are shared.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "duration_seconds",
+			Help:      "Time it took to save a backup",
+			Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+		}, []string{clusterLabel}),
+		size: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "size_bytes",
+			Help:      "Size of the saved snapshots before compression",
+			// 1MiB to 8GiB
+			Buckets: prometheus.ExponentialBuckets(1<<20, 2, 14),
+		}, []string{clusterLabel}),
+		attempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "attempts_total",
+			Help:      "Total number of backups attempted, whether saved, skipped or failed",
+		}, []string{clusterLabel}),
+		successes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "successes_total",
+			Help:      "Total number of backups saved",
+		}, []string{clusterLabel}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "failures_total",
+			Help:      "Total number of backups that failed to be saved, by the class of their cause",
+		}, []string{clusterLabel, reasonLabel}),
+		revisionsSkipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "revisions_skipped_total",
+			Help:      "Total number of backups skipped because the cluster revision had not changed since the latest backup",
+		}, []string{clusterLabel}),
+		purgeFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "purge_failed_total",
+			Help:      "Total number of backups that failed to be deleted by the retention policy",
+		}, []string{clusterLabel}),
+		corruptSnapshots: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "corrupt_snapshots_total",
+			Help:      "Total number of backups deleted because their snapshot failed verification",
+		}, []string{clusterLabel}),
+		latestFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "latest_failed_total",
+			Help:      "Total number of backups saved without updating the latest backup alias",
+		}, []string{clusterLabel}),
+		inProgress: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "skipped_in_progress_total",
+			Help:      "Total number of backups skipped because another backup of the cluster was in progress",
+		}, []string{clusterLabel}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix time of the latest backup saved",
+		}, []string{clusterLabel}),
+		lastSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "last_size_bytes",
+			Help:      "Size of the snapshot of the latest backup saved, before compression",
+		}, []string{clusterLabel}),
+		lastDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "last_duration_seconds",
+			Help:      "Time it took to save the latest backup",
+		}, []string{clusterLabel}),
+		storedBackups: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "stored_backups",
+			Help:      "Number of backups in the storage after the retention policy is applied",
+		}, []string{clusterLabel}),
+		alarms: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "etcd_alarm",
+			Help:      "Whether the etcd alarm was raised in the cluster before the latest backup, 1 if raised and 0 otherwise",
+		}, []string{clusterLabel, alarmLabel}),
+		backoff: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "failure_backoff_seconds",
+			Help:      "Wait before the next scheduled backup after consecutive failed backups, 0 if the latest backup did not fail",
+		}, []string{clusterLabel}),
+	}
+
+	c, err := register(reg, m.duration)
+	if err != nil {
+		return nil, err
+	}
+	m.duration = c.(*prometheus.HistogramVec)
+	if c, err = register(reg, m.size); err != nil {
+		return nil, err
+	}
+	m.size = c.(*prometheus.HistogramVec)
+	if c, err = register(reg, m.attempts); err != nil {
+		return nil, err
+	}
+	m.attempts = c.(*prometheus.CounterVec)
+	if c, err = register(reg, m.successes); err != nil {
+		return nil, err
+	}
+	m.successes = c.(*prometheus.CounterVec)
+	if c, err = register(reg, m.failures); err != nil {
+		return nil, err
+	}
+	m.failures = c.(*prometheus.CounterVec)
+	if c, err = register(reg, m.revisionsSkipped); err != nil {
+		return nil, err
+	}
+	m.revisionsSkipped = c.(*prometheus.CounterVec)
+	if c, err = register(reg, m.purgeFailed); err != nil {
+		return nil, err
+	}
+	m.purgeFailed = c.(*prometheus.CounterVec)
+	if c, err = register(reg, m.corruptSnapshots); err != nil {
+		return nil, err
+	}
+	m.corruptSnapshots = c.(*prometheus.CounterVec)
+	if c, err = register(reg, m.latestFailed); err != nil {
+		return nil, err
+	}
+	m.latestFailed = c.(*prometheus.CounterVec)
+	if c, err = register(reg, m.inProgress); err != nil {
+		return nil, err
+	}
+	m.inProgress = c.(*prometheus.CounterVec)
+	for _, g := range []**prometheus.GaugeVec{&m.lastSuccess, &m.lastSize, &m.lastDuration, &m.storedBackups, &m.alarms, &m.backoff} {
+		if c, err = register(reg, *g); err != nil {
+			return nil, err
+		}
+		*g = c.(*prometheus.GaugeVec)
+	}
+	return m, nil
+}
+
+// register registers c with reg and returns the collector that is registered,
+// which is the existing one if an equal collector was already registered.
+func register(reg prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// IncAttempts records a backup of the given cluster that is attempted.
+func (m *Metrics) IncAttempts(cluster string) {
+	if m == nil {
+		return
+	}
+	m.attempts.WithLabelValues(cluster).Inc()
+}
+
+// ObserveBackup records a backup of the given cluster saved now that took d and whose snapshot has size bytes.
+func (m *Metrics) ObserveBackup(cluster string, d time.Duration, size int64) {
+	if m == nil {
+		return
+	}
+	m.successes.WithLabelValues(cluster).Inc()
+	m.duration.WithLabelValues(cluster).Observe(d.Seconds())
+	m.size.WithLabelValues(cluster).Observe(float64(size))
+	m.lastSuccess.WithLabelValues(cluster).Set(float64(time.Now().Unix()))
+	m.lastSize.WithLabelValues(cluster).Set(float64(size))
+	m.lastDuration.WithLabelValues(cluster).Set(d.Seconds())
+}
+
+// IncFailures records a backup of the given cluster that failed for the given class of reason.
+func (m *Metrics) IncFailures(cluster, reason string) {
+	if m == nil {
+		return
+	}
+	m.failures.WithLabelValues(cluster, reason).Inc()
+}
+
+// SetStoredBackups records the number of backups of the given cluster in the storage.
+func (m *Metrics) SetStoredBackups(cluster string, n int) {
+	if m == nil {
+		return
+	}
+	m.storedBackups.WithLabelValues(cluster).Set(float64(n))
+}
+
+// IncRevisionsSkipped records a backup of the given cluster that was skipped because its revision had not changed.
+func (m *Metrics) IncRevisionsSkipped(cluster string) {
+	if m == nil {
+		return
+	}
+	m.revisionsSkipped.WithLabelValues(cluster).Inc()
+}
+
+// IncPurgeFailed records a backup of the given cluster that failed to be deleted by the retention policy.
+func (m *Metrics) IncPurgeFailed(cluster string) {
+	if m == nil {
+		return
+	}
+	m.purgeFailed.WithLabelValues(cluster).Inc()
+}
+
+// IncCorruptSnapshots records a backup of the given cluster that was deleted because its snapshot failed verification.
+func (m *Metrics) IncCorruptSnapshots(cluster string) {
+	if m == nil {
+		return
+	}
+	m.corruptSnapshots.WithLabelValues(cluster).Inc()
+}
+
+// IncLatestFailed records a backup of the given cluster that was saved without updating the latest backup alias.
+func (m *Metrics) IncLatestFailed(cluster string) {
+	if m == nil {
+		return
+	}
+	m.latestFailed.WithLabelValues(cluster).Inc()
+}
+
+// IncSkippedInProgress records a backup of the given cluster that was skipped because another one was in progress.
+func (m *Metrics) IncSkippedInProgress(cluster string) {
+	if m == nil {
+		return
+	}
+	m.inProgress.WithLabelValues(cluster).Inc()
+}
+
+// SetAlarm records whether the given etcd alarm is raised in the given cluster.
+func (m *Metrics) SetAlarm(cluster, alarm string, raised bool) {
+	if m == nil {
+		return
+	}
+	v := 0.0
+	if raised {
+		v = 1
+	}
+	m.alarms.WithLabelValues(cluster, alarm).Set(v)
+}
+
+// SetFailureBackoff records the wait before the next scheduled backup of the given cluster after failed backups.
+func (m *Metrics) SetFailureBackoff(cluster string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.backoff.WithLabelValues(cluster).Set(d.Seconds())
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsShareRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m1, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := New(reg)
+	if err != nil {
+		t.Fatalf("expect metrics registered twice to be shared, got %v", err)
+	}
+
+	m1.IncAttempts("a")
+	m1.ObserveBackup("a", time.Second, 1<<20)
+	m2.IncFailures("b", "etcd")
+	m2.SetStoredBackups("b", 3)
+	m2.IncRevisionsSkipped("b")
+	m2.IncPurgeFailed("b")
+	m2.IncCorruptSnapshots("b")
+	m2.IncLatestFailed("b")
+	m2.IncSkippedInProgress("b")
+	m2.SetAlarm("b", "NOSPACE", true)
+	m2.SetFailureBackoff("b", time.Minute)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for _, mf := range mfs {
+		got[mf.GetName()] = len(mf.GetMetric())
+	}
+	for _, name := range []string{
+		"etcd_operator_backup_duration_seconds",
+		"etcd_operator_backup_size_bytes",
+		"etcd_operator_backup_attempts_total",
+		"etcd_operator_backup_successes_total",
+		"etcd_operator_backup_failures_total",
+		"etcd_operator_backup_revisions_skipped_total",
+		"etcd_operator_backup_purge_failed_total",
+		"etcd_operator_backup_corrupt_snapshots_total",
+		"etcd_operator_backup_latest_failed_total",
+		"etcd_operator_backup_skipped_in_progress_total",
+		"etcd_operator_backup_last_success_timestamp_seconds",
+		"etcd_operator_backup_last_size_bytes",
+		"etcd_operator_backup_last_duration_seconds",
+		"etcd_operator_backup_stored_backups",
+		"etcd_operator_backup_etcd_alarm",
+		"etcd_operator_backup_failure_backoff_seconds",
+	} {
+		if got[name] != 1 {
+			t.Errorf("expect 1 series of %s, got %d", name, got[name])
+		}
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.IncAttempts("a")
+	m.ObserveBackup("a", time.Second, 1)
+	m.IncFailures("a", "etcd")
+	m.SetStoredBackups("a", 1)
+	m.IncRevisionsSkipped("a")
+	m.IncPurgeFailed("a")
+	m.IncCorruptSnapshots("a")
+	m.SetAlarm("a", "NOSPACE", true)
+	m.IncLatestFailed("a")
+	m.IncSkippedInProgress("a")
+	m.SetFailureBackoff("a", time.Second)
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultMultiClusterConcurrency is the default maximum number of clusters backed up at the same time.
+const defaultMultiClusterConcurrency = 4
+
+// ClusterRef identifies an etcd cluster backed up by a MultiClusterBackupManager.
+type ClusterRef struct {
+	Namespace   string
+	ClusterName string
+	// TLSConfig is used to talk to the cluster. It is nil if the cluster does not use TLS.
+	TLSConfig *tls.Config
+	// Credentials are the etcd username and password to talk to the cluster with. It is nil if the cluster
+	// does not enable the etcd authentication.
+	Credentials *EtcdCredentials
+}
+
+// Key returns the key of the cluster in the results of MultiClusterBackupManager.SaveSnaps, namespace/name.
+func (c ClusterRef) Key() string {
+	return c.Namespace + "/" + c.ClusterName
+}
+
+// BackendFunc returns the backend the backups of the given cluster are saved to.
+// Backup names don't identify their cluster, so the clusters can't share a single backend:
+// the latest backup of one cluster would be taken for the latest of another, and the retention
+// of one would purge the backups of the others. The backends may still share a bucket or a
+// directory as long as each is scoped to its cluster, e.g. by backupapi.ToS3Prefix.
+type BackendFunc func(namespace, clusterName string) (backend.Backend, error)
+
+// MultiClusterBackupManager backs up several etcd clusters, e.g. one per namespace, in a single run.
+type MultiClusterBackupManager struct {
+	clusters []ClusterRef
+	managers map[string]*BackupManager
+	// concurrency is the maximum number of clusters backed up at the same time.
+	concurrency int
+}
+
+// MultiClusterBackupError is returned by MultiClusterBackupManager.SaveSnaps
+// if the backups of some clusters failed.
+type MultiClusterBackupError struct {
+	// Errors are the errors of the failed backups by cluster, keyed by ClusterRef.Key.
+	Errors map[string]error
+}
+
+func (e *MultiClusterBackupError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, e.Errors[name]))
+	}
+	return fmt.Sprintf("failed to back up %d cluster(s): %s", len(names), strings.Join(msgs, "; "))
+}
+
+// NewMultiClusterBackupManager creates a MultiClusterBackupManager that backs up the given clusters to the backends
+// returned by newBackend, at most concurrency clusters at a time. Each cluster must be given once.
+func NewMultiClusterBackupManager(kubecli kubernetes.Interface, clusters []ClusterRef, newBackend BackendFunc, concurrency int) (*MultiClusterBackupManager, error) {
+	if concurrency <= 0 {
+		concurrency = defaultMultiClusterConcurrency
+	}
+	m := &MultiClusterBackupManager{
+		clusters:    clusters,
+		managers:    make(map[string]*BackupManager, len(clusters)),
+		concurrency: concurrency,
+	}
+	for _, c := range clusters {
+		if _, ok := m.managers[c.Key()]; ok {
+			return nil, fmt.Errorf("duplicate cluster (%s)", c.Key())
+		}
+		be, err := newBackend(c.Namespace, c.ClusterName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create backend for cluster (%s/%s): %v", c.Namespace, c.ClusterName, err)
+		}
+		bm := NewBackupManager(kubecli, c.ClusterName, c.Namespace, c.TLSConfig, be)
+		bm.SetEtcdCredentials(c.Credentials)
+		m.managers[c.Key()] = bm
+	}
+	return m, nil
+}
+
+// SaveSnaps saves a snapshot of each cluster whose revision moved past its latest backup.
+// A cluster that fails, e.g. because it is unreachable, doesn't stop the others.
+// It returns the statuses of the backups keyed by ClusterRef.Key, where the status is nil if the cluster
+// has not changed since its latest backup, and a *MultiClusterBackupError if any backup failed.
+func (m *MultiClusterBackupManager) SaveSnaps(ctx context.Context) (map[string]*backupapi.BackupStatus, error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		statuses = make(map[string]*backupapi.BackupStatus, len(m.clusters))
+		errs     = make(map[string]error)
+	)
+	sem := make(chan struct{}, m.concurrency)
+	for _, c := range m.clusters {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			var (
+				bs  *backupapi.BackupStatus
+				err error
+			)
+			select {
+			case sem <- struct{}{}:
+				bs, err = m.saveSnap(ctx, m.managers[name])
+				<-sem
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logrus.Errorf("failed to back up cluster (%s): %v", name, err)
+				errs[name] = err
+				return
+			}
+			statuses[name] = bs
+		}(c.Key())
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return statuses, &MultiClusterBackupError{Errors: errs}
+	}
+	return statuses, nil
+}
+
+func (m *MultiClusterBackupManager) saveSnap(ctx context.Context, bm *BackupManager) (*backupapi.BackupStatus, error) {
+	return bm.SaveSnap(ctx, LatestBackupRevUnknown)
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+
+	"golang.org/x/net/context"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestMultiClusterSaveSnapsAggregatesErrors ensures a cluster that can't be backed up
+// fails on its own and its error is reported by namespace/name.
+func TestMultiClusterSaveSnapsAggregatesErrors(t *testing.T) {
+	d, err := ioutil.TempDir("", "multi-cluster-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+
+	clusters := []ClusterRef{
+		{Namespace: "ns-a", ClusterName: "a"},
+		{Namespace: "ns-b", ClusterName: "b"},
+		// the same cluster name in another namespace is another cluster.
+		{Namespace: "ns-c", ClusterName: "b"},
+	}
+	newBackend := func(namespace, clusterName string) (backend.Backend, error) {
+		dir := filepath.Join(d, namespace, clusterName)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		return backend.NewFileBackend(dir), nil
+	}
+	// The clusters have no pods, so neither is reachable.
+	m, err := NewMultiClusterBackupManager(fake.NewSimpleClientset(), clusters, newBackend, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := m.SaveSnaps(context.Background())
+	mcErr, ok := err.(*MultiClusterBackupError)
+	if !ok {
+		t.Fatalf("expect *MultiClusterBackupError, got %v", err)
+	}
+	for _, c := range clusters {
+		if mcErr.Errors[c.Key()] == nil {
+			t.Errorf("expect error for cluster (%s)", c.Key())
+		}
+		if _, ok := statuses[c.Key()]; ok {
+			t.Errorf("expect no status for failed cluster (%s)", c.Key())
+		}
+	}
+	if len(mcErr.Errors) != len(clusters) {
+		t.Errorf("expect %d errors, got %d", len(clusters), len(mcErr.Errors))
+	}
+}
+
+func TestNewMultiClusterBackupManager(t *testing.T) {
+	newBackend := func(namespace, clusterName string) (backend.Backend, error) {
+		if clusterName == "bad" {
+			return nil, errors.New("no backend")
+		}
+		return backend.NewFileBackend(os.TempDir()), nil
+	}
+	tests := []struct {
+		clusters []ClusterRef
+		wantErr  bool
+	}{
+		{clusters: []ClusterRef{{Namespace: "a", ClusterName: "c1"}, {Namespace: "b", ClusterName: "c2"}}},
+		{clusters: []ClusterRef{{Namespace: "a", ClusterName: "c1"}, {Namespace: "b", ClusterName: "c1"}}},
+		{clusters: []ClusterRef{{Namespace: "a", ClusterName: "c1"}, {Namespace: "a", ClusterName: "c1"}}, wantErr: true},
+		{clusters: []ClusterRef{{Namespace: "a", ClusterName: "bad"}}, wantErr: true},
+	}
+	for i, tt := range tests {
+		_, err := NewMultiClusterBackupManager(fake.NewSimpleClientset(), tt.clusters, newBackend, 0)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: expect error %v, got %v", i, tt.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"io"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// progressInterval is how often the progress of a snapshot being saved is logged.
+	progressInterval = 30 * time.Second
+	// progressBytes is how many bytes of a snapshot being saved are read between two progress logs at most.
+	progressBytes = 1 << 30
+	// progressMinBytes is the size below which the progress of a snapshot is not logged,
+	// so that the snapshots of small clusters, saved within seconds, log nothing.
+	progressMinBytes = 64 << 20
+)
+
+// progressReader counts the bytes of a snapshot read through it as it is saved, and logs them with the
+// throughput every progressInterval or progressBytes, once more than progressMinBytes were read, so that
+// a large snapshot being saved can be told from a hung one. The bytes are passed through unchanged.
+type progressReader struct {
+	r      io.Reader
+	logger *logrus.Entry
+
+	n     int64
+	start time.Time
+	// lastLog and lastLogN are when and at how many bytes the progress was last logged.
+	lastLog  time.Time
+	lastLogN int64
+	// now returns the current time. If nil, time.Now is used.
+	now func() time.Time
+}
+
+// newProgressReader returns a progressReader of r which logs with logger.
+func newProgressReader(r io.Reader, logger *logrus.Entry) *progressReader {
+	now := time.Now()
+	return &progressReader{r: r, logger: logger, start: now, lastLog: now}
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.n += int64(n)
+	if pr.n >= progressMinBytes {
+		now := pr.clock()
+		if now.Sub(pr.lastLog) >= progressInterval || pr.n-pr.lastLogN >= progressBytes {
+			pr.lastLog, pr.lastLogN = now, pr.n
+			pr.logger.WithFields(logrus.Fields{
+				"size_mb":         util.ToMB(pr.n),
+				"duration_s":      now.Sub(pr.start).Seconds(),
+				"throughput_mb_s": pr.throughputAt(now),
+			}).Info("saving snapshot")
+		}
+	}
+	return n, err
+}
+
+// throughput returns the bytes read so far per second since pr was created, in MB.
+func (pr *progressReader) throughput() float64 {
+	return pr.throughputAt(pr.clock())
+}
+
+func (pr *progressReader) throughputAt(now time.Time) float64 {
+	d := now.Sub(pr.start).Seconds()
+	if d <= 0 {
+		return 0
+	}
+	return util.ToMB(pr.n) / d
+}
+
+func (pr *progressReader) clock() time.Time {
+	if pr.now == nil {
+		return time.Now()
+	}
+	return pr.now()
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestProgressReader(t *testing.T) {
+	tests := []struct {
+		size int64
+		logs bool
+	}{
+		{size: 1 << 20, logs: false},
+		{size: progressMinBytes / 2, logs: false},
+		{size: 4 * progressMinBytes, logs: true},
+	}
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		l := logrus.New()
+		l.Out = &buf
+
+		src := io.LimitReader(rand.New(rand.NewSource(int64(i))), tt.size)
+		want := sha256.New()
+		pr := newProgressReader(io.TeeReader(src, want), logrus.NewEntry(l))
+		clock := pr.start
+		// each read takes 10 seconds.
+		pr.now = func() time.Time {
+			clock = clock.Add(10 * time.Second)
+			return clock
+		}
+
+		got := sha256.New()
+		n, err := io.CopyBuffer(got, pr, make([]byte, 8<<20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tt.size || pr.n != tt.size {
+			t.Errorf("#%d: expect %d bytes read and counted, get %d and %d", i, tt.size, n, pr.n)
+		}
+		if !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+			t.Errorf("#%d: expect the bytes to pass through unchanged", i)
+		}
+		logged := strings.Count(buf.String(), "saving snapshot")
+		if tt.logs && logged == 0 {
+			t.Errorf("#%d: expect the progress of %d bytes to be logged", i, tt.size)
+		}
+		if !tt.logs && logged != 0 {
+			t.Errorf("#%d: expect no progress log for %d bytes, get %q", i, tt.size, buf.String())
+		}
+	}
+}
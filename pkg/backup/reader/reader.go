@@ -19,5 +19,6 @@ import "io"
 // Reader defines required reader operations
 type Reader interface {
 	// Open opens up a backup file for reading.
+	// os.IsNotExist(err) is true if the file does not exist.
 	Open(path string) (rc io.ReadCloser, err error)
 }
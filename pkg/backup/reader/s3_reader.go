@@ -17,10 +17,12 @@ package reader
 import (
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/coreos/etcd-operator/pkg/backup/util"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
@@ -46,6 +48,9 @@ func (s3r *s3Reader) Open(path string) (io.ReadCloser, error) {
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,197 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+const (
+	// defaultUploadAttempts is the number of attempts to upload a backup if UploadRetryConfig.Attempts is not set.
+	defaultUploadAttempts = 3
+	// defaultUploadBackoff is the wait before the first retry if UploadRetryConfig.Backoff is not set.
+	defaultUploadBackoff = time.Second
+	// maxUploadBackoff caps the wait between two attempts.
+	maxUploadBackoff = time.Minute
+)
+
+// UploadRetryConfig configures retrying the uploads of backups which fail with a transient error.
+// The zero value retries with the defaults.
+type UploadRetryConfig struct {
+	// Attempts is the maximum number of attempts, including the first one.
+	// If equal to 0, defaultUploadAttempts is used.
+	Attempts int
+	// Backoff is the wait before the first retry, which doubles after each retry.
+	// If equal to 0, defaultUploadBackoff is used.
+	Backoff time.Duration
+}
+
+// IsTransientError returns true if the upload which failed with err may succeed when retried:
+// it timed out, the connection was reset, or the storage answered with a server error or throttled it.
+// Errors the storage answered otherwise, e.g. denied access, are not transient.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+	// e.g. awserr.RequestFailure, the failures with a response.
+	if sc, ok := err.(interface {
+		StatusCode() int
+	}); ok {
+		c := sc.StatusCode()
+		return c >= http.StatusInternalServerError || c == http.StatusTooManyRequests || c == http.StatusRequestTimeout
+	}
+	if isConnectionReset(err) {
+		return true
+	}
+	if ne, ok := err.(net.Error); ok {
+		return ne.Timeout() || ne.Temporary()
+	}
+	// e.g. awserr.Error, which wraps the failures without a response.
+	if oe, ok := err.(interface {
+		OrigErr() error
+	}); ok {
+		return IsTransientError(oe.OrigErr())
+	}
+	return false
+}
+
+// isConnectionReset returns true if err is caused by the storage closing the connection.
+func isConnectionReset(err error) bool {
+	for {
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case syscall.Errno:
+			return e == syscall.ECONNRESET || e == syscall.ECONNABORTED || e == syscall.EPIPE
+		default:
+			return false
+		}
+	}
+}
+
+// RetryOnStorageError makes bm retry reading the storage for the latest backup, up to maxAttempts times
+// including the first one, waiting backoff before the first retry and doubling it after each retry.
+// A maxAttempts or backoff not greater than 0 means the default of the uploads, 3 attempts and 1 second.
+// Without it, a failure to read the storage is returned right away.
+func (bm *BackupManager) RetryOnStorageError(maxAttempts int, backoff time.Duration) {
+	bm.storageRetry = &UploadRetryConfig{Attempts: maxAttempts, Backoff: backoff}
+}
+
+// retryUpload calls upload until it succeeds, fails with an error which is not transient,
+// or runs out of attempts. The wait between two attempts doubles after each retry.
+// upload must take a new snapshot on each call, since a snapshot can't be read twice.
+func (bm *BackupManager) retryUpload(ctx context.Context, upload func() error) error {
+	return bm.retry(ctx, bm.uploadRetry, IsTransientError, "failed to upload backup, retrying", upload)
+}
+
+// retrySnapshot calls snapshot until it succeeds, fails with an error which is neither transient nor
+// an *etcdError, or runs out of the attempts of the uploads. The storage and etcd failures share the
+// attempts, so that a backup takes at most that many snapshots, each bounded by the snapshot timeout.
+func (bm *BackupManager) retrySnapshot(ctx context.Context, snapshot func() error) error {
+	retryable := func(err error) bool {
+		_, ok := err.(*etcdError)
+		return ok || IsTransientError(err)
+	}
+	return bm.retry(ctx, bm.uploadRetry, retryable, "failed to take snapshot, retrying", snapshot)
+}
+
+// etcdError is the error of a backup which failed to receive the status or the snapshot of etcd, e.g. because
+// the member restarted, as opposed to failing to save it. The snapshot may be taken from another member.
+type etcdError struct {
+	err error
+}
+
+func (e *etcdError) Error() string {
+	return e.err.Error()
+}
+
+// etcdReader records the error of reading a snapshot from etcd.
+type etcdReader struct {
+	r   io.Reader
+	err error
+}
+
+func (er *etcdReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	if err != nil && err != io.EOF {
+		er.err = err
+	}
+	return n, err
+}
+
+// wrap returns the error of the backup which failed with err while reading from er, as an *etcdError
+// if reading the snapshot failed. A snapshot cancelled or timed out through ctx is not an etcd failure.
+func (er *etcdReader) wrap(ctx context.Context, err error) error {
+	if cerr := ctx.Err(); cerr != nil {
+		return &backupFailure{reason: failureReason(cerr), err: err}
+	}
+	if er.err == nil {
+		return err
+	}
+	return &etcdError{fmt.Errorf("failed to receive snapshot (%v)", er.err)}
+}
+
+// retryStorage calls read until it succeeds or runs out of the attempts set by RetryOnStorageError.
+func (bm *BackupManager) retryStorage(ctx context.Context, read func() error) error {
+	if bm.storageRetry == nil {
+		return read()
+	}
+	retryable := func(error) bool { return true }
+	return bm.retry(ctx, *bm.storageRetry, retryable, "failed to read backup storage, retrying", read)
+}
+
+// retry calls fn until it succeeds, fails with an error which is not retryable, or runs out of
+// the attempts of rc. The wait between two attempts doubles after each retry.
+func (bm *BackupManager) retry(ctx context.Context, rc UploadRetryConfig, retryable func(error) bool, msg string, fn func() error) error {
+	attempts, backoff := rc.Attempts, rc.Backoff
+	if attempts <= 0 {
+		attempts = defaultUploadAttempts
+	}
+	if backoff <= 0 {
+		backoff = defaultUploadBackoff
+	}
+	for i := 1; ; i++ {
+		err := fn()
+		if err == nil || i >= attempts || !retryable(err) {
+			return err
+		}
+		bm.getLogger().WithError(err).WithFields(logrus.Fields{"attempt": i, "backoff": backoff}).Warning(msg)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		if backoff *= 2; backoff > maxUploadBackoff {
+			backoff = maxUploadBackoff
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+
+	"golang.org/x/net/context"
+)
+
+// statusError is an error the storage answered with, like awserr.RequestFailure.
+type statusError int
+
+func (e statusError) Error() string   { return "status error" }
+func (e statusError) StatusCode() int { return int(e) }
+
+// origError wraps a failure without a response, like awserr.Error.
+type origError struct{ err error }
+
+func (e origError) Error() string  { return "request error" }
+func (e origError) OrigErr() error { return e.err }
+
+func TestIsTransientError(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: errors.New("bad snapshot"), want: false},
+		{err: io.ErrUnexpectedEOF, want: true},
+		{err: statusError(500), want: true},
+		{err: statusError(503), want: true},
+		{err: statusError(429), want: true},
+		{err: statusError(403), want: false},
+		{err: statusError(401), want: false},
+		{err: reset, want: true},
+		{err: origError{reset}, want: true},
+		{err: origError{errors.New("invalid credentials")}, want: false},
+	}
+	for i, tt := range tests {
+		if got := IsTransientError(tt.err); got != tt.want {
+			t.Errorf("#%d: IsTransientError(%v) = %v, want %v", i, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryUpload(t *testing.T) {
+	tests := []struct {
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{errs: []error{nil}, wantCalls: 1},
+		{errs: []error{statusError(500), nil}, wantCalls: 2},
+		// an auth error fails immediately.
+		{errs: []error{statusError(403), nil}, wantCalls: 1, wantErr: true},
+		// the attempts run out.
+		{errs: []error{statusError(500), statusError(500), statusError(500), nil}, wantCalls: 3, wantErr: true},
+	}
+	for i, tt := range tests {
+		bm := &BackupManager{uploadRetry: UploadRetryConfig{Backoff: time.Millisecond}}
+		calls := 0
+		err := bm.retryUpload(context.Background(), func() error {
+			calls++
+			return tt.errs[calls-1]
+		})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: expect error %v, got %v", i, tt.wantErr, err)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("#%d: calls = %d, want %d", i, calls, tt.wantCalls)
+		}
+	}
+}
+
+func TestRetrySnapshot(t *testing.T) {
+	etcdErr := &etcdError{errors.New("member restarted")}
+	tests := []struct {
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{errs: []error{etcdErr, nil}, wantCalls: 2},
+		{errs: []error{statusError(500), etcdErr, nil}, wantCalls: 3},
+		// the storage and etcd failures share the attempts.
+		{errs: []error{etcdErr, statusError(500), etcdErr, nil}, wantCalls: 3, wantErr: true},
+		{errs: []error{errors.New("corrupt snapshot"), nil}, wantCalls: 1, wantErr: true},
+	}
+	for i, tt := range tests {
+		bm := &BackupManager{uploadRetry: UploadRetryConfig{Backoff: time.Millisecond}}
+		calls := 0
+		err := bm.retrySnapshot(context.Background(), func() error {
+			calls++
+			return tt.errs[calls-1]
+		})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: expect error %v, got %v", i, tt.wantErr, err)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("#%d: calls = %d, want %d", i, calls, tt.wantCalls)
+		}
+	}
+}
+
+// flakyBackend fails to get the latest backup the given number of times.
+type flakyBackend struct {
+	backend.Backend
+	failures int
+	calls    int
+}
+
+func (b *flakyBackend) GetLatest() (string, error) {
+	b.calls++
+	if b.calls <= b.failures {
+		return "", errors.New("storage unavailable")
+	}
+	return "", nil
+}
+
+func TestRetryOnStorageError(t *testing.T) {
+	tests := []struct {
+		failures    int
+		maxAttempts int // 0 doesn't call RetryOnStorageError.
+		wantCalls   int
+		wantErr     bool
+	}{
+		{failures: 1, wantCalls: 1, wantErr: true},
+		{failures: 2, maxAttempts: 3, wantCalls: 3},
+		{failures: 2, maxAttempts: 2, wantCalls: 2, wantErr: true},
+	}
+	for i, tt := range tests {
+		be := &flakyBackend{failures: tt.failures}
+		bm := &BackupManager{be: be}
+		if tt.maxAttempts > 0 {
+			bm.RetryOnStorageError(tt.maxAttempts, time.Millisecond)
+		}
+		_, err := bm.getLatestBackupRev(context.Background())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: expect error %v, got %v", i, tt.wantErr, err)
+		}
+		if be.calls != tt.wantCalls {
+			t.Errorf("#%d: calls = %d, want %d", i, be.calls, tt.wantCalls)
+		}
+	}
+
+	// SaveSnap reports the failure instead of exiting.
+	bm := &BackupManager{be: &flakyBackend{failures: 1}}
+	if _, err := bm.SaveSnap(context.Background(), LatestBackupRevUnknown); err == nil {
+		t.Error("expect SaveSnap to fail if the latest backup can't be read")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var (
+	// maxCopyObjectSize is the max size of an object S3 copies with a single request.
+	maxCopyObjectSize int64 = 5 * 1024 * 1024 * 1024
+	// copyPartSize is the size of the parts of a multipart copy.
+	// 1GB parts copy objects up to 10TB, twice the max size of an object.
+	copyPartSize int64 = 1024 * 1024 * 1024
+)
+
+// Copy copies the object of the given source bucket and key to the given bucket and key on the server side.
+// Objects larger than 5GB, which S3 can't copy with a single request, are copied in parts of a multipart
+// upload. The metadata of the source object is kept unless opts sets some. The part size and concurrency
+// of opts are not used. It returns an error satisfying os.IsNotExist if the source object doesn't exist.
+func Copy(ctx context.Context, cli *s3.S3, srcBucket, srcKey, bucket, key string, opts UploadOptions) error {
+	head, err := cli.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return toCopyError(err, srcBucket, srcKey)
+	}
+	u := &uploader{client: cli, bucket: bucket, key: key, opts: opts}
+	src := copySource(srcBucket, srcKey)
+	size := aws.Int64Value(head.ContentLength)
+	if size <= maxCopyObjectSize {
+		return toCopyError(u.copyObject(ctx, src), srcBucket, srcKey)
+	}
+	if len(u.opts.Metadata) == 0 {
+		u.opts.Metadata = aws.StringValueMap(head.Metadata)
+	}
+	return toCopyError(u.multipartCopy(ctx, src, size), srcBucket, srcKey)
+}
+
+// copySource returns the copy source of the given bucket and key, "<bucket>/<key>",
+// with each path segment URL-encoded as S3 requires. S3 decodes "+" as a space,
+// so it is encoded too although it is valid in a path.
+func copySource(bucket, key string) string {
+	segs := strings.Split(bucket+"/"+key, "/")
+	for i, seg := range segs {
+		segs[i] = strings.Replace(url.PathEscape(seg), "+", "%2B", -1)
+	}
+	return strings.Join(segs, "/")
+}
+
+// toCopyError returns an error satisfying os.IsNotExist if err reports that the source object doesn't exist.
+func toCopyError(err error, srcBucket, srcKey string) error {
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return &os.PathError{Op: "copy", Path: path.Join(srcBucket, srcKey), Err: os.ErrNotExist}
+	}
+	return err
+}
+
+func (u *uploader) copyObject(ctx context.Context, src string) error {
+	in := &s3.CopyObjectInput{
+		Bucket:     aws.String(u.bucket),
+		Key:        aws.String(u.key),
+		CopySource: aws.String(src),
+	}
+	if len(u.opts.Metadata) != 0 {
+		in.Metadata = aws.StringMap(u.opts.Metadata)
+		in.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+	}
+	u.opts.SSE.ApplyToCopyObject(in)
+	if len(u.opts.StorageClass) != 0 {
+		in.StorageClass = aws.String(u.opts.StorageClass)
+	}
+	_, err := u.client.CopyObjectWithContext(ctx, in)
+	return u.opts.SSE.ToError(err)
+}
+
+// multipartCopy copies the source object of the given size in parts of a multipart upload.
+// The upload is aborted on failure, including the cancellation of ctx.
+func (u *uploader) multipartCopy(ctx context.Context, src string, size int64) error {
+	uploadID, err := u.create(ctx)
+	if err != nil {
+		return err
+	}
+	var parts []*s3.CompletedPart
+	for num, start := int64(1), int64(0); start < size; num, start = num+1, start+copyPartSize {
+		end := start + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		etag, err := u.copyPart(ctx, uploadID, num, src, fmt.Sprintf("bytes=%d-%d", start, end))
+		if err != nil {
+			u.abort(uploadID)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to copy part %d: %v", num, err)
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: etag, PartNumber: aws.Int64(num)})
+	}
+	if err = u.complete(ctx, uploadID, parts); err != nil {
+		u.abort(uploadID)
+		return err
+	}
+	return nil
+}
+
+// copyPart copies the given byte range of the source object as a part and returns its ETag.
+// It retries on transient failures until ctx is cancelled.
+func (u *uploader) copyPart(ctx context.Context, uploadID *string, num int64, src, byteRange string) (*string, error) {
+	var etag *string
+	err := retryPart(ctx, fmt.Sprintf("part %d of %s/%s", num, u.bucket, u.key), func() error {
+		resp, err := u.client.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(u.bucket),
+			Key:             aws.String(u.key),
+			UploadId:        uploadID,
+			PartNumber:      aws.Int64(num),
+			CopySource:      aws.String(src),
+			CopySourceRange: aws.String(byteRange),
+		})
+		if err != nil {
+			return err
+		}
+		etag = resp.CopyPartResult.ETag
+		return nil
+	})
+	return etag, err
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/s3/s3test"
+)
+
+func TestCopySource(t *testing.T) {
+	tests := []struct {
+		bucket, key string
+		w           string
+	}{
+		{"bucket", "v1/default/example/3.1.8_0000000000000001_etcd.backup", "bucket/v1/default/example/3.1.8_0000000000000001_etcd.backup"},
+		{"bucket", "prod-2017-11-03T03:04:05+02:00_etcd.backup", "bucket/prod-2017-11-03T03:04:05%2B02:00_etcd.backup"},
+		{"bucket", "a b/c?d", "bucket/a%20b/c%3Fd"},
+	}
+	for i, tt := range tests {
+		if g := copySource(tt.bucket, tt.key); g != tt.w {
+			t.Errorf("#%d: copy source = %s, want %s", i, g, tt.w)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	defer func(max, part int64) { maxCopyObjectSize, copyPartSize = max, part }(maxCopyObjectSize, copyPartSize)
+	maxCopyObjectSize, copyPartSize = 10, 4
+
+	ts := s3test.NewServer()
+	defer ts.Close()
+	cli := ts.NewClient()
+	md := map[string]string{"etcd_revision": "1"}
+
+	for i, data := range [][]byte{[]byte("small"), []byte("larger than 10 bytes")} {
+		// a timestamp with an offset in the backup name.
+		src := "v1/prod-2017-11-03T03:04:05+02:00_etcd.backup"
+		if _, err := Upload(context.Background(), cli, "bucket", src, bytes.NewReader(data), UploadOptions{Metadata: md}); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if err := Copy(context.Background(), cli, "bucket", src, "dr-bucket", "v1/latest", UploadOptions{}); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if b, _ := ts.Object("dr-bucket/v1/latest"); !bytes.Equal(b, data) {
+			t.Errorf("#%d: copied %q, want %q", i, b, data)
+		}
+		if ts.InProgress() != 0 {
+			t.Errorf("#%d: %d multipart uploads left in progress", i, ts.InProgress())
+		}
+	}
+	// the metadata of a large object is copied from the source.
+	if got := ts.Header("dr-bucket/v1/latest", "X-Amz-Meta-Etcd_revision"); got != "1" {
+		t.Errorf("metadata etcd_revision = %q, want %q", got, "1")
+	}
+
+	if err := Copy(context.Background(), cli, "bucket", "v1/missing", "bucket", "v1/latest", UploadOptions{}); !os.IsNotExist(err) {
+		t.Errorf("expect a missing source to not exist, got %v", err)
+	}
+}
@@ -15,11 +15,15 @@
 package s3
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"os"
 	"path"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
@@ -29,6 +33,12 @@ type S3 struct {
 	bucket string
 	prefix string
 	client *s3.S3
+	sse    SSE
+	// storageClass is the storage class of the objects put. Empty means the bucket default.
+	storageClass string
+	// partSizeInMB and uploadConcurrency configure the multipart uploads of Upload. Zero means the default.
+	partSizeInMB      int64
+	uploadConcurrency int
 }
 
 // New returns a S3 translator from default shared config.
@@ -52,6 +62,11 @@ func NewFromSessionOpt(bucket, prefix string, so session.Options) (*S3, error) {
 	return NewFromClient(bucket, prefix, cli), nil
 }
 
+// NewFromSession returns a new S3 object for the given bucket and prefix using the given AWS session.
+func NewFromSession(bucket, prefix string, sess *session.Session) *S3 {
+	return NewFromClient(bucket, prefix, s3.New(sess))
+}
+
 func NewFromClient(bucket, prefix string, cli *s3.S3) *S3 {
 	return &S3{
 		bucket: bucket,
@@ -60,14 +75,45 @@ func NewFromClient(bucket, prefix string, cli *s3.S3) *S3 {
 	}
 }
 
-func (s *S3) Put(key string, rs io.ReadSeeker) error {
-	_, err := s.client.PutObject(&s3.PutObjectInput{
+// WithBucket returns a copy of s for the given bucket, with the same prefix, client and settings.
+func (s *S3) WithBucket(bucket string) *S3 {
+	cp := *s
+	cp.bucket = bucket
+	return &cp
+}
+
+// SetSSE sets the server-side encryption of the objects put afterwards.
+func (s *S3) SetSSE(sse SSE) {
+	s.sse = sse
+}
+
+// SetStorageClass sets the storage class of the objects put afterwards.
+// The storage class must be validated by ValidateStorageClass.
+func (s *S3) SetStorageClass(sc string) {
+	s.storageClass = sc
+}
+
+// SetUploadOptions sets the size of the parts and the number of parts uploaded in parallel
+// of the objects uploaded afterwards, see UploadOptions. Zero means the default.
+func (s *S3) SetUploadOptions(partSizeInMB int64, concurrency int) {
+	s.partSizeInMB = partSizeInMB
+	s.uploadConcurrency = concurrency
+}
+
+// Put puts the object of the given key. The request is cancelled if ctx is.
+func (s *S3) Put(ctx context.Context, key string, rs io.ReadSeeker) error {
+	in := &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(path.Join(s.prefix, key)),
 		Body:   rs,
-	})
+	}
+	s.sse.ApplyToPutObject(in)
+	if len(s.storageClass) != 0 {
+		in.StorageClass = aws.String(s.storageClass)
+	}
+	_, err := s.client.PutObjectWithContext(ctx, in)
 
-	return err
+	return s.sse.ToError(err)
 }
 
 func (s *S3) Get(key string) (io.ReadCloser, error) {
@@ -75,6 +121,9 @@ func (s *S3) Get(key string) (io.ReadCloser, error) {
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(path.Join(s.prefix, key)),
 	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, &os.PathError{Op: "get", Path: key, Err: os.ErrNotExist}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -82,6 +131,14 @@ func (s *S3) Get(key string) (io.ReadCloser, error) {
 	return resp.Body, nil
 }
 
+// Ping checks that the bucket exists and is accessible with the credentials of the client.
+func (s *S3) Ping(ctx context.Context) error {
+	if _, err := s.client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)}); err != nil {
+		return fmt.Errorf("failed to reach s3 bucket (%s): %v", s.bucket, err)
+	}
+	return nil
+}
+
 func (s *S3) Delete(key string) error {
 	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
@@ -118,6 +175,60 @@ func (s *S3) list(prefix string) (int64, []string, error) {
 	return size, keys, nil
 }
 
+// ObjectInfo describes an object under the prefix.
+type ObjectInfo struct {
+	Size         int64
+	LastModified time.Time
+}
+
+// ListObjectInfos returns the size and the last modified time of every key under the prefix.
+func (s *S3) ListObjectInfos() (map[string]ObjectInfo, error) {
+	resp, err := s.client.ListObjects(&s3.ListObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix + "/"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make(map[string]ObjectInfo, len(resp.Contents))
+	for _, key := range resp.Contents {
+		infos[(*key.Key)[len(*resp.Prefix):]] = ObjectInfo{Size: *key.Size, LastModified: *key.LastModified}
+	}
+	return infos, nil
+}
+
+// SignedURL returns a pre-signed URL to download the given key without credentials, which expires after ttl.
+func (s *S3) SignedURL(key string, ttl time.Duration) (string, error) {
+	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path.Join(s.prefix, key)),
+	})
+	return req.Presign(ttl)
+}
+
+// Path returns the location of the given key, <bucket>/<prefix>/<key>.
+func (s *S3) Path(key string) string {
+	return path.Join(s.bucket, s.prefix, key)
+}
+
+// ListModTimes returns the last modified time of every key under the prefix.
+func (s *S3) ListModTimes() (map[string]time.Time, error) {
+	resp, err := s.client.ListObjects(&s3.ListObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix + "/"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	modTimes := make(map[string]time.Time, len(resp.Contents))
+	for _, key := range resp.Contents {
+		modTimes[(*key.Key)[len(*resp.Prefix):]] = *key.LastModified
+	}
+	return modTimes, nil
+}
+
 func (s *S3) TotalSize() (int64, error) {
 	size, _, err := s.list(s.prefix)
 	return size, err
@@ -128,13 +239,9 @@ func (s *S3) CopyPrefix(from string) error {
 	if err != nil {
 		return err
 	}
+	opts := UploadOptions{SSE: s.sse, StorageClass: s.storageClass}
 	for _, key := range keys {
-		req := &s3.CopyObjectInput{
-			Bucket:     aws.String(s.bucket),
-			Key:        aws.String(path.Join(s.prefix, key)),
-			CopySource: aws.String(path.Join(s.bucket, from, key)),
-		}
-		_, err := s.client.CopyObject(req)
+		err = Copy(context.Background(), s.client, s.bucket, path.Join(from, key), s.bucket, path.Join(s.prefix, key), opts)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,256 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package s3test provides an in-memory S3 server for tests.
+package s3test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// InvalidKMSKeyID is a KMS key that the fake S3 server doesn't know.
+const InvalidKMSKeyID = "alias/invalid"
+
+// Server is a fake S3 server which stores objects in memory keyed by the request path,
+// "/<bucket>/<key>". It only understands path-style requests.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	// headers keeps the request headers of each object put or multipart upload created.
+	headers map[string]http.Header
+	// uploads keeps the parts of each multipart upload in progress by upload ID.
+	uploads map[string]map[int][]byte
+	// failParts maps a part number to the status code to fail its next upload with.
+	failParts map[int]int
+
+	nextUploadID int
+	// puts counts the objects put with a single request.
+	puts int
+	// aborted counts the aborted multipart uploads.
+	aborted int
+}
+
+// NewServer starts a fake S3 server.
+func NewServer() *Server {
+	fs := &Server{
+		objects:   make(map[string][]byte),
+		headers:   make(map[string]http.Header),
+		uploads:   make(map[string]map[int][]byte),
+		failParts: make(map[int]int),
+	}
+	fs.Server = httptest.NewServer(http.HandlerFunc(fs.serveHTTP))
+	return fs
+}
+
+func (fs *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	q := r.URL.Query()
+	if r.Header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id") == InvalidKMSKeyID {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("<Error><Code>KMS.NotFoundException</Code><Message>Invalid keyId</Message></Error>"))
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && q["uploads"] != nil:
+		fs.nextUploadID++
+		id := strconv.Itoa(fs.nextUploadID)
+		fs.uploads[id] = make(map[int][]byte)
+		fs.headers[r.URL.Path] = r.Header
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && len(q.Get("uploadId")) != 0:
+		parts, ok := fs.uploads[q.Get("uploadId")]
+		if !ok {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+		num, _ := strconv.Atoi(q.Get("partNumber"))
+		if code, ok := fs.failParts[num]; ok {
+			delete(fs.failParts, num)
+			w.WriteHeader(code)
+			fmt.Fprintf(w, "<Error><Code>%s</Code></Error>", http.StatusText(code))
+			return
+		}
+		if len(r.Header.Get("X-Amz-Copy-Source")) != 0 {
+			b, ok := fs.copySource(w, r)
+			if !ok {
+				return
+			}
+			var start, end int
+			if _, err := fmt.Sscanf(r.Header.Get("X-Amz-Copy-Source-Range"), "bytes=%d-%d", &start, &end); err != nil || end >= len(b) {
+				http.Error(w, "InvalidRange", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			parts[num] = b[start : end+1]
+			fmt.Fprintf(w, `<CopyPartResult><ETag>"part%d"</ETag></CopyPartResult>`, num)
+			return
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		parts[num] = b
+		w.Header().Set("ETag", fmt.Sprintf(`"part%d"`, num))
+	case r.Method == http.MethodPost && len(q.Get("uploadId")) != 0:
+		parts, ok := fs.uploads[q.Get("uploadId")]
+		if !ok {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+		var b []byte
+		for i := 1; i <= len(parts); i++ {
+			b = append(b, parts[i]...)
+		}
+		fs.objects[r.URL.Path] = b
+		delete(fs.uploads, q.Get("uploadId"))
+		w.Write([]byte(`<CompleteMultipartUploadResult><ETag>"fake"</ETag></CompleteMultipartUploadResult>`))
+	case r.Method == http.MethodDelete && len(q.Get("uploadId")) != 0:
+		delete(fs.uploads, q.Get("uploadId"))
+		fs.aborted++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && len(r.Header.Get("X-Amz-Copy-Source")) != 0:
+		b, ok := fs.copySource(w, r)
+		if !ok {
+			return
+		}
+		fs.objects[r.URL.Path] = b
+		fs.headers[r.URL.Path] = r.Header
+		w.Write([]byte(`<CopyObjectResult><ETag>"fake"</ETag></CopyObjectResult>`))
+	case r.Method == http.MethodPut:
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fs.objects[r.URL.Path] = b
+		fs.headers[r.URL.Path] = r.Header
+		fs.puts++
+		w.Header().Set("ETag", `"fake"`)
+	case r.Method == http.MethodHead:
+		b, ok := fs.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range fs.headers[r.URL.Path] {
+			if strings.HasPrefix(k, "X-Amz-Meta-") {
+				w.Header()[k] = v
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	case r.Method == http.MethodGet:
+		b, ok := fs.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.Write(b)
+	default:
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+// copySource returns the object of the copy source of r. Like S3, it decodes the copy source
+// as a query string, so a "+" that is not URL-encoded is read as a space.
+func (fs *Server) copySource(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	src, err := url.QueryUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	b, ok := fs.objects["/"+strings.TrimPrefix(src, "/")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<Error><Code>NoSuchKey</Code></Error>"))
+		return nil, false
+	}
+	return b, true
+}
+
+// Object returns the object of the given path, "<bucket>/<key>".
+func (fs *Server) Object(p string) ([]byte, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	b, ok := fs.objects["/"+p]
+	return b, ok
+}
+
+// Header returns the header of the request that put the object of the given path, "<bucket>/<key>".
+func (fs *Server) Header(p, key string) string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.headers["/"+p].Get(key)
+}
+
+// HasHeaders returns true if an object of the given path, "<bucket>/<key>", was put or its multipart upload created.
+func (fs *Server) HasHeaders(p string) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_, ok := fs.headers["/"+p]
+	return ok
+}
+
+// FailPart fails the next upload of the part of the given number with the given status code.
+func (fs *Server) FailPart(num, code int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.failParts[num] = code
+}
+
+// Puts returns the number of objects put with a single request.
+func (fs *Server) Puts() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.puts
+}
+
+// Aborted returns the number of aborted multipart uploads.
+func (fs *Server) Aborted() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.aborted
+}
+
+// InProgress returns the number of multipart uploads neither completed nor aborted.
+func (fs *Server) InProgress() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.uploads)
+}
+
+// NewClient returns a client of the fake S3 server.
+func (fs *Server) NewClient() *s3.S3 {
+	return s3.New(session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(fs.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("fake", "fake", ""),
+	})))
+}
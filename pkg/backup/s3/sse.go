@@ -0,0 +1,113 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// SSEKMS is the server-side encryption with AWS KMS managed keys.
+	SSEKMS = s3.ServerSideEncryptionAwsKms
+	// SSEAES256 is the server-side encryption with S3 managed keys.
+	SSEAES256 = s3.ServerSideEncryptionAes256
+)
+
+// SSE configures the server-side encryption of the objects put to S3.
+// S3 decrypts the objects when they are read, so reading needs no configuration.
+type SSE struct {
+	// Algorithm is SSEKMS, SSEAES256, or empty to leave it to the bucket default.
+	Algorithm string
+	// KMSKeyID is the ID, ARN or alias of the KMS key to encrypt with if Algorithm is SSEKMS.
+	// If empty, the AWS managed key of S3 is used.
+	KMSKeyID string
+}
+
+// NewSSE returns the SSE of the given algorithm and KMS key ID.
+// If only the KMS key ID is given, the algorithm is SSEKMS.
+func NewSSE(algorithm, kmsKeyID string) (SSE, error) {
+	if len(algorithm) == 0 && len(kmsKeyID) != 0 {
+		algorithm = SSEKMS
+	}
+	switch algorithm {
+	case "", SSEAES256:
+		if len(kmsKeyID) != 0 {
+			return SSE{}, fmt.Errorf("KMS key (%s) requires the %s server-side encryption", kmsKeyID, SSEKMS)
+		}
+	case SSEKMS:
+	default:
+		return SSE{}, fmt.Errorf("unknown server-side encryption (%s), must be %s or %s", algorithm, SSEKMS, SSEAES256)
+	}
+	return SSE{Algorithm: algorithm, KMSKeyID: kmsKeyID}, nil
+}
+
+// ApplyToPutObject sets the encryption headers of a PutObject request.
+func (sse SSE) ApplyToPutObject(in *s3.PutObjectInput) {
+	if len(sse.Algorithm) != 0 {
+		in.ServerSideEncryption = aws.String(sse.Algorithm)
+	}
+	if len(sse.KMSKeyID) != 0 {
+		in.SSEKMSKeyId = aws.String(sse.KMSKeyID)
+	}
+}
+
+// ApplyToCopyObject sets the encryption headers of a CopyObject request.
+func (sse SSE) ApplyToCopyObject(in *s3.CopyObjectInput) {
+	if len(sse.Algorithm) != 0 {
+		in.ServerSideEncryption = aws.String(sse.Algorithm)
+	}
+	if len(sse.KMSKeyID) != 0 {
+		in.SSEKMSKeyId = aws.String(sse.KMSKeyID)
+	}
+}
+
+// ApplyToCreateMultipartUpload sets the encryption headers of a CreateMultipartUpload request.
+// The parts of the upload need no encryption headers.
+func (sse SSE) ApplyToCreateMultipartUpload(in *s3.CreateMultipartUploadInput) {
+	if len(sse.Algorithm) != 0 {
+		in.ServerSideEncryption = aws.String(sse.Algorithm)
+	}
+	if len(sse.KMSKeyID) != 0 {
+		in.SSEKMSKeyId = aws.String(sse.KMSKeyID)
+	}
+}
+
+// ToError names the KMS key in err if err is caused by an invalid KMS key or a denied access to it.
+func (sse SSE) ToError(err error) error {
+	if err == nil || sse.Algorithm != SSEKMS {
+		return err
+	}
+	for cause := err; cause != nil; {
+		aerr, ok := cause.(awserr.Error)
+		if !ok {
+			break
+		}
+		code := aerr.Code()
+		if strings.HasPrefix(code, "KMS.") || code == "AccessDenied" || code == "InvalidArgument" {
+			key := sse.KMSKeyID
+			if len(key) == 0 {
+				key = "aws/s3"
+			}
+			return fmt.Errorf("failed to encrypt with KMS key (%s): %v", key, err)
+		}
+		cause = aerr.OrigErr()
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"fmt"
+)
+
+// Storage classes that backups can be saved in.
+const (
+	StorageClassStandard           = "STANDARD"
+	StorageClassStandardIA         = "STANDARD_IA"
+	StorageClassOneZoneIA          = "ONEZONE_IA"
+	StorageClassIntelligentTiering = "INTELLIGENT_TIERING"
+)
+
+// ValidateStorageClass checks that backups can be saved in the given S3 storage class.
+// An empty storage class leaves it to the bucket default.
+func ValidateStorageClass(sc string) error {
+	switch sc {
+	case "", StorageClassStandard, StorageClassStandardIA, StorageClassOneZoneIA, StorageClassIntelligentTiering:
+		return nil
+	case "GLACIER", "DEEP_ARCHIVE":
+		// Every backup saved is the latest one until the next is saved, and
+		// objects in archive classes must be restored before they can be read.
+		return fmt.Errorf("storage class (%s) is not supported: the latest backup must be readable synchronously to restore from it; use a lifecycle rule to archive older backups instead", sc)
+	default:
+		return fmt.Errorf("unknown storage class (%s), must be one of %s, %s, %s or %s",
+			sc, StorageClassStandard, StorageClassStandardIA, StorageClassOneZoneIA, StorageClassIntelligentTiering)
+	}
+}
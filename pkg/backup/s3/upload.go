@@ -0,0 +1,357 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultPartSizeInMB is the size of the parts of a multipart upload if not configured.
+	DefaultPartSizeInMB = 64
+	// MinPartSizeInMB is the min size of the parts of a multipart upload except the last one allowed by S3.
+	MinPartSizeInMB = 5
+	// DefaultUploadConcurrency is the number of parts uploaded in parallel by S3.Upload if not configured.
+	DefaultUploadConcurrency = 4
+	// maxUploadParts is the max number of parts of a multipart upload allowed by S3.
+	maxUploadParts = 10000
+	// maxPartRetries is the max number of retries to upload a part on transient failures.
+	maxPartRetries = 3
+)
+
+// partRetryInterval is the interval before the first retry to upload a part. It grows linearly.
+var partRetryInterval = 500 * time.Millisecond
+
+// UploadOptions configures how Upload saves an object.
+type UploadOptions struct {
+	SSE SSE
+	// StorageClass is the storage class of the object. Empty means the bucket default.
+	// It must be validated by ValidateStorageClass.
+	StorageClass string
+	// Metadata is the metadata saved with the object.
+	Metadata map[string]string
+	// PartSizeInMB is the size of the parts of a multipart upload. Objects that fit in one part
+	// are put with a single request. Zero means DefaultPartSizeInMB.
+	// It must be at least MinPartSizeInMB.
+	PartSizeInMB int64
+	// Concurrency is the number of parts uploaded in parallel. Up to Concurrency+1 parts
+	// are held in memory. Zero means 1.
+	Concurrency int
+}
+
+// Upload uploads the object of the given bucket and key from r and returns the number of bytes read.
+// Objects larger than a part are streamed in parts of a multipart upload. Each part is retried on
+// transient failures. The multipart upload is aborted on failure, including the cancellation of ctx,
+// so that the uploaded parts are not left behind.
+func Upload(ctx context.Context, cli *s3.S3, bucket, key string, r io.Reader, opts UploadOptions) (int64, error) {
+	partSize := opts.PartSizeInMB
+	if partSize == 0 {
+		partSize = DefaultPartSizeInMB
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	u := &uploader{client: cli, bucket: bucket, key: key, opts: opts}
+
+	buf := make([]byte, partSize*1024*1024)
+	n, last, err := readPart(r, buf)
+	if err != nil {
+		return 0, err
+	}
+	if last {
+		// a multipart upload costs two more requests.
+		return int64(n), u.put(ctx, buf[:n])
+	}
+	return u.multipartUpload(ctx, buf, r)
+}
+
+// Upload uploads the object of the given key from r like Upload, with the part size and
+// the concurrency set by SetUploadOptions. Up to DefaultUploadConcurrency parts of
+// DefaultPartSizeInMB are uploaded in parallel if not set.
+func (s *S3) Upload(ctx context.Context, key string, r io.Reader) (int64, error) {
+	concurrency := s.uploadConcurrency
+	if concurrency == 0 {
+		concurrency = DefaultUploadConcurrency
+	}
+	return Upload(ctx, s.client, s.bucket, path.Join(s.prefix, key), r, UploadOptions{
+		SSE:          s.sse,
+		StorageClass: s.storageClass,
+		PartSizeInMB: s.partSizeInMB,
+		Concurrency:  concurrency,
+	})
+}
+
+type uploader struct {
+	client *s3.S3
+	bucket string
+	key    string
+	opts   UploadOptions
+}
+
+// readPart fills buf from r. last is true if r has no more data after the n bytes read.
+func readPart(r io.Reader, buf []byte) (n int, last bool, err error) {
+	n, err = io.ReadFull(r, buf)
+	switch err {
+	case nil:
+		return n, false, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		return n, true, nil
+	default:
+		return n, false, err
+	}
+}
+
+func (u *uploader) put(ctx context.Context, data []byte) error {
+	in := &s3.PutObjectInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(u.key),
+		Body:   bytes.NewReader(data),
+	}
+	if len(u.opts.Metadata) != 0 {
+		in.Metadata = aws.StringMap(u.opts.Metadata)
+	}
+	u.opts.SSE.ApplyToPutObject(in)
+	if len(u.opts.StorageClass) != 0 {
+		in.StorageClass = aws.String(u.opts.StorageClass)
+	}
+	_, err := u.client.PutObjectWithContext(ctx, in)
+	return u.opts.SSE.ToError(err)
+}
+
+// multipartUpload uploads the first part in buf and the rest of r as a multipart upload.
+func (u *uploader) multipartUpload(ctx context.Context, buf []byte, r io.Reader) (int64, error) {
+	uploadID, err := u.create(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := u.uploadParts(ctx, uploadID, buf, r)
+	if err != nil {
+		u.abort(uploadID)
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, err
+	}
+	return n, nil
+}
+
+// create creates a multipart upload and returns its ID.
+func (u *uploader) create(ctx context.Context) (*string, error) {
+	in := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(u.key),
+	}
+	if len(u.opts.Metadata) != 0 {
+		in.Metadata = aws.StringMap(u.opts.Metadata)
+	}
+	u.opts.SSE.ApplyToCreateMultipartUpload(in)
+	if len(u.opts.StorageClass) != 0 {
+		in.StorageClass = aws.String(u.opts.StorageClass)
+	}
+	resp, err := u.client.CreateMultipartUploadWithContext(ctx, in)
+	if err != nil {
+		return nil, u.opts.SSE.ToError(err)
+	}
+	return resp.UploadId, nil
+}
+
+// complete completes the multipart upload with the given parts.
+func (u *uploader) complete(ctx context.Context, uploadID *string, parts []*s3.CompletedPart) error {
+	sort.Slice(parts, func(i, j int) bool { return *parts[i].PartNumber < *parts[j].PartNumber })
+	_, err := u.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.bucket),
+		Key:             aws.String(u.key),
+		UploadId:        uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+	return nil
+}
+
+// abort aborts the multipart upload so that its parts are not left behind.
+func (u *uploader) abort(uploadID *string) {
+	// ctx may be cancelled already, the abort must still be sent.
+	_, err := u.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(u.bucket),
+		Key:      aws.String(u.key),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		logrus.Warningf("failed to abort multipart upload (%s) of %s/%s: %v", *uploadID, u.bucket, u.key, err)
+	}
+}
+
+// uploadPart is a part of a multipart upload to be uploaded by a worker.
+type uploadPart struct {
+	num  int64
+	data []byte
+}
+
+// uploadParts reads the parts from r and hands them to the upload workers. The reading stops as soon as a part fails.
+func (u *uploader) uploadParts(ctx context.Context, uploadID *string, buf []byte, r io.Reader) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		parts []*s3.CompletedPart
+		uerr  error
+	)
+	todo := make(chan uploadPart)
+	// free keeps the buffers of the uploaded parts to be read into again.
+	free := make(chan []byte, u.opts.Concurrency+1)
+	for i := 0; i < u.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range todo {
+				etag, err := u.uploadPart(ctx, uploadID, p)
+				mu.Lock()
+				if err == nil {
+					parts = append(parts, &s3.CompletedPart{ETag: etag, PartNumber: aws.Int64(p.num)})
+				} else if uerr == nil {
+					uerr = fmt.Errorf("failed to upload part %d: %v", p.num, err)
+					cancel()
+				}
+				mu.Unlock()
+				free <- p.data[:cap(p.data)]
+			}
+		}()
+	}
+
+	total, rerr := u.sendParts(ctx, todo, free, buf, r)
+	close(todo)
+	wg.Wait()
+	if uerr != nil {
+		return 0, uerr
+	}
+	if rerr != nil {
+		return 0, rerr
+	}
+
+	if err := u.complete(ctx, uploadID, parts); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// sendParts sends the first part in buf and the rest of r to todo. It reads into the buffers
+// given back on free, and allocates new ones until Concurrency+1 buffers are in use.
+func (u *uploader) sendParts(ctx context.Context, todo chan<- uploadPart, free chan []byte, buf []byte, r io.Reader) (int64, error) {
+	var (
+		total     int64
+		allocated = 1
+		part      = buf
+	)
+	// readPart returns no data once r is drained.
+	for num := int64(1); len(part) != 0; num++ {
+		if num > maxUploadParts {
+			return 0, fmt.Errorf("object is larger than %d parts of %d bytes, increase the part size", maxUploadParts, len(buf))
+		}
+		select {
+		case todo <- uploadPart{num: num, data: part}:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		total += int64(len(part))
+
+		var next []byte
+		if len(free) == 0 && allocated <= u.opts.Concurrency {
+			allocated++
+			next = make([]byte, len(buf))
+		} else {
+			select {
+			case next = <-free:
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+		n, _, err := readPart(r, next)
+		if err != nil {
+			return 0, err
+		}
+		part = next[:n]
+	}
+	return total, nil
+}
+
+// uploadPart uploads a part and returns its ETag. It retries on transient failures until ctx is cancelled.
+func (u *uploader) uploadPart(ctx context.Context, uploadID *string, p uploadPart) (*string, error) {
+	var etag *string
+	err := retryPart(ctx, fmt.Sprintf("part %d of %s/%s", p.num, u.bucket, u.key), func() error {
+		resp, err := u.client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(u.bucket),
+			Key:        aws.String(u.key),
+			UploadId:   uploadID,
+			PartNumber: aws.Int64(p.num),
+			Body:       bytes.NewReader(p.data),
+		})
+		if err != nil {
+			return err
+		}
+		etag = resp.ETag
+		return nil
+	})
+	return etag, err
+}
+
+// retryPart calls fn to upload or copy the given part until it succeeds, fails with
+// an error that is not transient, maxPartRetries retries are done or ctx is cancelled.
+func retryPart(ctx context.Context, part string, fn func() error) error {
+	var err error
+	for i := 0; i <= maxPartRetries; i++ {
+		if i > 0 {
+			logrus.Warningf("retrying %s: %v", part, err)
+			select {
+			case <-time.After(time.Duration(i) * partRetryInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err = fn(); err == nil || !isTransientError(err) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// isTransientError returns true if the request may succeed when retried,
+// i.e. it failed without a response, with a server error or by throttling.
+func isTransientError(err error) bool {
+	rf, ok := err.(awserr.RequestFailure)
+	if !ok {
+		return true
+	}
+	return rf.StatusCode() >= http.StatusInternalServerError || rf.StatusCode() == http.StatusTooManyRequests
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/s3/s3test"
+)
+
+const mb = 1024 * 1024
+
+func TestUpload(t *testing.T) {
+	tests := []struct {
+		size int
+		// wputs is the number of objects put with a single request.
+		wputs int
+	}{
+		{size: 0, wputs: 1},
+		{size: MinPartSizeInMB*mb - 1, wputs: 1},
+		// exactly one part, r is not known to be drained until the next part is read.
+		{size: MinPartSizeInMB * mb},
+		{size: MinPartSizeInMB*mb + 1},
+		// more parts than workers.
+		{size: 3*MinPartSizeInMB*mb + 1},
+	}
+	for i, tt := range tests {
+		ts := s3test.NewServer()
+		data := make([]byte, tt.size)
+		rand.Read(data)
+
+		s := NewFromClient("bucket", "prefix", ts.NewClient())
+		s.SetUploadOptions(MinPartSizeInMB, 2)
+		n, err := s.Upload(context.Background(), "backup", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if n != int64(tt.size) {
+			t.Errorf("#%d: size = %d, want %d", i, n, tt.size)
+		}
+		if b, _ := ts.Object("bucket/prefix/backup"); !bytes.Equal(b, data) {
+			t.Errorf("#%d: uploaded object differs from the data", i)
+		}
+		if ts.Puts() != tt.wputs {
+			t.Errorf("#%d: puts = %d, want %d", i, ts.Puts(), tt.wputs)
+		}
+		if ts.InProgress() != 0 {
+			t.Errorf("#%d: %d multipart uploads left in progress", i, ts.InProgress())
+		}
+		ts.Close()
+	}
+}
+
+func TestUploadPartFailure(t *testing.T) {
+	defer func(d time.Duration) { partRetryInterval = d }(partRetryInterval)
+	partRetryInterval = time.Millisecond
+
+	tests := []struct {
+		code int
+		wok  bool
+	}{
+		// transient failures are retried.
+		{code: http.StatusServiceUnavailable, wok: true},
+		{code: http.StatusForbidden, wok: false},
+	}
+	for i, tt := range tests {
+		ts := s3test.NewServer()
+		ts.FailPart(3, tt.code)
+		data := make([]byte, 4*MinPartSizeInMB*mb)
+		rand.Read(data)
+
+		_, err := Upload(context.Background(), ts.NewClient(), "bucket", "backup", bytes.NewReader(data),
+			UploadOptions{PartSizeInMB: MinPartSizeInMB, Concurrency: 2})
+		if (err == nil) != tt.wok {
+			t.Fatalf("#%d: upload error = %v, want ok %v", i, err, tt.wok)
+		}
+		b, ok := ts.Object("bucket/backup")
+		if tt.wok && !bytes.Equal(b, data) {
+			t.Errorf("#%d: uploaded object differs from the data", i)
+		}
+		if !tt.wok {
+			if ok {
+				t.Errorf("#%d: expected no object after a failed upload", i)
+			}
+			if ts.Aborted() != 1 || ts.InProgress() != 0 {
+				t.Errorf("#%d: aborted = %d, in progress = %d, want the upload aborted", i, ts.Aborted(), ts.InProgress())
+			}
+		}
+		ts.Close()
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server serves the latest valid backup of an etcd cluster to its members,
+// e.g. when they bootstrap from a backup.
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SnapshotPath is the path the latest backup is served at.
+const SnapshotPath = backupapi.APIV1 + "/snapshot"
+
+// defaultMaxSpoolSize bounds the size of a backup spooled to a temporary file. It is the max
+// suggested etcd backend quota, 8GB. Larger backups are skipped rather than filling up the disk.
+const defaultMaxSpoolSize = 8 * 1024 * 1024 * 1024
+
+var errNoValidBackup = errors.New("no valid backup")
+
+// Handler serves the latest backup that matches the checksum saved with it.
+// It supports range requests so that a client can resume an interrupted download.
+// The ETag of the response is the backup name; clients resuming a download should send
+// it in If-Range so that they get the whole new backup if a newer one was saved meanwhile.
+type Handler struct {
+	be backend.Backend
+	// tmpDir is where backups that cannot be seeked are spooled to.
+	tmpDir string
+	// maxSpoolSize is the max size of a backup spooled to tmpDir.
+	maxSpoolSize int64
+}
+
+// NewHandler creates a Handler serving the backups of be.
+func NewHandler(be backend.Backend) *Handler {
+	return &Handler{be: be, tmpDir: os.TempDir(), maxSpoolSize: defaultMaxSpoolSize}
+}
+
+// ListenAndServe serves the latest backup of be at SnapshotPath on addr.
+// If getTLS returns a TLS config, the server uses TLS and only accepts clients with a certificate
+// signed by the CA in it, i.e. the same credentials as the communication with the etcd cluster.
+// The config is got at each handshake, so that rotated credentials are used without a restart.
+func ListenAndServe(addr string, be backend.Backend, getTLS func() *tls.Config) error {
+	mux := http.NewServeMux()
+	mux.Handle(SnapshotPath, NewHandler(be))
+	srv := &http.Server{Addr: addr, Handler: mux}
+	if getTLS == nil || getTLS() == nil {
+		logrus.Warningf("serving snapshots on %s without TLS", addr)
+		return srv.ListenAndServe()
+	}
+	srv.TLSConfig = etcdutil.ReloadingServerTLSConfig(getTLS)
+	logrus.Infof("serving snapshots on %s", addr)
+	return srv.ListenAndServeTLS("", "")
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, rev, f, err := h.openLatestValid()
+	if err == errNoValidBackup {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logrus.Errorf("fail to serve snapshot: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set(backup.HTTPHeaderEtcdVersion, strings.SplitN(name, "_", 2)[0])
+	w.Header().Set(backup.HTTPHeaderRevision, strconv.FormatInt(rev, 10))
+	w.Header().Set("ETag", strconv.Quote(name))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	// ServeContent handles HEAD, Range and If-Range.
+	http.ServeContent(w, r, name, time.Time{}, f)
+}
+
+// openLatestValid opens the latest backup that matches its checksum and returns its name and revision.
+func (h *Handler) openLatestValid() (string, int64, readSeekCloser, error) {
+	backups, err := h.be.List()
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("failed to list backups: %v", err)
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		f, err := h.openVerified(b.Name)
+		if err == nil {
+			return b.Name, b.Revision, f, nil
+		}
+		logrus.Warningf("skip serving backup (%s): %v", b.Name, err)
+	}
+	return "", 0, nil, errNoValidBackup
+}
+
+type readSeekCloser interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// openVerified opens the backup and checks it against its checksum. Backups that cannot be
+// seeked are spooled to a temporary file, which is removed on close.
+func (h *Handler) openVerified(name string) (readSeekCloser, error) {
+	want, err := h.readChecksum(name)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := h.be.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	// members restore from the snapshot as is. A decompressed backup is spooled below.
+	dr, err := compression.NewDecompressReader(name, rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	rc = dr
+
+	var f readSeekCloser
+	hash := sha256.New()
+	if rs, ok := rc.(readSeekCloser); ok {
+		f = rs
+		if _, err = io.Copy(hash, f); err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+	} else {
+		f, err = spool(h.tmpDir, io.TeeReader(rc, hash), h.maxSpoolSize)
+		rc.Close()
+	}
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, fmt.Errorf("failed to read backup: %v", err)
+	}
+
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		f.Close()
+		return nil, fmt.Errorf("checksum mismatch: saved %s, computed %s", want, got)
+	}
+	return f, nil
+}
+
+func (h *Handler) readChecksum(name string) (string, error) {
+	rc, err := h.be.Open(util.MakeChecksumName(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to open checksum: %v", err)
+	}
+	defer rc.Close()
+	sum, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum: %v", err)
+	}
+	return strings.TrimSpace(string(sum)), nil
+}
+
+// tempFile is a temporary file that is removed on close.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// spool copies r to a temporary file in dir, which is removed on close.
+// It fails without leaving the file behind if r is larger than max bytes.
+func spool(dir string, r io.Reader, max int64) (readSeekCloser, error) {
+	tmp, err := ioutil.TempFile(dir, "etcd-snapshot")
+	if err != nil {
+		return nil, err
+	}
+	f := &tempFile{tmp}
+	n, err := io.Copy(f, io.LimitReader(r, max+1))
+	if err == nil && n > max {
+		err = fmt.Errorf("backup is larger than %d bytes", max)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
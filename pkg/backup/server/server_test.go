@@ -0,0 +1,227 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+const testEtcdVersion = "3.1.8"
+
+func saveBackup(t *testing.T, be backend.Backend, rev int64, data, sum string) {
+	if _, err := be.Save(context.Background(), testEtcdVersion, rev, strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if len(sum) == 0 {
+		h := sha256.Sum256([]byte(data))
+		sum = hex.EncodeToString(h[:])
+	}
+	if err := be.SaveChecksum(context.Background(), testEtcdVersion, rev, sum); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestBackend(t *testing.T) (backend.Backend, func()) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Mkdir(filepath.Join(dir, util.BackupTmpDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return backend.NewFileBackend(dir), func() { os.RemoveAll(dir) }
+}
+
+func TestHandlerServesLatestValid(t *testing.T) {
+	be, cleanup := newTestBackend(t)
+	defer cleanup()
+	srv := httptest.NewServer(NewHandler(be))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status without backups = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	saveBackup(t, be, 1, "backup at revision 1", "")
+	saveBackup(t, be, 2, "backup at revision 2", "")
+	// the latest backup doesn't match its checksum.
+	saveBackup(t, be, 3, "backup at revision 3", "bad")
+
+	resp, err = http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "backup at revision 2" {
+		t.Errorf("served %q, want the backup at revision 2", b)
+	}
+	if rev := resp.Header.Get("X-Revision"); rev != "2" {
+		t.Errorf("revision header = %s, want 2", rev)
+	}
+	if etag := resp.Header.Get("ETag"); etag != strconv.Quote(util.MakeBackupName(testEtcdVersion, 2)) {
+		t.Errorf("unexpected ETag %s", etag)
+	}
+}
+
+func TestHandlerRange(t *testing.T) {
+	be, cleanup := newTestBackend(t)
+	defer cleanup()
+	data := "0123456789"
+	saveBackup(t, be, 1, data, "")
+	srv := httptest.NewServer(NewHandler(be))
+	defer srv.Close()
+
+	etag := strconv.Quote(util.MakeBackupName(testEtcdVersion, 1))
+	tests := []struct {
+		ifRange string
+		code    int
+		want    string
+	}{
+		{"", http.StatusPartialContent, data[4:]},
+		{etag, http.StatusPartialContent, data[4:]},
+		// the backup changed since the download started.
+		{strconv.Quote("other"), http.StatusOK, data},
+	}
+	for i, tt := range tests {
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", "bytes=4-")
+		if len(tt.ifRange) != 0 {
+			req.Header.Set("If-Range", tt.ifRange)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.code || string(b) != tt.want {
+			t.Errorf("#%d: got (%d, %q), want (%d, %q)", i, resp.StatusCode, b, tt.code, tt.want)
+		}
+	}
+}
+
+func checkEmptyDir(t *testing.T, dir string) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 0 {
+		t.Errorf("expect %s to be empty, got %d files", dir, len(fis))
+	}
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := []byte("etcd snapshot")
+
+	f, err := spool(dir, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("spooled %q, want %q", b, data)
+	}
+	f.Close()
+	checkEmptyDir(t, dir)
+
+	if _, err = spool(dir, bytes.NewReader(data), int64(len(data))-1); err == nil {
+		t.Error("expect spooling a backup larger than the limit to fail")
+	}
+	checkEmptyDir(t, dir)
+}
+
+func TestHandlerSkipsBackupLargerThanSpoolLimit(t *testing.T) {
+	be, cleanup := newTestBackend(t)
+	defer cleanup()
+	saveBackup(t, be, 1, "small", "")
+
+	// a compressed backup is spooled to be served decompressed.
+	data := strings.Repeat("large", 100)
+	var buf bytes.Buffer
+	cr := compression.NewCompressReader(strings.NewReader(data), compression.Gzip, compression.DefaultLevel)
+	if _, err := buf.ReadFrom(cr); err != nil {
+		t.Fatal(err)
+	}
+	name := compression.MakeName(util.MakeBackupName(testEtcdVersion, 2), compression.Gzip)
+	if _, err := be.SaveAs(context.Background(), name, &buf); err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256([]byte(data))
+	if _, err := be.SaveAs(context.Background(), util.MakeChecksumName(name), strings.NewReader(hex.EncodeToString(h[:]))); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	handler := NewHandler(be)
+	handler.tmpDir, handler.maxSpoolSize = dir, int64(len(data))-1
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(b) != "small" {
+		t.Errorf("got (%d, %q), want the backup at revision 1", resp.StatusCode, b)
+	}
+	checkEmptyDir(t, dir)
+}
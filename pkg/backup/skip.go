@@ -0,0 +1,70 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"fmt"
+	"time"
+)
+
+// BackupSkipPolicy configures skipping the backups of a cluster whose revision moves without meaningful changes.
+// A backup is saved only if the revision moved past the latest backup and every configured threshold is met.
+// The zero value only skips the backups of a cluster that has not changed.
+type BackupSkipPolicy struct {
+	// MinInterval is the minimum time since the latest backup. If equal to 0, it is not checked.
+	MinInterval time.Duration
+	// MinRevisionDelta is the minimum number of revisions since the latest backup. If equal to 0, it is not checked.
+	MinRevisionDelta int64
+}
+
+// skipReason returns why the snapshot at rev is not saved, or an empty string if it is saved,
+// given the revision of the latest backup.
+func (bm *BackupManager) skipReason(lastSnapRev, rev int64) string {
+	if rev <= lastSnapRev {
+		return "no change since the latest backup"
+	}
+	// the first backup is never skipped.
+	if lastSnapRev <= 0 {
+		return ""
+	}
+	if d := bm.skip.MinRevisionDelta; d > 0 && rev-lastSnapRev < d {
+		return fmt.Sprintf("%d revisions since the latest backup, fewer than %d", rev-lastSnapRev, d)
+	}
+	if i := bm.skip.MinInterval; i > 0 {
+		last := bm.latestBackupTime()
+		if since := time.Since(last); !last.IsZero() && since < i {
+			return fmt.Sprintf("%v since the latest backup, less than %v", since-since%time.Second, i)
+		}
+	}
+	return ""
+}
+
+// latestBackupTime returns when the latest backup was saved, or the zero time if it is not known.
+// After a restart, it is read from the backend.
+func (bm *BackupManager) latestBackupTime() time.Time {
+	if !bm.lastBackupTime.IsZero() {
+		return bm.lastBackupTime
+	}
+	backups, err := bm.be.List()
+	if err != nil {
+		// not knowing when the latest backup was saved only costs an unneeded backup.
+		bm.getLogger().WithError(err).Warning("failed to get the latest backup")
+		return time.Time{}
+	}
+	if len(backups) != 0 {
+		bm.lastBackupTime = backups[len(backups)-1].CreationTime
+	}
+	return bm.lastBackupTime
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+
+	"golang.org/x/net/context"
+)
+
+func TestSkipReason(t *testing.T) {
+	tests := []struct {
+		skip        BackupSkipPolicy
+		lastBackup  time.Duration
+		lastSnapRev int64
+		rev         int64
+		wantSkip    bool
+	}{
+		{lastSnapRev: 10, rev: 10, wantSkip: true},
+		{lastSnapRev: 10, rev: 11},
+		{skip: BackupSkipPolicy{MinRevisionDelta: 5}, lastSnapRev: 10, rev: 14, wantSkip: true},
+		{skip: BackupSkipPolicy{MinRevisionDelta: 5}, lastSnapRev: 10, rev: 15},
+		// the first backup is never skipped.
+		{skip: BackupSkipPolicy{MinRevisionDelta: 5}, lastSnapRev: 0, rev: 1},
+		{skip: BackupSkipPolicy{MinInterval: time.Hour}, lastBackup: time.Minute, lastSnapRev: 10, rev: 11, wantSkip: true},
+		{skip: BackupSkipPolicy{MinInterval: time.Hour}, lastBackup: 2 * time.Hour, lastSnapRev: 10, rev: 11},
+		// both thresholds must be met.
+		{skip: BackupSkipPolicy{MinInterval: time.Hour, MinRevisionDelta: 5}, lastBackup: 2 * time.Hour, lastSnapRev: 10, rev: 11, wantSkip: true},
+		{skip: BackupSkipPolicy{MinInterval: time.Hour, MinRevisionDelta: 5}, lastBackup: time.Minute, lastSnapRev: 10, rev: 20, wantSkip: true},
+		{skip: BackupSkipPolicy{MinInterval: time.Hour, MinRevisionDelta: 5}, lastBackup: 2 * time.Hour, lastSnapRev: 10, rev: 20},
+	}
+	for i, tt := range tests {
+		bm := &BackupManager{skip: tt.skip, lastBackupTime: time.Now().Add(-tt.lastBackup)}
+		if reason := bm.skipReason(tt.lastSnapRev, tt.rev); (len(reason) != 0) != tt.wantSkip {
+			t.Errorf("#%d: skip reason = %q, want skip %v", i, reason, tt.wantSkip)
+		}
+	}
+}
+
+// TestSkipReasonAfterRestart ensures the time of the latest backup is read from the backend
+// if no backup was saved since the start.
+func TestSkipReasonAfterRestart(t *testing.T) {
+	d, err := ioutil.TempDir("", "backup-skip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	be := backend.NewFileBackend(d)
+	bm := &BackupManager{be: be, skip: BackupSkipPolicy{MinInterval: time.Hour}}
+
+	// there is no backup yet.
+	if reason := bm.skipReason(10, 11); len(reason) != 0 {
+		t.Errorf("skip reason without backups = %q, want none", reason)
+	}
+	if _, err = be.Save(context.Background(), "3.1.0", 10, strings.NewReader("snapshot")); err != nil {
+		t.Fatal(err)
+	}
+	if reason := bm.skipReason(10, 11); len(reason) == 0 {
+		t.Error("expect a backup right after the latest backup to be skipped")
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"time"
+)
+
+// SnapshotTimeoutPolicy scales the timeout of receiving and saving a snapshot with the size of the
+// database of etcd, so that a large database on a congested network is given the time to be backed up.
+type SnapshotTimeoutPolicy struct {
+	// MinThroughput is the lowest throughput, in bytes per second, the snapshot is expected to be
+	// received and saved at. The timeout is the base timeout plus the time to transfer the database at
+	// MinThroughput. If equal to 0, the timeout is not scaled.
+	MinThroughput int64
+	// MinTimeout is the floor of the timeout.
+	MinTimeout time.Duration
+	// MaxTimeout is the ceiling of the timeout. If equal to 0, the timeout has no ceiling.
+	MaxTimeout time.Duration
+}
+
+// timeout returns the timeout of backing up a database of dbSize bytes, given the base timeout.
+func (p *SnapshotTimeoutPolicy) timeout(base time.Duration, dbSize int64) time.Duration {
+	t := base
+	if p.MinThroughput > 0 && dbSize > 0 {
+		// dbSize*time.Second would overflow for databases beyond about 9GB.
+		t += time.Duration(dbSize/p.MinThroughput)*time.Second +
+			time.Duration(dbSize%p.MinThroughput)*time.Second/time.Duration(p.MinThroughput)
+	}
+	if t < p.MinTimeout {
+		t = p.MinTimeout
+	}
+	if p.MaxTimeout > 0 && t > p.MaxTimeout {
+		t = p.MaxTimeout
+	}
+	return t
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotTimeoutPolicyTimeout(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		p      SnapshotTimeoutPolicy
+		dbSize int64
+		want   time.Duration
+	}{
+		// not scaled
+		{p: SnapshotTimeoutPolicy{}, dbSize: 7 * 1024 * mb, want: time.Minute},
+		{p: SnapshotTimeoutPolicy{MinThroughput: mb}, dbSize: 0, want: time.Minute},
+		// 7GB at 1MB/s
+		{p: SnapshotTimeoutPolicy{MinThroughput: mb}, dbSize: 7 * 1024 * mb, want: time.Minute + 7168*time.Second},
+		{p: SnapshotTimeoutPolicy{MinThroughput: 2 * mb}, dbSize: 3 * mb, want: time.Minute + 1500*time.Millisecond},
+		// floor
+		{p: SnapshotTimeoutPolicy{MinThroughput: mb, MinTimeout: 5 * time.Minute}, dbSize: 10 * mb, want: 5 * time.Minute},
+		// ceiling
+		{p: SnapshotTimeoutPolicy{MinThroughput: mb, MaxTimeout: time.Hour}, dbSize: 7 * 1024 * mb, want: time.Hour},
+	}
+	for i, tt := range tests {
+		if got := tt.p.timeout(time.Minute, tt.dbSize); got != tt.want {
+			t.Errorf("#%d: expect timeout %v, got %v", i, tt.want, got)
+		}
+	}
+}
@@ -18,4 +18,24 @@ const (
 	BackupTmpDir         = "tmp"
 	BackupFilePerm       = 0600
 	BackupFilenameSuffix = "etcd.backup"
+	DeltaFilenameSuffix  = "etcd.delta"
+	// LatestBackupName is the name of the copy of the latest backup saved under a prefix.
+	// It is not a backup of its own, e.g. it is not listed or purged.
+	LatestBackupName = "latest_" + BackupFilenameSuffix
+	// ChecksumFileExtension is appended to a backup name to name the file
+	// holding the SHA-256 checksum of the backup.
+	ChecksumFileExtension = ".sha256"
+	// ManifestFileExtension is appended to a backup name to name the JSON manifest
+	// holding the metadata of the backup, if it can't be saved with the backup.
+	ManifestFileExtension = ".json"
+	// ClusterMetadataFileExtension is appended to a backup name to name the JSON document describing
+	// the cluster the backup is taken from. See backupapi.ClusterMetadata.
+	ClusterMetadataFileExtension = ".meta.json"
+	// EncryptedFileMarker separates the name of an encrypted backup or delta
+	// from the encoded ID of the key it is encrypted with.
+	EncryptedFileMarker = ".enc."
+	// GzipFileExtension is appended to the name of a gzip compressed backup.
+	GzipFileExtension = ".gz"
+	// ZstdFileExtension is appended to the name of a zstd compressed backup.
+	ZstdFileExtension = ".zst"
 )
@@ -0,0 +1,90 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// BackupNameTimestampFormat is the format of the .Timestamp of a backup name template.
+const BackupNameTimestampFormat = "20060102T150405Z"
+
+// BackupNameData holds the variables of a backup name template.
+type BackupNameData struct {
+	// Version is the etcd version of the backup, e.g. 3.1.8.
+	Version string
+	// Revision is the revision of the backup as 16 hex digits, like in the default backup name.
+	Revision string
+	// Timestamp is when the backup is taken, in UTC, formatted with BackupNameTimestampFormat.
+	Timestamp string
+	// RFC3339Timestamp is when the backup is taken, in UTC, formatted with time.RFC3339, e.g. 2017-11-02T03:04:05Z.
+	RFC3339Timestamp string
+	// ClusterName is the name of the backed up etcd cluster.
+	ClusterName string
+	// ClusterUID is the UID of the EtcdCluster of the backed up etcd cluster, or empty if it is not known.
+	// It tells apart the backups of a cluster recreated under the same name, whose revisions start over.
+	ClusterUID string
+}
+
+// ParseBackupNameTemplate parses a Go template of backup names, e.g.
+// "{{.Version}}_{{.Revision}}_{{.ClusterName}}-{{.Timestamp}}_etcd.backup".
+// The variables of the template are the fields of BackupNameData.
+// The backups are listed, sorted and matched to etcd versions by their names, so the names must start
+// like the default names, with "{{.Version}}_{{.Revision}}_", and end with BackupFilenameSuffix.
+// The template is checked by rendering the name of a sample backup.
+func ParseBackupNameTemplate(text string) (*template.Template, error) {
+	t, err := template.New("backup-name").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = MakeBackupNameFromTemplate(t, "3.1.8", 1, "example", "", time.Now()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// MakeBackupNameFromTemplate renders the name of the backup of the given etcd version and revision,
+// taken from the cluster of the given name and UID at ts, with the template t parsed by ParseBackupNameTemplate.
+// If t is nil, it returns the default name, MakeBackupName(ver, rev).
+func MakeBackupNameFromTemplate(t *template.Template, ver string, rev int64, clusterName, clusterUID string, ts time.Time) (string, error) {
+	if t == nil {
+		return MakeBackupName(ver, rev), nil
+	}
+	var b bytes.Buffer
+	err := t.Execute(&b, &BackupNameData{
+		Version:          ver,
+		Revision:         fmt.Sprintf("%016x", rev),
+		Timestamp:        ts.UTC().Format(BackupNameTimestampFormat),
+		RFC3339Timestamp: ts.UTC().Format(time.RFC3339),
+		ClusterName:      clusterName,
+		ClusterUID:       clusterUID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render backup name: %v", err)
+	}
+	name := b.String()
+	prefix := fmt.Sprintf("%s_%016x_", ver, rev)
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, BackupFilenameSuffix) {
+		return "", fmt.Errorf("backup name (%s) must start with %q and end with %q", name, prefix, BackupFilenameSuffix)
+	}
+	if strings.Contains(name, "/") || strings.Contains(name, EncryptedFileMarker) {
+		return "", fmt.Errorf("backup name (%s) can't contain %q or %q", name, "/", EncryptedFileMarker)
+	}
+	return name, nil
+}
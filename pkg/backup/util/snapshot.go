@@ -0,0 +1,232 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// snapshotHashAlign is the alignment of the bolt database of a snapshot. etcd appends the SHA-256 hash
+// of the database to the snapshots it sends, so a snapshot with a hash is 32 bytes past the alignment.
+const snapshotHashAlign = 512
+
+// VerifySnap checks the integrity of the etcd snapshot at the given path like `etcdctl snapshot status`.
+// The SHA-256 hash etcd appends to the snapshot must match the database, if the snapshot has one,
+// and the bolt database must be whole and consistent.
+func VerifySnap(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	dbSize := fi.Size()
+	switch fi.Size() % snapshotHashAlign {
+	case sha256.Size:
+		dbSize -= sha256.Size
+		err = verifySnapHash(f, dbSize)
+	case 0:
+		// the snapshot has no hash, e.g. if it was copied from a data dir.
+	default:
+		err = fmt.Errorf("snapshot is truncated: its size (%d) is neither aligned nor followed by a hash", fi.Size())
+	}
+	if err == nil {
+		// bolt maps the database in memory, where reading the pages past the end of the file
+		// crashes the process instead of failing.
+		err = checkSnapDBSize(f, dbSize)
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(path, 0400, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot database: %v", err)
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		var errs []string
+		// Check closes the channel once done; it must be drained before the transaction is closed.
+		for err := range tx.Check() {
+			errs = append(errs, err.Error())
+		}
+		if len(errs) != 0 {
+			return fmt.Errorf("snapshot database is corrupt: %s", strings.Join(errs, "; "))
+		}
+		return nil
+	})
+}
+
+// snapshotHeadSize is how many bytes of a snapshot SnapshotVerifier keeps to read the meta pages of its
+// bolt database, enough for both meta pages with a page size of up to 32KB.
+const snapshotHeadSize = 64 * 1024
+
+// SnapshotVerifier checks the integrity of an etcd snapshot as it is read through it, so that the snapshot
+// is never buffered: the SHA-256 hash etcd appends to the snapshot must match the database, if the snapshot
+// has one, and the bolt database must hold all the pages its meta page refers to. Unlike VerifySnap,
+// it doesn't check the consistency of the database, which needs random access.
+type SnapshotVerifier struct {
+	r io.Reader
+	n int64
+	h hash.Hash
+	// tail holds the last bytes read, which are not hashed yet since they may be the appended hash.
+	tail []byte
+	// head holds the first bytes read, with the meta pages.
+	head []byte
+	// requireHash fails the snapshots without a hash. See RequireHash.
+	requireHash bool
+}
+
+// NewSnapshotVerifier returns a SnapshotVerifier of the snapshot read from r.
+func NewSnapshotVerifier(r io.Reader) *SnapshotVerifier {
+	return &SnapshotVerifier{r: r, h: sha256.New()}
+}
+
+// RequireHash has v fail the snapshots without a hash, which are truncated if etcd sent them with one,
+// e.g. if the stream ended at the alignment of the database. See etcdutil.SnapshotHasHash.
+func (v *SnapshotVerifier) RequireHash() {
+	v.requireHash = true
+}
+
+func (v *SnapshotVerifier) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	b := p[:n]
+	v.n += int64(n)
+	if k := snapshotHeadSize - len(v.head); k > 0 {
+		if k > n {
+			k = n
+		}
+		v.head = append(v.head, b[:k]...)
+	}
+	v.tail = append(v.tail, b...)
+	if k := len(v.tail) - sha256.Size; k > 0 {
+		v.h.Write(v.tail[:k])
+		v.tail = append(v.tail[:0], v.tail[k:]...)
+	}
+	return n, err
+}
+
+// Verify checks the snapshot, which must have been read through v to its end.
+func (v *SnapshotVerifier) Verify() error {
+	dbSize := v.n
+	switch v.n % snapshotHashAlign {
+	case sha256.Size:
+		dbSize -= sha256.Size
+		if got := v.h.Sum(nil); !bytes.Equal(got, v.tail) {
+			return fmt.Errorf("snapshot hash mismatch: saved %x, computed %x", v.tail, got)
+		}
+	case 0:
+		// the snapshot has no hash.
+		if v.requireHash {
+			return fmt.Errorf("snapshot is truncated: its size (%d) is aligned but not followed by a hash", v.n)
+		}
+	default:
+		return fmt.Errorf("snapshot is truncated: its size (%d) is neither aligned nor followed by a hash", v.n)
+	}
+	return checkSnapDBSize(bytes.NewReader(v.head), dbSize)
+}
+
+// verifySnapHash checks the SHA-256 hash that follows the first dbSize bytes of r.
+func verifySnapHash(r io.Reader, dbSize int64) error {
+	h := sha256.New()
+	if _, err := io.CopyN(h, r, dbSize); err != nil {
+		return err
+	}
+	want := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, want); err != nil {
+		return err
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return fmt.Errorf("snapshot hash mismatch: saved %x, computed %x", want, got)
+	}
+	return nil
+}
+
+// The layout of the meta pages of a bolt database, see https://github.com/boltdb/bolt/blob/v1.3.1/db.go.
+const (
+	boltMagic   = 0xED0CDAED
+	boltVersion = 2
+	// boltMetaOffset is the offset of the meta in its page, after the page header.
+	boltMetaOffset = 16
+	// boltMetaSize is the size of the meta up to its checksum, which is the FNV-1a hash of the fields before it.
+	boltMetaSize = 56
+)
+
+type boltMeta struct {
+	pageSize uint32
+	pgid     uint64
+	txid     uint64
+}
+
+// checkSnapDBSize checks that the first dbSize bytes of r hold all the pages of the bolt database,
+// as given by its latest valid meta page.
+func checkSnapDBSize(r io.ReaderAt, dbSize int64) error {
+	m0, ok0 := readBoltMeta(r, 0)
+	// like bolt, the second meta page is found with the OS page size if the first one is invalid.
+	pageSize := int64(os.Getpagesize())
+	if ok0 {
+		pageSize = int64(m0.pageSize)
+	}
+	m1, ok1 := readBoltMeta(r, pageSize)
+	m := m0
+	switch {
+	case ok0 && ok1:
+		if m1.txid > m0.txid {
+			m = m1
+		}
+	case ok1:
+		m = m1
+	case !ok0:
+		return errors.New("snapshot database has no valid meta page")
+	}
+	if need := int64(m.pgid) * int64(m.pageSize); need > dbSize {
+		return fmt.Errorf("snapshot is truncated: the database needs %d bytes, the snapshot has %d", need, dbSize)
+	}
+	return nil
+}
+
+// readBoltMeta reads the meta in the page at the given offset of r, and returns false if it is not valid.
+func readBoltMeta(r io.ReaderAt, off int64) (boltMeta, bool) {
+	b := make([]byte, boltMetaSize+8)
+	if _, err := r.ReadAt(b, off+boltMetaOffset); err != nil {
+		return boltMeta{}, false
+	}
+	h := fnv.New64a()
+	h.Write(b[:boltMetaSize])
+	le := binary.LittleEndian
+	if le.Uint32(b[0:]) != boltMagic || le.Uint32(b[4:]) != boltVersion || le.Uint64(b[boltMetaSize:]) != h.Sum64() {
+		return boltMeta{}, false
+	}
+	return boltMeta{
+		pageSize: le.Uint32(b[8:]),
+		pgid:     le.Uint64(b[40:]),
+		txid:     le.Uint64(b[48:]),
+	}, true
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/boltdb/bolt"
+)
+
+// writeTestSnap writes a bolt database with some keys to a file in dir, followed by its hash like
+// the snapshots sent by etcd if withHash is true, and returns its content.
+func writeTestSnap(t *testing.T, dir string, withHash bool) []byte {
+	p := filepath.Join(dir, "db")
+	os.Remove(p)
+	db, err := bolt.Open(p, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("key"))
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"a", "b", "c"} {
+			if err = b.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withHash {
+		sum := sha256.Sum256(b)
+		b = append(b, sum[:]...)
+	}
+	return b
+}
+
+func TestVerifySnap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	withHash := writeTestSnap(t, dir, true)
+	withoutHash := writeTestSnap(t, dir, false)
+	badHash := append([]byte(nil), withHash...)
+	badHash[len(badHash)-1] ^= 0xff
+	tests := []struct {
+		desc    string
+		snap    []byte
+		wantErr bool
+	}{
+		{desc: "with hash", snap: withHash},
+		{desc: "without hash", snap: withoutHash},
+		{desc: "hash mismatch", snap: badHash, wantErr: true},
+		{desc: "truncated", snap: withHash[:len(withHash)/2+100], wantErr: true},
+		// truncated after the meta pages, where there is no hash to tell.
+		{desc: "truncated pages", snap: withoutHash[:2*os.Getpagesize()], wantErr: true},
+	}
+	for _, tt := range tests {
+		p := filepath.Join(dir, "snap")
+		if err = ioutil.WriteFile(p, tt.snap, 0600); err != nil {
+			t.Fatal(err)
+		}
+		err = VerifySnap(p)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expect error %v, got %v", tt.desc, tt.wantErr, err)
+		}
+	}
+}
+
+func TestSnapshotVerifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	withHash := writeTestSnap(t, dir, true)
+	withoutHash := writeTestSnap(t, dir, false)
+	badHash := append([]byte(nil), withHash...)
+	badHash[len(badHash)-1] ^= 0xff
+	tests := []struct {
+		desc        string
+		snap        []byte
+		requireHash bool
+		wantErr     bool
+	}{
+		{desc: "with hash", snap: withHash},
+		{desc: "with required hash", snap: withHash, requireHash: true},
+		{desc: "without hash", snap: withoutHash},
+		{desc: "without required hash", snap: withoutHash, requireHash: true, wantErr: true},
+		{desc: "hash mismatch", snap: badHash, wantErr: true},
+		{desc: "truncated", snap: withHash[:len(withHash)/2+100], wantErr: true},
+		{desc: "truncated pages", snap: withoutHash[:2*os.Getpagesize()], wantErr: true},
+		{desc: "not a snapshot", snap: []byte("foo"), wantErr: true},
+	}
+	for _, tt := range tests {
+		// the snapshot is read in small chunks, like from a stream.
+		v := NewSnapshotVerifier(bytes.NewReader(tt.snap))
+		if tt.requireHash {
+			v.RequireHash()
+		}
+		b, err := ioutil.ReadAll(iotest.HalfReader(v))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.desc, err)
+		}
+		if !bytes.Equal(b, tt.snap) {
+			t.Errorf("%s: the snapshot read through the verifier differs", tt.desc)
+		}
+		err = v.Verify()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expect error %v, got %v", tt.desc, tt.wantErr, err)
+		}
+	}
+}
@@ -15,10 +15,12 @@
 package util
 
 import (
+	"encoding/base64"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -32,22 +34,82 @@ func GetLatestBackupName(names []string) string {
 }
 
 func IsBackup(name string) bool {
-	return strings.HasSuffix(name, BackupFilenameSuffix)
+	name, _, _ = ParseEncryptedName(name)
+	return strings.HasSuffix(TrimCompressedExtension(name), BackupFilenameSuffix)
 }
 
 func MakeBackupName(ver string, rev int64) string {
 	return fmt.Sprintf("%s_%016x_%s", ver, rev, BackupFilenameSuffix)
 }
 
+// MakeChecksumName returns the name of the file holding the checksum of the given backup.
+func MakeChecksumName(name string) string {
+	return name + ChecksumFileExtension
+}
+
+// MakeClusterMetadataName returns the name of the file holding the metadata of the cluster the given backup is taken from.
+func MakeClusterMetadataName(name string) string {
+	return name + ClusterMetadataFileExtension
+}
+
+// MakeManifestName returns the name of the manifest holding the metadata of the given backup.
+func MakeManifestName(name string) string {
+	return name + ManifestFileExtension
+}
+
+func IsDelta(name string) bool {
+	name, _, _ = ParseEncryptedName(name)
+	return strings.HasSuffix(TrimCompressedExtension(name), DeltaFilenameSuffix)
+}
+
+// compressedFileExtensions are the extensions appended to the names of compressed backups.
+var compressedFileExtensions = []string{GzipFileExtension, ZstdFileExtension}
+
+// TrimCompressedExtension returns the name of the backup without the extension of its compression, if any.
+func TrimCompressedExtension(name string) string {
+	for _, ext := range compressedFileExtensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// MakeEncryptedName returns the name of the given backup or delta encrypted with the key of the given ID.
+// The key ID is base64 encoded since KMS key IDs may contain characters that are not allowed in file names.
+func MakeEncryptedName(name, keyID string) string {
+	return name + EncryptedFileMarker + base64.RawURLEncoding.EncodeToString([]byte(keyID))
+}
+
+// ParseEncryptedName returns the name of the backup or delta and the ID of the key
+// if the given name is made by MakeEncryptedName. Otherwise it returns the name as is and false.
+func ParseEncryptedName(name string) (string, string, bool) {
+	i := strings.LastIndex(name, EncryptedFileMarker)
+	if i < 0 {
+		return name, "", false
+	}
+	keyID, err := base64.RawURLEncoding.DecodeString(name[i+len(EncryptedFileMarker):])
+	if err != nil || len(keyID) == 0 {
+		return name, "", false
+	}
+	return name[:i], string(keyID), true
+}
+
+// MakeDeltaName returns the name of the delta that brings a backup up to rev.
+func MakeDeltaName(ver string, rev int64) string {
+	return fmt.Sprintf("%s_%016x_%s", ver, rev, DeltaFilenameSuffix)
+}
+
 func MustParseRevision(name string) int64 {
-	rev, err := parseRevision(name)
+	rev, err := ParseRevision(name)
 	if err != nil {
 		panic(err)
 	}
 	return rev
 }
 
-func parseRevision(name string) (int64, error) {
+// ParseRevision returns the revision of the given backup or delta name.
+func ParseRevision(name string) (int64, error) {
 	parts := strings.SplitN(name, "_", 3)
 	if len(parts) != 3 {
 		return 0, fmt.Errorf("bad backup name: %s", name)
@@ -63,12 +125,12 @@ func parseRevision(name string) (int64, error) {
 func FilterAndSortBackups(names []string) []string {
 	bnames := make(backupNames, 0)
 	for _, n := range names {
-		if !IsBackup(n) {
+		if !IsBackup(n) || n == LatestBackupName {
 			continue
 		}
-		_, err := parseRevision(n)
+		_, err := ParseRevision(n)
 		if err != nil {
-			logrus.Errorf("fail to get rev from backup (%s): %v", n, err)
+			logrus.Warningf("skipped backup (%s) whose revision can't be parsed: %v", n, err)
 			continue
 		}
 		bnames = append(bnames, n)
@@ -78,12 +140,90 @@ func FilterAndSortBackups(names []string) []string {
 	return []string(bnames)
 }
 
+// FilterAndSortDeltas returns the deltas with a revision greater than baseRev
+// sorted by revision in ascending order.
+func FilterAndSortDeltas(names []string, baseRev int64) []string {
+	dnames := make(backupNames, 0)
+	for _, n := range names {
+		if !IsDelta(n) {
+			continue
+		}
+		rev, err := ParseRevision(n)
+		if err != nil {
+			logrus.Errorf("fail to get rev from delta (%s): %v", n, err)
+			continue
+		}
+		if rev <= baseRev {
+			continue
+		}
+		dnames = append(dnames, n)
+	}
+
+	sort.Sort(dnames)
+	return []string(dnames)
+}
+
+// ObsoleteDeltas returns the deltas in names that were taken before the oldest backup in names
+// that is not removed, sorted by revision in ascending order. Such deltas can't be replayed once
+// the backups they were taken on top of are removed. It returns nil if every backup is removed.
+func ObsoleteDeltas(names, removed []string) []string {
+	isRemoved := make(map[string]bool, len(removed))
+	for _, n := range removed {
+		isRemoved[n] = true
+	}
+	var oldestRev int64 = -1
+	for _, n := range FilterAndSortBackups(names) {
+		if !isRemoved[n] {
+			oldestRev = MustParseRevision(n)
+			break
+		}
+	}
+	if oldestRev < 0 {
+		return nil
+	}
+
+	var obsolete []string
+	for _, n := range FilterAndSortDeltas(names, 0) {
+		if MustParseRevision(n) < oldestRev {
+			obsolete = append(obsolete, n)
+		}
+	}
+	return obsolete
+}
+
+// BackupsOlderThan returns the backups last modified before cutoff sorted by revision
+// in ascending order. The latest backup is never returned so that at least one backup is kept.
+func BackupsOlderThan(modTimes map[string]time.Time, cutoff time.Time) []string {
+	names := make([]string, 0, len(modTimes))
+	for n := range modTimes {
+		names = append(names, n)
+	}
+	bnames := FilterAndSortBackups(names)
+	if len(bnames) == 0 {
+		return nil
+	}
+
+	var old []string
+	for _, n := range bnames[:len(bnames)-1] {
+		if modTimes[n].Before(cutoff) {
+			old = append(old, n)
+		}
+	}
+	return old
+}
+
 type backupNames []string
 
 func (bn backupNames) Len() int { return len(bn) }
 
+// Less sorts the backups by revision, then by name, so that the backups of the same revision,
+// e.g. of a cluster recreated under the same name, are sorted by the timestamp of their names.
 func (bn backupNames) Less(i, j int) bool {
-	return MustParseRevision(bn[i]) < MustParseRevision(bn[j])
+	ri, rj := MustParseRevision(bn[i]), MustParseRevision(bn[j])
+	if ri != rj {
+		return ri < rj
+	}
+	return bn[i] < bn[j]
 }
 
 func (bn backupNames) Swap(i, j int) {
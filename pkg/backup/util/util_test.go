@@ -16,7 +16,9 @@ package util
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFilterAndSortBackups(t *testing.T) {
@@ -27,6 +29,7 @@ func TestFilterAndSortBackups(t *testing.T) {
 		MakeBackupName("3.0.3", 19),
 		MakeBackupName("3.0.0", 1),
 		"3.0.1_badbackup_etcd.backup", //bad backup name
+		LatestBackupName,
 	}
 
 	w := []string{
@@ -55,7 +58,7 @@ func TestParseRevision(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		rev, err := parseRevision(tt.name)
+		rev, err := ParseRevision(tt.name)
 		if rev != tt.rev {
 			t.Errorf("#%d: rev = %d, want %d", i, rev, tt.rev)
 		}
@@ -83,3 +86,180 @@ func TestGetLatestBackupName(t *testing.T) {
 		t.Errorf("name = %s, want %s", gname, wname)
 	}
 }
+
+// TestGetLatestBackupNameMixedNames ensures the default names and the names of a template are sorted together
+// by revision, and by name within a revision.
+func TestGetLatestBackupNameMixedNames(t *testing.T) {
+	names := []string{
+		"3.1.8_000000000000000c_prod-20171103T030405Z_etcd.backup",
+		MakeBackupName("3.1.8", 12),
+		"3.1.8_000000000000000c_prod-20171102T030405Z_etcd.backup",
+		MakeBackupName("3.1.8", 11),
+	}
+	want := []string{
+		MakeBackupName("3.1.8", 11),
+		MakeBackupName("3.1.8", 12),
+		"3.1.8_000000000000000c_prod-20171102T030405Z_etcd.backup",
+		"3.1.8_000000000000000c_prod-20171103T030405Z_etcd.backup",
+	}
+	if got := FilterAndSortBackups(names); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v, want %v", got, want)
+	}
+	if got := GetLatestBackupName(names); got != want[len(want)-1] {
+		t.Errorf("latest backup = %s, want %s", got, want[len(want)-1])
+	}
+}
+
+func TestFilterAndSortDeltas(t *testing.T) {
+	names := []string{
+		MakeDeltaName("3.1.0", 5),
+		MakeBackupName("3.1.0", 4), // not a delta
+		MakeDeltaName("3.1.0", 3),
+		MakeDeltaName("3.1.0", 2), // not newer than base revision
+		"3.1.0_baddelta_etcd.delta",
+	}
+
+	w := []string{
+		MakeDeltaName("3.1.0", 3),
+		MakeDeltaName("3.1.0", 5),
+	}
+
+	got := FilterAndSortDeltas(names, 2)
+	if !reflect.DeepEqual(got, w) {
+		t.Errorf("got = %v, want %v", got, w)
+	}
+}
+
+func TestObsoleteDeltas(t *testing.T) {
+	names := []string{
+		MakeBackupName("3.1.0", 1),
+		MakeDeltaName("3.1.0", 2), // on top of a removed backup
+		MakeDeltaName("3.1.0", 3), // on top of a removed backup
+		MakeBackupName("3.1.0", 4),
+		MakeDeltaName("3.1.0", 5),
+		MakeBackupName("3.1.0", 6),
+		MakeDeltaName("3.1.0", 7),
+	}
+
+	w := []string{
+		MakeDeltaName("3.1.0", 2),
+		MakeDeltaName("3.1.0", 3),
+	}
+	got := ObsoleteDeltas(names, []string{MakeBackupName("3.1.0", 1)})
+	if !reflect.DeepEqual(got, w) {
+		t.Errorf("got = %v, want %v", got, w)
+	}
+
+	all := []string{MakeBackupName("3.1.0", 1), MakeBackupName("3.1.0", 4), MakeBackupName("3.1.0", 6)}
+	if got = ObsoleteDeltas(names, all); got != nil {
+		t.Errorf("expect no obsolete deltas if every backup is removed, got %v", got)
+	}
+}
+
+func TestBackupsOlderThan(t *testing.T) {
+	now := time.Now()
+	modTimes := map[string]time.Time{
+		MakeBackupName("3.1.0", 3): now.Add(-3 * time.Hour),
+		MakeBackupName("3.1.0", 1): now.Add(-5 * time.Hour),
+		MakeBackupName("3.1.0", 2): now.Add(-time.Hour),
+		MakeBackupName("3.1.0", 4): now.Add(-4 * time.Hour), // latest backup is always kept
+		"3.1.0_5_etcd.tmp":         now.Add(-5 * time.Hour), // bad suffix
+	}
+
+	w := []string{
+		MakeBackupName("3.1.0", 1),
+		MakeBackupName("3.1.0", 3),
+	}
+
+	got := BackupsOlderThan(modTimes, now.Add(-2*time.Hour))
+	if !reflect.DeepEqual(got, w) {
+		t.Errorf("got = %v, want %v", got, w)
+	}
+}
+
+func TestEncryptedName(t *testing.T) {
+	bn := MakeBackupName("3.1.8", 10)
+	keyID := "arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	en := MakeEncryptedName(bn, keyID)
+	if strings.ContainsAny(en, "/:") {
+		t.Errorf("encrypted name (%s) is not a valid file name", en)
+	}
+	name, id, ok := ParseEncryptedName(en)
+	if !ok || name != bn || id != keyID {
+		t.Errorf("ParseEncryptedName(%s) = (%s, %s, %v), want (%s, %s, true)", en, name, id, ok, bn, keyID)
+	}
+	if !IsBackup(en) || MustParseRevision(en) != 10 {
+		t.Errorf("expect %s to be the backup of revision 10", en)
+	}
+	if !IsDelta(MakeEncryptedName(MakeDeltaName("3.1.8", 11), keyID)) {
+		t.Error("expect an encrypted delta to be a delta")
+	}
+	// the checksum of an encrypted backup is neither encrypted nor a backup.
+	if _, _, ok = ParseEncryptedName(MakeChecksumName(en)); ok {
+		t.Errorf("expect %s not to be encrypted", MakeChecksumName(en))
+	}
+	if IsBackup(MakeChecksumName(en)) {
+		t.Errorf("expect %s not to be a backup", MakeChecksumName(en))
+	}
+}
+
+func TestCompressedName(t *testing.T) {
+	bn := MakeBackupName("3.1.8", 10)
+	cn := bn + GzipFileExtension
+	if got := TrimCompressedExtension(cn); got != bn {
+		t.Errorf("TrimCompressedExtension(%s) = %s, want %s", cn, got, bn)
+	}
+	if !IsBackup(cn) || MustParseRevision(cn) != 10 {
+		t.Errorf("expect %s to be the backup of revision 10", cn)
+	}
+	if IsBackup(MakeChecksumName(cn)) {
+		t.Errorf("expect %s not to be a backup", MakeChecksumName(cn))
+	}
+	if got := GetLatestBackupName([]string{MakeBackupName("3.1.8", 11), cn}); got != MakeBackupName("3.1.8", 11) {
+		t.Errorf("latest backup = %s, want the backup of revision 11", got)
+	}
+}
+
+func TestBackupNameTemplate(t *testing.T) {
+	ts := time.Date(2017, 11, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{text: "{{.Version}}_{{.Revision}}_etcd.backup", want: MakeBackupName("3.2.0", 18)},
+		{text: "{{.Version}}_{{.Revision}}_{{.ClusterName}}-{{.Timestamp}}_etcd.backup", want: "3.2.0_0000000000000012_prod-20171102T030405Z_etcd.backup"},
+		{text: "{{.Version}}_{{.Revision}}_{{.ClusterUID}}_{{.RFC3339Timestamp}}_etcd.backup", want: "3.2.0_0000000000000012_4ae1d7c2_2017-11-02T03:04:05Z_etcd.backup"},
+		{text: "{{.Version", wantErr: true},
+		{text: "{{.Unknown}}", wantErr: true},
+		// the version and the revision can't be parsed from the name.
+		{text: "{{.ClusterName}}_{{.Version}}_{{.Revision}}_etcd.backup", wantErr: true},
+		// the name isn't listed as a backup.
+		{text: "{{.Version}}_{{.Revision}}_etcd", wantErr: true},
+		{text: "{{.Version}}_{{.Revision}}_{{.ClusterName}}/etcd.backup", wantErr: true},
+	}
+	for i, tt := range tests {
+		tmpl, err := ParseBackupNameTemplate(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("#%d: expect error %v, got %v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		name, err := MakeBackupNameFromTemplate(tmpl, "3.2.0", 18, "prod", "4ae1d7c2", ts)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if name != tt.want {
+			t.Errorf("#%d: name = %s, want %s", i, name, tt.want)
+		}
+		if rev := MustParseRevision(name); !IsBackup(name) || rev != 18 {
+			t.Errorf("#%d: name (%s) is not a backup at revision 18", i, name)
+		}
+	}
+
+	if name, err := MakeBackupNameFromTemplate(nil, "3.2.0", 18, "prod", "4ae1d7c2", ts); err != nil || name != MakeBackupName("3.2.0", 18) {
+		t.Errorf("default name = %s, %v, want %s", name, err, MakeBackupName("3.2.0", 18))
+	}
+}
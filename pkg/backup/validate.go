@@ -0,0 +1,105 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+
+	"golang.org/x/net/context"
+)
+
+// probeName is the name of the empty file Validate saves and deletes to check that the storage accepts writes.
+// It is not a backup name, so it's never taken for a backup.
+const probeName = ".etcd-operator-probe"
+
+// Validate checks that backups can be saved, without saving one: the members of the cluster are
+// reachable with the TLS config, and the backend accepts writes with its credentials, which is
+// checked by saving and deleting an empty probe file. It is meant to run at startup, so that a
+// misconfigured backup fails early and clearly.
+func (bm *BackupManager) Validate(ctx context.Context) error {
+	if err := bm.validateMembers(ctx); err != nil {
+		return err
+	}
+	return bm.validateBackend(ctx)
+}
+
+// validateBackend checks that the backend accepts writes by saving and deleting the probe file.
+func (bm *BackupManager) validateBackend(ctx context.Context) error {
+	if _, err := bm.be.SaveAs(ctx, probeName, bytes.NewReader(nil)); err != nil {
+		return fmt.Errorf("failed to save probe file to the backend: %v", err)
+	}
+	if err := bm.be.Delete(probeName); err != nil {
+		return fmt.Errorf("failed to delete probe file from the backend: %v", err)
+	}
+	return nil
+}
+
+// ValidateWithPrefix is like Validate for a BackupManager created by NewBackupManagerFromWriter.
+// The probe file is saved under the given prefix, where SaveSnapWithPrefix saves the backups.
+func (bm *BackupManager) ValidateWithPrefix(ctx context.Context, prefix string) error {
+	if err := bm.validateMembers(ctx); err != nil {
+		return err
+	}
+	p := path.Join(prefix, probeName)
+	if _, err := bm.bw.Write(ctx, p, bytes.NewReader(nil)); err != nil {
+		return fmt.Errorf("failed to write probe file (%s): %v", p, err)
+	}
+	if err := bm.bw.Delete(p); err != nil {
+		return fmt.Errorf("failed to delete probe file (%s): %v", p, err)
+	}
+	return nil
+}
+
+// validateMembers checks that a member of the cluster is reachable to take snapshots from.
+// The members that are not reachable are logged.
+func (bm *BackupManager) validateMembers(ctx context.Context) error {
+	etcdcli, _, err := bm.etcdClientWithMaxRevision(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reach etcd members: %v", err)
+	}
+	etcdcli.Close()
+	return nil
+}
+
+// checkStorage checks cheaply that the storage is reachable and accepts the credentials right before
+// a snapshot is taken, so that no snapshot is streamed from etcd only to fail to be saved.
+// The storage is checked with backend.Ping, or with writer.Ping under prefix for a BackupManager
+// created by NewBackupManagerFromWriter; a storage which can't be checked is taken for reachable.
+// The failure is of the storage class, which tells it apart from the failures of etcd in the metrics.
+func (bm *BackupManager) checkStorage(ctx context.Context, prefix string) error {
+	ctx, cancel := context.WithTimeout(ctx, constants.DefaultRequestTimeout)
+	defer cancel()
+	var err error
+	if bm.bw != nil {
+		err = writer.Ping(ctx, bm.bw, prefix)
+	} else {
+		err = backend.Ping(ctx, bm.be)
+	}
+	switch {
+	case err == nil:
+		return nil
+	case backend.IsPartialReplication(err):
+		// the backup is still saved on a quorum of the backends.
+		bm.getLogger().WithError(err).Warning("some backends are unreachable")
+		return nil
+	}
+	return &backupFailure{reason: failureStorage, err: fmt.Errorf("skipped taking the snapshot: storage is unreachable: %v", err)}
+}
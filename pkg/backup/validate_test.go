@@ -0,0 +1,94 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"golang.org/x/net/context"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateBackend(t *testing.T) {
+	d, err := ioutil.TempDir("", "backupdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	if err = os.Mkdir(filepath.Join(d, util.BackupTmpDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	bm := &BackupManager{be: backend.NewFileBackend(d)}
+	if err = bm.validateBackend(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(d, probeName)); !os.IsNotExist(err) {
+		t.Errorf("expect the probe file to be deleted, get=%v", err)
+	}
+
+	// the backend can't save files without its tmp dir.
+	bm = &BackupManager{be: backend.NewFileBackend(filepath.Join(d, "missing"))}
+	if err = bm.validateBackend(context.Background()); err == nil || !strings.Contains(err.Error(), "probe") {
+		t.Errorf("expect probe error, get=%v", err)
+	}
+}
+
+// TestCheckStorage ensures an unreachable storage fails the backup before the members are reached,
+// with a failure of the storage class.
+func TestCheckStorage(t *testing.T) {
+	d, err := ioutil.TempDir("", "backupdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	if err = os.Mkdir(filepath.Join(d, util.BackupTmpDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir        string
+		wantReason string
+	}{
+		// the cluster has no pods, so the backup then fails to reach the members.
+		{dir: d, wantReason: failureEtcd},
+		{dir: filepath.Join(d, "missing"), wantReason: failureStorage},
+	}
+	for _, tt := range tests {
+		bm := NewBackupManager(fake.NewSimpleClientset(), "example", "default", nil, backend.NewFileBackend(tt.dir))
+		_, err := bm.SaveSnap(context.Background(), 0)
+		if err == nil {
+			t.Fatalf("%s: expect SaveSnap to fail", tt.dir)
+		}
+		if got := failureReason(err); got != tt.wantReason {
+			t.Errorf("%s: failure reason = %s, want %s (%v)", tt.dir, got, tt.wantReason, err)
+		}
+	}
+}
+
+func TestValidateNoMembers(t *testing.T) {
+	bm := NewBackupManager(fake.NewSimpleClientset(), "example", "default", nil, nil)
+	err := bm.Validate(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "failed to reach etcd members") {
+		t.Errorf("expect unreachable members error, get=%v", err)
+	}
+}
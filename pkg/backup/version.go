@@ -18,7 +18,7 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/coreos/go-semver/semver"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
 )
 
 var compatibilityMap = map[string]map[string]struct{}{
@@ -27,6 +27,34 @@ var compatibilityMap = map[string]map[string]struct{}{
 	"3.2": {"3.1": struct{}{}, "3.2": struct{}{}},
 }
 
+// IsBackupCompatible returns true if the backup with the given name can be
+// restored by etcd of the given version.
+func IsBackupCompatible(version, name string) (bool, error) {
+	reqV, err := getMajorAndMinorVersion(version)
+	if err != nil {
+		return false, err
+	}
+	serV, err := getMajorMinorVersionFromBackup(name)
+	if err != nil {
+		return false, fmt.Errorf("fail to parse etcd version from backup (%s): %v", name, err)
+	}
+	return isVersionCompatible(reqV, serV), nil
+}
+
+// IsVersionCompatible returns true if a backup taken from etcd of version backupVersion
+// can be restored by etcd of the given version.
+func IsVersionCompatible(version, backupVersion string) (bool, error) {
+	reqV, err := getMajorAndMinorVersion(version)
+	if err != nil {
+		return false, err
+	}
+	serV, err := getMajorAndMinorVersion(backupVersion)
+	if err != nil {
+		return false, fmt.Errorf("fail to parse etcd version of backup (%s): %v", backupVersion, err)
+	}
+	return isVersionCompatible(reqV, serV), nil
+}
+
 func getMajorMinorVersionFromBackup(name string) (string, error) {
 	return getMajorAndMinorVersion(getVersionFromBackup(name))
 }
@@ -46,9 +74,9 @@ func isVersionCompatible(req, serve string) bool {
 
 // getMajorAndMinorVersion expects a semver and then returns "major.minor"
 func getMajorAndMinorVersion(rawV string) (string, error) {
-	v, err := semver.NewVersion(rawV)
+	major, minor, _, err := etcdutil.ParseVersion(rawV)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%d.%d", v.Major, v.Minor), nil
+	return fmt.Sprintf("%d.%d", major, minor), nil
 }
@@ -0,0 +1,235 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/abs"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+)
+
+const (
+	// absBlockSize is the size of each block uploaded to ABS.
+	// 4MB is the largest block size supported by the storage service API version in use.
+	absBlockSize = 4 * 1024 * 1024
+)
+
+var (
+	_ Writer         = &absWriter{}
+	_ MetadataWriter = &absWriter{}
+	_ ModTimeLister  = &absWriter{}
+	_ Opener         = &absWriter{}
+	_ Copier         = &absWriter{}
+	_ Pinger         = &absWriter{}
+)
+
+type absWriter struct {
+	abs *storage.BlobStorageClient
+}
+
+// NewABSWriter creates a abs writer.
+func NewABSWriter(abs *storage.BlobStorageClient) Writer {
+	return &absWriter{abs}
+}
+
+// Write writes the backup file to the given abs path, "<abs-container-name>/<key>".
+// The backup is uploaded as a block blob in absBlockSize chunks.
+// If ctx is cancelled, the upload stops before the block list is committed; ABS discards
+// the uncommitted blocks on its own.
+func (absw *absWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	return absw.write(ctx, path, r, nil)
+}
+
+// WriteWithMetadata writes the backup file to the given abs path like Write, with the given blob metadata.
+func (absw *absWriter) WriteWithMetadata(ctx context.Context, path string, r io.Reader, md map[string]string) (int64, error) {
+	return absw.write(ctx, path, r, md)
+}
+
+func (absw *absWriter) write(ctx context.Context, path string, r io.Reader, md map[string]string) (int64, error) {
+	container, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return 0, err
+	}
+
+	containerRef := absw.abs.GetContainerReference(container)
+	containerExists, err := containerRef.Exists()
+	if err != nil {
+		return 0, err
+	}
+	if !containerExists {
+		return 0, fmt.Errorf("container %v does not exist", container)
+	}
+
+	blob := containerRef.GetBlobReference(key)
+	var (
+		blocks []storage.Block
+		n      int64
+	)
+	buf := make([]byte, absBlockSize)
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		m, rerr := io.ReadFull(r, buf)
+		if m > 0 {
+			// block IDs must be base64 encoded and of the same length within a blob.
+			id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", i)))
+			if err := blob.PutBlock(id, buf[:m], &storage.PutBlockOptions{}); err != nil {
+				return 0, fmt.Errorf("failed to put block %d: %v", i, err)
+			}
+			blocks = append(blocks, storage.Block{ID: id, Status: storage.BlockStatusUncommitted})
+			n += int64(m)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return 0, rerr
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	// the metadata is set when the block list is committed.
+	blob.Metadata = md
+	if err := blob.PutBlockList(blocks, &storage.PutBlockListOptions{}); err != nil {
+		return 0, fmt.Errorf("failed to commit block list: %v", err)
+	}
+	return n, nil
+}
+
+// Ping checks that the container of the given abs prefix, "<abs-container-name>/<key-prefix>", exists.
+func (absw *absWriter) Ping(ctx context.Context, prefix string) error {
+	container, _, err := util.ParseBucketAndKey(prefix)
+	if err != nil {
+		return err
+	}
+	exists, err := absw.abs.GetContainerReference(container).Exists()
+	if err != nil {
+		return fmt.Errorf("failed to reach abs container (%s): %v", container, err)
+	}
+	if !exists {
+		return fmt.Errorf("container %v does not exist", container)
+	}
+	return nil
+}
+
+// List lists the backup files under the given abs prefix, "<abs-container-name>/<key-prefix>".
+func (absw *absWriter) List(prefix string) ([]string, error) {
+	var paths []string
+	err := absw.listBlobs(prefix, func(p string, blob storage.Blob) {
+		paths = append(paths, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ListModTimes returns the last modified time of the backup files listed by List.
+func (absw *absWriter) ListModTimes(prefix string) (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	err := absw.listBlobs(prefix, func(p string, blob storage.Blob) {
+		modTimes[p] = time.Time(blob.Properties.LastModified)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return modTimes, nil
+}
+
+// listBlobs calls fn with the path and the blob of each backup file under the given abs prefix.
+func (absw *absWriter) listBlobs(prefix string, fn func(p string, blob storage.Blob)) error {
+	container, key, err := util.ParseBucketAndKey(prefix)
+	if err != nil {
+		return err
+	}
+
+	containerRef := absw.abs.GetContainerReference(container)
+	params := storage.ListBlobsParameters{Prefix: key}
+	for {
+		resp, err := containerRef.ListBlobs(params)
+		if err != nil {
+			return err
+		}
+		for _, blob := range resp.Blobs {
+			fn(path.Join(container, blob.Name), blob)
+		}
+		if len(resp.NextMarker) == 0 {
+			return nil
+		}
+		params.Marker = resp.NextMarker
+	}
+}
+
+// Open opens the backup file at the given abs path, "<abs-container-name>/<key>".
+func (absw *absWriter) Open(path string) (io.ReadCloser, error) {
+	container, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := absw.abs.GetContainerReference(container).GetBlobReference(key)
+	rc, err := blob.Get(&storage.GetBlobOptions{})
+	if abs.IsNotFound(err) {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return rc, err
+}
+
+// Copy copies the backup file at the given abs path, "<abs-container-name>/<key>", to dst on the server side.
+// It waits for the copy to complete.
+func (absw *absWriter) Copy(ctx context.Context, src, dst string) error {
+	scontainer, skey, err := util.ParseBucketAndKey(src)
+	if err != nil {
+		return err
+	}
+	container, key, err := util.ParseBucketAndKey(dst)
+	if err != nil {
+		return err
+	}
+
+	srcBlob := absw.abs.GetContainerReference(scontainer).GetBlobReference(skey)
+	blob := absw.abs.GetContainerReference(container).GetBlobReference(key)
+	err = blob.Copy(srcBlob.GetURL(), &storage.CopyOptions{})
+	if abs.IsNotFound(err) {
+		return &os.PathError{Op: "copy", Path: src, Err: os.ErrNotExist}
+	}
+	return err
+}
+
+// Delete deletes the backup file at the given abs path, "<abs-container-name>/<key>".
+func (absw *absWriter) Delete(path string) error {
+	container, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return err
+	}
+
+	blob := absw.abs.GetContainerReference(container).GetBlobReference(key)
+	_, err = blob.DeleteIfExists(&storage.DeleteBlobOptions{})
+	return err
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+var (
+	_ Writer        = &FakeWriter{}
+	_ ModTimeLister = &FakeWriter{}
+	_ Opener        = &FakeWriter{}
+	_ Copier        = &FakeWriter{}
+)
+
+// FakeWriter is an in-memory writer for tests.
+type FakeWriter struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	modTimes map[string]time.Time
+}
+
+// NewFakeWriter creates a fake writer with no files.
+func NewFakeWriter() *FakeWriter {
+	return &FakeWriter{files: make(map[string][]byte), modTimes: make(map[string]time.Time)}
+}
+
+// Write reads the backup file into memory under the given path.
+// Nothing is written if ctx is cancelled before r is drained.
+func (fw *FakeWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	b, err := ioutil.ReadAll(util.NewContextReader(ctx, r))
+	if err != nil {
+		return 0, err
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.files[path] = b
+	fw.modTimes[path] = time.Now()
+	return int64(len(b)), nil
+}
+
+// List lists the paths of the files written under the given prefix.
+func (fw *FakeWriter) List(prefix string) ([]string, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	var paths []string
+	for p := range fw.files {
+		if strings.HasPrefix(p, prefix) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Open returns a reader of the file written to the given path.
+func (fw *FakeWriter) Open(path string) (io.ReadCloser, error) {
+	b, ok := fw.Get(path)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+// Copy copies the file written to src to dst.
+func (fw *FakeWriter) Copy(ctx context.Context, src, dst string) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	b, ok := fw.files[src]
+	if !ok {
+		return &os.PathError{Op: "copy", Path: src, Err: os.ErrNotExist}
+	}
+	fw.files[dst] = b
+	fw.modTimes[dst] = time.Now()
+	return nil
+}
+
+// Delete removes the file written to the given path.
+func (fw *FakeWriter) Delete(path string) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	delete(fw.files, path)
+	delete(fw.modTimes, path)
+	return nil
+}
+
+// ListModTimes returns the time the files under the given prefix were written, or set by SetModTime.
+func (fw *FakeWriter) ListModTimes(prefix string) (map[string]time.Time, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	modTimes := make(map[string]time.Time)
+	for p, t := range fw.modTimes {
+		if strings.HasPrefix(p, prefix) {
+			modTimes[p] = t
+		}
+	}
+	return modTimes, nil
+}
+
+// SetModTime sets the time the file at the given path was last modified.
+func (fw *FakeWriter) SetModTime(path string, t time.Time) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.modTimes[path] = t
+}
+
+// Get returns the content of the file written to the given path.
+func (fw *FakeWriter) Get(path string) ([]byte, bool) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	b, ok := fw.files[path]
+	return b, ok
+}
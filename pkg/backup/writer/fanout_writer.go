@@ -0,0 +1,355 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+const (
+	// fanOutChunkSize is the size of the chunks the snapshot is read and fanned out in.
+	fanOutChunkSize = 32 * 1024
+	// fanOutBufferedChunks is the number of chunks buffered for each writer
+	// so that a writer consuming slower than the others does not block them immediately.
+	fanOutBufferedChunks = 32
+	// DefaultFanOutTimeout is how long a secondary writer may not keep up with reading the backup
+	// before it is given up on, if the fan-out writer is created with a zero timeout.
+	DefaultFanOutTimeout = 1 * time.Minute
+)
+
+var (
+	_ Writer         = &fanOutWriter{}
+	_ MetadataWriter = &fanOutWriter{}
+	_ ModTimeLister  = &fanOutWriter{}
+	_ Opener         = &fanOutWriter{}
+	_ Copier         = &fanOutWriter{}
+	_ Pinger         = &fanOutWriter{}
+)
+
+var errWriterReturned = errors.New("writer returned before reading the whole backup")
+
+// PartialWriteError is returned by the fan-out writer when the primary writer
+// succeeded writing or deleting a backup but some of the secondary writers failed.
+type PartialWriteError struct {
+	// Errs maps the index of each failed secondary writer to its error.
+	Errs map[int]error
+}
+
+func (e *PartialWriteError) Error() string {
+	idx := make([]int, 0, len(e.Errs))
+	for i := range e.Errs {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d secondary writer(s) failed:", len(idx))
+	for _, i := range idx {
+		fmt.Fprintf(&b, " [%d] %v;", i, e.Errs[i])
+	}
+	return b.String()
+}
+
+// IsPartialWrite returns true if err reports that only secondary writers failed,
+// which means the backup has been saved by the primary writer.
+func IsPartialWrite(err error) bool {
+	_, ok := err.(*PartialWriteError)
+	return ok
+}
+
+type fanOutWriter struct {
+	primary     Writer
+	secondaries []Writer
+	timeout     time.Duration
+}
+
+// NewFanOutWriter creates a writer which writes each backup to the primary and all the secondary
+// writers concurrently. A secondary writer which doesn't keep up with reading the backup for longer
+// than timeout is given up on, so that it cannot stall the others. The primary writer is waited for
+// until ctx is done, since the backup fails without it. A timeout not greater than zero means
+// DefaultFanOutTimeout.
+func NewFanOutWriter(timeout time.Duration, primary Writer, secondaries ...Writer) Writer {
+	if timeout <= 0 {
+		timeout = DefaultFanOutTimeout
+	}
+	return &fanOutWriter{
+		primary:     primary,
+		secondaries: secondaries,
+		timeout:     timeout,
+	}
+}
+
+type fanOutResult struct {
+	n   int64
+	err error
+}
+
+// Write writes the backup to the given path of every writer.
+// It fails if the primary writer fails. If only secondary writers fail,
+// it returns the size written by the primary writer and a *PartialWriteError.
+// If ctx is cancelled, every writer is cancelled and ctx.Err() is returned.
+func (fw *fanOutWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	return fw.write(ctx, path, r, nil)
+}
+
+// WriteWithMetadata writes the backup with the given metadata to the given path of every writer
+// like Write. The writers which can't save metadata with the backup write a manifest, see WriteWithMetadata.
+func (fw *fanOutWriter) WriteWithMetadata(ctx context.Context, path string, r io.Reader, md map[string]string) (int64, error) {
+	return fw.write(ctx, path, r, md)
+}
+
+func (fw *fanOutWriter) write(ctx context.Context, path string, r io.Reader, md map[string]string) (int64, error) {
+	ws := append([]Writer{fw.primary}, fw.secondaries...)
+	pipes := make([]*bufferedPipe, len(ws))
+	results := make([]chan fanOutResult, len(ws))
+	for i, w := range ws {
+		p := newBufferedPipe()
+		res := make(chan fanOutResult, 1)
+		pipes[i], results[i] = p, res
+		go func(w Writer) {
+			var (
+				n   int64
+				err error
+			)
+			if md == nil {
+				n, err = w.Write(ctx, path, p)
+			} else {
+				n, err = WriteWithMetadata(ctx, w, path, p, md)
+			}
+			close(p.done)
+			res <- fanOutResult{n, err}
+		}(w)
+	}
+
+	// aborted holds the error of the writers which have been given up on.
+	aborted := make([]error, len(ws))
+	var total int64
+	buf := make([]byte, fanOutChunkSize)
+	cr := util.NewContextReader(ctx, r)
+	for {
+		n, err := cr.Read(buf)
+		if n > 0 {
+			total += int64(n)
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			for i, p := range pipes {
+				if aborted[i] != nil {
+					continue
+				}
+				timeout := fw.timeout
+				if i == 0 {
+					timeout = 0
+				}
+				if serr := p.send(ctx, chunk, timeout); serr != nil {
+					if serr == errWriterReturned {
+						if res := <-results[i]; res.err != nil {
+							serr = res.err
+						}
+					}
+					aborted[i] = serr
+					p.close(serr)
+				}
+			}
+			if aborted[0] != nil {
+				fw.closeAll(pipes, aborted[0])
+				if cerr := ctx.Err(); cerr != nil && aborted[0] == cerr {
+					return 0, cerr
+				}
+				return 0, fmt.Errorf("primary writer failed: %v", aborted[0])
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fw.closeAll(pipes, err)
+			if err == ctx.Err() {
+				return 0, err
+			}
+			return 0, fmt.Errorf("failed to read backup: %v", err)
+		}
+	}
+	fw.closeAll(pipes, nil)
+
+	errs := make(map[int]error)
+	for i := range ws {
+		err := aborted[i]
+		if err == nil {
+			res := <-results[i]
+			err = res.err
+			if err == nil && res.n != total {
+				err = fmt.Errorf("wrote %d bytes, expected %d", res.n, total)
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("primary writer failed: %v", err)
+		}
+		errs[i-1] = err
+	}
+	if len(errs) != 0 {
+		return total, &PartialWriteError{Errs: errs}
+	}
+	return total, nil
+}
+
+// List lists the backup files of the primary writer.
+func (fw *fanOutWriter) List(prefix string) ([]string, error) {
+	return fw.primary.List(prefix)
+}
+
+// ListModTimes returns the last modified time of the backup files of the primary writer.
+// It fails if the primary writer can't tell.
+func (fw *fanOutWriter) ListModTimes(prefix string) (map[string]time.Time, error) {
+	l, ok := fw.primary.(ModTimeLister)
+	if !ok {
+		return nil, errors.New("primary writer can't list the last modified time of backups")
+	}
+	return l.ListModTimes(prefix)
+}
+
+// Open opens the backup file of the primary writer.
+// It fails if the primary writer can't read back files.
+func (fw *fanOutWriter) Open(path string) (io.ReadCloser, error) {
+	o, ok := fw.primary.(Opener)
+	if !ok {
+		return nil, errors.New("primary writer can't read back backups")
+	}
+	return o.Open(path)
+}
+
+// Ping checks the storage of the primary writer, see Ping.
+// The secondary writers are not checked, since their failures don't fail a write.
+func (fw *fanOutWriter) Ping(ctx context.Context, prefix string) error {
+	return Ping(ctx, fw.primary, prefix)
+}
+
+// Copy copies the backup file on the primary and all the secondary writers, see Copy.
+// If only the secondary writers fail, it returns a *PartialWriteError.
+func (fw *fanOutWriter) Copy(ctx context.Context, src, dst string) error {
+	if err := Copy(ctx, fw.primary, src, dst); err != nil {
+		return err
+	}
+	errs := make(map[int]error)
+	for i, w := range fw.secondaries {
+		if err := Copy(ctx, w, src, dst); err != nil {
+			errs[i] = err
+		}
+	}
+	if len(errs) > 0 {
+		return &PartialWriteError{Errs: errs}
+	}
+	return nil
+}
+
+// Delete deletes the backup file from the primary and all the secondary writers.
+// If only the secondary writers fail, it returns a *PartialWriteError.
+func (fw *fanOutWriter) Delete(path string) error {
+	if err := fw.primary.Delete(path); err != nil {
+		return err
+	}
+	errs := make(map[int]error)
+	for i, w := range fw.secondaries {
+		if err := w.Delete(path); err != nil {
+			errs[i] = err
+		}
+	}
+	if len(errs) > 0 {
+		return &PartialWriteError{Errs: errs}
+	}
+	return nil
+}
+
+func (fw *fanOutWriter) closeAll(pipes []*bufferedPipe, err error) {
+	for _, p := range pipes {
+		p.close(err)
+	}
+}
+
+// bufferedPipe is an in-memory pipe which buffers up to fanOutBufferedChunks chunks.
+type bufferedPipe struct {
+	ch chan []byte
+	// done is closed when the writer reading from the pipe returns.
+	done chan struct{}
+	// err is returned to the reader after the buffered chunks, if the pipe is closed with an error.
+	err    error
+	closed bool
+	buf    []byte
+}
+
+func newBufferedPipe() *bufferedPipe {
+	return &bufferedPipe{
+		ch:   make(chan []byte, fanOutBufferedChunks),
+		done: make(chan struct{}),
+	}
+}
+
+func (p *bufferedPipe) Read(b []byte) (int, error) {
+	for len(p.buf) == 0 {
+		chunk, ok := <-p.ch
+		if !ok {
+			if p.err != nil {
+				return 0, p.err
+			}
+			return 0, io.EOF
+		}
+		p.buf = chunk
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	return n, nil
+}
+
+// send passes the chunk to the reader. It fails if the reader has returned, if ctx is done,
+// or if the reader does not make room for the chunk within timeout. A timeout not greater
+// than zero means waiting until ctx is done.
+func (p *bufferedPipe) send(ctx context.Context, chunk []byte, timeout time.Duration) error {
+	var timeoutc <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timeoutc = t.C
+	}
+	select {
+	case p.ch <- chunk:
+		return nil
+	case <-p.done:
+		return errWriterReturned
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeoutc:
+		return fmt.Errorf("writer stalled for more than %v", timeout)
+	}
+}
+
+// close closes the pipe. The reader gets err, or io.EOF if err is nil,
+// after reading the buffered chunks.
+func (p *bufferedPipe) close(err error) {
+	if p.closed {
+		return
+	}
+	p.err = err
+	p.closed = true
+	close(p.ch)
+}
@@ -0,0 +1,225 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+const testPath = "bucket/backup"
+
+type failingWriter struct{}
+
+func (fw *failingWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	return 0, errors.New("failed")
+}
+
+func (fw *failingWriter) List(prefix string) ([]string, error) {
+	return nil, errors.New("failed")
+}
+
+func (fw *failingWriter) Delete(path string) error {
+	return errors.New("failed")
+}
+
+// stalledWriter never reads the backup until released.
+type stalledWriter struct {
+	release chan struct{}
+}
+
+func (sw *stalledWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	<-sw.release
+	return 0, errors.New("released")
+}
+
+func (sw *stalledWriter) List(prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func (sw *stalledWriter) Delete(path string) error {
+	return nil
+}
+
+// slowWriter waits for delay before reading the backup into a FakeWriter.
+type slowWriter struct {
+	*FakeWriter
+	delay time.Duration
+}
+
+func (sw *slowWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	time.Sleep(sw.delay)
+	return sw.FakeWriter.Write(ctx, path, r)
+}
+
+func checkWritten(t *testing.T, fw *FakeWriter, data []byte) {
+	b, ok := fw.Get(testPath)
+	if !ok {
+		t.Fatalf("%s not written", testPath)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("written %d bytes, want %d", len(b), len(data))
+	}
+}
+
+func TestFanOutWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("etcd"), 3*fanOutChunkSize)
+	primary, secondary := NewFakeWriter(), NewFakeWriter()
+	fw := NewFanOutWriter(time.Second, primary, secondary)
+
+	n, err := fw.Write(context.Background(), testPath, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("written size = %d, want %d", n, len(data))
+	}
+	checkWritten(t, primary, data)
+	checkWritten(t, secondary, data)
+}
+
+func TestFanOutWriterDefaultTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		fw := NewFanOutWriter(timeout, NewFakeWriter()).(*fanOutWriter)
+		if fw.timeout != DefaultFanOutTimeout {
+			t.Errorf("timeout %v: fan-out timeout = %v, want %v", timeout, fw.timeout, DefaultFanOutTimeout)
+		}
+	}
+}
+
+func TestFanOutWriterSecondaryFailure(t *testing.T) {
+	data := []byte("etcd snapshot")
+	primary := NewFakeWriter()
+	fw := NewFanOutWriter(time.Second, primary, NewFakeWriter(), &failingWriter{})
+
+	n, err := fw.Write(context.Background(), testPath, bytes.NewReader(data))
+	if !IsPartialWrite(err) {
+		t.Fatalf("expect partial write error, get=%v", err)
+	}
+	if _, ok := err.(*PartialWriteError).Errs[1]; !ok || len(err.(*PartialWriteError).Errs) != 1 {
+		t.Errorf("expect only secondary writer #1 to fail, get=%v", err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("written size = %d, want %d", n, len(data))
+	}
+	checkWritten(t, primary, data)
+}
+
+func TestFanOutWriterPrimaryFailure(t *testing.T) {
+	fw := NewFanOutWriter(time.Second, &failingWriter{}, NewFakeWriter())
+
+	_, err := fw.Write(context.Background(), testPath, bytes.NewReader([]byte("etcd snapshot")))
+	if err == nil || IsPartialWrite(err) {
+		t.Fatalf("expect primary writer failure, get=%v", err)
+	}
+}
+
+func TestFanOutWriterStalledSecondary(t *testing.T) {
+	// more data than the pipe of the stalled writer can buffer.
+	data := bytes.Repeat([]byte("e"), 2*fanOutBufferedChunks*fanOutChunkSize)
+	primary := NewFakeWriter()
+	stalled := &stalledWriter{release: make(chan struct{})}
+	defer close(stalled.release)
+	fw := NewFanOutWriter(100*time.Millisecond, primary, stalled)
+
+	donec := make(chan error, 1)
+	go func() {
+		_, err := fw.Write(context.Background(), testPath, bytes.NewReader(data))
+		donec <- err
+	}()
+	select {
+	case err := <-donec:
+		if !IsPartialWrite(err) {
+			t.Fatalf("expect partial write error, get=%v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled secondary writer blocked the backup")
+	}
+	checkWritten(t, primary, data)
+}
+
+// TestFanOutWriterSlowPrimary ensures the primary writer is not given up on
+// after the fan-out timeout, unlike the secondary writers.
+func TestFanOutWriterSlowPrimary(t *testing.T) {
+	data := bytes.Repeat([]byte("e"), 2*fanOutBufferedChunks*fanOutChunkSize)
+	primary := &slowWriter{FakeWriter: NewFakeWriter(), delay: 500 * time.Millisecond}
+	secondary := NewFakeWriter()
+	fw := NewFanOutWriter(100*time.Millisecond, primary, secondary)
+
+	n, err := fw.Write(context.Background(), testPath, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("written size = %d, want %d", n, len(data))
+	}
+	checkWritten(t, primary.FakeWriter, data)
+	checkWritten(t, secondary, data)
+}
+
+func TestFanOutWriterStalledPrimaryCancel(t *testing.T) {
+	data := bytes.Repeat([]byte("e"), 2*fanOutBufferedChunks*fanOutChunkSize)
+	stalled := &stalledWriter{release: make(chan struct{})}
+	defer close(stalled.release)
+	fw := NewFanOutWriter(time.Hour, stalled, NewFakeWriter())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	donec := make(chan error, 1)
+	go func() {
+		_, err := fw.Write(ctx, testPath, bytes.NewReader(data))
+		donec <- err
+	}()
+	select {
+	case err := <-donec:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expect %v, get=%v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled primary writer blocked the cancelled backup")
+	}
+}
+
+func TestFanOutWriterDelete(t *testing.T) {
+	primary, secondary := NewFakeWriter(), NewFakeWriter()
+	fw := NewFanOutWriter(time.Second, primary, secondary, &failingWriter{})
+	for _, w := range []Writer{primary, secondary} {
+		if _, err := w.Write(context.Background(), testPath, bytes.NewReader([]byte("data"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := fw.Delete(testPath)
+	perr, ok := err.(*PartialWriteError)
+	if !ok {
+		t.Fatalf("expect *PartialWriteError, got %v", err)
+	}
+	if _, ok = perr.Errs[1]; !ok || len(perr.Errs) != 1 {
+		t.Errorf("expect only secondary writer 1 to fail, got %v", perr)
+	}
+	for i, w := range []*FakeWriter{primary, secondary} {
+		if _, ok := w.Get(testPath); ok {
+			t.Errorf("#%d: %s not deleted", i, testPath)
+		}
+	}
+
+	if err = NewFanOutWriter(time.Second, &failingWriter{}, secondary).Delete(testPath); err == nil || IsPartialWrite(err) {
+		t.Errorf("expect primary delete failure, got %v", err)
+	}
+}
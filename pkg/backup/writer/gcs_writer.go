@@ -0,0 +1,225 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	_ Writer    = &gcsWriter{}
+	_ URLSigner = &gcsWriter{}
+	_ Opener    = &gcsWriter{}
+	_ Copier    = &gcsWriter{}
+	_ Pinger    = &gcsWriter{}
+)
+
+// GCSWriterOptions configures a gcs writer.
+type GCSWriterOptions struct {
+	// Identity describes the GCP identity of the client in permission errors,
+	// e.g. the service account it authenticates as.
+	Identity string
+	// GoogleAccessID and PrivateKey are the email and the PEM encoded private key of the service account
+	// the URLs returned by SignedURL are signed with. If not set, SignedURL fails.
+	GoogleAccessID string
+	PrivateKey     []byte
+}
+
+type gcsWriter struct {
+	gcs  *storage.Client
+	opts GCSWriterOptions
+}
+
+// NewGCSWriter creates a gcs writer.
+func NewGCSWriter(gcs *storage.Client) Writer {
+	return &gcsWriter{gcs: gcs}
+}
+
+// NewGCSWriterWithOptions creates a gcs writer with the given options.
+func NewGCSWriterWithOptions(gcs *storage.Client, opts GCSWriterOptions) Writer {
+	return &gcsWriter{gcs: gcs, opts: opts}
+}
+
+// Write streams the backup file to the given gcs path, "<gcs-bucket-name>/<key>".
+// Cancelling ctx aborts the upload without creating the object.
+func (gcsw *gcsWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	bk, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// The storage writer uploads in chunks as data is copied into it,
+	// so the snapshot is never fully buffered in memory.
+	w := gcsw.gcs.Bucket(bk).Object(key).NewWriter(ctx)
+	n, err := io.Copy(w, r)
+	if err != nil {
+		// cancelling the context aborts the upload without creating the object.
+		cancel()
+		w.Close()
+		return 0, toGCSError(bk, gcsw.opts.Identity, err)
+	}
+	if err = w.Close(); err != nil {
+		return 0, toGCSError(bk, gcsw.opts.Identity, err)
+	}
+	return n, nil
+}
+
+// List lists the backup files under the given gcs prefix, "<gcs-bucket-name>/<key-prefix>".
+func (gcsw *gcsWriter) List(prefix string) ([]string, error) {
+	bk, key, err := util.ParseBucketAndKey(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	it := gcsw.gcs.Bucket(bk).Objects(context.Background(), &storage.Query{Prefix: key})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, toGCSError(bk, gcsw.opts.Identity, err)
+		}
+		paths = append(paths, path.Join(bk, attrs.Name))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Ping checks that the objects under the given gcs prefix, "<gcs-bucket-name>/<key-prefix>", can be listed.
+// Listing needs the same role as writing, while getting the bucket itself doesn't.
+func (gcsw *gcsWriter) Ping(ctx context.Context, prefix string) error {
+	bk, key, err := util.ParseBucketAndKey(prefix)
+	if err != nil {
+		return err
+	}
+	it := gcsw.gcs.Bucket(bk).Objects(ctx, &storage.Query{Prefix: key})
+	if _, err := it.Next(); err != nil && err != iterator.Done {
+		return toGCSError(bk, gcsw.opts.Identity, err)
+	}
+	return nil
+}
+
+// Open opens the backup file at the given gcs path, "<gcs-bucket-name>/<key>".
+func (gcsw *gcsWriter) Open(path string) (io.ReadCloser, error) {
+	bk, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := gcsw.gcs.Bucket(bk).Object(key).NewReader(context.Background())
+	if err == storage.ErrObjectNotExist {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, toGCSError(bk, gcsw.opts.Identity, err)
+	}
+	return r, nil
+}
+
+// Copy copies the backup file at the given gcs path, "<gcs-bucket-name>/<key>", to dst on the server side.
+func (gcsw *gcsWriter) Copy(ctx context.Context, src, dst string) error {
+	sbk, skey, err := util.ParseBucketAndKey(src)
+	if err != nil {
+		return err
+	}
+	bk, key, err := util.ParseBucketAndKey(dst)
+	if err != nil {
+		return err
+	}
+
+	srcObj := gcsw.gcs.Bucket(sbk).Object(skey)
+	_, err = gcsw.gcs.Bucket(bk).Object(key).CopierFrom(srcObj).Run(ctx)
+	if err == storage.ErrObjectNotExist {
+		return &os.PathError{Op: "copy", Path: src, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return toGCSError(bk, gcsw.opts.Identity, err)
+	}
+	return nil
+}
+
+// Delete deletes the backup file at the given gcs path, "<gcs-bucket-name>/<key>".
+func (gcsw *gcsWriter) Delete(path string) error {
+	bk, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return err
+	}
+
+	err = gcsw.gcs.Bucket(bk).Object(key).Delete(context.Background())
+	if err != nil && err != storage.ErrObjectNotExist {
+		return toGCSError(bk, gcsw.opts.Identity, err)
+	}
+	return nil
+}
+
+// SignedURL returns a signed URL to download the backup file at the given gcs path, "<gcs-bucket-name>/<key>",
+// which expires after ttl.
+func (gcsw *gcsWriter) SignedURL(path string, ttl time.Duration) (string, error) {
+	bk, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return "", err
+	}
+	if len(gcsw.opts.GoogleAccessID) == 0 || len(gcsw.opts.PrivateKey) == 0 {
+		return "", errors.New("signing gcs urls needs the key of a service account; they can't be signed with application default credentials")
+	}
+
+	return storage.SignedURL(bk, key, &storage.SignedURLOptions{
+		GoogleAccessID: gcsw.opts.GoogleAccessID,
+		PrivateKey:     gcsw.opts.PrivateKey,
+		Method:         http.MethodGet,
+		Expires:        time.Now().Add(ttl),
+	})
+}
+
+// toGCSError makes the common bucket-not-found and permission errors readable.
+// Permission errors name the identity, if known, that needs to be granted access to the bucket.
+func toGCSError(bucket, identity string, err error) error {
+	if err == storage.ErrBucketNotExist {
+		return fmt.Errorf("gcs bucket (%s) not found", bucket)
+	}
+	gerr, ok := err.(*googleapi.Error)
+	if !ok {
+		return err
+	}
+	switch gerr.Code {
+	case http.StatusNotFound:
+		return fmt.Errorf("gcs bucket (%s) not found: %v", bucket, gerr)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		if len(identity) == 0 {
+			return fmt.Errorf("permission denied accessing gcs bucket (%s): %v", bucket, gerr)
+		}
+		return fmt.Errorf("permission denied accessing gcs bucket (%s) as %s: grant it the roles/storage.objectAdmin role on the bucket: %v",
+			bucket, identity, gerr)
+	}
+	return err
+}
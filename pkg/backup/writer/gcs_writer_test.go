@@ -0,0 +1,44 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestToGCSErrorNamesIdentity(t *testing.T) {
+	const identity = "service account backup@project.iam.gserviceaccount.com from secret (gcp)"
+	denied := &googleapi.Error{Code: http.StatusForbidden, Message: "Forbidden"}
+
+	err := toGCSError("bk", identity, denied)
+	for _, want := range []string{"(bk)", identity, "roles/storage.objectAdmin"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expect %q in error, got %v", want, err)
+		}
+	}
+	if err = toGCSError("bk", "", denied); strings.Contains(err.Error(), " as ") {
+		t.Errorf("expect no identity in error, got %v", err)
+	}
+
+	other := errors.New("connection refused")
+	if err = toGCSError("bk", identity, other); err != other {
+		t.Errorf("expect other errors unchanged, got %v", err)
+	}
+}
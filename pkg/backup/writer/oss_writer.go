@@ -0,0 +1,182 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/util/retryutil"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ossPartSize is the size of each part of a multipart upload.
+	// OSS requires every part except the last one to be at least 100KB.
+	ossPartSize = 16 * 1024 * 1024
+
+	ossRetryInterval = 2 * time.Second
+	ossMaxRetries    = 5
+)
+
+var _ Writer = &ossWriter{}
+
+type ossWriter struct {
+	oss *oss.Client
+}
+
+// NewOSSWriter creates an oss writer.
+func NewOSSWriter(oss *oss.Client) Writer {
+	return &ossWriter{oss}
+}
+
+// Write writes the backup file to the given oss path, "<oss-bucket-name>/<key>".
+// Since the snapshot size is not known in advance, the backup is always written
+// with a multipart upload. Parts failing with a 5xx response are retried.
+func (ow *ossWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	bucketName, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return 0, err
+	}
+
+	exist, err := ow.oss.IsBucketExist(bucketName)
+	if err != nil {
+		return 0, err
+	}
+	if !exist {
+		return 0, fmt.Errorf("oss bucket (%s) not found", bucketName)
+	}
+	bucket, err := ow.oss.Bucket(bucketName)
+	if err != nil {
+		return 0, err
+	}
+
+	imur, err := bucket.InitiateMultipartUpload(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to initiate multipart upload: %v", err)
+	}
+	n, parts, err := uploadOSSParts(bucket, imur, util.NewContextReader(ctx, r))
+	if err != nil {
+		if aerr := bucket.AbortMultipartUpload(imur); aerr != nil {
+			logrus.Warningf("failed to abort multipart upload (%s): %v", imur.UploadID, aerr)
+		}
+		return 0, err
+	}
+	if _, err = bucket.CompleteMultipartUpload(imur, parts); err != nil {
+		return 0, fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+	return n, nil
+}
+
+// List lists the backup files under the given oss prefix, "<oss-bucket-name>/<key-prefix>".
+func (ow *ossWriter) List(prefix string) ([]string, error) {
+	bucketName, key, err := util.ParseBucketAndKey(prefix)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := ow.oss.Bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	marker := oss.Marker("")
+	for {
+		resp, err := bucket.ListObjects(oss.Prefix(key), marker)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range resp.Objects {
+			paths = append(paths, path.Join(bucketName, obj.Key))
+		}
+		if !resp.IsTruncated {
+			break
+		}
+		marker = oss.Marker(resp.NextMarker)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Delete deletes the backup file at the given oss path, "<oss-bucket-name>/<key>".
+func (ow *ossWriter) Delete(path string) error {
+	bucketName, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return err
+	}
+	bucket, err := ow.oss.Bucket(bucketName)
+	if err != nil {
+		return err
+	}
+	// OSS reports success when deleting an object that does not exist.
+	return bucket.DeleteObject(key)
+}
+
+// uploadOSSParts reads r in ossPartSize parts and uploads them in order.
+// At least one part is always uploaded so that the upload can be completed.
+func uploadOSSParts(bucket *oss.Bucket, imur oss.InitiateMultipartUploadResult, r io.Reader) (int64, []oss.UploadPart, error) {
+	var (
+		total int64
+		parts []oss.UploadPart
+	)
+	buf := make([]byte, ossPartSize)
+	for num := 1; ; num++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, nil, err
+		}
+		if n == 0 && num > 1 {
+			break
+		}
+
+		var part oss.UploadPart
+		rerr := retryutil.Retry(ossRetryInterval, ossMaxRetries, func() (bool, error) {
+			var perr error
+			part, perr = bucket.UploadPart(imur, bytes.NewReader(buf[:n]), int64(n), num)
+			if perr == nil {
+				return true, nil
+			}
+			if isOSSTransientError(perr) {
+				logrus.Warningf("failed to upload part %d of %s, retrying: %v", num, imur.Key, perr)
+				return false, nil
+			}
+			return false, perr
+		})
+		if rerr != nil {
+			return 0, nil, fmt.Errorf("failed to upload part %d: %v", num, rerr)
+		}
+		parts = append(parts, part)
+		total += int64(n)
+
+		if n < ossPartSize {
+			break
+		}
+	}
+	return total, parts, nil
+}
+
+// isOSSTransientError returns true if err is a server side error that is worth retrying.
+func isOSSTransientError(err error) bool {
+	serr, ok := err.(oss.ServiceError)
+	return ok && serr.StatusCode >= 500
+}
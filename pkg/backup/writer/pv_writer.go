@@ -0,0 +1,243 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+var (
+	_ Writer        = &pvWriter{}
+	_ ModTimeLister = &pvWriter{}
+	_ Opener        = &pvWriter{}
+	_ Copier        = &pvWriter{}
+	_ Pinger        = &pvWriter{}
+)
+
+// DiskFullError is returned by the PV writer when the volume runs out of space.
+type DiskFullError struct {
+	Path string
+	Err  error
+}
+
+func (e *DiskFullError) Error() string {
+	return fmt.Sprintf("no space left on device to write backup (%s): %v", e.Path, e.Err)
+}
+
+// IsDiskFull returns true if err reports that the backup volume is full.
+func IsDiskFull(err error) bool {
+	_, ok := err.(*DiskFullError)
+	return ok
+}
+
+type pvWriter struct {
+	dir string
+}
+
+// NewPVWriter creates a writer which saves backups under dir,
+// the mount path of a persistent volume.
+func NewPVWriter(dir string) Writer {
+	return &pvWriter{dir}
+}
+
+// Write writes the backup file to the given path relative to the volume mount path.
+// The file is synced to disk before Write returns. Writing a backup that already exists
+// succeeds only if the existing file has the same size.
+// If ctx is cancelled, the write stops and the partially written temp file is removed.
+func (pw *pvWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	return pw.write(ctx, path, r, false)
+}
+
+// write writes the backup file like Write. If replace is true, an existing file is replaced
+// whatever its size.
+func (pw *pvWriter) write(ctx context.Context, path string, r io.Reader, replace bool) (int64, error) {
+	fpath := filepath.Join(pw.dir, path)
+	dir := filepath.Dir(fpath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return 0, toPVError(fpath, fmt.Errorf("failed to create backup dir: %v", err), err)
+	}
+
+	// The temp file is hidden so that List does not return it.
+	tmpfile, err := ioutil.TempFile(dir, "."+filepath.Base(fpath)+".tmp")
+	if err != nil {
+		return 0, toPVError(fpath, fmt.Errorf("failed to create backup tempfile: %v", err), err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	n, err := io.Copy(tmpfile, util.NewContextReader(ctx, r))
+	if err == nil {
+		err = tmpfile.Sync()
+	}
+	if cerr := tmpfile.Close(); err == nil {
+		err = cerr
+	}
+	// the backup must not be saved if ctx was cancelled, even once it is fully written.
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	if err != nil {
+		return 0, toPVError(fpath, fmt.Errorf("failed to write backup: %v", err), err)
+	}
+
+	if !replace {
+		fi, err := os.Stat(fpath)
+		switch {
+		case err == nil:
+			if fi.Size() != n {
+				return 0, fmt.Errorf("backup (%s) already exists with a different size (%d != %d)", fpath, fi.Size(), n)
+			}
+			return n, nil
+		case !os.IsNotExist(err):
+			return 0, err
+		}
+	}
+
+	if err = os.Rename(tmpfile.Name(), fpath); err != nil {
+		return 0, fmt.Errorf("rename backup from %s to %s failed: %v", tmpfile.Name(), fpath, err)
+	}
+	if err = syncDir(dir); err != nil {
+		return 0, fmt.Errorf("failed to sync backup dir (%s): %v", dir, err)
+	}
+	return n, nil
+}
+
+// List lists the backup files whose path relative to the volume mount path starts with prefix.
+func (pw *pvWriter) List(prefix string) ([]string, error) {
+	var paths []string
+	err := pw.walk(prefix, func(p string, fi os.FileInfo) {
+		paths = append(paths, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ListModTimes returns the modification time of the backup files listed by List.
+func (pw *pvWriter) ListModTimes(prefix string) (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	err := pw.walk(prefix, func(p string, fi os.FileInfo) {
+		modTimes[p] = fi.ModTime()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return modTimes, nil
+}
+
+// walk calls fn with the path relative to the volume mount path of each backup file that starts with prefix.
+func (pw *pvWriter) walk(prefix string, fn func(p string, fi os.FileInfo)) error {
+	root := prefix
+	if !strings.HasSuffix(prefix, "/") {
+		root = filepath.Dir(prefix)
+	}
+	root = filepath.Join(pw.dir, root)
+
+	return filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if p == root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(pw.dir, p)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(rel, prefix) {
+			fn(rel, fi)
+		}
+		return nil
+	})
+}
+
+// Open opens the backup file at the given path relative to the volume mount path.
+func (pw *pvWriter) Open(path string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(pw.dir, path))
+}
+
+// Copy copies the backup file at src to dst, relative to the volume mount path.
+// dst is replaced atomically if it exists.
+func (pw *pvWriter) Copy(ctx context.Context, src, dst string) error {
+	f, err := os.Open(filepath.Join(pw.dir, src))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = pw.write(ctx, dst, f, true)
+	return err
+}
+
+// Delete deletes the backup file at the given path relative to the volume mount path.
+func (pw *pvWriter) Delete(path string) error {
+	fpath := filepath.Join(pw.dir, path)
+	if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return syncDir(filepath.Dir(fpath))
+}
+
+// syncDir makes the rename of a file in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Ping checks that the mount path of the volume is a directory. The given prefix is created by Write if missing.
+func (pw *pvWriter) Ping(ctx context.Context, prefix string) error {
+	fi, err := os.Stat(pw.dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("backup volume mount path (%s) is not a directory", pw.dir)
+	}
+	return nil
+}
+
+// toPVError returns a DiskFullError if cause is caused by a full volume, otherwise err.
+func toPVError(path string, err, cause error) error {
+	switch e := cause.(type) {
+	case *os.PathError:
+		cause = e.Err
+	case *os.LinkError:
+		cause = e.Err
+	case *os.SyscallError:
+		cause = e.Err
+	}
+	if cause == syscall.ENOSPC {
+		return &DiskFullError{Path: path, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,245 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestPVWriterWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pw := NewPVWriter(dir)
+	p := "v1/default/example/3.1.9_0000000000000001_etcd.backup"
+	data := []byte("etcd snapshot")
+
+	n, err := pw.Write(context.Background(), p, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("written size = %d, want %d", n, len(data))
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("content = %q, want %q", b, data)
+	}
+
+	// rewriting the same backup is allowed.
+	if _, err = pw.Write(context.Background(), p, bytes.NewReader(data)); err != nil {
+		t.Errorf("rewrite with the same size failed: %v", err)
+	}
+	// overwriting it with a different size is not.
+	if _, err = pw.Write(context.Background(), p, bytes.NewReader([]byte("corrupted"))); err == nil {
+		t.Errorf("expect overwrite with a different size to fail")
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("content after overwrite = %q, want %q", b, data)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Dir(filepath.Join(dir, p)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expect temp files to be removed, get %d files", len(files))
+	}
+}
+
+func TestPVWriterWriteCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pv-writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pw := NewPVWriter(dir)
+	p := "v1/default/example/3.1.10_0000000000000001_etcd.backup"
+	if _, err = pw.Write(ctx, p, bytes.NewReader([]byte("data"))); err != context.Canceled {
+		t.Fatalf("expect %v, got %v", context.Canceled, err)
+	}
+	files, err := ioutil.ReadDir(filepath.Dir(filepath.Join(dir, p)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expect no file to be left, get %d files", len(files))
+	}
+}
+
+func TestToPVError(t *testing.T) {
+	tests := []struct {
+		cause error
+		wfull bool
+	}{
+		{&os.PathError{Op: "write", Path: "backup", Err: syscall.ENOSPC}, true},
+		{&os.PathError{Op: "write", Path: "backup", Err: syscall.EACCES}, false},
+		{errors.New("unexpected EOF"), false},
+	}
+	for i, tt := range tests {
+		err := toPVError("backup", tt.cause, tt.cause)
+		if IsDiskFull(err) != tt.wfull {
+			t.Errorf("#%d: IsDiskFull(%v) = %v, want %v", i, err, !tt.wfull, tt.wfull)
+		}
+	}
+}
+
+func TestPVWriterList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pw := NewPVWriter(dir)
+	paths := []string{
+		"v1/default/example/3.1.9_0000000000000002_etcd.backup",
+		"v1/default/example/3.1.9_0000000000000001_etcd.backup",
+		"v1/default/example-2/3.1.9_0000000000000003_etcd.backup",
+	}
+	for _, p := range paths {
+		if _, err = pw.Write(context.Background(), p, bytes.NewReader([]byte(p))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"v1/default/example/", []string{paths[1], paths[0]}},
+		{"v1/default/example", []string{paths[2], paths[1], paths[0]}},
+		{"v1/default/none/", nil},
+	}
+	for i, tt := range tests {
+		got, err := pw.List(tt.prefix)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("#%d: List(%s) = %v, want %v", i, tt.prefix, got, tt.want)
+		}
+
+		modTimes, err := pw.(ModTimeLister).ListModTimes(tt.prefix)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if len(modTimes) != len(tt.want) {
+			t.Errorf("#%d: ListModTimes(%s) = %v, want the times of %v", i, tt.prefix, modTimes, tt.want)
+		}
+		for _, p := range tt.want {
+			if modTimes[p].IsZero() {
+				t.Errorf("#%d: ListModTimes(%s) has no time of %s", i, tt.prefix, p)
+			}
+		}
+	}
+}
+
+func TestPVWriterDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pw := NewPVWriter(dir)
+	p := "v1/default/example/3.1.9_0000000000000001_etcd.backup"
+	if _, err = pw.Write(context.Background(), p, bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatal(err)
+	}
+	if err = pw.Delete(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, p)); !os.IsNotExist(err) {
+		t.Errorf("expect backup to be deleted, stat error = %v", err)
+	}
+	// deleting again is not an error.
+	if err = pw.Delete(p); err != nil {
+		t.Errorf("failed to delete a deleted backup: %v", err)
+	}
+}
+
+// TestPVWriterCopy ensures Copy replaces the destination, unlike Write which keeps a file of the same size.
+func TestPVWriterCopy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pw := NewPVWriter(dir)
+	dst := "v1/default/example/latest_etcd.backup"
+	for i, data := range []string{"data1", "data2"} {
+		src := fmt.Sprintf("v1/default/example/3.1.9_%016x_etcd.backup", i+1)
+		if _, err = pw.Write(context.Background(), src, bytes.NewReader([]byte(data))); err != nil {
+			t.Fatal(err)
+		}
+		if err = pw.(Copier).Copy(context.Background(), src, dst); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, dst))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != data {
+			t.Errorf("#%d: copy = %q, want %q", i, b, data)
+		}
+	}
+	if err = pw.(Copier).Copy(context.Background(), "v1/default/example/missing", dst); !os.IsNotExist(err) {
+		t.Errorf("expect not exist error copying a missing backup, got %v", err)
+	}
+}
+
+func TestPVWriterPing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pv-writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = Ping(context.Background(), NewPVWriter(dir), "default/example"); err != nil {
+		t.Errorf("expect the mounted volume to be reachable, got %v", err)
+	}
+	if err = Ping(context.Background(), NewPVWriter(filepath.Join(dir, "missing")), "default/example"); err == nil {
+		t.Error("expect a missing mount path to fail")
+	}
+	// the fan-out writer checks its primary writer.
+	fw := NewFanOutWriter(0, NewPVWriter(filepath.Join(dir, "missing")), NewPVWriter(dir))
+	if err = Ping(context.Background(), fw, "default/example"); err == nil {
+		t.Error("expect a missing mount path of the primary writer to fail")
+	}
+}
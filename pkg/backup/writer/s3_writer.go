@@ -15,51 +15,236 @@
 package writer
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
 
+	backups3 "github.com/coreos/etcd-operator/pkg/backup/s3"
 	"github.com/coreos/etcd-operator/pkg/backup/util"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	// DefaultS3PartSizeInMB is the size of the parts of a multipart upload if not configured.
+	DefaultS3PartSizeInMB = backups3.DefaultPartSizeInMB
+	// MinS3PartSizeInMB is the min size of the parts of a multipart upload except the last one allowed by S3.
+	MinS3PartSizeInMB = backups3.MinPartSizeInMB
+)
+
+// S3WriterOptions configures how a s3 writer saves the backups.
+type S3WriterOptions struct {
+	// SSE is the server-side encryption of the backups.
+	SSE backups3.SSE
+	// StorageClass is the storage class of the backups. Empty means the bucket default.
+	// It must be validated by backups3.ValidateStorageClass.
+	StorageClass string
+	// PartSizeInMB is the size of the parts of a multipart upload. Backups that fit in one part
+	// are saved with a single request. Zero means DefaultS3PartSizeInMB.
+	// It must be at least MinS3PartSizeInMB.
+	PartSizeInMB int64
+	// Bucket, if set, is the bucket the backups are saved in instead of the bucket of the given paths.
+	// It lets the same paths be saved in a secondary bucket.
+	Bucket string
+}
+
+var (
+	_ Writer         = &s3Writer{}
+	_ MetadataWriter = &s3Writer{}
+	_ ModTimeLister  = &s3Writer{}
+	_ Opener         = &s3Writer{}
+	_ Copier         = &s3Writer{}
+	_ Pinger         = &s3Writer{}
 )
 
 type s3Writer struct {
-	s3 *s3.S3
+	s3   *s3.S3
+	opts S3WriterOptions
 }
 
 // NewS3Writer creates a s3 writer.
 func NewS3Writer(s3 *s3.S3) Writer {
-	return &s3Writer{s3}
+	return &s3Writer{s3: s3}
+}
+
+// NewS3WriterWithSSE creates a s3 writer which encrypts the backups with the given server-side encryption.
+func NewS3WriterWithSSE(s3 *s3.S3, sse backups3.SSE) Writer {
+	return &s3Writer{s3: s3, opts: S3WriterOptions{SSE: sse}}
+}
+
+// NewS3WriterWithOptions creates a s3 writer configured by the given options.
+func NewS3WriterWithOptions(s3 *s3.S3, opts S3WriterOptions) Writer {
+	return &s3Writer{s3: s3, opts: opts}
 }
 
 // Write writes the backup file to the given s3 path, "<s3-bucket-name>/<key>".
-func (s3w *s3Writer) Write(path string, r io.Reader) (int64, error) {
-	bk, key, err := util.ParseBucketAndKey(path)
+// The backup is streamed in parts of a multipart upload, so at most two parts of it are in memory:
+// the part being uploaded and the next one being read.
+// It returns the number of bytes read from r.
+// The upload is aborted if ctx is cancelled.
+func (s3w *s3Writer) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	return s3w.write(ctx, path, r, nil)
+}
+
+// WriteWithMetadata writes the backup file to the given s3 path like Write, with the given object metadata.
+func (s3w *s3Writer) WriteWithMetadata(ctx context.Context, path string, r io.Reader, md map[string]string) (int64, error) {
+	return s3w.write(ctx, path, r, md)
+}
+
+func (s3w *s3Writer) write(ctx context.Context, path string, r io.Reader, md map[string]string) (int64, error) {
+	bk, key, err := s3w.parsePath(path)
 	if err != nil {
 		return 0, err
 	}
+	return backups3.Upload(ctx, s3w.s3, bk, key, r, backups3.UploadOptions{
+		SSE:          s3w.opts.SSE,
+		StorageClass: s3w.opts.StorageClass,
+		Metadata:     md,
+		PartSizeInMB: s3w.opts.PartSizeInMB,
+	})
+}
 
-	_, err = s3manager.NewUploaderWithClient(s3w.s3).Upload(
-		&s3manager.UploadInput{
-			Bucket: aws.String(bk),
-			Key:    aws.String(key),
-			Body:   r,
-		})
+// List lists the backup files under the given s3 prefix, "<s3-bucket-name>/<key-prefix>".
+func (s3w *s3Writer) List(prefix string) ([]string, error) {
+	var paths []string
+	err := s3w.listObjects(prefix, func(p string, obj *s3.Object) {
+		paths = append(paths, p)
+	})
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ListModTimes returns the last modified time of the backup files listed by List.
+func (s3w *s3Writer) ListModTimes(prefix string) (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	err := s3w.listObjects(prefix, func(p string, obj *s3.Object) {
+		modTimes[p] = aws.TimeValue(obj.LastModified)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return modTimes, nil
+}
+
+// listObjects calls fn with the path and the object of each backup file under the given s3 prefix.
+func (s3w *s3Writer) listObjects(prefix string, fn func(p string, obj *s3.Object)) error {
+	pbk, key, err := util.ParseBucketAndKey(prefix)
+	if err != nil {
+		return err
+	}
+	bk := pbk
+	if s3w.opts.Bucket != "" {
+		bk = s3w.opts.Bucket
+	}
+
+	// ListObjects returns at most 1000 keys at a time; the pager follows the markers.
+	return s3w.s3.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket: aws.String(bk),
+		Prefix: aws.String(key),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			fn(path.Join(pbk, *obj.Key), obj)
+		}
+		return true
+	})
+}
+
+// Open opens the backup file at the given s3 path, "<s3-bucket-name>/<key>".
+func (s3w *s3Writer) Open(path string) (io.ReadCloser, error) {
+	bk, key, err := s3w.parsePath(path)
+	if err != nil {
+		return nil, err
 	}
 
 	resp, err := s3w.s3.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(bk),
 		Key:    aws.String(key),
 	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Copy copies the backup file at the given s3 path, "<s3-bucket-name>/<key>", to dst on the server side.
+// Backups larger than 5GB are copied in parts, see backups3.Copy.
+func (s3w *s3Writer) Copy(ctx context.Context, src, dst string) error {
+	sbk, skey, err := s3w.parsePath(src)
+	if err != nil {
+		return err
+	}
+	bk, key, err := s3w.parsePath(dst)
+	if err != nil {
+		return err
+	}
+	return backups3.Copy(ctx, s3w.s3, sbk, skey, bk, key, backups3.UploadOptions{
+		SSE:          s3w.opts.SSE,
+		StorageClass: s3w.opts.StorageClass,
+	})
+}
+
+// Delete deletes the backup file at the given s3 path, "<s3-bucket-name>/<key>".
+func (s3w *s3Writer) Delete(path string) error {
+	bk, key, err := s3w.parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3w.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bk),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// SignedURL returns a pre-signed URL to download the backup file at the given s3 path, "<s3-bucket-name>/<key>",
+// which expires after ttl.
+func (s3w *s3Writer) SignedURL(path string, ttl time.Duration) (string, error) {
+	bk, key, err := s3w.parsePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := s3w.s3.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bk),
+		Key:    aws.String(key),
+	})
+	return req.Presign(ttl)
+}
+
+// Ping checks that the bucket of the given s3 prefix, "<s3-bucket-name>/<key-prefix>", exists
+// and is accessible with the credentials of the writer.
+func (s3w *s3Writer) Ping(ctx context.Context, prefix string) error {
+	bk, _, err := s3w.parsePath(prefix)
+	if err != nil {
+		return err
+	}
+	if _, err := s3w.s3.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(bk)}); err != nil {
+		return fmt.Errorf("failed to reach s3 bucket (%s): %v", bk, err)
+	}
+	return nil
+}
+
+// parsePath parses the s3 path, "<s3-bucket-name>/<key>", into the bucket and key to save the backup at.
+func (s3w *s3Writer) parsePath(p string) (string, string, error) {
+	bk, key, err := util.ParseBucketAndKey(p)
+	if err != nil {
+		return "", "", err
 	}
-	if resp.ContentLength == nil {
-		return 0, fmt.Errorf("failed to compute s3 object size")
+	if s3w.opts.Bucket != "" {
+		bk = s3w.opts.Bucket
 	}
-	return *resp.ContentLength, nil
+	return bk, key, nil
 }
@@ -0,0 +1,337 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/reader"
+	backups3 "github.com/coreos/etcd-operator/pkg/backup/s3"
+	"github.com/coreos/etcd-operator/pkg/backup/s3/s3test"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+func TestS3WriterServerSideEncryption(t *testing.T) {
+	ts := s3test.NewServer()
+	defer ts.Close()
+	s3cli := ts.NewClient()
+
+	tests := []struct {
+		sse      string
+		kmsKeyID string
+		wsse     string
+	}{
+		{sse: backups3.SSEAES256, wsse: "AES256"},
+		{sse: backups3.SSEKMS, wsse: "aws:kms"},
+		{kmsKeyID: "alias/etcd-backup", wsse: "aws:kms"},
+		{},
+	}
+	for i, tt := range tests {
+		sse, err := backups3.NewSSE(tt.sse, tt.kmsKeyID)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		data := []byte("etcd snapshot")
+
+		// the backup operator uploads with the writer.
+		p := fmt.Sprintf("bucket/v1/default/example/3.1.10_%016x_etcd.backup", i)
+		if _, err = NewS3WriterWithSSE(s3cli, sse).Write(context.Background(), p, bytes.NewReader(data)); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		// the backup sidecar puts through the S3 backend.
+		bcli := backups3.NewFromClient("bucket", "sidecar", s3cli)
+		bcli.SetSSE(sse)
+		if err = bcli.Put(context.Background(), strconv.Itoa(i), bytes.NewReader(data)); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		for _, p := range []string{p, path.Join("bucket/sidecar", strconv.Itoa(i))} {
+			if got := ts.Header(p, "X-Amz-Server-Side-Encryption"); got != tt.wsse {
+				t.Errorf("#%d: %s encryption header = %q, want %q", i, p, got, tt.wsse)
+			}
+			if got := ts.Header(p, "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"); got != tt.kmsKeyID {
+				t.Errorf("#%d: %s KMS key header = %q, want %q", i, p, got, tt.kmsKeyID)
+			}
+		}
+		// reading needs no encryption config.
+		rc, err := reader.NewS3Reader(s3cli).Open(p)
+		if err != nil {
+			t.Fatalf("#%d: failed to open %s: %v", i, p, err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(b, data) {
+			t.Errorf("#%d: read (%q, %v), want %q", i, b, err, data)
+		}
+	}
+
+	sse, err := backups3.NewSSE(backups3.SSEKMS, s3test.InvalidKMSKeyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewS3WriterWithSSE(s3cli, sse).Write(context.Background(), "bucket/invalid", bytes.NewReader([]byte("data")))
+	if err == nil || !strings.Contains(err.Error(), s3test.InvalidKMSKeyID) {
+		t.Errorf("expect the error to name the KMS key, got %v", err)
+	}
+
+	if _, err = backups3.NewSSE(backups3.SSEAES256, "alias/etcd-backup"); err == nil {
+		t.Error("expect a KMS key with AES256 to be rejected")
+	}
+}
+
+func TestS3WriterSecondaryBucket(t *testing.T) {
+	ts := s3test.NewServer()
+	defer ts.Close()
+	s3cli := ts.NewClient()
+
+	w := NewFanOutWriter(0, NewS3Writer(s3cli),
+		NewS3WriterWithOptions(s3cli, S3WriterOptions{Bucket: "dr-bucket"}))
+	key := "v1/default/example/3.1.10_0000000000000001_etcd.backup"
+	data := []byte("etcd snapshot")
+	if _, err := w.Write(context.Background(), path.Join("bucket", key), bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	for _, bk := range []string{"bucket", "dr-bucket"} {
+		rc, err := reader.NewS3Reader(s3cli).Open(path.Join(bk, key))
+		if err != nil {
+			t.Fatalf("failed to open the backup in %s: %v", bk, err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("failed to read the backup in %s: %v", bk, err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Errorf("read %q from %s, want %q", b, bk, data)
+		}
+	}
+}
+
+func TestS3WriterStorageClass(t *testing.T) {
+	ts := s3test.NewServer()
+	defer ts.Close()
+	s3cli := ts.NewClient()
+
+	for i, sc := range []string{"", backups3.StorageClassStandard, backups3.StorageClassStandardIA,
+		backups3.StorageClassOneZoneIA, backups3.StorageClassIntelligentTiering} {
+		if err := backups3.ValidateStorageClass(sc); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		p := fmt.Sprintf("bucket/v1/default/example/3.1.10_%016x_etcd.backup", i)
+		if _, err := NewS3WriterWithOptions(s3cli, S3WriterOptions{StorageClass: sc}).Write(context.Background(), p, bytes.NewReader([]byte("etcd snapshot"))); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		bcli := backups3.NewFromClient("bucket", "sidecar", s3cli)
+		bcli.SetStorageClass(sc)
+		if err := bcli.Put(context.Background(), strconv.Itoa(i), bytes.NewReader([]byte("etcd snapshot"))); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		for _, p := range []string{p, path.Join("bucket/sidecar", strconv.Itoa(i))} {
+			if got := ts.Header(p, "X-Amz-Storage-Class"); got != sc {
+				t.Errorf("#%d: %s storage class header = %q, want %q", i, p, got, sc)
+			}
+		}
+	}
+
+	for _, sc := range []string{"GLACIER", "DEEP_ARCHIVE", "standard_ia"} {
+		if err := backups3.ValidateStorageClass(sc); err == nil || !strings.Contains(err.Error(), sc) {
+			t.Errorf("expect storage class %s to be rejected, got %v", sc, err)
+		}
+	}
+}
+
+func TestS3WriterMultipartUpload(t *testing.T) {
+	ts := s3test.NewServer()
+	defer ts.Close()
+	s3cli := ts.NewClient()
+
+	const mb = 1024 * 1024
+	tests := []struct {
+		size int
+		// failParts fails the first upload of the parts with the given status code.
+		failParts map[int]int
+		wok       bool
+	}{
+		{size: 11 * mb, wok: true},
+		// exactly two parts.
+		{size: 10 * mb, wok: true},
+		{size: 11 * mb, failParts: map[int]int{2: http.StatusServiceUnavailable}, wok: true},
+		{size: 11 * mb, failParts: map[int]int{2: http.StatusForbidden}, wok: false},
+	}
+	for i, tt := range tests {
+		data := make([]byte, tt.size)
+		rand.New(rand.NewSource(int64(i))).Read(data)
+		for num, code := range tt.failParts {
+			ts.FailPart(num, code)
+		}
+		aborted := ts.Aborted()
+
+		p := fmt.Sprintf("bucket/v1/default/example/3.1.10_%016x_etcd.backup", i)
+		w := NewS3WriterWithOptions(s3cli, S3WriterOptions{
+			StorageClass: backups3.StorageClassStandardIA,
+			PartSizeInMB: MinS3PartSizeInMB,
+		})
+		n, err := w.Write(context.Background(), p, bytes.NewReader(data))
+		if (err == nil) != tt.wok {
+			t.Fatalf("#%d: write error = %v, want ok %v", i, err, tt.wok)
+		}
+		if !tt.wok {
+			if ts.Aborted() != aborted+1 || ts.InProgress() != 0 {
+				t.Errorf("#%d: expect the multipart upload to be aborted", i)
+			}
+			continue
+		}
+		if n != int64(len(data)) {
+			t.Errorf("#%d: written size = %d, want %d", i, n, len(data))
+		}
+		if got := ts.Header(p, "X-Amz-Storage-Class"); got != backups3.StorageClassStandardIA {
+			t.Errorf("#%d: storage class header = %q, want %q", i, got, backups3.StorageClassStandardIA)
+		}
+		rc, err := reader.NewS3Reader(s3cli).Open(p)
+		if err != nil {
+			t.Fatalf("#%d: failed to open %s: %v", i, p, err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(b, data) {
+			t.Errorf("#%d: read %d bytes (%v), want the %d bytes written", i, len(b), err, len(data))
+		}
+	}
+}
+
+// cancelReader cancels the write once more than n bytes are read from r.
+type cancelReader struct {
+	r      io.Reader
+	n      int
+	cancel context.CancelFunc
+}
+
+func (cr *cancelReader) Read(p []byte) (int, error) {
+	m, err := cr.r.Read(p)
+	if cr.n -= m; cr.n < 0 {
+		cr.cancel()
+	}
+	return m, err
+}
+
+func TestS3WriterMultipartUploadCancelled(t *testing.T) {
+	ts := s3test.NewServer()
+	defer ts.Close()
+
+	const mb = 1024 * 1024
+	data := make([]byte, 11*mb)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the write is cancelled while the second part is read.
+	r := &cancelReader{r: bytes.NewReader(data), n: MinS3PartSizeInMB * mb, cancel: cancel}
+
+	w := NewS3WriterWithOptions(ts.NewClient(), S3WriterOptions{PartSizeInMB: MinS3PartSizeInMB})
+	p := "bucket/v1/default/example/3.1.10_0000000000000001_etcd.backup"
+	if _, err := w.Write(ctx, p, r); err != context.Canceled {
+		t.Fatalf("expect %v, got %v", context.Canceled, err)
+	}
+	if ts.Aborted() != 1 || ts.InProgress() != 0 {
+		t.Errorf("expect the multipart upload to be aborted")
+	}
+}
+
+func TestS3WriterMetadata(t *testing.T) {
+	ts := s3test.NewServer()
+	defer ts.Close()
+	w := NewS3Writer(ts.NewClient())
+
+	p := "bucket/v1/default/example/3.1.10_0000000000000001_etcd.backup"
+	md := map[string]string{"etcd_cluster_name": "example", "etcd_revision": "1"}
+	if _, err := WriteWithMetadata(context.Background(), w, p, bytes.NewReader([]byte("etcd snapshot")), md); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range md {
+		if got := ts.Header(p, "X-Amz-Meta-"+k); got != v {
+			t.Errorf("metadata %s = %q, want %q", k, got, v)
+		}
+	}
+	// the metadata is saved with the object, so no manifest is written.
+	if ts.HasHeaders(util.MakeManifestName(p)) {
+		t.Error("expect no manifest to be written")
+	}
+}
+
+func TestS3WriterSignedURL(t *testing.T) {
+	ts := s3test.NewServer()
+	defer ts.Close()
+
+	w := NewS3Writer(ts.NewClient())
+	p := "bucket/v1/default/example/3.1.10_0000000000000001_etcd.backup"
+	data := []byte("etcd snapshot")
+	if _, err := w.Write(context.Background(), p, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	u, err := w.(URLSigner).SignedURL(p, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(u, "X-Amz-Expires=600") {
+		t.Errorf("expect url to expire after 600s, got %s", u)
+	}
+
+	// the URL is downloaded without credentials.
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("downloaded %q, want %q", b, data)
+	}
+}
+
+func TestS3WriterCopy(t *testing.T) {
+	ts := s3test.NewServer()
+	defer ts.Close()
+	w := NewS3Writer(ts.NewClient())
+
+	// a backup name template with an RFC3339 timestamp.
+	src := "bucket/v1/default/example/3.1.10_0000000000000001_example-2017-11-03T03:04:05+02:00_etcd.backup"
+	dst := "bucket/v1/default/example/latest"
+	data := []byte("etcd snapshot")
+	if _, err := w.Write(context.Background(), src, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Copy(context.Background(), w, src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ts.Object(dst); !bytes.Equal(b, data) {
+		t.Errorf("copied %q, want %q", b, data)
+	}
+	if err := Copy(context.Background(), w, "bucket/v1/default/example/missing", dst); !os.IsNotExist(err) {
+		t.Errorf("expect a missing backup to not exist, got %v", err)
+	}
+}
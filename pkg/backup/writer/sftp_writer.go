@@ -0,0 +1,168 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"github.com/pkg/sftp"
+	"github.com/sirupsen/logrus"
+)
+
+var _ Writer = &sftpWriter{}
+
+type sftpWriter struct {
+	sftp *sftp.Client
+}
+
+// NewSFTPWriter creates a sftp writer.
+func NewSFTPWriter(sftp *sftp.Client) Writer {
+	return &sftpWriter{sftp}
+}
+
+// Write writes the backup file to the given remote path, creating its parent directories.
+// The data is first written to a hidden temporary file in the same directory, which is
+// renamed to p only after its size matches the bytes written. A failed or cancelled write
+// removes the temporary file, so no truncated file is left under a backup name.
+func (sw *sftpWriter) Write(ctx context.Context, p string, r io.Reader) (int64, error) {
+	if err := sw.mkdirAll(path.Dir(p)); err != nil {
+		return 0, fmt.Errorf("failed to create remote dir: %v", err)
+	}
+
+	tmp := path.Join(path.Dir(p), "."+path.Base(p)+".tmp")
+	n, err := sw.writeFile(ctx, tmp, r)
+	if err != nil {
+		sw.removeTmp(tmp)
+		return 0, err
+	}
+	if err = sw.rename(tmp, p); err != nil {
+		sw.removeTmp(tmp)
+		return 0, fmt.Errorf("failed to rename remote file (%s) to (%s): %v", tmp, p, err)
+	}
+	return n, nil
+}
+
+// writeFile writes r to the remote file p and checks that the size of p matches the bytes written.
+func (sw *sftpWriter) writeFile(ctx context.Context, p string, r io.Reader) (int64, error) {
+	f, err := sw.sftp.Create(p)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create remote file (%s): %v", p, err)
+	}
+	n, err := io.Copy(f, util.NewContextReader(ctx, r))
+	if err != nil {
+		f.Close()
+		return 0, fmt.Errorf("failed to write remote file (%s): %v", p, err)
+	}
+	if err = f.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close remote file (%s): %v", p, err)
+	}
+
+	fi, err := sw.sftp.Stat(p)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat remote file (%s): %v", p, err)
+	}
+	if fi.Size() != n {
+		return 0, fmt.Errorf("remote file (%s) size %d does not match %d bytes written", p, fi.Size(), n)
+	}
+	return n, nil
+}
+
+// rename renames the remote file from to to. SFTP servers may refuse to rename over an
+// existing file, in which case to is removed and the rename is retried.
+func (sw *sftpWriter) rename(from, to string) error {
+	err := sw.sftp.Rename(from, to)
+	if err == nil {
+		return nil
+	}
+	if _, serr := sw.sftp.Stat(to); serr != nil {
+		return err
+	}
+	if err = sw.sftp.Remove(to); err != nil {
+		return err
+	}
+	return sw.sftp.Rename(from, to)
+}
+
+// removeTmp removes the temporary file of a failed write.
+func (sw *sftpWriter) removeTmp(tmp string) {
+	if err := sw.sftp.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		logrus.Warningf("failed to remove remote file (%s): %v", tmp, err)
+	}
+}
+
+// List lists the backup files whose remote path starts with prefix.
+func (sw *sftpWriter) List(prefix string) ([]string, error) {
+	root := prefix
+	if !strings.HasSuffix(prefix, "/") {
+		root = path.Dir(prefix)
+	}
+
+	var paths []string
+	walker := sw.sftp.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == root && os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if walker.Stat().IsDir() {
+			continue
+		}
+		if p := walker.Path(); strings.HasPrefix(p, prefix) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Delete deletes the backup file at the given remote path.
+func (sw *sftpWriter) Delete(p string) error {
+	err := sw.sftp.Remove(p)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove remote file (%s): %v", p, err)
+	}
+	return nil
+}
+
+// mkdirAll creates the remote directory dir along with any missing parents.
+func (sw *sftpWriter) mkdirAll(dir string) error {
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	fi, err := sw.sftp.Stat(dir)
+	if err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if err = sw.mkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+	return sw.sftp.Mkdir(dir)
+}
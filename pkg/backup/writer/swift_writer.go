@@ -0,0 +1,144 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+
+	"github.com/ncw/swift"
+	"github.com/sirupsen/logrus"
+)
+
+// swiftSegmentSize is the size of each segment of a Dynamic Large Object.
+// It must not exceed the 5GB object size limit of Swift.
+var swiftSegmentSize int64 = 1024 * 1024 * 1024
+
+var _ Writer = &swiftWriter{}
+
+type swiftWriter struct {
+	swift *swift.Connection
+}
+
+// NewSwiftWriter creates a swift writer.
+func NewSwiftWriter(swift *swift.Connection) Writer {
+	return &swiftWriter{swift}
+}
+
+// Write writes the backup file to the given swift path, "<swift-container-name>/<key>".
+// Since the snapshot size is not known in advance, the backup is always written as a
+// Dynamic Large Object so that snapshots bigger than 5GB are supported.
+// The segments are stored in the "<swift-container-name>_segments" container.
+// If the upload fails or ctx is cancelled, the manifest is not written and the segments uploaded so far are deleted,
+// so that no truncated backup is left under path.
+func (sw *swiftWriter) Write(ctx context.Context, path string, r io.Reader) (int64, error) {
+	container, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, _, err = sw.swift.Container(container); err != nil {
+		if err == swift.ContainerNotFound {
+			return 0, fmt.Errorf("swift container (%s) not found", container)
+		}
+		return 0, err
+	}
+
+	// the segments of each upload have their own prefix, so that those of a failed upload can be found
+	// without its manifest.
+	segmentContainer := container + "_segments"
+	segmentPrefix := "segments/" + key + "/" + strconv.FormatInt(time.Now().UnixNano(), 16)
+	f, err := sw.swift.DynamicLargeObjectCreateFile(&swift.LargeObjectOpts{
+		Container:        container,
+		ObjectName:       key,
+		SegmentContainer: segmentContainer,
+		SegmentPrefix:    segmentPrefix,
+		ChunkSize:        swiftSegmentSize,
+		ContentType:      "application/octet-stream",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create swift object: %v", err)
+	}
+	n, err := io.Copy(f, util.NewContextReader(ctx, r))
+	if err != nil {
+		// closing f would write the manifest, which commits the truncated upload.
+		sw.deleteUpload(container, key, segmentContainer, segmentPrefix)
+		return 0, err
+	}
+	if err = f.Close(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// List lists the backup files under the given swift prefix, "<swift-container-name>/<key-prefix>".
+func (sw *swiftWriter) List(prefix string) ([]string, error) {
+	container, key, err := util.ParseBucketAndKey(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// ObjectNamesAll pages through the listing until all names are returned.
+	names, err := sw.swift.ObjectNamesAll(container, &swift.ObjectsOpts{Prefix: key})
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(names))
+	for _, n := range names {
+		paths = append(paths, path.Join(container, n))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// deleteUpload deletes the segments of a failed upload under segmentPrefix, and the object at key
+// in case the manifest was written. Failing to delete them is only logged.
+func (sw *swiftWriter) deleteUpload(container, key, segmentContainer, segmentPrefix string) {
+	if err := sw.swift.DynamicLargeObjectDelete(container, key); err != nil && err != swift.ObjectNotFound {
+		logrus.Warningf("failed to delete swift object (%s/%s) of failed upload: %v", container, key, err)
+	}
+	names, err := sw.swift.ObjectNamesAll(segmentContainer, &swift.ObjectsOpts{Prefix: segmentPrefix + "/"})
+	if err != nil {
+		logrus.Warningf("failed to list segments (%s/%s) of failed upload: %v", segmentContainer, segmentPrefix, err)
+		return
+	}
+	for _, n := range names {
+		if err := sw.swift.ObjectDelete(segmentContainer, n); err != nil && err != swift.ObjectNotFound {
+			logrus.Warningf("failed to delete segment (%s/%s) of failed upload: %v", segmentContainer, n, err)
+		}
+	}
+}
+
+// Delete deletes the backup file at the given swift path, "<swift-container-name>/<key>",
+// along with its segments.
+func (sw *swiftWriter) Delete(path string) error {
+	container, key, err := util.ParseBucketAndKey(path)
+	if err != nil {
+		return err
+	}
+
+	err = sw.swift.DynamicLargeObjectDelete(container, key)
+	if err != nil && err != swift.ObjectNotFound {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ncw/swift"
+	"github.com/ncw/swift/swifttest"
+)
+
+// halfReader returns the first n bytes of data, then fails.
+type halfReader struct {
+	data []byte
+	n    int
+}
+
+var errHalfReader = errors.New("snapshot stream broken")
+
+func (hr *halfReader) Read(p []byte) (int, error) {
+	if hr.n == 0 {
+		return 0, errHalfReader
+	}
+	if len(p) > hr.n {
+		p = p[:hr.n]
+	}
+	m := copy(p, hr.data)
+	hr.data, hr.n = hr.data[m:], hr.n-m
+	return m, nil
+}
+
+func newSwiftTestConnection(t *testing.T, containers ...string) (*swift.Connection, func()) {
+	srv, err := swifttest.NewSwiftServer("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &swift.Connection{
+		UserName:    swifttest.TEST_ACCOUNT,
+		ApiKey:      swifttest.TEST_ACCOUNT,
+		AuthUrl:     srv.AuthURL,
+		AuthVersion: 1,
+		Timeout:     time.Second,
+		Transport:   new(http.Transport),
+	}
+	if err = conn.Authenticate(); err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	for _, c := range containers {
+		if err = conn.ContainerCreate(c, nil); err != nil {
+			srv.Close()
+			t.Fatal(err)
+		}
+	}
+	return conn, srv.Close
+}
+
+func TestSwiftWriterWrite(t *testing.T) {
+	defer func(n int64) { swiftSegmentSize = n }(swiftSegmentSize)
+	swiftSegmentSize = 1024
+
+	conn, cleanup := newSwiftTestConnection(t, "bk", "bk_segments")
+	defer cleanup()
+	w := NewSwiftWriter(conn)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 200)
+	n, err := w.Write(context.Background(), "bk/v1/default/example/3.1.8_0000000000000001_etcd.backup", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("written = %d, want %d", n, len(data))
+	}
+	rc, _, err := conn.ObjectOpen("bk", "v1/default/example/3.1.8_0000000000000001_etcd.backup", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("read %d bytes back, want the %d bytes written", len(got), len(data))
+	}
+}
+
+// TestSwiftWriterWriteFailed ensures a failed upload leaves neither the object nor its segments behind.
+func TestSwiftWriterWriteFailed(t *testing.T) {
+	defer func(n int64) { swiftSegmentSize = n }(swiftSegmentSize)
+	swiftSegmentSize = 1024
+
+	conn, cleanup := newSwiftTestConnection(t, "bk", "bk_segments")
+	defer cleanup()
+	w := NewSwiftWriter(conn)
+
+	// the reader fails after more than two segments.
+	data := bytes.Repeat([]byte("0123456789abcdef"), 200)
+	r := &halfReader{data: data, n: len(data) / 2}
+	if _, err := w.Write(context.Background(), "bk/v1/default/example/3.1.8_0000000000000001_etcd.backup", r); err != errHalfReader {
+		t.Fatalf("error = %v, want %v", err, errHalfReader)
+	}
+	names, err := conn.ObjectNamesAll("bk", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("objects = %v, want none", names)
+	}
+	if names, err = conn.ObjectNamesAll("bk_segments", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("segments = %v, want none", names)
+	}
+}
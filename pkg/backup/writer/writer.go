@@ -14,10 +14,126 @@
 
 package writer
 
-import "io"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
 
 // Writer defines the required writer operations.
 type Writer interface {
 	// Write writes a backup file to the given path and returns size of written file.
-	Write(path string, r io.Reader) (int64, error)
+	// The write is abandoned if ctx is cancelled, without leaving a partial file behind where possible.
+	Write(ctx context.Context, path string, r io.Reader) (int64, error)
+
+	// List returns the paths of the files whose path starts with the given prefix, sorted by name.
+	// The paths are in the same format as the path given to Write.
+	List(prefix string) ([]string, error)
+
+	// Delete deletes the file at the given path.
+	// Deleting a file that does not exist is not an error.
+	Delete(path string) error
+}
+
+// MetadataWriter is implemented by the writers which save metadata along with the files they write,
+// e.g. as object metadata.
+type MetadataWriter interface {
+	// WriteWithMetadata writes a backup file with the given metadata to the given path
+	// and returns size of written file.
+	WriteWithMetadata(ctx context.Context, path string, r io.Reader, md map[string]string) (int64, error)
+}
+
+// ModTimeLister is implemented by the writers which can tell when the files they wrote were last modified.
+// Backups are never modified once written, so it is when they were created.
+type ModTimeLister interface {
+	// ListModTimes returns the last modified time of the files whose path starts with the given prefix,
+	// keyed by path in the same format as List.
+	ListModTimes(prefix string) (map[string]time.Time, error)
+}
+
+// Opener is implemented by the writers which can read back the files they wrote.
+type Opener interface {
+	// Open opens the file at the given path for reading.
+	// os.IsNotExist(err) is true if the file does not exist.
+	Open(path string) (io.ReadCloser, error)
+}
+
+// Copier is implemented by the writers which can copy the files they wrote without reading them back,
+// e.g. on the storage server.
+type Copier interface {
+	// Copy copies the file at src to dst, replacing dst if it exists.
+	Copy(ctx context.Context, src, dst string) error
+}
+
+// URLSigner is implemented by the writers which can generate URLs to download the files they wrote
+// without credentials, e.g. pre-signed S3 URLs.
+type URLSigner interface {
+	// SignedURL returns a URL to download the file at the given path which expires after ttl.
+	SignedURL(path string, ttl time.Duration) (string, error)
+}
+
+// Pinger is implemented by the writers which can check cheaply, without writing anything, that their storage
+// is reachable and accepts their credentials, e.g. with a HEAD request on the bucket.
+type Pinger interface {
+	// Ping checks the storage the files under the given prefix are written to.
+	Ping(ctx context.Context, prefix string) error
+}
+
+// Ping checks the storage the files under the given prefix of w are written to.
+// It returns nil if w can't check its storage.
+func Ping(ctx context.Context, w Writer, prefix string) error {
+	if p, ok := w.(Pinger); ok {
+		return p.Ping(ctx, prefix)
+	}
+	return nil
+}
+
+// WriteWithMetadata writes a backup file with the given metadata to the given path of w.
+// If w can't save metadata with the file, the metadata is written to the JSON manifest
+// named by util.MakeManifestName instead.
+func WriteWithMetadata(ctx context.Context, w Writer, path string, r io.Reader, md map[string]string) (int64, error) {
+	if mw, ok := w.(MetadataWriter); ok {
+		return mw.WriteWithMetadata(ctx, path, r, md)
+	}
+	n, err := w.Write(ctx, path, r)
+	if err != nil {
+		return n, err
+	}
+	b, err := json.Marshal(md)
+	if err != nil {
+		return n, err
+	}
+	if _, err = w.Write(ctx, util.MakeManifestName(path), bytes.NewReader(b)); err != nil {
+		return n, fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return n, nil
+}
+
+// Copy copies the file at src of w to dst, replacing dst if it exists.
+// If w can't copy files itself, the file is read back and written to dst.
+func Copy(ctx context.Context, w Writer, src, dst string) error {
+	if c, ok := w.(Copier); ok {
+		return c.Copy(ctx, src, dst)
+	}
+	o, ok := w.(Opener)
+	if !ok {
+		return errors.New("writer can neither copy nor read back backups")
+	}
+	rc, err := o.Open(src)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	// writers may keep a file that already exists, e.g. the PV writer.
+	if err = w.Delete(dst); err != nil && !IsPartialWrite(err) {
+		return err
+	}
+	_, err = w.Write(ctx, dst, rc)
+	return err
 }
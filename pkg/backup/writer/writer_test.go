@@ -0,0 +1,60 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+)
+
+// TestWriteWithMetadataManifest ensures the metadata is written to a manifest by the writers
+// which can't save it with the backup, including the secondaries of a fan-out writer.
+func TestWriteWithMetadataManifest(t *testing.T) {
+	md := &backupapi.BackupMetadata{
+		ClusterName:       "example",
+		Namespace:         "default",
+		ClusterUID:        "2f3c5e4a",
+		EtcdVersion:       "3.1.10",
+		Revision:          1,
+		CreationTimestamp: time.Date(2017, 12, 1, 0, 0, 0, 0, time.UTC),
+	}
+	data := []byte("etcd snapshot")
+	primary, secondary := NewFakeWriter(), NewFakeWriter()
+	for _, w := range []Writer{primary, NewFanOutWriter(time.Second, secondary)} {
+		if _, err := WriteWithMetadata(context.Background(), w, testPath, bytes.NewReader(data), md.ToMap()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, fw := range []*FakeWriter{primary, secondary} {
+		checkWritten(t, fw, data)
+		b, ok := fw.Get(util.MakeManifestName(testPath))
+		if !ok {
+			t.Fatal("manifest not written")
+		}
+		got, err := backupapi.ParseBackupManifest(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != *md {
+			t.Errorf("manifest = %+v, want %+v", got, md)
+		}
+	}
+}
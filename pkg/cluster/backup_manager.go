@@ -16,6 +16,7 @@ package cluster
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -50,15 +51,22 @@ type backupManager struct {
 	cluster *api.EtcdCluster
 	s       backupstorage.Storage
 
+	// tlsConfig is the TLS config of the operator secret of the cluster, or nil if the cluster doesn't use TLS.
+	// It is the client certificate of the backup sidecar if the sidecar requires one.
+	tlsConfig *tls.Config
+
 	bc experimentalclient.Backup
 }
 
-func newBackupManager(c Config, cl *api.EtcdCluster, l *logrus.Entry) (*backupManager, error) {
+// newBackupManager creates a backupManager. tc is the TLS config of the operator secret of the cluster,
+// or nil if the cluster doesn't use TLS.
+func newBackupManager(c Config, cl *api.EtcdCluster, tc *tls.Config, l *logrus.Entry) (*backupManager, error) {
 	bm := &backupManager{
-		config:  c,
-		cluster: cl,
-		logger:  l,
-		bc:      experimentalclient.NewBackup(&http.Client{}, "http", cl.GetName()),
+		config:    c,
+		cluster:   cl,
+		logger:    l,
+		tlsConfig: tc,
+		bc:        newBackupClient(cl, tc),
 	}
 	var err error
 	bm.s, err = bm.setupStorage()
@@ -68,6 +76,15 @@ func newBackupManager(c Config, cl *api.EtcdCluster, l *logrus.Entry) (*backupMa
 	return bm, nil
 }
 
+// newBackupClient returns the client of the HTTP API of the backup sidecar of the given cluster,
+// which uses the client certificate of tc if the sidecar requires one.
+func newBackupClient(cl *api.EtcdCluster, tc *tls.Config) experimentalclient.Backup {
+	if cl.Spec.Backup.HTTPClientCertAuth {
+		return experimentalclient.NewBackup(&http.Client{Transport: &http.Transport{TLSClientConfig: tc}}, "https", cl.GetName())
+	}
+	return experimentalclient.NewBackup(&http.Client{}, "http", cl.GetName())
+}
+
 // setupStorage will only set up the necessary structs in order for backup manager to
 // use the storage. It doesn't creates the actual storage here.
 func (bm *backupManager) setupStorage() (s backupstorage.Storage, err error) {
@@ -117,6 +134,9 @@ func (bm *backupManager) setup() error {
 }
 
 func (bm *backupManager) runSidecar() error {
+	if err := bm.setupRBAC(); err != nil {
+		return fmt.Errorf("failed to create backup sidecar RBAC: %v", err)
+	}
 	if err := bm.createSidecarDeployment(); err != nil {
 		return fmt.Errorf("failed to create backup sidecar Deployment: %v", err)
 	}
@@ -127,6 +147,24 @@ func (bm *backupManager) runSidecar() error {
 	return nil
 }
 
+// setupRBAC creates the ServiceAccount of the backup sidecar and grants it the permissions the sidecar needs,
+// if the operator generates per cluster RBAC. Otherwise the sidecar runs with the ServiceAccount of the operator.
+func (bm *backupManager) setupRBAC() error {
+	if !bm.config.GeneratePerClusterRBAC {
+		return nil
+	}
+	cl := bm.cluster
+	return k8sutil.CreateBackupSidecarRBAC(bm.config.KubeCli, cl.Name, cl.Namespace, cl.Spec, cl.AsOwner())
+}
+
+// serviceAccount returns the ServiceAccount the backup sidecar runs with.
+func (bm *backupManager) serviceAccount() string {
+	if bm.config.GeneratePerClusterRBAC {
+		return k8sutil.BackupSidecarServiceAccountName(bm.cluster.Name)
+	}
+	return bm.config.ServiceAccount
+}
+
 func (bm *backupManager) createSidecarDeployment() error {
 	d := bm.makeSidecarDeployment()
 	_, err := bm.config.KubeCli.AppsV1beta1().Deployments(bm.cluster.Namespace).Create(d)
@@ -136,6 +174,7 @@ func (bm *backupManager) createSidecarDeployment() error {
 func (bm *backupManager) updateSidecar(cl *api.EtcdCluster) error {
 	// change local structs
 	bm.cluster = cl
+	bm.bc = newBackupClient(cl, bm.tlsConfig)
 	var err error
 	bm.s, err = bm.setupStorage()
 	if err != nil {
@@ -143,6 +182,10 @@ func (bm *backupManager) updateSidecar(cl *api.EtcdCluster) error {
 	}
 	ns, n := cl.Namespace, k8sutil.BackupSidecarName(cl.Name)
 	// change k8s objects
+	// the permissions of the sidecar follow the secrets and the features of the backup policy.
+	if err := bm.setupRBAC(); err != nil {
+		return fmt.Errorf("failed to update backup sidecar RBAC: %v", err)
+	}
 	uf := func(d *appsv1beta1.Deployment) {
 		d.Spec = bm.makeSidecarDeployment().Spec
 	}
@@ -151,7 +194,7 @@ func (bm *backupManager) updateSidecar(cl *api.EtcdCluster) error {
 
 func (bm *backupManager) makeSidecarDeployment() *appsv1beta1.Deployment {
 	cl := bm.cluster
-	podTemplate := k8sutil.NewBackupPodTemplate(cl.Name, bm.config.ServiceAccount, cl.Spec)
+	podTemplate := k8sutil.NewBackupPodTemplate(cl.Name, bm.serviceAccount(), cl.Spec)
 	switch cl.Spec.Backup.StorageType {
 	case api.BackupStorageTypeDefault, api.BackupStorageTypePersistentVolume:
 		k8sutil.PodSpecWithPV(&podTemplate.Spec, cl.Name)
@@ -257,6 +300,12 @@ func (bm *backupManager) deleteBackupSidecar() error {
 		return fmt.Errorf("backup manager deletion: failed to delete backup sidecar deployment: %v", err)
 	}
 
+	if bm.config.GeneratePerClusterRBAC {
+		if err := k8sutil.DeleteBackupSidecarRBAC(bm.config.KubeCli, bm.cluster.Name, ns); err != nil {
+			return fmt.Errorf("backup manager deletion: failed to delete backup sidecar RBAC: %v", err)
+		}
+	}
+
 	if err := bm.cleanup(); err != nil {
 		return fmt.Errorf("backup manager deletion: %v", err)
 	}
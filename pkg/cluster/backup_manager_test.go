@@ -15,11 +15,15 @@
 package cluster
 
 import (
+	"reflect"
 	"testing"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 )
 
 func TestNewBackupManagerWithoutS3Config(t *testing.T) {
@@ -33,7 +37,7 @@ func TestNewBackupManagerWithoutS3Config(t *testing.T) {
 			},
 		},
 	}
-	_, err := newBackupManager(cfg, cl, nil)
+	_, err := newBackupManager(cfg, cl, nil, nil)
 	if err != errNoS3ConfigForBackup {
 		t.Errorf("expect err=%v, get=%v", errNoS3ConfigForBackup, err)
 	}
@@ -50,8 +54,93 @@ func TestNewBackupManagerWithoutABSCreds(t *testing.T) {
 			},
 		},
 	}
-	_, err := newBackupManager(cfg, cl, nil)
+	_, err := newBackupManager(cfg, cl, nil, nil)
 	if err != errNoABSCredsForBackup {
 		t.Errorf("expect err=%v, get=%v", errNoABSCredsForBackup, err)
 	}
 }
+
+func TestBackupServiceStatusConversion(t *testing.T) {
+	s := &backupapi.ServiceStatus{
+		RecentBackup: &backupapi.BackupStatus{
+			CreationTime: "2017-12-01T00:00:00Z",
+			Size:         1.5,
+			Revision:     10,
+			Version:      "3.1.10",
+		},
+		Backups:         2,
+		BackupSize:      3,
+		LastBackupError: "failed to save snapshot",
+	}
+	bs := backupServiceStatusToTPRBackupServiceStatu(s)
+	if bs.Backups != s.Backups || bs.BackupSize != s.BackupSize {
+		t.Errorf("expect backups=%d size=%v, get backups=%d size=%v", s.Backups, s.BackupSize, bs.Backups, bs.BackupSize)
+	}
+	if bs.LastBackupError != s.LastBackupError {
+		t.Errorf("expect last backup error=%q, get=%q", s.LastBackupError, bs.LastBackupError)
+	}
+	if bs.RecentBackup == nil || bs.RecentBackup.Revision != s.RecentBackup.Revision {
+		t.Errorf("expect recent backup=%+v, get=%+v", s.RecentBackup, bs.RecentBackup)
+	}
+}
+
+func TestBackupSidecarRBAC(t *testing.T) {
+	kubecli := fake.NewSimpleClientset()
+	cl := &api.EtcdCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "testing", Namespace: "default"},
+		Spec: api.ClusterSpec{
+			Backup: &api.BackupPolicy{StorageType: api.BackupStorageTypePersistentVolume, PV: &api.PVSource{VolumeSizeInMB: 512}},
+		},
+	}
+	bm := &backupManager{config: Config{ServiceAccount: "etcd-operator", KubeCli: kubecli}, cluster: cl}
+	if sa := bm.makeSidecarDeployment().Spec.Template.Spec.ServiceAccountName; sa != "etcd-operator" {
+		t.Errorf("expect the sidecar to run with the operator service account, get %s", sa)
+	}
+
+	bm.config.GeneratePerClusterRBAC = true
+	if err := bm.setupRBAC(); err != nil {
+		t.Fatal(err)
+	}
+	name := k8sutil.BackupSidecarServiceAccountName(cl.Name)
+	if sa := bm.makeSidecarDeployment().Spec.Template.Spec.ServiceAccountName; sa != name {
+		t.Errorf("expect the sidecar to run with service account %s, get %s", name, sa)
+	}
+	if _, err := kubecli.CoreV1().ServiceAccounts("default").Get(name, metav1.GetOptions{}); err != nil {
+		t.Errorf("expect the service account to be created: %v", err)
+	}
+	rb, err := kubecli.RbacV1().RoleBindings("default").Get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expect the role binding to be created: %v", err)
+	}
+	if rb.RoleRef.Name != name || len(rb.Subjects) != 1 || rb.Subjects[0].Name != name {
+		t.Errorf("expect the role binding to grant role %s to service account %s, get %+v", name, name, rb)
+	}
+	role, err := kubecli.RbacV1().Roles("default").Get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range role.Rules {
+		for _, res := range r.Resources {
+			if res == "secrets" || res == "configmaps" {
+				t.Errorf("expect no access to %s without TLS, encryption or metadata, get %+v", res, r)
+			}
+		}
+	}
+
+	// the rules of the role follow the backup policy.
+	cl.Spec.Backup.AuthSecret = "etcd-auth"
+	if err := bm.setupRBAC(); err != nil {
+		t.Fatal(err)
+	}
+	role, err = kubecli.RbacV1().Roles("default").Get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := k8sutil.NewBackupSidecarRole(cl.Name, cl.Spec, cl.AsOwner()).Rules; !reflect.DeepEqual(role.Rules, want) {
+		t.Errorf("expect rules %+v, get %+v", want, role.Rules)
+	}
+	last := role.Rules[len(role.Rules)-1]
+	if !reflect.DeepEqual(last.ResourceNames, []string{"etcd-auth"}) {
+		t.Errorf("expect the role to read the auth secret only, get %+v", last)
+	}
+}
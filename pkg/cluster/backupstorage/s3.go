@@ -34,13 +34,23 @@ type s3 struct {
 }
 
 func NewS3Storage(kubecli kubernetes.Interface, clusterName, ns string, p api.BackupPolicy) (Storage, error) {
-	cli, err := s3factory.NewClientFromSecret(kubecli, ns, p.S3.AWSSecret)
+	sse, err := backups3.NewSSE(p.S3.SSE, p.S3.SSEKMSKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err = backups3.ValidateStorageClass(p.S3.StorageClass); err != nil {
+		return nil, err
+	}
+	cli, err := s3factory.NewClient(kubecli, ns, p.S3)
 	if err != nil {
 		return nil, err
 	}
 
 	prefix := backupapi.ToS3Prefix(p.S3.Prefix, ns, clusterName)
 	s3cli := backups3.NewFromClient(p.S3.S3Bucket, prefix, cli.S3)
+	// cloned backups are encrypted and stored like the backups saved by the sidecar.
+	s3cli.SetSSE(sse)
+	s3cli.SetStorageClass(p.S3.StorageClass)
 
 	s := &s3{
 		kubecli:      kubecli,
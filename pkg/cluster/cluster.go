@@ -15,6 +15,7 @@
 package cluster
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -25,6 +26,7 @@ import (
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
 	"github.com/coreos/etcd-operator/pkg/debug"
 	"github.com/coreos/etcd-operator/pkg/garbagecollection"
@@ -61,6 +63,16 @@ type clusterEvent struct {
 type Config struct {
 	ServiceAccount string
 
+	// MemberFailureThreshold is how long a member's pod can stay pending before the member is replaced.
+	// Zero disables the replacement.
+	MemberFailureThreshold time.Duration
+	// MaxConcurrentReplacements is the max number of failed members being replaced at the same time.
+	MaxConcurrentReplacements int
+
+	// GeneratePerClusterRBAC tells whether the backup sidecar of each cluster runs with a ServiceAccount of its own,
+	// granted only the permissions the sidecar needs by a Role in the namespace of the cluster, instead of ServiceAccount.
+	GeneratePerClusterRBAC bool
+
 	KubeCli   kubernetes.Interface
 	EtcdCRCli versioned.Interface
 }
@@ -86,6 +98,8 @@ type Cluster struct {
 	// the name of the member is the the name of the pod the member
 	// process runs in.
 	members etcdutil.MemberSet
+	// expandingMembers are the members whose PersistentVolumeClaim is not expanded to spec.storage.requestedSize yet.
+	expandingMembers map[string]bool
 
 	bm *backupManager
 
@@ -93,6 +107,8 @@ type Cluster struct {
 
 	gc *garbagecollection.GC
 
+	failureHandler *MemberFailureHandler
+
 	eventsCli corev1.EventInterface
 }
 
@@ -113,6 +129,8 @@ func New(config Config, cl *api.EtcdCluster) *Cluster {
 		status:      *(cl.Status.DeepCopy()),
 		gc:          garbagecollection.New(config.KubeCli, cl.Namespace),
 		eventsCli:   config.KubeCli.Core().Events(cl.Namespace),
+
+		failureHandler: NewMemberFailureHandler(config.MemberFailureThreshold, config.MaxConcurrentReplacements),
 	}
 
 	go func() {
@@ -160,7 +178,7 @@ func (c *Cluster) setup() error {
 	}
 
 	if c.cluster.Spec.Backup != nil {
-		c.bm, err = newBackupManager(c.config, c.cluster, c.logger)
+		c.bm, err = newBackupManager(c.config, c.cluster, c.tlsConfig, c.logger)
 		if err != nil {
 			return err
 		}
@@ -185,6 +203,7 @@ func (c *Cluster) create() error {
 		return fmt.Errorf("cluster create: failed to update cluster phase (%v): %v", api.ClusterPhaseCreating, err)
 	}
 	c.logClusterCreation()
+	c.checkTopologySpread()
 
 	c.gc.CollectCluster(c.cluster.Name, c.cluster.UID)
 
@@ -298,6 +317,17 @@ func (c *Cluster) run() {
 				continue
 			}
 
+			// Pods stuck in pending, e.g. after a crash, would block the reconciliation forever.
+			replaced, err := c.replaceFailedMembers(running, pending)
+			if err != nil {
+				c.logger.Errorf("fail to replace failed members: %v", err)
+				reconcileFailed.WithLabelValues("failed to replace failed members").Inc()
+				continue
+			}
+			if replaced {
+				continue
+			}
+
 			if len(pending) > 0 {
 				// Pod startup might take long, e.g. pulling image. It would deterministically become running or succeeded/failed later.
 				c.logger.Infof("skip reconciliation: running (%v), pending (%v)", k8sutil.GetPodNames(running), k8sutil.GetPodNames(pending))
@@ -328,6 +358,9 @@ func (c *Cluster) run() {
 				break
 			}
 
+			if err := c.reconcilePDB(); err != nil {
+				c.logger.Warningf("failed to reconcile PodDisruptionBudget: %v", err)
+			}
 			if err := c.updateLocalBackupStatus(); err != nil {
 				c.logger.Warningf("failed to update local backup service status: %v", err)
 			}
@@ -365,6 +398,9 @@ func (c *Cluster) handleUpdateEvent(event *clusterEvent) error {
 	// TODO: we can't handle another upgrade while an upgrade is in progress
 
 	c.logSpecUpdate(*oldSpec, event.cluster.Spec)
+	if event.cluster.Spec.Size != oldSpec.Size {
+		c.checkTopologySpread()
+	}
 
 	ob, nb := oldSpec.Backup, event.cluster.Spec.Backup
 	if !isBackupPolicyEqual(ob, nb) {
@@ -380,7 +416,7 @@ func (c *Cluster) updateBackupPolicy(ob, nb *api.BackupPolicy) error {
 	var err error
 	switch {
 	case ob == nil && nb != nil:
-		c.bm, err = newBackupManager(c.config, c.cluster, c.logger)
+		c.bm, err = newBackupManager(c.config, c.cluster, c.tlsConfig, c.logger)
 		if err != nil {
 			return err
 		}
@@ -476,12 +512,23 @@ func (c *Cluster) setupServices() error {
 }
 
 func (c *Cluster) createPod(members etcdutil.MemberSet, m *etcdutil.Member, state string, needRecovery bool) error {
+	if ss := c.cluster.Spec.Storage; ss != nil {
+		pvc := k8sutil.NewEtcdPVC(m, c.cluster.Name, ss, c.cluster.AsOwner())
+		if err := k8sutil.CreateEtcdPVC(c.config.KubeCli, c.cluster.Namespace, pvc); err != nil {
+			return fmt.Errorf("fail to create PVC (%s): %v", pvc.Name, err)
+		}
+	}
+
 	var pod *v1.Pod
 	if state == "new" {
 		var backupURL *url.URL
 		if needRecovery {
 			serviceAddr := k8sutil.BackupServiceAddr(c.cluster.Name)
-			backupURL = backupapi.NewBackupURL("http", serviceAddr, c.cluster.Spec.Version, -1)
+			scheme := "http"
+			if b := c.cluster.Spec.Backup; b != nil && b.HTTPClientCertAuth {
+				scheme = "https"
+			}
+			backupURL = backupapi.NewBackupURL(scheme, serviceAddr, c.cluster.Spec.Version, -1)
 		}
 		pod = k8sutil.NewSeedMemberPod(c.cluster.Name, members, m, c.cluster.Spec, c.cluster.AsOwner(), backupURL)
 	} else {
@@ -506,6 +553,10 @@ func (c *Cluster) removePod(name string) error {
 	if c.isDebugLoggerEnabled() {
 		c.debugLogger.LogPodDeletion(name)
 	}
+	// The data of a deleted pod is never reused: its member is replaced by a new member with a new name.
+	if err := k8sutil.DeleteEtcdPVC(c.config.KubeCli, ns, name); err != nil {
+		return fmt.Errorf("fail to delete PVC of pod (%s): %v", name, err)
+	}
 	return nil
 }
 
@@ -537,15 +588,25 @@ func (c *Cluster) pollPods() (running, pending []*v1.Pod, err error) {
 	return running, pending, nil
 }
 
+// updateMemberStatus reports the members reachable by the member discovery of the backups as ready,
+// unless their storage is still being expanded.
 func (c *Cluster) updateMemberStatus(members etcdutil.MemberSet) {
+	bm := backup.NewBackupManagerWithLogger(c.config.KubeCli, c.cluster.Name, c.cluster.Namespace, c.tlsConfig, nil, c.logger)
+	infos, err := bm.ListMembers(context.Background())
+	if err != nil {
+		c.logger.Warningf("failed to list members: %v", err)
+	}
+	reachable := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		reachable[info.Name] = info.Reachable
+		if !info.Reachable {
+			c.logger.Warningf("health check of etcd member (%s) failed: %v", info.ClientURL(), info.Err)
+		}
+	}
+
 	var ready, unready []string
 	for _, m := range members {
-		url := m.ClientURL()
-		healthy, err := etcdutil.CheckHealth(url, c.tlsConfig)
-		if err != nil {
-			c.logger.Warningf("health check of etcd member (%s) failed: %v", url, err)
-		}
-		if healthy {
+		if reachable[m.Name] && !c.expandingMembers[m.Name] {
 			ready = append(ready, m.Name)
 		} else {
 			unready = append(unready, m.Name)
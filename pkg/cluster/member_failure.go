@@ -0,0 +1,181 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+)
+
+// MemberFailureHandler detects the members whose pods have not been running for longer than
+// FailureThreshold, e.g. pods stuck in pending after a crash, so that they can be replaced
+// without manual intervention.
+//
+// The replacements join as voting members, like any member added by the operator.
+type MemberFailureHandler struct {
+	// FailureThreshold is how long a member's pod can stay not running before the member is considered failed.
+	// Zero disables the detection.
+	FailureThreshold time.Duration
+	// MaxConcurrentReplacements is the max number of failed members being replaced at the same time.
+	MaxConcurrentReplacements int
+
+	// notRunningSince records when the pod of each member was first seen not running.
+	notRunningSince map[string]time.Time
+	// removed is the number of failed members removed whose replacements have not been added yet.
+	removed int
+	// adding records the replacement members added whose pods have not been running yet.
+	adding map[string]bool
+}
+
+// NewMemberFailureHandler returns a MemberFailureHandler.
+// It replaces one member at a time if maxConcurrentReplacements is not positive.
+func NewMemberFailureHandler(failureThreshold time.Duration, maxConcurrentReplacements int) *MemberFailureHandler {
+	if maxConcurrentReplacements <= 0 {
+		maxConcurrentReplacements = 1
+	}
+	return &MemberFailureHandler{
+		FailureThreshold:          failureThreshold,
+		MaxConcurrentReplacements: maxConcurrentReplacements,
+		notRunningSince:           make(map[string]time.Time),
+		adding:                    make(map[string]bool),
+	}
+}
+
+// Observe records the pods that are not running at now, and returns the names of the members whose pods
+// have not been running for longer than FailureThreshold, oldest failure first.
+// missing is the number of members the cluster is short of its size; removed members beyond it
+// are not going to be replaced, e.g. after the cluster is scaled down.
+// At most MaxConcurrentReplacements-Replacing() names are returned.
+func (h *MemberFailureHandler) Observe(notRunning []*v1.Pod, missing int, now time.Time) []string {
+	if h.FailureThreshold <= 0 {
+		return nil
+	}
+
+	seen := make(map[string]time.Time, len(notRunning))
+	for _, pod := range notRunning {
+		since, ok := h.notRunningSince[pod.Name]
+		if !ok {
+			since = now
+		}
+		seen[pod.Name] = since
+	}
+	// forget the pods which are running or gone.
+	h.notRunningSince = seen
+	for name := range h.adding {
+		if _, ok := seen[name]; !ok {
+			delete(h.adding, name)
+		}
+	}
+	if h.removed > missing {
+		h.removed = missing
+	}
+
+	var failed []string
+	for name, since := range seen {
+		if now.Sub(since) > h.FailureThreshold {
+			failed = append(failed, name)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		ti, tj := seen[failed[i]], seen[failed[j]]
+		if ti.Equal(tj) {
+			return failed[i] < failed[j]
+		}
+		return ti.Before(tj)
+	})
+
+	n := h.MaxConcurrentReplacements - h.Replacing()
+	if n < 0 {
+		n = 0
+	}
+	if len(failed) > n {
+		failed = failed[:n]
+	}
+	return failed
+}
+
+// Replacing returns the number of failed members being replaced: the members removed whose replacements
+// have not been added yet, and the replacements added whose pods have not been running yet.
+func (h *MemberFailureHandler) Replacing() int {
+	return h.removed + len(h.adding)
+}
+
+// Removed records that the given failed member is removed and waits for a replacement.
+func (h *MemberFailureHandler) Removed(name string) {
+	h.Forget(name)
+	h.removed++
+}
+
+// Added records that the given member is added. It is the replacement of a removed member, if any
+// is waiting for one, until its pod is no longer observed not running.
+func (h *MemberFailureHandler) Added(name string) {
+	if h.removed == 0 {
+		return
+	}
+	h.removed--
+	h.adding[name] = true
+}
+
+// Forget drops the record of the given member, e.g. after it is removed.
+func (h *MemberFailureHandler) Forget(name string) {
+	delete(h.notRunningSince, name)
+	delete(h.adding, name)
+}
+
+// replaceFailedMembers removes the members whose pods are not running for longer than the failure threshold.
+// The next reconciliations add the replacement members back as the cluster is below its desired size.
+// It returns true if any member is removed.
+func (c *Cluster) replaceFailedMembers(running, notRunning []*v1.Pod) (bool, error) {
+	if c.members == nil {
+		return false, nil
+	}
+	missing := c.cluster.Spec.Size - c.members.Size()
+	if missing < 0 {
+		missing = 0
+	}
+	failed := c.failureHandler.Observe(notRunning, missing, time.Now())
+	if len(failed) == 0 {
+		return false, nil
+	}
+
+	toRemove := etcdutil.MemberSet{}
+	for _, name := range failed {
+		if m, ok := c.members[name]; ok {
+			toRemove.Add(m)
+		}
+	}
+	if toRemove.Size() == 0 {
+		return false, nil
+	}
+	// removing members needs the quorum of the current membership.
+	if len(running) < c.members.Size()/2+1 {
+		return false, errors.New("fail to replace failed members: not enough running members for quorum")
+	}
+
+	for _, m := range toRemove {
+		c.logger.Warningf("member (%s) has not been running for more than %v, replacing it", m.Name, c.failureHandler.FailureThreshold)
+		if err := c.removeDeadMember(m); err != nil {
+			return true, err
+		}
+		c.failureHandler.Removed(m.Name)
+		membersReplaced.Inc()
+	}
+	return true, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPendingPods(names ...string) []*v1.Pod {
+	var pods []*v1.Pod
+	for _, name := range names {
+		pods = append(pods, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     v1.PodStatus{Phase: v1.PodPending},
+		})
+	}
+	return pods
+}
+
+func TestMemberFailureHandlerObserve(t *testing.T) {
+	h := NewMemberFailureHandler(time.Minute, 2)
+	start := time.Now()
+
+	if got := h.Observe(newPendingPods("a-0001", "a-0002"), 0, start); len(got) != 0 {
+		t.Fatalf("expect no failed member at first sight, got %v", got)
+	}
+	if got := h.Observe(newPendingPods("a-0001", "a-0002", "a-0003"), 0, start.Add(30*time.Second)); len(got) != 0 {
+		t.Fatalf("expect no failed member within the threshold, got %v", got)
+	}
+
+	// a-0003 has been pending for 40s only.
+	got := h.Observe(newPendingPods("a-0003", "a-0002", "a-0001"), 0, start.Add(70*time.Second))
+	if w := []string{"a-0001", "a-0002"}; !reflect.DeepEqual(got, w) {
+		t.Errorf("failed members = %v, want %v", got, w)
+	}
+
+	// a-0001 was running in between, so it starts over.
+	h.Observe(nil, 0, start.Add(90*time.Second))
+	if got = h.Observe(newPendingPods("a-0001"), 0, start.Add(100*time.Second)); len(got) != 0 {
+		t.Errorf("expect the record of a running pod to be dropped, got %v", got)
+	}
+}
+
+func TestMemberFailureHandlerReplacing(t *testing.T) {
+	h := NewMemberFailureHandler(time.Minute, 2)
+	start := time.Now()
+	h.Observe(newPendingPods("a-0001", "a-0002", "a-0003"), 0, start)
+
+	h.Removed("a-0001")
+	if h.Replacing() != 1 {
+		t.Fatalf("Replacing() = %d, want 1", h.Replacing())
+	}
+	got := h.Observe(newPendingPods("a-0002", "a-0003"), 1, start.Add(70*time.Second))
+	if w := []string{"a-0002"}; !reflect.DeepEqual(got, w) {
+		t.Errorf("failed members = %v, want %v", got, w)
+	}
+
+	// the replacement is still in flight until its pod is running.
+	h.Added("a-0004")
+	if got = h.Observe(newPendingPods("a-0002", "a-0003", "a-0004"), 0, start.Add(80*time.Second)); len(got) != 1 {
+		t.Errorf("expect one replacement while a-0004 is not running, got %v", got)
+	}
+	h.Removed("a-0002")
+	if got = h.Observe(newPendingPods("a-0003", "a-0004"), 1, start.Add(90*time.Second)); len(got) != 0 {
+		t.Errorf("expect no replacement beyond the max concurrent replacements, got %v", got)
+	}
+
+	// a member added for scaling up is not a replacement.
+	h.Added("a-0005")
+	h.Added("a-0006")
+	if h.Replacing() != 2 {
+		t.Fatalf("Replacing() = %d, want 2", h.Replacing())
+	}
+
+	h.Observe(newPendingPods("a-0003"), 0, start.Add(100*time.Second))
+	if h.Replacing() != 0 {
+		t.Errorf("Replacing() = %d, want 0 once the replacements are running", h.Replacing())
+	}
+}
+
+func TestMemberFailureHandlerScaledDown(t *testing.T) {
+	h := NewMemberFailureHandler(time.Minute, 1)
+	h.Removed("a-0001")
+	// the cluster is scaled down, so the removed member is not going to be replaced.
+	h.Observe(nil, 0, time.Now())
+	if h.Replacing() != 0 {
+		t.Errorf("Replacing() = %d, want 0", h.Replacing())
+	}
+}
+
+func TestMemberFailureHandlerDisabled(t *testing.T) {
+	h := NewMemberFailureHandler(0, 0)
+	start := time.Now()
+	h.Observe(newPendingPods("a-0001"), 0, start)
+	if got := h.Observe(newPendingPods("a-0001"), 0, start.Add(time.Hour)); len(got) != 0 {
+		t.Errorf("expect no failed member with zero threshold, got %v", got)
+	}
+	if h.MaxConcurrentReplacements != 1 {
+		t.Errorf("MaxConcurrentReplacements = %d, want 1", h.MaxConcurrentReplacements)
+	}
+}
@@ -37,7 +37,15 @@ var reconcileFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
 	[]string{"Reason"},
 )
 
+var membersReplaced = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "etcd_operator",
+	Subsystem: "cluster",
+	Name:      "members_replaced",
+	Help:      "Total number of members replaced after failing for longer than the failure threshold",
+})
+
 func init() {
 	prometheus.MustRegister(reconcileHistogram)
 	prometheus.MustRegister(reconcileFailed)
+	prometheus.MustRegister(membersReplaced)
 }
@@ -0,0 +1,99 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reconcilePDB keeps a PodDisruptionBudget with minAvailable set to the quorum of spec.size on the members
+// of the cluster, so that voluntary disruptions like node drains never evict a majority of them.
+// The spec of a PodDisruptionBudget is immutable, so on resize it is deleted and created again.
+// A PodDisruptionBudget modified by hand is left alone; if it keeps fewer members available than quorum,
+// the cluster is warned about and gets the DisruptionBudgetBelowQuorum condition.
+func (c *Cluster) reconcilePDB() error {
+	size := c.cluster.Spec.Size
+	quorum := k8sutil.QuorumSize(size)
+
+	pdb, err := c.config.KubeCli.PolicyV1beta1().PodDisruptionBudgets(c.cluster.Namespace).Get(c.cluster.Name, metav1.GetOptions{})
+	if err != nil {
+		if !k8sutil.IsKubernetesResourceNotFoundError(err) {
+			return fmt.Errorf("reconcile PDB: fail to get PDB: %v", err)
+		}
+		c.status.ClearCondition(api.ClusterConditionDisruptionBudgetBelowQuorum)
+		if err := k8sutil.CreateEtcdPDB(c.config.KubeCli, c.cluster.Namespace, k8sutil.NewEtcdPDB(c.cluster.Name, size, c.cluster.AsOwner())); err != nil {
+			return fmt.Errorf("reconcile PDB: fail to create PDB: %v", err)
+		}
+		c.logger.Infof("created PodDisruptionBudget with minAvailable %d", quorum)
+		return nil
+	}
+
+	if k8sutil.IsPDBModified(pdb) {
+		return c.checkPDBQuorum(pdb, size, quorum)
+	}
+
+	c.status.ClearCondition(api.ClusterConditionDisruptionBudgetBelowQuorum)
+	if pdb.Spec.MinAvailable.IntValue() == quorum {
+		return nil
+	}
+	if err := k8sutil.DeleteEtcdPDB(c.config.KubeCli, c.cluster.Namespace, c.cluster.Name); err != nil {
+		return fmt.Errorf("reconcile PDB: fail to delete PDB: %v", err)
+	}
+	if err := k8sutil.CreateEtcdPDB(c.config.KubeCli, c.cluster.Namespace, k8sutil.NewEtcdPDB(c.cluster.Name, size, c.cluster.AsOwner())); err != nil {
+		return fmt.Errorf("reconcile PDB: fail to create PDB: %v", err)
+	}
+	c.logger.Infof("updated PodDisruptionBudget minAvailable from %s to %d", pdb.Spec.MinAvailable.String(), quorum)
+	return nil
+}
+
+// checkPDBQuorum warns, with a log, an event and the DisruptionBudgetBelowQuorum condition, if the given
+// PodDisruptionBudget modified by hand keeps fewer members than quorum available.
+// The event is only emitted when the condition is first set.
+func (c *Cluster) checkPDBQuorum(pdb *policyv1beta1.PodDisruptionBudget, size, quorum int) error {
+	minAvailable, err := k8sutil.PDBMinAvailable(pdb, size)
+	if err != nil {
+		return fmt.Errorf("reconcile PDB: invalid PDB: %v", err)
+	}
+	if minAvailable >= quorum {
+		c.status.ClearCondition(api.ClusterConditionDisruptionBudgetBelowQuorum)
+		return nil
+	}
+
+	c.logger.Warningf("PodDisruptionBudget %s was modified to keep %d members available, below the quorum %d", pdb.Name, minAvailable, quorum)
+	warned := hasClusterCondition(c.status, api.ClusterConditionDisruptionBudgetBelowQuorum)
+	c.status.SetDisruptionBudgetBelowQuorumCondition(minAvailable, quorum)
+	if warned {
+		return nil
+	}
+	if _, err := c.eventsCli.Create(k8sutil.DisruptionBudgetBelowQuorumEvent(minAvailable, quorum, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create disruption budget below quorum event: %v", err)
+	}
+	return nil
+}
+
+func hasClusterCondition(status api.ClusterStatus, t api.ClusterConditionType) bool {
+	for _, c := range status.Conditions {
+		if c.Type == t {
+			return true
+		}
+	}
+	return false
+}
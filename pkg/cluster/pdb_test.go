@@ -0,0 +1,70 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNewEtcdPDB(t *testing.T) {
+	for size, quorum := range map[int]int{1: 1, 2: 2, 3: 2, 4: 3, 5: 3, 7: 4} {
+		pdb := k8sutil.NewEtcdPDB("example", size, metav1.OwnerReference{UID: "uid"})
+		if v := pdb.Spec.MinAvailable.IntValue(); v != quorum {
+			t.Errorf("size %d: expect minAvailable %d, get %d", size, quorum, v)
+		}
+		if k8sutil.IsPDBModified(pdb) {
+			t.Errorf("size %d: expect the PDB of the operator to be unmodified", size)
+		}
+		if pdb.Spec.Selector.MatchLabels["etcd_cluster"] != "example" || pdb.Spec.Selector.MatchLabels["app"] != "etcd" {
+			t.Errorf("size %d: expect the PDB to select the members of the cluster, get %v", size, pdb.Spec.Selector.MatchLabels)
+		}
+	}
+}
+
+func TestPDBModified(t *testing.T) {
+	one := intstr.FromInt(1)
+	half := intstr.FromString("50%")
+
+	pdb := k8sutil.NewEtcdPDB("example", 3, metav1.OwnerReference{})
+	pdb.Spec.MinAvailable = &one
+	if !k8sutil.IsPDBModified(pdb) {
+		t.Errorf("expect the PDB with minAvailable changed to be modified")
+	}
+	if n, err := k8sutil.PDBMinAvailable(pdb, 3); err != nil || n != 1 {
+		t.Errorf("expect minAvailable 1, get %d (%v)", n, err)
+	}
+
+	pdb = k8sutil.NewEtcdPDB("example", 3, metav1.OwnerReference{})
+	pdb.Spec.MinAvailable = nil
+	pdb.Spec.MaxUnavailable = &half
+	if !k8sutil.IsPDBModified(pdb) {
+		t.Errorf("expect the PDB with maxUnavailable set to be modified")
+	}
+	// 50% of 3 is rounded up to 2 unavailable members.
+	if n, err := k8sutil.PDBMinAvailable(pdb, 3); err != nil || n != 1 {
+		t.Errorf("expect minAvailable 1, get %d (%v)", n, err)
+	}
+
+	pdb = k8sutil.NewEtcdPDB("example", 5, metav1.OwnerReference{})
+	delete(pdb.Annotations, k8sutil.PDBMinAvailableAnnotation)
+	if !k8sutil.IsPDBModified(pdb) {
+		t.Errorf("expect the PDB not created by the operator to be modified")
+	}
+}
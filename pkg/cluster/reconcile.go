@@ -32,6 +32,8 @@ import (
 // reconcile reconciles cluster current state to desired state specified by spec.
 // - it tries to reconcile the cluster to desired size.
 // - if the cluster needs for upgrade, it tries to upgrade old member one by one.
+// - if the etcd configuration of the spec changed, it restarts the members a few at a time.
+// - if the storage size of the spec increased, it expands the PersistentVolumeClaims of the members.
 func (c *Cluster) reconcile(pods []*v1.Pod) error {
 	c.logger.Infoln("Start reconciling")
 	defer c.logger.Infoln("Finish reconciling")
@@ -55,6 +57,14 @@ func (c *Cluster) reconcile(pods []*v1.Pod) error {
 	}
 	c.status.ClearCondition(api.ClusterConditionUpgrading)
 
+	if restarted, err := c.rollingRestart(pods); err != nil || restarted {
+		return err
+	}
+
+	if err := c.expandStorage(pods); err != nil {
+		return err
+	}
+
 	c.status.SetVersion(sp.Version)
 	c.status.SetReadyCondition()
 
@@ -142,6 +152,7 @@ func (c *Cluster) addOneMember() error {
 		return fmt.Errorf("fail to create member's pod (%s): %v", newMember.Name, err)
 	}
 	c.memberCounter++
+	c.failureHandler.Added(newMember.Name)
 	c.logger.Infof("added member (%s)", newMember.Name)
 	_, err = c.eventsCli.Create(k8sutil.NewMemberAddEvent(newMember.Name, c.cluster))
 	if err != nil {
@@ -0,0 +1,109 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"k8s.io/api/core/v1"
+)
+
+// rollingRestart restarts the members whose pods run with an etcd configuration other than the spec's,
+// e.g. after spec.pod.etcdEnv is updated, by deleting up to maxRestarts of their pods. The reconciliation then
+// replaces these members like dead members, with pods created from the spec. It returns whether pods were deleted.
+// The pods are only deleted once all the members have joined the cluster, as listed by etcd, so that the
+// replacements of the previous pods are running and have joined the cluster before the next pods are deleted.
+func (c *Cluster) rollingRestart(pods []*v1.Pod) (bool, error) {
+	if c.cluster.Spec.SelfHosted != nil {
+		return false, nil
+	}
+	stale := staleConfigPods(pods, k8sutil.EtcdConfigHash(c.cluster.Spec))
+	if len(stale) == 0 {
+		return false, nil
+	}
+	n := maxRestarts(c.cluster.Spec.Size, c.cluster.Spec.MaxUnavailable)
+	if n == 0 {
+		c.logger.Warningf("skip restarting member %s to apply the etcd configuration: the cluster would lose its quorum", stale[0].Name)
+		return false, nil
+	}
+
+	resp, err := etcdutil.ListMembers(c.members.ClientURLs(), c.tlsConfig)
+	if err != nil {
+		return false, fmt.Errorf("rolling restart: list members failed: %v", err)
+	}
+	if !allMembersStarted(resp.Members, c.members.Size()) {
+		c.logger.Infof("waiting for the members to join the cluster before restarting the next members")
+		return false, nil
+	}
+
+	if len(stale) > n {
+		stale = stale[:n]
+	}
+	for _, pod := range stale {
+		c.logger.Infof("restarting the etcd member %s to apply the etcd configuration", pod.Name)
+		if err := c.removePod(pod.Name); err != nil {
+			return false, fmt.Errorf("rolling restart: fail to delete pod (%s): %v", pod.Name, err)
+		}
+		if _, err := c.eventsCli.Create(k8sutil.MemberRestartedEvent(pod.Name, c.cluster)); err != nil {
+			c.logger.Errorf("failed to create member restarted event: %v", err)
+		}
+	}
+	return true, nil
+}
+
+// staleConfigPods returns the pods, sorted by name, created with an etcd configuration whose hash is not hash.
+// The pods created before the hash was recorded are left as they are.
+func staleConfigPods(pods []*v1.Pod, hash string) []*v1.Pod {
+	var stale []*v1.Pod
+	for _, pod := range pods {
+		if h := k8sutil.GetEtcdConfigHash(pod); len(h) != 0 && h != hash {
+			stale = append(stale, pod)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Name < stale[j].Name })
+	return stale
+}
+
+// maxRestarts returns how many of the members of a cluster of the given size may be restarted at the same time
+// with the given maxUnavailable, so that the remaining members keep the quorum.
+func maxRestarts(size, maxUnavailable int) int {
+	n := maxUnavailable
+	if n == 0 {
+		n = 1
+	}
+	if tolerated := size - (size/2 + 1); n > tolerated {
+		n = tolerated
+	}
+	return n
+}
+
+// allMembersStarted tells whether the etcd member list has size members which have all started,
+// i.e. joined the cluster under their names.
+func allMembersStarted(members []*etcdserverpb.Member, size int) bool {
+	if len(members) != size {
+		return false
+	}
+	for _, m := range members {
+		if len(m.Name) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStaleConfigPods(t *testing.T) {
+	old := api.ClusterSpec{Size: 3}
+	cur := api.ClusterSpec{Size: 3, Pod: &api.PodPolicy{EtcdEnv: []v1.EnvVar{{Name: "ETCD_QUOTA_BACKEND_BYTES", Value: "4294967296"}}}}
+	if k8sutil.EtcdConfigHash(old) != k8sutil.EtcdConfigHash(api.ClusterSpec{Size: 5, Pod: &api.PodPolicy{}}) {
+		t.Error("expect the etcd configuration hash to only depend on the etcd environment and resources")
+	}
+	newPod := func(name string, cs *api.ClusterSpec) *v1.Pod {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{}}}
+		if cs != nil {
+			pod.Annotations[k8sutil.EtcdConfigAnnotation] = k8sutil.EtcdConfigHash(*cs)
+		}
+		return pod
+	}
+	// the pod without the hash predates it.
+	pods := []*v1.Pod{newPod("etcd-3", &old), newPod("etcd-0", nil), newPod("etcd-2", &cur), newPod("etcd-1", &old)}
+
+	stale := staleConfigPods(pods, k8sutil.EtcdConfigHash(cur))
+	if names := k8sutil.GetPodNames(stale); len(names) != 2 || names[0] != "etcd-1" || names[1] != "etcd-3" {
+		t.Errorf("stale pods = %v, want [etcd-1 etcd-3]", names)
+	}
+	if stale := staleConfigPods(pods, k8sutil.EtcdConfigHash(old)); len(stale) != 1 {
+		t.Errorf("stale pods = %v, want [etcd-2]", k8sutil.GetPodNames(stale))
+	}
+}
+
+func TestMaxRestarts(t *testing.T) {
+	tests := []struct {
+		size, maxUnavailable, want int
+	}{
+		{size: 1, maxUnavailable: 0, want: 0},
+		{size: 2, maxUnavailable: 1, want: 0},
+		{size: 3, maxUnavailable: 0, want: 1},
+		{size: 3, maxUnavailable: 2, want: 1},
+		{size: 5, maxUnavailable: 0, want: 1},
+		{size: 5, maxUnavailable: 2, want: 2},
+		{size: 5, maxUnavailable: 3, want: 2},
+	}
+	for _, tt := range tests {
+		if got := maxRestarts(tt.size, tt.maxUnavailable); got != tt.want {
+			t.Errorf("maxRestarts(%d, %d) = %d, want %d", tt.size, tt.maxUnavailable, got, tt.want)
+		}
+	}
+}
+
+func TestAllMembersStarted(t *testing.T) {
+	started := []*etcdserverpb.Member{{ID: 1, Name: "etcd-0"}, {ID: 2, Name: "etcd-1"}, {ID: 3, Name: "etcd-2"}}
+	if !allMembersStarted(started, 3) {
+		t.Error("expect all members started")
+	}
+	if allMembersStarted(started[:2], 3) {
+		t.Error("expect a missing member not to be started")
+	}
+	// a member added but not started yet has no name.
+	joining := append(started[:2:2], &etcdserverpb.Member{ID: 4})
+	if allMembersStarted(joining, 3) {
+		t.Error("expect a member without a name not to be started")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// expandStorage expands the PersistentVolumeClaims of the members whose requested size is below
+// spec.storage.requestedSize, and records the members whose PersistentVolumeClaim capacity, i.e. the size
+// of the expanded filesystem, has not reached its requested size yet. These members are reported unready
+// until their expansion completes.
+func (c *Cluster) expandStorage(pods []*v1.Pod) error {
+	ss := c.cluster.Spec.Storage
+	if ss == nil {
+		c.expandingMembers = nil
+		return nil
+	}
+
+	expanding := make(map[string]bool)
+	defer func() { c.expandingMembers = expanding }()
+
+	var waiting []string
+
+	pvcs := c.config.KubeCli.CoreV1().PersistentVolumeClaims(c.cluster.Namespace)
+	for _, pod := range pods {
+		pvc, err := pvcs.Get(k8sutil.EtcdPVCName(pod.Name), metav1.GetOptions{})
+		if err != nil {
+			if k8sutil.IsKubernetesResourceNotFoundError(err) {
+				// The pods created before spec.storage was set have no PersistentVolumeClaim.
+				continue
+			}
+			return fmt.Errorf("expand storage: fail to get PVC of pod (%s): %v", pod.Name, err)
+		}
+
+		switch needStorageResize(pvc, ss.RequestedSize) {
+		case 1:
+			pvc.Spec.Resources.Requests[v1.ResourceStorage] = ss.RequestedSize.DeepCopy()
+			if pvc, err = pvcs.Update(pvc); err != nil {
+				return fmt.Errorf("expand storage: fail to resize PVC (%s): %v", k8sutil.EtcdPVCName(pod.Name), err)
+			}
+			c.logger.Infof("expanding the storage of member %s to %s", pod.Name, ss.RequestedSize.String())
+			if _, err := c.eventsCli.Create(k8sutil.MemberStorageExpandingEvent(pod.Name, ss.RequestedSize.String(), c.cluster)); err != nil {
+				c.logger.Errorf("failed to create member storage expanding event: %v", err)
+			}
+		case -1:
+			c.logger.Warningf("skip shrinking the storage of member %s to %s: PVCs can't be shrunk", pod.Name, ss.RequestedSize.String())
+		}
+
+		if k8sutil.PVCStorageExpanding(pvc) {
+			expanding[pod.Name] = true
+			waiting = append(waiting, pod.Name)
+		}
+	}
+	if len(waiting) > 0 {
+		sort.Strings(waiting)
+		c.logger.Infof("waiting for the storage of members %v to be expanded", waiting)
+	}
+	return nil
+}
+
+// needStorageResize compares the requested size of the PersistentVolumeClaim with size: it returns 1 if the
+// PersistentVolumeClaim should be expanded, -1 if size is smaller, and 0 if they are equal.
+func needStorageResize(pvc *v1.PersistentVolumeClaim, size resource.Quantity) int {
+	requested, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	if !ok {
+		return 0
+	}
+	return size.Cmp(requested)
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewEtcdPVC(t *testing.T) {
+	m := &etcdutil.Member{Name: "example-0000"}
+	ss := &api.StorageSpec{StorageClassName: "fast", RequestedSize: resource.MustParse("1Gi")}
+	pvc := k8sutil.NewEtcdPVC(m, "example", ss, metav1.OwnerReference{UID: "uid"})
+	if pvc.Name != "example-0000-data" {
+		t.Errorf("expect PVC name example-0000-data, get %s", pvc.Name)
+	}
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName != "fast" {
+		t.Errorf("expect storage class fast, get %v", pvc.Spec.StorageClassName)
+	}
+	if len(pvc.Spec.AccessModes) != 1 || pvc.Spec.AccessModes[0] != v1.ReadWriteOnce {
+		t.Errorf("expect access modes [%s], get %v", v1.ReadWriteOnce, pvc.Spec.AccessModes)
+	}
+	if size := pvc.Spec.Resources.Requests[v1.ResourceStorage]; size.Cmp(ss.RequestedSize) != 0 {
+		t.Errorf("expect requested size %s, get %s", ss.RequestedSize.String(), size.String())
+	}
+	if len(pvc.OwnerReferences) != 1 || pvc.OwnerReferences[0].UID != "uid" {
+		t.Errorf("expect the PVC to be owned by the cluster, get %v", pvc.OwnerReferences)
+	}
+
+	pod := k8sutil.NewEtcdPod(m, nil, "example", "new", "", api.ClusterSpec{Size: 1, Storage: ss}, metav1.OwnerReference{})
+	if pvs := pod.Spec.Volumes[0].PersistentVolumeClaim; pvs == nil || pvs.ClaimName != pvc.Name {
+		t.Errorf("expect the pod to store its data on PVC %s, get %v", pvc.Name, pod.Spec.Volumes[0])
+	}
+}
+
+func TestStorageResize(t *testing.T) {
+	newPVC := func(requested, capacity string) *v1.PersistentVolumeClaim {
+		return &v1.PersistentVolumeClaim{
+			Spec: v1.PersistentVolumeClaimSpec{
+				Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse(requested)}},
+			},
+			Status: v1.PersistentVolumeClaimStatus{
+				Phase:    v1.ClaimBound,
+				Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse(capacity)},
+			},
+		}
+	}
+
+	tests := []struct {
+		pvc       *v1.PersistentVolumeClaim
+		size      string
+		resize    int
+		expanding bool
+	}{
+		{newPVC("1Gi", "1Gi"), "1024Mi", 0, false},
+		{newPVC("1Gi", "1Gi"), "2Gi", 1, false},
+		{newPVC("2Gi", "1Gi"), "2Gi", 0, true},
+		{newPVC("2Gi", "2Gi"), "1Gi", -1, false},
+	}
+	for i, tt := range tests {
+		if r := needStorageResize(tt.pvc, resource.MustParse(tt.size)); r != tt.resize {
+			t.Errorf("#%d: expect resize %d, get %d", i, tt.resize, r)
+		}
+		if e := k8sutil.PVCStorageExpanding(tt.pvc); e != tt.expanding {
+			t.Errorf("#%d: expect expanding %v, get %v", i, tt.expanding, e)
+		}
+	}
+
+	pending := newPVC("2Gi", "1Gi")
+	pending.Status.Phase = v1.ClaimPending
+	if k8sutil.PVCStorageExpanding(pending) {
+		t.Error("expect a pending PVC not to be expanding")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// checkTopologySpread warns, with a log and an event, if the cluster has more members than the ready nodes
+// it may run on have values of the topology key of its topologySpread, so that the members can't be spread
+// one per value: with DoNotSchedule, the members beyond the number of values are left unscheduled.
+// It is only a warning, since nodes may be added later. Failing to list the nodes skips the check.
+func (c *Cluster) checkTopologySpread() {
+	tp := c.cluster.Spec.TopologySpread
+	if tp == nil {
+		return
+	}
+	var selector string
+	if c.cluster.Spec.Pod != nil && len(c.cluster.Spec.Pod.NodeSelector) != 0 {
+		selector = labels.SelectorFromSet(c.cluster.Spec.Pod.NodeSelector).String()
+	}
+	nodes, err := c.config.KubeCli.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		c.logger.Warningf("skipped checking the topology spread: failed to list nodes: %v", err)
+		return
+	}
+	msg := topologySpreadWarning(nodes.Items, c.cluster.Spec.Size, tp)
+	if len(msg) == 0 {
+		return
+	}
+	c.logger.Warning(msg)
+	if _, err := c.eventsCli.Create(k8sutil.TopologySpreadWarningEvent(msg, c.cluster)); err != nil {
+		c.logger.Errorf("failed to create topology spread warning event: %v", err)
+	}
+}
+
+// topologySpreadWarning returns why size members can't be spread across the values of the topology key of tp
+// among the ready nodes, or an empty string if they can.
+func topologySpreadWarning(nodes []v1.Node, size int, tp *api.TopologySpreadPolicy) string {
+	values := make(map[string]bool)
+	for _, n := range nodes {
+		if v, ok := n.Labels[tp.TopologyKey]; ok && k8sutil.IsNodeReady(n) {
+			values[v] = true
+		}
+	}
+	if len(values) >= size {
+		return ""
+	}
+	msg := fmt.Sprintf("the cluster has %d members but the ready nodes have %d values of %s", size, len(values), tp.TopologyKey)
+	if tp.IsRequired() {
+		return msg + ": the members beyond are left unscheduled"
+	}
+	return msg + ": some members share a value"
+}
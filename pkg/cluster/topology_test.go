@@ -0,0 +1,60 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTopologySpreadWarning(t *testing.T) {
+	newNode := func(zone string, ready bool) v1.Node {
+		n := v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{}}}
+		if len(zone) != 0 {
+			n.Labels["topology.kubernetes.io/zone"] = zone
+		}
+		status := v1.ConditionFalse
+		if ready {
+			status = v1.ConditionTrue
+		}
+		n.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: status}}
+		return n
+	}
+	// the nodes have 2 zones, "c" is not ready and the last node has no zone.
+	nodes := []v1.Node{newNode("a", true), newNode("a", true), newNode("b", true), newNode("c", false), newNode("", true)}
+	tests := []struct {
+		size              int
+		whenUnsatisfiable string
+		want              string
+	}{
+		{size: 1},
+		{size: 2},
+		{size: 3, want: "left unscheduled"},
+		{size: 3, whenUnsatisfiable: api.TopologySpreadDoNotSchedule, want: "left unscheduled"},
+		{size: 3, whenUnsatisfiable: api.TopologySpreadScheduleAnyway, want: "share a value"},
+	}
+	for i, tt := range tests {
+		tp := &api.TopologySpreadPolicy{TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: tt.whenUnsatisfiable}
+		msg := topologySpreadWarning(nodes, tt.size, tp)
+		if len(tt.want) == 0 && len(msg) != 0 || !strings.Contains(msg, tt.want) {
+			t.Errorf("#%d: warning = %q, want %q", i, msg, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"text/template"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+	"github.com/coreos/etcd-operator/pkg/util/azureutil/absfactory"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// handleABS backups up etcd cluster to abs and return abs path for the backup file.
+func handleABS(ctx context.Context, kubecli kubernetes.Interface, abs *api.ABSSource, namespace, clusterName string, tc *tls.Config, retention backup.BackupRetentionPolicy, hooks backup.BackupHooks, defrag *backup.MemberDefragConfig, nameTemplate *template.Template, compression string, compressionLevel int) (string, bool, error) {
+	cli, err := absfactory.NewClientFromSecret(kubecli, namespace, abs.ABSSecret)
+	if err != nil {
+		return "", false, err
+	}
+	bm := backup.NewBackupManagerFromWriter(kubecli, writer.NewABSWriter(cli.ABS), clusterName, namespace, tc,
+		retention, compression, compressionLevel)
+	return saveSnap(ctx, bm, backupPrefix(abs.ABSContainer, "", namespace, clusterName), hooks, defrag, nameTemplate)
+}
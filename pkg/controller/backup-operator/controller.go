@@ -52,7 +52,7 @@ func (b *Backup) run(ctx context.Context) {
 
 	const numWorkers = 1
 	for i := 0; i < numWorkers; i++ {
-		go wait.Until(b.runWorker, time.Second, ctx.Done())
+		go wait.Until(func() { b.runWorker(ctx) }, time.Second, ctx.Done())
 	}
 
 	<-ctx.Done()
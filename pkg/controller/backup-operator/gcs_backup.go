@@ -0,0 +1,52 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"text/template"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+	"github.com/coreos/etcd-operator/pkg/util/gcputil/gcsfactory"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// handleGCS backups up etcd cluster to gcs and return gcs path for the backup file.
+// If workloadIdentity is true and neither a GCP secret nor Vault is given, the operator's own GKE Workload Identity is used.
+func handleGCS(ctx context.Context, kubecli kubernetes.Interface, gcs *api.GCSSource, namespace, clusterName string, tc *tls.Config, retention backup.BackupRetentionPolicy, hooks backup.BackupHooks, defrag *backup.MemberDefragConfig, nameTemplate *template.Template, compression string, compressionLevel int, workloadIdentity bool) (string, bool, error) {
+	if workloadIdentity && len(gcs.GCPSecret) == 0 && gcs.Vault == nil {
+		gcs = gcs.DeepCopy()
+		gcs.UseApplicationDefaultCredentials = true
+	}
+	if err := gcs.Validate(); err != nil {
+		return "", false, err
+	}
+	cli, err := gcsfactory.NewClient(kubecli, namespace, gcs)
+	if err != nil {
+		return "", false, err
+	}
+	defer cli.Close()
+	w := writer.NewGCSWriterWithOptions(cli.GCS, writer.GCSWriterOptions{
+		Identity:       cli.Identity,
+		GoogleAccessID: cli.ClientEmail,
+		PrivateKey:     cli.PrivateKey,
+	})
+	bm := backup.NewBackupManagerFromWriter(kubecli, w, clusterName, namespace, tc, retention, compression, compressionLevel)
+	return saveSnap(ctx, bm, backupPrefix(gcs.GCSBucket, gcs.Prefix, namespace, clusterName), hooks, defrag, nameTemplate)
+}
@@ -18,11 +18,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
 	"github.com/coreos/etcd-operator/pkg/client"
 	"github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/gcputil"
 	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
 
 	"github.com/sirupsen/logrus"
@@ -44,17 +47,31 @@ type Backup struct {
 	kubecli     kubernetes.Interface
 	backupCRCli versioned.Interface
 	kubeExtCli  apiextensionsclient.Interface
+
+	// gcsWorkloadIdentity is true if the operator runs on GKE and
+	// GCS backups without a GCP secret use GKE Workload Identity.
+	gcsWorkloadIdentity bool
+
+	// defragCounters count the backups of each cluster until its members are defragmented.
+	// The counts are kept in memory, so they start over when the operator restarts.
+	defragMu       sync.Mutex
+	defragCounters map[string]*backup.BackupCounter
 }
 
 // New creates a backup operator.
 func New() *Backup {
-	return &Backup{
+	b := &Backup{
 		logger:      logrus.WithField("pkg", "controller"),
 		namespace:   os.Getenv(constants.EnvOperatorPodNamespace),
 		kubecli:     k8sutil.MustNewKubeClient(),
 		backupCRCli: client.MustNewInCluster(),
 		kubeExtCli:  k8sutil.MustNewKubeExtClient(),
 	}
+	if gcputil.OnGKE() {
+		b.logger.Info("detected GKE metadata server: GCS backups without a GCP secret use Workload Identity")
+		b.gcsWorkloadIdentity = true
+	}
+	return b
 }
 
 // Start starts the Backup operator.
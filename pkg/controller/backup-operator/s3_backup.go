@@ -15,12 +15,14 @@
 package controller
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
-	"path"
+	"text/template"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/backup"
-	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	backups3 "github.com/coreos/etcd-operator/pkg/backup/s3"
 	"github.com/coreos/etcd-operator/pkg/backup/writer"
 	"github.com/coreos/etcd-operator/pkg/util/awsutil/s3factory"
 
@@ -29,18 +31,41 @@ import (
 
 // TODO: replace this with generic backend interface for other options (PV, Azure)
 // handleS3 backups up etcd cluster to s3 and return s3 path for the backup file.
-func handleS3(kubecli kubernetes.Interface, s3 *api.S3Source, namespace, clusterName string) (string, error) {
-	cli, err := s3factory.NewClientFromSecret(kubecli, namespace, s3.AWSSecret)
+func handleS3(ctx context.Context, kubecli kubernetes.Interface, s3 *api.S3Source, namespace, clusterName string, tc *tls.Config, retention backup.BackupRetentionPolicy, hooks backup.BackupHooks, defrag *backup.MemberDefragConfig, nameTemplate *template.Template, compression string, compressionLevel int) (string, bool, error) {
+	sse, err := backups3.NewSSE(s3.SSE, s3.SSEKMSKeyID)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
-	defer cli.Close()
-	// TODO: support TLS.
-	bm := backup.NewBackupManagerFromWriter(kubecli, writer.NewS3Writer(cli.S3), clusterName, namespace)
-	s3Prefix := backupapi.ToS3Prefix(s3.Prefix, namespace, clusterName)
-	fullPath, err := bm.SaveSnapWithPrefix(path.Join(s3.S3Bucket, s3Prefix))
+	if err = backups3.ValidateStorageClass(s3.StorageClass); err != nil {
+		return "", false, err
+	}
+	if s3.PartSizeInMB != 0 && s3.PartSizeInMB < writer.MinS3PartSizeInMB {
+		return "", false, fmt.Errorf("S3 part size (%dMB) must be at least %dMB", s3.PartSizeInMB, writer.MinS3PartSizeInMB)
+	}
+	if err = s3.Validate(); err != nil {
+		return "", false, err
+	}
+	cli, err := s3factory.NewClient(kubecli, namespace, s3)
 	if err != nil {
-		return "", fmt.Errorf("failed to save snapshot (%v)", err)
+		return "", false, err
+	}
+	defer cli.Close()
+	opts := writer.S3WriterOptions{
+		SSE:          sse,
+		StorageClass: s3.StorageClass,
+		PartSizeInMB: s3.PartSizeInMB,
+	}
+	w := writer.NewS3WriterWithOptions(cli.S3, opts)
+	if len(s3.SecondaryS3Buckets) != 0 {
+		secondaries := make([]writer.Writer, 0, len(s3.SecondaryS3Buckets))
+		for _, bk := range s3.SecondaryS3Buckets {
+			o := opts
+			o.Bucket = bk
+			secondaries = append(secondaries, writer.NewS3WriterWithOptions(cli.S3, o))
+		}
+		w = writer.NewFanOutWriter(writer.DefaultFanOutTimeout, w, secondaries...)
 	}
-	return fullPath, nil
+	bm := backup.NewBackupManagerFromWriter(kubecli, w, clusterName, namespace, tc,
+		retention, compression, compressionLevel)
+	return saveSnap(ctx, bm, backupPrefix(s3.S3Bucket, s3.Prefix, namespace, clusterName), hooks, defrag, nameTemplate)
 }
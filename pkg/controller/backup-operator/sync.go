@@ -15,7 +15,16 @@
 package controller
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
 
 	"github.com/sirupsen/logrus"
 )
@@ -30,12 +39,12 @@ const (
 	maxRetries = 15
 )
 
-func (b *Backup) runWorker() {
-	for b.processNextItem() {
+func (b *Backup) runWorker(ctx context.Context) {
+	for b.processNextItem(ctx) {
 	}
 }
 
-func (b *Backup) processNextItem() bool {
+func (b *Backup) processNextItem(ctx context.Context) bool {
 	// Wait until there is a new item in the working queue
 	key, quit := b.queue.Get()
 	if quit {
@@ -45,13 +54,13 @@ func (b *Backup) processNextItem() bool {
 	// This allows safe parallel processing because two pods with the same key are never processed in
 	// parallel.
 	defer b.queue.Done(key)
-	err := b.processItem(key.(string))
+	err := b.processItem(ctx, key.(string))
 	// Handle the error if something went wrong during the execution of the business logic
 	b.handleErr(err, key)
 	return true
 }
 
-func (b *Backup) processItem(key string) error {
+func (b *Backup) processItem(ctx context.Context, key string) error {
 	obj, exists, err := b.indexer.GetByKey(key)
 	if err != nil {
 		return err
@@ -66,7 +75,7 @@ func (b *Backup) processItem(key string) error {
 	if eb.Status.Succeeded || len(eb.Status.Reason) != 0 {
 		return nil
 	}
-	bs, err := b.handleBackup(&eb.Spec)
+	bs, err := b.handleBackup(ctx, &eb.Spec)
 	// Report backup status
 	b.reportBackupStatus(bs, err, eb)
 	return err
@@ -79,6 +88,13 @@ func (b *Backup) reportBackupStatus(bs *api.BackupCRStatus, berr error, eb *api.
 	} else {
 		eb.Status.Succeeded = true
 		eb.Status.S3Path = bs.S3Path
+		eb.Status.GCSPath = bs.GCSPath
+		eb.Status.ABSPath = bs.ABSPath
+		eb.Status.SwiftPath = bs.SwiftPath
+		eb.Status.OSSPath = bs.OSSPath
+		eb.Status.SFTPPath = bs.SFTPPath
+		eb.Status.PVPath = bs.PVPath
+		eb.Status.Unchanged = bs.Unchanged
 	}
 	_, err := b.backupCRCli.EtcdV1beta2().EtcdBackups(b.namespace).Update(eb)
 	if err != nil {
@@ -110,14 +126,89 @@ func (b *Backup) handleErr(err error, key interface{}) {
 	b.logger.Infof("Dropping etcd backup (%v) out of the queue: %v", key, err)
 }
 
-func (b *Backup) handleBackup(spec *api.BackupSpec) (*api.BackupCRStatus, error) {
+func (b *Backup) handleBackup(ctx context.Context, spec *api.BackupSpec) (*api.BackupCRStatus, error) {
+	if err := compression.Validate(spec.Compression, spec.CompressionLevel); err != nil {
+		return nil, err
+	}
+	if spec.MaxBackupAgeInDays < 0 {
+		return nil, errors.New("maxBackupAgeInDays value should be >= 0")
+	}
+	retention := backup.BackupRetentionPolicy{
+		MaxBackups:   spec.MaxBackups,
+		MaxBackupAge: time.Duration(spec.MaxBackupAgeInDays) * 24 * time.Hour,
+	}
+	if spec.HookTimeoutInSecond < 0 {
+		return nil, errors.New("hookTimeoutInSecond value should be >= 0")
+	}
+	hooks := backup.BackupHooks{
+		PreBackupJob:  spec.PreBackupHook,
+		PostBackupJob: spec.PostBackupHook,
+		Timeout:       time.Duration(spec.HookTimeoutInSecond) * time.Second,
+	}
+	if spec.DefragmentAfterNBackups < 0 {
+		return nil, errors.New("defragmentAfterNBackups value should be >= 0")
+	}
+	var defrag *backup.MemberDefragConfig
+	if spec.DefragmentAfterNBackups > 0 {
+		defrag = &backup.MemberDefragConfig{
+			AfterBackups: spec.DefragmentAfterNBackups,
+			Counter:      b.backupCounter(spec.ClusterName),
+		}
+	}
+	var nameTemplate *template.Template
+	if len(spec.BackupNameTemplate) != 0 {
+		var err error
+		if nameTemplate, err = util.ParseBackupNameTemplate(spec.BackupNameTemplate); err != nil {
+			return nil, fmt.Errorf("invalid backupNameTemplate (%s): %v", spec.BackupNameTemplate, err)
+		}
+	}
+	tc, err := b.etcdTLSConfig(spec.ClusterName)
+	if err != nil {
+		return nil, err
+	}
 	switch spec.StorageType {
 	case api.BackupStorageTypeS3:
-		s3path, err := handleS3(b.kubecli, spec.S3, b.namespace, spec.ClusterName)
+		s3path, unchanged, err := handleS3(ctx, b.kubecli, spec.S3, b.namespace, spec.ClusterName, tc, retention, hooks, defrag, nameTemplate, spec.Compression, spec.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		return &api.BackupCRStatus{S3Path: s3path, Unchanged: unchanged}, nil
+	case api.BackupStorageTypeGCS:
+		gcsPath, unchanged, err := handleGCS(ctx, b.kubecli, spec.GCS, b.namespace, spec.ClusterName, tc, retention, hooks, defrag, nameTemplate, spec.Compression, spec.CompressionLevel, b.gcsWorkloadIdentity)
+		if err != nil {
+			return nil, err
+		}
+		return &api.BackupCRStatus{GCSPath: gcsPath, Unchanged: unchanged}, nil
+	case api.BackupStorageTypeABS:
+		absPath, unchanged, err := handleABS(ctx, b.kubecli, spec.ABS, b.namespace, spec.ClusterName, tc, retention, hooks, defrag, nameTemplate, spec.Compression, spec.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		return &api.BackupCRStatus{ABSPath: absPath, Unchanged: unchanged}, nil
+	case api.BackupStorageTypeSwift:
+		swiftPath, unchanged, err := handleSwift(ctx, b.kubecli, spec.Swift, b.namespace, spec.ClusterName, tc, retention, hooks, defrag, nameTemplate, spec.Compression, spec.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		return &api.BackupCRStatus{SwiftPath: swiftPath, Unchanged: unchanged}, nil
+	case api.BackupStorageTypeOSS:
+		ossPath, unchanged, err := handleOSS(ctx, b.kubecli, spec.OSS, b.namespace, spec.ClusterName, tc, retention, hooks, defrag, nameTemplate, spec.Compression, spec.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		return &api.BackupCRStatus{OSSPath: ossPath, Unchanged: unchanged}, nil
+	case api.BackupStorageTypeSFTP:
+		sftpPath, unchanged, err := handleSFTP(ctx, b.kubecli, spec.SFTP, b.namespace, spec.ClusterName, tc, retention, hooks, defrag, nameTemplate, spec.Compression, spec.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		return &api.BackupCRStatus{SFTPPath: sftpPath, Unchanged: unchanged}, nil
+	case api.BackupStorageTypePersistentVolume:
+		pvPath, unchanged, err := handlePV(ctx, b.kubecli, spec.PV, b.namespace, spec.ClusterName, tc, retention, hooks, defrag, nameTemplate, spec.Compression, spec.CompressionLevel)
 		if err != nil {
 			return nil, err
 		}
-		return &api.BackupCRStatus{S3Path: s3path}, nil
+		return &api.BackupCRStatus{PVPath: pvPath, Unchanged: unchanged}, nil
 	default:
 		logrus.Fatalf("unknown StorageType: %v", spec.StorageType)
 	}
@@ -0,0 +1,94 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"path"
+	"text/template"
+
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/k8sutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// backupPrefix returns the path the backups of the given cluster are saved under in base, e.g. a bucket.
+// Every storage type uses the S3 path layout so that restore can locate the backups the same way.
+func backupPrefix(base, prefix, namespace, clusterName string) string {
+	return path.Join(base, backupapi.ToS3Prefix(prefix, namespace, clusterName))
+}
+
+// saveSnap saves a backup of the cluster under prefix with bm and returns the path of the backup.
+// If the cluster has not changed since the latest backup under prefix, no backup is saved:
+// the path of the latest backup is returned and unchanged is true.
+// The Jobs of hooks are run around the backup; if the pre-backup Job fails, no backup is saved.
+// The members of the cluster are defragmented after the backup if defrag is not nil and enough backups were counted.
+// The backup is named with nameTemplate if not nil.
+func saveSnap(ctx context.Context, bm *backup.BackupManager, prefix string, hooks backup.BackupHooks, defrag *backup.MemberDefragConfig,
+	nameTemplate *template.Template) (fullPath string, unchanged bool, err error) {
+	bm.RunHooks(hooks)
+	bm.SetNameTemplate(nameTemplate)
+	if defrag != nil {
+		bm.DefragmentMembersAfter(*defrag)
+	}
+	fullPath, err = bm.SaveSnapWithPrefix(ctx, prefix)
+	switch {
+	case err == backup.ErrSnapshotUnchanged:
+		return fullPath, true, nil
+	case writer.IsPartialWrite(err):
+		// the backup is saved by the primary writer; the failures of the others are logged.
+		return fullPath, false, nil
+	case err != nil:
+		return "", false, fmt.Errorf("failed to save snapshot (%v)", err)
+	}
+	return fullPath, false, nil
+}
+
+// backupCounter returns the counter of the backups of the given cluster until its members are defragmented.
+func (b *Backup) backupCounter(clusterName string) *backup.BackupCounter {
+	b.defragMu.Lock()
+	defer b.defragMu.Unlock()
+	if b.defragCounters == nil {
+		b.defragCounters = make(map[string]*backup.BackupCounter)
+	}
+	c, ok := b.defragCounters[clusterName]
+	if !ok {
+		c = &backup.BackupCounter{}
+		b.defragCounters[clusterName] = c
+	}
+	return c
+}
+
+// etcdTLSConfig returns the TLS config to talk to the given etcd cluster, or nil if it does not use TLS.
+func (b *Backup) etcdTLSConfig(clusterName string) (*tls.Config, error) {
+	ec, err := b.backupCRCli.EtcdV1beta2().EtcdClusters(b.namespace).Get(clusterName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get etcd cluster (%s): %v", clusterName, err)
+	}
+	if !ec.Spec.TLS.IsSecureClient() {
+		return nil, nil
+	}
+	d, err := k8sutil.GetTLSDataFromSecret(b.kubecli, b.namespace, ec.Spec.TLS.Static.OperatorSecret)
+	if err != nil {
+		return nil, err
+	}
+	return etcdutil.NewTLSConfig(d.CertData, d.KeyData, d.CAData)
+}
@@ -50,6 +50,14 @@ type Config struct {
 	KubeExtCli     apiextensionsclient.Interface
 	EtcdCRCli      versioned.Interface
 	CreateCRD      bool
+
+	// MemberFailureThreshold and MaxConcurrentReplacements configure the replacement of failed members.
+	// See cluster.Config.
+	MemberFailureThreshold    time.Duration
+	MaxConcurrentReplacements int
+
+	// GeneratePerClusterRBAC configures the ServiceAccount of the backup sidecars. See cluster.Config.
+	GeneratePerClusterRBAC bool
 }
 
 func New(cfg Config) *Controller {
@@ -116,6 +124,11 @@ func (c *Controller) makeClusterConfig() cluster.Config {
 		ServiceAccount: c.Config.ServiceAccount,
 		KubeCli:        c.Config.KubeCli,
 		EtcdCRCli:      c.Config.EtcdCRCli,
+
+		MemberFailureThreshold:    c.Config.MemberFailureThreshold,
+		MaxConcurrentReplacements: c.Config.MaxConcurrentReplacements,
+
+		GeneratePerClusterRBAC: c.Config.GeneratePerClusterRBAC,
 	}
 }
 
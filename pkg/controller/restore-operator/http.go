@@ -15,14 +15,23 @@
 package controller
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup"
 	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
 	"github.com/coreos/etcd-operator/pkg/backup/reader"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
 	"github.com/coreos/etcd-operator/pkg/util/awsutil/s3factory"
 
 	"github.com/sirupsen/logrus"
@@ -84,7 +93,11 @@ func (r *Restore) serveBackup(w http.ResponseWriter, req *http.Request) error {
 			return errors.New("invalid s3 restore source field (spec.s3), must specify all required subfields")
 		}
 
-		s3Cli, err := s3factory.NewClientFromSecret(r.kubecli, r.namespace, s3RestoreSource.AWSSecret)
+		s3Cli, err := s3factory.NewClientFromSecret(r.kubecli, r.namespace, s3RestoreSource.AWSSecret, s3factory.EndpointConfig{
+			Endpoint:           s3RestoreSource.Endpoint,
+			ForcePathStyle:     s3RestoreSource.ForcePathStyle,
+			InsecureSkipVerify: s3RestoreSource.InsecureSkipVerify,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to create S3 client: %v", err)
 		}
@@ -92,6 +105,16 @@ func (r *Restore) serveBackup(w http.ResponseWriter, req *http.Request) error {
 
 		backupReader = reader.NewS3Reader(s3Cli.S3)
 		path = s3RestoreSource.Path
+		if strings.HasSuffix(path, "/") {
+			prefix := strings.TrimSuffix(path, "/")
+			if path, err = backup.LatestBackupWithPrefix(writer.NewS3Writer(s3Cli.S3), prefix); err != nil {
+				return fmt.Errorf("failed to find the latest backup under (%s): %v", prefix, err)
+			}
+			if len(path) == 0 {
+				return fmt.Errorf("no backup found under (%s)", prefix)
+			}
+			logrus.Infof("restoring from the latest backup (%s)", path)
+		}
 	default:
 		return errors.New("restore CR must have a restore source specified")
 	}
@@ -101,10 +124,73 @@ func (r *Restore) serveBackup(w http.ResponseWriter, req *http.Request) error {
 		return fmt.Errorf("failed to read backup file(%v): %v", path, err)
 	}
 	defer rc.Close()
+	dr, err := compression.NewDecompressReader(path, rc)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
 
-	_, err = io.Copy(w, rc)
+	want, err := readChecksum(backupReader, path)
+	if err != nil {
+		return err
+	}
+	var snap io.Reader = dr
+	if len(want) != 0 {
+		f, err := spoolVerified(dr, path, want)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		snap = f
+	}
+
+	_, err = io.Copy(w, snap)
 	if err != nil {
 		return fmt.Errorf("failed to write backup to %s: %v", req.RemoteAddr, err)
 	}
 	return nil
 }
+
+// readChecksum returns the checksum saved next to the backup on path, or "" for the backups saved without one.
+func readChecksum(br reader.Reader, path string) (string, error) {
+	rc, err := br.Open(util.MakeChecksumName(path))
+	if os.IsNotExist(err) {
+		logrus.Warningf("backup (%s) has no checksum, serving it unverified", path)
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum of backup (%s): %v", path, err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum of backup (%s): %v", path, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// spoolVerified copies the snapshot into a temporary file and checks it against the checksum,
+// so that nothing is served to the seed member unless the whole snapshot matches.
+// The caller removes the returned file, which is positioned at its start.
+func spoolVerified(r io.Reader, path, want string) (*os.File, error) {
+	f, err := ioutil.TempFile("", "etcd-restore-")
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(f, h), r); err == nil {
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			err = fmt.Errorf("backup (%s) does not match its checksum: saved %s, computed %s", path, want, got)
+		}
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
@@ -85,6 +85,12 @@ func (gc *GC) collectResources(option metav1.ListOptions, runningSet map[types.U
 	if err := gc.collectDeployment(option, runningSet); err != nil {
 		gc.logger.Errorf("gc deployments failed: %v", err)
 	}
+	if err := gc.collectPVCs(option, runningSet); err != nil {
+		gc.logger.Errorf("gc PVCs failed: %v", err)
+	}
+	if err := gc.collectPDBs(option, runningSet); err != nil {
+		gc.logger.Errorf("gc PDBs failed: %v", err)
+	}
 }
 
 func (gc *GC) collectPods(option metav1.ListOptions, runningSet map[types.UID]bool) error {
@@ -158,3 +164,49 @@ func (gc *GC) collectDeployment(option metav1.ListOptions, runningSet map[types.
 
 	return nil
 }
+
+func (gc *GC) collectPVCs(option metav1.ListOptions, runningSet map[types.UID]bool) error {
+	pvcs, err := gc.kubecli.CoreV1().PersistentVolumeClaims(gc.ns).List(option)
+	if err != nil {
+		return err
+	}
+
+	for _, pvc := range pvcs.Items {
+		// The PVC of the backup sidecar has no owner and outlives its cluster.
+		if len(pvc.OwnerReferences) == 0 {
+			continue
+		}
+		if !runningSet[pvc.OwnerReferences[0].UID] {
+			err = gc.kubecli.CoreV1().PersistentVolumeClaims(gc.ns).Delete(pvc.GetName(), nil)
+			if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+				return err
+			}
+			gc.logger.Infof("deleted PVC (%v)", pvc.GetName())
+		}
+	}
+
+	return nil
+}
+
+func (gc *GC) collectPDBs(option metav1.ListOptions, runningSet map[types.UID]bool) error {
+	pdbs, err := gc.kubecli.PolicyV1beta1().PodDisruptionBudgets(gc.ns).List(option)
+	if err != nil {
+		return err
+	}
+
+	for _, pdb := range pdbs.Items {
+		if len(pdb.OwnerReferences) == 0 {
+			gc.logger.Warningf("failed to check PDB %s: no owner", pdb.GetName())
+			continue
+		}
+		if !runningSet[pdb.OwnerReferences[0].UID] {
+			err = gc.kubecli.PolicyV1beta1().PodDisruptionBudgets(gc.ns).Delete(pdb.GetName(), nil)
+			if err != nil && !k8sutil.IsKubernetesResourceNotFoundError(err) {
+				return err
+			}
+			gc.logger.Infof("deleted PDB (%v)", pdb.GetName())
+		}
+	}
+
+	return nil
+}
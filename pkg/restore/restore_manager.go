@@ -0,0 +1,327 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/backup"
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/util/constants"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+	"github.com/coreos/etcd-operator/pkg/util/retryutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// tmpEtcdClientURL and tmpEtcdPeerURL are the URLs the temporary etcd listens on.
+	tmpEtcdClientURL = "http://127.0.0.1:2379"
+	tmpEtcdPeerURL   = "http://127.0.0.1:2380"
+
+	tmpEtcdStartInterval   = time.Second
+	tmpEtcdStartMaxRetries = 60
+)
+
+// RestoreManager restores the data directory of an etcd member from
+// the backups saved in a backend. It runs where the etcd binaries are
+// available, e.g. in an init container of the etcd pod.
+type RestoreManager struct {
+	be backend.Backend
+	// etcdVersion is the version of etcd which runs on the restored data directory.
+	etcdVersion string
+	member      *etcdutil.Member
+	token       string
+	dataDir     string
+}
+
+// NewRestoreManager creates a RestoreManager which restores the data directory dataDir
+// of member m, which runs etcd etcdVersion in the cluster with the given cluster token.
+func NewRestoreManager(be backend.Backend, etcdVersion string, m *etcdutil.Member, token, dataDir string) *RestoreManager {
+	return &RestoreManager{
+		be:          be,
+		etcdVersion: etcdVersion,
+		member:      m,
+		token:       token,
+		dataDir:     dataDir,
+	}
+}
+
+// RestoreFromLatest restores the data directory from the latest backup
+// and returns the name of the backup restored from.
+func (rm *RestoreManager) RestoreFromLatest() (string, error) {
+	name, err := rm.be.GetLatest()
+	if err != nil {
+		return "", fmt.Errorf("failed to get latest backup: %v", err)
+	}
+	if len(name) == 0 {
+		return "", fmt.Errorf("no backup found")
+	}
+	return name, rm.restore(name, true)
+}
+
+// RestoreFromRevision restores the data directory from the backup taken at revision rev
+// and returns the name of the backup restored from. The deltas saved on top of the backup
+// are not replayed, so the data is restored as of rev.
+func (rm *RestoreManager) RestoreFromRevision(rev int64) (string, error) {
+	backups, err := rm.be.List()
+	if err != nil {
+		return "", fmt.Errorf("failed to list backups: %v", err)
+	}
+	for _, b := range backups {
+		if b.Revision == rev {
+			return b.Name, rm.restore(b.Name, false)
+		}
+	}
+	return "", fmt.Errorf("no backup found at revision %d", rev)
+}
+
+// RestoreFromName restores the data directory from the backup of the given name, as listed by the backend,
+// and returns the name. The deltas saved on top of the backup are not replayed, so the data is restored
+// as of the revision of the backup.
+func (rm *RestoreManager) RestoreFromName(name string) (string, error) {
+	if !util.IsBackup(name) {
+		return "", fmt.Errorf("invalid backup name (%s)", name)
+	}
+	return name, rm.restore(name, false)
+}
+
+// restore restores the data dir from the given backup, and replays the deltas saved on top of it if replayDeltas is true.
+func (rm *RestoreManager) restore(name string, replayDeltas bool) error {
+	if _, err := os.Stat(rm.dataDir); err == nil {
+		return fmt.Errorf("data dir (%s) already exists", rm.dataDir)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	ok, err := backup.IsBackupCompatible(rm.etcdVersion, name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("backup (%s) is not compatible with etcd version (%s)", name, rm.etcdVersion)
+	}
+	if err = rm.checkClusterMetadata(name); err != nil {
+		return err
+	}
+
+	snapFile, err := rm.fetch(name)
+	if err != nil {
+		return fmt.Errorf("failed to fetch backup (%s): %v", name, err)
+	}
+	defer os.Remove(snapFile)
+
+	if err = rm.restoreDataDir(snapFile); err != nil {
+		return err
+	}
+	var replay func(clientv3.KV) error
+	if replayDeltas {
+		baseRev := util.MustParseRevision(name)
+		replay = func(kv clientv3.KV) error {
+			return rm.replayDeltas(kv, baseRev)
+		}
+	}
+	if err = rm.bootstrap(replay); err != nil {
+		return err
+	}
+	logrus.Infof("restored data dir (%s) from backup (%s)", rm.dataDir, name)
+	return nil
+}
+
+// checkClusterMetadata checks the backup against the metadata of the cluster saved with it, if any:
+// the etcd version of the cluster must be compatible, and the revision must be the revision of the backup.
+func (rm *RestoreManager) checkClusterMetadata(name string) error {
+	md, err := backup.ReadClusterMetadata(rm.be, name)
+	if err != nil {
+		return err
+	}
+	if md == nil {
+		logrus.Infof("backup (%s) has no cluster metadata, restoring from it unchecked", name)
+		return nil
+	}
+	ok, err := backup.IsVersionCompatible(rm.etcdVersion, md.EtcdVersion)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("backup (%s) taken from etcd version (%s) is not compatible with etcd version (%s)", name, md.EtcdVersion, rm.etcdVersion)
+	}
+	if rev, err := util.ParseRevision(name); err == nil && rev != md.Revision {
+		return fmt.Errorf("backup (%s) does not match its cluster metadata: revision %d, want %d", name, md.Revision, rev)
+	}
+	logrus.Infof("restoring backup (%s) of cluster (%s/%s) of %d member(s), taken at revision %d from etcd version (%s)",
+		name, md.Namespace, md.ClusterName, md.ClusterSize, md.Revision, md.EtcdVersion)
+	return nil
+}
+
+// fetch copies the backup into a temporary file next to the data dir and returns its path.
+// Compressed backups are decompressed, since etcdctl restores from the snapshot as is.
+// The snapshot must match the checksum saved with the backup, if any.
+func (rm *RestoreManager) fetch(name string) (string, error) {
+	want, err := rm.readChecksum(name)
+	if err != nil {
+		return "", err
+	}
+	rc, err := rm.be.Open(name)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("backup (%s) not found", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	dr, err := compression.NewDecompressReader(name, rc)
+	if err != nil {
+		rc.Close()
+		return "", err
+	}
+	defer dr.Close()
+
+	f, err := ioutil.TempFile(filepath.Dir(rm.dataDir), name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(f, h), dr); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); len(want) != 0 && got != want {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("backup (%s) does not match its checksum: saved %s, computed %s", name, want, got)
+	}
+	if err = f.Sync(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// readChecksum returns the checksum saved with the backup, or "" for the backups saved without one.
+func (rm *RestoreManager) readChecksum(name string) (string, error) {
+	rc, err := rm.be.Open(util.MakeChecksumName(name))
+	if os.IsNotExist(err) {
+		logrus.Warningf("backup (%s) has no checksum, restoring from it unverified", name)
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open checksum of backup (%s): %v", name, err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum of backup (%s): %v", name, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// restoreDataDir seeds the data dir from the snapshot file as a single member cluster,
+// with etcdutl from etcd 3.5 and etcdctl before.
+func (rm *RestoreManager) restoreDataDir(snapFile string) error {
+	m := rm.member
+	tool := "etcdctl"
+	if etcdutil.RestoresWithEtcdutl(rm.etcdVersion) {
+		tool = "etcdutl"
+	}
+	cmd := exec.Command(tool, "snapshot", "restore", snapFile,
+		"--name", m.Name,
+		"--initial-cluster", fmt.Sprintf("%s=%s", m.Name, m.PeerURL()),
+		"--initial-cluster-token", rm.token,
+		"--initial-advertise-peer-urls", m.PeerURL(),
+		"--data-dir", rm.dataDir)
+	cmd.Env = append(os.Environ(), "ETCDCTL_API=3")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s snapshot restore failed: %v: %s", tool, err, out)
+	}
+	return nil
+}
+
+// replayDeltas applies the deltas saved on top of the backup at baseRev through kv.
+func (rm *RestoreManager) replayDeltas(kv clientv3.KV, baseRev int64) error {
+	rev, err := backup.ReplayDeltas(rm.be, kv, baseRev)
+	if err != nil {
+		return fmt.Errorf("failed to replay deltas: %v", err)
+	}
+	if rev > baseRev {
+		logrus.Infof("replayed deltas on top of revision %d up to revision %d", baseRev, rev)
+	}
+	return nil
+}
+
+// bootstrap runs a temporary etcd on the restored data dir until it serves requests,
+// so that the cluster bootstraps from an initialized member. If replay is not nil,
+// it is called with the temporary etcd once it serves requests.
+func (rm *RestoreManager) bootstrap(replay func(clientv3.KV) error) error {
+	cmd := exec.Command("etcd",
+		"--name", rm.member.Name,
+		"--data-dir", rm.dataDir,
+		"--listen-client-urls", tmpEtcdClientURL,
+		"--advertise-client-urls", tmpEtcdClientURL,
+		"--listen-peer-urls", tmpEtcdPeerURL)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start temporary etcd: %v", err)
+	}
+	defer func() {
+		cmd.Process.Signal(syscall.SIGTERM)
+		cmd.Wait()
+	}()
+
+	cfg := clientv3.Config{
+		Endpoints:   []string{tmpEtcdClientURL},
+		DialTimeout: constants.DefaultDialTimeout,
+	}
+	var etcdcli *clientv3.Client
+	err := retryutil.Retry(tmpEtcdStartInterval, tmpEtcdStartMaxRetries, func() (bool, error) {
+		cli, err := clientv3.New(cfg)
+		if err != nil {
+			return false, nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), constants.DefaultRequestTimeout)
+		_, err = cli.Get(ctx, "/", clientv3.WithCountOnly())
+		cancel()
+		if err != nil {
+			cli.Close()
+			return false, nil
+		}
+		etcdcli = cli
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("temporary etcd did not become ready: %v", err)
+	}
+	defer etcdcli.Close()
+
+	if replay != nil {
+		return replay(etcdcli.KV)
+	}
+	return nil
+}
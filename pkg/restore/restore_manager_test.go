@@ -0,0 +1,215 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/etcd-operator/pkg/backup/backend"
+	"github.com/coreos/etcd-operator/pkg/backup/compression"
+	"github.com/coreos/etcd-operator/pkg/backup/util"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/coreos/etcd/clientv3"
+	"golang.org/x/net/context"
+)
+
+func newTestRestoreManager(t *testing.T, etcdVersion string, backups []string) (*RestoreManager, string) {
+	dir, err := ioutil.TempDir("", "etcd-operator-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bdir := filepath.Join(dir, "backup")
+	if err = os.Mkdir(bdir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range backups {
+		if err = ioutil.WriteFile(filepath.Join(bdir, n), []byte(n), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &etcdutil.Member{Name: "example-0000", Namespace: "default"}
+	return NewRestoreManager(backend.NewFileBackend(bdir), etcdVersion, m, "token", filepath.Join(dir, "data")), dir
+}
+
+func TestRestoreFromRevisionNotFound(t *testing.T) {
+	rm, dir := newTestRestoreManager(t, "3.1.9", []string{util.MakeBackupName("3.1.9", 1)})
+	defer os.RemoveAll(dir)
+
+	_, err := rm.RestoreFromRevision(2)
+	if err == nil || !strings.Contains(err.Error(), "no backup found") {
+		t.Errorf("expect no backup found error, get=%v", err)
+	}
+}
+
+func TestRestoreFromNameNotFound(t *testing.T) {
+	rm, dir := newTestRestoreManager(t, "3.1.9", []string{util.MakeBackupName("3.1.9", 1)})
+	defer os.RemoveAll(dir)
+
+	_, err := rm.RestoreFromName(util.MakeBackupName("3.1.9", 2))
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expect backup not found error, get=%v", err)
+	}
+	if _, err = rm.RestoreFromName("3.1.9_0000000000000001_etcd.backup.sha256"); err == nil {
+		t.Error("expect error restoring from a file which is not a backup")
+	}
+}
+
+func TestRestoreFromLatestNoBackup(t *testing.T) {
+	rm, dir := newTestRestoreManager(t, "3.1.9", nil)
+	defer os.RemoveAll(dir)
+
+	_, err := rm.RestoreFromLatest()
+	if err == nil || !strings.Contains(err.Error(), "no backup found") {
+		t.Errorf("expect no backup found error, get=%v", err)
+	}
+}
+
+func TestRestoreIncompatibleVersion(t *testing.T) {
+	backups := []string{
+		util.MakeBackupName("3.1.9", 1),
+		util.MakeBackupName("3.2.0", 2),
+	}
+	rm, dir := newTestRestoreManager(t, "3.0.17", backups)
+	defer os.RemoveAll(dir)
+
+	name, err := rm.RestoreFromLatest()
+	if name != backups[1] {
+		t.Errorf("backup name = %s, want %s", name, backups[1])
+	}
+	if err == nil || !strings.Contains(err.Error(), "not compatible") {
+		t.Errorf("expect not compatible error, get=%v", err)
+	}
+}
+
+func TestRestoreDataDirExists(t *testing.T) {
+	rm, dir := newTestRestoreManager(t, "3.1.9", []string{util.MakeBackupName("3.1.9", 1)})
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(rm.dataDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := rm.RestoreFromRevision(1)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expect data dir exists error, get=%v", err)
+	}
+}
+
+// TestFetchCompressed ensures compressed backups are fetched decompressed for etcdctl.
+func TestFetchCompressed(t *testing.T) {
+	rm, dir := newTestRestoreManager(t, "3.1.9", nil)
+	defer os.RemoveAll(dir)
+
+	data := strings.Repeat("snapshot data", 1024)
+	name := compression.MakeName(util.MakeBackupName("3.1.9", 1), compression.Gzip)
+	cr := compression.NewCompressReader(strings.NewReader(data), compression.Gzip, compression.DefaultLevel)
+	compressed, err := ioutil.ReadAll(cr)
+	cr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "backup", name), compressed, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	snapFile, err := rm.fetch(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(snapFile)
+	got, err := ioutil.ReadFile(snapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("fetched %d bytes, want the %d bytes of the snapshot", len(got), len(data))
+	}
+}
+
+// TestFetchChecksumMismatch ensures a backup which does not match its checksum is refused.
+func TestFetchChecksumMismatch(t *testing.T) {
+	name := util.MakeBackupName("3.1.9", 1)
+	rm, dir := newTestRestoreManager(t, "3.1.9", []string{name})
+	defer os.RemoveAll(dir)
+
+	sum := sha256.Sum256([]byte(name))
+	cpath := filepath.Join(dir, "backup", util.MakeChecksumName(name))
+	if err := ioutil.WriteFile(cpath, []byte(hex.EncodeToString(sum[:])), 0600); err != nil {
+		t.Fatal(err)
+	}
+	snapFile, err := rm.fetch(name)
+	if err != nil {
+		t.Fatalf("expect backup to match its checksum, get=%v", err)
+	}
+	os.Remove(snapFile)
+
+	bad := sha256.Sum256([]byte("corrupted"))
+	if err = ioutil.WriteFile(cpath, []byte(hex.EncodeToString(bad[:])), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = rm.fetch(name)
+	if err == nil || !strings.Contains(err.Error(), hex.EncodeToString(sum[:])) || !strings.Contains(err.Error(), hex.EncodeToString(bad[:])) {
+		t.Errorf("expect checksum mismatch error naming both checksums, get=%v", err)
+	}
+}
+
+type fakeKV struct {
+	clientv3.KV
+	data map[string]string
+}
+
+func (kv *fakeKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	kv.data[key] = val
+	return &clientv3.PutResponse{}, nil
+}
+
+func (kv *fakeKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	delete(kv.data, key)
+	return &clientv3.DeleteResponse{}, nil
+}
+
+// TestReplayDeltas ensures only the deltas saved on top of the restored backup are replayed.
+func TestReplayDeltas(t *testing.T) {
+	rm, dir := newTestRestoreManager(t, "3.1.9", []string{util.MakeBackupName("3.1.9", 2)})
+	defer os.RemoveAll(dir)
+
+	// the keys and values are base64 encoded by the JSON encoding of the deltas.
+	deltas := map[string]string{
+		util.MakeDeltaName("3.1.9", 1): `{"key":"YQ==","value":"MA==","rev":1}`, // "a" = "0", older than the backup
+		util.MakeDeltaName("3.1.9", 3): `{"key":"YQ==","value":"MQ==","rev":3}`, // "a" = "1"
+		util.MakeDeltaName("3.1.9", 4): `{"delete":true,"key":"Yg==","rev":4}`,  // delete "b"
+	}
+	for n, d := range deltas {
+		if err := ioutil.WriteFile(filepath.Join(dir, "backup", n), []byte(d+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kv := &fakeKV{data: map[string]string{"b": "2"}}
+	if err := rm.replayDeltas(kv, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "1"}
+	if !reflect.DeepEqual(kv.data, want) {
+		t.Errorf("expect data %v, got %v", want, kv.data)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ossfactory
+
+import (
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// OSSClient is a wrapper for Alibaba Cloud OSS client.
+type OSSClient struct {
+	OSS *oss.Client
+}
+
+// NewClientFromSecret returns an OSS client for the given endpoint based on given k8s secret containing an AccessKey.
+func NewClientFromSecret(kubecli kubernetes.Interface, namespace, endpoint, ossSecret string) (w *OSSClient, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("new OSS client failed: %v", err)
+		}
+	}()
+
+	if len(endpoint) == 0 {
+		return nil, fmt.Errorf("OSS endpoint is not specified")
+	}
+	se, err := kubecli.CoreV1().Secrets(namespace).Get(ossSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get k8s secret: %v", err)
+	}
+	for _, k := range []string{api.OSSAccessKeyID, api.OSSAccessKeySecret} {
+		if len(se.Data[k]) == 0 {
+			return nil, fmt.Errorf("secret (%s) has no '%s' entry", ossSecret, k)
+		}
+	}
+
+	c, err := oss.New(endpoint, string(se.Data[api.OSSAccessKeyID]), string(se.Data[api.OSSAccessKeySecret]))
+	if err != nil {
+		return nil, err
+	}
+	return &OSSClient{OSS: c}, nil
+}
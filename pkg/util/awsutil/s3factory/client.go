@@ -15,13 +15,18 @@
 package s3factory
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/credentials"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -38,8 +43,70 @@ type S3Client struct {
 	configDir string
 }
 
+// EndpointConfig describes how to reach a S3 compatible service other than AWS S3, e.g. Minio or Ceph RGW.
+// The zero value means AWS S3.
+type EndpointConfig struct {
+	// Endpoint overrides the AWS S3 endpoint.
+	Endpoint string
+	// ForcePathStyle forces path-style addressing, "<endpoint>/<bucket>/<key>".
+	ForcePathStyle bool
+	// InsecureSkipVerify disables TLS certificate verification of the endpoint.
+	InsecureSkipVerify bool
+	// CABundle is a PEM encoded CA bundle used to verify the endpoint.
+	CABundle []byte
+}
+
+// NewEndpointConfig returns the EndpointConfig of the given S3 source.
+func NewEndpointConfig(s *api.S3Source) EndpointConfig {
+	return EndpointConfig{
+		Endpoint:           s.Endpoint,
+		ForcePathStyle:     s.ForcePathStyle,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+}
+
+// Apply sets up the AWS session options to reach the endpoint.
+func (ec EndpointConfig) Apply(so *session.Options) {
+	if len(ec.Endpoint) != 0 {
+		so.Config.Endpoint = aws.String(ec.Endpoint)
+	}
+	if ec.ForcePathStyle {
+		so.Config.S3ForcePathStyle = aws.Bool(true)
+	}
+	if ec.InsecureSkipVerify {
+		so.Config.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+	}
+	if len(ec.CABundle) != 0 {
+		so.CustomCABundle = bytes.NewReader(ec.CABundle)
+	}
+}
+
+// NewClient returns a S3 client for the given S3 source, with the credentials in its AWS secret,
+// with the default credential chain if the source uses it, see NewClientFromDefaultChain,
+// or with the credentials from Vault if the source is configured with it.
+func NewClient(kubecli kubernetes.Interface, namespace string, s *api.S3Source) (*S3Client, error) {
+	if s.UseDefaultCredentialChain {
+		return NewClientFromDefaultChain(NewEndpointConfig(s))
+	}
+	if s.Vault != nil {
+		p, err := credentials.NewVaultCredentialProvider(kubecli, namespace, credentials.EngineAWS, s.Vault)
+		if err != nil {
+			return nil, fmt.Errorf("new S3 client failed: %v", err)
+		}
+		return NewClientFromProvider(p, NewEndpointConfig(s))
+	}
+	return NewClientFromSecret(kubecli, namespace, s.AWSSecret, NewEndpointConfig(s))
+}
+
 // NewClientFromSecret returns a S3 client based on given k8s secret containing aws credentials.
-func NewClientFromSecret(kubecli kubernetes.Interface, namespace, awsSecret string) (w *S3Client, err error) {
+// The client talks to the endpoint described by ec; if the secret has a CA bundle, it is used
+// unless ec has its own.
+func NewClientFromSecret(kubecli kubernetes.Interface, namespace, awsSecret string, ec EndpointConfig) (w *S3Client, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("new S3 client failed: %v", err)
@@ -54,6 +121,7 @@ func NewClientFromSecret(kubecli kubernetes.Interface, namespace, awsSecret stri
 	if err != nil {
 		return nil, fmt.Errorf("failed to setup aws config: (%v)", err)
 	}
+	ec.Apply(so)
 	sess, err := session.NewSessionWithOptions(*so)
 	if err != nil {
 		return nil, fmt.Errorf("new AWS session failed: %v", err)
@@ -62,6 +130,29 @@ func NewClientFromSecret(kubecli kubernetes.Interface, namespace, awsSecret stri
 	return w, nil
 }
 
+// NewSessionFromProvider returns an AWS session with the credentials of p.
+// The region is read from the environment or the shared config of so.
+func NewSessionFromProvider(so session.Options, p credentials.CredentialProvider) (*session.Session, error) {
+	so.Config.Credentials = credentials.NewAWSCredentials(p)
+	sess, err := session.NewSessionWithOptions(so)
+	if err != nil {
+		return nil, fmt.Errorf("new AWS session failed: %v", err)
+	}
+	return sess, nil
+}
+
+// NewClientFromProvider returns a S3 client with the credentials of p, e.g. short-lived credentials from Vault.
+// The client talks to the endpoint described by ec.
+func NewClientFromProvider(p credentials.CredentialProvider, ec EndpointConfig) (*S3Client, error) {
+	so := session.Options{SharedConfigState: session.SharedConfigEnable}
+	ec.Apply(&so)
+	sess, err := NewSessionFromProvider(so, p)
+	if err != nil {
+		return nil, fmt.Errorf("new S3 client failed: %v", err)
+	}
+	return &S3Client{S3: s3.New(sess)}, nil
+}
+
 // Close cleans up all intermediate resources for creating S3 client.
 func (w *S3Client) Close() {
 	os.RemoveAll(w.configDir)
@@ -97,5 +188,10 @@ func setupAWSConfig(kubecli kubernetes.Interface, ns, secret, configDir string)
 		options.SharedConfigFiles = append(options.SharedConfigFiles, configFile)
 	}
 
+	ca := se.Data[api.AWSSecretCABundleFileName]
+	if len(ca) != 0 {
+		options.CustomCABundle = bytes.NewReader(ca)
+	}
+
 	return options, nil
 }
@@ -0,0 +1,176 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3factory
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/reader"
+	"github.com/coreos/etcd-operator/pkg/backup/writer"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace = "default"
+	testAWSSecret = "aws"
+)
+
+func newFakeKubeClient() kubernetes.Interface {
+	return fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: testAWSSecret, Namespace: testNamespace},
+		Data: map[string][]byte{
+			api.AWSSecretCredentialsFileName: []byte("[default]\naws_access_key_id = fake\naws_secret_access_key = fake\n"),
+			api.AWSSecretConfigFileName:      []byte("[default]\nregion = us-east-1\n"),
+		},
+	})
+}
+
+// newFakeS3Server returns a server which stores objects in memory keyed by the request path.
+// It only understands path-style requests to put and get objects.
+func newFakeS3Server(tlsEnabled bool) *httptest.Server {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			objects[r.URL.Path] = b
+			w.Header().Set("ETag", `"fake"`)
+		case http.MethodGet:
+			b, ok := objects[r.URL.Path]
+			if !ok {
+				http.Error(w, "NoSuchKey", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			w.Write(b)
+		default:
+			http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		}
+	})
+	if tlsEnabled {
+		return httptest.NewTLSServer(h)
+	}
+	return httptest.NewServer(h)
+}
+
+func TestEndpointConfigURL(t *testing.T) {
+	kubecli := newFakeKubeClient()
+	tests := []struct {
+		ec   EndpointConfig
+		want string
+	}{{
+		ec:   EndpointConfig{Endpoint: "http://minio.minio.svc:9000", ForcePathStyle: true},
+		want: "http://minio.minio.svc:9000/bucket/prefix/key",
+	}, {
+		ec:   EndpointConfig{Endpoint: "http://minio.minio.svc:9000"},
+		want: "http://bucket.minio.minio.svc:9000/prefix/key",
+	}}
+	for i, tt := range tests {
+		cli, err := NewClientFromSecret(kubecli, testNamespace, testAWSSecret, tt.ec)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		req, _ := cli.S3.GetObjectRequest(&s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("prefix/key"),
+		})
+		if err = req.Build(); err != nil {
+			t.Fatalf("#%d: failed to build request: %v", i, err)
+		}
+		if got := req.HTTPRequest.URL.String(); got != tt.want {
+			t.Errorf("#%d: url = %s, want %s", i, got, tt.want)
+		}
+		cli.Close()
+	}
+}
+
+func TestPathStyleWriteAndRead(t *testing.T) {
+	kubecli := newFakeKubeClient()
+	tests := []struct {
+		tls      bool
+		insecure bool
+		withCA   bool
+		wok      bool
+	}{
+		{tls: false, wok: true},
+		{tls: true, insecure: true, wok: true},
+		{tls: true, withCA: true, wok: true},
+		// self-signed certificate is rejected by default.
+		{tls: true, wok: false},
+	}
+	for i, tt := range tests {
+		ts := newFakeS3Server(tt.tls)
+		ec := EndpointConfig{
+			Endpoint:           ts.URL,
+			ForcePathStyle:     true,
+			InsecureSkipVerify: tt.insecure,
+		}
+		if tt.withCA {
+			ec.CABundle = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+		}
+		cli, err := NewClientFromSecret(kubecli, testNamespace, testAWSSecret, ec)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		p := "bucket/v1/default/example/3.1.10_0000000000000001_etcd.backup"
+		data := []byte("etcd snapshot")
+		n, err := writer.NewS3Writer(cli.S3).Write(context.Background(), p, bytes.NewReader(data))
+		if (err == nil) != tt.wok {
+			t.Errorf("#%d: write error = %v, want ok %v", i, err, tt.wok)
+		}
+		if tt.wok {
+			if n != int64(len(data)) {
+				t.Errorf("#%d: written size = %d, want %d", i, n, len(data))
+			}
+			rc, err := reader.NewS3Reader(cli.S3).Open(p)
+			if err != nil {
+				t.Fatalf("#%d: failed to open %s: %v", i, p, err)
+			}
+			b, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("#%d: failed to read %s: %v", i, p, err)
+			}
+			if !bytes.Equal(b, data) {
+				t.Errorf("#%d: read %q, want %q", i, b, data)
+			}
+		}
+		cli.Close()
+		ts.Close()
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3factory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	// The environment IAM Roles for Service Accounts (IRSA) sets up in the pods of annotated service accounts.
+	envRoleARN              = "AWS_ROLE_ARN"
+	envWebIdentityTokenFile = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	envRoleSessionName      = "AWS_ROLE_SESSION_NAME"
+
+	defaultRoleSessionName = "etcd-operator"
+
+	// WebIdentityProviderName is the name of the provider of the credentials assumed with a web identity token.
+	WebIdentityProviderName = "WebIdentityProvider"
+
+	// webIdentityExpiryWindow is how long before they expire the credentials are refreshed.
+	webIdentityExpiryWindow = 5 * time.Minute
+)
+
+// webIdentityProvider retrieves the credentials of a role assumed with a web identity token,
+// e.g. the projected service account token of IRSA. The token is read from its file on each
+// retrieval, so that the credentials are refreshed with the rotated token once they expire.
+type webIdentityProvider struct {
+	credentials.Expiry
+
+	client          *sts.STS
+	roleARN         string
+	roleSessionName string
+	tokenFile       string
+}
+
+func (p *webIdentityProvider) Retrieve() (credentials.Value, error) {
+	token, err := ioutil.ReadFile(p.tokenFile)
+	if err != nil {
+		return credentials.Value{ProviderName: WebIdentityProviderName}, fmt.Errorf("failed to read web identity token: %v", err)
+	}
+	resp, err := p.client.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(p.roleARN),
+		RoleSessionName:  aws.String(p.roleSessionName),
+		WebIdentityToken: aws.String(strings.TrimSpace(string(token))),
+	})
+	if err != nil {
+		return credentials.Value{ProviderName: WebIdentityProviderName}, fmt.Errorf("failed to assume role (%s) with web identity: %v", p.roleARN, err)
+	}
+	p.SetExpiration(aws.TimeValue(resp.Credentials.Expiration), webIdentityExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(resp.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(resp.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(resp.Credentials.SessionToken),
+		ProviderName:    WebIdentityProviderName,
+	}, nil
+}
+
+// NewSessionFromDefaultChain returns an AWS session with the default credential chain of the SDK:
+// the environment, the shared files, then the ECS task role or the EC2 instance profile.
+// If IRSA is set up in the environment, the role of the service account is assumed instead.
+// The credentials are refreshed before they expire, so the session can be used for weeks.
+func NewSessionFromDefaultChain(so session.Options) (*session.Session, error) {
+	sess, err := session.NewSessionWithOptions(so)
+	if err != nil {
+		return nil, fmt.Errorf("new AWS session failed: %v", err)
+	}
+	roleARN, tokenFile := os.Getenv(envRoleARN), os.Getenv(envWebIdentityTokenFile)
+	if len(roleARN) == 0 || len(tokenFile) == 0 {
+		return sess, nil
+	}
+	sessionName := os.Getenv(envRoleSessionName)
+	if len(sessionName) == 0 {
+		sessionName = defaultRoleSessionName
+	}
+	// AssumeRoleWithWebIdentity is authenticated by the token, not by credentials.
+	stscli := sts.New(sess, aws.NewConfig().WithCredentials(credentials.AnonymousCredentials))
+	sess.Config.Credentials = credentials.NewCredentials(&webIdentityProvider{
+		client:          stscli,
+		roleARN:         roleARN,
+		roleSessionName: sessionName,
+		tokenFile:       tokenFile,
+	})
+	return sess, nil
+}
+
+// NewClientFromDefaultChain returns a S3 client with the credentials of NewSessionFromDefaultChain,
+// for the pods whose service account or node has access to S3 without a secret.
+// The client talks to the endpoint described by ec.
+func NewClientFromDefaultChain(ec EndpointConfig) (*S3Client, error) {
+	so := session.Options{SharedConfigState: session.SharedConfigEnable}
+	ec.Apply(&so)
+	sess, err := NewSessionFromDefaultChain(so)
+	if err != nil {
+		return nil, fmt.Errorf("new S3 client failed: %v", err)
+	}
+	return &S3Client{S3: s3.New(sess)}, nil
+}
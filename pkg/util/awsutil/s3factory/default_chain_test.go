@@ -0,0 +1,96 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3factory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const testSTSResponse = `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>AKID</AccessKeyId>
+      <SecretAccessKey>SECRET</SecretAccessKey>
+      <SessionToken>SESSION</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`
+
+// TestWebIdentityProvider ensures the credentials are assumed with the token in the token file,
+// which is read again on each retrieval to pick up the rotated token.
+func TestWebIdentityProvider(t *testing.T) {
+	var tokens []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tokens = append(tokens, r.FormValue("WebIdentityToken"))
+		fmt.Fprintf(w, testSTSResponse, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "web-identity-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	sess, err := session.NewSession(aws.NewConfig().
+		WithRegion("us-east-1").
+		WithEndpoint(ts.URL).
+		WithCredentials(credentials.AnonymousCredentials))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &webIdentityProvider{
+		client:          sts.New(sess),
+		roleARN:         "arn:aws:iam::123456789012:role/etcd-backup",
+		roleSessionName: defaultRoleSessionName,
+		tokenFile:       f.Name(),
+	}
+	for _, token := range []string{"token-1", "token-2"} {
+		if err = ioutil.WriteFile(f.Name(), []byte(token+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		v, err := p.Retrieve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.AccessKeyID != "AKID" || v.SecretAccessKey != "SECRET" || v.SessionToken != "SESSION" {
+			t.Errorf("credentials = %+v, want AKID/SECRET/SESSION", v)
+		}
+		if p.IsExpired() {
+			t.Error("expect credentials valid for an hour not to be expired")
+		}
+	}
+	if want := []string{"token-1", "token-2"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("tokens = %v, want %v", tokens, want)
+	}
+}
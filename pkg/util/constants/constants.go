@@ -23,6 +23,11 @@ const (
 	DefaultSnapshotInterval = 1800 * time.Second
 
 	DefaultBackupPodHTTPPort = 19999
+	// DefaultBackupPodSnapshotPort is the port etcd members download the latest backup from.
+	DefaultBackupPodSnapshotPort = 19998
+	// DefaultBackupPodHealthPort is the port the health checks of the backup sidecar are served on without TLS
+	// if its HTTP API requires client certificates, which the kubelet probes can't present.
+	DefaultBackupPodHealthPort = 19997
 
 	OperatorRoot   = "/var/tmp/etcd-operator"
 	BackupMountDir = "/var/etcd-backup"
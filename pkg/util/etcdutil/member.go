@@ -23,6 +23,9 @@ import (
 	"strings"
 )
 
+// DefaultClientPort is the port the etcd members serve their clients on.
+const DefaultClientPort = 2379
+
 type Member struct {
 	Name string
 	// Kubernetes namespace this member runs in.
@@ -34,6 +37,12 @@ type Member struct {
 
 	SecurePeer   bool
 	SecureClient bool
+
+	// ClientScheme and ClientPort override the scheme and the port of ClientURL if not empty or 0,
+	// e.g. where the clients reach the member through a proxy on another port.
+	// They don't change the URLs the member listens on.
+	ClientScheme string
+	ClientPort   int
 }
 
 func (m *Member) Addr() string {
@@ -42,7 +51,29 @@ func (m *Member) Addr() string {
 
 // ClientURL is the client URL for this member
 func (m *Member) ClientURL() string {
-	return fmt.Sprintf("%s://%s:2379", m.clientScheme(), m.Addr())
+	scheme := m.ClientScheme
+	if len(scheme) == 0 {
+		scheme = m.clientScheme()
+	}
+	port := m.ClientPort
+	if port == 0 {
+		port = DefaultClientPort
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, m.Addr(), port)
+}
+
+// ValidateClientEndpoint returns an error if the members can't be reached at the given client scheme and port.
+// An empty scheme is the default scheme.
+func ValidateClientEndpoint(scheme string, port int) error {
+	switch scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("unsupported client scheme (%s), want http or https", scheme)
+	}
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid client port (%d)", port)
+	}
+	return nil
 }
 
 func (m *Member) clientScheme() string {
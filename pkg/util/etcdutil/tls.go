@@ -16,6 +16,7 @@ package etcdutil
 
 import (
 	"crypto/tls"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -61,6 +62,38 @@ func NewTLSConfig(certData, keyData, caData []byte) (*tls.Config, error) {
 	return tlsConfig, nil
 }
 
+// ServerTLSConfig returns the server side of the given etcd client TLS config: the server presents
+// the client certificate and only accepts clients with a certificate signed by the same CA,
+// i.e. the same credentials as the communication with the etcd cluster.
+func ServerTLSConfig(tc *tls.Config) *tls.Config {
+	return &tls.Config{
+		Certificates:   tc.Certificates,
+		GetCertificate: tc.GetCertificate,
+		ClientCAs:      tc.RootCAs,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// ReloadingServerTLSConfig is ServerTLSConfig of the client TLS config returned by get at each handshake,
+// so that the server presents and accepts the rotated credentials without a restart.
+func ReloadingServerTLSConfig(get func() *tls.Config) *tls.Config {
+	return &tls.Config{
+		// the certificate is given by GetConfigForClient, this only tells the server it has one.
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			tc := get()
+			if len(tc.Certificates) == 0 {
+				return nil, errors.New("no certificate in the TLS config")
+			}
+			return &tc.Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return ServerTLSConfig(get()), nil
+		},
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
 func writeFile(dir, file string, data []byte) (string, error) {
 	p := filepath.Join(dir, file)
 	return p, ioutil.WriteFile(p, data, 0600)
@@ -0,0 +1,53 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+// ParseVersion parses an etcd version like "3.4.13", "v3.5.0" or "3.5.0-rc.1".
+func ParseVersion(v string) (major, minor, patch int, err error) {
+	sv, err := semver.NewVersion(strings.TrimPrefix(v, "v"))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid etcd version (%s): %v", v, err)
+	}
+	return int(sv.Major), int(sv.Minor), int(sv.Patch), nil
+}
+
+// versionAtLeast tells whether the etcd version v is at least major.minor.
+// An invalid version is assumed to be older, so that the code path of the older versions is kept.
+func versionAtLeast(v string, major, minor int) bool {
+	vmajor, vminor, _, err := ParseVersion(v)
+	if err != nil {
+		return false
+	}
+	return vmajor > major || vmajor == major && vminor >= minor
+}
+
+// SnapshotHasHash tells whether the snapshots sent by etcd of version v end with the SHA-256 hash
+// of the database, which etcd appends since 3.1.
+func SnapshotHasHash(v string) bool {
+	return versionAtLeast(v, 3, 1)
+}
+
+// RestoresWithEtcdutl tells whether snapshots are restored with etcdutl for etcd of version v.
+// etcdutl took over the offline commands of etcdctl in 3.5, where `etcdctl snapshot restore` is deprecated.
+func RestoresWithEtcdutl(v string) bool {
+	return versionAtLeast(v, 3, 5)
+}
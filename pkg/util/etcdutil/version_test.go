@@ -0,0 +1,70 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdutil
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		v                   string
+		major, minor, patch int
+		wErr                bool
+	}{
+		{v: "3.1.8", major: 3, minor: 1, patch: 8},
+		{v: "v3.5.0", major: 3, minor: 5},
+		{v: "3.5.0-rc.1", major: 3, minor: 5},
+		{v: "3.4", wErr: true},
+		{v: "", wErr: true},
+	}
+	for i, tt := range tests {
+		major, minor, patch, err := ParseVersion(tt.v)
+		if tt.wErr {
+			if err == nil {
+				t.Errorf("#%d: should be error case", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%d: want err = nil, got %v", i, err)
+		}
+		if major != tt.major || minor != tt.minor || patch != tt.patch {
+			t.Errorf("#%d: version = %d.%d.%d, want %d.%d.%d", i, major, minor, patch, tt.major, tt.minor, tt.patch)
+		}
+	}
+}
+
+func TestVersionGates(t *testing.T) {
+	tests := []struct {
+		v                    string
+		hash, etcdutlRestore bool
+	}{
+		{v: "3.0.17"},
+		{v: "3.1.8", hash: true},
+		{v: "3.3.25", hash: true},
+		{v: "3.4.13", hash: true},
+		{v: "v3.5.0", hash: true, etcdutlRestore: true},
+		{v: "4.0.0", hash: true, etcdutlRestore: true},
+		// an invalid version takes the code path of the older versions.
+		{v: "latest"},
+	}
+	for _, tt := range tests {
+		if got := SnapshotHasHash(tt.v); got != tt.hash {
+			t.Errorf("SnapshotHasHash(%q) = %v, want %v", tt.v, got, tt.hash)
+		}
+		if got := RestoresWithEtcdutl(tt.v); got != tt.etcdutlRestore {
+			t.Errorf("RestoresWithEtcdutl(%q) = %v, want %v", tt.v, got, tt.etcdutlRestore)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsfactory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/credentials"
+	"github.com/coreos/etcd-operator/pkg/util/gcputil"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// GCSClient is a wrapper for GCS client that provides cleanup functionality.
+type GCSClient struct {
+	GCS *storage.Client
+	// Identity describes the GCP identity the client authenticates as, for error messages.
+	Identity string
+	// ClientEmail and PrivateKey are the email and the private key of the service account key
+	// the client authenticates with. They are empty with the Application Default Credentials.
+	ClientEmail string
+	PrivateKey  []byte
+}
+
+// NewClient returns a GCS client with the credentials of the given source:
+// the service account key in its GCP secret, the Application Default Credentials if it uses them,
+// or the access tokens from Vault if it is configured with it.
+func NewClient(kubecli kubernetes.Interface, namespace string, gcs *api.GCSSource) (*GCSClient, error) {
+	if gcs.UseApplicationDefaultCredentials {
+		return NewClientFromADC()
+	}
+	if gcs.Vault != nil {
+		p, err := credentials.NewVaultCredentialProvider(kubecli, namespace, credentials.EngineGCP, gcs.Vault)
+		if err != nil {
+			return nil, fmt.Errorf("new GCS client failed: %v", err)
+		}
+		return NewClientFromProvider(p, fmt.Sprintf("the access token of vault roleset (%s)", gcs.Vault.Role))
+	}
+	return NewClientFromSecret(kubecli, namespace, gcs.GCPSecret)
+}
+
+// NewClientFromADC returns a GCS client with the Application Default Credentials,
+// which GKE Workload Identity provides through the metadata server.
+func NewClientFromADC() (w *GCSClient, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("new GCS client failed: %v", err)
+		}
+	}()
+	cli, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &GCSClient{GCS: cli, Identity: adcIdentity()}, nil
+}
+
+// NewClientFromProvider returns a GCS client with the access tokens of p, e.g. short-lived tokens from Vault.
+// identity describes who the tokens belong to, for error messages.
+func NewClientFromProvider(p credentials.CredentialProvider, identity string) (*GCSClient, error) {
+	cli, err := storage.NewClient(context.Background(), option.WithTokenSource(credentials.NewTokenSource(p)))
+	if err != nil {
+		return nil, fmt.Errorf("new GCS client failed: %v", err)
+	}
+	return &GCSClient{GCS: cli, Identity: identity}, nil
+}
+
+// NewClientFromSecret returns a GCS client based on given k8s secret containing a GCP service account key.
+func NewClientFromSecret(kubecli kubernetes.Interface, namespace, gcpSecret string) (w *GCSClient, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("new GCS client failed: %v", err)
+		}
+	}()
+	se, err := kubecli.CoreV1().Secrets(namespace).Get(gcpSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get k8s secret failed: %v", err)
+	}
+	creds := se.Data[api.GCPSecretCredentialsFileName]
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("secret (%s) has no '%s' entry", gcpSecret, api.GCPSecretCredentialsFileName)
+	}
+	cli, err := storage.NewClient(context.Background(), option.WithCredentialsJSON(creds))
+	if err != nil {
+		return nil, err
+	}
+	var key serviceAccountKey
+	json.Unmarshal(creds, &key)
+	return &GCSClient{
+		GCS:         cli,
+		Identity:    secretIdentity(gcpSecret, key),
+		ClientEmail: key.ClientEmail,
+		PrivateKey:  []byte(key.PrivateKey),
+	}, nil
+}
+
+// serviceAccountKey is the JSON key of a GCP service account.
+type serviceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+}
+
+// secretIdentity describes the service account of the JSON key in the given secret.
+func secretIdentity(gcpSecret string, key serviceAccountKey) string {
+	if len(key.ClientEmail) == 0 {
+		return fmt.Sprintf("the service account key in secret (%s)", gcpSecret)
+	}
+	return fmt.Sprintf("service account %s from secret (%s)", key.ClientEmail, gcpSecret)
+}
+
+// adcIdentity describes the service account of the Application Default Credentials.
+// Outside GCP it can't be known without loading the credentials.
+func adcIdentity() string {
+	email, err := gcputil.ServiceAccountEmail()
+	if err != nil || len(email) == 0 {
+		return "the application default credentials"
+	}
+	return fmt.Sprintf("service account %s from the application default credentials", email)
+}
+
+// Close cleans up all intermediate resources for creating GCS client.
+func (w *GCSClient) Close() {
+	w.GCS.Close()
+}
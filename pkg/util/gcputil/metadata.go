@@ -0,0 +1,90 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcputil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// metadataHostEnv is the environment variable the Google client libraries use to override the metadata server address.
+	metadataHostEnv     = "GCE_METADATA_HOST"
+	defaultMetadataHost = "metadata.google.internal"
+
+	// clusterNamePath is only served by the GKE metadata server.
+	clusterNamePath = "/computeMetadata/v1/instance/attributes/cluster-name"
+	// serviceAccountEmailPath serves the email of the GCP service account whose credentials
+	// the metadata server provides, which is the Workload Identity one inside a pod.
+	serviceAccountEmailPath = "/computeMetadata/v1/instance/service-accounts/default/email"
+
+	metadataProbeTimeout = 2 * time.Second
+)
+
+// OnGKE returns true if the GKE metadata server is reachable.
+// Inside a pod with Workload Identity enabled, the metadata server provides the credentials
+// of the GCP service account bound to the pod's Kubernetes service account.
+func OnGKE() bool {
+	return probeMetadataServer(metadataURL(clusterNamePath))
+}
+
+// ServiceAccountEmail returns the email of the GCP service account the metadata server provides credentials for.
+func ServiceAccountEmail() (string, error) {
+	req, err := http.NewRequest("GET", metadataURL(serviceAccountEmailPath), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	cli := &http.Client{Timeout: metadataProbeTimeout}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from metadata server: %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func metadataURL(path string) string {
+	host := os.Getenv(metadataHostEnv)
+	if len(host) == 0 {
+		host = defaultMetadataHost
+	}
+	return "http://" + host + path
+}
+
+func probeMetadataServer(url string) bool {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	cli := &http.Client{Timeout: metadataProbeTimeout}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK && resp.Header.Get("Metadata-Flavor") == "Google"
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOnGKE(t *testing.T) {
+	tests := []struct {
+		flavor string
+		code   int
+		want   bool
+	}{
+		{"Google", http.StatusOK, true},
+		// The GCE metadata server doesn't serve the cluster name.
+		{"Google", http.StatusNotFound, false},
+		// Not a metadata server.
+		{"", http.StatusOK, false},
+	}
+	defer os.Unsetenv(metadataHostEnv)
+	for i, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != clusterNamePath || r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if len(tt.flavor) != 0 {
+				w.Header().Set("Metadata-Flavor", tt.flavor)
+			}
+			w.WriteHeader(tt.code)
+		}))
+		os.Setenv(metadataHostEnv, strings.TrimPrefix(srv.URL, "http://"))
+		if got := OnGKE(); got != tt.want {
+			t.Errorf("#%d: OnGKE() = %v, want %v", i, got, tt.want)
+		}
+		srv.Close()
+	}
+
+	// Nothing is listening.
+	os.Setenv(metadataHostEnv, "127.0.0.1:1")
+	if OnGKE() {
+		t.Error("OnGKE() = true without a metadata server")
+	}
+}
+
+func TestServiceAccountEmail(t *testing.T) {
+	const email = "backup@project.iam.gserviceaccount.com"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != serviceAccountEmailPath || r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(email))
+	}))
+	defer srv.Close()
+	defer os.Unsetenv(metadataHostEnv)
+
+	os.Setenv(metadataHostEnv, strings.TrimPrefix(srv.URL, "http://"))
+	got, err := ServiceAccountEmail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != email {
+		t.Errorf("ServiceAccountEmail() = %q, want %q", got, email)
+	}
+
+	os.Setenv(metadataHostEnv, "127.0.0.1:1")
+	if _, err = ServiceAccountEmail(); err == nil {
+		t.Error("expect error without a metadata server")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/backup/backupapi"
 	backupenv "github.com/coreos/etcd-operator/pkg/backup/env"
 	"github.com/coreos/etcd-operator/pkg/util/constants"
 	"github.com/coreos/etcd-operator/pkg/util/retryutil"
@@ -36,7 +37,7 @@ import (
 const (
 	BackupPodSelectorAppField = "etcd_backup_tool"
 	backupPVVolName           = "etcd-backup-storage"
-	awsCredentialDir          = "/root/.aws/"
+	AWSCredentialDir          = "/root/.aws/"
 	awsSecretVolName          = "secret-aws"
 	fromDirMountDir           = "/mnt/backup/from"
 
@@ -107,19 +108,23 @@ func PodSpecWithPV(ps *v1.PodSpec, clusterName string) {
 	}}
 }
 
+// AttachS3ToPodSpec attaches the S3 bucket and the AWS secret to a Pod. Without a secret,
+// the pod gets its credentials from the default AWS credential chain, e.g. the IAM role of its service account.
 func AttachS3ToPodSpec(ps *v1.PodSpec, ss api.S3Source) {
-	ps.Containers[0].VolumeMounts = append(ps.Containers[0].VolumeMounts, v1.VolumeMount{
-		Name:      awsSecretVolName,
-		MountPath: awsCredentialDir,
-	})
-	ps.Volumes = append(ps.Volumes, v1.Volume{
-		Name: awsSecretVolName,
-		VolumeSource: v1.VolumeSource{
-			Secret: &v1.SecretVolumeSource{
-				SecretName: ss.AWSSecret,
+	if len(ss.AWSSecret) != 0 {
+		ps.Containers[0].VolumeMounts = append(ps.Containers[0].VolumeMounts, v1.VolumeMount{
+			Name:      awsSecretVolName,
+			MountPath: AWSCredentialDir,
+		})
+		ps.Volumes = append(ps.Volumes, v1.Volume{
+			Name: awsSecretVolName,
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{
+					SecretName: ss.AWSSecret,
+				},
 			},
-		},
-	})
+		})
+	}
 	ps.Containers[0].Env = append(ps.Containers[0].Env, v1.EnvVar{
 		Name:  backupenv.AWSS3Bucket,
 		Value: ss.S3Bucket,
@@ -155,6 +160,11 @@ func NewBackupPodTemplate(clusterName, account string, sp api.ClusterSpec) v1.Po
 		panic("unexpected json error " + err.Error())
 	}
 
+	healthPort := constants.DefaultBackupPodHTTPPort
+	if sp.Backup.HTTPClientCertAuth {
+		// the kubelet probes can't present a client certificate to the HTTP API.
+		healthPort = constants.DefaultBackupPodHealthPort
+	}
 	ps := v1.PodSpec{
 		ServiceAccountName: account,
 		Containers: []v1.Container{
@@ -172,6 +182,8 @@ func NewBackupPodTemplate(clusterName, account string, sp api.ClusterSpec) v1.Po
 					Name:  backupenv.ClusterSpec,
 					Value: string(b),
 				}},
+				LivenessProbe:  backupSidecarProbe(backupapi.HealthzPath, healthPort),
+				ReadinessProbe: backupSidecarProbe(backupapi.ReadyzPath, healthPort),
 			},
 		},
 	}
@@ -189,6 +201,23 @@ func NewBackupPodTemplate(clusterName, account string, sp api.ClusterSpec) v1.Po
 	return pl
 }
 
+// backupSidecarProbe returns the probe of the backup sidecar that checks the given health path on the given port.
+// The readiness check saves a probe file to the storage, so the probes are infrequent.
+func backupSidecarProbe(path string, port int) *v1.Probe {
+	return &v1.Probe{
+		Handler: v1.Handler{
+			HTTPGet: &v1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromInt(port),
+			},
+		},
+		InitialDelaySeconds: 10,
+		TimeoutSeconds:      10,
+		PeriodSeconds:       60,
+		FailureThreshold:    3,
+	}
+}
+
 func NewBackupDeploymentManifest(name string, dplSel map[string]string, pl v1.PodTemplateSpec, owner metav1.OwnerReference) *appsv1beta1.Deployment {
 	d := &appsv1beta1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -224,6 +253,12 @@ func NewBackupServiceManifest(clusterName string, owner metav1.OwnerReference) *
 					TargetPort: intstr.FromInt(constants.DefaultBackupPodHTTPPort),
 					Protocol:   v1.ProtocolTCP,
 				},
+				{
+					Name:       "backup-snapshot",
+					Port:       constants.DefaultBackupPodSnapshotPort,
+					TargetPort: intstr.FromInt(constants.DefaultBackupPodSnapshotPort),
+					Protocol:   v1.ProtocolTCP,
+				},
 			},
 			Selector: selector,
 		},
@@ -58,6 +58,33 @@ func MemberUpgradedEvent(memberName, oldVersion, newVersion string, cl *api.Etcd
 	return event
 }
 
+// MemberRestartedEvent tells that the member is replaced to apply the etcd configuration of the spec.
+func MemberRestartedEvent(memberName string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Member Restarted"
+	event.Message = fmt.Sprintf("Member %s is being replaced to apply the etcd configuration", memberName)
+	return event
+}
+
+// MemberStorageExpandingEvent tells that the PersistentVolumeClaim of the member is being expanded to the given size.
+func MemberStorageExpandingEvent(memberName, size string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeNormal
+	event.Reason = "Member Storage Expanding"
+	event.Message = fmt.Sprintf("The storage of member %s is being expanded to %s", memberName, size)
+	return event
+}
+
+// TopologySpreadWarningEvent warns that the members of the cluster can't be spread as its topologySpread asks.
+func TopologySpreadWarningEvent(msg string, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Topology Spread Unsatisfiable"
+	event.Message = msg
+	return event
+}
+
 func newClusterEvent(cl *api.EtcdCluster) *v1.Event {
 	t := time.Now()
 	return &v1.Event{
@@ -82,3 +109,13 @@ func newClusterEvent(cl *api.EtcdCluster) *v1.Event {
 		Count:          int32(1),
 	}
 }
+
+// DisruptionBudgetBelowQuorumEvent warns that the PodDisruptionBudget of the cluster was modified to keep
+// fewer members available than quorum needs.
+func DisruptionBudgetBelowQuorumEvent(minAvailable, quorum int, cl *api.EtcdCluster) *v1.Event {
+	event := newClusterEvent(cl)
+	event.Type = v1.EventTypeWarning
+	event.Reason = "Disruption Budget Below Quorum"
+	event.Message = fmt.Sprintf("PodDisruptionBudget keeps %d members available, quorum needs %d", minAvailable, quorum)
+	return event
+}
@@ -15,11 +15,13 @@
 package k8sutil
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -59,6 +61,14 @@ const (
 
 const TolerateUnreadyEndpointsAnnotation = "service.alpha.kubernetes.io/tolerate-unready-endpoints"
 
+// MemberBackupPriorityAnnotation is the backup priority of a member pod. The backup sidecar takes the snapshots
+// from the follower of the highest priority greater than 0, if its revision is recent enough, to spare the leader.
+const MemberBackupPriorityAnnotation = "etcd.database.coreos.com/backup-priority"
+
+// EtcdConfigAnnotation is the hash of the etcd configuration of the spec a member pod was created with.
+// See EtcdConfigHash.
+const EtcdConfigAnnotation = "etcd.database.coreos.com/config-hash"
+
 func GetEtcdVersion(pod *v1.Pod) string {
 	return pod.Annotations[etcdVersionAnnotationKey]
 }
@@ -67,6 +77,38 @@ func SetEtcdVersion(pod *v1.Pod, version string) {
 	pod.Annotations[etcdVersionAnnotationKey] = version
 }
 
+// GetMemberBackupPriority returns the backup priority the pod is annotated with, or 0 if it has none or it is invalid.
+func GetMemberBackupPriority(pod *v1.Pod) int {
+	p, err := strconv.Atoi(pod.Annotations[MemberBackupPriorityAnnotation])
+	if err != nil {
+		return 0
+	}
+	return p
+}
+
+// EtcdConfigHash returns the hash of the etcd configuration of cs which can't be applied to a running member:
+// the environment and the resource requirements of the etcd container.
+func EtcdConfigHash(cs api.ClusterSpec) string {
+	var cfg struct {
+		Env       []v1.EnvVar             `json:"env,omitempty"`
+		Resources v1.ResourceRequirements `json:"resources"`
+	}
+	if cs.Pod != nil {
+		cfg.Env, cfg.Resources = cs.Pod.EtcdEnv, cs.Pod.Resources
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		panic("unexpected etcd configuration marshal error: " + err.Error())
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b))[:16]
+}
+
+// GetEtcdConfigHash returns the hash of the etcd configuration the pod was created with,
+// or empty if it was created before the hash was recorded.
+func GetEtcdConfigHash(pod *v1.Pod) string {
+	return pod.Annotations[EtcdConfigAnnotation]
+}
+
 func GetPodNames(pods []*v1.Pod) []string {
 	if len(pods) == 0 {
 		return nil
@@ -78,28 +120,44 @@ func GetPodNames(pods []*v1.Pod) []string {
 	return res
 }
 
+// makeRestoreInitContainers returns the init containers that fetch the backup and restore the data dir of m from it.
+// The restore replaces the membership stored in the snapshot with m alone, so a backup taken from a cluster
+// in another namespace, whose member URLs name that namespace, is restored as is.
+// See doc/design/cluster_restore.md.
 func makeRestoreInitContainers(backupURL *url.URL, token, baseImage, version string, m *etcdutil.Member) []v1.Container {
+	fetchCmd := fmt.Sprintf("curl -o %s %s", backupFile, backupURL.String())
+	fetchMounts := etcdVolumeMounts()
+	if backupURL.Scheme == "https" {
+		// the backup sidecar requires the client certificate of the operator secret, which secure client pods mount.
+		fetchCmd = fmt.Sprintf("curl --cert %[1]s/%[2]s --key %[1]s/%[3]s --cacert %[1]s/%[4]s -o %[5]s %[6]s",
+			operatorEtcdTLSDir, etcdutil.CliCertFile, etcdutil.CliKeyFile, etcdutil.CliCAFile, backupFile, backupURL.String())
+		fetchMounts = append(fetchMounts, v1.VolumeMount{MountPath: operatorEtcdTLSDir, Name: operatorEtcdTLSVolume})
+	}
+	restoreCmd := "ETCDCTL_API=3 etcdctl snapshot restore"
+	if etcdutil.RestoresWithEtcdutl(version) {
+		restoreCmd = "etcdutl snapshot restore"
+	}
 	return []v1.Container{
 		{
 			Name:  "fetch-backup",
 			Image: "tutum/curl",
 			Command: []string{
 				"/bin/sh", "-ec",
-				fmt.Sprintf("curl -o %s %s", backupFile, backupURL.String()),
+				fetchCmd,
 			},
-			VolumeMounts: etcdVolumeMounts(),
+			VolumeMounts: fetchMounts,
 		},
 		{
 			Name:  "restore-datadir",
 			Image: ImageName(baseImage, version),
 			Command: []string{
 				"/bin/sh", "-ec",
-				fmt.Sprintf("ETCDCTL_API=3 etcdctl snapshot restore %[1]s"+
+				fmt.Sprintf("%[6]s %[1]s"+
 					" --name %[2]s"+
 					" --initial-cluster %[2]s=%[3]s"+
 					" --initial-cluster-token %[4]s"+
 					" --initial-advertise-peer-urls %[3]s"+
-					" --data-dir %[5]s", backupFile, m.Name, m.PeerURL(), token, dataDir),
+					" --data-dir %[5]s", backupFile, m.Name, m.PeerURL(), token, dataDir, restoreCmd),
 			},
 			VolumeMounts: etcdVolumeMounts(),
 		},
@@ -259,8 +317,14 @@ func NewEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state,
 		container = containerWithRequirements(container, cs.Pod.Resources)
 	}
 
+	dataVolume := v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}
+	if cs.Storage != nil {
+		dataVolume = v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+			ClaimName: EtcdPVCName(m.Name),
+		}}
+	}
 	volumes := []v1.Volume{
-		{Name: "etcd-data", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+		{Name: "etcd-data", VolumeSource: dataVolume},
 	}
 
 	if m.SecurePeer {
@@ -306,8 +370,12 @@ func NewEtcdPod(m *etcdutil.Member, initialCluster []string, clusterName, state,
 	}
 
 	applyPodPolicy(clusterName, pod, cs.Pod)
+	if cs.TopologySpread != nil {
+		pod = podWithTopologySpread(pod, clusterName, cs.TopologySpread)
+	}
 
 	SetEtcdVersion(pod, cs.Version)
+	pod.Annotations[EtcdConfigAnnotation] = EtcdConfigHash(cs)
 
 	addOwnerRefToObject(pod.GetObjectMeta(), owner)
 	return pod
@@ -0,0 +1,102 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"strconv"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PDBMinAvailableAnnotation records the minAvailable the operator created the PodDisruptionBudget of
+// a cluster with. A PodDisruptionBudget whose minAvailable differs from it was modified by hand.
+const PDBMinAvailableAnnotation = "etcd.database.coreos.com/pdb-min-available"
+
+// QuorumSize returns the number of members of a cluster of the given size needed to keep quorum.
+func QuorumSize(size int) int {
+	return size/2 + 1
+}
+
+// NewEtcdPDB returns the PodDisruptionBudget that keeps a quorum of the members of the cluster available.
+func NewEtcdPDB(clusterName string, size int, owner metav1.OwnerReference) *policyv1beta1.PodDisruptionBudget {
+	quorum := QuorumSize(size)
+	minAvailable := intstr.FromInt(quorum)
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   clusterName,
+			Labels: LabelsForCluster(clusterName),
+			Annotations: map[string]string{
+				PDBMinAvailableAnnotation: strconv.Itoa(quorum),
+			},
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: LabelsForCluster(clusterName),
+			},
+		},
+	}
+	addOwnerRefToObject(pdb.GetObjectMeta(), owner)
+	return pdb
+}
+
+// IsPDBModified returns true if the given PodDisruptionBudget was not created by the operator,
+// or its minAvailable was changed since.
+func IsPDBModified(pdb *policyv1beta1.PodDisruptionBudget) bool {
+	recorded, ok := pdb.Annotations[PDBMinAvailableAnnotation]
+	if !ok || pdb.Spec.MinAvailable == nil || pdb.Spec.MaxUnavailable != nil {
+		return true
+	}
+	return pdb.Spec.MinAvailable.String() != recorded
+}
+
+// PDBMinAvailable returns the number of pods out of size the given PodDisruptionBudget keeps available.
+// Percentages are rounded the way the disruption controller does.
+func PDBMinAvailable(pdb *policyv1beta1.PodDisruptionBudget, size int) (int, error) {
+	if pdb.Spec.MinAvailable != nil {
+		return intstr.GetValueFromIntOrPercent(pdb.Spec.MinAvailable, size, true)
+	}
+	if pdb.Spec.MaxUnavailable != nil {
+		maxUnavailable, err := intstr.GetValueFromIntOrPercent(pdb.Spec.MaxUnavailable, size, true)
+		if err != nil {
+			return 0, err
+		}
+		return size - maxUnavailable, nil
+	}
+	return 0, nil
+}
+
+// CreateEtcdPDB creates the PodDisruptionBudget of a cluster.
+// It is not an error if the PodDisruptionBudget already exists.
+func CreateEtcdPDB(kubecli kubernetes.Interface, ns string, pdb *policyv1beta1.PodDisruptionBudget) error {
+	_, err := kubecli.PolicyV1beta1().PodDisruptionBudgets(ns).Create(pdb)
+	if err != nil && !IsKubernetesResourceAlreadyExistError(err) {
+		return err
+	}
+	return nil
+}
+
+// DeleteEtcdPDB deletes the PodDisruptionBudget of a cluster.
+// It is not an error if the PodDisruptionBudget does not exist.
+func DeleteEtcdPDB(kubecli kubernetes.Interface, ns, clusterName string) error {
+	err := kubecli.PolicyV1beta1().PodDisruptionBudgets(ns).Delete(clusterName, nil)
+	if err != nil && !IsKubernetesResourceNotFoundError(err) {
+		return err
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ package k8sutil
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
 	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
@@ -112,6 +113,32 @@ func podWithAntiAffinity(pod *v1.Pod, ls *metav1.LabelSelector) *v1.Pod {
 	return pod
 }
 
+// podWithTopologySpread spreads the pod apart from the other members of the cluster across the values of
+// the topology key of tp, with a required or preferred pod anti-affinity term as tp.WhenUnsatisfiable tells.
+// The terms are added to the anti-affinity of the pod, e.g. the one of PodPolicy.AntiAffinity.
+func podWithTopologySpread(pod *v1.Pod, clusterName string, tp *api.TopologySpreadPolicy) *v1.Pod {
+	term := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{
+			"etcd_cluster": clusterName,
+		}},
+		TopologyKey: tp.TopologyKey,
+	}
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &v1.Affinity{}
+	}
+	if pod.Spec.Affinity.PodAntiAffinity == nil {
+		pod.Spec.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{}
+	}
+	aa := pod.Spec.Affinity.PodAntiAffinity
+	if tp.IsRequired() {
+		aa.RequiredDuringSchedulingIgnoredDuringExecution = append(aa.RequiredDuringSchedulingIgnoredDuringExecution, term)
+	} else {
+		aa.PreferredDuringSchedulingIgnoredDuringExecution = append(aa.PreferredDuringSchedulingIgnoredDuringExecution,
+			v1.WeightedPodAffinityTerm{Weight: 100, PodAffinityTerm: term})
+	}
+	return pod
+}
+
 func applyPodPolicy(clusterName string, pod *v1.Pod, policy *api.PodPolicy) {
 	if policy == nil {
 		return
@@ -132,6 +159,12 @@ func applyPodPolicy(clusterName string, pod *v1.Pod, policy *api.PodPolicy) {
 	}
 
 	mergeLabels(pod.Labels, policy.Labels)
+	if policy.BackupPriority > 0 {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[MemberBackupPriorityAnnotation] = strconv.Itoa(policy.BackupPriority)
+	}
 
 	for i := range pod.Spec.Containers {
 		if pod.Spec.Containers[i].Name == "etcd" {
@@ -167,6 +200,16 @@ func IsPodReady(pod *v1.Pod) bool {
 	return condition != nil && condition.Status == v1.ConditionTrue
 }
 
+// IsEtcdContainerReady returns true if the etcd container of the pod reports ready.
+func IsEtcdContainerReady(pod *v1.Pod) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == "etcd" {
+			return cs.Ready
+		}
+	}
+	return false
+}
+
 func getPodReadyCondition(status *v1.PodStatus) *v1.PodCondition {
 	for i := range status.Conditions {
 		if status.Conditions[i].Type == v1.PodReady {
@@ -0,0 +1,95 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EtcdPVCName returns the name of the PersistentVolumeClaim the data of the given member is stored on.
+func EtcdPVCName(memberName string) string {
+	return memberName + "-data"
+}
+
+// NewEtcdPVC returns the PersistentVolumeClaim the data of the given member is stored on.
+func NewEtcdPVC(m *etcdutil.Member, clusterName string, ss *api.StorageSpec, owner metav1.OwnerReference) *v1.PersistentVolumeClaim {
+	labels := LabelsForCluster(clusterName)
+	labels["etcd_node"] = m.Name
+
+	accessMode := ss.AccessMode
+	if len(accessMode) == 0 {
+		accessMode = v1.ReadWriteOnce
+	}
+
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   EtcdPVCName(m.Name),
+			Labels: labels,
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{accessMode},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceStorage: ss.RequestedSize.DeepCopy(),
+				},
+			},
+		},
+	}
+	if len(ss.StorageClassName) != 0 {
+		sc := ss.StorageClassName
+		pvc.Spec.StorageClassName = &sc
+	}
+	addOwnerRefToObject(pvc.GetObjectMeta(), owner)
+	return pvc
+}
+
+// CreateEtcdPVC creates the PersistentVolumeClaim of the given member.
+// It is not an error if the PersistentVolumeClaim already exists.
+func CreateEtcdPVC(kubecli kubernetes.Interface, ns string, pvc *v1.PersistentVolumeClaim) error {
+	_, err := kubecli.CoreV1().PersistentVolumeClaims(ns).Create(pvc)
+	if err != nil && !IsKubernetesResourceAlreadyExistError(err) {
+		return err
+	}
+	return nil
+}
+
+// DeleteEtcdPVC deletes the PersistentVolumeClaim of the given member.
+// It is not an error if the PersistentVolumeClaim does not exist.
+func DeleteEtcdPVC(kubecli kubernetes.Interface, ns, memberName string) error {
+	err := kubecli.CoreV1().PersistentVolumeClaims(ns).Delete(EtcdPVCName(memberName), nil)
+	if err != nil && !IsKubernetesResourceNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+// PVCStorageExpanding returns true if the capacity of the given PersistentVolumeClaim is
+// still below its requested size, that is its volume or filesystem is not expanded yet.
+func PVCStorageExpanding(pvc *v1.PersistentVolumeClaim) bool {
+	if pvc.Status.Phase != v1.ClaimBound {
+		return false
+	}
+	requested, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	if !ok {
+		return false
+	}
+	capacity := pvc.Status.Capacity[v1.ResourceStorage]
+	return capacity.Cmp(requested) < 0
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// BackupSidecarServiceAccountName is the name of the ServiceAccount, Role and RoleBinding generated for
+// the backup sidecar of the given cluster.
+func BackupSidecarServiceAccountName(clusterName string) string {
+	return BackupSidecarName(clusterName)
+}
+
+// NewBackupSidecarServiceAccount returns the ServiceAccount of the backup sidecar of the given cluster.
+func NewBackupSidecarServiceAccount(clusterName string, owner metav1.OwnerReference) *v1.ServiceAccount {
+	sa := &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   BackupSidecarServiceAccountName(clusterName),
+			Labels: LabelsForCluster(clusterName),
+		},
+	}
+	addOwnerRefToObject(sa.GetObjectMeta(), owner)
+	return sa
+}
+
+// NewBackupSidecarRole returns the Role with the permissions the backup sidecar of the given cluster needs:
+// listing the member pods, reading its EtcdCluster and its Secrets, recording its events, and, if the backup
+// metadata is recorded, writing its ConfigMap.
+func NewBackupSidecarRole(clusterName string, cs api.ClusterSpec, owner metav1.OwnerReference) *rbacv1.Role {
+	rules := []rbacv1.PolicyRule{{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"list"},
+	}, {
+		APIGroups: []string{""},
+		Resources: []string{"events"},
+		Verbs:     []string{"create", "patch"},
+	}, {
+		APIGroups:     []string{api.SchemeGroupVersion.Group},
+		Resources:     []string{api.EtcdClusterResourcePlural},
+		ResourceNames: []string{clusterName},
+		Verbs:         []string{"get"},
+	}}
+
+	var secrets []string
+	if cs.TLS.IsSecureClient() {
+		secrets = append(secrets, cs.TLS.Static.OperatorSecret)
+	}
+	if bp := cs.Backup; bp != nil {
+		if e := bp.Encryption; e != nil && len(e.SecretName) != 0 {
+			secrets = append(secrets, e.SecretName)
+		}
+		if len(bp.AuthSecret) != 0 {
+			secrets = append(secrets, bp.AuthSecret)
+		}
+		if bp.RecordMetadata {
+			rules = append(rules, rbacv1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"configmaps"},
+				Verbs:     []string{"get", "create", "update"},
+			})
+		}
+	}
+	if len(secrets) != 0 {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: secrets,
+			Verbs:         []string{"get"},
+		})
+	}
+	if cs.TLS.IsSecureClient() {
+		// the rotation of the operator secret is watched, and list and watch can't be limited to a name.
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"secrets"},
+			Verbs:     []string{"list", "watch"},
+		})
+	}
+
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   BackupSidecarServiceAccountName(clusterName),
+			Labels: LabelsForCluster(clusterName),
+		},
+		Rules: rules,
+	}
+	addOwnerRefToObject(role.GetObjectMeta(), owner)
+	return role
+}
+
+// NewBackupSidecarRoleBinding returns the RoleBinding granting the Role of the backup sidecar of the given cluster
+// to its ServiceAccount in the given namespace.
+func NewBackupSidecarRoleBinding(clusterName, ns string, owner metav1.OwnerReference) *rbacv1.RoleBinding {
+	name := BackupSidecarServiceAccountName(clusterName)
+	rb := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: LabelsForCluster(clusterName),
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      name,
+			Namespace: ns,
+		}},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     name,
+		},
+	}
+	addOwnerRefToObject(rb.GetObjectMeta(), owner)
+	return rb
+}
+
+// CreateBackupSidecarRBAC creates the ServiceAccount, the Role and the RoleBinding of the backup sidecar of
+// the given cluster, or updates the rules of its Role if they already exist.
+func CreateBackupSidecarRBAC(kubecli kubernetes.Interface, clusterName, ns string, cs api.ClusterSpec, owner metav1.OwnerReference) error {
+	_, err := kubecli.CoreV1().ServiceAccounts(ns).Create(NewBackupSidecarServiceAccount(clusterName, owner))
+	if err != nil && !IsKubernetesResourceAlreadyExistError(err) {
+		return err
+	}
+
+	role := NewBackupSidecarRole(clusterName, cs, owner)
+	roles := kubecli.RbacV1().Roles(ns)
+	_, err = roles.Create(role)
+	if IsKubernetesResourceAlreadyExistError(err) {
+		var old *rbacv1.Role
+		if old, err = roles.Get(role.Name, metav1.GetOptions{}); err == nil {
+			old.Rules = role.Rules
+			_, err = roles.Update(old)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = kubecli.RbacV1().RoleBindings(ns).Create(NewBackupSidecarRoleBinding(clusterName, ns, owner))
+	if err != nil && !IsKubernetesResourceAlreadyExistError(err) {
+		return err
+	}
+	return nil
+}
+
+// DeleteBackupSidecarRBAC deletes the ServiceAccount, the Role and the RoleBinding of the backup sidecar of the given cluster.
+func DeleteBackupSidecarRBAC(kubecli kubernetes.Interface, clusterName, ns string) error {
+	name := BackupSidecarServiceAccountName(clusterName)
+	err := kubecli.RbacV1().RoleBindings(ns).Delete(name, nil)
+	if err != nil && !IsKubernetesResourceNotFoundError(err) {
+		return err
+	}
+	err = kubecli.RbacV1().Roles(ns).Delete(name, nil)
+	if err != nil && !IsKubernetesResourceNotFoundError(err) {
+		return err
+	}
+	err = kubecli.CoreV1().ServiceAccounts(ns).Delete(name, nil)
+	if err != nil && !IsKubernetesResourceNotFoundError(err) {
+		return err
+	}
+	return nil
+}
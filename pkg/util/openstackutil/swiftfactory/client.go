@@ -0,0 +1,75 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swiftfactory
+
+import (
+	"fmt"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/ncw/swift"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultRequestTimeout = 60 * time.Second
+	defaultConnectTimeout = 10 * time.Second
+)
+
+// SwiftClient is a wrapper for Swift client.
+type SwiftClient struct {
+	Swift *swift.Connection
+}
+
+// NewClientFromSecret returns an authenticated Swift client based on given k8s secret containing Keystone v3 credentials.
+// A request to Swift that takes longer than timeout fails; zero means the default timeout.
+func NewClientFromSecret(kubecli kubernetes.Interface, namespace, swiftSecret string, timeout time.Duration) (w *SwiftClient, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("new Swift client failed: %v", err)
+		}
+	}()
+
+	se, err := kubecli.CoreV1().Secrets(namespace).Get(swiftSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get k8s secret: %v", err)
+	}
+	for _, k := range []string{api.SwiftAuthURL, api.SwiftUsername, api.SwiftPassword, api.SwiftDomain, api.SwiftProject} {
+		if len(se.Data[k]) == 0 {
+			return nil, fmt.Errorf("secret (%s) has no '%s' entry", swiftSecret, k)
+		}
+	}
+
+	if timeout == 0 {
+		timeout = defaultRequestTimeout
+	}
+	c := &swift.Connection{
+		AuthVersion:    3,
+		AuthUrl:        string(se.Data[api.SwiftAuthURL]),
+		UserName:       string(se.Data[api.SwiftUsername]),
+		ApiKey:         string(se.Data[api.SwiftPassword]),
+		Domain:         string(se.Data[api.SwiftDomain]),
+		Tenant:         string(se.Data[api.SwiftProject]),
+		Region:         string(se.Data[api.SwiftRegion]),
+		ConnectTimeout: defaultConnectTimeout,
+		Timeout:        timeout,
+	}
+	if err = c.Authenticate(); err != nil {
+		return nil, fmt.Errorf("keystone authentication failed: %v", err)
+	}
+	return &SwiftClient{Swift: c}, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sftpfactory
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	api "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultSSHPort = 22
+	dialTimeout    = 30 * time.Second
+)
+
+// SFTPClient is a wrapper for SFTP client that provides cleanup functionality.
+type SFTPClient struct {
+	SFTP *sftp.Client
+	ssh  *ssh.Client
+}
+
+// NewClientFromSecret returns a SFTP client connected to host:port based on given k8s secret
+// containing the SSH credentials and the host key of the server.
+func NewClientFromSecret(kubecli kubernetes.Interface, namespace, host string, port int, sftpSecret string) (w *SFTPClient, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("new SFTP client failed: %v", err)
+		}
+	}()
+
+	se, err := kubecli.CoreV1().Secrets(namespace).Get(sftpSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get k8s secret: %v", err)
+	}
+	for _, k := range []string{api.SFTPUsername, api.SFTPHostKey} {
+		if len(se.Data[k]) == 0 {
+			return nil, fmt.Errorf("secret (%s) has no '%s' entry", sftpSecret, k)
+		}
+	}
+
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey(se.Data[api.SFTPHostKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host key: %v", err)
+	}
+	var auth []ssh.AuthMethod
+	if key := se.Data[api.SFTPPrivateKey]; len(key) != 0 {
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password := se.Data[api.SFTPPassword]; len(password) != 0 {
+		auth = append(auth, ssh.Password(string(password)))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("secret (%s) has neither '%s' nor '%s' entry", sftpSecret, api.SFTPPrivateKey, api.SFTPPassword)
+	}
+
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	sshcli, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            string(se.Data[api.SFTPUsername]),
+		Auth:            auth,
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         dialTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	cli, err := sftp.NewClient(sshcli)
+	if err != nil {
+		sshcli.Close()
+		return nil, fmt.Errorf("failed to start sftp session: %v", err)
+	}
+	return &SFTPClient{SFTP: cli, ssh: sshcli}, nil
+}
+
+// Close closes the SFTP session and the underlying SSH connection.
+func (w *SFTPClient) Close() {
+	w.SFTP.Close()
+	w.ssh.Close()
+}
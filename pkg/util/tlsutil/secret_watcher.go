@@ -0,0 +1,101 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"crypto/tls"
+	"sync"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// SecretWatcher keeps the etcd client TLS config built from a Secret up to date as the certificates
+// in the Secret are rotated, e.g. by cert-manager, so that its users don't need to be restarted.
+type SecretWatcher struct {
+	kubecli   kubernetes.Interface
+	namespace string
+	name      string
+
+	mu     sync.RWMutex
+	config *tls.Config
+	// resourceVersion is the version of the Secret config was built from.
+	resourceVersion string
+}
+
+// NewSecretWatcher returns a SecretWatcher of the Secret of the given name, holding the etcd client
+// certificate, key and CA as read by k8sutil.GetTLSDataFromSecret. initial is the TLS config
+// built from the Secret already, returned by Config until the Secret is loaded by Run.
+func NewSecretWatcher(kubecli kubernetes.Interface, namespace, name string, initial *tls.Config) *SecretWatcher {
+	return &SecretWatcher{
+		kubecli:   kubecli,
+		namespace: namespace,
+		name:      name,
+		config:    initial,
+	}
+}
+
+// Config returns the TLS config built from the latest version of the Secret.
+// The returned config must not be modified.
+func (w *SecretWatcher) Config() *tls.Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.config
+}
+
+// Run watches the Secret and swaps the TLS config whenever it changes, until stopc is closed.
+func (w *SecretWatcher) Run(stopc <-chan struct{}) {
+	source := cache.NewListWatchFromClient(
+		w.kubecli.CoreV1().RESTClient(),
+		"secrets",
+		w.namespace,
+		fields.OneTermEqualSelector("metadata.name", w.name))
+
+	_, informer := cache.NewInformer(source, &v1.Secret{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			w.update(obj.(*v1.Secret))
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			w.update(newObj.(*v1.Secret))
+		},
+	})
+	informer.Run(stopc)
+}
+
+// update builds the TLS config from secret unless it was built from the same version already.
+// If the certificates of secret are invalid, e.g. while only some of them are rotated, the previous config is kept.
+func (w *SecretWatcher) update(secret *v1.Secret) {
+	w.mu.RLock()
+	unchanged := secret.ResourceVersion == w.resourceVersion
+	w.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	tc, err := etcdutil.NewTLSConfig(secret.Data[etcdutil.CliCertFile], secret.Data[etcdutil.CliKeyFile], secret.Data[etcdutil.CliCAFile])
+	if err != nil {
+		logrus.Errorf("failed to load the TLS certificates of secret %s/%s, keeping the previous ones: %v", w.namespace, w.name, err)
+		return
+	}
+	w.mu.Lock()
+	w.config, w.resourceVersion = tc, secret.ResourceVersion
+	w.mu.Unlock()
+	logrus.Infof("loaded the TLS certificates of secret %s/%s (resource version %s)", w.namespace, w.name, secret.ResourceVersion)
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 The etcd-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newCertSecret returns a Secret of the given resource version holding a self-signed client certificate.
+func newCertSecret(t *testing.T, resourceVersion string) *v1.Secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "etcd-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd-client-tls", ResourceVersion: resourceVersion},
+		Data: map[string][]byte{
+			etcdutil.CliCertFile: cert,
+			etcdutil.CliKeyFile:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+			etcdutil.CliCAFile:   cert,
+		},
+	}
+}
+
+func TestSecretWatcherUpdate(t *testing.T) {
+	initial := &tls.Config{}
+	w := NewSecretWatcher(nil, "default", "etcd-client-tls", initial)
+	if w.Config() != initial {
+		t.Fatal("expect the initial config before the secret is loaded")
+	}
+
+	w.update(newCertSecret(t, "1"))
+	rotated := w.Config()
+	if rotated == initial || len(rotated.Certificates) != 1 {
+		t.Fatalf("expect the config to be built from the secret, got %+v", rotated)
+	}
+
+	// the same version is not loaded again.
+	w.update(newCertSecret(t, "1"))
+	if w.Config() != rotated {
+		t.Error("expect the config of an unchanged secret to be kept")
+	}
+
+	// invalid certificates, e.g. while the secret is half rotated, don't replace the valid ones.
+	invalid := newCertSecret(t, "2")
+	invalid.Data[etcdutil.CliKeyFile] = []byte("invalid")
+	w.update(invalid)
+	if w.Config() != rotated {
+		t.Error("expect the previous config to be kept if the secret is invalid")
+	}
+
+	w.update(newCertSecret(t, "3"))
+	if w.Config() == rotated {
+		t.Error("expect the config to be swapped when the secret is rotated")
+	}
+}